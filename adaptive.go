@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Defaults of the adaptive reporting frequency
+const (
+	adaptiveSustain   = 3
+	adaptiveRestore   = 6
+	adaptiveMaxFactor = 8
+)
+
+// AdaptiveConfig lowers the reporting frequency of the paths while the
+// queues of the worker keep dropping. Every interval seconds the drops are
+// checked, after sustain intervals in a row with drops the sample frequency
+// of the affected paths is divided by two more (up to max-factor) and the
+// paths are resubscribed, after restore intervals without drops it is
+// doubled again. The affected paths are the ones with a priority below the
+// highest priority of the worker, all of them if they share one. Interval 0
+// disables it. IOS-XR subscriptions are configured on the device, so this is
+// Junos only.
+type AdaptiveConfig struct {
+	Interval  int    `json:"interval"`
+	Sustain   int    `json:"sustain"`
+	Restore   int    `json:"restore"`
+	MaxFactor uint64 `json:"max-factor"`
+}
+
+func validateAdaptiveConfig(cfg AdaptiveConfig, vendor string) error {
+	if cfg.Interval > 0 && vendor != "" && vendor != "juniper-junos" {
+		return fmt.Errorf("adaptive reporting frequency is not supported for vendor %s", vendor)
+	}
+	if cfg.Interval < 0 || cfg.Sustain < 0 || cfg.Restore < 0 {
+		return fmt.Errorf("adaptive interval, sustain and restore can not be negative")
+	}
+	if cfg.MaxFactor&(cfg.MaxFactor-1) != 0 {
+		return fmt.Errorf("adaptive max-factor %d is not a power of two", cfg.MaxFactor)
+	}
+	return nil
+}
+
+// adaptive tracks the drops of a worker and the factor its reporting
+// frequency is lowered by
+type adaptive struct {
+	sync.Mutex
+	sustain   int
+	restore   int
+	maxFactor uint64
+	factor    uint64
+	drops     uint64
+	busy      int
+	quiet     int
+	task      *schedTask
+}
+
+func newAdaptive(cfg AdaptiveConfig) *adaptive {
+	a := &adaptive{
+		sustain:   cfg.Sustain,
+		restore:   cfg.Restore,
+		maxFactor: cfg.MaxFactor,
+		factor:    1,
+	}
+	if a.sustain == 0 {
+		a.sustain = adaptiveSustain
+	}
+	if a.restore == 0 {
+		a.restore = adaptiveRestore
+	}
+	if a.maxFactor == 0 {
+		a.maxFactor = adaptiveMaxFactor
+	}
+	return a
+}
+
+// check takes the total drops of the worker so far and tells whether the
+// factor has changed
+func (a *adaptive) check(drops uint64) bool {
+	a.Lock()
+	defer a.Unlock()
+
+	dropped := drops > a.drops
+	a.drops = drops
+	if dropped {
+		a.busy++
+		a.quiet = 0
+		if a.busy >= a.sustain && a.factor < a.maxFactor {
+			a.factor *= 2
+			a.busy = 0
+			return true
+		}
+		return false
+	}
+	a.quiet++
+	a.busy = 0
+	if a.quiet >= a.restore && a.factor > 1 {
+		a.factor /= 2
+		a.quiet = 0
+		return true
+	}
+	return false
+}
+
+// current returns the factor, 1 if a is nil
+func (a *adaptive) current() uint64 {
+	if a == nil {
+		return 1
+	}
+	a.Lock()
+	defer a.Unlock()
+	return a.factor
+}
+
+// adaptiveFreqs returns the sample frequencies of the paths lowered by
+// factor. On-change paths (frequency 0) and the paths with the highest
+// priority, unless all paths have it, keep theirs.
+func adaptiveFreqs(paths []PathsConfig, factor uint64) []uint64 {
+	highest, mixed := 0, false
+	for i, p := range paths {
+		if i > 0 && p.Priority != highest {
+			mixed = true
+		}
+		if p.Priority > highest {
+			highest = p.Priority
+		}
+	}
+
+	freqs := make([]uint64, len(paths))
+	for i, p := range paths {
+		freqs[i] = p.Freq
+		if mixed && p.Priority == highest {
+			continue
+		}
+		freqs[i] *= factor
+	}
+	return freqs
+}
+
+func adaptiveInit(jctx *JCtx) {
+	cfg := jctx.config.Backpressure.Adaptive
+	if cfg.Interval == 0 {
+		return
+	}
+	a := newAdaptive(cfg)
+	jctx.adaptive = a
+	a.task = schedule(time.Duration(cfg.Interval)*time.Second, func() {
+		var drops uint64
+		for _, q := range jctx.drops.queues() {
+			drops += jctx.drops.get(q)
+		}
+		if !a.check(drops) {
+			return
+		}
+		jLogWarn(jctx, fmt.Sprintf("drops of %s:%d, reporting frequency now divided by %d",
+			jctx.config.Host, jctx.config.Port, a.current()))
+		// resubscribe if streaming, otherwise the next connect uses the factor
+		select {
+		case jctx.control <- syscall.SIGHUP:
+		default:
+		}
+	})
+}
+
+func adaptiveStop(jctx *JCtx) {
+	if jctx.adaptive != nil {
+		jctx.adaptive.task.stop()
+	}
+}
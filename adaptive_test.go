@@ -0,0 +1,111 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateAdaptiveConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    AdaptiveConfig
+		vendor string
+		err    bool
+	}{
+		{name: "disabled", cfg: AdaptiveConfig{}},
+		{name: "junos", cfg: AdaptiveConfig{Interval: 10, MaxFactor: 16}, vendor: "juniper-junos"},
+		{name: "default vendor", cfg: AdaptiveConfig{Interval: 10}},
+		{name: "iosxr", cfg: AdaptiveConfig{Interval: 10}, vendor: "cisco-iosxr", err: true},
+		{name: "iosxr disabled", cfg: AdaptiveConfig{}, vendor: "cisco-iosxr"},
+		{name: "negative", cfg: AdaptiveConfig{Interval: 10, Restore: -1}, err: true},
+		{name: "max-factor", cfg: AdaptiveConfig{Interval: 10, MaxFactor: 6}, err: true},
+	}
+	for _, test := range tests {
+		err := validateAdaptiveConfig(test.cfg, test.vendor)
+		if (err != nil) != test.err {
+			t.Errorf("%s: got error %v", test.name, err)
+		}
+	}
+}
+
+func TestAdaptiveCheck(t *testing.T) {
+	a := newAdaptive(AdaptiveConfig{Interval: 1, Sustain: 2, Restore: 3, MaxFactor: 4})
+
+	// drops so far of every check and the factor after it
+	tests := []struct {
+		drops   uint64
+		changed bool
+		factor  uint64
+	}{
+		{drops: 10, factor: 1},
+		{drops: 10, factor: 1},
+		{drops: 20, factor: 1},
+		{drops: 30, changed: true, factor: 2},
+		{drops: 40, factor: 2},
+		{drops: 50, changed: true, factor: 4},
+		{drops: 60, factor: 4},
+		{drops: 70, factor: 4},
+		{drops: 70, factor: 4},
+		{drops: 70, factor: 4},
+		{drops: 70, changed: true, factor: 2},
+		{drops: 80, factor: 2},
+		{drops: 80, factor: 2},
+		{drops: 80, factor: 2},
+		{drops: 80, changed: true, factor: 1},
+		{drops: 80, factor: 1},
+		{drops: 80, factor: 1},
+		{drops: 80, factor: 1},
+	}
+	for i, test := range tests {
+		if changed := a.check(test.drops); changed != test.changed {
+			t.Errorf("check %d: got changed %v", i, changed)
+		}
+		if f := a.current(); f != test.factor {
+			t.Errorf("check %d: got factor %d, want %d", i, f, test.factor)
+		}
+	}
+
+	var none *adaptive
+	if f := none.current(); f != 1 {
+		t.Errorf("disabled: got factor %d", f)
+	}
+}
+
+func TestAdaptiveFreqs(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []PathsConfig
+		want  []uint64
+	}{
+		{
+			name:  "same priority",
+			paths: []PathsConfig{{Freq: 2000}, {Freq: 5000}, {Freq: 0}},
+			want:  []uint64{8000, 20000, 0},
+		},
+		{
+			name:  "priorities",
+			paths: []PathsConfig{{Freq: 2000, Priority: 2}, {Freq: 5000, Priority: 1}, {Freq: 1000}},
+			want:  []uint64{2000, 20000, 4000},
+		},
+	}
+	for _, test := range tests {
+		if got := adaptiveFreqs(test.paths, 4); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestJunosSubscriptionRequestsFactor(t *testing.T) {
+	cfg := &Config{Paths: []PathsConfig{
+		{Path: "/interfaces", Freq: 2000},
+		{Path: "/components", Freq: 10000, Priority: 1},
+	}}
+	reqs := junosSubscriptionRequests(cfg, 2, nil)
+	var got []uint32
+	for _, p := range reqs[0].PathList {
+		got = append(got, p.SampleFrequency)
+	}
+	if want := []uint32{4000, 10000}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got frequencies %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/nileshsimaria/jtimon/admin"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// adminServer serves the gRPC admin service of admin/admin.proto, the
+// control of the workers of the internal metrics port for typed clients
+type adminServer struct{}
+
+// adminInit serves the admin service on --admin-host:--admin-port and on
+// the Unix socket of --admin-socket, which is not TLS
+func adminInit() {
+	if *adminPort != 0 {
+		addr := fmt.Sprintf("%s:%d", *adminHost, *adminPort)
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Printf("Could not start the admin service on %s: %v", addr, err)
+		} else {
+			s := newAdminServer(adminServerOptions())
+			go func() {
+				log.Println(s.Serve(lis))
+			}()
+		}
+	}
+	if *adminSocket != "" {
+		lis, err := listenAPISocket(*adminSocket, apiSocketAccess)
+		if err != nil {
+			log.Printf("Could not start the admin service on %s: %v", *adminSocket, err)
+			return
+		}
+		s := newAdminServer(adminGuardOptions())
+		go func() {
+			log.Println(s.Serve(lis))
+		}()
+	}
+}
+
+// newAdminServer returns the gRPC server of the admin service, with the
+// server reflection for grpcurl and other generic clients
+func newAdminServer(opts []grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(opts...)
+	admin.RegisterAdminServer(s, adminServer{})
+	reflection.Register(s)
+	return s
+}
+
+// adminServerOptions are the TLS, rate limits, authentication and audit of
+// the admin service, in this order
+func adminServerOptions() []grpc.ServerOption {
+	opts := adminGuardOptions()
+	if apiTLS != nil {
+		opts = append([]grpc.ServerOption{grpc.Creds(credentials.NewTLS(apiTLS))}, opts...)
+	}
+	return opts
+}
+
+// adminGuardOptions are the rate limits, authentication and audit of the
+// admin service
+func adminGuardOptions() []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	var interceptors []grpc.UnaryServerInterceptor
+	var streamInterceptors []grpc.StreamServerInterceptor
+	if apiLimit != nil {
+		interceptors = append(interceptors, apiLimit.unaryInterceptor)
+		streamInterceptors = append(streamInterceptors, apiLimit.streamInterceptor)
+	}
+	if apiAuthn != nil {
+		interceptors = append(interceptors, apiAuthn.unaryInterceptor)
+		streamInterceptors = append(streamInterceptors, apiAuthn.streamInterceptor)
+	}
+	if apiAudit != nil {
+		interceptors = append(interceptors, apiAudit.unaryInterceptor)
+	}
+	if len(interceptors) != 0 {
+		opts = append(opts, grpc.UnaryInterceptor(chainUnary(interceptors...)))
+	}
+	if len(streamInterceptors) != 0 {
+		opts = append(opts, grpc.StreamInterceptor(chainStream(streamInterceptors...)))
+	}
+	return opts
+}
+
+// adminError is the gRPC error of the HTTP status of the control endpoints
+func adminError(code int, msg string) error {
+	c := codes.Internal
+	switch code {
+	case http.StatusBadRequest, http.StatusConflict:
+		c = codes.InvalidArgument
+	case http.StatusNotFound:
+		c = codes.NotFound
+	case http.StatusServiceUnavailable:
+		c = codes.Unavailable
+	}
+	return status.Error(c, msg)
+}
+
+// adminWorker returns the worker of the device of the request
+func adminWorker(ctx context.Context, device string) (*JCtx, error) {
+	jctx, code := findScopedWorker(requestScope(ctx), device)
+	if code != http.StatusOK {
+		return nil, adminError(code, findWorkerError(device, code))
+	}
+	return jctx, nil
+}
+
+func adminStatus(workers []*JCtx) *admin.StatusReply {
+	reply := &admin.StatusReply{}
+	for _, jctx := range workers {
+		h := workerHealth(jctx)
+		_, pausedPaths := jctx.paused.state()
+		s := &admin.DeviceStatus{
+			Device:      h.Device,
+			Port:        int32(h.Port),
+			Connected:   h.Connected,
+			Stale:       h.Stale,
+			Paused:      h.Paused,
+			Paths:       h.Paths,
+			PausedPaths: pausedPaths,
+			Reconnects:  h.Reconnects,
+		}
+		if h.LastData != nil {
+			s.LastData = h.LastData.UnixNano()
+		}
+		reply.Devices = append(reply.Devices, s)
+	}
+	return reply
+}
+
+func adminPaths(paths []PathsConfig) *admin.PathsReply {
+	reply := &admin.PathsReply{}
+	for _, p := range paths {
+		reply.Paths = append(reply.Paths, &admin.Path{Path: p.Path, Freq: p.Freq, Mode: p.Mode, Priority: int32(p.Priority)})
+	}
+	return reply
+}
+
+func (adminServer) Status(ctx context.Context, req *admin.StatusRequest) (*admin.StatusReply, error) {
+	workers := requestScope(ctx).filter(deviceWorkers(req.Device))
+	if req.Device != "" && len(workers) == 0 {
+		return nil, adminError(http.StatusNotFound, findWorkerError(req.Device, http.StatusNotFound))
+	}
+	return adminStatus(workers), nil
+}
+
+func (adminServer) pause(ctx context.Context, req *admin.PauseRequest, paused bool) (*admin.StatusReply, error) {
+	if req.Device == "" {
+		return nil, status.Error(codes.InvalidArgument, "device is missing")
+	}
+	workers := pauseWorkers(ctx, req.Device, req.Path, paused)
+	if len(workers) == 0 {
+		return nil, status.Error(codes.NotFound, "no such device or path")
+	}
+	return adminStatus(workers), nil
+}
+
+func (s adminServer) Pause(ctx context.Context, req *admin.PauseRequest) (*admin.StatusReply, error) {
+	return s.pause(ctx, req, true)
+}
+
+func (s adminServer) Resume(ctx context.Context, req *admin.PauseRequest) (*admin.StatusReply, error) {
+	return s.pause(ctx, req, false)
+}
+
+func (adminServer) GetConfig(ctx context.Context, req *admin.DeviceRequest) (*admin.ConfigReply, error) {
+	jctx, err := adminWorker(ctx, req.Device)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := redactConfig(jctx.config)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(cfg); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &admin.ConfigReply{Config: strings.TrimSpace(b.String())}, nil
+}
+
+func (adminServer) GetPaths(ctx context.Context, req *admin.DeviceRequest) (*admin.PathsReply, error) {
+	jctx, err := adminWorker(ctx, req.Device)
+	if err != nil {
+		return nil, err
+	}
+	return adminPaths(jctx.config.Paths), nil
+}
+
+func (adminServer) SetPaths(ctx context.Context, req *admin.SetPathsRequest) (*admin.PathsReply, error) {
+	jctx, err := adminWorker(ctx, req.Device)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]PathsConfig, 0, len(req.Paths))
+	for _, p := range req.Paths {
+		paths = append(paths, PathsConfig{Path: p.Path, Freq: p.Freq, Mode: p.Mode, Priority: int(p.Priority)})
+	}
+	if code, err := setDevicePaths(ctx, jctx, paths, req.Persist); err != nil {
+		return nil, adminError(code, err.Error())
+	}
+	return adminPaths(paths), nil
+}
@@ -0,0 +1,604 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: admin.proto
+
+/*
+Package admin is a generated protocol buffer package.
+
+It is generated from these files:
+
+	admin.proto
+
+It has these top-level messages:
+
+	StatusRequest
+	DeviceStatus
+	StatusReply
+	PauseRequest
+	DeviceRequest
+	ConfigReply
+	Path
+	PathsReply
+	SetPathsRequest
+*/
+package admin
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type StatusRequest struct {
+	Device string `protobuf:"bytes,1,opt,name=device" json:"device,omitempty"`
+}
+
+func (m *StatusRequest) Reset()                    { *m = StatusRequest{} }
+func (m *StatusRequest) String() string            { return proto.CompactTextString(m) }
+func (*StatusRequest) ProtoMessage()               {}
+func (*StatusRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *StatusRequest) GetDevice() string {
+	if m != nil {
+		return m.Device
+	}
+	return ""
+}
+
+// The state of the connection to a device
+type DeviceStatus struct {
+	Device    string `protobuf:"bytes,1,opt,name=device" json:"device,omitempty"`
+	Port      int32  `protobuf:"varint,2,opt,name=port" json:"port,omitempty"`
+	Connected bool   `protobuf:"varint,3,opt,name=connected" json:"connected,omitempty"`
+	Stale     bool   `protobuf:"varint,4,opt,name=stale" json:"stale,omitempty"`
+	Paused    bool   `protobuf:"varint,5,opt,name=paused" json:"paused,omitempty"`
+	// last_data is the time of the last data in nanoseconds since the epoch,
+	// 0 if none was received
+	LastData int64 `protobuf:"varint,6,opt,name=last_data,json=lastData" json:"last_data,omitempty"`
+	// paths are the subscribed paths while the device is connected
+	Paths       []string `protobuf:"bytes,7,rep,name=paths" json:"paths,omitempty"`
+	PausedPaths []string `protobuf:"bytes,8,rep,name=paused_paths,json=pausedPaths" json:"paused_paths,omitempty"`
+	Reconnects  uint64   `protobuf:"varint,9,opt,name=reconnects" json:"reconnects,omitempty"`
+}
+
+func (m *DeviceStatus) Reset()                    { *m = DeviceStatus{} }
+func (m *DeviceStatus) String() string            { return proto.CompactTextString(m) }
+func (*DeviceStatus) ProtoMessage()               {}
+func (*DeviceStatus) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *DeviceStatus) GetDevice() string {
+	if m != nil {
+		return m.Device
+	}
+	return ""
+}
+
+func (m *DeviceStatus) GetPort() int32 {
+	if m != nil {
+		return m.Port
+	}
+	return 0
+}
+
+func (m *DeviceStatus) GetConnected() bool {
+	if m != nil {
+		return m.Connected
+	}
+	return false
+}
+
+func (m *DeviceStatus) GetStale() bool {
+	if m != nil {
+		return m.Stale
+	}
+	return false
+}
+
+func (m *DeviceStatus) GetPaused() bool {
+	if m != nil {
+		return m.Paused
+	}
+	return false
+}
+
+func (m *DeviceStatus) GetLastData() int64 {
+	if m != nil {
+		return m.LastData
+	}
+	return 0
+}
+
+func (m *DeviceStatus) GetPaths() []string {
+	if m != nil {
+		return m.Paths
+	}
+	return nil
+}
+
+func (m *DeviceStatus) GetPausedPaths() []string {
+	if m != nil {
+		return m.PausedPaths
+	}
+	return nil
+}
+
+func (m *DeviceStatus) GetReconnects() uint64 {
+	if m != nil {
+		return m.Reconnects
+	}
+	return 0
+}
+
+type StatusReply struct {
+	Devices []*DeviceStatus `protobuf:"bytes,1,rep,name=devices" json:"devices,omitempty"`
+}
+
+func (m *StatusReply) Reset()                    { *m = StatusReply{} }
+func (m *StatusReply) String() string            { return proto.CompactTextString(m) }
+func (*StatusReply) ProtoMessage()               {}
+func (*StatusReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *StatusReply) GetDevices() []*DeviceStatus {
+	if m != nil {
+		return m.Devices
+	}
+	return nil
+}
+
+type PauseRequest struct {
+	Device string `protobuf:"bytes,1,opt,name=device" json:"device,omitempty"`
+	Path   string `protobuf:"bytes,2,opt,name=path" json:"path,omitempty"`
+}
+
+func (m *PauseRequest) Reset()                    { *m = PauseRequest{} }
+func (m *PauseRequest) String() string            { return proto.CompactTextString(m) }
+func (*PauseRequest) ProtoMessage()               {}
+func (*PauseRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *PauseRequest) GetDevice() string {
+	if m != nil {
+		return m.Device
+	}
+	return ""
+}
+
+func (m *PauseRequest) GetPath() string {
+	if m != nil {
+		return m.Path
+	}
+	return ""
+}
+
+type DeviceRequest struct {
+	Device string `protobuf:"bytes,1,opt,name=device" json:"device,omitempty"`
+}
+
+func (m *DeviceRequest) Reset()                    { *m = DeviceRequest{} }
+func (m *DeviceRequest) String() string            { return proto.CompactTextString(m) }
+func (*DeviceRequest) ProtoMessage()               {}
+func (*DeviceRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *DeviceRequest) GetDevice() string {
+	if m != nil {
+		return m.Device
+	}
+	return ""
+}
+
+type ConfigReply struct {
+	// config is the config as JSON
+	Config string `protobuf:"bytes,1,opt,name=config" json:"config,omitempty"`
+}
+
+func (m *ConfigReply) Reset()                    { *m = ConfigReply{} }
+func (m *ConfigReply) String() string            { return proto.CompactTextString(m) }
+func (*ConfigReply) ProtoMessage()               {}
+func (*ConfigReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *ConfigReply) GetConfig() string {
+	if m != nil {
+		return m.Config
+	}
+	return ""
+}
+
+// A subscription path as in the config file
+type Path struct {
+	Path     string `protobuf:"bytes,1,opt,name=path" json:"path,omitempty"`
+	Freq     uint64 `protobuf:"varint,2,opt,name=freq" json:"freq,omitempty"`
+	Mode     string `protobuf:"bytes,3,opt,name=mode" json:"mode,omitempty"`
+	Priority int32  `protobuf:"varint,4,opt,name=priority" json:"priority,omitempty"`
+}
+
+func (m *Path) Reset()                    { *m = Path{} }
+func (m *Path) String() string            { return proto.CompactTextString(m) }
+func (*Path) ProtoMessage()               {}
+func (*Path) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *Path) GetPath() string {
+	if m != nil {
+		return m.Path
+	}
+	return ""
+}
+
+func (m *Path) GetFreq() uint64 {
+	if m != nil {
+		return m.Freq
+	}
+	return 0
+}
+
+func (m *Path) GetMode() string {
+	if m != nil {
+		return m.Mode
+	}
+	return ""
+}
+
+func (m *Path) GetPriority() int32 {
+	if m != nil {
+		return m.Priority
+	}
+	return 0
+}
+
+type PathsReply struct {
+	Paths []*Path `protobuf:"bytes,1,rep,name=paths" json:"paths,omitempty"`
+}
+
+func (m *PathsReply) Reset()                    { *m = PathsReply{} }
+func (m *PathsReply) String() string            { return proto.CompactTextString(m) }
+func (*PathsReply) ProtoMessage()               {}
+func (*PathsReply) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *PathsReply) GetPaths() []*Path {
+	if m != nil {
+		return m.Paths
+	}
+	return nil
+}
+
+type SetPathsRequest struct {
+	Device string  `protobuf:"bytes,1,opt,name=device" json:"device,omitempty"`
+	Paths  []*Path `protobuf:"bytes,2,rep,name=paths" json:"paths,omitempty"`
+	// persist writes the paths to the config file of the device
+	Persist bool `protobuf:"varint,3,opt,name=persist" json:"persist,omitempty"`
+}
+
+func (m *SetPathsRequest) Reset()                    { *m = SetPathsRequest{} }
+func (m *SetPathsRequest) String() string            { return proto.CompactTextString(m) }
+func (*SetPathsRequest) ProtoMessage()               {}
+func (*SetPathsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+func (m *SetPathsRequest) GetDevice() string {
+	if m != nil {
+		return m.Device
+	}
+	return ""
+}
+
+func (m *SetPathsRequest) GetPaths() []*Path {
+	if m != nil {
+		return m.Paths
+	}
+	return nil
+}
+
+func (m *SetPathsRequest) GetPersist() bool {
+	if m != nil {
+		return m.Persist
+	}
+	return false
+}
+
+func init() {
+	proto.RegisterType((*StatusRequest)(nil), "admin.StatusRequest")
+	proto.RegisterType((*DeviceStatus)(nil), "admin.DeviceStatus")
+	proto.RegisterType((*StatusReply)(nil), "admin.StatusReply")
+	proto.RegisterType((*PauseRequest)(nil), "admin.PauseRequest")
+	proto.RegisterType((*DeviceRequest)(nil), "admin.DeviceRequest")
+	proto.RegisterType((*ConfigReply)(nil), "admin.ConfigReply")
+	proto.RegisterType((*Path)(nil), "admin.Path")
+	proto.RegisterType((*PathsReply)(nil), "admin.PathsReply")
+	proto.RegisterType((*SetPathsRequest)(nil), "admin.SetPathsRequest")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for Admin service
+
+type AdminClient interface {
+	// Status returns the state of the devices, all of them if device is empty
+	Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusReply, error)
+	// Pause pauses the collection from the device, or only its path if set
+	Pause(ctx context.Context, in *PauseRequest, opts ...grpc.CallOption) (*StatusReply, error)
+	// Resume resumes the collection from the device, or only its path if set
+	Resume(ctx context.Context, in *PauseRequest, opts ...grpc.CallOption) (*StatusReply, error)
+	// GetConfig returns the running config of the device, secrets redacted
+	GetConfig(ctx context.Context, in *DeviceRequest, opts ...grpc.CallOption) (*ConfigReply, error)
+	// GetPaths returns the subscription paths of the device
+	GetPaths(ctx context.Context, in *DeviceRequest, opts ...grpc.CallOption) (*PathsReply, error)
+	// SetPaths replaces the subscription paths of the device
+	SetPaths(ctx context.Context, in *SetPathsRequest, opts ...grpc.CallOption) (*PathsReply, error)
+}
+
+type adminClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewAdminClient(cc *grpc.ClientConn) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusReply, error) {
+	out := new(StatusReply)
+	err := grpc.Invoke(ctx, "/admin.Admin/Status", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Pause(ctx context.Context, in *PauseRequest, opts ...grpc.CallOption) (*StatusReply, error) {
+	out := new(StatusReply)
+	err := grpc.Invoke(ctx, "/admin.Admin/Pause", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Resume(ctx context.Context, in *PauseRequest, opts ...grpc.CallOption) (*StatusReply, error) {
+	out := new(StatusReply)
+	err := grpc.Invoke(ctx, "/admin.Admin/Resume", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetConfig(ctx context.Context, in *DeviceRequest, opts ...grpc.CallOption) (*ConfigReply, error) {
+	out := new(ConfigReply)
+	err := grpc.Invoke(ctx, "/admin.Admin/GetConfig", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetPaths(ctx context.Context, in *DeviceRequest, opts ...grpc.CallOption) (*PathsReply, error) {
+	out := new(PathsReply)
+	err := grpc.Invoke(ctx, "/admin.Admin/GetPaths", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) SetPaths(ctx context.Context, in *SetPathsRequest, opts ...grpc.CallOption) (*PathsReply, error) {
+	out := new(PathsReply)
+	err := grpc.Invoke(ctx, "/admin.Admin/SetPaths", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for Admin service
+
+type AdminServer interface {
+	// Status returns the state of the devices, all of them if device is empty
+	Status(context.Context, *StatusRequest) (*StatusReply, error)
+	// Pause pauses the collection from the device, or only its path if set
+	Pause(context.Context, *PauseRequest) (*StatusReply, error)
+	// Resume resumes the collection from the device, or only its path if set
+	Resume(context.Context, *PauseRequest) (*StatusReply, error)
+	// GetConfig returns the running config of the device, secrets redacted
+	GetConfig(context.Context, *DeviceRequest) (*ConfigReply, error)
+	// GetPaths returns the subscription paths of the device
+	GetPaths(context.Context, *DeviceRequest) (*PathsReply, error)
+	// SetPaths replaces the subscription paths of the device
+	SetPaths(context.Context, *SetPathsRequest) (*PathsReply, error)
+}
+
+func RegisterAdminServer(s *grpc.Server, srv AdminServer) {
+	s.RegisterService(&_Admin_serviceDesc, srv)
+}
+
+func _Admin_Status_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Status(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/Status",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Status(ctx, req.(*StatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_Pause_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PauseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Pause(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/Pause",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Pause(ctx, req.(*PauseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_Resume_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PauseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Resume(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/Resume",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Resume(ctx, req.(*PauseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeviceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/GetConfig",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetConfig(ctx, req.(*DeviceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetPaths_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeviceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetPaths(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/GetPaths",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetPaths(ctx, req.(*DeviceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_SetPaths_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetPathsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).SetPaths(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/admin.Admin/SetPaths",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).SetPaths(ctx, req.(*SetPathsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Admin_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "admin.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Status",
+			Handler:    _Admin_Status_Handler,
+		},
+		{
+			MethodName: "Pause",
+			Handler:    _Admin_Pause_Handler,
+		},
+		{
+			MethodName: "Resume",
+			Handler:    _Admin_Resume_Handler,
+		},
+		{
+			MethodName: "GetConfig",
+			Handler:    _Admin_GetConfig_Handler,
+		},
+		{
+			MethodName: "GetPaths",
+			Handler:    _Admin_GetPaths_Handler,
+		},
+		{
+			MethodName: "SetPaths",
+			Handler:    _Admin_SetPaths_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "admin.proto",
+}
+
+func init() { proto.RegisterFile("admin.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 481 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x54, 0x5d, 0x6f, 0xd3, 0x30,
+	0x14, 0x9d, 0xdb, 0x24, 0x4d, 0x6e, 0x8a, 0x10, 0xde, 0x54, 0x59, 0x03, 0xa1, 0xcc, 0x12, 0x22,
+	0x2f, 0x0c, 0xa9, 0x03, 0x21, 0x21, 0x5e, 0x10, 0x93, 0xf6, 0x3a, 0x79, 0xef, 0x4c, 0xa6, 0x71,
+	0x59, 0xa4, 0xb6, 0xc9, 0x62, 0x17, 0xa9, 0xbf, 0x92, 0x3f, 0xc4, 0x03, 0xf2, 0xb5, 0x93, 0xa6,
+	0x88, 0x50, 0xf1, 0x76, 0xcf, 0xf1, 0xfd, 0xf2, 0x39, 0x4e, 0x20, 0x95, 0xc5, 0xba, 0xdc, 0x5c,
+	0xd6, 0x4d, 0x65, 0x2a, 0x1a, 0x22, 0xe0, 0xaf, 0xe1, 0xc9, 0x9d, 0x91, 0x66, 0xab, 0x85, 0x7a,
+	0xdc, 0x2a, 0x6d, 0xe8, 0x0c, 0xa2, 0x42, 0xfd, 0x28, 0x17, 0x8a, 0x91, 0x8c, 0xe4, 0x89, 0xf0,
+	0x88, 0xff, 0x22, 0x30, 0xbd, 0xc6, 0xd0, 0xe5, 0x0f, 0x25, 0x52, 0x0a, 0x41, 0x5d, 0x35, 0x86,
+	0x8d, 0x32, 0x92, 0x87, 0x02, 0x63, 0xfa, 0x02, 0x92, 0x45, 0xb5, 0xd9, 0xa8, 0x85, 0x51, 0x05,
+	0x1b, 0x67, 0x24, 0x8f, 0xc5, 0x9e, 0xa0, 0x67, 0x10, 0x6a, 0x23, 0x57, 0x8a, 0x05, 0x78, 0xe2,
+	0x80, 0xed, 0x5f, 0xcb, 0xad, 0x56, 0x05, 0x0b, 0x91, 0xf6, 0x88, 0x3e, 0x87, 0x64, 0x25, 0xb5,
+	0xb9, 0x2f, 0xa4, 0x91, 0x2c, 0xca, 0x48, 0x3e, 0x16, 0xb1, 0x25, 0xae, 0xa5, 0x91, 0xb6, 0x55,
+	0x2d, 0xcd, 0x83, 0x66, 0x93, 0x6c, 0x9c, 0x27, 0xc2, 0x01, 0x7a, 0x01, 0x53, 0x57, 0x7c, 0xef,
+	0x0e, 0x63, 0x3c, 0x4c, 0x1d, 0x77, 0x8b, 0x29, 0x2f, 0x01, 0x1a, 0xe5, 0x57, 0xd2, 0x2c, 0xc9,
+	0x48, 0x1e, 0x88, 0x1e, 0xc3, 0x3f, 0x41, 0xda, 0xea, 0x54, 0xaf, 0x76, 0xf4, 0x0d, 0x4c, 0xdc,
+	0x75, 0x35, 0x23, 0xd9, 0x38, 0x4f, 0xe7, 0xa7, 0x97, 0x4e, 0xdc, 0xbe, 0x44, 0xa2, 0xcd, 0xe1,
+	0x1f, 0x61, 0x7a, 0x6b, 0x87, 0x1d, 0x11, 0x19, 0xb5, 0x93, 0xe6, 0x01, 0xb5, 0x4b, 0x04, 0xc6,
+	0xd6, 0x21, 0xd7, 0xf4, 0x98, 0x43, 0xaf, 0x20, 0xfd, 0x52, 0x6d, 0x96, 0xe5, 0x77, 0xb7, 0xe2,
+	0x0c, 0xa2, 0x05, 0xc2, 0x36, 0xcd, 0x21, 0xfe, 0x15, 0x02, 0x7b, 0xe5, 0x6e, 0x16, 0xd9, 0xcf,
+	0xb2, 0xdc, 0xb2, 0x51, 0x8f, 0x38, 0x3f, 0x10, 0x18, 0x5b, 0x6e, 0x5d, 0x15, 0x0a, 0x6d, 0x4b,
+	0x04, 0xc6, 0xf4, 0x1c, 0xe2, 0xba, 0x29, 0xab, 0xa6, 0x34, 0x3b, 0x34, 0x2d, 0x14, 0x1d, 0xe6,
+	0x6f, 0x01, 0x50, 0x52, 0xb7, 0xc5, 0x45, 0x6b, 0x88, 0x93, 0x29, 0xf5, 0x32, 0xd9, 0x0c, 0xef,
+	0x0e, 0x5f, 0xc2, 0xd3, 0x3b, 0x65, 0x7c, 0xcd, 0xbf, 0xf5, 0xe9, 0xba, 0x8d, 0x86, 0xba, 0x51,
+	0x06, 0x93, 0x5a, 0x35, 0xba, 0xd4, 0xc6, 0x3f, 0xb4, 0x16, 0xce, 0x7f, 0x8e, 0x20, 0xfc, 0x6c,
+	0xf3, 0xe9, 0x3b, 0x88, 0xfc, 0x23, 0x3e, 0xf3, 0x1d, 0x0e, 0xbe, 0x81, 0x73, 0xfa, 0x07, 0x5b,
+	0xaf, 0x76, 0xfc, 0x84, 0xce, 0x21, 0x44, 0x13, 0xe9, 0x69, 0x37, 0x76, 0x6f, 0xe9, 0x40, 0xcd,
+	0x15, 0x44, 0x42, 0xe9, 0xed, 0xfa, 0xbf, 0x8a, 0x3e, 0x40, 0x72, 0xa3, 0x8c, 0xf3, 0xb2, 0xdb,
+	0xf0, 0xe0, 0x0d, 0x74, 0x85, 0x3d, 0xc3, 0xf9, 0x09, 0x7d, 0x0f, 0xf1, 0x8d, 0x57, 0x72, 0xa0,
+	0xee, 0x59, 0x4f, 0xb1, 0xde, 0xbc, 0xb8, 0x35, 0x80, 0xce, 0xda, 0x8d, 0x0e, 0x1d, 0xf9, 0x6b,
+	0xe1, 0xb7, 0x08, 0x7f, 0x25, 0x57, 0xbf, 0x07, 0x00, 0x06, 0x40, 0xbc, 0xa2, 0x59, 0x04, 0x00,
+	0x00,
+}
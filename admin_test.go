@@ -0,0 +1,182 @@
+package main
+
+import (
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nileshsimaria/jtimon/admin"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+)
+
+func TestAdminServer(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	admin.RegisterAdminServer(s, adminServer{})
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := admin.NewAdminClient(conn)
+	ctx := context.Background()
+
+	r1 := &JCtx{
+		config:   Config{Host: "r1", Port: 32767, Password: "s3cr3t", Paths: []PathsConfig{{Path: "/interfaces/", Freq: 2000}}},
+		signalch: make(chan os.Signal, 1),
+	}
+	r2 := &JCtx{config: Config{Host: "r2", Port: 32767}}
+	for _, jctx := range []*JCtx{r2, r1} {
+		dropsInit(jctx)
+		defer dropsStop(jctx)
+	}
+
+	reply, err := c.Status(ctx, &admin.StatusRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reply.Devices) != 2 || reply.Devices[0].Device != "r1" || reply.Devices[1].Device != "r2" {
+		t.Errorf("Status: got %v", reply.Devices)
+	}
+
+	reply, err = c.Pause(ctx, &admin.PauseRequest{Device: "r1", Path: "/interfaces/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/interfaces/"}; len(reply.Devices) != 1 || !reflect.DeepEqual(reply.Devices[0].PausedPaths, want) {
+		t.Errorf("Pause: got %v, want paused paths %v", reply.Devices, want)
+	}
+	if reply, err = c.Resume(ctx, &admin.PauseRequest{Device: "r1", Path: "/interfaces/"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(reply.Devices[0].PausedPaths) != 0 {
+		t.Errorf("Resume: got %v", reply.Devices)
+	}
+
+	config, err := c.GetConfig(ctx, &admin.DeviceRequest{Device: "r1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(config.Config, "s3cr3t") || !strings.Contains(config.Config, `"password":"<redacted>"`) {
+		t.Errorf("GetConfig: got %s", config.Config)
+	}
+
+	paths, err := c.GetPaths(ctx, &admin.DeviceRequest{Device: "r1:32767"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []*admin.Path{{Path: "/interfaces/", Freq: 2000}}; !reflect.DeepEqual(paths.Paths, want) {
+		t.Errorf("GetPaths: got %v, want %v", paths.Paths, want)
+	}
+	if _, err := c.SetPaths(ctx, &admin.SetPathsRequest{Device: "r1", Paths: []*admin.Path{{Path: "/bgp/"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(r1.signalch) != 1 || !reflect.DeepEqual(r1.pathsSet.apply(nil), []PathsConfig{{Path: "/bgp/"}}) {
+		t.Errorf("SetPaths: the paths are not set")
+	}
+
+	for _, test := range []struct {
+		name string
+		call func() error
+		code codes.Code
+	}{
+		{
+			name: "status of an unknown device",
+			call: func() error { _, err := c.Status(ctx, &admin.StatusRequest{Device: "r3"}); return err },
+			code: codes.NotFound,
+		},
+		{
+			name: "pause without device",
+			call: func() error { _, err := c.Pause(ctx, &admin.PauseRequest{}); return err },
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "pause of an unknown path",
+			call: func() error { _, err := c.Pause(ctx, &admin.PauseRequest{Device: "r1", Path: "/mpls/"}); return err },
+			code: codes.NotFound,
+		},
+		{
+			name: "config of an unknown device",
+			call: func() error { _, err := c.GetConfig(ctx, &admin.DeviceRequest{Device: "r3"}); return err },
+			code: codes.NotFound,
+		},
+		{
+			name: "no paths",
+			call: func() error { _, err := c.SetPaths(ctx, &admin.SetPathsRequest{Device: "r1"}); return err },
+			code: codes.InvalidArgument,
+		},
+	} {
+		if got := status.Code(test.call()); got != test.code {
+			t.Errorf("%s: got code %v, want %v", test.name, got, test.code)
+		}
+	}
+}
+
+func TestAdminReflection(t *testing.T) {
+	apiAuthn = &apiAuth{token: "t0ken"}
+	defer func() { apiAuthn = nil }()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newAdminServer(adminServerOptions())
+	go s.Serve(lis)
+	defer s.Stop()
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := rpb.NewServerReflectionClient(conn)
+
+	reflect := func(ctx context.Context, req *rpb.ServerReflectionRequest) (*rpb.ServerReflectionResponse, error) {
+		stream, err := c.ServerReflectionInfo(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := stream.Send(req); err != nil {
+			return nil, err
+		}
+		return stream.Recv()
+	}
+	list := &rpb.ServerReflectionRequest{MessageRequest: &rpb.ServerReflectionRequest_ListServices{}}
+	if _, err := reflect(context.Background(), list); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("without token: got %v", err)
+	}
+
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", "Bearer t0ken"))
+	resp, err := reflect(ctx, list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var services []string
+	for _, s := range resp.GetListServicesResponse().GetService() {
+		services = append(services, s.Name)
+	}
+	if strings.Join(services, ",") != "admin.Admin,grpc.reflection.v1alpha.ServerReflection" {
+		t.Errorf("got services %v", services)
+	}
+
+	resp, err = reflect(ctx, &rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: "admin.Admin"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := resp.GetFileDescriptorResponse().GetFileDescriptorProto(); len(files) == 0 {
+		t.Errorf("got no descriptor of admin.Admin: %v", resp)
+	}
+}
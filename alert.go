@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// AlertConfig is the config of threshold alerts sent to a webhook. format
+// is json (default), slack (incoming webhook) or pagerduty (Events API v2,
+// routing-key is the integration key).
+type AlertConfig struct {
+	URL        string            `json:"url"`
+	Format     string            `json:"format"`
+	RoutingKey string            `json:"routing-key"`
+	Headers    map[string]string `json:"headers"`
+	Rules      []AlertRule       `json:"rules"`
+	BatchConfig
+}
+
+// AlertRule fires when the value of the fields matching measurement and
+// field (regexes) compares (>, >=, <, <=, ==, !=) to threshold for at least
+// duration seconds. While firing the notification is repeated every dedup
+// seconds (0 never), with resolve a notification is sent when the value is
+// back. message is a Go template with .Rule, .Status, .Threshold, .Tags,
+// .Measurement, .Field and .Value.
+type AlertRule struct {
+	Name        string  `json:"name"`
+	Measurement string  `json:"measurement"`
+	Field       string  `json:"field"`
+	Comparison  string  `json:"comparison"`
+	Threshold   float64 `json:"threshold"`
+	Duration    int     `json:"duration"`
+	Dedup       int     `json:"dedup"`
+	Resolve     bool    `json:"resolve"`
+	Severity    string  `json:"severity"`
+	Message     string  `json:"message"`
+}
+
+// alertEvent is the data of the message template
+type alertEvent struct {
+	*updateEvent
+	Rule      string
+	Status    string
+	Threshold float64
+}
+
+type alertState struct {
+	since    time.Time
+	firing   bool
+	notified time.Time
+}
+
+type alertRule struct {
+	*updateRule
+	cfg     AlertRule
+	compare func(v, threshold float64) bool
+	message *template.Template
+	state   map[string]*alertState
+}
+
+type alertSink struct {
+	cfg    AlertConfig
+	rules  []*alertRule
+	client *http.Client
+}
+
+var alertComparisons = map[string]func(v, threshold float64) bool{
+	">":  func(v, t float64) bool { return v > t },
+	">=": func(v, t float64) bool { return v >= t },
+	"<":  func(v, t float64) bool { return v < t },
+	"<=": func(v, t float64) bool { return v <= t },
+	"==": func(v, t float64) bool { return v == t },
+	"!=": func(v, t float64) bool { return v != t },
+}
+
+func newAlertSink() *sink {
+	return &sink{
+		name: "alert",
+		open: openAlertSink,
+	}
+}
+
+func openAlertSink(jctx *JCtx) (sinkWriter, BatchConfig, error) {
+	cfg := jctx.config.Alert
+	if cfg.URL == "" {
+		return nil, cfg.BatchConfig, nil
+	}
+	if len(cfg.Rules) == 0 {
+		return nil, cfg.BatchConfig, fmt.Errorf("alert needs at least one rule")
+	}
+	switch cfg.Format {
+	case "":
+		cfg.Format = "json"
+	case "json", "slack":
+	case "pagerduty":
+		if cfg.RoutingKey == "" {
+			return nil, cfg.BatchConfig, fmt.Errorf("alert routing-key is missing")
+		}
+	default:
+		return nil, cfg.BatchConfig, fmt.Errorf("alert format %q is not supported, use json, slack or pagerduty", cfg.Format)
+	}
+
+	s := &alertSink{
+		cfg:    cfg,
+		client: &http.Client{Timeout: time.Duration(DefaultIDBTimeout) * time.Second},
+	}
+	for i, r := range cfg.Rules {
+		u, err := newUpdateRule(UpdateRule{Measurement: r.Measurement, Field: r.Field})
+		if err != nil {
+			return nil, cfg.BatchConfig, err
+		}
+		compare, ok := alertComparisons[r.Comparison]
+		if !ok {
+			return nil, cfg.BatchConfig, fmt.Errorf("alert rule %d: unknown comparison %q", i, r.Comparison)
+		}
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("%s %s %v", r.Field, r.Comparison, r.Threshold)
+		}
+		if r.Severity == "" {
+			r.Severity = DefaultAlertSeverity
+		}
+		message := r.Message
+		if message == "" {
+			message = DefaultAlertMessage
+		}
+		t, err := newKeyTemplate("message", message)
+		if err != nil {
+			return nil, cfg.BatchConfig, err
+		}
+		s.rules = append(s.rules, &alertRule{
+			updateRule: u,
+			cfg:        r,
+			compare:    compare,
+			message:    t,
+			state:      map[string]*alertState{},
+		})
+	}
+	return s, cfg.BatchConfig, nil
+}
+
+// eval updates the state of the series of e, status is "firing" or
+// "resolved" if a notification is due
+func (r *alertRule) eval(e *updateEvent) (status string) {
+	v, _, ok := numericValue(e.Value)
+	if !ok {
+		return ""
+	}
+	now := e.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	key := seriesKey(e.point, e.Field)
+	st := r.state[key]
+	if !r.compare(v, r.cfg.Threshold) {
+		if st == nil {
+			return ""
+		}
+		delete(r.state, key)
+		if st.firing && r.cfg.Resolve {
+			return "resolved"
+		}
+		return ""
+	}
+
+	if st == nil {
+		st = &alertState{since: now}
+		r.state[key] = st
+	}
+	if now.Sub(st.since) < time.Duration(r.cfg.Duration)*time.Second {
+		return ""
+	}
+	if st.firing && (r.cfg.Dedup == 0 || now.Sub(st.notified) < time.Duration(r.cfg.Dedup)*time.Second) {
+		return ""
+	}
+	st.firing = true
+	st.notified = now
+	return "firing"
+}
+
+func (s *alertSink) payload(r *alertRule, e *alertEvent, msg string) interface{} {
+	switch s.cfg.Format {
+	case "slack":
+		return map[string]string{"text": msg}
+	case "pagerduty":
+		action := "trigger"
+		if e.Status == "resolved" {
+			action = "resolve"
+		}
+		return map[string]interface{}{
+			"routing_key":  s.cfg.RoutingKey,
+			"event_action": action,
+			"dedup_key":    r.cfg.Name + " " + seriesKey(e.point, e.Field),
+			"payload": map[string]interface{}{
+				"summary":   msg,
+				"source":    e.Tags["device"],
+				"severity":  r.cfg.Severity,
+				"timestamp": e.Timestamp.UTC().Format(time.RFC3339Nano),
+				"custom_details": map[string]interface{}{
+					"measurement": e.Measurement,
+					"tags":        e.Tags,
+					"field":       e.Field,
+					"value":       e.Value,
+					"threshold":   e.Threshold,
+				},
+			},
+		}
+	}
+	return map[string]interface{}{
+		"rule":        r.cfg.Name,
+		"status":      e.Status,
+		"severity":    r.cfg.Severity,
+		"measurement": e.Measurement,
+		"tags":        e.Tags,
+		"field":       e.Field,
+		"value":       e.Value,
+		"threshold":   e.Threshold,
+		"message":     msg,
+		"timestamp":   e.Timestamp.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+func (s *alertSink) notify(body interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", s.cfg.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	_, err = sinkHTTPDo(s.client, req)
+	return err
+}
+
+func (s *alertSink) write(points []*point) error {
+	var firstErr error
+	for _, p := range points {
+		for _, r := range s.rules {
+			for _, ue := range r.match(p) {
+				status := r.eval(ue)
+				if status == "" {
+					continue
+				}
+				e := &alertEvent{updateEvent: ue, Rule: r.cfg.Name, Status: status, Threshold: r.cfg.Threshold}
+				var buf bytes.Buffer
+				if err := r.message.Execute(&buf, e); err != nil {
+					return err
+				}
+				// keep evaluating the rest so that the state stays current
+				if err := s.notify(s.payload(r, e, buf.String())); err != nil && firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+	}
+	return firstErr
+}
+
+func (s *alertSink) close() {}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAlertRule(t *testing.T) {
+	rule := AlertRule{Field: "temperature", Comparison: ">", Threshold: 70, Duration: 10, Dedup: 60, Resolve: true}
+	samples := []struct {
+		sec   int64
+		value float64
+		want  string
+	}{
+		{0, 65, ""},
+		{10, 75, ""},         // breach starts
+		{15, 80, ""},         // not long enough
+		{20, 80, "firing"},   // held for 10s
+		{30, 81, ""},         // dedup
+		{80, 82, "firing"},   // dedup interval passed
+		{90, 60, "resolved"}, // back to normal
+		{100, 60, ""},        // still normal
+		{110, 90, ""},        // new breach
+		{115, 60, ""},        // never fired, nothing to resolve
+	}
+
+	jctx := &JCtx{}
+	jctx.config.Alert = AlertConfig{URL: "http://127.0.0.1:1", Rules: []AlertRule{rule}}
+	w, _, err := openAlertSink(jctx)
+	if err != nil {
+		t.Fatalf("openAlertSink failed: %v", err)
+	}
+	r := w.(*alertSink).rules[0]
+	for _, s := range samples {
+		p := newPoint("/components/", map[string]string{"device": "r1"},
+			map[string]interface{}{"temperature": s.value}, time.Unix(s.sec, 0))
+		var got string
+		for _, e := range r.match(p) {
+			got = r.eval(e)
+		}
+		if got != s.want {
+			t.Errorf("t=%d value=%v: got %q, want %q", s.sec, s.value, got, s.want)
+		}
+	}
+}
+
+func TestAlertSink(t *testing.T) {
+	var mu sync.Mutex
+	var got []map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		got = append(got, body)
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	p := newPoint("/interfaces/", map[string]string{"device": "r1"},
+		map[string]interface{}{"in-errors": 12.0, "out-errors": 0.0}, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	rule := AlertRule{Name: "errors", Field: "errors", Comparison: ">=", Threshold: 10}
+
+	tests := []struct {
+		format string
+		want   map[string]interface{}
+	}{
+		{
+			format: "slack",
+			want:   map[string]interface{}{"text": "errors firing: r1 in-errors=12"},
+		},
+		{
+			format: "json",
+			want: map[string]interface{}{
+				"rule": "errors", "status": "firing", "severity": "warning",
+				"measurement": "/interfaces/", "tags": map[string]interface{}{"device": "r1"},
+				"field": "in-errors", "value": 12.0, "threshold": 10.0,
+				"message": "errors firing: r1 in-errors=12", "timestamp": "2020-01-02T03:04:05Z",
+			},
+		},
+		{
+			format: "pagerduty",
+			want: map[string]interface{}{
+				"routing_key": "key", "event_action": "trigger",
+				"dedup_key": "errors /interfaces/,device=r1 in-errors",
+				"payload": map[string]interface{}{
+					"summary": "errors firing: r1 in-errors=12", "source": "r1", "severity": "warning",
+					"timestamp": "2020-01-02T03:04:05Z",
+					"custom_details": map[string]interface{}{
+						"measurement": "/interfaces/", "tags": map[string]interface{}{"device": "r1"},
+						"field": "in-errors", "value": 12.0, "threshold": 10.0,
+					},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			mu.Lock()
+			got = nil
+			mu.Unlock()
+
+			jctx := &JCtx{}
+			jctx.config.Alert = AlertConfig{URL: ts.URL, Format: test.format, RoutingKey: "key", Rules: []AlertRule{rule}}
+			w, _, err := openAlertSink(jctx)
+			if err != nil {
+				t.Fatalf("openAlertSink failed: %v", err)
+			}
+			defer w.close()
+			if err := w.write([]*point{p}); err != nil {
+				t.Fatalf("write failed: %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(got) != 1 || !reflect.DeepEqual(got[0], test.want) {
+				t.Errorf("\ngot:  %v\nwant: %v", got, test.want)
+			}
+		})
+	}
+
+	t.Run("bad-comparison", func(t *testing.T) {
+		jctx := &JCtx{}
+		jctx.config.Alert = AlertConfig{URL: ts.URL, Rules: []AlertRule{{Field: "x", Comparison: "=~"}}}
+		if _, _, err := openAlertSink(jctx); err == nil {
+			t.Errorf("want error, got nil")
+		}
+	})
+}
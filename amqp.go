@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// AMQPConfig is the config of the AMQP (RabbitMQ) sink
+type AMQPConfig struct {
+	URL        string `json:"url"`
+	Exchange   string `json:"exchange"`
+	RoutingKey string `json:"routing-key"`
+	Persistent bool   `json:"persistent"`
+	BatchConfig
+}
+
+// AMQP 0-9-1 frame types, classes and methods jtimon cares about
+const (
+	amqpFrameMethod    = 1
+	amqpFrameHeader    = 2
+	amqpFrameBody      = 3
+	amqpFrameHeartbeat = 8
+	amqpFrameEnd       = 0xCE
+
+	amqpConnectionStart   = 10<<16 | 10
+	amqpConnectionStartOk = 10<<16 | 11
+	amqpConnectionTune    = 10<<16 | 30
+	amqpConnectionTuneOk  = 10<<16 | 31
+	amqpConnectionOpen    = 10<<16 | 40
+	amqpConnectionOpenOk  = 10<<16 | 41
+	amqpConnectionClose   = 10<<16 | 50
+	amqpChannelOpen       = 20<<16 | 10
+	amqpChannelOpenOk     = 20<<16 | 11
+	amqpChannelClose      = 20<<16 | 40
+	amqpBasicPublish      = 60<<16 | 40
+	amqpBasicAck          = 60<<16 | 80
+	amqpBasicNack         = 60<<16 | 120
+	amqpConfirmSelect     = 85<<16 | 10
+	amqpConfirmSelectOk   = 85<<16 | 11
+
+	amqpClassBasic      = 60
+	amqpDefaultFrameMax = 131072
+	amqpTimeout         = 30 * time.Second
+)
+
+// amqpConn is a minimal AMQP 0-9-1 client. It only knows how to open one
+// channel in confirm mode and publish on it, which is all the sink needs.
+type amqpConn struct {
+	conn     net.Conn
+	r        *bufio.Reader
+	frameMax uint32
+	seq      uint64 // delivery tag of the last published message
+	acked    uint64
+}
+
+type amqpFrame struct {
+	typ     byte
+	channel uint16
+	payload []byte
+}
+
+func (f *amqpFrame) method() uint32 {
+	if f.typ != amqpFrameMethod || len(f.payload) < 4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(f.payload[:4])
+}
+
+func amqpShortStr(buf *bytes.Buffer, s string) {
+	buf.WriteByte(byte(len(s)))
+	buf.WriteString(s)
+}
+
+func amqpLongStr(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.BigEndian, uint32(len(s)))
+	buf.WriteString(s)
+}
+
+func amqpReadShortStr(b []byte) string {
+	if len(b) == 0 || len(b) < 1+int(b[0]) {
+		return ""
+	}
+	return string(b[1 : 1+int(b[0])])
+}
+
+func dialAMQP(rawurl string) (*amqpConn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		switch u.Scheme {
+		case "amqps":
+			host = net.JoinHostPort(u.Hostname(), "5671")
+		default:
+			host = net.JoinHostPort(u.Hostname(), "5672")
+		}
+	}
+
+	user, pass := "guest", "guest"
+	if u.User != nil {
+		user = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			pass = p
+		}
+	}
+
+	vhost := "/"
+	if p := strings.TrimPrefix(u.EscapedPath(), "/"); p != "" {
+		if vhost, err = url.PathUnescape(p); err != nil {
+			return nil, err
+		}
+	}
+
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: amqpTimeout}
+	switch u.Scheme {
+	case "amqp":
+		conn, err = dialer.Dial("tcp", host)
+	case "amqps":
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, fmt.Errorf("unsupported amqp url scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &amqpConn{
+		conn:     conn,
+		r:        bufio.NewReader(conn),
+		frameMax: amqpDefaultFrameMax,
+	}
+	if err := c.handshake(user, pass, vhost); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *amqpConn) handshake(user, pass, vhost string) error {
+	c.conn.SetDeadline(time.Now().Add(amqpTimeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	if _, err := c.conn.Write([]byte{'A', 'M', 'Q', 'P', 0, 0, 9, 1}); err != nil {
+		return err
+	}
+	if _, err := c.expect(amqpConnectionStart); err != nil {
+		return err
+	}
+
+	var args bytes.Buffer
+	var props bytes.Buffer
+	amqpShortStr(&props, "product")
+	props.WriteByte('S')
+	amqpLongStr(&props, "jtimon")
+	binary.Write(&args, binary.BigEndian, uint32(props.Len()))
+	args.Write(props.Bytes())
+	amqpShortStr(&args, "PLAIN")
+	amqpLongStr(&args, "\x00"+user+"\x00"+pass)
+	amqpShortStr(&args, "en_US")
+	if err := c.sendMethod(0, amqpConnectionStartOk, args.Bytes()); err != nil {
+		return err
+	}
+
+	f, err := c.expect(amqpConnectionTune)
+	if err != nil {
+		return err
+	}
+	if len(f.payload) < 12 {
+		return fmt.Errorf("amqp: short connection.tune")
+	}
+	channelMax := binary.BigEndian.Uint16(f.payload[4:6])
+	if frameMax := binary.BigEndian.Uint32(f.payload[6:10]); frameMax != 0 && frameMax < c.frameMax {
+		c.frameMax = frameMax
+	}
+
+	// heartbeats are disabled, we only talk to the broker when we publish
+	args.Reset()
+	binary.Write(&args, binary.BigEndian, channelMax)
+	binary.Write(&args, binary.BigEndian, c.frameMax)
+	binary.Write(&args, binary.BigEndian, uint16(0))
+	if err := c.sendMethod(0, amqpConnectionTuneOk, args.Bytes()); err != nil {
+		return err
+	}
+
+	args.Reset()
+	amqpShortStr(&args, vhost)
+	amqpShortStr(&args, "")
+	args.WriteByte(0)
+	if err := c.sendMethod(0, amqpConnectionOpen, args.Bytes()); err != nil {
+		return err
+	}
+	if _, err := c.expect(amqpConnectionOpenOk); err != nil {
+		return err
+	}
+
+	if err := c.sendMethod(1, amqpChannelOpen, []byte{0}); err != nil {
+		return err
+	}
+	if _, err := c.expect(amqpChannelOpenOk); err != nil {
+		return err
+	}
+
+	// publisher confirms let us know whether the batch made it
+	if err := c.sendMethod(1, amqpConfirmSelect, []byte{0}); err != nil {
+		return err
+	}
+	_, err = c.expect(amqpConfirmSelectOk)
+	return err
+}
+
+func (c *amqpConn) sendFrame(typ byte, channel uint16, payload []byte) error {
+	var buf bytes.Buffer
+	buf.WriteByte(typ)
+	binary.Write(&buf, binary.BigEndian, channel)
+	binary.Write(&buf, binary.BigEndian, uint32(len(payload)))
+	buf.Write(payload)
+	buf.WriteByte(amqpFrameEnd)
+	_, err := c.conn.Write(buf.Bytes())
+	return err
+}
+
+func (c *amqpConn) sendMethod(channel uint16, method uint32, args []byte) error {
+	payload := make([]byte, 4, 4+len(args))
+	binary.BigEndian.PutUint32(payload, method)
+	return c.sendFrame(amqpFrameMethod, channel, append(payload, args...))
+}
+
+func (c *amqpConn) readFrame() (*amqpFrame, error) {
+	hdr := make([]byte, 7)
+	if _, err := io.ReadFull(c.r, hdr); err != nil {
+		return nil, err
+	}
+	f := &amqpFrame{
+		typ:     hdr[0],
+		channel: binary.BigEndian.Uint16(hdr[1:3]),
+		payload: make([]byte, binary.BigEndian.Uint32(hdr[3:7])+1),
+	}
+	if _, err := io.ReadFull(c.r, f.payload); err != nil {
+		return nil, err
+	}
+	if f.payload[len(f.payload)-1] != amqpFrameEnd {
+		return nil, fmt.Errorf("amqp: bad frame end")
+	}
+	f.payload = f.payload[:len(f.payload)-1]
+	return f, nil
+}
+
+// next method frame, heartbeats are skipped and close is turned into error
+func (c *amqpConn) nextMethod() (*amqpFrame, error) {
+	for {
+		f, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		if f.typ == amqpFrameHeartbeat {
+			continue
+		}
+		switch m := f.method(); m {
+		case amqpConnectionClose, amqpChannelClose:
+			if len(f.payload) < 6 {
+				return nil, fmt.Errorf("amqp: closed by broker")
+			}
+			return nil, fmt.Errorf("amqp: closed by broker: %d %s",
+				binary.BigEndian.Uint16(f.payload[4:6]), amqpReadShortStr(f.payload[6:]))
+		}
+		return f, nil
+	}
+}
+
+func (c *amqpConn) expect(method uint32) (*amqpFrame, error) {
+	f, err := c.nextMethod()
+	if err != nil {
+		return nil, err
+	}
+	if m := f.method(); m != method {
+		return nil, fmt.Errorf("amqp: unexpected method %d.%d (want %d.%d)", m>>16, m&0xffff, method>>16, method&0xffff)
+	}
+	return f, nil
+}
+
+func (c *amqpConn) publish(exchange, key string, body []byte, persistent bool) error {
+	var args bytes.Buffer
+	binary.Write(&args, binary.BigEndian, uint16(0))
+	amqpShortStr(&args, exchange)
+	amqpShortStr(&args, key)
+	args.WriteByte(0)
+	if err := c.sendMethod(1, amqpBasicPublish, args.Bytes()); err != nil {
+		return err
+	}
+
+	// content header with content-type and delivery-mode properties
+	var hdr bytes.Buffer
+	binary.Write(&hdr, binary.BigEndian, uint16(amqpClassBasic))
+	binary.Write(&hdr, binary.BigEndian, uint16(0))
+	binary.Write(&hdr, binary.BigEndian, uint64(len(body)))
+	binary.Write(&hdr, binary.BigEndian, uint16(0x8000|0x1000))
+	amqpShortStr(&hdr, "application/json")
+	if persistent {
+		hdr.WriteByte(2)
+	} else {
+		hdr.WriteByte(1)
+	}
+	if err := c.sendFrame(amqpFrameHeader, 1, hdr.Bytes()); err != nil {
+		return err
+	}
+
+	max := int(c.frameMax) - 8
+	for len(body) > 0 {
+		n := len(body)
+		if n > max {
+			n = max
+		}
+		if err := c.sendFrame(amqpFrameBody, 1, body[:n]); err != nil {
+			return err
+		}
+		body = body[n:]
+	}
+	c.seq++
+	return nil
+}
+
+// waitConfirms blocks until the broker confirmed everything published so far
+func (c *amqpConn) waitConfirms() error {
+	var nacked uint64
+	for c.acked < c.seq {
+		f, err := c.nextMethod()
+		if err != nil {
+			return err
+		}
+		if len(f.payload) < 13 {
+			continue
+		}
+		tag := binary.BigEndian.Uint64(f.payload[4:12])
+		multiple := f.payload[12]&1 == 1
+		n := uint64(1)
+		if multiple {
+			n = tag - c.acked
+		}
+		switch f.method() {
+		case amqpBasicAck:
+		case amqpBasicNack:
+			nacked += n
+		default:
+			continue
+		}
+		if tag > c.acked {
+			c.acked = tag
+		}
+	}
+	if nacked != 0 {
+		return fmt.Errorf("amqp: broker rejected %d messages", nacked)
+	}
+	return nil
+}
+
+func (c *amqpConn) close() {
+	c.conn.Close()
+}
+
+type amqpSink struct {
+	cfg  AMQPConfig
+	key  *template.Template
+	conn *amqpConn
+}
+
+func newAMQPSink() *sink {
+	return &sink{
+		name: "amqp",
+		open: openAMQPSink,
+	}
+}
+
+func openAMQPSink(jctx *JCtx) (sinkWriter, BatchConfig, error) {
+	cfg := jctx.config.AMQP
+	if cfg.URL == "" {
+		return nil, cfg.BatchConfig, nil
+	}
+
+	routingKey := cfg.RoutingKey
+	if routingKey == "" {
+		routingKey = DefaultAMQPRoutingKey
+	}
+	key, err := newKeyTemplate("routing-key", routingKey)
+	if err != nil {
+		return nil, cfg.BatchConfig, err
+	}
+	return &amqpSink{cfg: cfg, key: key}, cfg.BatchConfig, nil
+}
+
+func (s *amqpSink) write(points []*point) error {
+	if s.conn == nil {
+		conn, err := dialAMQP(s.cfg.URL)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	err := s.publish(points)
+	if err != nil {
+		// start over with a new connection next time
+		s.close()
+	}
+	return err
+}
+
+func (s *amqpSink) publish(points []*point) error {
+	s.conn.conn.SetDeadline(time.Now().Add(amqpTimeout))
+	defer s.conn.conn.SetDeadline(time.Time{})
+
+	for _, p := range points {
+		body, err := json.Marshal(p)
+		if err != nil {
+			// e.g. NaN can not be encoded, drop the point but not the batch
+			continue
+		}
+		key, err := execKeyTemplate(s.key, p)
+		if err != nil {
+			return err
+		}
+		if err := s.conn.publish(s.cfg.Exchange, key, body, s.cfg.Persistent); err != nil {
+			return err
+		}
+	}
+	return s.conn.waitConfirms()
+}
+
+func (s *amqpSink) close() {
+	if s.conn != nil {
+		s.conn.close()
+		s.conn = nil
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+type amqpMessage struct {
+	exchange string
+	key      string
+	body     []byte
+}
+
+// fakeAMQPBroker accepts one connection, publishes received messages on
+// msgs and acks (or nacks) everything it gets.
+func fakeAMQPBroker(t *testing.T, nack bool, msgs chan<- amqpMessage) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		c := &amqpConn{conn: conn, r: bufio.NewReader(conn), frameMax: 4096}
+		hdr := make([]byte, 8)
+		if _, err := io.ReadFull(c.r, hdr); err != nil {
+			return
+		}
+
+		tune := make([]byte, 8)
+		binary.BigEndian.PutUint32(tune[2:6], 4096)
+		c.sendMethod(0, amqpConnectionStart, []byte{0, 9, 0, 0, 0, 0})
+		c.expect(amqpConnectionStartOk)
+		c.sendMethod(0, amqpConnectionTune, tune)
+		c.expect(amqpConnectionTuneOk)
+		c.expect(amqpConnectionOpen)
+		c.sendMethod(0, amqpConnectionOpenOk, []byte{0})
+		c.expect(amqpChannelOpen)
+		c.sendMethod(1, amqpChannelOpenOk, []byte{0, 0, 0, 0})
+		c.expect(amqpConfirmSelect)
+		c.sendMethod(1, amqpConfirmSelectOk, nil)
+
+		var tag uint64
+		for {
+			f, err := c.expect(amqpBasicPublish)
+			if err != nil {
+				return
+			}
+			args := f.payload[6:]
+			exchange := amqpReadShortStr(args)
+			key := amqpReadShortStr(args[1+len(exchange):])
+
+			h, err := c.readFrame()
+			if err != nil || h.typ != amqpFrameHeader {
+				return
+			}
+			size := binary.BigEndian.Uint64(h.payload[4:12])
+			var body bytes.Buffer
+			for uint64(body.Len()) < size {
+				b, err := c.readFrame()
+				if err != nil {
+					return
+				}
+				body.Write(b.payload)
+			}
+			msgs <- amqpMessage{exchange: exchange, key: key, body: body.Bytes()}
+
+			tag++
+			ack := make([]byte, 9)
+			binary.BigEndian.PutUint64(ack, tag)
+			if nack {
+				c.sendMethod(1, amqpBasicNack, ack)
+			} else {
+				c.sendMethod(1, amqpBasicAck, ack)
+			}
+		}
+	}()
+
+	return "amqp://guest:guest@" + l.Addr().String() + "/%2f"
+}
+
+func TestAMQPSink(t *testing.T) {
+	tests := []struct {
+		name       string
+		routingKey string
+		nack       bool
+		keys       []string
+	}{
+		{
+			name: "default-routing-key",
+			keys: []string{"r1", "r2"},
+		},
+		{
+			name:       "routing-key-template",
+			routingKey: "telemetry.{{.Tags.device}}.{{.Measurement}}.{{.Tags.nope}}",
+			keys:       []string{"telemetry.r1.m.", "telemetry.r2.m."},
+		},
+		{
+			name: "nack",
+			nack: true,
+			keys: []string{"r1", "r2"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msgs := make(chan amqpMessage, 10)
+			jctx := &JCtx{}
+			jctx.config.AMQP = AMQPConfig{
+				URL:        fakeAMQPBroker(t, test.nack, msgs),
+				Exchange:   "jtimon",
+				RoutingKey: test.routingKey,
+			}
+
+			w, _, err := openAMQPSink(jctx)
+			if err != nil {
+				t.Fatalf("openAMQPSink failed: %v", err)
+			}
+			defer w.close()
+
+			points := []*point{
+				newPoint("m", map[string]string{"device": "r1"}, map[string]interface{}{"/a": 1.0}, time.Unix(1, 0)),
+				newPoint("m", map[string]string{"device": "r2"}, map[string]interface{}{"/b": "up"}, time.Unix(2, 0)),
+			}
+			err = w.write(points)
+			if test.nack && err == nil {
+				t.Errorf("want error for nacked messages, got nil")
+			}
+			if !test.nack && err != nil {
+				t.Errorf("write failed: %v", err)
+			}
+
+			for i, key := range test.keys {
+				m := <-msgs
+				if m.exchange != "jtimon" {
+					t.Errorf("exchange: want jtimon, got %s", m.exchange)
+				}
+				if m.key != key {
+					t.Errorf("routing key: want %s, got %s", key, m.key)
+				}
+				var got point
+				if err := json.Unmarshal(m.body, &got); err != nil {
+					t.Errorf("could not unmarshal body %s: %v", m.body, err)
+				} else if got.Tags["device"] != points[i].Tags["device"] {
+					t.Errorf("device: want %s, got %s", points[i].Tags["device"], got.Tags["device"])
+				}
+			}
+		})
+	}
+}
+
+func TestAMQPSinkDisabled(t *testing.T) {
+	w, _, err := openAMQPSink(&JCtx{})
+	if w != nil || err != nil {
+		t.Errorf("want nil writer and nil error, got %v %v", w, err)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// AnomalyRule keeps an exponentially weighted moving average and variance
+// of the fields matching match (regex) per series and flags samples whose
+// z-score (distance from the average in standard deviations) is above
+// score. alpha is the weight of the new sample, nothing is flagged before
+// warmup samples were seen. With output "tag" (default) the anomalous field
+// names are added as tag anomaly to the point, with "point" a separate point
+// is written to measurement (default "anomaly") with the value, mean, stddev
+// and score of the field.
+type AnomalyRule struct {
+	Match       string  `json:"match"`
+	Alpha       float64 `json:"alpha"`
+	Score       float64 `json:"score"`
+	Warmup      int     `json:"warmup"`
+	Output      string  `json:"output"`
+	Measurement string  `json:"measurement"`
+}
+
+type anomalyRule struct {
+	AnomalyRule
+	re *regexp.Regexp
+}
+
+type anomalyStats struct {
+	n        int
+	mean     float64
+	variance float64
+}
+
+type anomaly struct {
+	sync.Mutex
+	rules []anomalyRule
+	stats map[string]*anomalyStats
+}
+
+func newAnomalyTransformer() *transformer {
+	return &transformer{
+		name: "anomaly",
+		new:  newAnomaly,
+	}
+}
+
+func newAnomaly(jctx *JCtx) (transform, error) {
+	rules := jctx.config.Transform.Anomaly
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	a := &anomaly{stats: map[string]*anomalyStats{}}
+	for i, rule := range rules {
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: invalid match %q: %v", i, rule.Match, err)
+		}
+		if rule.Alpha == 0 {
+			rule.Alpha = DefaultAnomalyAlpha
+		}
+		if rule.Alpha < 0 || rule.Alpha > 1 {
+			return nil, fmt.Errorf("rule %d: alpha must be between 0 and 1", i)
+		}
+		if rule.Score == 0 {
+			rule.Score = DefaultAnomalyScore
+		}
+		if rule.Warmup == 0 {
+			rule.Warmup = DefaultAnomalyWarmup
+		}
+		switch rule.Output {
+		case "":
+			rule.Output = "tag"
+		case "tag", "point":
+		default:
+			return nil, fmt.Errorf("rule %d: unknown output %q, use tag or point", i, rule.Output)
+		}
+		if rule.Measurement == "" {
+			rule.Measurement = "anomaly"
+		}
+		a.rules = append(a.rules, anomalyRule{AnomalyRule: rule, re: re})
+	}
+	return a, nil
+}
+
+func (a *anomaly) rule(field string) *anomalyRule {
+	for i, rule := range a.rules {
+		if rule.re.MatchString(field) {
+			return &a.rules[i]
+		}
+	}
+	return nil
+}
+
+// update adds v to the stats and returns the z-score of v against the
+// stats before the update, ok is false during warmup
+func (s *anomalyStats) update(v, alpha float64, warmup int) (score float64, ok bool) {
+	if s.n == 0 {
+		s.n, s.mean = 1, v
+		return 0, false
+	}
+	diff := v - s.mean
+	if s.n >= warmup && s.variance > 0 {
+		score, ok = math.Abs(diff)/math.Sqrt(s.variance), true
+	}
+	incr := alpha * diff
+	s.mean += incr
+	s.variance = (1 - alpha) * (s.variance + diff*incr)
+	s.n++
+	return score, ok
+}
+
+func (a *anomaly) apply(points []*point) []*point {
+	a.Lock()
+	defer a.Unlock()
+
+	out := make([]*point, 0, len(points))
+	for _, p := range points {
+		fields := make([]string, 0, len(p.Fields))
+		for k := range p.Fields {
+			fields = append(fields, k)
+		}
+		sort.Strings(fields)
+
+		var flagged []string
+		var extra []*point
+		for _, k := range fields {
+			rule := a.rule(k)
+			if rule == nil {
+				continue
+			}
+			v, _, ok := numericValue(p.Fields[k])
+			if !ok {
+				continue
+			}
+			key := seriesKey(p, k)
+			st := a.stats[key]
+			if st == nil {
+				st = &anomalyStats{}
+				a.stats[key] = st
+			}
+			mean, variance := st.mean, st.variance
+			score, ok := st.update(v, rule.Alpha, rule.Warmup)
+			if !ok || score <= rule.Score {
+				continue
+			}
+
+			if rule.Output == "tag" {
+				flagged = append(flagged, k)
+				continue
+			}
+			tags := make(map[string]string, len(p.Tags)+2)
+			for tk, tv := range p.Tags {
+				tags[tk] = tv
+			}
+			tags["measurement"] = p.Measurement
+			tags["field"] = k
+			extra = append(extra, newPoint(rule.Measurement, tags, map[string]interface{}{
+				"value":  v,
+				"mean":   mean,
+				"stddev": math.Sqrt(variance),
+				"score":  score,
+			}, p.Timestamp))
+		}
+
+		if len(flagged) == 0 {
+			out = append(out, p)
+		} else {
+			tags := make(map[string]string, len(p.Tags)+1)
+			for k, v := range p.Tags {
+				tags[k] = v
+			}
+			tags["anomaly"] = strings.Join(flagged, ",")
+			out = append(out, newPoint(p.Measurement, tags, p.Fields, p.Timestamp))
+		}
+		out = append(out, extra...)
+	}
+	return out
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnomaly(t *testing.T) {
+	sample := func(sec int64, errs float64) []*point {
+		return []*point{newPoint("/interfaces/", map[string]string{"device": "r1"},
+			map[string]interface{}{"in-errors": errs, "in-octets": 1.0}, time.Unix(sec, 0))}
+	}
+
+	t.Run("tag", func(t *testing.T) {
+		jctx := &JCtx{}
+		jctx.config.Transform.Anomaly = []AnomalyRule{{Match: "errors$", Warmup: 5}}
+		if err := transformsInit(jctx); err != nil {
+			t.Fatalf("transformsInit failed: %v", err)
+		}
+		for i := int64(0); i < 20; i++ {
+			out := applyTransforms(jctx, sample(i, float64(10+i%2*2)))
+			if len(out) != 1 || out[0].Tags["anomaly"] != "" {
+				t.Fatalf("sample %d flagged: %v", i, out[0].Tags)
+			}
+		}
+		out := applyTransforms(jctx, sample(20, 50))
+		if len(out) != 1 || out[0].Tags["anomaly"] != "in-errors" {
+			t.Errorf("spike not flagged: %v", out[0].Tags)
+		}
+	})
+
+	t.Run("point", func(t *testing.T) {
+		jctx := &JCtx{}
+		jctx.config.Transform.Anomaly = []AnomalyRule{{Match: "errors$", Warmup: 5, Output: "point", Score: 4}}
+		if err := transformsInit(jctx); err != nil {
+			t.Fatalf("transformsInit failed: %v", err)
+		}
+		for i := int64(0); i < 20; i++ {
+			if out := applyTransforms(jctx, sample(i, float64(10+i%2*2))); len(out) != 1 {
+				t.Fatalf("sample %d flagged", i)
+			}
+		}
+		out := applyTransforms(jctx, sample(20, 50))
+		if len(out) != 2 {
+			t.Fatalf("want 2 points, got %d", len(out))
+		}
+		a := out[1]
+		if a.Measurement != "anomaly" || a.Tags["field"] != "in-errors" || a.Tags["measurement"] != "/interfaces/" ||
+			a.Tags["device"] != "r1" || a.Fields["value"] != 50.0 || a.Fields["score"].(float64) <= 4 {
+			t.Errorf("unexpected anomaly point %v", *a)
+		}
+	})
+
+	t.Run("warmup", func(t *testing.T) {
+		s := &anomalyStats{}
+		for i, v := range []float64{1, 2, 1, 100} {
+			if _, ok := s.update(v, 0.5, 10); ok {
+				t.Errorf("sample %d scored during warmup", i)
+			}
+		}
+	})
+
+	t.Run("bad-alpha", func(t *testing.T) {
+		jctx := &JCtx{}
+		jctx.config.Transform.Anomaly = []AnomalyRule{{Match: "errors$", Alpha: 2}}
+		if err := transformsInit(jctx); err == nil {
+			t.Errorf("want error, got nil")
+		}
+	})
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// apiAuth authenticates the requests of the control endpoints, by a bearer
+// token or the user and password of basic auth. The users and named tokens
+// in scopes see and control the devices of their groups only.
+type apiAuth struct {
+	token  string
+	tokens map[string]string
+	users  map[string]string
+	scopes map[string]apiScope
+}
+
+var (
+	// apiAuthn is the authentication of the control endpoints, nil if they
+	// are open
+	apiAuthn *apiAuth
+	// apiTLS is the TLS config of the internal metrics and admin services,
+	// nil if they serve plain text
+	apiTLS *tls.Config
+	// apiSocketAccess are the clients allowed on the Unix sockets of the
+	// internal metrics and admin services
+	apiSocketAccess *apiSocketACL
+)
+
+// apiSecurityInit sets up the TLS, authentication and rate limits of the
+// internal metrics and admin services from the --api-* flags
+func apiSecurityInit() error {
+	var err error
+	if apiTLS, err = newAPITLSConfig(*apiTLSCert, *apiTLSKey, *apiTLSClientCA); err != nil {
+		return err
+	}
+	if apiAuthn, err = newAPIAuth(*apiTokenFile, *apiUsersFile, *apiScopesFile); err != nil {
+		return err
+	}
+	if apiSocketAccess, err = newAPISocketACL(*apiSockUsers, *apiSockGroups); err != nil {
+		return err
+	}
+	apiLimit = newAPILimiter(*apiRate, *apiBurst)
+	return nil
+}
+
+// newAPITLSConfig returns the TLS config of the certificate and key, nil if
+// they are not set. With clientCA the clients must have a certificate it
+// signed.
+func newAPITLSConfig(cert, key, clientCA string) (*tls.Config, error) {
+	if cert == "" && key == "" {
+		if clientCA != "" {
+			return nil, fmt.Errorf("client certificates can not be verified without TLS")
+		}
+		return nil, nil
+	}
+	certificate, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the API certificate: %v", err)
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{certificate}}
+	if *fipsMode {
+		fipsTLS(cfg)
+	}
+	if clientCA != "" {
+		bs, err := ioutil.ReadFile(clientCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the client ca cert: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if ok := pool.AppendCertsFromPEM(bs); !ok {
+			return nil, fmt.Errorf("failed to append the client ca certs")
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// newAPIAuth returns the authentication of the tokens of tokenFile, a
+// token or "name token" lines, and the user:password lines of usersFile, nil
+// if neither is set. scopesFile limits users and named tokens to groups.
+func newAPIAuth(tokenFile, usersFile, scopesFile string) (*apiAuth, error) {
+	if tokenFile == "" && usersFile == "" {
+		if scopesFile != "" {
+			return nil, fmt.Errorf("scopes need a token or users file")
+		}
+		return nil, nil
+	}
+	a := &apiAuth{tokens: map[string]string{}, users: map[string]string{}}
+	if tokenFile != "" {
+		b, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(b))
+		for n := 1; scanner.Scan(); n++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			switch fields := strings.Fields(line); {
+			case len(fields) == 1 && a.token == "":
+				a.token = fields[0]
+			case len(fields) == 2 && fields[0] != "token":
+				a.tokens[fields[0]] = fields[1]
+			default:
+				return nil, fmt.Errorf("%s:%d: want a token or name token", tokenFile, n)
+			}
+		}
+		if a.token == "" && len(a.tokens) == 0 {
+			return nil, fmt.Errorf("%s has no token", tokenFile)
+		}
+	}
+	if usersFile != "" {
+		b, err := ioutil.ReadFile(usersFile)
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(b))
+		for n := 1; scanner.Scan(); n++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			i := strings.Index(line, ":")
+			if i <= 0 || i == len(line)-1 {
+				return nil, fmt.Errorf("%s:%d: want user:password", usersFile, n)
+			}
+			a.users[line[:i]] = line[i+1:]
+		}
+		if len(a.users) == 0 {
+			return nil, fmt.Errorf("%s has no users", usersFile)
+		}
+	}
+	if scopesFile != "" {
+		var err error
+		if a.scopes, err = readScopes(scopesFile, a); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// known tells whether name is a user or the name of a token
+func (a *apiAuth) known(name string) bool {
+	_, user := a.users[name]
+	_, token := a.tokens[name]
+	return user || token || (name == "token" && a.token != "")
+}
+
+func secretEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// check tells whether the Authorization header has the token or the user
+// and password of a user
+func (a *apiAuth) check(authorization string) bool {
+	if a == nil {
+		return true
+	}
+	_, ok := a.authenticate(authorization)
+	return ok
+}
+
+// authenticate returns the user of the Authorization header, the name of
+// the bearer token (token for the unnamed one), and whether the credentials
+// are valid
+func (a *apiAuth) authenticate(authorization string) (string, bool) {
+	i := strings.Index(authorization, " ")
+	if i == -1 {
+		return "", false
+	}
+	scheme, credentials := authorization[:i], strings.TrimSpace(authorization[i+1:])
+	switch {
+	case strings.EqualFold(scheme, "Bearer"):
+		if a.token != "" && secretEqual(credentials, a.token) {
+			return "token", true
+		}
+		for name, token := range a.tokens {
+			if secretEqual(credentials, token) {
+				return name, true
+			}
+		}
+		return "", false
+	case strings.EqualFold(scheme, "Basic"):
+		b, err := base64.StdEncoding.DecodeString(credentials)
+		if err != nil {
+			return "", false
+		}
+		user := strings.SplitN(string(b), ":", 2)
+		if len(user) != 2 {
+			return "", false
+		}
+		password, ok := a.users[user[0]]
+		return user[0], ok && secretEqual(user[1], password)
+	}
+	return "", false
+}
+
+// handler serves h to the authenticated requests only, with their scope
+func (a *apiAuth) handler(h http.HandlerFunc) http.HandlerFunc {
+	if a == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := a.authenticate(r.Header.Get("Authorization"))
+		if !ok {
+			if len(a.users) != 0 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="jtimon"`)
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h(w, r.WithContext(withScope(r.Context(), a.scopes[user])))
+	}
+}
+
+// grpcUser returns the user of the authorization metadata of the gRPC call,
+// the credentials are as in HTTP, and whether they are valid
+func (a *apiAuth) grpcUser(ctx context.Context) (string, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md["authorization"]
+	if len(values) == 0 {
+		return "", false
+	}
+	return a.authenticate(values[0])
+}
+
+// unaryInterceptor serves the authenticated gRPC calls only, with their
+// scope
+func (a *apiAuth) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	user, ok := a.grpcUser(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	return handler(withScope(ctx, a.scopes[user]), req)
+}
+
+// streamInterceptor serves the authenticated gRPC streams only, those of
+// the reflection which show no device
+func (a *apiAuth) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	if _, ok := a.grpcUser(ss.Context()); !ok {
+		return status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	return handler(srv, ss)
+}
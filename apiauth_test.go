@@ -0,0 +1,239 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nileshsimaria/jtimon/admin"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func basicAuth(user, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
+
+func TestNewAPIAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, content string) string {
+		file := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		users   string
+		err     bool
+		nilAuth bool
+	}{
+		{name: "none", nilAuth: true},
+		{name: "token", token: "t0ken\n"},
+		{name: "users", users: "# operators\nalice:pa:ss\n\nbob:secret\n"},
+		{name: "empty token", token: " \n", err: true},
+		{name: "no users", users: "# nobody\n", err: true},
+		{name: "no password", users: "alice:\n", err: true},
+		{name: "no user", users: ":secret\n", err: true},
+	}
+	for _, test := range tests {
+		var tokenFile, usersFile string
+		if test.token != "" {
+			tokenFile = write("token", test.token)
+		}
+		if test.users != "" {
+			usersFile = write("users", test.users)
+		}
+		a, err := newAPIAuth(tokenFile, usersFile, "")
+		if (err != nil) != test.err {
+			t.Errorf("%s: got error %v", test.name, err)
+			continue
+		}
+		if err == nil && (a == nil) != test.nilAuth {
+			t.Errorf("%s: got %v", test.name, a)
+		}
+	}
+
+	a, err := newAPIAuth("", filepath.Join(dir, "missing"), "")
+	if err == nil {
+		t.Errorf("missing users file: got %v", a)
+	}
+}
+
+func TestAPIAuthCheck(t *testing.T) {
+	a := &apiAuth{token: "t0ken", users: map[string]string{"alice": "pa:ss"}}
+	tests := []struct {
+		auth          *apiAuth
+		authorization string
+		ok            bool
+	}{
+		{auth: nil, authorization: "", ok: true},
+		{auth: a, authorization: "Bearer t0ken", ok: true},
+		{auth: a, authorization: "bearer t0ken", ok: true},
+		{auth: a, authorization: "Bearer t0ke", ok: false},
+		{auth: a, authorization: "t0ken", ok: false},
+		{auth: a, authorization: "", ok: false},
+		{auth: a, authorization: basicAuth("alice", "pa:ss"), ok: true},
+		{auth: a, authorization: basicAuth("alice", "pa"), ok: false},
+		{auth: a, authorization: basicAuth("bob", "pa:ss"), ok: false},
+		{auth: a, authorization: "Basic !!!", ok: false},
+		{auth: &apiAuth{users: a.users}, authorization: "Bearer ", ok: false},
+	}
+	for _, test := range tests {
+		if got := test.auth.check(test.authorization); got != test.ok {
+			t.Errorf("%q: got %t, want %t", test.authorization, got, test.ok)
+		}
+	}
+
+	h := a.handler(func(w http.ResponseWriter, r *http.Request) {})
+	for _, test := range []struct {
+		authorization string
+		code          int
+	}{
+		{authorization: "Bearer t0ken", code: http.StatusOK},
+		{authorization: "", code: http.StatusUnauthorized},
+	} {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/pause", nil)
+		r.Header.Set("Authorization", test.authorization)
+		h(rec, r)
+		if rec.Code != test.code {
+			t.Errorf("%q: got code %d, want %d", test.authorization, rec.Code, test.code)
+		}
+		if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("no WWW-Authenticate")
+		}
+	}
+}
+
+// testCert writes a certificate and its key signed by the parent, self-signed
+// if it is nil, to dir
+func testCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestAdminServerSecurity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca, caKey := testCert(t, dir, "ca", nil, nil)
+	testCert(t, dir, "server", ca, caKey)
+	testCert(t, dir, "client", ca, caKey)
+	file := func(name string) string { return filepath.Join(dir, name) }
+
+	if _, err := newAPITLSConfig("", "", file("ca.crt")); err == nil {
+		t.Errorf("client ca without TLS: expected an error")
+	}
+	if _, err := newAPITLSConfig(file("server.crt"), file("missing.key"), ""); err == nil {
+		t.Errorf("missing key: expected an error")
+	}
+	tlsConfig, err := newAPITLSConfig(file("server.crt"), file("server.key"), file("ca.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apiTLS, apiAuthn = tlsConfig, &apiAuth{token: "t0ken"}
+	defer func() { apiTLS, apiAuthn = nil, nil }()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer(adminServerOptions()...)
+	admin.RegisterAdminServer(s, adminServer{})
+	go s.Serve(lis)
+	defer s.Stop()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	client, err := tls.LoadX509KeyPair(file("client.crt"), file("client.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		certs []tls.Certificate
+		token string
+		code  codes.Code
+	}{
+		{name: "client cert and token", certs: []tls.Certificate{client}, token: "t0ken", code: codes.OK},
+		{name: "no token", certs: []tls.Certificate{client}, code: codes.Unauthenticated},
+		{name: "wrong token", certs: []tls.Certificate{client}, token: "t0ke", code: codes.Unauthenticated},
+		{name: "no client cert", token: "t0ken", code: codes.Unavailable},
+	}
+	for _, test := range tests {
+		creds := credentials.NewTLS(&tls.Config{RootCAs: roots, Certificates: test.certs})
+		conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(creds))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if test.token != "" {
+			ctx = metadata.NewOutgoingContext(ctx, metadata.Pairs("authorization", "Bearer "+test.token))
+		}
+		_, err = admin.NewAdminClient(conn).Status(ctx, &admin.StatusRequest{}, grpc.FailFast(true))
+		if got := status.Code(err); got != test.code {
+			t.Errorf("%s: got code %v, want %v (%v)", test.name, got, test.code, err)
+		}
+		cancel()
+		conn.Close()
+	}
+}
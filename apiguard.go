@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// auditBodyMax is the max size of a request body kept in the audit log
+const auditBodyMax = 64 << 10
+
+// apiLimiterClients is the number of clients above which the buckets of the
+// idle ones are dropped
+const apiLimiterClients = 1024
+
+var (
+	// apiLimit limits the requests of each client to the control
+	// endpoints, nil if they are not limited
+	apiLimit *apiLimiter
+	// apiAudit is the audit log of the changes made over the API, nil if
+	// there is none
+	apiAudit *auditLog
+)
+
+// tokenBucket is the tokens left to a client and when they were counted
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// apiLimiter limits the requests per client to rate per second, with bursts
+// of burst requests
+type apiLimiter struct {
+	sync.Mutex
+	rate    float64
+	burst   float64
+	clients map[string]*tokenBucket
+	now     func() time.Time
+}
+
+// newAPILimiter returns the limiter of rate requests per second, nil if rate
+// is not positive
+func newAPILimiter(rate float64, burst int) *apiLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &apiLimiter{rate: rate, burst: float64(burst), clients: map[string]*tokenBucket{}, now: time.Now}
+}
+
+// allow takes a token of the client, it returns false if there is none
+func (l *apiLimiter) allow(client string) bool {
+	if l == nil {
+		return true
+	}
+	l.Lock()
+	defer l.Unlock()
+	now := l.now()
+	if len(l.clients) >= apiLimiterClients {
+		// a bucket which filled up again is the same as a new one
+		for c, b := range l.clients {
+			if now.Sub(b.last).Seconds()*l.rate >= l.burst {
+				delete(l.clients, c)
+			}
+		}
+	}
+	b, ok := l.clients[client]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.clients[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// handler serves h to the clients within their limit, 429 to the others
+func (l *apiLimiter) handler(h http.HandlerFunc) http.HandlerFunc {
+	if l == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !l.allow(remoteHost(r.RemoteAddr)) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(1/l.rate))))
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (l *apiLimiter) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	if !l.allow(grpcClient(ctx)) {
+		return nil, status.Error(codes.ResourceExhausted, "too many requests")
+	}
+	return handler(ctx, req)
+}
+
+func (l *apiLimiter) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	if !l.allow(grpcClient(ss.Context())) {
+		return status.Error(codes.ResourceExhausted, "too many requests")
+	}
+	return handler(srv, ss)
+}
+
+// remoteHost is the host of the remote address of a request
+func remoteHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// grpcClient is the host of the client of a gRPC call
+func grpcClient(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		return remoteHost(p.Addr.String())
+	}
+	return ""
+}
+
+// auditRecord is a change made over the API: who, from where, what and when
+type auditRecord struct {
+	Time     time.Time `json:"time"`
+	Client   string    `json:"client"`
+	User     string    `json:"user,omitempty"`
+	Cert     string    `json:"cert,omitempty"`
+	Method   string    `json:"method"`
+	Endpoint string    `json:"endpoint"`
+	Query    string    `json:"query,omitempty"`
+	Body     string    `json:"body,omitempty"`
+	Status   string    `json:"status"`
+	// Device is the device of the reloads and rotations
+	Device string `json:"device,omitempty"`
+	// Before and After are the states of the devices, or the settings,
+	// which changed
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// auditLog writes the audit records as JSON lines
+type auditLog struct {
+	sync.Mutex
+	w io.Writer
+}
+
+func (a *auditLog) log(rec auditRecord) {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	a.Lock()
+	defer a.Unlock()
+	if _, err := a.w.Write(append(b, '\n')); err != nil {
+		globalLog(LogLevelError, fmt.Sprintf("Could not write the audit log: %v", err))
+	}
+}
+
+// apiUser is the user of the credentials of the authorization header, token
+// for a bearer token
+func apiUser(authorization string) string {
+	if apiAuthn == nil {
+		return ""
+	}
+	user, _ := apiAuthn.authenticate(authorization)
+	return user
+}
+
+// statusRecorder keeps the status written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// handler serves h and writes an audit record of each request which is not
+// a GET
+func (a *auditLog) handler(h http.HandlerFunc) http.HandlerFunc {
+	if a == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" || r.Method == "HEAD" {
+			h(w, r)
+			return
+		}
+		var body []byte
+		if r.Body != nil {
+			body, _ = ioutil.ReadAll(io.LimitReader(r.Body, auditBodyMax))
+			r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		}
+		ctx, changes := withAuditChanges(r.Context())
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		h(rec, r.WithContext(ctx))
+
+		record := auditRecord{
+			Time:     time.Now().UTC(),
+			Client:   remoteHost(r.RemoteAddr),
+			User:     apiUser(r.Header.Get("Authorization")),
+			Method:   r.Method,
+			Endpoint: r.URL.Path,
+			Query:    r.URL.RawQuery,
+			Body:     string(bytes.TrimSpace(body)),
+			Status:   strconv.Itoa(rec.code),
+		}
+		if r.TLS != nil && len(r.TLS.PeerCertificates) != 0 {
+			record.Cert = r.TLS.PeerCertificates[0].Subject.CommonName
+		}
+		changes.fill(&record)
+		a.log(record)
+	}
+}
+
+// auditedCalls are the admin calls which change the state of jtimon
+var auditedCalls = map[string]bool{
+	"/admin.Admin/Pause":    true,
+	"/admin.Admin/Resume":   true,
+	"/admin.Admin/SetPaths": true,
+}
+
+func (a *auditLog) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	if !auditedCalls[info.FullMethod] {
+		return handler(ctx, req)
+	}
+	ctx, changes := withAuditChanges(ctx)
+	resp, err := handler(ctx, req)
+
+	record := auditRecord{
+		Time:     time.Now().UTC(),
+		Client:   grpcClient(ctx),
+		Method:   "gRPC",
+		Endpoint: info.FullMethod,
+		Status:   status.Code(err).String(),
+	}
+	if b, err := json.Marshal(req); err == nil {
+		record.Body = string(b)
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md["authorization"]; len(values) != 0 {
+		record.User = apiUser(values[0])
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.PeerCertificates) != 0 {
+			record.Cert = tlsInfo.State.PeerCertificates[0].Subject.CommonName
+		}
+	}
+	changes.fill(&record)
+	a.log(record)
+	return resp, err
+}
+
+// apiHandler guards a control endpoint: the client is rate limited, then
+// authenticated, and its changes are audited
+func apiHandler(h http.HandlerFunc) http.HandlerFunc {
+	return apiLimit.handler(apiAuthn.handler(apiAudit.handler(h)))
+}
+
+// chainUnary runs the interceptors in order, the last one calls the handler
+func chainUnary(interceptors ...grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		next := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, h := interceptors[i], next
+			next = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, h)
+			}
+		}
+		return next(ctx, req)
+	}
+}
+
+// chainStream runs the interceptors in order, the last one calls the handler
+func chainStream(interceptors ...grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		next := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, h := interceptors[i], next
+			next = func(srv interface{}, ss grpc.ServerStream) error {
+				return interceptor(srv, ss, info, h)
+			}
+		}
+		return next(srv, ss)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nileshsimaria/jtimon/admin"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAPILimiter(t *testing.T) {
+	if l := newAPILimiter(0, 10); l != nil || !l.allow("10.0.0.1") {
+		t.Errorf("no rate: got %v", l)
+	}
+
+	now := time.Date(2020, 3, 1, 10, 30, 0, 0, time.UTC)
+	l := newAPILimiter(1, 2)
+	l.now = func() time.Time { return now }
+	tests := []struct {
+		after  time.Duration
+		client string
+		want   bool
+	}{
+		{client: "10.0.0.1", want: true},
+		{client: "10.0.0.1", want: true},
+		{client: "10.0.0.1", want: false},
+		{client: "10.0.0.2", want: true},
+		{after: 500 * time.Millisecond, client: "10.0.0.1", want: false},
+		{after: 500 * time.Millisecond, client: "10.0.0.1", want: true},
+		{after: 10 * time.Second, client: "10.0.0.1", want: true},
+		{client: "10.0.0.1", want: true},
+		{client: "10.0.0.1", want: false},
+	}
+	for i, test := range tests {
+		now = now.Add(test.after)
+		if got := l.allow(test.client); got != test.want {
+			t.Errorf("request %d of %s: got %t, want %t", i, test.client, got, test.want)
+		}
+	}
+
+	// the buckets of idle clients are dropped
+	for i := 0; i < apiLimiterClients; i++ {
+		l.allow(string(rune('a'+i%26)) + strings.Repeat("x", i))
+	}
+	now = now.Add(time.Minute)
+	l.allow("10.0.0.3")
+	if len(l.clients) != 1 {
+		t.Errorf("got %d clients, want 1", len(l.clients))
+	}
+
+	h := l.handler(func(w http.ResponseWriter, r *http.Request) {})
+	codes := []int{}
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("POST", "/pause", nil))
+		codes = append(codes, rec.Code)
+		if rec.Code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "1" {
+			t.Errorf("got Retry-After %q", rec.Header().Get("Retry-After"))
+		}
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("got codes %v", codes)
+	}
+}
+
+func TestAuditHandler(t *testing.T) {
+	apiAuthn = &apiAuth{users: map[string]string{"alice": "pa:ss"}}
+	defer func() { apiAuthn = nil }()
+	var buf bytes.Buffer
+	a := &auditLog{w: &buf}
+
+	h := a.handler(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" {
+			if b, _ := ioutil.ReadAll(r.Body); string(b) != `{"paths": [{"path": "/bgp/"}]}` {
+				t.Errorf("the handler got body %q", b)
+			}
+			return
+		}
+		if r.Method == "POST" {
+			http.Error(w, "no such device or path", http.StatusNotFound)
+		}
+	})
+	for _, r := range []*http.Request{
+		httptest.NewRequest("GET", "/pause", nil),
+		httptest.NewRequest("POST", "/pause?device=r9", nil),
+		httptest.NewRequest("PUT", "/devices/r1/paths?persist=true", strings.NewReader(`{"paths": [{"path": "/bgp/"}]}`)),
+	} {
+		r.Header.Set("Authorization", basicAuth("alice", "pa:ss"))
+		h(httptest.NewRecorder(), r)
+	}
+
+	var got []auditRecord
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec auditRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatal(err)
+		}
+		if time.Since(rec.Time) > time.Minute {
+			t.Errorf("got time %v", rec.Time)
+		}
+		rec.Time = time.Time{}
+		got = append(got, rec)
+	}
+	want := []auditRecord{
+		{Client: "192.0.2.1", User: "alice", Method: "POST", Endpoint: "/pause", Query: "device=r9", Status: "404"},
+		{Client: "192.0.2.1", User: "alice", Method: "PUT", Endpoint: "/devices/r1/paths", Query: "persist=true",
+			Body: `{"paths": [{"path": "/bgp/"}]}`, Status: "200"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("record %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestAdminServerGuards(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "audit.log")
+	if err := ioutil.WriteFile(file, []byte("{}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := newAppendingFile(file, LogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	apiLimit, apiAuthn, apiAudit = newAPILimiter(0.001, 3), &apiAuth{token: "t0ken"}, &auditLog{w: f}
+	defer func() { apiLimit, apiAuthn, apiAudit = nil, nil, nil }()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer(adminServerOptions()...)
+	admin.RegisterAdminServer(s, adminServer{})
+	go s.Serve(lis)
+	defer s.Stop()
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := admin.NewAdminClient(conn)
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", "Bearer t0ken"))
+
+	if _, err := c.Status(ctx, &admin.StatusRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Pause(ctx, &admin.PauseRequest{Device: "r9"}); status.Code(err) != codes.NotFound {
+		t.Errorf("pause: got %v", err)
+	}
+	if _, err := c.Pause(context.Background(), &admin.PauseRequest{Device: "r9"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("pause without token: got %v", err)
+	}
+	if _, err := c.Status(ctx, &admin.StatusRequest{}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("over the limit: got %v", err)
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 || lines[0] != "{}" {
+		t.Fatalf("got audit log %q", b)
+	}
+	var rec auditRecord
+	if err := json.Unmarshal([]byte(lines[1]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	rec.Time = time.Time{}
+	want := auditRecord{Client: "127.0.0.1", User: "token", Method: "gRPC", Endpoint: "/admin.Admin/Pause",
+		Body: `{"device":"r9"}`, Status: "NotFound"}
+	if rec != want {
+		t.Errorf("got %+v, want %+v", rec, want)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// peerCredentials are the user, group and process of the client of a Unix
+// socket, from the kernel
+type peerCredentials struct {
+	uid, gid uint32
+	pid      int32
+}
+
+// apiSocketACL are the users and groups allowed on the API sockets
+type apiSocketACL struct {
+	uids map[uint32]bool
+	gids map[uint32]bool
+}
+
+// metricsEnabled tells whether the internal metrics service is served, on
+// its port or its socket
+func metricsEnabled() bool {
+	return *metricsPort != 0 || *metricsSocket != ""
+}
+
+// adminEnabled tells whether the admin service is served, on its port or
+// its socket
+func adminEnabled() bool {
+	return *adminPort != 0 || *adminSocket != ""
+}
+
+// newAPISocketACL returns the users and groups, names or ids separated by
+// commas, allowed on the API sockets. Without any, only the user of jtimon
+// is.
+func newAPISocketACL(users, groups string) (*apiSocketACL, error) {
+	acl := &apiSocketACL{uids: map[uint32]bool{}, gids: map[uint32]bool{}}
+	for _, name := range strings.Split(users, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		id := name
+		if _, err := strconv.ParseUint(name, 10, 32); err != nil {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return nil, err
+			}
+			id = u.Uid
+		}
+		uid, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uid %s of %s", id, name)
+		}
+		acl.uids[uint32(uid)] = true
+	}
+	for _, name := range strings.Split(groups, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		id := name
+		if _, err := strconv.ParseUint(name, 10, 32); err != nil {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return nil, err
+			}
+			id = g.Gid
+		}
+		gid, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gid %s of %s", id, name)
+		}
+		acl.gids[uint32(gid)] = true
+	}
+	if len(acl.uids) == 0 && len(acl.gids) == 0 {
+		acl.uids[uint32(os.Getuid())] = true
+	}
+	return acl, nil
+}
+
+func (acl *apiSocketACL) allowed(cred peerCredentials) bool {
+	return acl.uids[cred.uid] || acl.gids[cred.gid]
+}
+
+// listenAPISocket listens on the Unix socket path for the clients of acl, a
+// stale socket of a previous run is removed
+func listenAPISocket(path string, acl *apiSocketACL) (net.Listener, error) {
+	if !peerCredSupported {
+		return nil, fmt.Errorf("the peer credentials of Unix sockets are not supported on this system")
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// the peer credentials decide, the mode keeps the others from even
+	// connecting
+	if err := os.Chmod(path, 0660); err != nil {
+		lis.Close()
+		return nil, err
+	}
+	return &peerCredListener{Listener: lis, acl: acl}, nil
+}
+
+// peerCredListener accepts the clients of its ACL only, the others are
+// disconnected at once
+type peerCredListener struct {
+	net.Listener
+	acl *apiSocketACL
+}
+
+func (l *peerCredListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		cred, err := peerCred(conn)
+		if err != nil {
+			log.Printf("API socket %s: %v", l.Addr(), err)
+			conn.Close()
+			continue
+		}
+		if !l.acl.allowed(cred) {
+			log.Printf("API socket %s: uid %d gid %d (pid %d) is not allowed", l.Addr(), cred.uid, cred.gid, cred.pid)
+			conn.Close()
+			continue
+		}
+		return &peerConn{Conn: conn, cred: cred}, nil
+	}
+}
+
+// peerConn is a connection of an API socket, its remote address is the
+// user and group of the client for the rate limits and the audit log
+type peerConn struct {
+	net.Conn
+	cred peerCredentials
+}
+
+func (c *peerConn) RemoteAddr() net.Addr {
+	return &net.UnixAddr{Net: "unix", Name: fmt.Sprintf("uid=%d,gid=%d", c.cred.uid, c.cred.gid)}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/nileshsimaria/jtimon/admin"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+func TestAPISocketACL(t *testing.T) {
+	tests := []struct {
+		name   string
+		users  string
+		groups string
+		uids   []uint32
+		gids   []uint32
+		err    bool
+	}{
+		{name: "default", uids: []uint32{uint32(os.Getuid())}},
+		{name: "ids", users: "1000, 1001", groups: "50", uids: []uint32{1000, 1001}, gids: []uint32{50}},
+		{name: "names", users: "root", groups: "root", uids: []uint32{0}, gids: []uint32{0}},
+		{name: "groups only", groups: "2000", gids: []uint32{2000}},
+		{name: "unknown user", users: "no-such-user-of-jtimon", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			acl, err := newAPISocketACL(test.users, test.groups)
+			if test.err {
+				if err == nil {
+					t.Errorf("no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(acl.uids) != len(test.uids) || len(acl.gids) != len(test.gids) {
+				t.Errorf("got %v %v", acl.uids, acl.gids)
+			}
+			for _, uid := range test.uids {
+				if !acl.allowed(peerCredentials{uid: uid, gid: 99999}) {
+					t.Errorf("uid %d not allowed", uid)
+				}
+			}
+			for _, gid := range test.gids {
+				if !acl.allowed(peerCredentials{uid: 99999, gid: gid}) {
+					t.Errorf("gid %d not allowed", gid)
+				}
+			}
+		})
+	}
+}
+
+func TestAPISocket(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials are known on Linux only")
+	}
+	dir, err := ioutil.TempDir("", "jtimon-socket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	serve := func(name string, acl *apiSocketACL) (*http.Client, chan string) {
+		path := filepath.Join(dir, name)
+		// a stale socket is replaced
+		if stale, err := net.Listen("unix", path); err == nil {
+			stale.(*net.UnixListener).SetUnlinkOnClose(false)
+			stale.Close()
+		}
+		lis, err := listenAPISocket(path, acl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info, _ := os.Stat(path); info.Mode().Perm() != 0660 {
+			t.Errorf("socket mode %v", info.Mode())
+		}
+		clients := make(chan string, 1)
+		go http.Serve(lis, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			clients <- r.RemoteAddr
+		}))
+		return &http.Client{
+			Timeout: time.Second,
+			Transport: &http.Transport{Dial: func(network, addr string) (net.Conn, error) {
+				return net.Dial("unix", path)
+			}},
+		}, clients
+	}
+
+	c, clients := serve("allowed.sock", &apiSocketACL{uids: map[uint32]bool{uint32(os.Getuid()): true}})
+	resp, err := c.Get("http://jtimon/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got, want := <-clients, fmt.Sprintf("uid=%d,gid=%d", os.Getuid(), os.Getgid()); got != want {
+		t.Errorf("client %s, want %s", got, want)
+	}
+
+	c, _ = serve("group.sock", &apiSocketACL{gids: map[uint32]bool{uint32(os.Getgid()): true}})
+	if resp, err := c.Get("http://jtimon/health"); err != nil {
+		t.Errorf("group not allowed: %v", err)
+	} else {
+		resp.Body.Close()
+	}
+
+	c, _ = serve("denied.sock", &apiSocketACL{uids: map[uint32]bool{uint32(os.Getuid()) + 1: true}})
+	if _, err := c.Get("http://jtimon/health"); err == nil {
+		t.Errorf("other user allowed")
+	}
+
+	// the admin service
+	path := filepath.Join(dir, "admin.sock")
+	lis, err := listenAPISocket(path, &apiSocketACL{uids: map[uint32]bool{uint32(os.Getuid()): true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newAdminServer(adminGuardOptions())
+	go s.Serve(lis)
+	defer s.Stop()
+	conn, err := grpc.Dial(path, grpc.WithInsecure(), grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+		return net.DialTimeout("unix", addr, timeout)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := admin.NewAdminClient(conn).Status(ctx, &admin.StatusRequest{}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// auditInit opens the audit log of --audit-log, or of --api-audit-log which
+// it replaces
+func auditInit() error {
+	file := *auditFile
+	if file == "" {
+		file = *apiAuditFile
+	}
+	if file == "" {
+		return nil
+	}
+	f, err := newAppendingFile(file, LogConfig{})
+	if err != nil {
+		return err
+	}
+	apiAudit = &auditLog{w: f}
+	return nil
+}
+
+// auditChanges are the states before and after a change made over the API,
+// by device, the handlers add them to the audit record of the request
+type auditChanges struct {
+	sync.Mutex
+	before map[string]interface{}
+	after  map[string]interface{}
+}
+
+type auditKey struct{}
+
+// withAuditChanges returns ctx carrying the changes of its request
+func withAuditChanges(ctx context.Context) (context.Context, *auditChanges) {
+	c := &auditChanges{}
+	return context.WithValue(ctx, auditKey{}, c), c
+}
+
+// auditChange records the state of device before and after a change of the
+// request of ctx, nothing if it is not audited
+func auditChange(ctx context.Context, device string, before, after interface{}) {
+	c, ok := ctx.Value(auditKey{}).(*auditChanges)
+	if !ok {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	if c.before == nil {
+		c.before, c.after = map[string]interface{}{}, map[string]interface{}{}
+	}
+	c.before[device], c.after[device] = before, after
+}
+
+// fill sets the changes to the record
+func (c *auditChanges) fill(rec *auditRecord) {
+	c.Lock()
+	defer c.Unlock()
+	if c.before != nil {
+		rec.Before, rec.After = c.before, c.after
+	}
+}
+
+// auditStatus is the status of the records which are not requests
+func auditStatus(err error) string {
+	if err != nil {
+		return "failed: " + err.Error()
+	}
+	return "ok"
+}
+
+// auditReload writes the record of a config reload of the worker, with the
+// settings which changed from old, their secrets redacted
+func auditReload(jctx *JCtx, old Config, err error) {
+	if apiAudit == nil {
+		return
+	}
+	rec := auditRecord{
+		Time:     time.Now().UTC(),
+		Method:   "reload",
+		Endpoint: jctx.file,
+		Device:   old.Host,
+		Status:   auditStatus(err),
+	}
+	if err == nil {
+		if before, after := configChanges(old, jctx.config); len(before) != 0 {
+			rec.Before, rec.After = before, after
+		}
+	}
+	apiAudit.log(rec)
+}
+
+// auditRotation writes the record of a rotation of the credentials what of
+// the device, "" for the ones of jtimon
+func auditRotation(device, what string, before, after interface{}) {
+	if apiAudit == nil {
+		return
+	}
+	apiAudit.log(auditRecord{
+		Time:     time.Now().UTC(),
+		Method:   "rotate",
+		Endpoint: what,
+		Device:   device,
+		Before:   before,
+		After:    after,
+		Status:   "ok",
+	})
+}
+
+// configChanges returns the top level settings which differ between the
+// configs, as in the config files with the secrets redacted. A secret
+// which changed is listed, redacted on both sides.
+func configChanges(old, new Config) (before, after map[string]interface{}) {
+	o, n := configMap(old), configMap(new)
+	before, after = map[string]interface{}{}, map[string]interface{}{}
+	for k := range o {
+		if !reflect.DeepEqual(o[k], n[k]) {
+			before[k] = redactValue(k, o[k])
+		}
+	}
+	for k := range n {
+		if !reflect.DeepEqual(o[k], n[k]) {
+			after[k] = redactValue(k, n[k])
+		}
+	}
+	return before, after
+}
+
+func configMap(cfg Config) map[string]interface{} {
+	m := map[string]interface{}{}
+	if b, err := json.Marshal(cfg); err == nil {
+		json.Unmarshal(b, &m)
+	}
+	return m
+}
+
+// fileSums are the short sha256 of files, for the records of rotations
+func fileSums(sums map[string][32]byte) map[string]string {
+	m := map[string]string{}
+	for f, sum := range sums {
+		m[f] = fmt.Sprintf("%x", sum[:8])
+	}
+	return m
+}
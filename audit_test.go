@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testAuditRecords returns the records of the audit log as JSON objects
+func testAuditRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatal(err)
+		}
+		delete(rec, "time")
+		records = append(records, rec)
+	}
+	buf.Reset()
+	return records
+}
+
+func TestAuditChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "r1.json")
+	write := func(config string) {
+		if err := ioutil.WriteFile(file, []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"host": "r1", "port": 32767, "user": "jtimon", "password": "old", "paths": [{"path": "/interfaces/", "freq": 2000}]}`)
+	cfg, err := NewJTIMONConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jctx := &JCtx{file: file, config: cfg, signalch: make(chan os.Signal, 1)}
+	jctx.control = make(chan os.Signal)
+	dropsInit(jctx)
+	defer dropsStop(jctx)
+
+	var buf bytes.Buffer
+	apiAudit = &auditLog{w: &buf}
+	defer func() { apiAudit = nil }()
+	handler := apiAudit.handler(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/devices/") {
+			devicesHandler(w, r)
+			return
+		}
+		pauseHandler(w, r)
+	})
+	reload := func() {
+		restart := false
+		ConfigRead(jctx, false, &restart)
+	}
+
+	// the paths set over the API, then the reload they make
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("PUT", "/devices/r1/paths", strings.NewReader(`{"paths": [{"path": "/bgp/", "freq": 5000}]}`)))
+	if rec.Code != 200 {
+		t.Fatalf("got %d %s", rec.Code, rec.Body)
+	}
+	<-jctx.signalch
+	reload()
+	got := testAuditRecords(t, &buf)
+	want := []map[string]interface{}{
+		{
+			"client": "192.0.2.1", "method": "PUT", "endpoint": "/devices/r1/paths", "status": "200",
+			"body":   `{"paths": [{"path": "/bgp/", "freq": 5000}]}`,
+			"before": map[string]interface{}{"r1": map[string]interface{}{"paths": []interface{}{map[string]interface{}{"path": "/interfaces/", "freq": 2000.0, "mode": "", "priority": 0.0}}}},
+			"after":  map[string]interface{}{"r1": map[string]interface{}{"paths": []interface{}{map[string]interface{}{"path": "/bgp/", "freq": 5000.0, "mode": "", "priority": 0.0}}}},
+		},
+		{
+			"client": "", "method": "reload", "endpoint": file, "device": "r1", "status": "ok",
+			"before": map[string]interface{}{"paths": []interface{}{map[string]interface{}{"path": "/interfaces/", "freq": 2000.0, "mode": "", "priority": 0.0}}},
+			"after":  map[string]interface{}{"paths": []interface{}{map[string]interface{}{"path": "/bgp/", "freq": 5000.0, "mode": "", "priority": 0.0}}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+
+	// a new password is listed, redacted
+	write(`{"host": "r1", "port": 32767, "user": "jtimon", "password": "new", "paths": [{"path": "/interfaces/", "freq": 2000}]}`)
+	jctx.pathsSet.set(nil)
+	reload()
+	logged := buf.String()
+	got = testAuditRecords(t, &buf)
+	if len(got) != 1 || !reflect.DeepEqual(got[0]["before"], map[string]interface{}{
+		"password": redacted, "paths": []interface{}{map[string]interface{}{"path": "/bgp/", "freq": 5000.0, "mode": "", "priority": 0.0}},
+	}) || !reflect.DeepEqual(got[0]["after"], map[string]interface{}{
+		"password": redacted, "paths": []interface{}{map[string]interface{}{"path": "/interfaces/", "freq": 2000.0, "mode": "", "priority": 0.0}},
+	}) || strings.Contains(logged, `"new"`) || strings.Contains(logged, `"old"`) {
+		t.Errorf("got %v", got)
+	}
+
+	// the reloads which fail
+	write(`{"host": "r1", "port": 32767,`)
+	reload()
+	got = testAuditRecords(t, &buf)
+	if len(got) != 1 || got[0]["method"] != "reload" || !strings.HasPrefix(got[0]["status"].(string), "failed: ") || got[0]["before"] != nil {
+		t.Errorf("got %v", got)
+	}
+	write(`{"host": "r1", "port": 32767, "user": "jtimon", "password": "new", "paths": [{"path": "/interfaces/", "freq": 2000}], "influx": {"server": "127.0.0.1"}}`)
+	reload()
+	got = testAuditRecords(t, &buf)
+	if len(got) != 1 || !strings.Contains(got[0]["status"].(string), "Influxdb config changes are not allowed") {
+		t.Errorf("got %v", got)
+	}
+
+	// the state of the paused devices
+	handler(httptest.NewRecorder(), httptest.NewRequest("POST", "/pause?device=r1&path=/interfaces/", nil))
+	got = testAuditRecords(t, &buf)
+	if len(got) != 1 ||
+		!reflect.DeepEqual(got[0]["before"], map[string]interface{}{"r1": map[string]interface{}{"device": "r1", "port": 32767.0, "paused": false, "paused-paths": []interface{}{}}}) ||
+		!reflect.DeepEqual(got[0]["after"], map[string]interface{}{"r1": map[string]interface{}{"device": "r1", "port": 32767.0, "paused": false, "paused-paths": []interface{}{"/interfaces/"}}}) {
+		t.Errorf("got %v", got)
+	}
+
+	// the rotations
+	auditRotation("r1", "tls", fileSums(map[string][32]byte{"client.crt": {1}}), fileSums(map[string][32]byte{"client.crt": {2}}))
+	got = testAuditRecords(t, &buf)
+	if len(got) != 1 || got[0]["method"] != "rotate" || got[0]["endpoint"] != "tls" || got[0]["device"] != "r1" ||
+		!reflect.DeepEqual(got[0]["after"], map[string]interface{}{"client.crt": "0200000000000000"}) {
+		t.Errorf("got %v", got)
+	}
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// AWSAuth is the region and IAM credentials of the AWS sinks. Credentials
+// not given in the config are taken from AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+type AWSAuth struct {
+	Region          string `json:"region"`
+	AccessKeyID     string `json:"access-key-id"`
+	SecretAccessKey string `json:"secret-access-key"`
+	SessionToken    string `json:"session-token"`
+	Endpoint        string `json:"endpoint"`
+}
+
+// KinesisConfig is the config of the AWS Kinesis Data Streams sink
+type KinesisConfig struct {
+	Stream       string `json:"stream"`
+	PartitionKey string `json:"partition-key"`
+	AWSAuth
+	BatchConfig
+}
+
+// TimestreamConfig is the config of the AWS Timestream sink
+type TimestreamConfig struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	AWSAuth
+	BatchConfig
+}
+
+const (
+	kinesisMaxRecords    = 500
+	timestreamMaxRecords = 100
+)
+
+func (a AWSAuth) credentials() (AWSAuth, error) {
+	if a.AccessKeyID == "" {
+		a.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		a.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		a.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if a.Region == "" {
+		a.Region = os.Getenv("AWS_REGION")
+	}
+	if a.AccessKeyID == "" || a.SecretAccessKey == "" {
+		return a, fmt.Errorf("aws credentials are missing")
+	}
+	if a.Region == "" {
+		return a, fmt.Errorf("aws region is missing")
+	}
+	return a, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// signV4 signs the request with AWS Signature Version 4. Host and all of
+// the headers already set on the request are signed.
+func signV4(req *http.Request, body []byte, auth AWSAuth, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if auth.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", auth.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders bytes.Buffer
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + auth.Region + "/" + service + "/aws4_request"
+	crHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(crHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+auth.SecretAccessKey), date)
+	key = hmacSHA256(key, auth.Region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		auth.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// awsJSONCall invokes one action of AWS JSON protocol API
+func awsJSONCall(c *http.Client, url string, auth AWSAuth, service, target, contentType string, in interface{}, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Amz-Target", target)
+	signV4(req, body, auth, service, time.Now())
+
+	resp, err := sinkHTTPDo(c, req)
+	if err != nil {
+		return err
+	}
+	if out != nil {
+		return json.Unmarshal(resp, out)
+	}
+	return nil
+}
+
+type kinesisSink struct {
+	cfg          KinesisConfig
+	url          string
+	partitionKey *template.Template
+	client       *http.Client
+}
+
+func newKinesisSink() *sink {
+	return &sink{
+		name: "kinesis",
+		open: openKinesisSink,
+	}
+}
+
+func openKinesisSink(jctx *JCtx) (sinkWriter, BatchConfig, error) {
+	cfg := jctx.config.Kinesis
+	if cfg.Stream == "" {
+		return nil, cfg.BatchConfig, nil
+	}
+	auth, err := cfg.AWSAuth.credentials()
+	if err != nil {
+		return nil, cfg.BatchConfig, err
+	}
+	cfg.AWSAuth = auth
+
+	partitionKey := cfg.PartitionKey
+	if partitionKey == "" {
+		partitionKey = DefaultKinesisPartitionKey
+	}
+	t, err := newKeyTemplate("partition-key", partitionKey)
+	if err != nil {
+		return nil, cfg.BatchConfig, err
+	}
+
+	url := cfg.Endpoint
+	if url == "" {
+		url = fmt.Sprintf("https://kinesis.%s.amazonaws.com/", cfg.Region)
+	}
+	return &kinesisSink{
+		cfg:          cfg,
+		url:          url,
+		partitionKey: t,
+		client:       &http.Client{Timeout: time.Duration(DefaultIDBTimeout) * time.Second},
+	}, cfg.BatchConfig, nil
+}
+
+type kinesisRecord struct {
+	Data         []byte `json:"Data"`
+	PartitionKey string `json:"PartitionKey"`
+}
+
+func (s *kinesisSink) write(points []*point) error {
+	for len(points) > 0 {
+		n := len(points)
+		if n > kinesisMaxRecords {
+			n = kinesisMaxRecords
+		}
+		if err := s.putRecords(points[:n]); err != nil {
+			return err
+		}
+		points = points[n:]
+	}
+	return nil
+}
+
+func (s *kinesisSink) putRecords(points []*point) error {
+	records := make([]kinesisRecord, 0, len(points))
+	for _, p := range points {
+		data, err := json.Marshal(p)
+		if err != nil {
+			continue
+		}
+		key, err := execKeyTemplate(s.partitionKey, p)
+		if err != nil {
+			return err
+		}
+		if key == "" {
+			key = "jtimon"
+		}
+		records = append(records, kinesisRecord{Data: data, PartitionKey: key})
+	}
+
+	var out struct {
+		FailedRecordCount int
+	}
+	in := map[string]interface{}{"StreamName": s.cfg.Stream, "Records": records}
+	if err := awsJSONCall(s.client, s.url, s.cfg.AWSAuth, "kinesis", "Kinesis_20131202.PutRecords",
+		"application/x-amz-json-1.1", in, &out); err != nil {
+		return err
+	}
+	if out.FailedRecordCount != 0 {
+		return fmt.Errorf("kinesis: %d of %d records failed", out.FailedRecordCount, len(records))
+	}
+	return nil
+}
+
+func (s *kinesisSink) close() {
+}
+
+type timestreamSink struct {
+	cfg      TimestreamConfig
+	client   *http.Client
+	url      string
+	urlValid time.Time
+}
+
+func newTimestreamSink() *sink {
+	return &sink{
+		name: "timestream",
+		open: openTimestreamSink,
+	}
+}
+
+func openTimestreamSink(jctx *JCtx) (sinkWriter, BatchConfig, error) {
+	cfg := jctx.config.Timestream
+	if cfg.Table == "" {
+		return nil, cfg.BatchConfig, nil
+	}
+	if cfg.Database == "" {
+		return nil, cfg.BatchConfig, fmt.Errorf("timestream database is missing")
+	}
+	auth, err := cfg.AWSAuth.credentials()
+	if err != nil {
+		return nil, cfg.BatchConfig, err
+	}
+	cfg.AWSAuth = auth
+
+	return &timestreamSink{
+		cfg:    cfg,
+		client: &http.Client{Timeout: time.Duration(DefaultIDBTimeout) * time.Second},
+	}, cfg.BatchConfig, nil
+}
+
+// endpoint returns the ingest endpoint. Timestream requires endpoint
+// discovery unless the endpoint is configured explicitly.
+func (s *timestreamSink) endpoint() (string, error) {
+	if s.cfg.Endpoint != "" {
+		return s.cfg.Endpoint, nil
+	}
+	if s.url != "" && time.Now().Before(s.urlValid) {
+		return s.url, nil
+	}
+
+	var out struct {
+		Endpoints []struct {
+			Address              string
+			CachePeriodInMinutes int64
+		}
+	}
+	url := fmt.Sprintf("https://ingest.timestream.%s.amazonaws.com/", s.cfg.Region)
+	if err := awsJSONCall(s.client, url, s.cfg.AWSAuth, "timestream", "Timestream_20181101.DescribeEndpoints",
+		"application/x-amz-json-1.0", map[string]string{}, &out); err != nil {
+		return "", err
+	}
+	if len(out.Endpoints) == 0 {
+		return "", fmt.Errorf("timestream: no ingest endpoint")
+	}
+	s.url = "https://" + out.Endpoints[0].Address + "/"
+	s.urlValid = time.Now().Add(time.Duration(out.Endpoints[0].CachePeriodInMinutes) * time.Minute)
+	return s.url, nil
+}
+
+type timestreamValue struct {
+	Name  string
+	Value string
+	Type  string
+}
+
+func toTimestreamValue(name string, v interface{}) (timestreamValue, bool) {
+	tv := timestreamValue{Name: name}
+	switch v := v.(type) {
+	case float64:
+		tv.Value, tv.Type = strconv.FormatFloat(v, 'f', -1, 64), "DOUBLE"
+	case uint32, uint64, int32, int64, int:
+		tv.Value, tv.Type = fmt.Sprintf("%d", v), "BIGINT"
+	case bool:
+		tv.Value, tv.Type = strconv.FormatBool(v), "BOOLEAN"
+	case string:
+		tv.Value, tv.Type = v, "VARCHAR"
+	default:
+		return tv, false
+	}
+	return tv, true
+}
+
+// one multi-measure record per point, tags are the dimensions
+func timestreamRecord(p *point) map[string]interface{} {
+	dims := []map[string]string{}
+	for k, v := range p.Tags {
+		if v != "" {
+			dims = append(dims, map[string]string{"Name": k, "Value": v})
+		}
+	}
+	values := []timestreamValue{}
+	for k, v := range p.Fields {
+		if tv, ok := toTimestreamValue(k, v); ok {
+			values = append(values, tv)
+		}
+	}
+	return map[string]interface{}{
+		"Dimensions":       dims,
+		"MeasureName":      p.Measurement,
+		"MeasureValueType": "MULTI",
+		"MeasureValues":    values,
+		"Time":             strconv.FormatInt(p.Timestamp.UnixNano()/int64(time.Millisecond), 10),
+		"TimeUnit":         "MILLISECONDS",
+	}
+}
+
+func (s *timestreamSink) write(points []*point) error {
+	url, err := s.endpoint()
+	if err != nil {
+		return err
+	}
+
+	for len(points) > 0 {
+		n := len(points)
+		if n > timestreamMaxRecords {
+			n = timestreamMaxRecords
+		}
+		records := make([]map[string]interface{}, 0, n)
+		for _, p := range points[:n] {
+			records = append(records, timestreamRecord(p))
+		}
+		in := map[string]interface{}{
+			"DatabaseName": s.cfg.Database,
+			"TableName":    s.cfg.Table,
+			"Records":      records,
+		}
+		if err := awsJSONCall(s.client, url, s.cfg.AWSAuth, "timestream", "Timestream_20181101.WriteRecords",
+			"application/x-amz-json-1.0", in, nil); err != nil {
+			// endpoint might have moved, discover it again next time
+			s.url = ""
+			return err
+		}
+		points = points[n:]
+	}
+	return nil
+}
+
+func (s *timestreamSink) close() {
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignV4(t *testing.T) {
+	// get-vanilla from the AWS Signature Version 4 test suite
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	auth := AWSAuth{
+		Region:          "us-east-1",
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	signV4(req, nil, auth, "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("signV4 failed\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestAWSSinks(t *testing.T) {
+	var target string
+	var in map[string]interface{}
+	failed := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			http.Error(w, "not signed", http.StatusForbidden)
+			return
+		}
+		target = r.Header.Get("X-Amz-Target")
+		in = nil
+		json.NewDecoder(r.Body).Decode(&in)
+		if strings.HasPrefix(target, "Kinesis") {
+			json.NewEncoder(w).Encode(map[string]int{"FailedRecordCount": failed})
+		}
+	}))
+	defer server.Close()
+
+	auth := AWSAuth{Region: "us-east-1", AccessKeyID: "AKID", SecretAccessKey: "secret", Endpoint: server.URL}
+	p := newPoint("m", map[string]string{"device": "r1", "empty": ""},
+		map[string]interface{}{"/a": 1.5, "/b": "up", "/c": uint32(7)}, time.Unix(1, 0))
+
+	t.Run("kinesis", func(t *testing.T) {
+		jctx := &JCtx{}
+		jctx.config.Kinesis = KinesisConfig{Stream: "s", AWSAuth: auth}
+		w, _, err := openKinesisSink(jctx)
+		if err != nil {
+			t.Fatalf("openKinesisSink failed: %v", err)
+		}
+		if err := w.write([]*point{p}); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		if target != "Kinesis_20131202.PutRecords" || in["StreamName"] != "s" {
+			t.Errorf("unexpected request %s %v", target, in)
+		}
+		records := in["Records"].([]interface{})
+		if key := records[0].(map[string]interface{})["PartitionKey"]; key != "r1" {
+			t.Errorf("partition key: want r1, got %v", key)
+		}
+
+		failed = 1
+		defer func() { failed = 0 }()
+		if err := w.write([]*point{p}); err == nil {
+			t.Errorf("want error for failed records, got nil")
+		}
+	})
+
+	t.Run("timestream", func(t *testing.T) {
+		jctx := &JCtx{}
+		jctx.config.Timestream = TimestreamConfig{Database: "db", Table: "t", AWSAuth: auth}
+		w, _, err := openTimestreamSink(jctx)
+		if err != nil {
+			t.Fatalf("openTimestreamSink failed: %v", err)
+		}
+		if err := w.write([]*point{p}); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		if target != "Timestream_20181101.WriteRecords" || in["TableName"] != "t" {
+			t.Errorf("unexpected request %s %v", target, in)
+		}
+		record := in["Records"].([]interface{})[0].(map[string]interface{})
+		if dims := record["Dimensions"].([]interface{}); len(dims) != 1 {
+			t.Errorf("empty tags must not be dimensions, got %v", dims)
+		}
+		if values := record["MeasureValues"].([]interface{}); len(values) != 3 {
+			t.Errorf("want 3 measure values, got %v", values)
+		}
+		if record["Time"] != "1000" {
+			t.Errorf("time: want 1000, got %v", record["Time"])
+		}
+	})
+
+	t.Run("no-credentials", func(t *testing.T) {
+		jctx := &JCtx{}
+		jctx.config.Kinesis = KinesisConfig{Stream: "s", AWSAuth: AWSAuth{Region: "us-east-1"}}
+		if _, _, err := openKinesisSink(jctx); err == nil {
+			t.Errorf("want error for missing credentials, got nil")
+		}
+	})
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Backpressure policies
+const (
+	BackpressureBlock      = "block"
+	BackpressureDropNewest = "drop-newest"
+	BackpressureDropOldest = "drop-oldest"
+)
+
+// BackpressureConfig sets what happens when an internal queue of the worker
+// (pipeline stages, sinks, InfluxDB batches) is full: block waits for room
+// (default), drop-newest drops the update being queued and drop-oldest
+// drops the oldest queued one to make room. The queues of the InfluxDB
+// servers never block, with block they drop the newest batch. Drops are
+// counted per queue. Adaptive lowers the reporting frequency while the
+// drops go on.
+type BackpressureConfig struct {
+	Policy   string         `json:"policy"`
+	Adaptive AdaptiveConfig `json:"adaptive"`
+}
+
+func validateBackpressureConfig(cfg BackpressureConfig) error {
+	switch cfg.Policy {
+	case "", BackpressureBlock, BackpressureDropNewest, BackpressureDropOldest:
+	default:
+		return fmt.Errorf("backpressure policy %q is not supported, use block, drop-newest or drop-oldest", cfg.Policy)
+	}
+	return nil
+}
+
+func backpressurePolicy(jctx *JCtx) string {
+	if jctx.config.Backpressure.Policy == "" {
+		return BackpressureBlock
+	}
+	return jctx.config.Backpressure.Policy
+}
+
+// enqueue queues with policy, trySend queues without blocking and tells
+// whether it did, send blocks and dropOldest drops the oldest queued
+// element without blocking. It returns the number of dropped elements.
+func enqueue(policy string, trySend func() bool, send func(), dropOldest func() bool) uint64 {
+	switch policy {
+	case BackpressureDropNewest:
+		if trySend() {
+			return 0
+		}
+		return 1
+	case BackpressureDropOldest:
+		var dropped uint64
+		for !trySend() {
+			if dropOldest() {
+				dropped++
+			}
+		}
+		return dropped
+	default:
+		send()
+		return 0
+	}
+}
+
+// dropCounters counts the drops of the queues of a worker
+type dropCounters struct {
+	sync.Mutex
+	m map[string]*uint64
+}
+
+func (d *dropCounters) add(queue string, n uint64) {
+	if n == 0 {
+		return
+	}
+	d.Lock()
+	c, ok := d.m[queue]
+	if !ok {
+		if d.m == nil {
+			d.m = map[string]*uint64{}
+		}
+		c = new(uint64)
+		d.m[queue] = c
+	}
+	d.Unlock()
+	atomic.AddUint64(c, n)
+}
+
+func (d *dropCounters) get(queue string) uint64 {
+	d.Lock()
+	c, ok := d.m[queue]
+	d.Unlock()
+	if !ok {
+		return 0
+	}
+	return atomic.LoadUint64(c)
+}
+
+// reset sets the drops of all queues to 0
+func (d *dropCounters) reset() {
+	d.Lock()
+	defer d.Unlock()
+	for _, c := range d.m {
+		atomic.StoreUint64(c, 0)
+	}
+}
+
+// total returns the drops of all queues
+func (d *dropCounters) total() uint64 {
+	d.Lock()
+	defer d.Unlock()
+	var n uint64
+	for _, c := range d.m {
+		n += atomic.LoadUint64(c)
+	}
+	return n
+}
+
+// queues returns the names of the queues with drops, sorted
+func (d *dropCounters) queues() []string {
+	d.Lock()
+	defer d.Unlock()
+	queues := make([]string, 0, len(d.m))
+	for q := range d.m {
+		queues = append(queues, q)
+	}
+	sort.Strings(queues)
+	return queues
+}
+
+// stats describes the drops, one line per queue
+func (d *dropCounters) stats() string {
+	s := ""
+	for _, q := range d.queues() {
+		s += fmt.Sprintf("%-12v : dropped by %s queue\n", d.get(q), q)
+	}
+	return s
+}
+
+// metricWorkers are the workers whose drops and internal counters are
+// exported to Prometheus
+var metricWorkers = struct {
+	sync.Mutex
+	m map[*JCtx]bool
+}{m: map[*JCtx]bool{}}
+
+var dropDesc = prometheus.NewDesc("jtimon_queue_drops_total",
+	"Updates dropped by the internal queues of jtimon", []string{"device", "queue"}, nil)
+
+// dropCollector exports the drops of the workers
+type dropCollector struct{}
+
+// Describe implements prometheus.Collector
+func (dropCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dropDesc
+}
+
+// Collect implements prometheus.Collector
+func (dropCollector) Collect(ch chan<- prometheus.Metric) {
+	metricWorkers.Lock()
+	defer metricWorkers.Unlock()
+	for jctx := range metricWorkers.m {
+		for _, q := range jctx.drops.queues() {
+			ch <- prometheus.MustNewConstMetric(dropDesc, prometheus.CounterValue,
+				float64(jctx.drops.get(q)), jctx.config.Host, q)
+		}
+	}
+}
+
+func dropsInit(jctx *JCtx) {
+	metricWorkers.Lock()
+	metricWorkers.m[jctx] = true
+	metricWorkers.Unlock()
+}
+
+func dropsStop(jctx *JCtx) {
+	metricWorkers.Lock()
+	delete(metricWorkers.m, jctx)
+	metricWorkers.Unlock()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnqueue(t *testing.T) {
+	tests := []struct {
+		policy  string
+		dropped uint64
+		want    []int
+	}{
+		{policy: BackpressureDropNewest, dropped: 2, want: []int{0, 1}},
+		{policy: BackpressureDropOldest, dropped: 2, want: []int{2, 3}},
+	}
+	for _, test := range tests {
+		t.Run(test.policy, func(t *testing.T) {
+			ch := make(chan int, 2)
+			var dropped uint64
+			for i := 0; i < 4; i++ {
+				i := i
+				dropped += enqueue(test.policy, func() bool {
+					select {
+					case ch <- i:
+						return true
+					default:
+						return false
+					}
+				}, func() {
+					ch <- i
+				}, func() bool {
+					select {
+					case <-ch:
+						return true
+					default:
+						return false
+					}
+				})
+			}
+			close(ch)
+			var got []int
+			for i := range ch {
+				got = append(got, i)
+			}
+			if dropped != test.dropped || !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v with %d dropped, want %v with %d dropped", got, dropped, test.want, test.dropped)
+			}
+		})
+	}
+
+	if err := validateBackpressureConfig(BackpressureConfig{Policy: "drop-all"}); err == nil {
+		t.Errorf("want error, got nil")
+	}
+}
+
+func TestDropCounters(t *testing.T) {
+	var d dropCounters
+	d.add("sink/kafka", 0)
+	d.add("sink/kafka", 2)
+	d.add("influx/batch", 1)
+	d.add("sink/kafka", 3)
+
+	if got := d.queues(); !reflect.DeepEqual(got, []string{"influx/batch", "sink/kafka"}) {
+		t.Errorf("got queues %v", got)
+	}
+	if got := d.get("sink/kafka"); got != 5 {
+		t.Errorf("got %d drops, want 5", got)
+	}
+	if s := d.stats(); !strings.Contains(s, "dropped by sink/kafka queue") {
+		t.Errorf("got stats %q", s)
+	}
+}
+
+func TestWriteSinksBackpressure(t *testing.T) {
+	jctx := &JCtx{sinks: []*sinkCtx{{name: "test", ch: make(chan *point, 1)}}}
+	jctx.config.Backpressure.Policy = BackpressureDropOldest
+	points := []*point{
+		newPoint("a", nil, map[string]interface{}{"v": 1.0}, time.Unix(1, 0)),
+		newPoint("b", nil, map[string]interface{}{"v": 2.0}, time.Unix(1, 0)),
+	}
+	writeSinks(jctx, points)
+	if p := <-jctx.sinks[0].ch; p.Measurement != "b" {
+		t.Errorf("got %s, want newest point b", p.Measurement)
+	}
+	if got := jctx.drops.get("sink/test"); got != 1 {
+		t.Errorf("got %d drops, want 1", got)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// BearerConfig is the bearer token jtimon presents to the device with every
+// RPC, for devices and gNMI gateways with token auth: a static token, the
+// token in file, read again for each RPC so that it can be rotated, or a
+// token of the OAuth2 token endpoint url (client credentials grant).
+type BearerConfig struct {
+	Token        string `json:"token"`
+	File         string `json:"file"`
+	URL          string `json:"url"`
+	ClientID     string `json:"client-id"`
+	ClientSecret string `json:"client-secret"`
+	Scope        string `json:"scope"`
+}
+
+const (
+	// bearerRefresh is how long before its expiry a token of the token
+	// endpoint is renewed
+	bearerRefresh = 30 * time.Second
+	// bearerTTL is how long a token of the token endpoint is used when the
+	// endpoint does not tell when it expires
+	bearerTTL = 5 * time.Minute
+)
+
+func validateBearerConfig(cfg Config) error {
+	b := cfg.Bearer
+	sources := 0
+	for _, s := range []string{b.Token, b.File, b.URL} {
+		if s != "" {
+			sources++
+		}
+	}
+	switch {
+	case sources == 0:
+		return nil
+	case sources > 1:
+		return fmt.Errorf("bearer needs one of token, file and url")
+	case b.URL != "" && b.ClientID == "":
+		return fmt.Errorf("bearer url needs a client-id")
+	case !tlsEnabled(cfg.TLS):
+		return fmt.Errorf("bearer token is sent with every RPC, it needs tls")
+	}
+	return nil
+}
+
+// bearerCreds are the per RPC credentials of the bearer token
+type bearerCreds struct {
+	cfg    BearerConfig
+	client *http.Client
+	sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// bearerCredentials is the dial option of the bearer token of the device,
+// nil without one
+func bearerCredentials(jctx *JCtx) grpc.DialOption {
+	cfg := jctx.config.Bearer
+	if cfg.Token == "" && cfg.File == "" && cfg.URL == "" {
+		return nil
+	}
+	return grpc.WithPerRPCCredentials(&bearerCreds{
+		cfg:    cfg,
+		client: &http.Client{Timeout: time.Duration(DefaultIDBTimeout) * time.Second},
+	})
+}
+
+// GetRequestMetadata is the authorization of the RPC
+func (c *bearerCreds) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	token, err := c.get(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"authorization": "Bearer " + token}, nil
+}
+
+// RequireTransportSecurity is true, the token is not sent in clear text
+func (c *bearerCreds) RequireTransportSecurity() bool {
+	return true
+}
+
+func (c *bearerCreds) get(now time.Time) (string, error) {
+	switch {
+	case c.cfg.Token != "":
+		return c.cfg.Token, nil
+	case c.cfg.File != "":
+		b, err := ioutil.ReadFile(c.cfg.File)
+		if err != nil {
+			return "", fmt.Errorf("can not read the bearer token: %v", err)
+		}
+		token := strings.TrimSpace(string(b))
+		if token == "" {
+			return "", fmt.Errorf("bearer token file %s is empty", c.cfg.File)
+		}
+		return token, nil
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if c.token != "" && now.Add(bearerRefresh).Before(c.expiry) {
+		return c.token, nil
+	}
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {c.cfg.ClientID},
+		"client_secret": {c.cfg.ClientSecret},
+	}
+	if c.cfg.Scope != "" {
+		form.Set("scope", c.cfg.Scope)
+	}
+	req, err := http.NewRequest("POST", c.cfg.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	body, err := sinkHTTPDo(c.client, req)
+	if err != nil {
+		return "", fmt.Errorf("can not get the bearer token: %v", err)
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return "", fmt.Errorf("can not get the bearer token: %v", err)
+	}
+	if tok.AccessToken == "" {
+		return "", fmt.Errorf("can not get the bearer token: no access_token")
+	}
+	ttl := bearerTTL
+	if tok.ExpiresIn > 0 {
+		ttl = time.Duration(tok.ExpiresIn) * time.Second
+	}
+	c.token = tok.AccessToken
+	c.expiry = now.Add(ttl)
+	return c.token, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestValidateBearerConfig(t *testing.T) {
+	tls := TLSConfig{CA: "ca.crt"}
+	tests := []struct {
+		name string
+		cfg  Config
+		err  bool
+	}{
+		{name: "none", cfg: Config{}},
+		{name: "token", cfg: Config{Bearer: BearerConfig{Token: "t0ken"}, TLS: tls}},
+		{name: "file", cfg: Config{Bearer: BearerConfig{File: "token"}, TLS: tls}},
+		{name: "url", cfg: Config{Bearer: BearerConfig{URL: "https://idp/token", ClientID: "jtimon"}, TLS: tls}},
+		{name: "token and file", cfg: Config{Bearer: BearerConfig{Token: "t0ken", File: "token"}, TLS: tls}, err: true},
+		{name: "url without client id", cfg: Config{Bearer: BearerConfig{URL: "https://idp/token"}, TLS: tls}, err: true},
+		{name: "without tls", cfg: Config{Bearer: BearerConfig{Token: "t0ken"}}, err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := validateBearerConfig(test.cfg); (err != nil) != test.err {
+				t.Errorf("got %v", err)
+			}
+		})
+	}
+}
+
+func TestBearerTokenEndpoint(t *testing.T) {
+	fetched := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("client_id") != "jtimon" ||
+			r.Form.Get("client_secret") != "s3cret" || r.Form.Get("scope") != "telemetry" {
+			http.Error(w, "invalid client", http.StatusUnauthorized)
+			return
+		}
+		fetched++
+		fmt.Fprintf(w, `{"access_token": "t%d", "token_type": "Bearer", "expires_in": 60}`, fetched)
+	}))
+	defer srv.Close()
+
+	c := &bearerCreds{
+		cfg:    BearerConfig{URL: srv.URL, ClientID: "jtimon", ClientSecret: "s3cret", Scope: "telemetry"},
+		client: http.DefaultClient,
+	}
+	now := time.Now()
+	steps := []struct {
+		at   time.Duration
+		want string
+	}{
+		{at: 0, want: "t1"},
+		{at: 20 * time.Second, want: "t1"},
+		// renewed ahead of its expiry
+		{at: 40 * time.Second, want: "t2"},
+		{at: 60 * time.Second, want: "t2"},
+	}
+	for _, step := range steps {
+		got, err := c.get(now.Add(step.at))
+		if err != nil || got != step.want {
+			t.Errorf("at %v: got %q %v, want %q", step.at, got, err, step.want)
+		}
+	}
+
+	c.cfg.ClientSecret = "wrong"
+	c.token = ""
+	if _, err := c.get(now); err == nil {
+		t.Errorf("no error with a wrong secret")
+	}
+}
+
+func TestBearerCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-bearer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "token")
+	addr, mds, stop := testMetadataServer(t)
+	defer stop()
+
+	jctx := &JCtx{config: Config{Host: "r1", TLS: TLSConfig{SkipVerify: true}, Bearer: BearerConfig{File: file}}}
+	// the file is read again for each RPC
+	for _, token := range []string{"t1", "t2"} {
+		ioutil.WriteFile(file, []byte(token+"\n"), 0600)
+		md := testRPCMetadata(t, jctx, addr, mds)
+		if got := md["authorization"]; len(got) != 1 || got[0] != "Bearer "+token {
+			t.Errorf("got metadata %v, want token %s", md, token)
+		}
+	}
+
+	if bearerCredentials(&JCtx{}) != nil {
+		t.Errorf("got credentials without a token")
+	}
+}
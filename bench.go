@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	benchRate       = flag.Int("bench-rate", 10000, "Points per second generated by jtimon bench")
+	benchDevices    = flag.Int("bench-devices", 10, "Number of devices simulated by jtimon bench")
+	benchInterfaces = flag.Int("bench-interfaces", 100, "Number of interfaces per device simulated by jtimon bench")
+	benchDuration   = flag.Int("bench-duration", 10, "Run time of jtimon bench in seconds")
+)
+
+// benchBatch is the number of points handed to the pipeline at once, one
+// update of a device
+const benchBatch = 100
+
+// benchResult is the outcome of a benchmark run, latency is the time taken
+// by transforming and exporting one update
+type benchResult struct {
+	generated uint64
+	exported  uint64
+	elapsed   time.Duration
+	latency   []time.Duration
+}
+
+// benchPoints generates the n synthetic points starting with the seq-th,
+// interface counters of devices * interfaces series
+func benchPoints(seq uint64, n, devices, interfaces int, ts time.Time) []*point {
+	points := make([]*point, 0, n)
+	for i := 0; i < n; i++ {
+		s := seq + uint64(i)
+		device := s % uint64(devices)
+		intf := (s / uint64(devices)) % uint64(interfaces)
+		tags := map[string]string{
+			"device":                      "bench-" + strconv.FormatUint(device, 10),
+			"sensor":                      "sensor_1000:/interfaces/:/interfaces/:bench",
+			"/interfaces/interface/@name": "ge-0/0/" + strconv.FormatUint(intf, 10),
+		}
+		fields := map[string]interface{}{
+			"/interfaces/interface/state/counters/in-octets":  float64(s * 1000),
+			"/interfaces/interface/state/counters/out-octets": float64(s * 500),
+			"/interfaces/interface/state/oper-status":         "UP",
+		}
+		points = append(points, newPoint("/interfaces/", tags, fields, ts))
+	}
+	return points
+}
+
+// runBench pushes synthetic points at rate points per second through the
+// transforms and sinks of the worker
+func runBench(jctx *JCtx, rate, devices, interfaces int, duration time.Duration) *benchResult {
+	res := &benchResult{}
+	interval := time.Second * benchBatch / time.Duration(rate)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	for time.Since(start) < duration {
+		<-ticker.C
+		t := time.Now()
+		points := applyTransforms(jctx, benchPoints(res.generated, benchBatch, devices, interfaces, t))
+		exportIDB(jctx, "/interfaces/", points)
+		res.latency = append(res.latency, time.Since(t))
+		res.generated += benchBatch
+		res.exported += uint64(len(points))
+	}
+	res.elapsed = time.Since(start)
+	return res
+}
+
+// percentile returns the p-th percentile of the sorted durations
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[(len(sorted)-1)*p/100]
+}
+
+func (r *benchResult) String() string {
+	latency := append([]time.Duration(nil), r.latency...)
+	sort.Slice(latency, func(i, j int) bool { return latency[i] < latency[j] })
+
+	s := fmt.Sprintf("\nBenchmark Stats (Run time : %s)\n", r.elapsed)
+	s += fmt.Sprintf("%-12v : generated points\n", r.generated)
+	s += fmt.Sprintf("%-12v : exported points (after transforms)\n", r.exported)
+	if secs := r.elapsed.Seconds(); secs > 0 {
+		s += fmt.Sprintf("%-12.0f : throughput (points per second)\n", float64(r.generated)/secs)
+	}
+	s += fmt.Sprintf("%-12v : latency p50 (per %d points)\n", percentile(latency, 50), benchBatch)
+	s += fmt.Sprintf("%-12v : latency p90\n", percentile(latency, 90))
+	s += fmt.Sprintf("%-12v : latency p99\n", percentile(latency, 99))
+	s += fmt.Sprintf("%-12v : latency max\n", percentile(latency, 100))
+	return s
+}
+
+// benchMain runs jtimon bench with the transforms and sinks of the first
+// config file
+func benchMain() {
+	if len(*configFiles) == 0 {
+		log.Printf("jtimon bench needs a config file (--config) with the transforms and sinks to benchmark")
+		return
+	}
+	if *benchRate <= 0 || *benchDevices <= 0 || *benchInterfaces <= 0 {
+		log.Printf("bench-rate, bench-devices and bench-interfaces must be positive")
+		return
+	}
+
+	jctx := &JCtx{file: (*configFiles)[0], stats: statsCtx{startTime: time.Now()}}
+	if err := ConfigRead(jctx, true, nil); err != nil {
+		log.Printf("%v", err)
+		return
+	}
+
+	log.Printf("benchmarking %s: %d points per second of %d devices with %d interfaces for %ds",
+		jctx.file, *benchRate, *benchDevices, *benchInterfaces, *benchDuration)
+	res := runBench(jctx, *benchRate, *benchDevices, *benchInterfaces, time.Duration(*benchDuration)*time.Second)
+	log.Printf("%s%s", res, jctx.drops.stats())
+}
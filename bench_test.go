@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBenchPoints(t *testing.T) {
+	tests := []struct {
+		name       string
+		n          int
+		devices    int
+		interfaces int
+		series     int
+	}{
+		{"single", 1, 10, 100, 1},
+		{"wrap", 100, 2, 5, 10},
+		{"all", 1000, 10, 100, 1000},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			points := benchPoints(0, test.n, test.devices, test.interfaces, time.Now())
+			if len(points) != test.n {
+				t.Fatalf("got %d points, want %d", len(points), test.n)
+			}
+			series := map[string]bool{}
+			for _, p := range points {
+				series[seriesKey(p, "")] = true
+			}
+			if len(series) != test.series {
+				t.Errorf("got %d series, want %d", len(series), test.series)
+			}
+		})
+	}
+}
+
+func TestRunBench(t *testing.T) {
+	jctx := &JCtx{}
+	res := runBench(jctx, 10000, 10, 100, 200*time.Millisecond)
+	if res.generated == 0 || res.generated%benchBatch != 0 {
+		t.Errorf("generated %d points, want a positive multiple of %d", res.generated, benchBatch)
+	}
+	if res.exported != res.generated {
+		t.Errorf("exported %d points, want %d", res.exported, res.generated)
+	}
+	if len(res.latency) != int(res.generated/benchBatch) {
+		t.Errorf("got %d latency samples, want %d", len(res.latency), res.generated/benchBatch)
+	}
+	if s := res.String(); s == "" {
+		t.Errorf("empty benchmark report")
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// captureSeconds is how long a capture records unless the request says
+	// otherwise, captureSecondsMax is the longest it may ask for
+	captureSeconds    = 10
+	captureSecondsMax = 300
+	// captureMaxBytes stops a capture early, the messages are kept in memory
+	captureMaxBytes = 64 << 20
+)
+
+// captureState is the capture of the raw messages of a worker, in the
+// format of --generate-test-data: the lengths of the messages as "len:" in
+// the meta and the messages one after the other in the bytes
+type captureState struct {
+	sync.Mutex
+	on       int32
+	meta     bytes.Buffer
+	data     bytes.Buffer
+	messages int
+	full     bool
+}
+
+// start starts a capture, false if one is running
+func (c *captureState) start() bool {
+	c.Lock()
+	defer c.Unlock()
+	if c.on != 0 {
+		return false
+	}
+	c.meta.Reset()
+	c.data.Reset()
+	c.messages = 0
+	c.full = false
+	atomic.StoreInt32(&c.on, 1)
+	return true
+}
+
+// stop ends the capture and returns what it recorded
+func (c *captureState) stop() (meta []byte, data []byte, messages int, full bool) {
+	c.Lock()
+	defer c.Unlock()
+	atomic.StoreInt32(&c.on, 0)
+	meta = append([]byte(nil), c.meta.Bytes()...)
+	data = append([]byte(nil), c.data.Bytes()...)
+	c.meta.Reset()
+	c.data.Reset()
+	return meta, data, c.messages, c.full
+}
+
+// capturing tells whether the raw messages of the worker are captured, the
+// Junos messages are marshalled again for it
+func capturing(jctx *JCtx) bool {
+	return atomic.LoadInt32(&jctx.capture.on) != 0
+}
+
+// captureMessage records a raw message of the worker while it is captured
+func captureMessage(jctx *JCtx, data []byte) {
+	if !capturing(jctx) {
+		return
+	}
+	c := &jctx.capture
+	c.Lock()
+	defer c.Unlock()
+	if c.on == 0 || c.full {
+		return
+	}
+	if c.data.Len()+len(data) > captureMaxBytes {
+		c.full = true
+		return
+	}
+	fmt.Fprintf(&c.meta, "%d:", len(data))
+	c.data.Write(data)
+	c.messages++
+}
+
+// captureName is the name of the files of a capture, the ones of the config
+// file of the worker as --consume-test-data reads them
+func captureName(jctx *JCtx) string {
+	if jctx.file != "" {
+		return filepath.Base(jctx.file)
+	}
+	return strings.Replace(jctx.config.Host, ":", "_", -1)
+}
+
+// deviceCapture records the raw messages of the worker for ?seconds= and
+// answers them as a tar of the .testmeta and .testbytes files
+func deviceCapture(w http.ResponseWriter, r *http.Request, jctx *JCtx) {
+	seconds := captureSeconds
+	if v := r.URL.Query().Get("seconds"); v != "" {
+		var err error
+		if seconds, err = strconv.Atoi(v); err != nil || seconds <= 0 || seconds > captureSecondsMax {
+			http.Error(w, fmt.Sprintf("invalid seconds %q, up to %d", v, captureSecondsMax), http.StatusBadRequest)
+			return
+		}
+	}
+	if !jctx.capture.start() {
+		http.Error(w, fmt.Sprintf("a capture of %s is running", jctx.config.Host), http.StatusConflict)
+		return
+	}
+	jLog(jctx, fmt.Sprintf("capturing the messages of %s for %ds", jctx.config.Host, seconds))
+
+	timer := time.NewTimer(time.Duration(seconds) * time.Second)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-r.Context().Done():
+		jctx.capture.stop()
+		return
+	}
+	meta, data, messages, full := jctx.capture.stop()
+	jLog(jctx, fmt.Sprintf("captured %d messages (%d bytes) of %s", messages, len(data), jctx.config.Host))
+
+	name := captureName(jctx)
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s-%s.tar", name, time.Now().UTC().Format("20060102T150405Z"))))
+	w.Header().Set("X-Capture-Messages", strconv.Itoa(messages))
+	if full {
+		w.Header().Set("X-Capture-Truncated", "true")
+	}
+	tw := tar.NewWriter(w)
+	now := time.Now()
+	for _, f := range []struct {
+		ext  string
+		data []byte
+	}{
+		{".testmeta", meta},
+		{".testbytes", data},
+	} {
+		hdr := &tar.Header{Name: name + f.ext, Mode: 0644, Size: int64(len(f.data)), ModTime: now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return
+		}
+	}
+	tw.Close()
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCaptureState(t *testing.T) {
+	jctx := &JCtx{}
+	captureMessage(jctx, []byte("not captured"))
+	if !jctx.capture.start() {
+		t.Fatalf("could not start")
+	}
+	if jctx.capture.start() {
+		t.Errorf("started twice")
+	}
+	captureMessage(jctx, []byte("abc"))
+	captureMessage(jctx, []byte("de"))
+	captureMessage(jctx, make([]byte, captureMaxBytes))
+	captureMessage(jctx, []byte("f"))
+	meta, data, messages, full := jctx.capture.stop()
+	if string(meta) != "3:2:" || string(data) != "abcde" || messages != 2 || !full {
+		t.Errorf("got %q %q %d %t", meta, data, messages, full)
+	}
+	if capturing(jctx) {
+		t.Errorf("capturing after the stop")
+	}
+}
+
+func TestDeviceCapture(t *testing.T) {
+	r1 := &JCtx{config: Config{Host: "r1"}, file: "tests/data/r1.json"}
+	dropsInit(r1)
+	defer dropsStop(r1)
+	srv := httptest.NewServer(http.HandlerFunc(devicesHandler))
+	defer srv.Close()
+
+	for _, url := range []string{"/devices/r1/capture?seconds=0", "/devices/r1/capture?seconds=301"} {
+		if resp, err := http.Post(srv.URL+url, "", nil); err != nil || resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: got %v %v", url, resp, err)
+		}
+	}
+	if resp, err := http.Get(srv.URL + "/devices/r1/capture"); err != nil || resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET: got %v %v", resp, err)
+	}
+
+	go func() {
+		for !capturing(r1) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if resp, err := http.Post(srv.URL+"/devices/r1/capture", "", nil); err != nil || resp.StatusCode != http.StatusConflict {
+			t.Errorf("second capture: got %v %v", resp, err)
+		}
+		captureMessage(r1, []byte("hello"))
+		captureMessage(r1, []byte("jtimon"))
+	}()
+	resp, err := http.Post(srv.URL+"/devices/r1/capture?seconds=1", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Capture-Messages") != "2" {
+		t.Fatalf("got %v", resp)
+	}
+
+	files := map[string]string{}
+	tr := tar.NewReader(resp.Body)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		b, _ := ioutil.ReadAll(tr)
+		files[hdr.Name] = string(b)
+	}
+	want := map[string]string{"r1.json.testmeta": "5:6:", "r1.json.testbytes": "hellojtimon"}
+	for name, content := range want {
+		if files[name] != content {
+			t.Errorf("%s: got %q, want %q", name, files[name], content)
+		}
+	}
+	if len(files) != len(want) {
+		t.Errorf("got files %v", files)
+	}
+	if capturing(r1) {
+		t.Errorf("capturing after the request")
+	}
+	if !strings.Contains(resp.Header.Get("Content-Disposition"), "r1.json-") {
+		t.Errorf("got %s", resp.Header.Get("Content-Disposition"))
+	}
+}
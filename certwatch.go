@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// certWatch reloads the client certificates of a worker when their files
+// change, short-lived certificates are renewed in place
+type certWatch struct {
+	task *schedTask
+	sums map[string][sha256.Size]byte
+}
+
+// certFiles are the files of the TLS config of the device, none without TLS
+func certFiles(cfg TLSConfig) []string {
+	if !tlsEnabled(cfg) {
+		return nil
+	}
+	var files []string
+	for _, f := range []string{cfg.CA, cfg.ClientCrt, cfg.ClientKey} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// check tells whether the files of cfg changed since the last check. The
+// new files are only taken once they make valid credentials, a certificate
+// and key written one after the other are checked again the next time.
+func (c *certWatch) check(cfg TLSConfig) (bool, error) {
+	sums := map[string][sha256.Size]byte{}
+	for _, f := range certFiles(cfg) {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return false, err
+		}
+		sums[f] = sha256.Sum256(b)
+	}
+	changed := len(sums) != len(c.sums)
+	for f, sum := range sums {
+		if old, ok := c.sums[f]; !ok || old != sum {
+			changed = true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+	if len(cfg.Signer) != 0 {
+		if _, err := loadSignerCertificate(cfg.ClientCrt, cfg.Signer); err != nil {
+			return false, err
+		}
+	} else if cfg.ClientCrt != "" || cfg.ClientKey != "" {
+		if _, err := tls.LoadX509KeyPair(cfg.ClientCrt, cfg.ClientKey); err != nil {
+			return false, err
+		}
+	}
+	first := c.sums == nil
+	c.sums = sums
+	return !first, nil
+}
+
+// certWatchInit checks the client certificates of the worker every
+// --tls-reload-interval seconds. When they change the worker connects
+// again, the credentials are built from the files at each connect.
+func certWatchInit(jctx *JCtx) {
+	if *tlsReload <= 0 {
+		return
+	}
+	c := &certWatch{}
+	if _, err := c.check(jctx.config.TLS); err != nil {
+		jLogError(jctx, "", "Could not read the TLS files", err)
+	}
+	jctx.certs = c
+	c.task = schedule(time.Duration(*tlsReload)*time.Second, func() {
+		old := c.sums
+		changed, err := c.check(jctx.config.TLS)
+		if err != nil {
+			jLogError(jctx, "", "Could not reload the TLS files", err)
+			return
+		}
+		if !changed {
+			return
+		}
+		jLog(jctx, fmt.Sprintf("TLS files of %s changed, connecting again", jctx.config.Host))
+		recordEvent(jctx, EventResubscribe, "", "the client certificates changed")
+		auditRotation(jctx.config.Host, "tls", fileSums(old), fileSums(c.sums))
+		resubscribe(jctx)
+	})
+}
+
+func certWatchStop(jctx *JCtx) {
+	if jctx.certs != nil {
+		jctx.certs.task.stop()
+	}
+}
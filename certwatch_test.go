@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCertWatchCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca, caKey := testCert(t, dir, "ca", nil, nil)
+	testCert(t, dir, "client", ca, caKey)
+	file := func(name string) string { return filepath.Join(dir, name) }
+	cfg := TLSConfig{CA: file("ca.crt"), ClientCrt: file("client.crt"), ClientKey: file("client.key")}
+
+	if got := certFiles(TLSConfig{ClientCrt: "c.crt", ClientKey: "c.key"}); got != nil {
+		t.Errorf("without CA: got %v", got)
+	}
+
+	c := &certWatch{}
+	steps := []struct {
+		name    string
+		change  func()
+		changed bool
+		err     bool
+	}{
+		{name: "first", changed: false},
+		{name: "unchanged", changed: false},
+		{
+			name:   "half written key",
+			change: func() { ioutil.WriteFile(file("client.key"), []byte("not a key"), 0600) },
+			err:    true,
+		},
+		{
+			name:    "renewed",
+			change:  func() { testCert(t, dir, "client", ca, caKey) },
+			changed: true,
+		},
+		{name: "renewed once", changed: false},
+	}
+	for _, step := range steps {
+		if step.change != nil {
+			step.change()
+		}
+		changed, err := c.check(cfg)
+		if changed != step.changed || (err != nil) != step.err {
+			t.Errorf("%s: got %t %v", step.name, changed, err)
+		}
+	}
+}
+
+func TestCertWatchReconnect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-certs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca, caKey := testCert(t, dir, "ca", nil, nil)
+	testCert(t, dir, "client", ca, caKey)
+	file := func(name string) string { return filepath.Join(dir, name) }
+
+	defer func(v int) { *tlsReload = v }(*tlsReload)
+	*tlsReload = 1
+	jctx := &JCtx{
+		config:  Config{Host: "r1", TLS: TLSConfig{CA: file("ca.crt"), ClientCrt: file("client.crt"), ClientKey: file("client.key")}},
+		control: make(chan os.Signal, 1),
+	}
+	certWatchInit(jctx)
+	defer certWatchStop(jctx)
+
+	testCert(t, dir, "client", ca, caKey)
+	select {
+	case s := <-jctx.control:
+		if s != syscall.SIGHUP {
+			t.Errorf("got signal %v", s)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("no reconnect after the certificate changed")
+	}
+	if events := jctx.events.events(); len(events) != 1 || events[0].Type != EventResubscribe {
+		t.Errorf("got events %v", events)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// cgroupRoot is where the cgroup file system of the container is mounted
+const cgroupRoot = "/sys/fs/cgroup"
+
+// readCgroupInt reads the integer value of a cgroup v1 file
+func readCgroupInt(file string) (int64, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+}
+
+// cgroupCPULimit returns the number of CPUs the cgroup quota of root allows,
+// false when there is no quota. cgroup v2 (cpu.max) is tried before v1
+// (cpu.cfs_quota_us and cpu.cfs_period_us).
+func cgroupCPULimit(root string) (float64, bool) {
+	if b, err := ioutil.ReadFile(filepath.Join(root, "cpu.max")); err == nil {
+		f := strings.Fields(string(b))
+		if len(f) != 2 || f[0] == "max" {
+			return 0, false
+		}
+		quota, err1 := strconv.ParseFloat(f[0], 64)
+		period, err2 := strconv.ParseFloat(f[1], 64)
+		if err1 != nil || err2 != nil || quota <= 0 || period <= 0 {
+			return 0, false
+		}
+		return quota / period, true
+	}
+
+	quota, err := readCgroupInt(filepath.Join(root, "cpu", "cpu.cfs_quota_us"))
+	if err != nil || quota <= 0 {
+		return 0, false
+	}
+	period, err := readCgroupInt(filepath.Join(root, "cpu", "cpu.cfs_period_us"))
+	if err != nil || period <= 0 {
+		return 0, false
+	}
+	return float64(quota) / float64(period), true
+}
+
+// cgroupMaxProcs returns GOMAXPROCS for a CPU limit, rounded up and never
+// more than the CPUs of the host
+func cgroupMaxProcs(limit float64, ncpu int) int {
+	procs := int(math.Ceil(limit))
+	if procs < 1 {
+		procs = 1
+	}
+	if procs > ncpu {
+		procs = ncpu
+	}
+	return procs
+}
+
+// setMaxProcs sizes GOMAXPROCS to the CPU quota of the container unless
+// GOMAXPROCS is set in the environment
+func setMaxProcs() {
+	if _, ok := os.LookupEnv("GOMAXPROCS"); ok {
+		return
+	}
+	limit, ok := cgroupCPULimit(cgroupRoot)
+	if !ok {
+		return
+	}
+	procs := cgroupMaxProcs(limit, runtime.NumCPU())
+	if procs != runtime.GOMAXPROCS(0) {
+		log.Printf("GOMAXPROCS set to %d for the CPU quota %.2f of the container", procs, limit)
+		runtime.GOMAXPROCS(procs)
+	}
+}
+
+// runtimeStats returns the Go runtime metrics for the stats
+func runtimeStats() string {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	var lastPause time.Duration
+	if m.NumGC > 0 {
+		lastPause = time.Duration(m.PauseNs[(m.NumGC+255)%256])
+	}
+
+	s := fmt.Sprintf("%-12v : goroutines\n", runtime.NumGoroutine())
+	s += fmt.Sprintf("%-12v : gomaxprocs\n", runtime.GOMAXPROCS(0))
+	s += fmt.Sprintf("%-12v : heap in use (bytes)\n", m.HeapInuse)
+	s += fmt.Sprintf("%-12v : heap objects\n", m.HeapObjects)
+	s += fmt.Sprintf("%-12v : memory from the OS (bytes)\n", m.Sys)
+	s += fmt.Sprintf("%-12v : GC cycles\n", m.NumGC)
+	s += fmt.Sprintf("%-12v : GC pause total\n", time.Duration(m.PauseTotalNs))
+	s += fmt.Sprintf("%-12v : GC pause last\n", lastPause)
+	s += fmt.Sprintf("%-12v : open gRPC connections\n", atomic.LoadInt64(&grpcConns))
+	return s
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCgroupCPULimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		limit float64
+		ok    bool
+	}{
+		{"none", map[string]string{}, 0, false},
+		{"v2-max", map[string]string{"cpu.max": "max 100000\n"}, 0, false},
+		{"v2-quota", map[string]string{"cpu.max": "250000 100000\n"}, 2.5, true},
+		{"v2-bad", map[string]string{"cpu.max": "abc 100000\n"}, 0, false},
+		{"v1-unlimited", map[string]string{"cpu/cpu.cfs_quota_us": "-1\n", "cpu/cpu.cfs_period_us": "100000\n"}, 0, false},
+		{"v1-quota", map[string]string{"cpu/cpu.cfs_quota_us": "50000\n", "cpu/cpu.cfs_period_us": "100000\n"}, 0.5, true},
+		{"v1-no-period", map[string]string{"cpu/cpu.cfs_quota_us": "50000\n"}, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root, err := ioutil.TempDir("", "jtimon-cgroup")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(root)
+			for name, content := range test.files {
+				file := filepath.Join(root, name)
+				os.MkdirAll(filepath.Dir(file), 0755)
+				if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			limit, ok := cgroupCPULimit(root)
+			if limit != test.limit || ok != test.ok {
+				t.Errorf("got %v %v, want %v %v", limit, ok, test.limit, test.ok)
+			}
+		})
+	}
+}
+
+func TestCgroupMaxProcs(t *testing.T) {
+	tests := []struct {
+		limit float64
+		ncpu  int
+		want  int
+	}{
+		{0.5, 8, 1},
+		{1, 8, 1},
+		{2.5, 8, 3},
+		{16, 8, 8},
+	}
+	for _, test := range tests {
+		if got := cgroupMaxProcs(test.limit, test.ncpu); got != test.want {
+			t.Errorf("cgroupMaxProcs(%v, %d) = %d, want %d", test.limit, test.ncpu, got, test.want)
+		}
+	}
+}
+
+func TestRuntimeStats(t *testing.T) {
+	s := runtimeStats()
+	for _, want := range []string{"goroutines", "gomaxprocs", "heap in use", "GC pause total",
+		"open gRPC connections"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("runtime stats miss %q:\n%s", want, s)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+)
+
+// defaultCID derives the client id of a config without cid from the
+// hostname of jtimon, the instance (--cluster-id or --ha-id) and the device,
+// so it is the same over restarts and moves of the config file and differs
+// between the collectors of a device. Config files of the same device on a
+// collector get the same one, cidDuplicate reports them and they need a cid
+// of their own. IOS-XR takes a number as the first subscription id, Junos a
+// string.
+func defaultCID(config Config) string {
+	collector, _ := os.Hostname()
+	instance := *clusterID
+	if instance == "" {
+		instance = *haID
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s|%s|%s:%d", collector, instance, config.Host, config.Port)
+	sum := h.Sum64()
+	if config.Vendor.Name == "cisco-iosxr" {
+		// room for the ids of the paths, which follow
+		return strconv.FormatUint(sum%1000000000, 10)
+	}
+	return fmt.Sprintf("jtimon-%s-%08x", collector, uint32(sum))
+}
+
+// cidDuplicate returns the error of a config subscribing to the same device
+// with the same client id as one of others, by config file, nil otherwise.
+// The device drops the subscriptions of one of them when the other
+// subscribes.
+func cidDuplicate(file string, config Config, others map[string]Config) error {
+	for other, c := range others {
+		if other != file && c.CID == config.CID && c.Host == config.Host && c.Port == config.Port {
+			return fmt.Errorf("%s and %s subscribe to %s:%d with the same cid %q, the device drops the subscriptions of one of them when the other subscribes",
+				file, other, config.Host, config.Port, config.CID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDefaultCID(t *testing.T) {
+	r1 := Config{Host: "r1", Port: 32767}
+	cid := defaultCID(r1)
+	if !strings.HasPrefix(cid, "jtimon-") || defaultCID(r1) != cid {
+		t.Errorf("got %q, want a stable jtimon- id", cid)
+	}
+	if defaultCID(Config{Host: "r2", Port: 32767}) == cid {
+		t.Errorf("same cid for another device")
+	}
+	if defaultCID(Config{Host: "r1", Port: 50051}) == cid {
+		t.Errorf("same cid for another port")
+	}
+	defer func(id string) { *haID = id }(*haID)
+	*haID = "b"
+	if defaultCID(r1) == cid {
+		t.Errorf("same cid for another instance")
+	}
+
+	xr := defaultCID(Config{Host: "xr1", Port: 57500, Vendor: VendorConfig{Name: "cisco-iosxr"}})
+	if _, err := strconv.ParseInt(xr, 10, 64); err != nil {
+		t.Errorf("IOS-XR cid %q is not a number", xr)
+	}
+}
+
+func TestCIDDuplicate(t *testing.T) {
+	others := map[string]Config{
+		"r1.json": {Host: "r1", Port: 32767, CID: "collector"},
+		"r2.json": {Host: "r2", Port: 32767, CID: "collector"},
+	}
+	if err := cidDuplicate("r1-bgp.json", Config{Host: "r1", Port: 32767, CID: "collector"}, others); err == nil {
+		t.Errorf("same device and cid: want an error")
+	}
+	if err := cidDuplicate("r1-bgp.json", Config{Host: "r1", Port: 32767, CID: "bgp"}, others); err != nil {
+		t.Errorf("another cid: %v", err)
+	}
+	if err := cidDuplicate("r1.json", others["r1.json"], others); err != nil {
+		t.Errorf("the file itself: %v", err)
+	}
+}
+
+func TestParseJSONCID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-cid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "r1.json")
+	if err := ioutil.WriteFile(file, []byte(`{"host": "r1", "port": 32767, "paths": [{"path": "/interfaces/"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := ParseJSON(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := defaultCID(config); config.CID != want {
+		t.Errorf("got cid %q, want %q", config.CID, want)
+	}
+
+	// the cid does not change when the config file moves
+	moved := filepath.Join(dir, "moved", "r1.json")
+	if err := os.MkdirAll(filepath.Dir(moved), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(file, moved); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := ParseJSON(moved); err != nil || c.CID != config.CID {
+		t.Errorf("moved: got cid %q, %v, want %q", c.CID, err, config.CID)
+	}
+}
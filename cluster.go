@@ -0,0 +1,405 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	clusterStore = flag.String("cluster", "", "Membership of the collector fleet sharing the devices of the config files by consistent hashing: consul://host:port/prefix or etcd://host:port/prefix")
+	clusterID    = flag.String("cluster-id", "", "Identity of this instance in the fleet of --cluster (default the hostname and pid)")
+	clusterTTL   = flag.Int("cluster-ttl", 10, "Seconds a member of --cluster stays in it without renewing, its devices move to the other members after them")
+)
+
+// clusterReplicas is the number of points of a member on the ring, the more
+// points the more evenly the devices are shared
+const clusterReplicas = 100
+
+// hashRing assigns the devices to the members: a device is assigned to the
+// member of the first point of the ring after its hash, so that a member
+// joining or leaving moves only the devices it gets or had
+type hashRing struct {
+	members []string
+	points  []uint64
+	owners  map[uint64]string
+}
+
+func ringHash(s string) uint64 {
+	h := sha1.Sum([]byte(s))
+	return binary.BigEndian.Uint64(h[:8])
+}
+
+func newHashRing(members []string) *hashRing {
+	r := &hashRing{members: append([]string(nil), members...), owners: map[uint64]string{}}
+	sort.Strings(r.members)
+	for _, m := range r.members {
+		for i := 0; i < clusterReplicas; i++ {
+			p := ringHash(fmt.Sprintf("%s#%d", m, i))
+			if _, ok := r.owners[p]; ok {
+				continue
+			}
+			r.owners[p] = m
+			r.points = append(r.points, p)
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+// owner returns the member the device is assigned to
+func (r *hashRing) owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := ringHash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+// clusterMembership registers the instance in the fleet
+type clusterMembership interface {
+	// join registers the instance, or renews it, and returns the members,
+	// this instance among them if it is registered
+	join() ([]string, error)
+	// leave removes the instance from the fleet
+	leave() error
+}
+
+// clusterState is the share of the devices of the instance, the workers of
+// the devices assigned to the other members do not connect to them
+type clusterState struct {
+	sync.Mutex
+	id string
+	// ring is nil until the instance joins the fleet and once it could not
+	// renew its membership
+	ring *hashRing
+	// changed is closed when the ring changes, nil without --cluster
+	changed chan struct{}
+	// stop is closed to leave the fleet, done once it is left
+	stop    chan struct{}
+	done    chan struct{}
+	stopped bool
+	// reporter keeps the statuses of the members, nil without --cluster
+	reporter clusterReporter
+}
+
+var cluster clusterState
+
+// clusterKey is the key of the device of the worker on the ring
+func clusterKey(jctx *JCtx) string {
+	return fmt.Sprintf("%s:%d", jctx.config.Host, jctx.config.Port)
+}
+
+// assigned returns the member the device of the worker is assigned to and,
+// if it is not this instance, the channel closed when the ring changes. The
+// channel is nil without --cluster.
+func (c *clusterState) assigned(jctx *JCtx) (string, chan struct{}) {
+	c.Lock()
+	defer c.Unlock()
+	if c.changed == nil {
+		return "", nil
+	}
+	if c.ring == nil {
+		return "", c.changed
+	}
+	owner := c.ring.owner(clusterKey(jctx))
+	if owner == c.id {
+		return owner, nil
+	}
+	return owner, c.changed
+}
+
+// owns tells whether the device of the worker is assigned to this instance
+func (c *clusterState) owns(jctx *JCtx) bool {
+	_, changed := c.assigned(jctx)
+	return changed == nil
+}
+
+// members returns the members of the fleet, nil if the instance is not one
+func (c *clusterState) members() []string {
+	c.Lock()
+	defer c.Unlock()
+	if c.ring == nil {
+		return nil
+	}
+	return c.ring.members
+}
+
+// outside tells whether the instance runs with --cluster but is not a
+// member of the fleet
+func (c *clusterState) outside() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.changed != nil && c.ring == nil
+}
+
+// setRing changes the ring, it returns false if its members did not change
+func (c *clusterState) setRing(r *hashRing) bool {
+	c.Lock()
+	defer c.Unlock()
+	if r == nil && c.ring == nil || r != nil && c.ring != nil && strings.Join(r.members, "\n") == strings.Join(c.ring.members, "\n") {
+		return false
+	}
+	c.ring = r
+	close(c.changed)
+	c.changed = make(chan struct{})
+	return true
+}
+
+// clusterSetMembers rebalances the devices on the members, nil when the
+// instance is no longer one. The workers of the devices moved to another
+// member stop streaming, those moved to this instance are woken up.
+func clusterSetMembers(members []string, why string) {
+	var r *hashRing
+	if members != nil {
+		r = newHashRing(members)
+	}
+	workers := deviceWorkers("")
+	owned := map[*JCtx]bool{}
+	for _, jctx := range workers {
+		owned[jctx] = cluster.owns(jctx)
+	}
+	if !cluster.setRing(r) {
+		return
+	}
+	if r == nil {
+		globalLog(LogLevelWarn, "Cluster: not collecting: "+why)
+	}
+	n := 0
+	for _, jctx := range workers {
+		if !cluster.owns(jctx) {
+			if owned[jctx] {
+				resubscribe(jctx)
+			}
+			continue
+		}
+		n++
+	}
+	if r != nil {
+		globalLog(LogLevelInfo, fmt.Sprintf("Cluster: %d members, collecting %d of %d devices", len(members), n, len(workers)))
+	}
+}
+
+// clusterInit makes the instance collect nothing until it joins the fleet
+// of --cluster, it does nothing without --cluster
+func clusterInit() error {
+	if *clusterStore == "" {
+		return nil
+	}
+	if *clusterTTL <= 0 {
+		return fmt.Errorf("--cluster-ttl must be positive")
+	}
+	ttl := time.Duration(*clusterTTL) * time.Second
+	id := instanceID(*clusterID)
+	m, err := newClusterMembership(*clusterStore, id, ttl)
+	if err != nil {
+		return err
+	}
+	cluster.Lock()
+	cluster.id, cluster.changed = id, make(chan struct{})
+	cluster.stop, cluster.done = make(chan struct{}), make(chan struct{})
+	cluster.reporter, _ = m.(clusterReporter)
+	cluster.Unlock()
+	go clusterRun(m, ttl)
+	return nil
+}
+
+// clusterRun renews the membership every third of the ttl and rebalances
+// the devices when the members change. The instance stops collecting when
+// it could not renew its membership for half of the ttl, before the other
+// members take its devices.
+func clusterRun(m clusterMembership, ttl time.Duration) {
+	renewed := time.Now()
+	failed, reportFailed := "", ""
+	var counters clusterCounters
+	for {
+		members, err := m.join()
+		switch {
+		case err != nil:
+			if err.Error() != failed {
+				globalLog(LogLevelError, fmt.Sprintf("Cluster: %v", err))
+				failed = err.Error()
+			}
+			if cluster.members() != nil && time.Since(renewed) > ttl/2 {
+				clusterSetMembers(nil, "the membership could not be renewed")
+			}
+		case !StringInSlice(cluster.id, members):
+			failed = ""
+			clusterSetMembers(nil, "not registered in the fleet yet")
+		default:
+			failed = ""
+			renewed = time.Now()
+			clusterSetMembers(members, "")
+			if err := clusterReport(m, cluster.id, &counters); err != nil {
+				if err.Error() != reportFailed {
+					globalLog(LogLevelWarn, fmt.Sprintf("Cluster: could not store the status: %v", err))
+					reportFailed = err.Error()
+				}
+			} else {
+				reportFailed = ""
+			}
+		}
+
+		t := time.NewTimer(ttl / 3)
+		select {
+		case <-cluster.stop:
+			t.Stop()
+			if err := m.leave(); err != nil {
+				globalLog(LogLevelError, fmt.Sprintf("Cluster: could not leave the fleet: %v", err))
+			}
+			close(cluster.done)
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// clusterStop leaves the fleet so that the other members take the devices
+// while this instance drains, it returns once it is left
+func clusterStop() {
+	cluster.Lock()
+	stop, done := cluster.stop, cluster.done
+	if stop != nil && !cluster.stopped {
+		close(stop)
+		cluster.stopped = true
+	}
+	cluster.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// newClusterMembership returns the membership of --cluster, a lock of the
+// id under the prefix of the URL which is held while the instance is a
+// member
+func newClusterMembership(store, id string, ttl time.Duration) (clusterMembership, error) {
+	u, err := url.Parse(store)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --cluster %q: %v", store, err)
+	}
+	prefix := strings.Trim(u.Path, "/")
+	if s := strings.TrimSuffix(u.Scheme, "+https"); s != "consul" && s != "etcd" {
+		return nil, fmt.Errorf("invalid --cluster %q: unknown store %s", store, u.Scheme)
+	}
+	if prefix == "" {
+		return nil, fmt.Errorf("invalid --cluster %q: no host or prefix", store)
+	}
+	if strings.Contains(id, "/") {
+		return nil, fmt.Errorf("invalid --cluster-id %q: it contains /", id)
+	}
+	u.Path = "/" + prefix + "/" + id
+	lock, err := newStoreLock("--cluster", u.String(), id, ttl)
+	if err != nil {
+		return nil, err
+	}
+	switch l := lock.(type) {
+	case *consulLock:
+		return &consulMembers{consulLock: l, prefix: prefix + "/"}, nil
+	case *etcdLock:
+		return &etcdMembers{etcdLock: l, prefix: "/" + prefix + "/"}, nil
+	}
+	return nil, fmt.Errorf("invalid --cluster %q: unknown store %s", store, u.Scheme)
+}
+
+// consulMembers are the keys under the prefix of the KV store of Consul
+// held by the sessions of the members
+type consulMembers struct {
+	*consulLock
+	prefix string
+}
+
+func (c *consulMembers) join() ([]string, error) {
+	member, err := c.campaign()
+	if err != nil {
+		return nil, err
+	}
+	var kvs []struct {
+		Key     string
+		Session string
+	}
+	code, err := c.consul.do("GET", "/v1/kv/"+c.prefix+"?recurse", nil, &kvs)
+	if err != nil && code != http.StatusNotFound {
+		return nil, err
+	}
+	members := []string{}
+	for _, kv := range kvs {
+		id := strings.TrimPrefix(kv.Key, c.prefix)
+		if id == c.id && !member {
+			// held by an earlier instance of the same id, until its session
+			// expires
+			continue
+		}
+		if kv.Session != "" && !strings.Contains(id, "/") {
+			members = append(members, id)
+		}
+	}
+	return members, nil
+}
+
+func (c *consulMembers) leave() error {
+	return c.resign()
+}
+
+// etcdMembers are the keys under the prefix put by the members with their
+// leases
+type etcdMembers struct {
+	*etcdLock
+	prefix string
+}
+
+func (e *etcdMembers) join() ([]string, error) {
+	member, err := e.campaign()
+	if err != nil {
+		return nil, err
+	}
+	// the keys of the prefix are those up to the prefix with its / changed
+	// into the next byte
+	end := e.prefix[:len(e.prefix)-1] + string(e.prefix[len(e.prefix)-1]+1)
+	var r struct {
+		Kvs []struct {
+			Key string `json:"key"`
+		} `json:"kvs"`
+	}
+	req := map[string]interface{}{
+		"key":       base64.StdEncoding.EncodeToString([]byte(e.prefix)),
+		"range_end": base64.StdEncoding.EncodeToString([]byte(end)),
+		"keys_only": true,
+	}
+	if err := e.post("/v3/kv/range", req, &r); err != nil {
+		return nil, err
+	}
+	members := []string{}
+	for _, kv := range r.Kvs {
+		key, err := base64.StdEncoding.DecodeString(kv.Key)
+		if err != nil {
+			return nil, fmt.Errorf("etcd /v3/kv/range: %v", err)
+		}
+		id := strings.TrimPrefix(string(key), e.prefix)
+		if id == e.id && !member {
+			// a key left by an earlier instance of the same id, until its
+			// lease expires
+			continue
+		}
+		if !strings.Contains(id, "/") {
+			members = append(members, id)
+		}
+	}
+	return members, nil
+}
+
+func (e *etcdMembers) leave() error {
+	return e.resign()
+}
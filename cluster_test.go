@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// resetCluster restores the instance collecting all the devices
+func resetCluster() {
+	cluster.Lock()
+	cluster.id, cluster.ring, cluster.changed = "", nil, nil
+	cluster.stop, cluster.done, cluster.stopped = nil, nil, false
+	cluster.reporter = nil
+	cluster.Unlock()
+}
+
+func TestHashRing(t *testing.T) {
+	var devices []string
+	for i := 0; i < 600; i++ {
+		devices = append(devices, fmt.Sprintf("r%d:32767", i))
+	}
+	assign := func(r *hashRing) map[string]string {
+		owners := map[string]string{}
+		for _, d := range devices {
+			owners[d] = r.owner(d)
+		}
+		return owners
+	}
+
+	three := assign(newHashRing([]string{"c", "a", "b"}))
+	shares := map[string]int{}
+	for _, m := range three {
+		shares[m]++
+	}
+	for _, m := range []string{"a", "b", "c"} {
+		if shares[m] < 100 || shares[m] > 300 {
+			t.Errorf("%s has %d of %d devices", m, shares[m], len(devices))
+		}
+	}
+	if !reflect.DeepEqual(assign(newHashRing([]string{"a", "b", "c"})), three) {
+		t.Errorf("the devices depend on the order of the members")
+	}
+
+	// a member joining takes devices from the others only
+	four := assign(newHashRing([]string{"a", "b", "c", "d"}))
+	moved := 0
+	for d, m := range four {
+		if m != three[d] {
+			if m != "d" {
+				t.Errorf("%s moved from %s to %s", d, three[d], m)
+			}
+			moved++
+		}
+	}
+	if moved == 0 || moved > 300 {
+		t.Errorf("%d of %d devices moved to the new member", moved, len(devices))
+	}
+
+	if owner := newHashRing(nil).owner("r1:32767"); owner != "" {
+		t.Errorf("owner() without members = %q", owner)
+	}
+}
+
+// assignedTo returns a worker of a device assigned to member by the ring of
+// members
+func assignedTo(t *testing.T, member string, members ...string) *JCtx {
+	r := newHashRing(members)
+	for i := 0; i < 1000; i++ {
+		jctx := &JCtx{config: Config{Host: fmt.Sprintf("r%d", i), Port: 32767, Paths: []PathsConfig{{Path: "/interfaces"}}},
+			control: make(chan os.Signal, 1)}
+		if r.owner(clusterKey(jctx)) == member {
+			return jctx
+		}
+	}
+	t.Fatalf("no device assigned to %s", member)
+	return nil
+}
+
+func TestClusterWaitResumed(t *testing.T) {
+	defer resetCluster()
+	mine, theirs := assignedTo(t, "a", "a", "b"), assignedTo(t, "b", "a", "b")
+	cluster.Lock()
+	cluster.id, cluster.changed = "a", make(chan struct{})
+	cluster.Unlock()
+
+	done := make(chan bool)
+	go func() { done <- waitResumed(mine) }()
+	select {
+	case <-done:
+		t.Fatalf("waitResumed() returned before joining the cluster")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if r := checkReadiness([]*JCtx{mine}, 0, false); r.Ready || r.Unassigned != 1 || r.Devices != 0 {
+		t.Errorf("readiness before joining the cluster %+v", r)
+	}
+
+	clusterSetMembers([]string{"a"}, "")
+	if !<-done {
+		t.Errorf("waitResumed() = false once joined")
+	}
+	if !cluster.owns(theirs) {
+		t.Errorf("the device of b is not collected before b joins")
+	}
+
+	// b joins, the worker streaming its device stops
+	metricWorkers.Lock()
+	metricWorkers.m[mine], metricWorkers.m[theirs] = true, true
+	metricWorkers.Unlock()
+	defer func() {
+		metricWorkers.Lock()
+		delete(metricWorkers.m, mine)
+		delete(metricWorkers.m, theirs)
+		metricWorkers.Unlock()
+	}()
+	clusterSetMembers([]string{"b", "a"}, "")
+	select {
+	case s := <-theirs.control:
+		if s != syscall.SIGHUP {
+			t.Errorf("signal %v", s)
+		}
+	default:
+		t.Errorf("the worker of the device moved to b was not resubscribed")
+	}
+	select {
+	case <-mine.control:
+		t.Errorf("the worker of the device kept by a was resubscribed")
+	default:
+	}
+	if owner, changed := cluster.assigned(theirs); owner != "b" || changed == nil {
+		t.Errorf("assigned() = %q, %v", owner, changed)
+	}
+	if h := workerHealth(theirs); h.Owner != "b" || !h.Unassigned {
+		t.Errorf("health %+v", h)
+	}
+	mine.metrics.attempted = 1
+	r := checkReadiness([]*JCtx{mine, theirs}, 0, false)
+	if !r.Ready || r.Devices != 1 || r.Unassigned != 1 {
+		t.Errorf("readiness %+v", r)
+	}
+	if s := sdStatus(r); s != "0 of 1 devices connected, 1 on the other members" {
+		t.Errorf("sdStatus() = %q", s)
+	}
+}
+
+// fakeMembers is a fleet of a and b until it fails
+type fakeMembers struct {
+	sync.Mutex
+	fail bool
+	left bool
+}
+
+func (f *fakeMembers) join() ([]string, error) {
+	f.Lock()
+	defer f.Unlock()
+	if f.fail {
+		return nil, fmt.Errorf("unreachable")
+	}
+	return []string{"a", "b"}, nil
+}
+
+func (f *fakeMembers) leave() error {
+	f.Lock()
+	defer f.Unlock()
+	f.left = true
+	return nil
+}
+
+func TestClusterRun(t *testing.T) {
+	defer resetCluster()
+	cluster.Lock()
+	cluster.id, cluster.changed = "a", make(chan struct{})
+	cluster.stop, cluster.done = make(chan struct{}), make(chan struct{})
+	cluster.Unlock()
+	m := &fakeMembers{}
+	go clusterRun(m, 300*time.Millisecond)
+
+	wait := func(want int) {
+		t.Helper()
+		for i := 0; i < 100 && len(cluster.members()) != want; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if n := len(cluster.members()); n != want {
+			t.Fatalf("%d members, want %d", n, want)
+		}
+	}
+	wait(2)
+	m.Lock()
+	m.fail = true
+	m.Unlock()
+	wait(0)
+	m.Lock()
+	m.fail = false
+	m.Unlock()
+	wait(2)
+
+	clusterStop()
+	clusterStop()
+	if !m.left {
+		t.Errorf("the fleet was not left")
+	}
+}
+
+// testMembership checks that a and b, two members of the fleet, see each
+// other until they leave
+func testMembership(t *testing.T, a, b clusterMembership) {
+	join := func(m clusterMembership, name string, want ...string) {
+		t.Helper()
+		members, err := m.join()
+		sort.Strings(members)
+		if err != nil || strings.Join(members, ",") != strings.Join(want, ",") {
+			t.Fatalf("%s.join() = %v, %v, want %v", name, members, err, want)
+		}
+	}
+	join(a, "a", "a")
+	join(b, "b", "a", "b")
+	join(a, "a", "a", "b")
+	if err := a.leave(); err != nil {
+		t.Fatal(err)
+	}
+	join(b, "b", "b")
+}
+
+func TestConsulMembers(t *testing.T) {
+	s, expire := fakeConsul(t)
+	defer s.Close()
+	store := "consul://" + strings.TrimPrefix(s.URL, "http://") + "/jtimon/collectors"
+	a, err := newClusterMembership(store, "a", 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := newClusterMembership(store, "b", 3*time.Second)
+	testMembership(t, a, b)
+
+	expire()
+	if members, err := b.join(); err != nil || !reflect.DeepEqual(members, []string{"b"}) {
+		t.Errorf("join() after the session expired = %v, %v", members, err)
+	}
+}
+
+func TestEtcdMembers(t *testing.T) {
+	s, expire := fakeEtcd(t)
+	defer s.Close()
+	store := "etcd://" + strings.TrimPrefix(s.URL, "http://") + "/jtimon/collectors"
+	a, err := newClusterMembership(store, "a", 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := newClusterMembership(store, "b", 3*time.Second)
+	testMembership(t, a, b)
+
+	expire()
+	if members, err := b.join(); err != nil || !reflect.DeepEqual(members, []string{"b"}) {
+		t.Errorf("join() after the lease expired = %v, %v", members, err)
+	}
+}
+
+func TestNewClusterMembership(t *testing.T) {
+	tests := []struct {
+		store string
+		id    string
+		err   string
+	}{
+		{"consul://127.0.0.1/jtimon/collectors", "a", ""},
+		{"etcd+https://etcd/jtimon", "a", ""},
+		{"consul://127.0.0.1", "a", `invalid --cluster "consul://127.0.0.1": no host or prefix`},
+		{"k8s://monitoring/jtimon", "a", `invalid --cluster "k8s://monitoring/jtimon": unknown store k8s`},
+		{"etcd://etcd/jtimon", "a/b", `invalid --cluster-id "a/b": it contains /`},
+	}
+	for _, test := range tests {
+		_, err := newClusterMembership(test.store, test.id, 10*time.Second)
+		if (err == nil) != (test.err == "") || err != nil && err.Error() != test.err {
+			t.Errorf("newClusterMembership(%q, %q) = %v, want %q", test.store, test.id, err, test.err)
+		}
+	}
+	m, _ := newClusterMembership("consul://127.0.0.1/jtimon/collectors/", "a", 10*time.Second)
+	if c := m.(*consulMembers); c.key != "jtimon/collectors/a" || c.prefix != "jtimon/collectors/" {
+		t.Errorf("consul members %+v", c)
+	}
+	m, _ = newClusterMembership("etcd://etcd/jtimon", "a", 10*time.Second)
+	if e := m.(*etcdMembers); e.key != "/jtimon/a" || e.prefix != "/jtimon/" || e.base != "http://etcd:2379" {
+		t.Errorf("etcd members %+v", e)
+	}
+}
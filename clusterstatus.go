@@ -0,0 +1,388 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// clusterReporter stores the status of each member next to its membership,
+// so that any member, or jtimon cluster status, shows the whole fleet. The
+// status of a member is removed with its membership.
+type clusterReporter interface {
+	putStatus(b []byte) error
+	// statuses returns the statuses of the members, by member
+	statuses() (map[string][]byte, error)
+}
+
+// clusterMemberStatus is the status a member reports at each renewal of
+// its membership, with the devices assigned to it
+type clusterMemberStatus struct {
+	ID      string                `json:"id"`
+	Time    time.Time             `json:"time"`
+	Version string                `json:"version"`
+	Devices []clusterDeviceStatus `json:"devices"`
+}
+
+// clusterDeviceStatus is a device of a member, the rates are per second
+// since the previous report
+type clusterDeviceStatus struct {
+	Key        string   `json:"key"`
+	Groups     []string `json:"groups,omitempty"`
+	Connected  bool     `json:"connected"`
+	Paused     bool     `json:"paused,omitempty"`
+	Stale      bool     `json:"stale,omitempty"`
+	PacketRate float64  `json:"packet-rate"`
+	PointRate  float64  `json:"point-rate"`
+}
+
+// clusterCounters are the counters of the devices at the previous report
+type clusterCounters struct {
+	time    time.Time
+	packets map[string]uint64
+	points  map[string]uint64
+}
+
+// clusterStatusOf returns the status of the devices of the workers assigned
+// to this instance and keeps their counters in prev
+func clusterStatusOf(id string, workers []*JCtx, prev *clusterCounters, now time.Time) clusterMemberStatus {
+	s := clusterMemberStatus{ID: id, Time: now.UTC(), Version: jtimonVersion, Devices: []clusterDeviceStatus{}}
+	packets, points := map[string]uint64{}, map[string]uint64{}
+	elapsed := now.Sub(prev.time).Seconds()
+	for _, jctx := range workers {
+		if !cluster.owns(jctx) {
+			continue
+		}
+		key := clusterKey(jctx)
+		d := clusterDeviceStatus{
+			Key:       key,
+			Groups:    jctx.config.Groups,
+			Connected: atomic.LoadInt32(&jctx.metrics.connected) == 1,
+			Stale:     isStale(jctx),
+		}
+		d.Paused, _ = jctx.paused.state()
+		packets[key] = atomic.LoadUint64(&jctx.metrics.packets)
+		points[key] = atomic.LoadUint64(&jctx.metrics.points)
+		if p, ok := prev.packets[key]; ok && elapsed > 0 && packets[key] >= p {
+			d.PacketRate = float64(packets[key]-p) / elapsed
+			d.PointRate = float64(points[key]-prev.points[key]) / elapsed
+		}
+		s.Devices = append(s.Devices, d)
+	}
+	sort.Slice(s.Devices, func(i, j int) bool { return s.Devices[i].Key < s.Devices[j].Key })
+	*prev = clusterCounters{time: now, packets: packets, points: points}
+	return s
+}
+
+// clusterReport stores the status of this instance, if the store of
+// --cluster keeps them
+func clusterReport(m clusterMembership, id string, prev *clusterCounters) error {
+	r, ok := m.(clusterReporter)
+	if !ok {
+		return nil
+	}
+	b, err := json.Marshal(clusterStatusOf(id, deviceWorkers(""), prev, time.Now()))
+	if err != nil {
+		return err
+	}
+	return r.putStatus(b)
+}
+
+// clusterView is the status of the fleet
+type clusterView struct {
+	Time       time.Time             `json:"time"`
+	Members    []clusterMemberView   `json:"members"`
+	Devices    int                   `json:"devices"`
+	Connected  int                   `json:"connected"`
+	PacketRate float64               `json:"packet-rate"`
+	PointRate  float64               `json:"point-rate"`
+	Uncovered  []clusterUncovered    `json:"uncovered"`
+	Reports    []clusterMemberStatus `json:"reports,omitempty"`
+}
+
+// clusterMemberView is the summary of the status of a member, Age is the
+// time in seconds since its report
+type clusterMemberView struct {
+	ID         string  `json:"id"`
+	Version    string  `json:"version"`
+	Age        float64 `json:"age"`
+	Devices    int     `json:"devices"`
+	Connected  int     `json:"connected"`
+	Stale      int     `json:"stale"`
+	Paused     int     `json:"paused"`
+	PacketRate float64 `json:"packet-rate"`
+	PointRate  float64 `json:"point-rate"`
+}
+
+// clusterUncovered is a device which is not streaming in the fleet, with
+// the member it is assigned to, "" if it is none
+type clusterUncovered struct {
+	Key   string `json:"key"`
+	Owner string `json:"owner"`
+}
+
+// clusterDevice is a device of the configs, its key on the ring and its
+// groups
+type clusterDevice struct {
+	key    string
+	groups []string
+}
+
+// clusterViewOf aggregates the statuses of the members. The devices are
+// those of the configs, the ones whose member does not report them
+// connected are uncovered; the devices and the statuses are limited to the
+// groups of scope.
+func clusterViewOf(statuses map[string][]byte, devices []clusterDevice, scope apiScope, now time.Time) (clusterView, error) {
+	v := clusterView{Time: now.UTC(), Members: []clusterMemberView{}, Uncovered: []clusterUncovered{}}
+	allowed := func(groups []string) bool {
+		if scope == nil {
+			return true
+		}
+		for _, g := range groups {
+			if scope[g] {
+				return true
+			}
+		}
+		return false
+	}
+
+	var members []string
+	connected := map[string]bool{}
+	for id, b := range statuses {
+		var s clusterMemberStatus
+		if err := json.Unmarshal(b, &s); err != nil {
+			return v, fmt.Errorf("invalid status of member %s: %v", id, err)
+		}
+		members = append(members, id)
+		m := clusterMemberView{ID: id, Version: s.Version, Age: now.Sub(s.Time).Seconds()}
+		var shown []clusterDeviceStatus
+		for _, d := range s.Devices {
+			if !allowed(d.Groups) {
+				continue
+			}
+			shown = append(shown, d)
+			m.Devices++
+			if d.Connected {
+				m.Connected++
+				connected[d.Key] = true
+			}
+			if d.Stale {
+				m.Stale++
+			}
+			if d.Paused {
+				m.Paused++
+			}
+			m.PacketRate += d.PacketRate
+			m.PointRate += d.PointRate
+		}
+		s.Devices = shown
+		v.Members = append(v.Members, m)
+		v.Reports = append(v.Reports, s)
+		v.Devices += m.Devices
+		v.Connected += m.Connected
+		v.PacketRate += m.PacketRate
+		v.PointRate += m.PointRate
+	}
+	sort.Slice(v.Members, func(i, j int) bool { return v.Members[i].ID < v.Members[j].ID })
+	sort.Slice(v.Reports, func(i, j int) bool { return v.Reports[i].ID < v.Reports[j].ID })
+
+	var ring *hashRing
+	if len(members) != 0 {
+		ring = newHashRing(members)
+	}
+	for _, d := range devices {
+		if connected[d.key] || !allowed(d.groups) {
+			continue
+		}
+		u := clusterUncovered{Key: d.key}
+		if ring != nil {
+			u.Owner = ring.owner(d.key)
+		}
+		v.Uncovered = append(v.Uncovered, u)
+	}
+	sort.Slice(v.Uncovered, func(i, j int) bool { return v.Uncovered[i].Key < v.Uncovered[j].Key })
+	return v, nil
+}
+
+// clusterHandler serves the status of the fleet of --cluster, the devices
+// of the config files of this instance are the ones of the fleet
+func clusterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cluster.Lock()
+	rep := cluster.reporter
+	cluster.Unlock()
+	if rep == nil {
+		http.Error(w, "not running with --cluster", http.StatusNotFound)
+		return
+	}
+	statuses, err := rep.statuses()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	var devices []clusterDevice
+	for _, jctx := range deviceWorkers("") {
+		devices = append(devices, clusterDevice{key: clusterKey(jctx), groups: jctx.config.Groups})
+	}
+	v, err := clusterViewOf(statuses, devices, requestScope(r.Context()), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if r.URL.Query().Get("devices") != "true" {
+		v.Reports = nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeClusterView prints the status of the fleet as a table
+func writeClusterView(w io.Writer, v clusterView) {
+	fmt.Fprintf(w, "%d members, %d devices, %d connected, %d uncovered, %.1f packets/s, %.1f points/s\n",
+		len(v.Members), v.Devices, v.Connected, len(v.Uncovered), v.PacketRate, v.PointRate)
+	fmt.Fprintf(w, "%-24s %-10s %6s %8s %10s %6s %7s %10s %10s\n",
+		"MEMBER", "VERSION", "AGE", "DEVICES", "CONNECTED", "STALE", "PAUSED", "PACKETS/S", "POINTS/S")
+	for _, m := range v.Members {
+		fmt.Fprintf(w, "%-24s %-10s %5.0fs %8d %10d %6d %7d %10.1f %10.1f\n",
+			m.ID, m.Version, m.Age, m.Devices, m.Connected, m.Stale, m.Paused, m.PacketRate, m.PointRate)
+	}
+	for _, u := range v.Uncovered {
+		owner := u.Owner
+		if owner == "" {
+			owner = "no member"
+		}
+		fmt.Fprintf(w, "uncovered: %s (%s)\n", u.Key, owner)
+	}
+}
+
+// clusterMain runs jtimon cluster status: it reads the statuses of the
+// members from the store of --cluster, the devices of the config files, if
+// any, are the ones of the fleet
+func clusterMain(args []string) {
+	if len(args) != 1 || args[0] != "status" {
+		log.Printf("usage: jtimon cluster status --cluster consul://host:port/prefix")
+		os.Exit(1)
+	}
+	if *clusterStore == "" {
+		log.Printf("jtimon cluster status needs the store of the fleet (--cluster)")
+		os.Exit(1)
+	}
+	m, err := newClusterMembership(*clusterStore, instanceID(*clusterID), time.Duration(*clusterTTL)*time.Second)
+	if err != nil {
+		log.Printf("%v", err)
+		os.Exit(1)
+	}
+	statuses, err := m.(clusterReporter).statuses()
+	if err != nil {
+		log.Printf("%v", err)
+		os.Exit(1)
+	}
+	var devices []clusterDevice
+	if len(*configFiles) != 0 || *configFileList != "" {
+		if err := GetConfigFiles(configFiles, *configFileList); err != nil {
+			log.Printf("%v", err)
+			os.Exit(1)
+		}
+		for _, file := range *configFiles {
+			config, err := NewJTIMONConfig(file)
+			if err != nil {
+				log.Printf("%s: %v", file, err)
+				os.Exit(1)
+			}
+			devices = append(devices, clusterDevice{key: fmt.Sprintf("%s:%d", config.Host, config.Port), groups: config.Groups})
+		}
+	}
+	v, err := clusterViewOf(statuses, devices, nil, time.Now())
+	if err != nil {
+		log.Printf("%v", err)
+		os.Exit(1)
+	}
+	writeClusterView(os.Stdout, v)
+}
+
+// the status of a member is a key under its key, acquired by its session
+func (c *consulMembers) putStatus(b []byte) error {
+	if c.session == "" {
+		return nil
+	}
+	_, err := c.consul.do("PUT", "/v1/kv/"+c.key+"/status?acquire="+c.session, json.RawMessage(b), nil)
+	return err
+}
+
+func (c *consulMembers) statuses() (map[string][]byte, error) {
+	var kvs []struct {
+		Key   string
+		Value []byte
+	}
+	code, err := c.consul.do("GET", "/v1/kv/"+c.prefix+"?recurse", nil, &kvs)
+	if err != nil && code != http.StatusNotFound {
+		return nil, err
+	}
+	statuses := map[string][]byte{}
+	for _, kv := range kvs {
+		id := strings.TrimPrefix(kv.Key, c.prefix)
+		if strings.HasSuffix(id, "/status") && kv.Value != nil {
+			statuses[strings.TrimSuffix(id, "/status")] = kv.Value
+		}
+	}
+	return statuses, nil
+}
+
+// the status of a member is a key under its key, with its lease
+func (e *etcdMembers) putStatus(b []byte) error {
+	if e.lease == "" {
+		return nil
+	}
+	req := map[string]string{
+		"key":   base64.StdEncoding.EncodeToString([]byte(e.key + "/status")),
+		"value": base64.StdEncoding.EncodeToString(b),
+		"lease": e.lease,
+	}
+	var r struct{}
+	return e.post("/v3/kv/put", req, &r)
+}
+
+func (e *etcdMembers) statuses() (map[string][]byte, error) {
+	end := e.prefix[:len(e.prefix)-1] + string(e.prefix[len(e.prefix)-1]+1)
+	var r struct {
+		Kvs []struct {
+			Key   string `json:"key"`
+			Value string `json:"value"`
+		} `json:"kvs"`
+	}
+	req := map[string]interface{}{
+		"key":       base64.StdEncoding.EncodeToString([]byte(e.prefix)),
+		"range_end": base64.StdEncoding.EncodeToString([]byte(end)),
+	}
+	if err := e.post("/v3/kv/range", req, &r); err != nil {
+		return nil, err
+	}
+	statuses := map[string][]byte{}
+	for _, kv := range r.Kvs {
+		key, err := base64.StdEncoding.DecodeString(kv.Key)
+		if err != nil {
+			return nil, fmt.Errorf("etcd /v3/kv/range: %v", err)
+		}
+		id := strings.TrimPrefix(string(key), e.prefix)
+		if !strings.HasSuffix(id, "/status") {
+			continue
+		}
+		value, err := base64.StdEncoding.DecodeString(kv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("etcd /v3/kv/range: %v", err)
+		}
+		statuses[strings.TrimSuffix(id, "/status")] = value
+	}
+	return statuses, nil
+}
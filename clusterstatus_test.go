@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClusterStatusOf(t *testing.T) {
+	defer resetCluster()
+	r1 := &JCtx{config: Config{Host: "r1", Port: 32767, Groups: []string{"core"}}}
+	r2 := &JCtx{config: Config{Host: "r2", Port: 32767}}
+	r1.metrics.connected, r1.metrics.packets, r1.metrics.points = 1, 10, 100
+
+	now := time.Unix(1000, 0)
+	var prev clusterCounters
+	s := clusterStatusOf("a", []*JCtx{r2, r1}, &prev, now)
+	want := []clusterDeviceStatus{{Key: "r1:32767", Groups: []string{"core"}, Connected: true}, {Key: "r2:32767"}}
+	if s.ID != "a" || !reflect.DeepEqual(s.Devices, want) {
+		t.Errorf("first report: got %+v, want devices %+v", s, want)
+	}
+	r1.metrics.packets, r1.metrics.points = 30, 500
+	s = clusterStatusOf("a", []*JCtx{r1, r2}, &prev, now.Add(2*time.Second))
+	if d := s.Devices[0]; d.PacketRate != 10 || d.PointRate != 200 {
+		t.Errorf("second report: got %+v, want 10 packets/s and 200 points/s", d)
+	}
+
+	// only the devices assigned to the instance
+	cluster.Lock()
+	cluster.id, cluster.changed, cluster.ring = "a", make(chan struct{}), newHashRing([]string{"a", "b"})
+	cluster.Unlock()
+	b := assignedTo(t, "b", "a", "b")
+	s = clusterStatusOf("a", []*JCtx{b}, &prev, now)
+	if len(s.Devices) != 0 {
+		t.Errorf("device of b: got %+v", s.Devices)
+	}
+}
+
+func TestClusterViewOf(t *testing.T) {
+	now := time.Unix(1000, 0)
+	status := func(id string, devices ...clusterDeviceStatus) []byte {
+		b, _ := json.Marshal(clusterMemberStatus{ID: id, Time: now.Add(-2 * time.Second), Version: "v1", Devices: devices})
+		return b
+	}
+	statuses := map[string][]byte{
+		"b": status("b", clusterDeviceStatus{Key: "r2:32767", Connected: true, PacketRate: 1, PointRate: 10},
+			clusterDeviceStatus{Key: "r3:32767", Stale: true}),
+		"a": status("a", clusterDeviceStatus{Key: "r1:32767", Groups: []string{"core"}, Connected: true, Paused: true, PacketRate: 2, PointRate: 20}),
+	}
+	devices := []clusterDevice{{key: "r1:32767", groups: []string{"core"}}, {key: "r2:32767"}, {key: "r3:32767"}, {key: "r4:32767"}}
+	v, err := clusterViewOf(statuses, devices, nil, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	members := []clusterMemberView{
+		{ID: "a", Version: "v1", Age: 2, Devices: 1, Connected: 1, Paused: 1, PacketRate: 2, PointRate: 20},
+		{ID: "b", Version: "v1", Age: 2, Devices: 2, Connected: 1, Stale: 1, PacketRate: 1, PointRate: 10},
+	}
+	if !reflect.DeepEqual(v.Members, members) {
+		t.Errorf("got members %+v, want %+v", v.Members, members)
+	}
+	if v.Devices != 3 || v.Connected != 2 || v.PacketRate != 3 || v.PointRate != 30 {
+		t.Errorf("got totals %+v", v)
+	}
+	ring := newHashRing([]string{"a", "b"})
+	uncovered := []clusterUncovered{{Key: "r3:32767", Owner: ring.owner("r3:32767")}, {Key: "r4:32767", Owner: ring.owner("r4:32767")}}
+	if !reflect.DeepEqual(v.Uncovered, uncovered) {
+		t.Errorf("got uncovered %+v, want %+v", v.Uncovered, uncovered)
+	}
+
+	v, _ = clusterViewOf(statuses, devices, apiScope{"core": true}, now)
+	if v.Devices != 1 || len(v.Uncovered) != 0 || len(v.Reports[1].Devices) != 0 {
+		t.Errorf("scope core: got %+v", v)
+	}
+
+	var out bytes.Buffer
+	writeClusterView(&out, v)
+	if !strings.HasPrefix(out.String(), "2 members, 1 devices, 1 connected, 0 uncovered") {
+		t.Errorf("got table\n%s", out.String())
+	}
+
+	statuses["c"] = []byte("{")
+	if _, err := clusterViewOf(statuses, nil, nil, now); err == nil {
+		t.Errorf("invalid status: want an error")
+	}
+}
+
+// testStatuses checks that the statuses of a and b are stored while they
+// are members
+func testStatuses(t *testing.T, a, b clusterMembership) {
+	for _, m := range []clusterMembership{a, b} {
+		if _, err := m.join(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a.(clusterReporter).putStatus([]byte(`{"id":"a"}`))
+	b.(clusterReporter).putStatus([]byte(`{"id":"b"}`))
+	got, err := b.(clusterReporter).statuses()
+	want := map[string][]byte{"a": []byte(`{"id":"a"}`), "b": []byte(`{"id":"b"}`)}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("statuses() = %q, %v, want %q", got, err, want)
+	}
+	if members, err := a.join(); err != nil || len(members) != 2 {
+		t.Errorf("join() with the statuses = %v, %v", members, err)
+	}
+	if err := a.leave(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := b.(clusterReporter).statuses(); len(got) != 1 || got["b"] == nil {
+		t.Errorf("statuses() after a left = %q", got)
+	}
+}
+
+func TestClusterStatuses(t *testing.T) {
+	consul, _ := fakeConsul(t)
+	defer consul.Close()
+	etcd, _ := fakeEtcd(t)
+	defer etcd.Close()
+	for _, store := range []string{
+		"consul://" + strings.TrimPrefix(consul.URL, "http://") + "/jtimon/collectors",
+		"etcd://" + strings.TrimPrefix(etcd.URL, "http://") + "/jtimon/collectors",
+	} {
+		a, err := newClusterMembership(store, "a", 3*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := newClusterMembership(store, "b", 3*time.Second)
+		testStatuses(t, a, b)
+	}
+}
+
+func TestClusterHandler(t *testing.T) {
+	defer resetCluster()
+	rec := httptest.NewRecorder()
+	clusterHandler(rec, httptest.NewRequest("GET", "/cluster", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("without --cluster: got code %d", rec.Code)
+	}
+
+	s, _ := fakeConsul(t)
+	defer s.Close()
+	m, err := newClusterMembership("consul://"+strings.TrimPrefix(s.URL, "http://")+"/jtimon/collectors", "a", 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	members, _ := m.join()
+	cluster.Lock()
+	cluster.id, cluster.changed, cluster.reporter = "a", make(chan struct{}), m.(clusterReporter)
+	cluster.ring = newHashRing(members)
+	cluster.Unlock()
+	r1 := &JCtx{config: Config{Host: "r1", Port: 32767}, control: make(chan os.Signal)}
+	r1.metrics.connected = 1
+	dropsInit(r1)
+	defer dropsStop(r1)
+	var counters clusterCounters
+	if err := clusterReport(m, "a", &counters); err != nil {
+		t.Fatal(err)
+	}
+
+	rec = httptest.NewRecorder()
+	clusterHandler(rec, httptest.NewRequest("GET", "/cluster?devices=true", nil))
+	var v clusterView
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("%d %s: %v", rec.Code, rec.Body.String(), err)
+	}
+	if len(v.Members) != 1 || v.Connected != 1 || len(v.Uncovered) != 0 || len(v.Reports) != 1 {
+		t.Errorf("got %+v", v)
+	}
+	rec = httptest.NewRecorder()
+	clusterHandler(rec, httptest.NewRequest("POST", "/cluster", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: got code %d", rec.Code)
+	}
+}
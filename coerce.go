@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CoerceRule converts string values of the fields matching match (all string
+// fields if empty) into numbers. type is auto (integer if the value is
+// integral, float otherwise), integer or float. Values sent as JSON strings
+// ("\"42\"") are unquoted first, values which do not parse are kept as is.
+type CoerceRule struct {
+	Match string `json:"match"`
+	Type  string `json:"type"`
+}
+
+type coerceRule struct {
+	re  *regexp.Regexp
+	typ string
+}
+
+type coerce struct {
+	rules []coerceRule
+}
+
+func newCoerceTransformer() *transformer {
+	return &transformer{
+		name: "coerce",
+		new:  newCoerce,
+	}
+}
+
+func newCoerce(jctx *JCtx) (transform, error) {
+	rules := jctx.config.Transform.Coerce
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	c := &coerce{}
+	for i, r := range rules {
+		rule := coerceRule{typ: r.Type}
+		switch r.Type {
+		case "":
+			rule.typ = "auto"
+		case "auto", "integer", "float":
+		default:
+			return nil, fmt.Errorf("rule %d: unknown type %q, use auto, integer or float", i, r.Type)
+		}
+		if r.Match != "" {
+			re, err := regexp.Compile(r.Match)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid match %q: %v", i, r.Match, err)
+			}
+			rule.re = re
+		}
+		c.rules = append(c.rules, rule)
+	}
+	return c, nil
+}
+
+func coerceValue(s, typ string) (interface{}, bool) {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+
+	switch typ {
+	case "integer":
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, true
+		}
+		// integral floats like "42.0" are fine too
+		if f, err := strconv.ParseFloat(s, 64); err == nil && f == float64(int64(f)) {
+			return int64(f), true
+		}
+	case "float":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f, true
+		}
+	default:
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, true
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+func (c *coerce) rule(field string) *coerceRule {
+	for i, r := range c.rules {
+		if r.re == nil || r.re.MatchString(field) {
+			return &c.rules[i]
+		}
+	}
+	return nil
+}
+
+func (c *coerce) apply(points []*point) []*point {
+	out := make([]*point, 0, len(points))
+	for _, p := range points {
+		var fields map[string]interface{}
+		for k, v := range p.Fields {
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+			r := c.rule(k)
+			if r == nil {
+				continue
+			}
+			if n, ok := coerceValue(s, r.typ); ok {
+				if fields == nil {
+					fields = copyFields(p.Fields)
+				}
+				fields[k] = n
+			}
+		}
+		if fields == nil {
+			out = append(out, p)
+		} else {
+			out = append(out, newPoint(p.Measurement, p.Tags, fields, p.Timestamp))
+		}
+	}
+	return out
+}
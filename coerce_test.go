@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCoerce(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []CoerceRule
+		in    interface{}
+		want  interface{}
+	}{
+		{"auto-integer", []CoerceRule{{}}, "42", int64(42)},
+		{"auto-float", []CoerceRule{{}}, " 4.5 ", 4.5},
+		{"json-string", []CoerceRule{{}}, `"-7"`, int64(-7)},
+		{"not-a-number", []CoerceRule{{}}, "UP", "UP"},
+		{"integer", []CoerceRule{{Type: "integer"}}, "42.0", int64(42)},
+		{"integer-fraction", []CoerceRule{{Type: "integer"}}, "42.5", "42.5"},
+		{"float", []CoerceRule{{Type: "float"}}, "42", 42.0},
+		{"not-matching", []CoerceRule{{Match: "temperature"}}, "42", "42"},
+		{"first-rule-wins", []CoerceRule{{Match: "value", Type: "float"}, {}}, "42", 42.0},
+		{"numbers-untouched", []CoerceRule{{Type: "float"}}, uint64(42), uint64(42)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jctx := &JCtx{}
+			jctx.config.Transform.Coerce = test.rules
+			if err := transformsInit(jctx); err != nil {
+				t.Fatalf("transformsInit failed: %v", err)
+			}
+			in := newPoint("m", nil, map[string]interface{}{"/state/value": test.in}, time.Unix(1, 0))
+			out := applyTransforms(jctx, []*point{in})
+			if got := out[0].Fields["/state/value"]; !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v (%T), want %v (%T)", got, got, test.want, test.want)
+			}
+			if !reflect.DeepEqual(in.Fields["/state/value"], test.in) {
+				t.Errorf("input point must not be modified")
+			}
+		})
+	}
+
+	jctx := &JCtx{}
+	jctx.config.Transform.Coerce = []CoerceRule{{Type: "string"}}
+	if err := transformsInit(jctx); err == nil {
+		t.Errorf("want error for unknown type, got nil")
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// command is a subcommand of jtimon, it takes the flags of the command
+// line which flags selects
+type command struct {
+	name    string
+	args    string
+	summary string
+	flags   func(name string) bool
+	run     func(args []string)
+}
+
+// commandOnly are the flags which only the other commands take, the others
+// are the ones of run
+var commandOnly = map[string]bool{
+	"bench-rate":          true,
+	"bench-devices":       true,
+	"bench-interfaces":    true,
+	"bench-duration":      true,
+	"dashboards-dir":      true,
+	"diff-values":         true,
+	"simulate-listen":     true,
+	"simulate-script":     true,
+	"explore-config":      true,
+	"golden":              true,
+	"golden-format":       true,
+	"golden-update":       true,
+	"healthcheck-ready":   true,
+	"healthcheck-timeout": true,
+	"from":                true,
+	"migrate-dir":         true,
+	"probe-path":          true,
+	"probe-freq":          true,
+	"probe-duration":      true,
+	"sensors-timeout":     true,
+	"top-interval":        true,
+	"version":             true,
+}
+
+// runFlags are the flags of run
+func runFlags(name string) bool {
+	return !commandOnly[name]
+}
+
+// flagNames selects the flags of the names, the ones ending with * are
+// prefixes
+func flagNames(names ...string) func(string) bool {
+	return func(name string) bool {
+		for _, n := range names {
+			if n == name || strings.HasSuffix(n, "*") && strings.HasPrefix(name, strings.TrimSuffix(n, "*")) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// configFlags are the flags the commands reading the config files take
+var configFlags = []string{"config", "config-file-list", "master-key-file", "password-source", "spiffe-socket", "fips", "log-*"}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{
+			name:    "run",
+			summary: "Stream the telemetry of the devices of the config files (the default)",
+			flags:   runFlags,
+			run:     func([]string) { runMain() },
+		},
+		{
+			name:    "validate",
+			summary: "Check the config files and exit, with status 1 if one is invalid",
+			flags:   flagNames(configFlags...),
+			run:     func([]string) { validateMain() },
+		},
+		{
+			name:    "explore",
+			summary: "Print the full config of a device with its defaults",
+			flags:   flagNames("log-*"),
+			run:     func([]string) { exploreMain() },
+		},
+		{
+			name:    "record",
+			summary: "Run and record the messages of the devices to {config}.testmeta and {config}.testbytes",
+			flags: func(name string) bool {
+				return runFlags(name) && name != "generate-test-data" && name != "consume-test-data"
+			},
+			run: func([]string) {
+				*genTestData = true
+				runMain()
+			},
+		},
+		{
+			name:    "replay",
+			summary: "Feed the messages recorded by record through the transforms and outputs of the config files",
+			flags:   flagNames(append([]string{"print", "explain", "golden*"}, configFlags...)...),
+			run:     func([]string) { replayMain() },
+		},
+		{
+			name:    "diff",
+			args:    "a b",
+			summary: "Compare two recordings of record, e.g. before and after an upgrade: their sensors, timing and values",
+			flags:   flagNames("diff-values", "log-*"),
+			run:     diffMain,
+		},
+		{
+			name:    "bench",
+			summary: "Benchmark the transforms and outputs of a config file with synthetic points",
+			flags:   flagNames(append([]string{"bench-*", "pprof*"}, configFlags...)...),
+			run:     func([]string) { benchMain() },
+		},
+		{
+			name:    "dashboards",
+			summary: "Write the Grafana dashboards of a config file",
+			flags:   flagNames(append([]string{"dashboards-dir"}, configFlags...)...),
+			run:     func([]string) { dashboardsMain() },
+		},
+		{
+			name:    "config",
+			args:    "encrypt|decrypt [file...]",
+			summary: "Encrypt or decrypt config files with the master key",
+			flags:   flagNames("config", "master-key-file", "log-*"),
+			run:     configMain,
+		},
+		{
+			name:    "cluster",
+			args:    "status",
+			summary: "Show the members of the fleet of --cluster with their devices and rates, and the devices of the config files no member streams",
+			flags:   flagNames(append([]string{"cluster", "cluster-id"}, configFlags...)...),
+			run:     clusterMain,
+		},
+		{
+			name:    "probe",
+			summary: "Measure the round trips and export latency of a Junos device on a small sensor, before onboarding it",
+			flags:   flagNames(append([]string{"probe-*", "compression"}, configFlags...)...),
+			run:     func([]string) { probeMain() },
+		},
+		{
+			name:    "sensors",
+			summary: "Check the paths of a config file against its device, the unsupported and misspelled ones",
+			flags:   flagNames(append([]string{"sensors-timeout", "compression"}, configFlags...)...),
+			run:     func([]string) { sensorsMain() },
+		},
+		{
+			name:    "migrate",
+			args:    "config.toml...",
+			summary: "Convert the gnmi and jti_openconfig_telemetry inputs of Telegraf configs into the config files of their devices",
+			flags:   flagNames("from", "migrate-dir", "log-*"),
+			run:     migrateMain,
+		},
+		{
+			name:    "simulate",
+			summary: "Serve a simulated Junos device with scripted sensors and faults, for integration tests",
+			flags:   flagNames("simulate-*", "log-*"),
+			run:     func([]string) { simulateMain() },
+		},
+		{
+			name:    "healthcheck",
+			summary: "Check the health of the local jtimon on its internal metrics service and exit 0 or 1, e.g. as a container HEALTHCHECK",
+			flags:   flagNames("healthcheck-*", "internal-metrics-host", "internal-metrics-port", "internal-metrics-socket", "api-tls-cert"),
+			run:     func([]string) { healthcheckMain() },
+		},
+		{
+			name:    "top",
+			summary: "Show the live rates, drops, latency and recent errors of the devices of the local jtimon, refreshed in place",
+			flags:   flagNames("top-interval", "internal-metrics-host", "internal-metrics-port", "internal-metrics-socket", "api-tls-cert", "api-token-file"),
+			run:     func([]string) { topMain() },
+		},
+		{
+			name:    "version",
+			summary: "Print the version and build of jtimon",
+			flags:   flagNames(),
+			run:     func([]string) { versionMain(os.Stdout) },
+		},
+		{
+			name:    "help",
+			args:    "[command]",
+			summary: "Print the usage of jtimon or of a command",
+			flags:   flagNames(),
+			run:     helpMain,
+		},
+	}
+}
+
+// findCommand returns the command of name, nil if there is none
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// flagSet returns the flags of the command, they set the same variables as
+// the flags of the command line
+func (c *command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("jtimon "+c.name, flag.ContinueOnError)
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		if c.flags(f.Name) {
+			fs.AddFlag(f)
+		}
+	})
+	fs.Usage = func() { c.usage(os.Stderr, fs) }
+	return fs
+}
+
+func (c *command) usage(w io.Writer, fs *flag.FlagSet) {
+	usage := "jtimon " + c.name
+	if fs.HasFlags() {
+		usage += " [flags]"
+	}
+	if c.args != "" {
+		usage += " " + c.args
+	}
+	fmt.Fprintf(w, "Usage: %s\n\n%s\n", usage, c.summary)
+	if fs.HasFlags() {
+		fmt.Fprintf(w, "\nFlags:\n%s", fs.FlagUsages())
+	}
+}
+
+// usage prints the commands, and the flags of the command line which are
+// the ones of all the commands
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: jtimon [command] [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(w, "\nRun \"jtimon help <command>\" for the flags of a command. Without a command, jtimon runs with\nthe flags of all the commands:\n%s", flag.CommandLine.FlagUsages())
+}
+
+// helpMain runs "jtimon help [command]"
+func helpMain(args []string) {
+	if len(args) == 0 {
+		usage(os.Stdout)
+		return
+	}
+	c := findCommand(args[0])
+	if c == nil {
+		unknownCommand(args[0])
+		os.Exit(2)
+	}
+	c.usage(os.Stdout, c.flagSet())
+}
+
+// parseCommand parses the command line, the command first and its flags or
+// the flags of all the commands without one. It returns the command and
+// its arguments.
+func parseCommand(args []string) (*command, []string, error) {
+	if len(args) != 0 && !strings.HasPrefix(args[0], "-") {
+		c := findCommand(args[0])
+		if c == nil {
+			return nil, nil, unknownCommand(args[0])
+		}
+		fs := c.flagSet()
+		if err := fs.Parse(args[1:]); err != nil {
+			if err != flag.ErrHelp {
+				fmt.Fprintf(os.Stderr, "jtimon %s: %v, run \"jtimon help %s\" for its flags\n", c.name, err, c.name)
+			}
+			return nil, nil, err
+		}
+		return c, fs.Args(), nil
+	}
+
+	// the command line of the versions without commands: all the flags, and
+	// the commands after them
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case *versionOnly:
+		return findCommand("version"), nil, nil
+	case *expConfig:
+		return findCommand("explore"), nil, nil
+	case flag.NArg() != 0:
+		if c := findCommand(flag.Arg(0)); c != nil {
+			return c, flag.Args()[1:], nil
+		}
+		return nil, nil, unknownCommand(flag.Arg(0))
+	}
+	return findCommand("run"), nil, nil
+}
+
+// unknownCommand prints and returns the error of an unknown command
+func unknownCommand(name string) error {
+	err := fmt.Errorf("unknown command %q, run \"jtimon help\" for the commands", name)
+	fmt.Fprintf(os.Stderr, "jtimon: %v\n", err)
+	return err
+}
+
+// commandInit sets up what all the commands use, from their flags
+func commandInit() {
+	logFlagsInit()
+	setMaxProcs()
+	if *pProf && *pProfPort != 0 {
+		pprofInit()
+	} else if *pProf && !metricsEnabled() {
+		log.Printf("--pprof serves the profiles on the internal metrics service or --pprof-port, neither is set")
+	}
+	if *pProfDumpDir != "" && *pProfDumpIntvl > 0 {
+		go pprofDumps(*pProfDumpDir, time.Duration(*pProfDumpIntvl)*time.Second)
+	}
+	if *fipsMode {
+		if err := fipsInit(); err != nil {
+			log.Fatalf("FIPS mode: %v", err)
+		}
+		log.Printf("FIPS mode")
+	}
+}
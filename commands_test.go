@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	defer func(m int64, v, e bool) { *maxRun, *versionOnly, *expConfig = m, v, e }(*maxRun, *versionOnly, *expConfig)
+	defer func(c []string) { *configFiles = c }(*configFiles)
+
+	tests := []struct {
+		name    string
+		args    []string
+		command string
+		rest    []string
+		err     bool
+	}{
+		{name: "run without command", args: []string{"--max-run", "5"}, command: "run"},
+		{name: "nothing", args: []string{}, command: "run"},
+		{name: "run", args: []string{"run", "--max-run", "5"}, command: "run"},
+		{name: "config args", args: []string{"config", "encrypt", "r1.json", "--master-key-file", "key"}, command: "config", rest: []string{"encrypt", "r1.json"}},
+		{name: "help args", args: []string{"help", "bench"}, command: "help", rest: []string{"bench"}},
+		{name: "command after the flags", args: []string{"--max-run", "5", "bench"}, command: "bench", rest: []string{}},
+		{name: "version flag", args: []string{"--version"}, command: "version"},
+		{name: "unknown", args: []string{"bogus"}, err: true},
+		{name: "unknown after the flags", args: []string{"--max-run", "5", "bogus"}, err: true},
+		{name: "flag of another command", args: []string{"bench", "--admin-port", "9000"}, err: true},
+		{name: "flag of run", args: []string{"validate", "--max-run", "5"}, err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			*versionOnly = false
+			c, rest, err := parseCommand(test.args)
+			if test.err {
+				if err == nil {
+					t.Errorf("no error, got %s", c.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.name != test.command {
+				t.Errorf("got command %s, want %s", c.name, test.command)
+			}
+			if len(rest) != 0 || len(test.rest) != 0 {
+				if !reflect.DeepEqual(rest, test.rest) {
+					t.Errorf("got args %v, want %v", rest, test.rest)
+				}
+			}
+		})
+	}
+	if *maxRun != 5 {
+		t.Errorf("max-run %d", *maxRun)
+	}
+}
+
+func TestCommandFlags(t *testing.T) {
+	tests := []struct {
+		command string
+		has     []string
+		hasNot  []string
+	}{
+		{command: "run", has: []string{"config", "admin-port", "generate-test-data", "log-level"}, hasNot: []string{"bench-rate", "dashboards-dir", "version", "explore-config"}},
+		{command: "record", has: []string{"config", "max-run", "print"}, hasNot: []string{"generate-test-data", "consume-test-data", "bench-rate"}},
+		{command: "replay", has: []string{"config", "print", "master-key-file"}, hasNot: []string{"admin-port", "max-run"}},
+		{command: "validate", has: []string{"config", "config-file-list", "fips", "spiffe-socket", "log-format"}, hasNot: []string{"print", "admin-port"}},
+		{command: "bench", has: []string{"bench-rate", "bench-duration", "pprof", "config"}, hasNot: []string{"admin-port", "dashboards-dir"}},
+		{command: "dashboards", has: []string{"dashboards-dir", "config"}, hasNot: []string{"bench-rate"}},
+		{command: "version", hasNot: []string{"config", "log-level"}},
+	}
+	for _, test := range tests {
+		t.Run(test.command, func(t *testing.T) {
+			fs := findCommand(test.command).flagSet()
+			for _, name := range test.has {
+				if fs.Lookup(name) == nil {
+					t.Errorf("no flag %s", name)
+				}
+			}
+			for _, name := range test.hasNot {
+				if fs.Lookup(name) != nil {
+					t.Errorf("flag %s", name)
+				}
+			}
+		})
+	}
+}
@@ -5,7 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
 	"os"
 	"os/exec"
@@ -19,28 +19,78 @@ type ConfigFileList struct {
 
 // Config struct
 type Config struct {
-	Port            int           `json:"port"`
-	Host            string        `json:"host"`
-	User            string        `json:"user"`
-	Password        string        `json:"password"`
-	CID             string        `json:"cid"`
-	Meta            bool          `json:"meta"`
-	EOS             bool          `json:"eos"`
-	GRPC            GRPCConfig    `json:"grpc"`
-	TLS             TLSConfig     `json:"tls"`
-	Influx          InfluxConfig  `json:"influx"`
-	Paths           []PathsConfig `json:"paths"`
-	Log             LogConfig     `json:"log"`
-	Vendor          VendorConfig  `json:"vendor"`
-	Alias           string        `json:"alias"`
-	PasswordDecoder string        `json:"password-decoder"`
+	Port            int                   `json:"port"`
+	Host            string                `json:"host"`
+	Addresses       []string              `json:"addresses,omitempty"`
+	User            string                `json:"user"`
+	Password        string                `json:"password"`
+	CID             string                `json:"cid"`
+	Meta            bool                  `json:"meta"`
+	Auth            string                `json:"auth"`
+	Bearer          BearerConfig          `json:"bearer"`
+	EOS             bool                  `json:"eos"`
+	GRPC            GRPCConfig            `json:"grpc"`
+	TLS             TLSConfig             `json:"tls"`
+	Influx          InfluxConfig          `json:"influx"`
+	Paths           []PathsConfig         `json:"paths"`
+	PathSets        []string              `json:"path-sets,omitempty"`
+	Log             LogConfig             `json:"log"`
+	Vendor          VendorConfig          `json:"vendor"`
+	Groups          []string              `json:"groups"`
+	Alias           string                `json:"alias"`
+	PasswordDecoder string                `json:"password-decoder"`
+	AMQP            AMQPConfig            `json:"amqp"`
+	Redis           RedisConfig           `json:"redis"`
+	PubSub          PubSubConfig          `json:"pubsub"`
+	Kinesis         KinesisConfig         `json:"kinesis"`
+	Timestream      TimestreamConfig      `json:"timestream"`
+	EventHubs       EventHubsConfig       `json:"eventhubs"`
+	Splunk          SplunkConfig          `json:"splunk"`
+	VictoriaMetrics VictoriaMetricsConfig `json:"victoriametrics"`
+	Loki            LokiConfig            `json:"loki"`
+	SNMPTrap        SNMPTrapConfig        `json:"snmp-trap"`
+	Syslog          SyslogConfig          `json:"syslog"`
+	Transform       TransformConfig       `json:"transform"`
+	Alert           AlertConfig           `json:"alert"`
+	Timestamp       TimestampConfig       `json:"timestamp"`
+	Pipeline        PipelineConfig        `json:"pipeline"`
+	Backpressure    BackpressureConfig    `json:"backpressure"`
+	Spool           SpoolConfig           `json:"spool"`
+	CSVStats        CSVStatsConfig        `json:"csv-stats"`
+	Stale           StaleConfig           `json:"stale"`
+	Facts           FactsConfig           `json:"facts"`
+	Routes          []RouteConfig         `json:"routes"`
+	RTT             RTTConfig             `json:"rtt"`
 }
 
 // VendorConfig definition
 type VendorConfig struct {
-	Name     string         `json:"name"`
-	RemoveNS bool           `json:"remove-namespace"`
-	Schema   []VendorSchema `json:"schema"`
+	Name       string            `json:"name"`
+	RemoveNS   bool              `json:"remove-namespace"`
+	Namespaces []VendorNamespace `json:"namespaces"`
+	Decoders   []VendorDecoder   `json:"decoders"`
+	Schema     []VendorSchema    `json:"schema"`
+	// StreamDecode is the size in bytes from which messages are decoded
+	// one row at a time, 0 disables it
+	StreamDecode int `json:"stream-decode"`
+}
+
+// VendorNamespace overrides remove-namespace for the encoding paths matching
+// path (regex). With remove namespaces are dropped, map renames modules
+// (empty name drops the namespace of that module).
+type VendorNamespace struct {
+	Path   string            `json:"path"`
+	Remove bool              `json:"remove"`
+	Map    map[string]string `json:"map"`
+}
+
+// VendorDecoder decodes the bytes values of the paths matching path (regex)
+// with the compiled-in decoder name or the decoder of the Go plugin file
+// plugin
+type VendorDecoder struct {
+	Path   string `json:"path"`
+	Name   string `json:"name"`
+	Plugin string `json:"plugin"`
 }
 
 // VendorSchema definition
@@ -48,13 +98,26 @@ type VendorSchema struct {
 	Path string `json:"path"`
 }
 
-//LogConfig is config struct for logging
+// LogConfig is config struct for logging
 type LogConfig struct {
 	File          string `json:"file"`
 	PeriodicStats int    `json:"periodic-stats"`
 	Verbose       bool   `json:"verbose"`
-	out           *os.File
-	logger        *log.Logger
+	// Level is the log level of the worker (debug, info, warn or error),
+	// --log-level if not set. Verbose is the same as debug.
+	Level string `json:"level"`
+	// RotateSize rotates the file once it reaches this size in MB and
+	// RotateAge once it is older than this many hours, the rotated files
+	// are compressed (gzip by default) and RotateKeep of them are kept
+	RotateSize  int    `json:"rotate-size"`
+	RotateAge   int    `json:"rotate-age"`
+	RotateKeep  int    `json:"rotate-keep"`
+	Compression string `json:"compression"`
+	// Dedup collapses a warning or error repeated within this many seconds
+	// into one line with the number of repeats, 0 logs every repeat
+	Dedup  int `json:"dedup"`
+	out    io.WriteCloser
+	logger *log.Logger
 }
 
 // APIConfig is config struct for API Server
@@ -62,24 +125,38 @@ type APIConfig struct {
 	Port int `json:"port"`
 }
 
-//GRPCConfig is to specify GRPC params
+// GRPCConfig is to specify GRPC params
 type GRPCConfig struct {
-	WS int32 `json:"ws"`
+	WS      int32 `json:"ws"`
+	WSAuto  bool  `json:"ws-auto"`
+	Streams int   `json:"streams"`
 }
 
 // TLSConfig is to specify TLS params
 type TLSConfig struct {
-	ClientCrt  string `json:"clientcrt"`
-	ClientKey  string `json:"clientkey"`
-	CA         string `json:"ca"`
-	ServerName string `json:"servername"`
+	ClientCrt    string   `json:"clientcrt"`
+	ClientKey    string   `json:"clientkey"`
+	CA           string   `json:"ca"`
+	ServerName   string   `json:"servername"`
+	MinVersion   string   `json:"min-version"`
+	CipherSuites []string `json:"cipher-suites"`
+	Curves       []string `json:"curves"`
+	SkipVerify   bool     `json:"skip-verify"`
+	SPIFFE       bool     `json:"spiffe"`
+	Signer       []string `json:"signer"`
+	CRL          []string `json:"crl"`
+	OCSP         bool     `json:"ocsp"`
+	// RevocationSoftFail accepts the devices whose revocation can not be
+	// checked, the revoked ones are still refused
+	RevocationSoftFail bool `json:"revocation-soft-fail"`
 }
 
 // PathsConfig to specify subscription path, reporting-interval (freq), etc,.
 type PathsConfig struct {
-	Path string `json:"path"`
-	Freq uint64 `json:"freq"`
-	Mode string `json:"mode"`
+	Path     string `json:"path"`
+	Freq     uint64 `json:"freq"`
+	Mode     string `json:"mode"`
+	Priority int    `json:"priority"`
 }
 
 // NewJTIMONConfigFilelist to return configfilelist object
@@ -113,13 +190,22 @@ func fillupDefaults(config *Config) {
 	if config.Influx.AccumulatorFrequency == 0 {
 		config.Influx.AccumulatorFrequency = DefaultIDBAccumulatorFreq
 	}
+	if config.Influx.Precision == "" {
+		config.Influx.Precision = DefaultIDBPrecision
+	}
+	if config.Influx.QueueSize == 0 {
+		config.Influx.QueueSize = DefaultIDBQueueSize
+	}
+	if config.Influx.RetryInterval == 0 {
+		config.Influx.RetryInterval = DefaultIDBRetryInterval
+	}
 }
 
 // ParseJSONConfigFileList parses file list config
 func ParseJSONConfigFileList(file string) (ConfigFileList, error) {
 	var configfilelist ConfigFileList
 
-	f, err := ioutil.ReadFile(file)
+	f, err := readConfigFile(file)
 	if err != nil {
 		return configfilelist, err
 	}
@@ -135,13 +221,19 @@ func ParseJSONConfigFileList(file string) (ConfigFileList, error) {
 func ParseJSON(file string) (Config, error) {
 	var config Config
 
-	f, err := ioutil.ReadFile(file)
+	f, err := readConfigFile(file)
 	if err != nil {
 		return config, err
 	}
 	if err := json.Unmarshal(f, &config); err != nil {
 		return config, err
 	}
+	if err := expandPathSets(&config); err != nil {
+		return config, err
+	}
+	if config.CID == "" {
+		config.CID = defaultCID(config)
+	}
 
 	fillupDefaults(&config)
 
@@ -152,8 +244,94 @@ func ParseJSON(file string) (Config, error) {
 	return config, nil
 }
 
+// ValidateConfigFile parses and validates the config file as ParseJSON,
+// returning the error of an invalid config instead of exiting
+func ValidateConfigFile(file string) error {
+	f, err := readConfigFile(file)
+	if err != nil {
+		return err
+	}
+	return validateConfigJSON(f)
+}
+
+// validateConfigJSON parses and validates the JSON of a config as ParseJSON
+func validateConfigJSON(f []byte) error {
+	var config Config
+	if err := json.Unmarshal(f, &config); err != nil {
+		return err
+	}
+	if err := expandPathSets(&config); err != nil {
+		return err
+	}
+	fillupDefaults(&config)
+	_, err := ValidateConfig(config)
+	return err
+}
+
 // ValidateConfig for config validation
 func ValidateConfig(config Config) (string, error) {
+	if err := validateInfluxConfig(config.Influx); err != nil {
+		return "", err
+	}
+	if err := validateTimestampConfig(config.Timestamp); err != nil {
+		return "", err
+	}
+	if err := validateLogConfig(config.Log); err != nil {
+		return "", err
+	}
+	if err := validateBackpressureConfig(config.Backpressure); err != nil {
+		return "", err
+	}
+	if err := validateSpoolConfig(config.Spool); err != nil {
+		return "", err
+	}
+	if err := validateAdaptiveConfig(config.Backpressure.Adaptive, config.Vendor.Name); err != nil {
+		return "", err
+	}
+	if err := validateCSVStatsConfig(config.CSVStats); err != nil {
+		return "", err
+	}
+	if err := validateStaleConfig(config.Stale); err != nil {
+		return "", err
+	}
+	if err := validateFactsConfig(config.Facts, config.Vendor.Name); err != nil {
+		return "", err
+	}
+	if err := validateDecoders(config.Vendor.Decoders); err != nil {
+		return "", err
+	}
+	if err := validateRoutes(config.Routes, config.Vendor.Name); err != nil {
+		return "", err
+	}
+	if err := validateRTTConfig(config.RTT); err != nil {
+		return "", err
+	}
+	if err := validateGroups(config.Groups); err != nil {
+		return "", err
+	}
+	if err := validateAddresses(config); err != nil {
+		return "", err
+	}
+	if err := validateTLSConfig(config.TLS); err != nil {
+		return "", err
+	}
+	if err := validateAuth(config); err != nil {
+		return "", err
+	}
+	if err := validateBearerConfig(config); err != nil {
+		return "", err
+	}
+	if config.GRPC.Streams < 0 {
+		return "", fmt.Errorf("grpc streams can not be negative")
+	}
+	for _, p := range config.Paths {
+		if p.Priority < 0 {
+			return "", fmt.Errorf("priority of path %s can not be negative", p.Path)
+		}
+	}
+	if _, err := newNamespaceRules(config.Vendor); err != nil {
+		return "", err
+	}
 	b, err := json.MarshalIndent(config, "", "    ")
 	if err != nil {
 		return "", err
@@ -175,9 +353,10 @@ func ExploreConfig() (string, error) {
 	return "", errors.New("something is wrong, this should have not happened")
 }
 
-// IsVerboseLogging returns true if verbose logging is enabled, false otherwise
+// IsVerboseLogging returns true if the worker logs at debug level, false
+// otherwise
 func IsVerboseLogging(jctx *JCtx) bool {
-	return jctx.config.Log.Verbose
+	return workerLogLevel(jctx) == LogLevelDebug
 }
 
 // GetConfigFiles to get the list of config files
@@ -219,6 +398,13 @@ func DecodePassword(jctx *JCtx, config Config) (string, error) {
 		}
 		password = outStr
 	}
+	if password == "" && config.User != "" {
+		value, err := missingPassword(config)
+		if err != nil {
+			return "", err
+		}
+		password = value
+	}
 	return password, nil
 }
 
@@ -238,11 +424,69 @@ func HandleConfigChange(jctx *JCtx, config Config, restart *bool) error {
 		if !reflect.DeepEqual(jctx.config.Influx, config.Influx) {
 			return fmt.Errorf("HandleConfigChange : Influxdb config changes are not allowed")
 		}
+		if !reflect.DeepEqual(jctx.config.Transform, config.Transform) {
+			return fmt.Errorf("HandleConfigChange : Transform config changes are not allowed")
+		}
+		if !reflect.DeepEqual(jctx.config.AMQP, config.AMQP) {
+			return fmt.Errorf("HandleConfigChange : AMQP config changes are not allowed")
+		}
+		if !reflect.DeepEqual(jctx.config.Redis, config.Redis) {
+			return fmt.Errorf("HandleConfigChange : Redis config changes are not allowed")
+		}
+		if !reflect.DeepEqual(jctx.config.PubSub, config.PubSub) {
+			return fmt.Errorf("HandleConfigChange : Pub/Sub config changes are not allowed")
+		}
+		if !reflect.DeepEqual(jctx.config.Kinesis, config.Kinesis) ||
+			!reflect.DeepEqual(jctx.config.Timestream, config.Timestream) {
+			return fmt.Errorf("HandleConfigChange : AWS config changes are not allowed")
+		}
+		if !reflect.DeepEqual(jctx.config.EventHubs, config.EventHubs) {
+			return fmt.Errorf("HandleConfigChange : Event Hubs config changes are not allowed")
+		}
+		if !reflect.DeepEqual(jctx.config.Splunk, config.Splunk) {
+			return fmt.Errorf("HandleConfigChange : Splunk config changes are not allowed")
+		}
+		if !reflect.DeepEqual(jctx.config.VictoriaMetrics, config.VictoriaMetrics) {
+			return fmt.Errorf("HandleConfigChange : VictoriaMetrics config changes are not allowed")
+		}
+		if !reflect.DeepEqual(jctx.config.Loki, config.Loki) {
+			return fmt.Errorf("HandleConfigChange : Loki config changes are not allowed")
+		}
+		if !reflect.DeepEqual(jctx.config.SNMPTrap, config.SNMPTrap) {
+			return fmt.Errorf("HandleConfigChange : SNMP trap config changes are not allowed")
+		}
+		if !reflect.DeepEqual(jctx.config.Syslog, config.Syslog) {
+			return fmt.Errorf("HandleConfigChange : Syslog config changes are not allowed")
+		}
+		if !reflect.DeepEqual(jctx.config.Alert, config.Alert) {
+			return fmt.Errorf("HandleConfigChange : Alert config changes are not allowed")
+		}
+		if jctx.config.Pipeline != config.Pipeline {
+			return fmt.Errorf("HandleConfigChange : Pipeline config changes are not allowed")
+		}
+		if jctx.config.Backpressure != config.Backpressure {
+			return fmt.Errorf("HandleConfigChange : Backpressure config changes are not allowed")
+		}
+		if jctx.config.Spool != config.Spool {
+			return fmt.Errorf("HandleConfigChange : Spool config changes are not allowed")
+		}
+		if !reflect.DeepEqual(jctx.config.CSVStats, config.CSVStats) {
+			return fmt.Errorf("HandleConfigChange : CSVStats config changes are not allowed")
+		}
+		if !reflect.DeepEqual(jctx.config.Stale, config.Stale) {
+			return fmt.Errorf("HandleConfigChange : Stale config changes are not allowed")
+		}
+		if !reflect.DeepEqual(jctx.config.Routes, config.Routes) {
+			return fmt.Errorf("HandleConfigChange : Routes config changes are not allowed")
+		}
+		if !reflect.DeepEqual(jctx.config.RTT, config.RTT) {
+			return fmt.Errorf("HandleConfigChange : RTT config changes are not allowed")
+		}
 		// In case if there is a change only in Log. stop the log and start it again.
 		// No need to disturb the subscription.
 		if jctx.config.Log != config.Log {
 			if IsVerboseLogging(jctx) {
-				jLog(jctx, fmt.Sprintf("Log config has been updated"))
+				jLogDebug(jctx, fmt.Sprintf("Log config has been updated"))
 			}
 			logStop(jctx)
 			jctx.config.Log = config.Log
@@ -251,6 +495,7 @@ func HandleConfigChange(jctx *JCtx, config Config, restart *bool) error {
 		// Check if any change in config post the log updation changes
 		if !reflect.DeepEqual(jctx.config, config) {
 			jctx.config = config
+			jctx.paths = newPathTrie(config.Paths)
 			if restart != nil {
 				jLog(jctx, fmt.Sprintf("Restarting worker process to spawn new device connection"))
 				*restart = true
@@ -267,11 +512,18 @@ func ConfigRead(jctx *JCtx, init bool, restart *bool) error {
 	config, err := NewJTIMONConfig(jctx.file)
 	if err != nil {
 		log.Printf("config parsing error for %s: %v", jctx.file, err)
+		if !init {
+			recordEvent(jctx, EventError, "", fmt.Sprintf("config reload failed: %v", err))
+			auditReload(jctx, jctx.config, err)
+		}
 		return fmt.Errorf("config parsing (json unmarshal) error for %s: %v", jctx.file, err)
 	}
+	// the paths set over the API are kept over reloads
+	config.Paths = jctx.pathsSet.apply(config.Paths)
 
 	if init {
 		jctx.config = config
+		jctx.paths = newPathTrie(config.Paths)
 		logInit(jctx)
 		b, err := json.MarshalIndent(jctx.config, "", "    ")
 		if err != nil {
@@ -289,13 +541,34 @@ func ConfigRead(jctx *JCtx, init bool, restart *bool) error {
 		// data know about certain events like sighup.
 		jctx.control = make(chan os.Signal)
 
-		go periodicStats(jctx)
+		periodicStats(jctx)
+		if err := transformsInit(jctx); err != nil {
+			return err
+		}
+		if err := decodersInit(jctx); err != nil {
+			return err
+		}
 		influxInit(jctx)
+		sinksInit(jctx)
+		routesInit(jctx)
+		pipelineInit(jctx)
+		dropsInit(jctx)
+		adaptiveInit(jctx)
+		selfInit(jctx)
+		rttInit(jctx)
+		csvStatsInit(jctx)
+		staleInit(jctx)
+		certWatchInit(jctx)
+		registerPathPriorities(&jctx.config)
 	} else {
+		old := jctx.config
 		err := HandleConfigChange(jctx, config, restart)
+		auditReload(jctx, old, err)
 		if err != nil {
+			recordEvent(jctx, EventError, "", fmt.Sprintf("config reload failed: %v", err))
 			return err
 		}
+		recordEvent(jctx, EventReload, "", jctx.file)
 	}
 	return nil
 }
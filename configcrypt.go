@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// encryptedPrefix starts the config files encrypted with the master key, the
+// rest is the base64 of the nonce and the AES-256-GCM ciphertext
+const encryptedPrefix = "jtimon-encrypted:v1:"
+
+// masterKeyCache is the master key, read once
+var masterKeyCache struct {
+	sync.Mutex
+	key []byte
+}
+
+// masterKey returns the key of the encrypted config files, the base64 of 32
+// bytes in --master-key-file or JTIMON_MASTER_KEY, or the base64 of the key
+// encrypted with AWS KMS in JTIMON_MASTER_KEY_KMS
+func masterKey() ([]byte, error) {
+	masterKeyCache.Lock()
+	defer masterKeyCache.Unlock()
+	if masterKeyCache.key != nil {
+		return masterKeyCache.key, nil
+	}
+
+	var key []byte
+	var err error
+	switch {
+	case *masterKeyFile != "":
+		var b []byte
+		if b, err = ioutil.ReadFile(*masterKeyFile); err == nil {
+			key, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+		}
+	case os.Getenv("JTIMON_MASTER_KEY") != "":
+		key, err = base64.StdEncoding.DecodeString(os.Getenv("JTIMON_MASTER_KEY"))
+	case os.Getenv("JTIMON_MASTER_KEY_KMS") != "":
+		key, err = kmsDecrypt(os.Getenv("JTIMON_MASTER_KEY_KMS"))
+	default:
+		return nil, fmt.Errorf("no master key, set --master-key-file, JTIMON_MASTER_KEY or JTIMON_MASTER_KEY_KMS")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can not read the master key: %v", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("the master key has %d bytes, want 32", len(key))
+	}
+	masterKeyCache.key = key
+	return key, nil
+}
+
+// kmsDecrypt decrypts the base64 ciphertext blob with AWS KMS, with the
+// credentials and region of the environment. AWS_ENDPOINT_URL_KMS replaces
+// the endpoint of the region.
+func kmsDecrypt(blob string) ([]byte, error) {
+	auth, err := AWSAuth{}.credentials()
+	if err != nil {
+		return nil, err
+	}
+	url := os.Getenv("AWS_ENDPOINT_URL_KMS")
+	if url == "" {
+		url = fmt.Sprintf("https://kms.%s.amazonaws.com/", auth.Region)
+	}
+	var out struct {
+		Plaintext string
+	}
+	client := &http.Client{Timeout: time.Duration(DefaultIDBTimeout) * time.Second}
+	if err := awsJSONCall(client, url, auth, "kms", "TrentService.Decrypt", "application/x-amz-json-1.1",
+		map[string]string{"CiphertextBlob": blob}, &out); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(out.Plaintext)
+}
+
+// isEncrypted tells whether the content of a config file is encrypted
+func isEncrypted(b []byte) bool {
+	return bytes.HasPrefix(b, []byte(encryptedPrefix))
+}
+
+func encryptConfig(key, plain []byte) ([]byte, error) {
+	gcm, err := newConfigCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	sealed := gcm.Seal(nonce, nonce, plain, nil)
+	return []byte(encryptedPrefix + base64.StdEncoding.EncodeToString(sealed) + "\n"), nil
+}
+
+func decryptConfig(key, b []byte) ([]byte, error) {
+	gcm, err := newConfigCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b[len(encryptedPrefix):])))
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("encrypted config is truncated")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("can not decrypt the config, wrong master key or corrupted file")
+	}
+	return plain, nil
+}
+
+func newConfigCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// readConfigFile reads a config file, decrypted if it is encrypted
+func readConfigFile(file string) ([]byte, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil || !isEncrypted(b) {
+		return b, err
+	}
+	key, err := masterKey()
+	if err != nil {
+		return nil, err
+	}
+	return decryptConfig(key, b)
+}
+
+// replaceFile writes b to file at once, so that a reload never reads half
+// of it, the mode of the file is kept
+func replaceFile(file string, b []byte) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// cryptConfigFile encrypts or decrypts the config file in place, files
+// which already are are left as they are
+func cryptConfigFile(file string, encrypt bool) (bool, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return false, err
+	}
+	if isEncrypted(b) == encrypt {
+		return false, nil
+	}
+	key, err := masterKey()
+	if err != nil {
+		return false, err
+	}
+	if encrypt {
+		b, err = encryptConfig(key, b)
+	} else {
+		b, err = decryptConfig(key, b)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, replaceFile(file, b)
+}
+
+// configMain runs "jtimon config encrypt|decrypt file...", the files are
+// the arguments or the ones of --config
+func configMain(args []string) {
+	if len(args) == 0 || (args[0] != "encrypt" && args[0] != "decrypt") {
+		log.Printf("usage: jtimon config encrypt|decrypt [file...]")
+		return
+	}
+	files := args[1:]
+	if len(files) == 0 {
+		files = *configFiles
+	}
+	if len(files) == 0 {
+		log.Printf("jtimon config %s needs config files", args[0])
+		return
+	}
+	encrypt := args[0] == "encrypt"
+	for _, file := range files {
+		changed, err := cryptConfigFile(file, encrypt)
+		switch {
+		case err != nil:
+			log.Printf("%s: %v", file, err)
+		case changed:
+			log.Printf("%s: %sed", file, args[0])
+		default:
+			log.Printf("%s: already %sed", file, args[0])
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testMasterKey makes key the master key until the returned func is called
+func testMasterKey(key []byte) func() {
+	masterKeyCache.Lock()
+	masterKeyCache.key = key
+	masterKeyCache.Unlock()
+	return func() {
+		masterKeyCache.Lock()
+		masterKeyCache.key = nil
+		masterKeyCache.Unlock()
+	}
+}
+
+func TestConfigEncryption(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-configcrypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "r1.json")
+	plain := `{"host": "127.0.0.1", "port": 50051, "user": "jtimon", "password": "secret", "paths": [{"path": "/interfaces", "freq": 2000}]}`
+	if err := ioutil.WriteFile(file, []byte(plain), 0600); err != nil {
+		t.Fatal(err)
+	}
+	key := []byte(strings.Repeat("k", 32))
+	defer testMasterKey(key)()
+
+	if changed, err := cryptConfigFile(file, true); !changed || err != nil {
+		t.Fatalf("encrypt: %v %v", changed, err)
+	}
+	b, _ := ioutil.ReadFile(file)
+	if !isEncrypted(b) || strings.Contains(string(b), "secret") {
+		t.Fatalf("not encrypted: %s", b)
+	}
+	if info, _ := os.Stat(file); info.Mode().Perm() != 0600 {
+		t.Errorf("mode %v", info.Mode())
+	}
+	if changed, err := cryptConfigFile(file, true); changed || err != nil {
+		t.Errorf("encrypted twice: %v %v", changed, err)
+	}
+
+	// loaded transparently
+	cfg, err := ParseJSON(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != "127.0.0.1" || cfg.Password != "secret" || len(cfg.Paths) != 1 {
+		t.Errorf("got %+v", cfg)
+	}
+
+	// the paths changed over the API are written back encrypted
+	if err := persistPaths(file, []PathsConfig{{Path: "/bgp", Freq: 5000}}); err != nil {
+		t.Fatal(err)
+	}
+	b, _ = ioutil.ReadFile(file)
+	if !isEncrypted(b) {
+		t.Fatalf("persistPaths decrypted the config: %s", b)
+	}
+	if cfg, err = ParseJSON(file); err != nil || len(cfg.Paths) != 1 || cfg.Paths[0].Path != "/bgp" {
+		t.Errorf("got %+v %v", cfg.Paths, err)
+	}
+
+	// a wrong key
+	testMasterKey([]byte(strings.Repeat("x", 32)))
+	if _, err := ParseJSON(file); err == nil || !strings.Contains(err.Error(), "wrong master key") {
+		t.Errorf("wrong key: %v", err)
+	}
+	testMasterKey(key)
+
+	if changed, err := cryptConfigFile(file, false); !changed || err != nil {
+		t.Fatalf("decrypt: %v %v", changed, err)
+	}
+	b, _ = ioutil.ReadFile(file)
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil || m["password"] != "secret" {
+		t.Errorf("decrypted to %s: %v", b, err)
+	}
+}
+
+func TestMasterKey(t *testing.T) {
+	key := []byte(strings.Repeat("m", 32))
+	encoded := base64.StdEncoding.EncodeToString(key)
+
+	kms := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in map[string]string
+		json.NewDecoder(r.Body).Decode(&in)
+		if r.Header.Get("X-Amz-Target") != "TrentService.Decrypt" || in["CiphertextBlob"] != "YmxvYg==" ||
+			!strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"Plaintext": encoded})
+	}))
+	defer kms.Close()
+
+	dir, err := ioutil.TempDir("", "jtimon-masterkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "master.key")
+	ioutil.WriteFile(keyFile, []byte(encoded+"\n"), 0600)
+
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		err  bool
+	}{
+		{name: "none", err: true},
+		{name: "file", file: keyFile},
+		{name: "env", env: map[string]string{"JTIMON_MASTER_KEY": encoded}},
+		{name: "short", env: map[string]string{"JTIMON_MASTER_KEY": "c2hvcnQ="}, err: true},
+		{name: "kms", env: map[string]string{
+			"JTIMON_MASTER_KEY_KMS": "YmxvYg==", "AWS_ENDPOINT_URL_KMS": kms.URL, "AWS_REGION": "us-east-1",
+			"AWS_ACCESS_KEY_ID": "AKID", "AWS_SECRET_ACCESS_KEY": "secret",
+		}},
+		{name: "kms error", env: map[string]string{
+			"JTIMON_MASTER_KEY_KMS": "b3RoZXI=", "AWS_ENDPOINT_URL_KMS": kms.URL, "AWS_REGION": "us-east-1",
+			"AWS_ACCESS_KEY_ID": "AKID", "AWS_SECRET_ACCESS_KEY": "secret",
+		}, err: true},
+	}
+	vars := []string{"JTIMON_MASTER_KEY", "JTIMON_MASTER_KEY_KMS", "AWS_ENDPOINT_URL_KMS", "AWS_REGION", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN"}
+	for _, v := range vars {
+		if old, ok := os.LookupEnv(v); ok {
+			defer os.Setenv(v, old)
+		} else {
+			defer os.Unsetenv(v)
+		}
+	}
+	defer func(v string) { *masterKeyFile = v }(*masterKeyFile)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer testMasterKey(nil)()
+			for _, v := range vars {
+				os.Unsetenv(v)
+			}
+			for k, v := range test.env {
+				os.Setenv(k, v)
+			}
+			*masterKeyFile = test.file
+			got, err := masterKey()
+			if test.err {
+				if err == nil {
+					t.Errorf("no error")
+				}
+				return
+			}
+			if err != nil || string(got) != string(key) {
+				t.Errorf("got %q %v", got, err)
+			}
+		})
+	}
+}
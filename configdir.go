@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	configDirs     = flag.StringSlice("config-dir", nil, "Directories whose config files (*.json) are collected and watched, e.g. mounted ConfigMaps and Secrets: the workers are added, reloaded and deleted as the files change")
+	configDirIntvl = flag.Int("config-dir-interval", 5, "Interval in seconds of the checks of the files of --config-dir")
+)
+
+// configDir watches the config files of a directory. The files of the
+// ConfigMaps and Secrets mounted by Kubernetes are links into a ..data
+// directory which is replaced at once on an update, without SIGHUP nor
+// change of the links, so the contents of the files are compared.
+type configDir struct {
+	dir  string
+	sums map[string][sha256.Size]byte
+	// invalid are the contents of the files found invalid, they are
+	// checked again once they change
+	invalid map[string][sha256.Size]byte
+}
+
+func newConfigDir(dir string) *configDir {
+	return &configDir{dir: dir, sums: map[string][sha256.Size]byte{}, invalid: map[string][sha256.Size]byte{}}
+}
+
+func (c *configDir) name() string {
+	return c.dir
+}
+
+func (c *configDir) count() int {
+	return len(c.sums)
+}
+
+func (c *configDir) interval() time.Duration {
+	return time.Duration(*configDirIntvl) * time.Second
+}
+
+// sync compares the config files of the directory with the last ones. A
+// new or changed file which is not a valid config is logged and left out,
+// the worker of a changed one keeps its config.
+func (c *configDir) sync() (discoveryChange, error) {
+	var ch discoveryChange
+	entries, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return ch, err
+	}
+	sums := map[string][sha256.Size]byte{}
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		file := filepath.Join(c.dir, name)
+		b, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			// removed meanwhile
+			continue
+		}
+		if err != nil {
+			return ch, err
+		}
+		sum := sha256.Sum256(b)
+		old, ok := c.sums[file]
+		if ok && old == sum {
+			sums[file] = sum
+			continue
+		}
+		if bad, found := c.invalid[file]; !found || bad != sum {
+			if err := ValidateConfigFile(file); err != nil {
+				globalLog(LogLevelError, fmt.Sprintf("Discovery: %s: invalid config: %v", file, err))
+				c.invalid[file] = sum
+			} else {
+				delete(c.invalid, file)
+			}
+		}
+		if _, bad := c.invalid[file]; bad {
+			if ok {
+				sums[file] = old
+			}
+			continue
+		}
+		sums[file] = sum
+		if ok {
+			ch.changed = append(ch.changed, file)
+		} else {
+			ch.added = append(ch.added, file)
+		}
+	}
+	for file := range c.sums {
+		if _, ok := sums[file]; !ok {
+			ch.removed = append(ch.removed, file)
+		}
+	}
+	for file := range c.invalid {
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			delete(c.invalid, file)
+		}
+	}
+	c.sums = sums
+	sort.Strings(ch.added)
+	sort.Strings(ch.changed)
+	sort.Strings(ch.removed)
+	return ch, nil
+}
+
+// configDirsInit returns the watchers of the directories of --config-dir
+func configDirsInit() ([]configWatcher, error) {
+	if len(*configDirs) == 0 {
+		return nil, nil
+	}
+	if *configDirIntvl <= 0 {
+		return nil, fmt.Errorf("--config-dir-interval must be positive")
+	}
+	var watchers []configWatcher
+	for _, dir := range *configDirs {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("--config-dir %s is not a directory", dir)
+		}
+		watchers = append(watchers, newConfigDir(dir))
+	}
+	return watchers, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// mountConfigMap writes the files as Kubernetes updates a mounted
+// ConfigMap: into a new directory, to which ..data is switched at once
+func mountConfigMap(t *testing.T, dir, version string, files map[string]string) {
+	data := filepath.Join(dir, "..2026_10_15_"+version)
+	if err := os.Mkdir(data, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(data, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		link := filepath.Join(dir, name)
+		if _, err := os.Lstat(link); os.IsNotExist(err) {
+			if err := os.Symlink(filepath.Join("..data", name), link); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	tmp := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(filepath.Base(data), tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigDirSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-configdir-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	r1, r2, r3 := filepath.Join(dir, "r1.json"), filepath.Join(dir, "r2.json"), filepath.Join(dir, "r3.json")
+	config := `{"host": "10.0.0.1", "port": 32767, "paths": [{"path": "/interfaces"}]}`
+	invalid := `{"host": "10.0.0.1", "paths": [{"path": "/interfaces", "priority": -1}]}`
+
+	mountConfigMap(t, dir, "1", map[string]string{"r1.json": config, "r2.json": config, "README": "not a config"})
+	c := newConfigDir(dir)
+	if ch, err := c.sync(); err != nil || !reflect.DeepEqual(ch, discoveryChange{added: []string{r1, r2}}) {
+		t.Errorf("first sync() = %+v, %v", ch, err)
+	}
+	if ch, err := c.sync(); err != nil || !ch.empty() {
+		t.Errorf("sync() without change = %+v, %v", ch, err)
+	}
+
+	// r1 changes, r2 gets an invalid config, r3 is new and invalid
+	mountConfigMap(t, dir, "2", map[string]string{
+		"r1.json": `{"host": "10.0.0.9", "port": 32767, "paths": [{"path": "/interfaces"}]}`, "r2.json": invalid, "r3.json": invalid})
+	if ch, err := c.sync(); err != nil || !reflect.DeepEqual(ch, discoveryChange{changed: []string{r1}}) {
+		t.Errorf("sync() of a change and invalid configs = %+v, %v", ch, err)
+	}
+	if c.count() != 2 {
+		t.Errorf("%d config files, the invalid change of r2 was not kept out", c.count())
+	}
+
+	// r2 is removed from the ConfigMap, r3 is fixed
+	os.Remove(r2)
+	mountConfigMap(t, dir, "3", map[string]string{"r1.json": config, "r3.json": config})
+	if ch, err := c.sync(); err != nil || !reflect.DeepEqual(ch, discoveryChange{added: []string{r3}, changed: []string{r1}, removed: []string{r2}}) {
+		t.Errorf("sync() of a removal and a fix = %+v, %v", ch, err)
+	}
+
+	os.RemoveAll(dir)
+	if _, err := c.sync(); err == nil {
+		t.Errorf("sync() of a missing directory did not fail")
+	}
+}
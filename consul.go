@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// consulClient calls the HTTP API of a Consul agent, with the ACL token of
+// $CONSUL_HTTP_TOKEN if it is set
+type consulClient struct {
+	client *http.Client
+	// base is the URL of the agent, e.g. http://127.0.0.1:8500
+	base  string
+	token string
+}
+
+func newConsulClient(base string, timeout time.Duration) *consulClient {
+	return &consulClient{
+		client: &http.Client{Timeout: timeout},
+		base:   strings.TrimSuffix(base, "/"),
+		token:  os.Getenv("CONSUL_HTTP_TOKEN"),
+	}
+}
+
+// do calls the API with the JSON of in if it is not nil and decodes the
+// JSON answer into out if it is not nil. It returns the status code of the
+// answer, the error tells the other statuses than 200.
+func (c *consulClient) do(method, path string, in, out interface{}) (int, error) {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, c.base+path, body)
+	if err != nil {
+		return 0, err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("consul %s %s: %s: %s", method, strings.SplitN(path, "?", 2)[0], resp.Status, strings.TrimSpace(string(b)))
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("consul %s %s: %v", method, strings.SplitN(path, "?", 2)[0], err)
+		}
+	}
+	return resp.StatusCode, nil
+}
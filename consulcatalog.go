@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+var consulCatalog = flag.String("consul-catalog", "", "Consul service whose instances passing their health checks are discovered and collected with the config of --discovery-template: consul://host:port/service[?tag=tag&dc=dc], with the ACL token of $CONSUL_HTTP_TOKEN")
+
+// consulCatalogSource finds the instances of a service of the catalog of
+// Consul whose health checks pass
+type consulCatalogSource struct {
+	consul  *consulClient
+	service string
+	query   url.Values
+}
+
+func newConsulCatalogSource(catalog string) (*consulCatalogSource, error) {
+	u, err := url.Parse(catalog)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --consul-catalog %q: %v", catalog, err)
+	}
+	scheme := "http"
+	switch u.Scheme {
+	case "consul":
+	case "consul+https":
+		scheme = "https"
+	default:
+		return nil, fmt.Errorf("invalid --consul-catalog %q: not a consul:// or consul+https:// URL", catalog)
+	}
+	service := strings.Trim(u.Path, "/")
+	if u.Host == "" || service == "" || strings.Contains(service, "/") {
+		return nil, fmt.Errorf("invalid --consul-catalog %q: no host or service", catalog)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "8500")
+	}
+	query := u.Query()
+	query.Set("passing", "true")
+	return &consulCatalogSource{
+		consul:  newConsulClient(scheme+"://"+host, 30*time.Second),
+		service: service,
+		query:   query,
+	}, nil
+}
+
+func (c *consulCatalogSource) name() string {
+	return "consul"
+}
+
+// consulServiceEntry is an instance of /v1/health/service/{service}
+type consulServiceEntry struct {
+	Node struct {
+		Node       string
+		Address    string
+		Datacenter string
+		Meta       map[string]string
+	}
+	Service struct {
+		ID      string
+		Address string
+		Port    int
+		Tags    []string
+		Meta    map[string]string
+	}
+}
+
+// devices returns the instances of the service, a device per node. The
+// address is the one of the instance, or of its node, the metadata are the
+// ones of the node and of the instance, which wins, with the role and
+// platform in role and platform.
+func (c *consulCatalogSource) devices() ([]discoveredDevice, error) {
+	var entries []consulServiceEntry
+	if _, err := c.consul.do("GET", "/v1/health/service/"+url.PathEscape(c.service)+"?"+c.query.Encode(), nil, &entries); err != nil {
+		return nil, err
+	}
+	devices := []discoveredDevice{}
+	for _, e := range entries {
+		dev := discoveredDevice{
+			Name:    e.Node.Node,
+			Address: e.Service.Address,
+			Port:    e.Service.Port,
+			Site:    e.Node.Datacenter,
+			Tags:    append([]string{}, e.Service.Tags...),
+			Meta:    map[string]string{},
+		}
+		if dev.Address == "" {
+			dev.Address = e.Node.Address
+		}
+		for k, v := range e.Node.Meta {
+			dev.Meta[k] = v
+		}
+		for k, v := range e.Service.Meta {
+			dev.Meta[k] = v
+		}
+		dev.Role, dev.Platform = dev.Meta["role"], dev.Meta["platform"]
+		devices = append(devices, dev)
+	}
+	return devices, nil
+}
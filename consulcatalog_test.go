@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConsulCatalogDevices(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/v1/health/service/jti" || q.Get("passing") != "true" || q.Get("tag") != "core" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `[
+			{"Node": {"Node": "r1", "Address": "10.0.0.1", "Datacenter": "ams1", "Meta": {"platform": "junos", "rack": "a1"}},
+			 "Service": {"ID": "jti", "Address": "", "Port": 32767, "Tags": ["core"], "Meta": {"role": "core", "rack": "a2"}}},
+			{"Node": {"Node": "r2", "Address": "10.0.0.2", "Datacenter": "ams1"},
+			 "Service": {"ID": "jti", "Address": "192.0.2.2", "Port": 50051, "Tags": null}}]`)
+	}))
+	defer srv.Close()
+
+	c, err := newConsulCatalogSource("consul://" + strings.TrimPrefix(srv.URL, "http://") + "/jti?tag=core")
+	if err != nil {
+		t.Fatal(err)
+	}
+	devices, err := c.devices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []discoveredDevice{
+		{Name: "r1", Address: "10.0.0.1", Port: 32767, Site: "ams1", Role: "core", Platform: "junos", Tags: []string{"core"},
+			Meta: map[string]string{"platform": "junos", "rack": "a2", "role": "core"}},
+		{Name: "r2", Address: "192.0.2.2", Port: 50051, Site: "ams1", Tags: []string{}, Meta: map[string]string{}},
+	}
+	if !reflect.DeepEqual(devices, want) {
+		t.Errorf("devices() = %+v, want %+v", devices, want)
+	}
+
+	c.service = "other"
+	if _, err := c.devices(); err == nil {
+		t.Errorf("devices() of an unknown service did not fail")
+	}
+
+	for _, catalog := range []string{"consul://127.0.0.1:8500", "http://127.0.0.1:8500/jti", "consul:///jti", "consul://127.0.0.1/a/b"} {
+		if _, err := newConsulCatalogSource(catalog); err == nil {
+			t.Errorf("newConsulCatalogSource(%q) did not fail", catalog)
+		}
+	}
+	if c, err := newConsulCatalogSource("consul+https://consul.example.com/jti"); err != nil || c.consul.base != "https://consul.example.com:8500" {
+		t.Errorf("newConsulCatalogSource() of consul+https %+v, %v", c, err)
+	}
+}
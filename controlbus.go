@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"golang.org/x/net/context"
+)
+
+var controlBus = flag.String("control-bus", "", "NATS subject the reload, pause and resume commands of the fleet are received on: nats://[user:password@ or token@]host:port/subject, nats+tls:// for TLS")
+
+// controlBusTimeout is the timeout of the connection to the NATS server and
+// of the handshake
+const controlBusTimeout = 10 * time.Second
+
+// busCommand is a command of --control-bus. pause and resume apply to the
+// device or to the devices of the group, or both, and to the path if set.
+type busCommand struct {
+	Command string `json:"command"`
+	Device  string `json:"device,omitempty"`
+	Group   string `json:"group,omitempty"`
+	Path    string `json:"path,omitempty"`
+}
+
+// busReply is the reply of an instance to a command with a reply subject
+type busReply struct {
+	Instance string `json:"instance"`
+	Command  string `json:"command"`
+	Devices  int    `json:"devices"`
+	Error    string `json:"error,omitempty"`
+}
+
+// controlBusClient subscribes to the subject of the NATS server and runs
+// the commands it receives
+type controlBusClient struct {
+	u       *url.URL
+	subject string
+	id      string
+	// reload reloads the config as SIGHUP
+	reload func()
+	stop   chan struct{}
+	mu     sync.Mutex
+	conn   net.Conn
+}
+
+func newControlBusClient(bus, id string, reload func()) (*controlBusClient, error) {
+	u, err := url.Parse(bus)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --control-bus %q: %v", bus, err)
+	}
+	if u.Scheme != "nats" && u.Scheme != "nats+tls" {
+		return nil, fmt.Errorf("invalid --control-bus %q: not a nats:// or nats+tls:// URL", bus)
+	}
+	subject := strings.Trim(u.Path, "/")
+	if u.Host == "" || subject == "" || strings.ContainsAny(subject, " \t/") {
+		return nil, fmt.Errorf("invalid --control-bus %q: no host or subject", bus)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	return &controlBusClient{u: u, subject: subject, id: id, reload: reload, stop: make(chan struct{})}, nil
+}
+
+// controlBusInit receives the commands of --control-bus, it does nothing
+// without --control-bus
+func controlBusInit(reload func()) error {
+	if *controlBus == "" {
+		return nil
+	}
+	id := *clusterID
+	if id == "" {
+		id = *haID
+	}
+	c, err := newControlBusClient(*controlBus, instanceID(id), reload)
+	if err != nil {
+		return err
+	}
+	go c.run()
+	return nil
+}
+
+// run subscribes again after reconnectDelay when the connection is lost
+func (c *controlBusClient) run() {
+	failed := ""
+	for {
+		err := c.subscribe()
+		select {
+		case <-c.stop:
+			return
+		default:
+		}
+		if err.Error() != failed {
+			globalLog(LogLevelError, fmt.Sprintf("Control bus: %v, connecting again", err))
+			failed = err.Error()
+		}
+		select {
+		case <-c.stop:
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// close stops the client
+func (c *controlBusClient) close() {
+	close(c.stop)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+}
+
+// subscribe connects to the server and runs the commands of the subject
+// until the connection fails
+func (c *controlBusClient) subscribe() error {
+	conn, err := net.DialTimeout("tcp", c.u.Host, controlBusTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if c.u.Scheme == "nats+tls" {
+		conn = tls.Client(conn, &tls.Config{ServerName: c.u.Hostname()})
+	}
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+	r := bufio.NewReader(conn)
+
+	conn.SetDeadline(time.Now().Add(controlBusTimeout))
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("nats: unexpected greeting %q", strings.TrimSpace(line))
+	}
+	connect := map[string]interface{}{"verbose": false, "pedantic": false, "name": "jtimon " + c.id, "lang": "go",
+		"version": jtimonVersion, "protocol": 1}
+	if user := c.u.User; user != nil {
+		if pass, ok := user.Password(); ok {
+			connect["user"], connect["pass"] = user.Username(), pass
+		} else {
+			connect["auth_token"] = user.Username()
+		}
+	}
+	b, err := json.Marshal(connect)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nSUB %s 1\r\nPING\r\n", b, c.subject); err != nil {
+		return err
+	}
+	// the PONG of the PING tells the server took the CONNECT and SUB
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		if line == "PONG" {
+			break
+		}
+		if strings.HasPrefix(line, "-ERR") {
+			return fmt.Errorf("nats: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+	conn.SetDeadline(time.Time{})
+	globalLog(LogLevelInfo, fmt.Sprintf("Control bus: receiving the commands of %s on %s", c.subject, c.u.Host))
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "PING":
+			if _, err := io.WriteString(conn, "PONG\r\n"); err != nil {
+				return err
+			}
+		case "-ERR":
+			return fmt.Errorf("nats: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		case "MSG":
+			// MSG subject sid [reply] size
+			if len(fields) != 4 && len(fields) != 5 {
+				return fmt.Errorf("nats: invalid message %q", strings.TrimSpace(line))
+			}
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil || size < 0 {
+				return fmt.Errorf("nats: invalid message %q", strings.TrimSpace(line))
+			}
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return err
+			}
+			reply := c.handle(payload[:size])
+			if len(fields) == 5 {
+				b, _ := json.Marshal(reply)
+				if _, err := fmt.Fprintf(conn, "PUB %s %d\r\n%s\r\n", fields[3], len(b), b); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// handle runs the command of the message, it is audited as a change made
+// over the control endpoints
+func (c *controlBusClient) handle(msg []byte) busReply {
+	var cmd busCommand
+	err := json.Unmarshal(msg, &cmd)
+	reply := busReply{Instance: c.id, Command: cmd.Command}
+	ctx, changes := withAuditChanges(context.Background())
+	if err == nil {
+		reply.Devices, err = c.command(ctx, cmd)
+	}
+	if err != nil {
+		reply.Error = err.Error()
+		globalLog(LogLevelWarn, fmt.Sprintf("Control bus: %s failed: %v", strings.TrimSpace(string(msg)), err))
+	} else {
+		globalLog(LogLevelInfo, fmt.Sprintf("Control bus: %s of %d devices", cmd.Command, reply.Devices))
+	}
+	if apiAudit != nil {
+		rec := auditRecord{
+			Time:     time.Now().UTC(),
+			Client:   "control-bus " + c.u.Host,
+			Method:   "bus",
+			Endpoint: c.subject,
+			Body:     string(msg),
+			Status:   auditStatus(err),
+		}
+		changes.fill(&rec)
+		apiAudit.log(rec)
+	}
+	return reply
+}
+
+// command runs the command and returns the number of devices it applied to
+func (c *controlBusClient) command(ctx context.Context, cmd busCommand) (int, error) {
+	switch cmd.Command {
+	case "reload":
+		c.reload()
+		return len(deviceWorkers("")), nil
+	case "pause", "resume":
+		if cmd.Device == "" && cmd.Group == "" {
+			return 0, fmt.Errorf("device or group is missing")
+		}
+		if cmd.Group != "" {
+			ctx = withScope(ctx, apiScope{cmd.Group: true})
+		}
+		return len(pauseWorkers(ctx, cmd.Device, cmd.Path, cmd.Command == "pause")), nil
+	}
+	return 0, fmt.Errorf("unknown command %q", cmd.Command)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewControlBusClient(t *testing.T) {
+	c, err := newControlBusClient("nats://token@nats.example.com/jtimon.control", "c1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.u.Host != "nats.example.com:4222" || c.subject != "jtimon.control" {
+		t.Errorf("got host %s subject %s", c.u.Host, c.subject)
+	}
+	for _, bus := range []string{"kafka://k:9092/jtimon", "nats://nats.example.com", "nats:///jtimon.control"} {
+		if _, err := newControlBusClient(bus, "c1", nil); err == nil {
+			t.Errorf("%s: want an error", bus)
+		}
+	}
+}
+
+// fakeNATS accepts one client, checks its subscription and sends it msgs,
+// it returns the payloads of the replies
+func fakeNATS(t *testing.T, l net.Listener, msgs []string, replies chan<- string) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"fake\",\"max_payload\":1048576}\r\n")
+	var connect map[string]interface{}
+	for _, want := range []string{"CONNECT ", "SUB jtimon.control 1", "PING"} {
+		line, err := r.ReadString('\n')
+		if err != nil || !strings.HasPrefix(line, want) {
+			t.Errorf("got %q, want %s", line, want)
+			return
+		}
+		if want == "CONNECT " {
+			json.Unmarshal([]byte(strings.TrimPrefix(line, want)), &connect)
+		}
+	}
+	if connect["user"] != "jtimon" || connect["pass"] != "secret" {
+		t.Errorf("CONNECT %v: want the user and password of the URL", connect)
+	}
+	fmt.Fprintf(conn, "PONG\r\nPING\r\n")
+	if line, _ := r.ReadString('\n'); line != "PONG\r\n" {
+		t.Errorf("got %q, want PONG", line)
+	}
+	for i, m := range msgs {
+		fmt.Fprintf(conn, "MSG jtimon.control 1 _INBOX.%d %d\r\n%s\r\n", i, len(m), m)
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		var size int
+		if _, err := fmt.Sscanf(line, fmt.Sprintf("PUB _INBOX.%d %%d", i), &size); err != nil {
+			t.Errorf("got %q, want the reply of message %d", line, i)
+			return
+		}
+		b := make([]byte, size+2)
+		if _, err := r.Read(b); err != nil {
+			return
+		}
+		replies <- string(b[:size])
+	}
+	r.ReadString('\n')
+}
+
+func TestControlBus(t *testing.T) {
+	r1 := &JCtx{config: Config{Host: "r1", Port: 32767, Groups: []string{"core"}, Paths: []PathsConfig{{Path: "/interfaces/"}}}}
+	r2 := &JCtx{config: Config{Host: "r2", Port: 32767, Paths: []PathsConfig{{Path: "/interfaces/"}}}}
+	for _, jctx := range []*JCtx{r1, r2} {
+		jctx.control = make(chan os.Signal)
+		dropsInit(jctx)
+		defer dropsStop(jctx)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	msgs := []string{
+		`{"command": "pause", "group": "core"}`,
+		`{"command": "reload"}`,
+		`{"command": "resume"}`,
+		`{"command": "shutdown"}`,
+		`{"command": "resume", "device": "r1"}`,
+	}
+	replies := make(chan string, len(msgs))
+	go fakeNATS(t, l, msgs, replies)
+
+	reloads := 0
+	c, err := newControlBusClient("nats://jtimon:secret@"+l.Addr().String()+"/jtimon.control", "c1", func() { reloads++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	go c.run()
+	defer c.close()
+
+	want := []busReply{
+		{Instance: "c1", Command: "pause", Devices: 1},
+		{Instance: "c1", Command: "reload", Devices: 2},
+		{Instance: "c1", Command: "resume", Error: "device or group is missing"},
+		{Instance: "c1", Command: "shutdown", Error: `unknown command "shutdown"`},
+		{Instance: "c1", Command: "resume", Devices: 1},
+	}
+	for i, w := range want {
+		var got busReply
+		select {
+		case b := <-replies:
+			if err := json.Unmarshal([]byte(b), &got); err != nil {
+				t.Fatalf("reply %d %q: %v", i, b, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no reply to %s", msgs[i])
+		}
+		if got != w {
+			t.Errorf("%s: got %+v, want %+v", msgs[i], got, w)
+		}
+		if i == 0 && (!workerPause(r1).Paused || workerPause(r2).Paused) {
+			t.Errorf("pause of core: got r1 %+v, r2 %+v", workerPause(r1), workerPause(r2))
+		}
+	}
+	if reloads != 1 {
+		t.Errorf("got %d reloads, want 1", reloads)
+	}
+	if workerPause(r1).Paused {
+		t.Errorf("r1 still paused after resume")
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// CSVStatsConfig writes the stats of the worker as CSV rows to file every
+// interval seconds, one row for the device and with per-path one row per
+// subscription path. Columns selects and orders the columns, the file is
+// rotated like log files and every file starts with the header.
+type CSVStatsConfig struct {
+	File        string   `json:"file"`
+	Columns     []string `json:"columns"`
+	Interval    int      `json:"interval"`
+	PerPath     bool     `json:"per-path"`
+	RotateSize  int      `json:"rotate-size"`
+	RotateAge   int      `json:"rotate-age"`
+	RotateKeep  int      `json:"rotate-keep"`
+	Compression string   `json:"compression"`
+}
+
+// csvRow are the stats of one row, the columns of the device or of a path
+// only are empty in the other rows
+type csvRow struct {
+	now    time.Time
+	device string
+	path   string
+	jctx   *JCtx
+	pc     *pathCounters
+}
+
+// csvColumns are the columns of the csv stats by name
+var csvColumns = map[string]func(r csvRow) string{
+	"timestamp": func(r csvRow) string { return r.now.Format(time.RFC3339) },
+	"device":    func(r csvRow) string { return r.device },
+	"path":      func(r csvRow) string { return r.path },
+	"packets": func(r csvRow) string {
+		if r.pc != nil {
+			return fmt.Sprint(atomic.LoadUint64(&r.pc.packets))
+		}
+		return fmt.Sprint(atomic.LoadUint64(&r.jctx.metrics.packets))
+	},
+	"kv": func(r csvRow) string {
+		if r.pc != nil {
+			return fmt.Sprint(atomic.LoadUint64(&r.pc.kv))
+		}
+		return fmt.Sprint(atomic.LoadUint64(&r.jctx.stats.totalKV))
+	},
+	"bytes": func(r csvRow) string {
+		if r.pc != nil {
+			return fmt.Sprint(atomic.LoadUint64(&r.pc.bytes))
+		}
+		return fmt.Sprint(atomic.LoadUint64(&r.jctx.stats.totalInPayloadLength))
+	},
+	"bytes-wire": func(r csvRow) string {
+		if r.pc != nil {
+			return ""
+		}
+		return fmt.Sprint(atomic.LoadUint64(&r.jctx.stats.totalInPayloadWireLength))
+	},
+	"decode-errors": func(r csvRow) string {
+		if r.pc != nil {
+			return ""
+		}
+		return fmt.Sprint(atomic.LoadUint64(&r.jctx.metrics.decodeErrs))
+	},
+	"drops": func(r csvRow) string {
+		if r.pc != nil {
+			return ""
+		}
+		var drops uint64
+		for _, q := range r.jctx.drops.queues() {
+			drops += r.jctx.drops.get(q)
+		}
+		return fmt.Sprint(drops)
+	},
+	"p50-ms": func(r csvRow) string { return csvLatency(r, 50) },
+	"p95-ms": func(r csvRow) string { return csvLatency(r, 95) },
+	"p99-ms": func(r csvRow) string { return csvLatency(r, 99) },
+}
+
+// csvDefaultColumns are the columns if none are configured
+var csvDefaultColumns = []string{"timestamp", "device", "path", "packets", "kv", "bytes", "bytes-wire", "drops"}
+
+func csvLatency(r csvRow, p float64) string {
+	if r.pc == nil || atomic.LoadUint64(&r.pc.latency.count) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.1f", float64(r.pc.latency.percentiles(p)[0])/float64(time.Millisecond))
+}
+
+func validateCSVStatsConfig(cfg CSVStatsConfig) error {
+	for _, c := range cfg.Columns {
+		if _, ok := csvColumns[c]; !ok {
+			return fmt.Errorf("csv-stats column %q is not supported", c)
+		}
+	}
+	if cfg.Interval < 0 {
+		return fmt.Errorf("csv-stats interval can not be negative")
+	}
+	return validateLogConfig(cfg.logConfig())
+}
+
+// logConfig is the log config of the rotation of the csv file
+func (cfg CSVStatsConfig) logConfig() LogConfig {
+	return LogConfig{
+		RotateSize:  cfg.RotateSize,
+		RotateAge:   cfg.RotateAge,
+		RotateKeep:  cfg.RotateKeep,
+		Compression: cfg.Compression,
+	}
+}
+
+func (cfg CSVStatsConfig) columns() []string {
+	if len(cfg.Columns) == 0 {
+		return csvDefaultColumns
+	}
+	return cfg.Columns
+}
+
+// csvStats writes the csv stats of a worker
+type csvStats struct {
+	file    *rotatingFile
+	columns []string
+	perPath bool
+	task    *schedTask
+}
+
+// write writes the records of the stats of the worker at now
+func (c *csvStats) write(jctx *JCtx, now time.Time) error {
+	w := csv.NewWriter(c.file)
+	w.WriteAll(csvRecords(jctx, c.columns, c.perPath, now))
+	return w.Error()
+}
+
+// csvRecords returns the records of the stats of the worker at now
+func csvRecords(jctx *JCtx, columns []string, perPath bool, now time.Time) [][]string {
+	record := func(r csvRow) []string {
+		rec := make([]string, len(columns))
+		for i, c := range columns {
+			rec[i] = csvColumns[c](r)
+		}
+		return rec
+	}
+	device := jctx.config.Host
+	records := [][]string{record(csvRow{now: now, device: device, jctx: jctx})}
+	if perPath {
+		for _, p := range jctx.stats.paths.paths() {
+			records = append(records, record(csvRow{now: now, device: device, path: p, jctx: jctx, pc: jctx.stats.paths.counters(p)}))
+		}
+	}
+	return records
+}
+
+// csvStatsInit schedules the csv stats of the worker if the csv-stats file
+// is set
+func csvStatsInit(jctx *JCtx) {
+	cfg := jctx.config.CSVStats
+	if cfg.File == "" {
+		return
+	}
+	f, err := newRotatingFile(cfg.File, cfg.logConfig())
+	if err != nil {
+		log.Printf("Could not create csv stats file(%s): %v\n", cfg.File, err)
+		return
+	}
+	columns := cfg.columns()
+	f.header = []byte(strings.Join(columns, ",") + "\n")
+
+	interval := cfg.Interval
+	if interval == 0 {
+		interval = DefaultCSVStatsInterval
+	}
+	c := &csvStats{file: f, columns: columns, perPath: cfg.PerPath}
+	jctx.csv = c
+	c.task = schedule(time.Duration(interval)*time.Second, func() {
+		if err := c.write(jctx, time.Now()); err != nil {
+			jLogError(jctx, "", "Could not write csv stats", err)
+		}
+	})
+}
+
+func csvStatsStop(jctx *JCtx) {
+	if jctx.csv != nil {
+		jctx.csv.task.stop()
+		jctx.csv.file.Close()
+		jctx.csv = nil
+	}
+}
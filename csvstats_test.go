@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateCSVStatsConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  CSVStatsConfig
+		err  bool
+	}{
+		{name: "default", cfg: CSVStatsConfig{File: "stats.csv"}},
+		{name: "columns", cfg: CSVStatsConfig{Columns: []string{"timestamp", "path", "p99-ms"}}},
+		{name: "unknown column", cfg: CSVStatsConfig{Columns: []string{"timestamp", "jitter"}}, err: true},
+		{name: "interval", cfg: CSVStatsConfig{Interval: -1}, err: true},
+		{name: "compression", cfg: CSVStatsConfig{RotateSize: 10, Compression: "zstd"}, err: true},
+	}
+	for _, test := range tests {
+		err := validateCSVStatsConfig(test.cfg)
+		if (err != nil) != test.err {
+			t.Errorf("%s: got error %v", test.name, err)
+		}
+	}
+}
+
+func TestCSVRecords(t *testing.T) {
+	jctx := &JCtx{config: Config{Host: "r1"}}
+	jctx.metrics.packets = 3
+	jctx.metrics.decodeErrs = 1
+	jctx.stats.totalKV = 30
+	jctx.stats.totalInPayloadLength = 900
+	jctx.stats.totalInPayloadWireLength = 950
+	jctx.stats.paths.add("/interfaces/", 20, 600, 20*time.Millisecond, true)
+	jctx.stats.paths.add("/bgp/", 10, 300, 0, false)
+	now := time.Date(2020, 3, 1, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		columns []string
+		perPath bool
+		want    []string
+	}{
+		{
+			name:    "default",
+			columns: csvDefaultColumns,
+			want:    []string{"2020-03-01T10:30:00Z,r1,,3,30,900,950,0"},
+		},
+		{
+			name:    "per path",
+			columns: []string{"path", "packets", "kv", "bytes", "decode-errors", "p50-ms"},
+			perPath: true,
+			want:    []string{",3,30,900,1,", "/bgp/,1,10,300,,", "/interfaces/,1,20,600,,20.0"},
+		},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, rec := range csvRecords(jctx, test.columns, test.perPath, now) {
+			got = append(got, strings.Join(rec, ","))
+		}
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.name, strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+var dashboardsDir = flag.String("dashboards-dir", ".", "Directory jtimon dashboards writes the Grafana dashboards to")
+
+type grafanaTarget struct {
+	RefID        string `json:"refId"`
+	Query        string `json:"query,omitempty"`
+	RawQuery     bool   `json:"rawQuery,omitempty"`
+	ResultFormat string `json:"resultFormat,omitempty"`
+	Expr         string `json:"expr,omitempty"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+}
+
+type grafanaGridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type grafanaPanel struct {
+	ID          int             `json:"id"`
+	Type        string          `json:"type"`
+	Title       string          `json:"title"`
+	Datasource  string          `json:"datasource"`
+	GridPos     grafanaGridPos  `json:"gridPos"`
+	Targets     []grafanaTarget `json:"targets"`
+	FieldConfig struct {
+		Defaults struct {
+			Unit string `json:"unit,omitempty"`
+		} `json:"defaults"`
+	} `json:"fieldConfig"`
+}
+
+type grafanaVariable struct {
+	Name       string `json:"name"`
+	Label      string `json:"label,omitempty"`
+	Type       string `json:"type"`
+	Datasource string `json:"datasource,omitempty"`
+	Query      string `json:"query"`
+	Refresh    int    `json:"refresh,omitempty"`
+	Multi      bool   `json:"multi,omitempty"`
+	IncludeAll bool   `json:"includeAll,omitempty"`
+}
+
+type grafanaDashboard struct {
+	UID           string   `json:"uid"`
+	Title         string   `json:"title"`
+	Tags          []string `json:"tags"`
+	Timezone      string   `json:"timezone"`
+	SchemaVersion int      `json:"schemaVersion"`
+	Refresh       string   `json:"refresh"`
+	Time          struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	} `json:"time"`
+	Templating struct {
+		List []grafanaVariable `json:"list"`
+	} `json:"templating"`
+	Panels []grafanaPanel `json:"panels"`
+}
+
+func newDashboard(uid, title, datasource, devices string) *grafanaDashboard {
+	d := &grafanaDashboard{
+		UID:           uid,
+		Title:         title,
+		Tags:          []string{"jtimon"},
+		Timezone:      "browser",
+		SchemaVersion: 27,
+		Refresh:       "30s",
+	}
+	d.Time.From, d.Time.To = "now-1h", "now"
+	d.Templating.List = []grafanaVariable{
+		{Name: "datasource", Label: "Data source", Type: "datasource", Query: datasource},
+		{Name: "device", Label: "Device", Type: "query", Datasource: "$datasource", Query: devices,
+			Refresh: 1, Multi: true, IncludeAll: true},
+	}
+	return d
+}
+
+// panel adds a panel of the targets, two panels per row
+func (d *grafanaDashboard) panel(title, unit string, targets ...grafanaTarget) {
+	n := len(d.Panels)
+	p := grafanaPanel{
+		ID:         n + 1,
+		Type:       "timeseries",
+		Title:      title,
+		Datasource: "$datasource",
+		GridPos:    grafanaGridPos{H: 8, W: 12, X: 12 * (n % 2), Y: 8 * (n / 2)},
+		Targets:    targets,
+	}
+	for i := range p.Targets {
+		p.Targets[i].RefID = string(rune('A' + i))
+	}
+	p.FieldConfig.Defaults.Unit = unit
+	d.Panels = append(d.Panels, p)
+}
+
+func influxTarget(query string) grafanaTarget {
+	return grafanaTarget{Query: query, RawQuery: true, ResultFormat: "time_series"}
+}
+
+func promTarget(expr, legend string) grafanaTarget {
+	return grafanaTarget{Expr: expr, LegendFormat: legend}
+}
+
+// dashboardNames are the names the points of jtimon get after the transforms
+// of a worker, "" if they are dropped
+type dashboardNames struct {
+	measurement string
+	device      string
+	ifName      string
+	inOctets    counterNames
+	outOctets   counterNames
+}
+
+// counterNames are the names of a counter field and of the fields the rate
+// and delta transforms derive from it
+type counterNames struct {
+	counter string
+	rate    string
+	delta   string
+}
+
+// namingBefore and namingAfter are the transforms which only select and
+// name the points, without state or side effects, before and after the rate
+// and delta transforms. The others may call out (enrich, script), keep the
+// samples they see (rate, delta, top-n, ...) or add fields, the names are
+// not discovered through them.
+var (
+	namingBefore = []*transformer{newListKeysTransformer(), newFilterTransformer()}
+	namingAfter  = []*transformer{newFlattenTransformer(), newRenameTransformer(), newSanitizeTransformer(),
+		newFieldsTransformer()}
+)
+
+func namingStages(jctx *JCtx, transformers []*transformer) []transform {
+	var stages []transform
+	for _, t := range transformers {
+		if tr, err := t.new(jctx); err == nil && tr != nil {
+			stages = append(stages, tr)
+		}
+	}
+	return stages
+}
+
+func applyStages(stages []transform, points []*point) []*point {
+	for _, t := range stages {
+		if len(points) == 0 {
+			break
+		}
+		points = t.apply(points)
+	}
+	return points
+}
+
+// discoverNames runs synthetic interface points through the naming
+// transforms of the worker to find the measurement, tag and field names
+// they end up with. The fields of the rate and delta rules matching the
+// counters are named as well.
+func discoverNames(jctx *JCtx) dashboardNames {
+	const device, ifName = "dashboards-device", "ge-0/0/0"
+	before, after := namingStages(jctx, namingBefore), namingStages(jctx, namingAfter)
+	var rates *rate
+	if tr, err := newRate(jctx); err == nil && tr != nil {
+		rates = tr.(*rate)
+	}
+	var deltas *delta
+	if tr, err := newDelta(jctx); err == nil && tr != nil {
+		deltas = tr.(*delta)
+	}
+
+	// single runs the point with the field only through stages, it returns
+	// the point and the name of the field, nil if it is dropped
+	single := func(stages []transform, p *point, field string) (*point, string) {
+		p = newPoint(p.Measurement, p.Tags, map[string]interface{}{field: float64(1000)}, p.Timestamp)
+		out := applyStages(stages, []*point{p})
+		if len(out) != 1 || len(out[0].Fields) != 1 {
+			return nil, ""
+		}
+		for k := range out[0].Fields {
+			return out[0], k
+		}
+		return nil, ""
+	}
+	var named *point
+	name := func(p *point, field string) string {
+		out, k := single(after, p, field)
+		if out != nil && named == nil {
+			named = out
+		}
+		return k
+	}
+	counter := func(field string) counterNames {
+		var names counterNames
+		p := newPoint("/interfaces/", map[string]string{
+			"device":                      device,
+			"sensor":                      "sensor_1000:/interfaces/:/interfaces/:PFE",
+			"/interfaces/interface/@name": ifName,
+		}, nil, time.Now())
+		if m := jctx.config.Influx.Measurement; m != "" {
+			p.Measurement = m
+		}
+		p, field = single(before, p, field)
+		if p == nil {
+			return names
+		}
+		names.counter = name(p, field)
+		if rates != nil {
+			if rule := rates.rule(field); rule != nil {
+				names.rate = name(p, field+rule.suffix)
+			}
+		}
+		if deltas != nil {
+			if rule := deltas.rule(field); rule != nil {
+				names.delta = name(p, field+rule.suffix)
+			}
+		}
+		return names
+	}
+
+	names := dashboardNames{
+		inOctets:  counter("/interfaces/interface/state/counters/in-octets"),
+		outOctets: counter("/interfaces/interface/state/counters/out-octets"),
+	}
+	if named == nil {
+		return names
+	}
+	names.measurement = named.Measurement
+	keys := make([]string, 0, len(named.Tags))
+	for k := range named.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		switch named.Tags[k] {
+		case device:
+			names.device = k
+		case ifName:
+			names.ifName = k
+		}
+	}
+	return names
+}
+
+func influxIdent(s string) string {
+	return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+}
+
+// deviceOverview is the dashboard of the interface throughput of the
+// devices and, with a self-measurement, of what jtimon receives from them
+func deviceOverview(names dashboardNames, self string) *grafanaDashboard {
+	if names.device == "" {
+		names.device = "device"
+	}
+	m, dev := influxIdent(names.measurement), influxIdent(names.device)
+	devices := fmt.Sprintf("SHOW TAG VALUES FROM %s WITH KEY = %s", m, dev)
+	if names.measurement == "" {
+		devices = fmt.Sprintf("SHOW TAG VALUES WITH KEY = %s", dev)
+	}
+	d := newDashboard("jtimon-devices", "jtimon / Device overview", "influxdb", devices)
+
+	groupBy := dev
+	if names.ifName != "" {
+		groupBy += ", " + influxIdent(names.ifName)
+	}
+	// throughput is the rate of the counter in bits per second: the field of
+	// the rate transform, the deltas over the interval or the derivative of
+	// the counter
+	throughput := func(c counterNames, alias string) grafanaTarget {
+		sel := "non_negative_derivative(mean(%s), 1s) * 8"
+		field := c.counter
+		switch {
+		case c.rate != "":
+			sel, field = "mean(%s) * 8", c.rate
+		case c.delta != "":
+			sel, field = "sum(%s) * 8000 / $__interval_ms", c.delta
+		}
+		return influxTarget(fmt.Sprintf(`SELECT `+sel+` AS %s FROM %s `+
+			`WHERE %s =~ /^$device$/ AND $timeFilter GROUP BY time($__interval), %s`,
+			influxIdent(field), influxIdent(alias), m, dev, groupBy))
+	}
+	if names.inOctets != (counterNames{}) {
+		d.panel("Interface input", "bps", throughput(names.inOctets, "in"))
+	}
+	if names.outOctets != (counterNames{}) {
+		d.panel("Interface output", "bps", throughput(names.outOctets, "out"))
+	}
+	if self != "" {
+		s := influxIdent(self)
+		query := func(field string) grafanaTarget {
+			return influxTarget(fmt.Sprintf(`SELECT mean(%s) FROM %s WHERE "device" =~ /^$device$/ AND $timeFilter `+
+				`GROUP BY time($__interval), "device"`, influxIdent(field), s))
+		}
+		d.panel("Packets received", "pps", query("packets-per-sec"))
+		d.panel("Points exported", "short", query("points-per-sec"))
+		d.panel("Bytes received", "Bps", query("bytes-per-sec"))
+		d.panel("Receive latency", "ms", query("latency-ms"))
+	}
+	return d
+}
+
+// pathThroughput is the dashboard of the packets and latency per path, from
+// the internal metrics
+func pathThroughput() *grafanaDashboard {
+	d := newDashboard("jtimon-paths", "jtimon / Path throughput", "prometheus",
+		"label_values(jtimon_latency_seconds_count, device)")
+	sel := `{device=~"$device"}`
+	d.panel("Packets per path", "pps",
+		promTarget(`sum by (path) (rate(jtimon_latency_seconds_count`+sel+`[1m]))`, "{{path}}"))
+	d.panel("p99 latency per path", "s",
+		promTarget(`max by (path) (jtimon_latency_seconds{device=~"$device",quantile="0.99"})`, "{{path}}"))
+	d.panel("Packets per device and path", "pps",
+		promTarget(`rate(jtimon_latency_seconds_count`+sel+`[1m])`, "{{device}} {{path}}"))
+	d.panel("p50 latency per path", "s",
+		promTarget(`max by (path) (jtimon_latency_seconds{device=~"$device",quantile="0.5"})`, "{{path}}"))
+	return d
+}
+
+// collectorHealth is the dashboard of the internal metrics of jtimon
+func collectorHealth() *grafanaDashboard {
+	d := newDashboard("jtimon-health", "jtimon / Collector health", "prometheus",
+		"label_values(jtimon_received_packets_total, device)")
+	sel := `{device=~"$device"}`
+	d.panel("Packets received", "pps",
+		promTarget(`rate(jtimon_received_packets_total`+sel+`[1m])`, "{{device}}"))
+	d.panel("Decode errors", "short",
+		promTarget(`increase(jtimon_decode_errors_total`+sel+`[5m])`, "{{device}}"))
+	d.panel("Queue fill", "percentunit",
+		promTarget(`jtimon_queue_length`+sel+` / jtimon_queue_capacity`+sel, "{{device}} {{queue}}"))
+	d.panel("Queue drops", "short",
+		promTarget(`increase(jtimon_queue_drops_total`+sel+`[5m])`, "{{device}} {{queue}}"))
+	d.panel("Sink write latency", "s",
+		promTarget(`rate(jtimon_sink_write_seconds_total`+sel+`[5m]) / rate(jtimon_sink_writes_total`+sel+`[5m])`,
+			"{{device}} {{sink}}"))
+	d.panel("Packets lost in sequence gaps", "short",
+		promTarget(`increase(jtimon_sequence_lost_total`+sel+`[5m])`, "{{device}} {{sensor}}"))
+	return d
+}
+
+// dashboards returns the dashboards for the worker by file name
+func dashboards(jctx *JCtx) map[string]*grafanaDashboard {
+	return map[string]*grafanaDashboard{
+		"jtimon-devices.json": deviceOverview(discoverNames(jctx), jctx.config.Influx.SelfMeasurement),
+		"jtimon-paths.json":   pathThroughput(),
+		"jtimon-health.json":  collectorHealth(),
+	}
+}
+
+// dashboardsMain writes the Grafana dashboards for the naming of the first
+// config file
+func dashboardsMain() {
+	if len(*configFiles) == 0 {
+		log.Printf("jtimon dashboards needs a config file (--config) with the naming of the measurements and fields")
+		return
+	}
+	config, err := NewJTIMONConfig((*configFiles)[0])
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	// only the naming transforms are checked, the others are not started
+	jctx := &JCtx{file: (*configFiles)[0], config: config}
+	naming := append(append(namingBefore, newRateTransformer(), newDeltaTransformer()), namingAfter...)
+	for _, t := range naming {
+		if _, err := t.new(jctx); err != nil {
+			log.Printf("%s transform: %v", t.name, err)
+			return
+		}
+	}
+
+	for name, d := range dashboards(jctx) {
+		b, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			log.Printf("%s: %v", name, err)
+			continue
+		}
+		file := filepath.Join(*dashboardsDir, name)
+		if err := ioutil.WriteFile(file, append(b, '\n'), 0644); err != nil {
+			log.Printf("%v", err)
+			continue
+		}
+		log.Printf("wrote %s (%d panels)", file, len(d.Panels))
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDiscoverNames(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want dashboardNames
+	}{
+		{
+			name: "default",
+			want: dashboardNames{
+				measurement: "/interfaces/",
+				device:      "device",
+				ifName:      "/interfaces/interface/@name",
+				inOctets:    counterNames{counter: "/interfaces/interface/state/counters/in-octets"},
+				outOctets:   counterNames{counter: "/interfaces/interface/state/counters/out-octets"},
+			},
+		},
+		{
+			name: "renamed",
+			cfg: Config{
+				Influx: InfluxConfig{Measurement: "jtimon"},
+				Transform: TransformConfig{Rename: []RenameRule{
+					{Field: "/interfaces/interface/state/counters/in-octets", Alias: "rx-bytes"},
+					{Match: `^/interfaces/interface/state/counters/(.*)$`, Alias: "${1}"},
+				}},
+			},
+			want: dashboardNames{
+				measurement: "jtimon",
+				device:      "device",
+				ifName:      "/interfaces/interface/@name",
+				inOctets:    counterNames{counter: "rx-bytes"},
+				outOctets:   counterNames{counter: "out-octets"},
+			},
+		},
+		{
+			name: "filtered",
+			cfg: Config{Transform: TransformConfig{Filter: FilterConfig{
+				ExcludeFields: []string{"out-octets$"},
+			}}},
+			want: dashboardNames{
+				measurement: "/interfaces/",
+				device:      "device",
+				ifName:      "/interfaces/interface/@name",
+				inOctets:    counterNames{counter: "/interfaces/interface/state/counters/in-octets"},
+			},
+		},
+		{
+			name: "rate and delta",
+			cfg: Config{Transform: TransformConfig{
+				Rate:   []RateRule{{Match: `in-octets$`}},
+				Delta:  []DeltaRule{{Match: `octets$`, Suffix: "-delta"}},
+				Rename: []RenameRule{{Match: `^/interfaces/interface/state/counters/(.*)$`, Alias: "${1}"}},
+			}},
+			want: dashboardNames{
+				measurement: "/interfaces/",
+				device:      "device",
+				ifName:      "/interfaces/interface/@name",
+				inOctets:    counterNames{counter: "in-octets", rate: "in-octets_rate", delta: "in-octets-delta"},
+				outOctets:   counterNames{counter: "out-octets", delta: "out-octets-delta"},
+			},
+		},
+	}
+	for _, test := range tests {
+		jctx := &JCtx{config: test.cfg}
+		if got := discoverNames(jctx); got != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDiscoverNamesNoLookups(t *testing.T) {
+	var lookups int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&lookups, 1)
+		w.Write([]byte(`{"site": "lab"}`))
+	}))
+	defer srv.Close()
+	cfg := Config{Transform: TransformConfig{Enrich: EnrichConfig{
+		EnrichLookupConfig: EnrichLookupConfig{URL: srv.URL + "/{{.Device}}/{{.Interface}}"},
+	}}}
+	names := discoverNames(&JCtx{config: cfg})
+	if names.inOctets.counter != "/interfaces/interface/state/counters/in-octets" {
+		t.Errorf("got %+v", names)
+	}
+	if n := atomic.LoadInt32(&lookups); n != 0 {
+		t.Errorf("%d enrich lookups", n)
+	}
+}
+
+func TestDashboards(t *testing.T) {
+	jctx := &JCtx{config: Config{Influx: InfluxConfig{Measurement: "jtimon", SelfMeasurement: "jtimon-self"}}}
+	tests := []struct {
+		file   string
+		panels int
+		query  string
+	}{
+		{"jtimon-devices.json", 6, `SELECT non_negative_derivative(mean("/interfaces/interface/state/counters/in-octets"), 1s) * 8 AS "in" ` +
+			`FROM "jtimon" WHERE "device" =~ /^$device$/ AND $timeFilter GROUP BY time($__interval), "device", "/interfaces/interface/@name"`},
+		{"jtimon-paths.json", 4, `sum by (path) (rate(jtimon_latency_seconds_count{device=~"$device"}[1m]))`},
+		{"jtimon-health.json", 6, `rate(jtimon_received_packets_total{device=~"$device"}[1m])`},
+	}
+	got := dashboards(jctx)
+	if len(got) != len(tests) {
+		t.Errorf("got %d dashboards", len(got))
+	}
+	for _, test := range tests {
+		d, ok := got[test.file]
+		if !ok {
+			t.Errorf("%s: missing", test.file)
+			continue
+		}
+		if len(d.Panels) != test.panels {
+			t.Errorf("%s: got %d panels, want %d", test.file, len(d.Panels), test.panels)
+		}
+		b, err := json.Marshal(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the first target of the first panel
+		var parsed struct {
+			Panels []struct {
+				GridPos grafanaGridPos `json:"gridPos"`
+				Targets []map[string]interface{}
+			}
+		}
+		if err := json.Unmarshal(b, &parsed); err != nil {
+			t.Fatal(err)
+		}
+		target := parsed.Panels[0].Targets[0]
+		if q := target["query"]; q != nil && q != test.query || q == nil && target["expr"] != test.query {
+			t.Errorf("%s: got target %v, want %s", test.file, target, test.query)
+		}
+		if last := parsed.Panels[len(parsed.Panels)-1].GridPos; last.Y != 8*((test.panels-1)/2) {
+			t.Errorf("%s: got last panel at %+v", test.file, last)
+		}
+		if !strings.Contains(string(b), `"name":"device"`) {
+			t.Errorf("%s: no device variable", test.file)
+		}
+	}
+}
+
+func TestDeviceOverviewThroughput(t *testing.T) {
+	names := dashboardNames{
+		measurement: "jtimon",
+		device:      "device",
+		inOctets:    counterNames{counter: "in-octets", rate: "in-octets_rate"},
+		outOctets:   counterNames{delta: "out-octets_delta"},
+	}
+	d := deviceOverview(names, "")
+	if len(d.Panels) != 2 {
+		t.Fatalf("got %d panels", len(d.Panels))
+	}
+	for i, want := range []string{`SELECT mean("in-octets_rate") * 8 AS "in"`,
+		`SELECT sum("out-octets_delta") * 8000 / $__interval_ms AS "out"`} {
+		if q := d.Panels[i].Targets[0].Query; !strings.HasPrefix(q, want) {
+			t.Errorf("got %s, want %s...", q, want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// DeadbandRule suppresses the fields matching match (regex) while they
+// change by less than absolute or percent (of the last written value) since
+// the last written sample. Non numeric values are suppressed while they do
+// not change. With max-age (milliseconds) the value is written anyway once
+// the last written sample is that old. Points without fields left are
+// dropped.
+type DeadbandRule struct {
+	Match    string  `json:"match"`
+	Absolute float64 `json:"absolute"`
+	Percent  float64 `json:"percent"`
+	MaxAge   int     `json:"max-age"`
+}
+
+type deadbandRule struct {
+	re       *regexp.Regexp
+	absolute float64
+	percent  float64
+	maxAge   time.Duration
+}
+
+type deadbandLast struct {
+	value interface{}
+	ts    time.Time
+}
+
+type deadband struct {
+	sync.Mutex
+	rules []deadbandRule
+	last  map[string]deadbandLast
+}
+
+func newDeadbandTransformer() *transformer {
+	return &transformer{
+		name: "deadband",
+		new:  newDeadband,
+	}
+}
+
+func newDeadband(jctx *JCtx) (transform, error) {
+	rules := jctx.config.Transform.Deadband
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	d := &deadband{last: map[string]deadbandLast{}}
+	for i, rule := range rules {
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: invalid match %q: %v", i, rule.Match, err)
+		}
+		if rule.Absolute < 0 || rule.Percent < 0 || rule.MaxAge < 0 {
+			return nil, fmt.Errorf("rule %d: absolute, percent and max-age can not be negative", i)
+		}
+		d.rules = append(d.rules, deadbandRule{
+			re:       re,
+			absolute: rule.Absolute,
+			percent:  rule.Percent,
+			maxAge:   time.Duration(rule.MaxAge) * time.Millisecond,
+		})
+	}
+	return d, nil
+}
+
+func (d *deadband) rule(field string) *deadbandRule {
+	for i, rule := range d.rules {
+		if rule.re.MatchString(field) {
+			return &d.rules[i]
+		}
+	}
+	return nil
+}
+
+// within tells whether v is within the deadband around last
+func (r *deadbandRule) within(v, last interface{}) bool {
+	cur, _, ok := numericValue(v)
+	prev, _, prevOk := numericValue(last)
+	if !ok || !prevOk {
+		return v == last
+	}
+	diff := math.Abs(cur - prev)
+	if diff == 0 {
+		return true
+	}
+	if r.absolute > 0 && diff < r.absolute {
+		return true
+	}
+	return r.percent > 0 && diff < math.Abs(prev)*r.percent/100
+}
+
+func (d *deadband) apply(points []*point) []*point {
+	d.Lock()
+	defer d.Unlock()
+
+	out := make([]*point, 0, len(points))
+	for _, p := range points {
+		var fields map[string]interface{}
+		for k, v := range p.Fields {
+			rule := d.rule(k)
+			if rule == nil {
+				continue
+			}
+			key := seriesKey(p, k)
+			last, seen := d.last[key]
+			if seen && rule.within(v, last.value) &&
+				(rule.maxAge == 0 || p.Timestamp.Sub(last.ts) < rule.maxAge) {
+				if fields == nil {
+					fields = copyFields(p.Fields)
+				}
+				delete(fields, k)
+				continue
+			}
+			d.last[key] = deadbandLast{value: v, ts: p.Timestamp}
+		}
+		switch {
+		case fields == nil:
+			out = append(out, p)
+		case len(fields) != 0:
+			out = append(out, newPoint(p.Measurement, p.Tags, fields, p.Timestamp))
+		}
+	}
+	return out
+}
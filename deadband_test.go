@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeadband(t *testing.T) {
+	type sample struct {
+		sec   int64
+		value interface{}
+		want  bool
+	}
+	tests := []struct {
+		name    string
+		rule    DeadbandRule
+		samples []sample
+	}{
+		{
+			name: "absolute",
+			rule: DeadbandRule{Match: "temperature", Absolute: 1},
+			samples: []sample{
+				{0, 40.0, true}, {1, 40.5, false}, {2, 40.9, false}, {3, 41.0, true}, {4, 40.1, false}, {5, 39.9, true},
+			},
+		},
+		{
+			name: "percent",
+			rule: DeadbandRule{Match: "power", Percent: 10},
+			samples: []sample{
+				{0, -2.0, true}, {1, -2.1, false}, {2, -2.19, false}, {3, -2.2, true},
+			},
+		},
+		{
+			name: "max-age",
+			rule: DeadbandRule{Match: "temperature", Absolute: 5, MaxAge: 10000},
+			samples: []sample{
+				{0, 40.0, true}, {5, 41.0, false}, {10, 41.0, true}, {15, 41.0, false},
+			},
+		},
+		{
+			name: "strings",
+			rule: DeadbandRule{Match: "status"},
+			samples: []sample{
+				{0, "UP", true}, {1, "UP", false}, {2, "DOWN", true}, {3, "DOWN", false},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jctx := &JCtx{}
+			jctx.config.Transform.Deadband = []DeadbandRule{test.rule}
+			if err := transformsInit(jctx); err != nil {
+				t.Fatalf("transformsInit failed: %v", err)
+			}
+			for _, s := range test.samples {
+				p := newPoint("/components/", map[string]string{"device": "r1"},
+					map[string]interface{}{test.rule.Match: s.value, "other": 1.0}, time.Unix(s.sec, 0))
+				out := applyTransforms(jctx, []*point{p})
+				if len(out) != 1 {
+					t.Fatalf("t=%d: want 1 point, got %d", s.sec, len(out))
+				}
+				if _, got := out[0].Fields[test.rule.Match]; got != s.want {
+					t.Errorf("t=%d value=%v: written %v, want %v", s.sec, s.value, got, s.want)
+				}
+			}
+		})
+	}
+
+	t.Run("empty-points-dropped", func(t *testing.T) {
+		jctx := &JCtx{}
+		jctx.config.Transform.Deadband = []DeadbandRule{{Match: ".", Absolute: 1}}
+		if err := transformsInit(jctx); err != nil {
+			t.Fatalf("transformsInit failed: %v", err)
+		}
+		p := newPoint("/components/", nil, map[string]interface{}{"t": 1.0}, time.Unix(0, 0))
+		applyTransforms(jctx, []*point{p})
+		if out := applyTransforms(jctx, []*point{p}); len(out) != 0 {
+			t.Errorf("want no points, got %d", len(out))
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// decodeFunc turns the bytes value of path into fields, the field names are
+// relative to path
+type decodeFunc func(path string, b []byte) (map[string]interface{}, error)
+
+// decoder decodes bytes values of updates, e.g. payloads of native
+// sensors. New decoders are compiled in by adding them to decoders or
+// loaded from Go plugins exporting
+//
+//	func Decode(path string, b []byte) (map[string]interface{}, error)
+type decoder struct {
+	name   string
+	decode decodeFunc
+}
+
+var decoders = []*decoder{
+	newProtobufRawDecoder(),
+}
+
+// decoderBinding is a configured decoder of the worker
+type decoderBinding struct {
+	re     *regexp.Regexp
+	decode decodeFunc
+}
+
+// validateDecoders checks the decoders can be loaded by this build, the
+// plugins need a build with cgo
+func validateDecoders(decoders []VendorDecoder) error {
+	for i, d := range decoders {
+		if d.Plugin != "" && !pluginsSupported {
+			return fmt.Errorf("vendor decoders %d: plugin %s: this jtimon is built without cgo, it can not load plugins", i, d.Plugin)
+		}
+	}
+	return nil
+}
+
+func decodersInit(jctx *JCtx) error {
+	for i, d := range jctx.config.Vendor.Decoders {
+		re, err := regexp.Compile(d.Path)
+		if err != nil {
+			return fmt.Errorf("vendor decoders %d: invalid path %q: %v", i, d.Path, err)
+		}
+
+		var decode decodeFunc
+		switch {
+		case d.Plugin != "":
+			if decode, err = loadDecoderPlugin(d.Plugin); err != nil {
+				return fmt.Errorf("vendor decoders %d: %v", i, err)
+			}
+		default:
+			for _, dec := range decoders {
+				if dec.name == d.Name {
+					decode = dec.decode
+				}
+			}
+			if decode == nil {
+				return fmt.Errorf("vendor decoders %d: unknown decoder %q", i, d.Name)
+			}
+		}
+		jctx.decoders = append(jctx.decoders, decoderBinding{re: re, decode: decode})
+	}
+	return nil
+}
+
+// decodeBytes decodes b with the first decoder bound to path, ok is false
+// if there is none or it failed
+func decodeBytes(jctx *JCtx, path string, b []byte) (map[string]interface{}, bool) {
+	for _, d := range jctx.decoders {
+		if !d.re.MatchString(path) {
+			continue
+		}
+		fields, err := d.decode(path, b)
+		if err != nil {
+			atomic.AddUint64(&jctx.metrics.decodeErrs, 1)
+			jLogError(jctx, path, "decoding failed", err)
+			return nil, false
+		}
+		return fields, true
+	}
+	return nil, false
+}
+
+func newProtobufRawDecoder() *decoder {
+	return &decoder{
+		name: "protobuf-raw",
+		decode: func(path string, b []byte) (map[string]interface{}, error) {
+			fields := map[string]interface{}{}
+			if err := decodeProtobufRaw(b, "", fields); err != nil {
+				return nil, err
+			}
+			return fields, nil
+		},
+	}
+}
+
+// decodeProtobufRaw decodes protobuf wire format without schema, fields are
+// named by their numbers (1/2 is field 2 of the message in field 1) and
+// repeated ones get the index appended (3[1]). Varints are uint64, as the
+// type of a varint is not known, fixed64 and fixed32 are floats. Length
+// delimited values are nested messages if they parse as such, strings
+// otherwise.
+func decodeProtobufRaw(b []byte, prefix string, fields map[string]interface{}) error {
+	seen := map[string]int{}
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return fmt.Errorf("invalid field key")
+		}
+		b = b[n:]
+		num, wire := key>>3, key&7
+		if num == 0 {
+			return fmt.Errorf("invalid field number 0")
+		}
+
+		name := prefix + strconv.FormatUint(num, 10)
+		if i := seen[name]; i > 0 {
+			seen[name]++
+			name = fmt.Sprintf("%s[%d]", name, i)
+		} else {
+			seen[name] = 1
+		}
+
+		switch wire {
+		case 0:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return fmt.Errorf("%s: invalid varint", name)
+			}
+			fields[name] = v
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				return fmt.Errorf("%s: truncated fixed64", name)
+			}
+			fields[name] = math.Float64frombits(binary.LittleEndian.Uint64(b))
+			b = b[8:]
+		case 5:
+			if len(b) < 4 {
+				return fmt.Errorf("%s: truncated fixed32", name)
+			}
+			fields[name] = float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+			b = b[4:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return fmt.Errorf("%s: truncated bytes", name)
+			}
+			v := b[n : n+int(l)]
+			b = b[n+int(l):]
+
+			nested := map[string]interface{}{}
+			if len(v) > 0 && decodeProtobufRaw(v, name+"/", nested) == nil {
+				for k, nv := range nested {
+					fields[k] = nv
+				}
+			} else if utf8.Valid(v) {
+				fields[name] = string(v)
+			} else {
+				fields[name] = fmt.Sprintf("%x", v)
+			}
+		default:
+			return fmt.Errorf("%s: unsupported wire type %d", name, wire)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !cgo || (!linux && !darwin && !freebsd)
+// +build !cgo !linux,!darwin,!freebsd
+
+package main
+
+import "fmt"
+
+// pluginsSupported tells whether the decoders can be loaded from Go plugins,
+// which needs cgo
+const pluginsSupported = false
+
+func loadDecoderPlugin(file string) (decodeFunc, error) {
+	return nil, fmt.Errorf("%s: this jtimon is built without cgo, it can not load plugins", file)
+}
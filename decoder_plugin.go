@@ -0,0 +1,30 @@
+//go:build cgo && (linux || darwin || freebsd)
+// +build cgo
+// +build linux darwin freebsd
+
+package main
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// pluginsSupported tells whether the decoders can be loaded from Go plugins,
+// which needs cgo
+const pluginsSupported = true
+
+func loadDecoderPlugin(file string) (decodeFunc, error) {
+	p, err := plugin.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup("Decode")
+	if err != nil {
+		return nil, err
+	}
+	decode, ok := sym.(func(string, []byte) (map[string]interface{}, error))
+	if !ok {
+		return nil, fmt.Errorf("%s: Decode has type %T", file, sym)
+	}
+	return decode, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeProtobufRaw(t *testing.T) {
+	tests := []struct {
+		name   string
+		b      []byte
+		fields map[string]interface{}
+		err    bool
+	}{
+		{name: "varint", b: []byte{0x08, 0x96, 0x01}, fields: map[string]interface{}{"1": uint64(150)}},
+		{name: "large-varint", b: []byte{0x08, 0xc5, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01},
+			fields: map[string]interface{}{"1": uint64(18446744073709551557)}},
+		{name: "string", b: []byte{0x12, 0x04, 'e', 't', 'h', '0'}, fields: map[string]interface{}{"2": "eth0"}},
+		{name: "nested", b: []byte{0x1a, 0x02, 0x08, 0x07}, fields: map[string]interface{}{"3/1": uint64(7)}},
+		{
+			name: "repeated", b: []byte{0x20, 0x01, 0x20, 0x02},
+			fields: map[string]interface{}{"4": uint64(1), "4[1]": uint64(2)},
+		},
+		{name: "fixed32", b: []byte{0x2d, 0x00, 0x00, 0xc0, 0x3f}, fields: map[string]interface{}{"5": float64(1.5)}},
+		{name: "truncated", b: []byte{0x12, 0x05, 'a'}, err: true},
+		{name: "wire-type", b: []byte{0x0b}, err: true},
+	}
+	decode := newProtobufRawDecoder().decode
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fields, err := decode("/junos/native", test.b)
+			if test.err {
+				if err == nil {
+					t.Errorf("want error, got %v", fields)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(fields, test.fields) {
+				t.Errorf("got %v, want %v", fields, test.fields)
+			}
+		})
+	}
+}
+
+func TestDecodersInit(t *testing.T) {
+	jctx := &JCtx{}
+	jctx.config.Vendor.Decoders = []VendorDecoder{{Path: "^/junos/native", Name: "protobuf-raw"}}
+	if err := decodersInit(jctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := decodeBytes(jctx, "/junos/other", []byte{0x08, 0x01}); ok {
+		t.Errorf("decoded path without decoder")
+	}
+	fields, ok := decodeBytes(jctx, "/junos/native/stats", []byte{0x08, 0x01})
+	if !ok || !reflect.DeepEqual(fields, map[string]interface{}{"1": uint64(1)}) {
+		t.Errorf("got %v %v", fields, ok)
+	}
+
+	for _, d := range []VendorDecoder{
+		{Path: "(", Name: "protobuf-raw"},
+		{Path: ".", Name: "unknown"},
+		{Path: ".", Plugin: "/nonexistent.so"},
+	} {
+		jctx := &JCtx{}
+		jctx.config.Vendor.Decoders = []VendorDecoder{d}
+		if err := decodersInit(jctx); err == nil {
+			t.Errorf("%v: want error, got nil", d)
+		}
+	}
+
+	decoders = append(decoders, &decoder{
+		name: "test",
+		decode: func(path string, b []byte) (map[string]interface{}, error) {
+			return map[string]interface{}{"len": len(b)}, nil
+		},
+	})
+	defer func() { decoders = decoders[:len(decoders)-1] }()
+	jctx = &JCtx{}
+	jctx.config.Vendor.Decoders = []VendorDecoder{{Path: ".", Name: "test"}}
+	if err := decodersInit(jctx); err != nil {
+		t.Fatal(err)
+	}
+	if fields, _ := decodeBytes(jctx, "/x", []byte{1, 2}); fields["len"] != 2 {
+		t.Errorf("got %v", fields)
+	}
+}
+
+func TestValidateDecoders(t *testing.T) {
+	if err := validateDecoders([]VendorDecoder{{Path: ".", Name: "protobuf-raw"}}); err != nil {
+		t.Errorf("compiled-in decoder: %v", err)
+	}
+	err := validateDecoders([]VendorDecoder{{Path: ".", Plugin: "/opt/jtimon/npu.so"}})
+	if pluginsSupported && err != nil {
+		t.Errorf("plugin with cgo: %v", err)
+	}
+	if !pluginsSupported && err == nil {
+		t.Errorf("plugin without cgo: want error, got nil")
+	}
+}
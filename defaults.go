@@ -12,6 +12,76 @@ const (
 	DefaultIDBAccumulatorFreq = 2000
 	//DefaultIDBTimeout is 30 seconds
 	DefaultIDBTimeout = 30
+	// DefaultIDBPrecision is the write precision of InfluxDB
+	DefaultIDBPrecision = "us"
+	// DefaultIDBQueueSize is the number of batches buffered per InfluxDB server
+	DefaultIDBQueueSize = 64
+	// DefaultIDBRetryInterval is 5 seconds
+	DefaultIDBRetryInterval = 5000
+
+	// DefaultSinkBatchSize to use if user has not provided in the sink config
+	DefaultSinkBatchSize = 1024
+	// DefaultSinkBatchFreq is 2 seconds
+	DefaultSinkBatchFreq = 2000
+	// DefaultAMQPRoutingKey routes by device name
+	DefaultAMQPRoutingKey = "{{.Tags.device}}"
+	// DefaultRedisPort is the standard Redis port
+	DefaultRedisPort = 6379
+	// DefaultRedisStream gives every device its own stream
+	DefaultRedisStream = "jtimon:{{.Tags.device}}"
+	// DefaultPubSubEndpoint is the global Pub/Sub endpoint
+	DefaultPubSubEndpoint = "https://pubsub.googleapis.com"
+	// DefaultPubSubOrderingKey keeps messages of a device in order
+	DefaultPubSubOrderingKey = "{{.Tags.device}}"
+	// DefaultKinesisPartitionKey keeps records of a device on one shard
+	DefaultKinesisPartitionKey = "{{.Tags.device}}"
+	// DefaultEventHubsPartitionKey keeps events of a device on one partition
+	DefaultEventHubsPartitionKey = "{{.Tags.device}}"
+	// DefaultSplunkSource is the source of HEC events
+	DefaultSplunkSource = "jtimon"
+	// DefaultSplunkSourceType gives every measurement its own sourcetype
+	DefaultSplunkSourceType = "jtimon:{{.Measurement}}"
+	// DefaultSplunkHost reports the device as host of the event
+	DefaultSplunkHost = "{{.Tags.device}}"
+	// DefaultSNMPTrapPort is the standard SNMP trap port
+	DefaultSNMPTrapPort = 162
+	// DefaultSNMPCommunity is used if snmp-trap community is not given
+	DefaultSNMPCommunity = "public"
+	// DefaultSyslogPort is the standard syslog port
+	DefaultSyslogPort = 514
+	// DefaultSyslogFacility of forwarded updates
+	DefaultSyslogFacility = "local0"
+	// DefaultSyslogSeverity of forwarded updates
+	DefaultSyslogSeverity = "notice"
+	// DefaultSyslogMessage describes the update
+	DefaultSyslogMessage = "{{.Measurement}} {{.Field}}={{.Value}}"
+	// DefaultSyslogTLSPort is the standard syslog over TLS port
+	DefaultSyslogTLSPort = 6514
+	// DefaultCSVStatsInterval is 60 seconds
+	DefaultCSVStatsInterval = 60
+	// DefaultEnrichTTL is 5 minutes
+	DefaultEnrichTTL = 300
+	// DefaultEnrichErrorTTL is 30 seconds
+	DefaultEnrichErrorTTL = 30
+	// DefaultEnrichTimeout is 2 seconds
+	DefaultEnrichTimeout = 2
+	// DefaultScriptTimeout is 1 second
+	DefaultScriptTimeout = 1000
+	// DefaultAnomalyAlpha is the weight of a new sample in the moving average
+	DefaultAnomalyAlpha = 0.1
+	// DefaultAnomalyScore flags samples 3 standard deviations off the average
+	DefaultAnomalyScore = 3
+	// DefaultAnomalyWarmup is the number of samples before anything is flagged
+	DefaultAnomalyWarmup = 10
+	// DefaultTopNInterval is 10 seconds
+	DefaultTopNInterval = 10000
+	// DefaultPromoteMaxValues is the number of distinct values a string field
+	// can have to be promoted to tag automatically
+	DefaultPromoteMaxValues = 16
+	// DefaultAlertSeverity of alerts without severity
+	DefaultAlertSeverity = "warning"
+	// DefaultAlertMessage describes the alert
+	DefaultAlertMessage = "{{.Rule}} {{.Status}}: {{.Tags.device}} {{.Field}}={{.Value}}"
 
 	// MatchExpressionXpath is for the pattern matching the xpath and key-value pairs
 	MatchExpressionXpath = "\\/([^\\/]*)\\[(.*?)+?(?:\\])"
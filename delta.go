@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// DeltaRule adds the difference from the previous sample of the fields
+// matching match as a parallel field named field+suffix (default "_delta").
+// With counter a decrease is a reset of the counter and the delta is the
+// new value, otherwise negative deltas are written as they are.
+type DeltaRule struct {
+	Match   string `json:"match"`
+	Suffix  string `json:"suffix"`
+	Counter bool   `json:"counter"`
+}
+
+type deltaRule struct {
+	re      *regexp.Regexp
+	suffix  string
+	counter bool
+}
+
+// deltaSample is the previous value of a series, seen is when it was
+// received
+type deltaSample struct {
+	value float64
+	seen  time.Time
+}
+
+type delta struct {
+	sync.Mutex
+	rules []deltaRule
+	last  map[string]deltaSample
+	now   func() time.Time
+	swept time.Time
+}
+
+func newDeltaTransformer() *transformer {
+	return &transformer{
+		name: "delta",
+		new:  newDelta,
+	}
+}
+
+func newDelta(jctx *JCtx) (transform, error) {
+	rules := jctx.config.Transform.Delta
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	d := &delta{last: map[string]deltaSample{}, now: time.Now}
+	for i, rule := range rules {
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: invalid match %q: %v", i, rule.Match, err)
+		}
+		suffix := rule.Suffix
+		if suffix == "" {
+			suffix = "_delta"
+		}
+		d.rules = append(d.rules, deltaRule{re: re, suffix: suffix, counter: rule.Counter})
+	}
+	return d, nil
+}
+
+func (d *delta) rule(field string) *deltaRule {
+	for i, rule := range d.rules {
+		if rule.re.MatchString(field) {
+			return &d.rules[i]
+		}
+	}
+	return nil
+}
+
+// sweep forgets the series without a sample for seriesExpiry, at most once
+// per seriesExpiry
+func (d *delta) sweep(now time.Time) {
+	if now.Sub(d.swept) < seriesExpiry {
+		return
+	}
+	for key, s := range d.last {
+		if now.Sub(s.seen) >= seriesExpiry {
+			delete(d.last, key)
+		}
+	}
+	d.swept = now
+}
+
+func (d *delta) apply(points []*point) []*point {
+	d.Lock()
+	defer d.Unlock()
+
+	now := d.now()
+	d.sweep(now)
+	out := make([]*point, 0, len(points))
+	for _, p := range points {
+		var fields map[string]interface{}
+		for k, v := range p.Fields {
+			rule := d.rule(k)
+			if rule == nil {
+				continue
+			}
+			cur, _, ok := numericValue(v)
+			if !ok {
+				continue
+			}
+
+			key := seriesKey(p, k)
+			prev, seen := d.last[key]
+			d.last[key] = deltaSample{value: cur, seen: now}
+			if !seen {
+				continue
+			}
+			diff := cur - prev.value
+			if diff < 0 && rule.counter {
+				diff = cur
+			}
+			if fields == nil {
+				fields = copyFields(p.Fields)
+			}
+			fields[k+rule.suffix] = diff
+		}
+		if fields == nil {
+			out = append(out, p)
+		} else {
+			out = append(out, newPoint(p.Measurement, p.Tags, fields, p.Timestamp))
+		}
+	}
+	return out
+}
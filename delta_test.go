@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDelta(t *testing.T) {
+	jctx := &JCtx{}
+	jctx.config.Transform.Delta = []DeltaRule{
+		{Match: "errors$", Counter: true},
+		{Match: "temperature$", Suffix: "-change"},
+	}
+	if err := transformsInit(jctx); err != nil {
+		t.Fatalf("transformsInit failed: %v", err)
+	}
+
+	sample := func(errors uint64, temperature float64) *point {
+		return newPoint("m", map[string]string{"device": "r1"},
+			map[string]interface{}{"in-errors": errors, "temperature": temperature}, time.Unix(1, 0))
+	}
+
+	tests := []struct {
+		name        string
+		in          *point
+		errors      interface{}
+		temperature interface{}
+	}{
+		{"first-sample", sample(10, 40), nil, nil},
+		{"increase", sample(15, 42), 5.0, 2.0},
+		{"gauge-decrease", sample(15, 39), 0.0, -3.0},
+		{"counter-reset", sample(3, 39), 3.0, 0.0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := applyTransforms(jctx, []*point{test.in})
+			if got := out[0].Fields["in-errors_delta"]; got != test.errors {
+				t.Errorf("errors: got %v, want %v", got, test.errors)
+			}
+			if got := out[0].Fields["temperature-change"]; got != test.temperature {
+				t.Errorf("temperature: got %v, want %v", got, test.temperature)
+			}
+		})
+	}
+}
+
+func TestDeltaExpiry(t *testing.T) {
+	jctx := &JCtx{}
+	jctx.config.Transform.Delta = []DeltaRule{{Match: "errors$"}}
+	tr, err := newDelta(jctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := tr.(*delta)
+	now := time.Unix(1000, 0)
+	d.now = func() time.Time { return now }
+
+	sample := func(ifd string, errors float64) *point {
+		return newPoint("m", map[string]string{"device": "r1", "name": ifd},
+			map[string]interface{}{"in-errors": errors}, time.Unix(1, 0))
+	}
+	d.apply([]*point{sample("et-0/0/0", 1), sample("et-0/0/1", 1)})
+	now = now.Add(seriesExpiry / 2)
+	d.apply([]*point{sample("et-0/0/0", 2)})
+	now = now.Add(seriesExpiry / 2)
+	out := d.apply([]*point{sample("et-0/0/0", 4)})
+	if len(d.last) != 1 {
+		t.Errorf("got %d series after the expiry, want 1", len(d.last))
+	}
+	if got := out[0].Fields["in-errors_delta"]; got != 2.0 {
+		t.Errorf("delta of the kept series: got %v, want 2", got)
+	}
+	now = now.Add(seriesExpiry)
+	if out := d.apply([]*point{sample("et-0/0/1", 5)}); out[0].Fields["in-errors_delta"] != nil {
+		t.Errorf("delta of an expired series: got %v", out[0].Fields["in-errors_delta"])
+	}
+}
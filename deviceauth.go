@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	// AuthLoginCheck authenticates with the LoginCheck RPC of Junos
+	AuthLoginCheck = "login-check"
+	// AuthMeta sends the username and password in the metadata of the
+	// subscription
+	AuthMeta = "meta"
+	// AuthPerRPC sends the username and password in the metadata of every
+	// RPC, as gNMI targets expect, over TLS only
+	AuthPerRPC = "per-rpc"
+)
+
+// authMode is how jtimon authenticates to the device, "" for the default of
+// the vendor: LoginCheck for Junos, per RPC credentials for IOS XR
+func authMode(cfg Config) string {
+	if cfg.Auth != "" {
+		return cfg.Auth
+	}
+	if cfg.Meta {
+		return AuthMeta
+	}
+	return ""
+}
+
+func validateAuth(cfg Config) error {
+	switch cfg.Auth {
+	case "":
+		return nil
+	case AuthLoginCheck, AuthMeta:
+		if cfg.Vendor.Name != "" && cfg.Vendor.Name != "juniper-junos" {
+			return fmt.Errorf("auth %s is not supported for vendor %s", cfg.Auth, cfg.Vendor.Name)
+		}
+	case AuthPerRPC:
+		if !tlsEnabled(cfg.TLS) {
+			return fmt.Errorf("auth %s sends the password with every RPC, it needs tls", cfg.Auth)
+		}
+	default:
+		return fmt.Errorf("auth %q is not supported, use %s, %s or %s", cfg.Auth, AuthLoginCheck, AuthMeta, AuthPerRPC)
+	}
+	if cfg.Meta && cfg.Auth != AuthMeta {
+		return fmt.Errorf("meta and auth %s can not be used together", cfg.Auth)
+	}
+	return nil
+}
+
+// perRPCCredentials is the dial option of the per RPC credentials of the
+// device, nil without them
+func perRPCCredentials(jctx *JCtx) grpc.DialOption {
+	if authMode(jctx.config) != AuthPerRPC || jctx.config.User == "" {
+		return nil
+	}
+	return grpc.WithPerRPCCredentials(&loginCreds{
+		Username:   jctx.config.User,
+		Password:   jctx.config.Password,
+		requireTLS: true})
+}
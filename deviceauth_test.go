@@ -0,0 +1,121 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	auth_pb "github.com/nileshsimaria/jtimon/authentication"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestValidateAuth(t *testing.T) {
+	tls := TLSConfig{CA: "ca.crt"}
+	tests := []struct {
+		name string
+		cfg  Config
+		mode string
+		err  bool
+	}{
+		{name: "default", cfg: Config{}, mode: ""},
+		{name: "meta flag", cfg: Config{Meta: true}, mode: AuthMeta},
+		{name: "meta", cfg: Config{Auth: AuthMeta, Meta: true}, mode: AuthMeta},
+		{name: "login check", cfg: Config{Auth: AuthLoginCheck, Vendor: VendorConfig{Name: "juniper-junos"}}, mode: AuthLoginCheck},
+		{name: "per rpc", cfg: Config{Auth: AuthPerRPC, TLS: tls}, mode: AuthPerRPC},
+		{name: "per rpc skip verify", cfg: Config{Auth: AuthPerRPC, TLS: TLSConfig{SkipVerify: true}}, mode: AuthPerRPC},
+		{name: "per rpc without tls", cfg: Config{Auth: AuthPerRPC}, err: true},
+		{name: "meta and per rpc", cfg: Config{Auth: AuthPerRPC, Meta: true, TLS: tls}, err: true},
+		{name: "login check of ios xr", cfg: Config{Auth: AuthLoginCheck, Vendor: VendorConfig{Name: "cisco-iosxr"}}, err: true},
+		{name: "unknown", cfg: Config{Auth: "token"}, err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateAuth(test.cfg)
+			if (err != nil) != test.err {
+				t.Fatalf("got %v", err)
+			}
+			if err == nil && authMode(test.cfg) != test.mode {
+				t.Errorf("got mode %q, want %q", authMode(test.cfg), test.mode)
+			}
+		})
+	}
+}
+
+// testMetadataServer serves TLS with a self-signed certificate and hands the
+// metadata of the RPCs it gets to mds
+func testMetadataServer(t *testing.T) (addr string, mds chan metadata.MD, stop func()) {
+	dir, err := ioutil.TempDir("", "jtimon-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	testCert(t, dir, "device", nil, nil)
+	creds, err := credentials.NewServerTLSFromFile(filepath.Join(dir, "device.crt"), filepath.Join(dir, "device.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mds = make(chan metadata.MD, 1)
+	s := grpc.NewServer(grpc.Creds(creds), grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+		md, _ := metadata.FromIncomingContext(stream.Context())
+		mds <- md
+		return nil
+	}))
+	go s.Serve(lis)
+	return lis.Addr().String(), mds, s.Stop
+}
+
+// testRPCMetadata makes an RPC to addr with the dial options of the device
+// and returns the metadata the server got
+func testRPCMetadata(t *testing.T, jctx *JCtx, addr string, mds chan metadata.MD) metadata.MD {
+	vendor, err := getVendor(jctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := getGPRCDialOptions(jctx, vendor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := grpc.Dial(addr, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = auth_pb.NewLoginClient(conn).LoginCheck(ctx, &auth_pb.LoginRequest{})
+	select {
+	case md := <-mds:
+		return md
+	case <-time.After(time.Second):
+		t.Fatalf("no RPC: %v", err)
+	}
+	return nil
+}
+
+func TestPerRPCCredentials(t *testing.T) {
+	addr, mds, stop := testMetadataServer(t)
+	defer stop()
+
+	for _, vendorName := range []string{"juniper-junos", "cisco-iosxr"} {
+		t.Run(vendorName, func(t *testing.T) {
+			jctx := &JCtx{config: Config{
+				Host: "r1", User: "jtimon", Password: "s3cret", Auth: AuthPerRPC,
+				TLS: TLSConfig{SkipVerify: true}, Vendor: VendorConfig{Name: vendorName},
+			}}
+			md := testRPCMetadata(t, jctx, addr, mds)
+			if u, p := md["username"], md["password"]; len(u) != 1 || u[0] != "jtimon" || len(p) != 1 || p[0] != "s3cret" {
+				t.Errorf("got metadata %v", md)
+			}
+		})
+	}
+}
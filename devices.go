@@ -0,0 +1,382 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// reloadTimeout is how long the API waits for the worker to take a reload
+const reloadTimeout = 5 * time.Second
+
+// redacted replaces the secrets of the config served by the API
+const redacted = "<redacted>"
+
+// secretConfigKeys are the keys of the config whose values are secrets
+var secretConfigKeys = map[string]bool{
+	"password":          true,
+	"client-secret":     true,
+	"secret-access-key": true,
+	"session-token":     true,
+	"token":             true,
+	"connection-string": true,
+}
+
+// redactValue replaces the secrets in the JSON value v, the values of the
+// secret keys, of headers and the passwords of URLs
+func redactValue(key string, v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			if key == "headers" {
+				v[k] = redacted
+				continue
+			}
+			v[k] = redactValue(k, e)
+		}
+		return v
+	case []interface{}:
+		for i, e := range v {
+			v[i] = redactValue(key, e)
+		}
+		return v
+	case string:
+		if v == "" {
+			return v
+		}
+		if secretConfigKeys[key] {
+			return redacted
+		}
+		if u, err := url.Parse(v); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), "xxxxx")
+				return u.String()
+			}
+		}
+	}
+	return v
+}
+
+// redactConfig returns the config as JSON value without its secrets
+func redactConfig(cfg Config) (interface{}, error) {
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return redactValue("", v), nil
+}
+
+// findWorker returns the worker of the device name, the host or host:port
+// of its config, or the HTTP status if there is none or more than one
+func findWorker(name string) (*JCtx, int) {
+	host, port := name, 0
+	if i := strings.LastIndex(name, ":"); i != -1 {
+		if p, err := strconv.Atoi(name[i+1:]); err == nil {
+			host, port = name[:i], p
+		}
+	}
+	var found *JCtx
+	metricWorkers.Lock()
+	defer metricWorkers.Unlock()
+	for jctx := range metricWorkers.m {
+		if jctx.config.Host != host || (port != 0 && jctx.config.Port != port) {
+			continue
+		}
+		if found != nil {
+			return nil, http.StatusConflict
+		}
+		found = jctx
+	}
+	if found == nil {
+		return nil, http.StatusNotFound
+	}
+	return found, http.StatusOK
+}
+
+// findScopedWorker is findWorker for the devices in the scope, the others
+// are not found
+func findScopedWorker(scope apiScope, name string) (*JCtx, int) {
+	jctx, code := findWorker(name)
+	if code == http.StatusOK && !scope.allows(jctx) {
+		return nil, http.StatusNotFound
+	}
+	return jctx, code
+}
+
+// findWorkerError is the message of the status of findWorker
+func findWorkerError(name string, code int) string {
+	if code == http.StatusConflict {
+		return fmt.Sprintf("more than one device %s, use host:port", name)
+	}
+	return fmt.Sprintf("no device %s", name)
+}
+
+// deviceWorkers returns the workers of the host, all of them if host is
+// empty, sorted by host and port
+func deviceWorkers(host string) []*JCtx {
+	var workers []*JCtx
+	metricWorkers.Lock()
+	for jctx := range metricWorkers.m {
+		if host == "" || jctx.config.Host == host {
+			workers = append(workers, jctx)
+		}
+	}
+	metricWorkers.Unlock()
+	sort.Slice(workers, func(i, j int) bool {
+		if workers[i].config.Host != workers[j].config.Host {
+			return workers[i].config.Host < workers[j].config.Host
+		}
+		return workers[i].config.Port < workers[j].config.Port
+	})
+	return workers
+}
+
+// devicesHandler serves the API of the workers by device name:
+//
+//	GET  /devices/{name}/config         the running config, secrets redacted
+//	GET  /devices/{name}/paths          the subscription paths
+//	PUT  /devices/{name}/paths          replaces the subscription paths
+//	GET  /devices/{name}/freq           the frequencies set over the API
+//	PUT  /devices/{name}/freq           sets the frequency of a path
+//	DELETE /devices/{name}/freq?path=   puts back the configured frequency
+//	POST /devices/{name}/get            fetches the current data of a path
+//	GET  /devices/{name}/last           the last points of the paths
+//	GET  /devices/{name}/tail           streams the decoded points live
+//	POST /devices/{name}/capture        records the raw messages for a while
+//	POST /devices/{name}/reset-stats    starts the stats over
+//	POST /devices/{name}/flush-stats    writes the csv stats now
+func devicesHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/devices/"), "/"), "/")
+	if len(parts) != 2 || parts[0] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	jctx, code := findScopedWorker(requestScope(r.Context()), parts[0])
+	if code != http.StatusOK {
+		http.Error(w, findWorkerError(parts[0], code), code)
+		return
+	}
+
+	switch parts[1] {
+	case "config":
+		if r.Method != "GET" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		deviceConfig(w, jctx)
+	case "get":
+		if r.Method != "POST" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		deviceGet(w, r, jctx)
+	case "last":
+		if r.Method != "GET" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		deviceLast(w, r, jctx)
+	case "reset-stats", "flush-stats":
+		if r.Method != "POST" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if parts[1] == "reset-stats" {
+			deviceResetStats(w, jctx)
+		} else {
+			deviceFlushStats(w, jctx)
+		}
+	case "tail":
+		if r.Method != "GET" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		deviceTail(w, r, jctx)
+	case "capture":
+		if r.Method != "POST" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		deviceCapture(w, r, jctx)
+	case "freq":
+		deviceFreq(w, r, jctx)
+	case "paths":
+		switch r.Method {
+		case "GET":
+			writeJSON(w, devicePaths{Paths: jctx.config.Paths})
+		case "PUT":
+			putDevicePaths(w, r, jctx)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func deviceConfig(w http.ResponseWriter, jctx *JCtx) {
+	cfg, err := redactConfig(jctx.config)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, cfg)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
+
+// devicePaths is the body of /devices/{name}/paths, as in the config file
+type devicePaths struct {
+	Paths []PathsConfig `json:"paths"`
+}
+
+// pathsOverride is the paths of a worker set over the API, they replace
+// the paths of its config file until jtimon is restarted
+type pathsOverride struct {
+	sync.Mutex
+	paths []PathsConfig
+}
+
+func (o *pathsOverride) set(paths []PathsConfig) {
+	o.Lock()
+	defer o.Unlock()
+	o.paths = paths
+}
+
+// apply returns the paths set over the API, the paths of the config file if
+// there are none
+func (o *pathsOverride) apply(paths []PathsConfig) []PathsConfig {
+	o.Lock()
+	defer o.Unlock()
+	if o.paths == nil {
+		return paths
+	}
+	return o.paths
+}
+
+// putDevicePaths validates the new paths of the worker like a config
+// reload, sets them and reloads the worker which subscribes again. With
+// persist=true they are written to the config file of the worker instead.
+func putDevicePaths(w http.ResponseWriter, r *http.Request, jctx *JCtx) {
+	persist := false
+	if v := r.URL.Query().Get("persist"); v != "" {
+		var err error
+		if persist, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, fmt.Sprintf("invalid persist %q", v), http.StatusBadRequest)
+			return
+		}
+	}
+	var body devicePaths
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("invalid paths: %v", err), http.StatusBadRequest)
+		return
+	}
+	if code, err := setDevicePaths(r.Context(), jctx, body.Paths, persist); err != nil {
+		http.Error(w, err.Error(), code)
+		return
+	}
+	writeJSON(w, body)
+}
+
+// setDevicePaths sets the paths of the worker for the request of ctx, the
+// error comes with its HTTP status
+func setDevicePaths(ctx context.Context, jctx *JCtx, paths []PathsConfig, persist bool) (int, error) {
+	if len(paths) == 0 {
+		return http.StatusBadRequest, fmt.Errorf("paths are missing")
+	}
+	for _, p := range paths {
+		if p.Path == "" {
+			return http.StatusBadRequest, fmt.Errorf("path can not be empty")
+		}
+	}
+	cfg := jctx.config
+	cfg.Paths = paths
+	if _, err := ValidateConfig(cfg); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid paths: %v", err)
+	}
+
+	if persist {
+		if err := persistPaths(jctx.file, paths); err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("could not write %s: %v", jctx.file, err)
+		}
+		jctx.pathsSet.set(nil)
+	} else {
+		jctx.pathsSet.set(paths)
+	}
+	jLog(jctx, fmt.Sprintf("%s: paths changed over the API (persist %t)", jctx.config.Host, persist))
+	auditChange(ctx, jctx.config.Host, devicePaths{Paths: jctx.config.Paths}, devicePaths{Paths: paths})
+	if !reloadWorker(jctx) {
+		return http.StatusServiceUnavailable, fmt.Errorf("the worker did not take the reload, the paths apply with the next one")
+	}
+	return http.StatusOK, nil
+}
+
+// reloadWorker makes the worker read its config again as on SIGHUP, it
+// returns false if the worker does not take it within reloadTimeout
+func reloadWorker(jctx *JCtx) bool {
+	if jctx.signalch == nil {
+		return false
+	}
+	select {
+	case jctx.signalch <- syscall.SIGHUP:
+		return true
+	case <-time.After(reloadTimeout):
+		return false
+	}
+}
+
+// persistPaths replaces the paths of the config file, the other settings are
+// kept as they are. The file is replaced at once so that a reload never
+// reads half of it.
+func persistPaths(file string, paths []PathsConfig) error {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	b, err := readConfigFile(file)
+	if err != nil {
+		return err
+	}
+	var cfg map[string]json.RawMessage
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return err
+	}
+	if cfg["paths"], err = json.Marshal(paths); err != nil {
+		return err
+	}
+	if b, err = json.MarshalIndent(cfg, "", "    "); err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	// an encrypted config stays encrypted
+	if isEncrypted(raw) {
+		key, err := masterKey()
+		if err != nil {
+			return err
+		}
+		if b, err = encryptConfig(key, b); err != nil {
+			return err
+		}
+	}
+	return replaceFile(file, b)
+}
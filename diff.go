@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	na_pb "github.com/nileshsimaria/jtimon/telemetry"
+	flag "github.com/spf13/pflag"
+)
+
+var diffValues = flag.Int("diff-values", 20, "Most values jtimon diff lists per kind of difference, 0 for all")
+
+// diffTolerance is how much the interval of a sensor may change between two
+// recordings, relative to the first, before jtimon diff reports it
+const diffTolerance = 0.1
+
+// sensorTiming are the messages of a sensor of a recording and their device
+// timestamps
+type sensorTiming struct {
+	messages uint64
+	first    uint64
+	last     uint64
+}
+
+// interval is the mean time between the messages
+func (s *sensorTiming) interval() time.Duration {
+	if s.messages < 2 {
+		return 0
+	}
+	return time.Duration((s.last-s.first)/(s.messages-1)) * time.Millisecond
+}
+
+// recording is what jtimon diff compares of a recording: the timing of its
+// sensors and the last value of each of its leaves
+type recording struct {
+	messages uint64
+	sensors  map[string]*sensorTiming
+	values   map[string]interface{}
+}
+
+// kvValue is the value of kv, nil without one
+func kvValue(kv *na_pb.KeyValue) interface{} {
+	switch v := kv.Value.(type) {
+	case *na_pb.KeyValue_DoubleValue:
+		return v.DoubleValue
+	case *na_pb.KeyValue_IntValue:
+		return v.IntValue
+	case *na_pb.KeyValue_UintValue:
+		return v.UintValue
+	case *na_pb.KeyValue_SintValue:
+		return v.SintValue
+	case *na_pb.KeyValue_BoolValue:
+		return v.BoolValue
+	case *na_pb.KeyValue_StrValue:
+		return v.StrValue
+	case *na_pb.KeyValue_BytesValue:
+		return fmt.Sprintf("%x", v.BytesValue)
+	}
+	return nil
+}
+
+// toFloat is the number v, ok is false if it is not one
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// recordingFile is the name jtimon record gave the recording of file, the
+// name of its config file, which may be given with the suffix of either of
+// its files
+func recordingFile(file string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(file, ".testmeta"), ".testbytes")
+}
+
+// readRecording reads the Junos recording of file
+func readRecording(file string) (*recording, error) {
+	r := &recording{sensors: map[string]*sensorTiming{}, values: map[string]interface{}{}}
+	jctx := &JCtx{file: recordingFile(file)}
+	n, err := eachRecorded(jctx, func(ocData *na_pb.OpenConfigData) {
+		sensor := sensorPath(ocData.Path)
+		s, ok := r.sensors[sensor]
+		if !ok {
+			s = &sensorTiming{first: ocData.Timestamp}
+			r.sensors[sensor] = s
+		}
+		s.messages++
+		s.last = ocData.Timestamp
+		packetLeaves(ocData, func(path string, kv *na_pb.KeyValue) {
+			if path != "" {
+				r.values[path] = kvValue(kv)
+			}
+		})
+	})
+	r.messages = uint64(n)
+	return r, err
+}
+
+// sortedKeys are the keys of m, sorted
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// diffList writes the title and up to max of the lines, 0 for all of them
+func diffList(w io.Writer, title string, lines []string, max int) {
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s (%d):\n", title, len(lines))
+	for i, l := range lines {
+		if max > 0 && i == max {
+			fmt.Fprintf(w, "  ... %d more\n", len(lines)-max)
+			break
+		}
+		fmt.Fprintf(w, "  %s\n", l)
+	}
+}
+
+// diffRecordings writes the differences of the recordings a and b to w: the
+// sensors of only one of them, the sensors which sent another number of
+// messages or at another interval, and the values of their leaves. It
+// tells whether they differ.
+func diffRecordings(w io.Writer, a, b *recording, max int) bool {
+	sensors := map[string]interface{}{}
+	for s := range a.sensors {
+		sensors[s] = nil
+	}
+	for s := range b.sensors {
+		sensors[s] = nil
+	}
+	fmt.Fprintf(w, "%-40s %24s %24s\n", "sensor", "a", "b")
+	timing := func(s *sensorTiming) string {
+		if s == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%d every %v", s.messages, s.interval())
+	}
+	differ := false
+	for _, s := range sortedKeys(sensors) {
+		sa, sb := a.sensors[s], b.sensors[s]
+		mark := ""
+		if sa == nil || sb == nil || sa.messages != sb.messages ||
+			math.Abs(float64(sb.interval()-sa.interval())) > diffTolerance*float64(sa.interval()) {
+			mark = " *"
+			differ = true
+		}
+		fmt.Fprintf(w, "%-40s %24s %24s%s\n", s, timing(sa), timing(sb), mark)
+	}
+	fmt.Fprintf(w, "%-40s %24d %24d\n\n", "messages", a.messages, b.messages)
+
+	var onlyA, onlyB, changed []string
+	for _, k := range sortedKeys(a.values) {
+		va := a.values[k]
+		vb, ok := b.values[k]
+		switch {
+		case !ok:
+			onlyA = append(onlyA, fmt.Sprintf("%s: %v", k, va))
+		case va != vb:
+			fa, okA := toFloat(va)
+			fb, okB := toFloat(vb)
+			if okA && okB {
+				changed = append(changed, fmt.Sprintf("%s: %v -> %v (%+g)", k, va, vb, fb-fa))
+			} else {
+				changed = append(changed, fmt.Sprintf("%s: %v -> %v", k, va, vb))
+			}
+		}
+	}
+	for _, k := range sortedKeys(b.values) {
+		if _, ok := a.values[k]; !ok {
+			onlyB = append(onlyB, fmt.Sprintf("%s: %v", k, b.values[k]))
+		}
+	}
+	fmt.Fprintf(w, "leaves: %d in a, %d in b, %d only in a, %d only in b, %d changed\n",
+		len(a.values), len(b.values), len(onlyA), len(onlyB), len(changed))
+	diffList(w, "only in a", onlyA, max)
+	diffList(w, "only in b", onlyB, max)
+	diffList(w, "changed", changed, max)
+	return differ || len(onlyA) != 0 || len(onlyB) != 0 || len(changed) != 0
+}
+
+// diffMain runs "jtimon diff a b", it exits with status 1 if the recordings
+// differ and 2 if one can not be read
+func diffMain(args []string) {
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "jtimon diff: two recordings are compared, run \"jtimon help diff\"\n")
+		os.Exit(2)
+	}
+	var recs [2]*recording
+	for i, file := range args {
+		r, err := readRecording(file)
+		if err != nil {
+			log.Printf("diff: %v", err)
+			os.Exit(2)
+		}
+		recs[i] = r
+	}
+	fmt.Printf("a: %s\nb: %s\n\n", recordingFile(args[0]), recordingFile(args[1]))
+	if diffRecordings(os.Stdout, recs[0], recs[1], *diffValues) {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	na_pb "github.com/nileshsimaria/jtimon/telemetry"
+)
+
+// writeRecording writes the messages as jtimon record does, to
+// file.testmeta and file.testbytes
+func writeRecording(t *testing.T, file string, messages ...*na_pb.OpenConfigData) {
+	var meta, data bytes.Buffer
+	for _, m := range messages {
+		b, err := proto.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&meta, "%d:", len(b))
+		data.Write(b)
+	}
+	if err := ioutil.WriteFile(file+".testmeta", meta.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file+".testbytes", data.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiffRecordings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	packet := func(sensor string, ts uint64, kvs ...*na_pb.KeyValue) *na_pb.OpenConfigData {
+		return &na_pb.OpenConfigData{Path: "sensor_1000:" + sensor + ":" + sensor + ":PFE", Timestamp: ts, Kv: kvs}
+	}
+	prefix := &na_pb.KeyValue{Key: "__prefix__", Value: &na_pb.KeyValue_StrValue{StrValue: "/interfaces/interface[name='ge-0/0/0']/"}}
+	octets := func(v uint64) *na_pb.KeyValue {
+		return &na_pb.KeyValue{Key: "state/counters/in-octets", Value: &na_pb.KeyValue_UintValue{UintValue: v}}
+	}
+	status := func(v string) *na_pb.KeyValue {
+		return &na_pb.KeyValue{Key: "state/oper-status", Value: &na_pb.KeyValue_StrValue{StrValue: v}}
+	}
+	mtu := &na_pb.KeyValue{Key: "state/mtu", Value: &na_pb.KeyValue_UintValue{UintValue: 1514}}
+	ts := &na_pb.KeyValue{Key: "__timestamp__", Value: &na_pb.KeyValue_UintValue{UintValue: 1}}
+	cpu := &na_pb.KeyValue{Key: "/components/component[name='re0']/cpu", Value: &na_pb.KeyValue_IntValue{IntValue: 5}}
+
+	a, b, same := filepath.Join(dir, "a.json"), filepath.Join(dir, "b.json"), filepath.Join(dir, "same.json")
+	writeRecording(t, a,
+		packet("/interfaces/", 10000, ts, prefix, octets(100), status("UP"), mtu),
+		packet("/interfaces/", 12000, prefix, octets(200), status("UP"), mtu),
+		packet("/interfaces/", 14000, prefix, octets(300), status("UP"), mtu),
+		packet("/components/", 14000, cpu))
+	writeRecording(t, b,
+		packet("/interfaces/", 10000, ts, prefix, octets(100), status("UP")),
+		packet("/interfaces/", 15000, prefix, octets(250), status("DOWN")),
+		packet("/interfaces/", 20000, prefix, octets(400), status("DOWN")))
+	writeRecording(t, same,
+		packet("/interfaces/", 30000, ts, prefix, octets(100), status("UP"), mtu),
+		packet("/interfaces/", 32000, prefix, octets(200), status("UP"), mtu),
+		packet("/interfaces/", 34100, prefix, octets(300), status("UP"), mtu),
+		packet("/components/", 34000, cpu))
+
+	read := func(file string) *recording {
+		r, err := readRecording(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	ra, rb, rs := read(a+".testmeta"), read(b), read(same+".testbytes")
+
+	tests := []struct {
+		name   string
+		a, b   *recording
+		max    int
+		differ bool
+		want   string
+	}{
+		{"upgrade", ra, rb, 0, true, `sensor                                                          a                        b
+/components/                                           1 every 0s                        - *
+/interfaces/                                           3 every 2s               3 every 5s *
+messages                                                        4                        3
+
+leaves: 4 in a, 2 in b, 2 only in a, 0 only in b, 2 changed
+only in a (2):
+  /components/component[name='re0']/cpu: 5
+  /interfaces/interface[name='ge-0/0/0']/state/mtu: 1514
+changed (2):
+  /interfaces/interface[name='ge-0/0/0']/state/counters/in-octets: 300 -> 400 (+100)
+  /interfaces/interface[name='ge-0/0/0']/state/oper-status: UP -> DOWN
+`},
+		{"most", ra, rb, 1, true, `sensor                                                          a                        b
+/components/                                           1 every 0s                        - *
+/interfaces/                                           3 every 2s               3 every 5s *
+messages                                                        4                        3
+
+leaves: 4 in a, 2 in b, 2 only in a, 0 only in b, 2 changed
+only in a (2):
+  /components/component[name='re0']/cpu: 5
+  ... 1 more
+changed (2):
+  /interfaces/interface[name='ge-0/0/0']/state/counters/in-octets: 300 -> 400 (+100)
+  ... 1 more
+`},
+		{"reversed", rb, ra, 20, true, `sensor                                                          a                        b
+/components/                                                    -               1 every 0s *
+/interfaces/                                           3 every 5s               3 every 2s *
+messages                                                        3                        4
+
+leaves: 2 in a, 4 in b, 0 only in a, 2 only in b, 2 changed
+only in b (2):
+  /components/component[name='re0']/cpu: 5
+  /interfaces/interface[name='ge-0/0/0']/state/mtu: 1514
+changed (2):
+  /interfaces/interface[name='ge-0/0/0']/state/counters/in-octets: 400 -> 300 (-100)
+  /interfaces/interface[name='ge-0/0/0']/state/oper-status: DOWN -> UP
+`},
+		// the interval is within the tolerance, and the timestamps are not compared
+		{"same", ra, rs, 20, false, `sensor                                                          a                        b
+/components/                                           1 every 0s               1 every 0s
+/interfaces/                                           3 every 2s            3 every 2.05s
+messages                                                        4                        4
+
+leaves: 4 in a, 4 in b, 0 only in a, 0 only in b, 0 changed
+`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if differ := diffRecordings(&buf, test.a, test.b, test.max); differ != test.differ {
+				t.Errorf("diffRecordings() = %v, want %v", differ, test.differ)
+			}
+			if buf.String() != test.want {
+				t.Errorf("diffRecordings() wrote\n%s\nwant\n%s", buf.String(), test.want)
+			}
+		})
+	}
+
+	if _, err := readRecording(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("readRecording() of a missing recording = nil")
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"syscall"
+	"text/template"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	discoveryTemplate = flag.String("discovery-template", "", "Template (Go text/template) of the config file of each discovered device, with its .Name, .Address, .Port, .Site, .Role, .Platform, .Tags and .Meta")
+	discoveryDir      = flag.String("discovery-dir", "", "Directory the config files of the discovered devices are written to (default a temporary directory)")
+	discoveryIntvl    = flag.Int("discovery-interval", 60, "Interval in seconds of the queries of the discovery sources")
+)
+
+// discoveredDevice is a device found by a discovery source, the template of
+// --discovery-template is executed with it
+type discoveredDevice struct {
+	Name    string
+	Address string
+	// Port is the port of the device in the source, 0 if it has none
+	Port     int
+	Site     string
+	Role     string
+	Platform string
+	Tags     []string
+	// Meta are the other fields of the device in the source, e.g. the
+	// custom fields of NetBox or the metadata of Consul
+	Meta map[string]string
+}
+
+// discoverySource finds the devices to collect
+type discoverySource interface {
+	// name is the name of the source, the prefix of the config files of
+	// its devices
+	name() string
+	devices() ([]discoveredDevice, error)
+}
+
+// configWatcher finds the changes of a set of config files, e.g. those of
+// the devices of a discovery source
+type configWatcher interface {
+	name() string
+	// sync returns the config files added, changed and removed since the
+	// last call
+	sync() (discoveryChange, error)
+	// count is the number of config files
+	count() int
+	// interval is the time between two calls of sync
+	interval() time.Duration
+}
+
+// discoveryChange are the config files of the devices of a source added,
+// changed and removed by a query
+type discoveryChange struct {
+	added, changed, removed []string
+}
+
+func (c discoveryChange) empty() bool {
+	return len(c.added) == 0 && len(c.changed) == 0 && len(c.removed) == 0
+}
+
+// discovery writes the config files of the devices of a source
+type discovery struct {
+	source discoverySource
+	tmpl   *template.Template
+	dir    string
+	// files are the contents of the config files written, by file
+	files map[string][]byte
+}
+
+// discoveryFuncs are the functions of the template, json quotes the values
+// in the JSON of the config
+var discoveryFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+func newDiscovery(source discoverySource, tmpl *template.Template, dir string) *discovery {
+	return &discovery{source: source, tmpl: tmpl, dir: dir, files: map[string][]byte{}}
+}
+
+func (d *discovery) name() string {
+	return d.source.name()
+}
+
+func (d *discovery) count() int {
+	return len(d.files)
+}
+
+func (d *discovery) interval() time.Duration {
+	return time.Duration(*discoveryIntvl) * time.Second
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// file is the config file of the device
+func (d *discovery) file(dev discoveredDevice) string {
+	return filepath.Join(d.dir, d.source.name()+"-"+unsafeFileChars.ReplaceAllString(dev.Name, "_")+".json")
+}
+
+// sync queries the source and writes the config files of its devices. The
+// config files of the devices which are no longer found are removed, those
+// whose new config is invalid are kept. Nothing changes when the source
+// can not be queried.
+func (d *discovery) sync() (discoveryChange, error) {
+	var c discoveryChange
+	devices, err := d.source.devices()
+	if err != nil {
+		return c, err
+	}
+	files := map[string][]byte{}
+	for _, dev := range devices {
+		file := d.file(dev)
+		if _, ok := files[file]; ok {
+			globalLog(LogLevelWarn, fmt.Sprintf("Discovery: %s: device %s found twice, only the first one is collected", d.source.name(), dev.Name))
+			continue
+		}
+		var b bytes.Buffer
+		err := d.tmpl.Execute(&b, dev)
+		if err == nil {
+			err = validateConfigJSON(b.Bytes())
+		}
+		if err != nil {
+			globalLog(LogLevelError, fmt.Sprintf("Discovery: %s: invalid config of device %s: %v", d.source.name(), dev.Name, err))
+			if old, ok := d.files[file]; ok {
+				files[file] = old
+			}
+			continue
+		}
+		old, ok := d.files[file]
+		if ok && bytes.Equal(old, b.Bytes()) {
+			files[file] = old
+			continue
+		}
+		if ok {
+			err = replaceFile(file, b.Bytes())
+		} else {
+			err = ioutil.WriteFile(file, b.Bytes(), 0600)
+		}
+		if err != nil {
+			globalLog(LogLevelError, fmt.Sprintf("Discovery: %s: could not write the config of device %s: %v", d.source.name(), dev.Name, err))
+			if ok {
+				files[file] = old
+			}
+			continue
+		}
+		files[file] = b.Bytes()
+		if ok {
+			c.changed = append(c.changed, file)
+		} else {
+			c.added = append(c.added, file)
+		}
+	}
+	for file := range d.files {
+		if _, ok := files[file]; !ok {
+			os.Remove(file)
+			c.removed = append(c.removed, file)
+		}
+	}
+	d.files = files
+	sort.Strings(c.added)
+	sort.Strings(c.changed)
+	sort.Strings(c.removed)
+	return c, nil
+}
+
+// discoverySources returns the sources of the flags
+func discoverySources() ([]discoverySource, error) {
+	var sources []discoverySource
+	if *netboxURL != "" {
+		s, err := newNetboxSource(*netboxURL, *netboxFilter)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, s)
+	}
+	if *consulCatalog != "" {
+		s, err := newConsulCatalogSource(*consulCatalog)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, s)
+	}
+	return sources, nil
+}
+
+// discoveryEnabled tells whether the devices of a source or of a config
+// directory are collected, the config files are then optional
+func discoveryEnabled() bool {
+	return *netboxURL != "" || *consulCatalog != "" || len(*configDirs) != 0
+}
+
+// discoveryInit returns the watchers of the config directories and the
+// discoveries of the sources of the flags
+func discoveryInit() ([]configWatcher, error) {
+	watchers, err := configDirsInit()
+	if err != nil {
+		return nil, err
+	}
+	sources, err := discoverySources()
+	if err != nil || len(sources) == 0 {
+		return watchers, err
+	}
+	if *discoveryTemplate == "" {
+		return nil, fmt.Errorf("--discovery-template is required to collect the discovered devices")
+	}
+	if *discoveryIntvl <= 0 {
+		return nil, fmt.Errorf("--discovery-interval must be positive")
+	}
+	tmpl, err := template.New(filepath.Base(*discoveryTemplate)).Funcs(discoveryFuncs).Option("missingkey=zero").ParseFiles(*discoveryTemplate)
+	if err != nil {
+		return nil, err
+	}
+	dir := *discoveryDir
+	if dir == "" {
+		if dir, err = ioutil.TempDir("", "jtimon-discovery-"); err != nil {
+			return nil, err
+		}
+	} else if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	for _, s := range sources {
+		watchers = append(watchers, newDiscovery(s, tmpl, dir))
+	}
+	return watchers, nil
+}
+
+// runDiscovery syncs the watcher at its interval and hands the changes of
+// the config files to the signal handler, which adds, reloads and deletes
+// their workers
+func (ws *JWorkers) runDiscovery(w configWatcher) {
+	defer ws.wg.Done()
+	failed := ""
+	t := time.NewTicker(w.interval())
+	defer t.Stop()
+	for {
+		c, err := w.sync()
+		switch {
+		case err != nil:
+			if err.Error() != failed {
+				globalLog(LogLevelError, fmt.Sprintf("Discovery: %s: %v", w.name(), err))
+				failed = err.Error()
+			}
+		case !c.empty():
+			failed = ""
+			globalLog(LogLevelInfo, fmt.Sprintf("Discovery: %s: %d devices, %d added, %d changed, %d removed",
+				w.name(), w.count(), len(c.added), len(c.changed), len(c.removed)))
+			select {
+			case ws.discovered <- c:
+			case <-ws.discoveryDone:
+				return
+			}
+		default:
+			failed = ""
+		}
+		select {
+		case <-ws.discoveryDone:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// stopDiscovery stops the queries of the sources
+func (ws *JWorkers) stopDiscovery() {
+	ws.discoveryOnce.Do(func() { close(ws.discoveryDone) })
+}
+
+// applyDiscovery adds, reloads and deletes the workers of the config files
+// of the discovered devices, as handleConfigChanges does for the config
+// file list
+func (ws *JWorkers) applyDiscovery(c discoveryChange) {
+	for _, file := range append(c.added, c.changed...) {
+		ws.discoveredFiles[file] = true
+		if w, ok := ws.m[file]; ok {
+			log.Printf("sending sighup to the worker for %v", file)
+			w.signalch <- syscall.SIGHUP
+			continue
+		}
+		log.Printf("adding a new worker for %v", file)
+		ws.StartWorker(file)
+	}
+	for _, file := range c.removed {
+		delete(ws.discoveredFiles, file)
+		if w, ok := ws.m[file]; ok {
+			log.Printf("deleting worker for %v", file)
+			w.signalch <- os.Interrupt
+			delete(ws.m, file)
+		}
+	}
+}
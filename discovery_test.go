@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"text/template"
+)
+
+// fakeSource is a discovery source returning the devices set by the test
+type fakeSource struct {
+	found []discoveredDevice
+	err   error
+}
+
+func (f *fakeSource) name() string {
+	return "fake"
+}
+
+func (f *fakeSource) devices() ([]discoveredDevice, error) {
+	return f.found, f.err
+}
+
+func TestDiscoverySync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-discovery-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tmpl := template.Must(template.New("device").Funcs(discoveryFuncs).Parse(
+		`{"host": {{json .Address}}, "port": 32767, "paths": [{"path": "/interfaces", "freq": {{or (index .Meta "freq") "10000"}}}]}`))
+	src := &fakeSource{found: []discoveredDevice{
+		{Name: "r1", Address: "10.0.0.1", Meta: map[string]string{}},
+		{Name: "r2/re0", Address: "10.0.0.2", Meta: map[string]string{}},
+	}}
+	d := newDiscovery(src, tmpl, dir)
+	r1, r2 := filepath.Join(dir, "fake-r1.json"), filepath.Join(dir, "fake-r2_re0.json")
+
+	c, err := d.sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c, discoveryChange{added: []string{r1, r2}}) {
+		t.Errorf("first sync() = %+v", c)
+	}
+	config, err := NewJTIMONConfig(r1)
+	if err != nil || config.Host != "10.0.0.1" || config.Paths[0].Freq != 10000 {
+		t.Errorf("config of r1 %+v, %v", config, err)
+	}
+
+	if c, err := d.sync(); err != nil || !c.empty() {
+		t.Errorf("sync() without change = %+v, %v", c, err)
+	}
+
+	// an invalid config keeps the previous one, a device gone is removed
+	src.found = []discoveredDevice{
+		{Name: "r1", Address: "10.0.0.1", Meta: map[string]string{"freq": "2000"}},
+		{Name: "r2/re0", Address: "10.0.0.2", Meta: map[string]string{"freq": "fast"}},
+	}
+	if c, err := d.sync(); err != nil || !reflect.DeepEqual(c, discoveryChange{changed: []string{r1}}) {
+		t.Errorf("sync() of a changed and an invalid config = %+v, %v", c, err)
+	}
+	if config, _ := NewJTIMONConfig(r1); config.Paths[0].Freq != 2000 {
+		t.Errorf("freq of r1 %d after its change", config.Paths[0].Freq)
+	}
+	if _, err := os.Stat(r2); err != nil {
+		t.Errorf("the config of r2 was removed for its invalid change: %v", err)
+	}
+
+	src.err = fmt.Errorf("unreachable")
+	if _, err := d.sync(); err == nil {
+		t.Errorf("sync() of an unreachable source did not fail")
+	}
+	src.found, src.err = src.found[:1], nil
+	if c, err := d.sync(); err != nil || !reflect.DeepEqual(c, discoveryChange{removed: []string{r2}}) {
+		t.Errorf("sync() of a device gone = %+v, %v", c, err)
+	}
+	if _, err := os.Stat(r2); !os.IsNotExist(err) {
+		t.Errorf("the config of the device gone was not removed: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+var drainTimeout = flag.Int("drain-timeout", 10, "Seconds jtimon waits on SIGINT, SIGTERM or --max-run for the received updates and pending batches to be written, 0 to not wait")
+
+// The exit statuses of jtimon run
+const (
+	// ExitOK is a run stopped by SIGINT, SIGTERM or --max-run with all of
+	// its updates written
+	ExitOK = 0
+	// ExitWorkerFailed is a run in which a worker stopped on an error
+	ExitWorkerFailed = 1
+	// ExitNotDrained is a run which stopped before all of its updates were
+	// written, the drain timed out or a second signal cut it short
+	ExitNotDrained = 3
+)
+
+// exitStatus is the exit status of the run, the highest one set
+var exitStatus int32
+
+// setExitStatus raises the exit status of the run to status
+func setExitStatus(status int32) {
+	for {
+		cur := atomic.LoadInt32(&exitStatus)
+		if status <= cur || atomic.CompareAndSwapInt32(&exitStatus, cur, status) {
+			return
+		}
+	}
+}
+
+// drainDeadline is the time the workers stopping now have to write their
+// updates
+func drainDeadline() time.Time {
+	return time.Now().Add(time.Duration(*drainTimeout) * time.Second)
+}
+
+// stopStreaming asks the subscription of the worker to stop and waits for
+// it until the deadline if the worker is streaming. A worker which is not,
+// e.g. waiting to reconnect, gets it when it checks.
+func stopStreaming(jctx *JCtx, deadline time.Time) {
+	taken := make(chan struct{})
+	go func() {
+		jctx.control <- os.Interrupt
+		close(taken)
+	}()
+	if !jctx.running {
+		return
+	}
+	t := time.NewTimer(time.Until(deadline))
+	defer t.Stop()
+	select {
+	case <-taken:
+	case <-t.C:
+	}
+}
+
+// drainWorker writes the updates the worker received before it stopped
+// streaming: the ones in its pipeline, then its accumulated points and
+// batches to InfluxDB and to the sinks, which spool what they fail to
+// write. It tells whether all of them were written by the deadline.
+func drainWorker(jctx *JCtx, deadline time.Time) bool {
+	if *drainTimeout <= 0 {
+		return true
+	}
+	drained := true
+	if jctx.pipeline != nil && !jctx.pipeline.wait(deadline) {
+		jLogWarn(jctx, fmt.Sprintf("Drain timed out, %d updates left in the pipeline", atomic.LoadInt64(&jctx.pipeline.pending)))
+		drained = false
+	}
+	routesFlush(jctx)
+	if t := jctx.influxCtx.accumulateTask; t != nil {
+		t.flush()
+	}
+	if t := jctx.influxCtx.batchTask; t != nil {
+		t.flush()
+	}
+	for _, w := range jctx.influxCtx.writers {
+		if !w.flush(deadline) {
+			jLogWarn(jctx, fmt.Sprintf("Drain timed out, batches left for InfluxDB %s", w.addr))
+			drained = false
+		}
+	}
+	for _, s := range jctx.sinks {
+		if s.task != nil {
+			s.task.flush()
+		}
+	}
+	return drained
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	client "github.com/influxdata/influxdb/client/v2"
+	"github.com/nileshsimaria/jtimon/simulator"
+)
+
+// influxCounter serves InfluxDB and counts the points written, the writes
+// wait for release if it is set
+type influxCounter struct {
+	*httptest.Server
+	mu      sync.Mutex
+	points  int
+	release chan struct{}
+}
+
+func newInfluxCounter(release chan struct{}) (*influxCounter, string, int) {
+	c := &influxCounter{release: release}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/write" {
+			if c.release != nil {
+				<-c.release
+			}
+			b, _ := ioutil.ReadAll(r.Body)
+			c.mu.Lock()
+			c.points += strings.Count(string(b), "\n")
+			c.mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"results":[{}]}`))
+	}))
+	u, _ := url.Parse(c.URL)
+	host, port, _ := net.SplitHostPort(u.Host)
+	p, _ := strconv.Atoi(port)
+	return c, host, p
+}
+
+func (c *influxCounter) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.points
+}
+
+func TestSetExitStatus(t *testing.T) {
+	defer atomic.StoreInt32(&exitStatus, 0)
+	for _, s := range []int32{ExitWorkerFailed, ExitNotDrained, ExitWorkerFailed, ExitOK} {
+		setExitStatus(s)
+	}
+	if s := atomic.LoadInt32(&exitStatus); s != ExitNotDrained {
+		t.Errorf("exitStatus = %d, want %d", s, ExitNotDrained)
+	}
+}
+
+func TestSchedTaskFlush(t *testing.T) {
+	var runs int32
+	task := schedule(time.Hour, func() { atomic.AddInt32(&runs, 1) })
+	task.flush()
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Errorf("%d runs after flush, want 1", n)
+	}
+}
+
+func TestPipelineWait(t *testing.T) {
+	release := make(chan struct{})
+	p := &pipeline{policy: BackpressureBlock, drops: &dropCounters{}}
+	for _, name := range []string{"decode", "export"} {
+		s := &pipelineStage{name: name, ch: make(chan *pipelineMsg, 10)}
+		s.process = func(m *pipelineMsg) *pipelineMsg {
+			if s.name == "export" {
+				<-release
+			}
+			return m
+		}
+		if len(p.stages) != 0 {
+			p.stages[0].next = s
+		}
+		p.stages = append(p.stages, s)
+		go p.run(s)
+	}
+	for i := 0; i < 3; i++ {
+		p.submit(nil, time.Now(), nil)
+	}
+	if p.wait(time.Now().Add(50 * time.Millisecond)) {
+		t.Errorf("wait() = true with the export stage held up")
+	}
+	close(release)
+	if !p.wait(time.Now().Add(5 * time.Second)) {
+		t.Errorf("wait() = false, %d updates pending", atomic.LoadInt64(&p.pending))
+	}
+}
+
+func TestDrainWorker(t *testing.T) {
+	for _, shared := range []bool{false, true} {
+		t.Run(fmt.Sprintf("shared=%v", shared), func(t *testing.T) {
+			release := make(chan struct{})
+			s, host, port := newInfluxCounter(release)
+			defer s.Close()
+
+			jctx := &JCtx{}
+			jctx.config.Host = "r1"
+			jctx.config.Influx = InfluxConfig{Server: host, Port: port, Dbname: fmt.Sprintf("drain%v", shared),
+				HTTPTimeout: 5, BatchFrequency: 3600000, Shared: shared}
+			fillupDefaults(&jctx.config)
+			influxInit(jctx)
+
+			point := func() []*client.Point {
+				pt, _ := client.NewPoint("m", map[string]string{"device": "r1"}, map[string]interface{}{"/a": 1.0}, time.Unix(1, 0))
+				return []*client.Point{pt}
+			}
+			// the batches of the hour are written by the drain, the
+			// writes are held up until the drain times out
+			jctx.influxCtx.batchWCh <- point()
+			jctx.influxCtx.batchWCh <- point()
+			if drainWorker(jctx, time.Now().Add(100*time.Millisecond)) {
+				t.Errorf("drainWorker() = true with InfluxDB held up")
+			}
+			close(release)
+			if !drainWorker(jctx, time.Now().Add(5*time.Second)) {
+				t.Errorf("drainWorker() = false")
+			}
+			if n := s.count(); n != 2 {
+				t.Errorf("%d points written, want 2", n)
+			}
+		})
+	}
+}
+
+func TestDrainOnMaxRun(t *testing.T) {
+	defer func(n bool) { *noppgoroutines = n }(*noppgoroutines)
+	*noppgoroutines = true
+	defer atomic.StoreInt32(&exitStatus, 0)
+
+	dir, err := ioutil.TempDir("", "jtimon-drain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sim, err := simulator.Start("127.0.0.1:0", simulator.DefaultScript())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Stop()
+	_, simPort, _ := net.SplitHostPort(sim.Addr())
+	s, host, port := newInfluxCounter(nil)
+	defer s.Close()
+
+	// the batches are written every hour, only the drain writes them
+	file := filepath.Join(dir, "sim.json")
+	config := fmt.Sprintf(`{"host": "127.0.0.1", "port": %s, "paths": [{"path": "/interfaces", "freq": 100}],
+		"influx": {"server": %q, "port": %d, "dbname": "drain", "batchfrequency": 3600000}}`, simPort, host, port)
+	if err := ioutil.WriteFile(file, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	workers := NewJWorkers([]string{file}, "", 2)
+	workers.StartWorkers()
+	workers.Wait()
+
+	if n := s.count(); n == 0 {
+		t.Errorf("no point written on --max-run")
+	}
+	if workers.m[file].jctx.undrained {
+		t.Errorf("worker undrained")
+	}
+	if status := atomic.LoadInt32(&exitStatus); status != ExitOK {
+		t.Errorf("exit status %d, want %d", status, ExitOK)
+	}
+}
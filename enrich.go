@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// EnrichConfig adds tags from a metadata file and/or an HTTP lookup to the
+// points. Both are keyed by device and optionally interface, the interface
+// of a point is the value of its interface-tag (default
+// "/interfaces/interface/@name"). Tags of the lookup win over the file,
+// interface entries win over device entries and tags the point already has
+// are kept.
+type EnrichConfig struct {
+	File         string `json:"file"`
+	InterfaceTag string `json:"interface-tag"`
+	EnrichLookupConfig
+}
+
+// EnrichLookupConfig queries url (a template of .Device and .Interface)
+// for a JSON object of tags. Answers are cached for ttl seconds, failed
+// lookups keep the previous answer (if any) for error-ttl seconds.
+type EnrichLookupConfig struct {
+	URL      string            `json:"url"`
+	Headers  map[string]string `json:"headers"`
+	TTL      int               `json:"ttl"`
+	ErrorTTL int               `json:"error-ttl"`
+	Timeout  int               `json:"timeout"`
+}
+
+// EnrichEntry is one entry of the JSON metadata file. The CSV file has a
+// header line, the device and interface columns are the keys and all other
+// columns are tags.
+type EnrichEntry struct {
+	Device    string            `json:"device"`
+	Interface string            `json:"interface"`
+	Tags      map[string]string `json:"tags"`
+}
+
+type enrichKey struct {
+	device, intf string
+}
+
+type enrich struct {
+	intfTag string
+	meta    map[enrichKey]map[string]string
+	lookup  *enrichLookup
+}
+
+func newEnrichTransformer() *transformer {
+	return &transformer{
+		name: "enrich",
+		new:  newEnrich,
+	}
+}
+
+func newEnrich(jctx *JCtx) (transform, error) {
+	cfg := jctx.config.Transform.Enrich
+	if cfg.File == "" && cfg.URL == "" {
+		return nil, nil
+	}
+
+	e := &enrich{intfTag: cfg.InterfaceTag, meta: map[enrichKey]map[string]string{}}
+	if e.intfTag == "" {
+		e.intfTag = "/interfaces/interface/@name"
+	}
+	if cfg.URL != "" {
+		l, err := newEnrichLookup(jctx, cfg.EnrichLookupConfig)
+		if err != nil {
+			return nil, err
+		}
+		e.lookup = l
+	}
+	if cfg.File == "" {
+		return e, nil
+	}
+
+	entries, err := readEnrichFile(cfg.File)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", cfg.File, err)
+	}
+	for i, entry := range entries {
+		if entry.Device == "" {
+			return nil, fmt.Errorf("%s: entry %d: device is missing", cfg.File, i)
+		}
+		k := enrichKey{entry.Device, entry.Interface}
+		if e.meta[k] == nil {
+			e.meta[k] = map[string]string{}
+		}
+		for tk, tv := range entry.Tags {
+			e.meta[k][tk] = tv
+		}
+	}
+	return e, nil
+}
+
+func readEnrichFile(file string) ([]EnrichEntry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.ToLower(filepath.Ext(file)) == ".csv" {
+		return readEnrichCSV(f)
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	var entries []EnrichEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func readEnrichCSV(r io.Reader) ([]EnrichEntry, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.Comment = '#'
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("header: %v", err)
+	}
+
+	var entries []EnrichEntry
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		entry := EnrichEntry{Tags: map[string]string{}}
+		for i, v := range record {
+			switch header[i] {
+			case "device":
+				entry.Device = v
+			case "interface":
+				entry.Interface = v
+			default:
+				// empty cells do not add the tag
+				if v != "" {
+					entry.Tags[header[i]] = v
+				}
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (e *enrich) apply(points []*point) []*point {
+	out := make([]*point, 0, len(points))
+	for _, p := range points {
+		device := p.Tags["device"]
+		intf, hasIntf := p.Tags[e.intfTag]
+		sources := []map[string]string{e.meta[enrichKey{device, ""}]}
+		if hasIntf {
+			sources = append(sources, e.meta[enrichKey{device, intf}])
+		}
+		if e.lookup != nil && device != "" {
+			sources = append(sources, e.lookup.get(enrichKey{device, intf}))
+		}
+
+		var tags map[string]string
+		for _, src := range sources {
+			if len(src) == 0 {
+				continue
+			}
+			if tags == nil {
+				tags = make(map[string]string, len(p.Tags)+len(src))
+			}
+			for k, v := range src {
+				tags[k] = v
+			}
+		}
+		if tags == nil {
+			out = append(out, p)
+			continue
+		}
+		for k, v := range p.Tags {
+			tags[k] = v
+		}
+		out = append(out, newPoint(p.Measurement, tags, p.Fields, p.Timestamp))
+	}
+	return out
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+)
+
+type enrichLookupEntry struct {
+	tags    map[string]string
+	expires time.Time
+}
+
+type enrichLookup struct {
+	sync.Mutex
+	jctx    *JCtx
+	url     *template.Template
+	headers map[string]string
+	ttl     time.Duration
+	errTTL  time.Duration
+	client  *http.Client
+	cache   map[enrichKey]*enrichLookupEntry
+}
+
+func newEnrichLookup(jctx *JCtx, cfg EnrichLookupConfig) (*enrichLookup, error) {
+	t, err := template.New("url").Option("missingkey=zero").Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url template %q: %v", cfg.URL, err)
+	}
+	if cfg.TTL == 0 {
+		cfg.TTL = DefaultEnrichTTL
+	}
+	if cfg.ErrorTTL == 0 {
+		cfg.ErrorTTL = DefaultEnrichErrorTTL
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultEnrichTimeout
+	}
+	return &enrichLookup{
+		jctx:    jctx,
+		url:     t,
+		headers: cfg.Headers,
+		ttl:     time.Duration(cfg.TTL) * time.Second,
+		errTTL:  time.Duration(cfg.ErrorTTL) * time.Second,
+		client:  &http.Client{Timeout: time.Duration(cfg.Timeout) * time.Second},
+		cache:   map[enrichKey]*enrichLookupEntry{},
+	}, nil
+}
+
+// get returns the cached tags of key, expired entries are looked up again.
+// The lock is not held during the lookup, concurrent misses of the same key
+// may query the endpoint more than once.
+func (l *enrichLookup) get(key enrichKey) map[string]string {
+	now := time.Now()
+	l.Lock()
+	entry := l.cache[key]
+	l.Unlock()
+	if entry != nil && now.Before(entry.expires) {
+		return entry.tags
+	}
+
+	tags, err := l.query(key)
+	next := &enrichLookupEntry{tags: tags, expires: now.Add(l.ttl)}
+	if err != nil {
+		jLogError(l.jctx, "", fmt.Sprintf("enrich lookup of %s %s failed", key.device, key.intf), err)
+		next.tags = nil
+		if entry != nil {
+			next.tags = entry.tags
+		}
+		next.expires = now.Add(l.errTTL)
+	}
+
+	l.Lock()
+	l.cache[key] = next
+	l.Unlock()
+	return next.tags
+}
+
+// query returns the tags of key, not found is an empty answer
+func (l *enrichLookup) query(key enrichKey) (map[string]string, error) {
+	var url bytes.Buffer
+	data := struct{ Device, Interface string }{key.device, key.intf}
+	if err := l.url.Execute(&url, data); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", url.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range l.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("GET %s: %s", req.URL, resp.Status)
+	}
+
+	var tags map[string]string
+	if err := json.Unmarshal(body, &tags); err != nil {
+		return nil, fmt.Errorf("GET %s: %v", req.URL, err)
+	}
+	return tags, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEnrich(t *testing.T) {
+	dir, err := ioutil.TempDir("", "enrich")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"meta.json": `[
+			{"device": "r1", "tags": {"site": "ams", "pop": "ams1"}},
+			{"device": "r1", "interface": "et-0/0/0", "tags": {"circuit-id": "C-100", "pop": "ams2"}}
+		]`,
+		"meta.csv": "device,interface,site,pop,circuit-id\n" +
+			"r1,,ams,ams1,\n" +
+			"# comment\n" +
+			"r1,et-0/0/0,,ams2,C-100\n",
+	}
+
+	points := []*point{
+		newPoint("/interfaces/", map[string]string{"device": "r1", "/interfaces/interface/@name": "et-0/0/0", "site": "fra"},
+			map[string]interface{}{"in-octets": 1.0}, time.Unix(1, 0)),
+		newPoint("/interfaces/", map[string]string{"device": "r1", "/interfaces/interface/@name": "et-0/0/1"},
+			map[string]interface{}{"in-octets": 1.0}, time.Unix(1, 0)),
+		newPoint("/interfaces/", map[string]string{"device": "r2"},
+			map[string]interface{}{"in-octets": 1.0}, time.Unix(1, 0)),
+	}
+	want := []map[string]string{
+		{"device": "r1", "/interfaces/interface/@name": "et-0/0/0", "site": "fra", "pop": "ams2", "circuit-id": "C-100"},
+		{"device": "r1", "/interfaces/interface/@name": "et-0/0/1", "site": "ams", "pop": "ams1"},
+		{"device": "r2"},
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(dir, name)
+			if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			jctx := &JCtx{}
+			jctx.config.Transform.Enrich = EnrichConfig{File: file}
+			if err := transformsInit(jctx); err != nil {
+				t.Fatalf("transformsInit failed: %v", err)
+			}
+			out := applyTransforms(jctx, points)
+			if len(out) != len(want) {
+				t.Fatalf("want %d points, got %d", len(want), len(out))
+			}
+			for i, p := range out {
+				if !reflect.DeepEqual(p.Tags, want[i]) {
+					t.Errorf("point %d\ngot:  %v\nwant: %v", i, p.Tags, want[i])
+				}
+			}
+		})
+	}
+
+	t.Run("missing-device", func(t *testing.T) {
+		file := filepath.Join(dir, "bad.json")
+		if err := ioutil.WriteFile(file, []byte(`[{"interface": "et-0/0/0"}]`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		jctx := &JCtx{}
+		jctx.config.Transform.Enrich = EnrichConfig{File: file}
+		if err := transformsInit(jctx); err == nil {
+			t.Errorf("want error, got nil")
+		}
+	})
+}
+
+func TestEnrichLookup(t *testing.T) {
+	var hits, fail int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if atomic.LoadInt32(&fail) != 0 {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("X-Token") != "secret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		switch r.URL.Query().Get("interface") {
+		case "et-0/0/0":
+			fmt.Fprintf(w, `{"customer": "acme", "device": "ignored"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	jctx := &JCtx{}
+	jctx.config.Transform.Enrich = EnrichConfig{
+		EnrichLookupConfig: EnrichLookupConfig{
+			URL:     ts.URL + "/tags?device={{.Device | urlquery}}&interface={{.Interface | urlquery}}",
+			Headers: map[string]string{"X-Token": "secret"},
+		},
+	}
+	if err := transformsInit(jctx); err != nil {
+		t.Fatalf("transformsInit failed: %v", err)
+	}
+	points := []*point{
+		newPoint("/interfaces/", map[string]string{"device": "r1", "/interfaces/interface/@name": "et-0/0/0"},
+			map[string]interface{}{"in-octets": 1.0}, time.Unix(1, 0)),
+		newPoint("/interfaces/", map[string]string{"device": "r1", "/interfaces/interface/@name": "et-0/0/1"},
+			map[string]interface{}{"in-octets": 1.0}, time.Unix(1, 0)),
+	}
+	want := []map[string]string{
+		{"device": "r1", "/interfaces/interface/@name": "et-0/0/0", "customer": "acme"},
+		{"device": "r1", "/interfaces/interface/@name": "et-0/0/1"},
+	}
+	check := func() {
+		t.Helper()
+		out := applyTransforms(jctx, points)
+		for i, p := range out {
+			if !reflect.DeepEqual(p.Tags, want[i]) {
+				t.Errorf("point %d\ngot:  %v\nwant: %v", i, p.Tags, want[i])
+			}
+		}
+	}
+
+	check()
+	check()
+	if n := atomic.LoadInt32(&hits); n != 2 {
+		t.Errorf("want 2 lookups, got %d", n)
+	}
+
+	// expire the cache, failed lookups fall back to the previous answer
+	atomic.StoreInt32(&fail, 1)
+	l := jctx.transforms[0].(*enrich).lookup
+	for _, entry := range l.cache {
+		entry.expires = time.Time{}
+	}
+	check()
+	if n := atomic.LoadInt32(&hits); n != 4 {
+		t.Errorf("want 4 lookups, got %d", n)
+	}
+	check()
+	if n := atomic.LoadInt32(&hits); n != 4 {
+		t.Errorf("want failed lookups cached, got %d lookups", n)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// EventHubsConfig is the config of the Azure Event Hubs sink. Either
+// connection-string (SAS) or tenant-id/client-id/client-secret (AAD) is used.
+type EventHubsConfig struct {
+	ConnectionString string `json:"connection-string"`
+	Namespace        string `json:"namespace"`
+	EventHub         string `json:"eventhub"`
+	TenantID         string `json:"tenant-id"`
+	ClientID         string `json:"client-id"`
+	ClientSecret     string `json:"client-secret"`
+	PartitionKey     string `json:"partition-key"`
+	Endpoint         string `json:"endpoint"`
+	BatchConfig
+}
+
+const (
+	eventHubsMaxBatchBytes = 900 * 1024
+	eventHubsTokenTTL      = time.Hour
+)
+
+type eventHubsSink struct {
+	cfg          EventHubsConfig
+	url          string
+	resource     string
+	keyName      string
+	key          string
+	partitionKey *template.Template
+	client       *http.Client
+	token        string
+	expiry       time.Time
+}
+
+func newEventHubsSink() *sink {
+	return &sink{
+		name: "eventhubs",
+		open: openEventHubsSink,
+	}
+}
+
+// parseEventHubsConnectionString understands
+// Endpoint=sb://ns.servicebus.windows.net/;SharedAccessKeyName=n;SharedAccessKey=k;EntityPath=hub
+func parseEventHubsConnectionString(cs string) (map[string]string, error) {
+	m := map[string]string{}
+	for _, part := range strings.Split(cs, ";") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("eventhubs connection-string has syntax error near %q", part)
+		}
+		m[kv[0]] = kv[1]
+	}
+	if m["Endpoint"] == "" || m["SharedAccessKeyName"] == "" || m["SharedAccessKey"] == "" {
+		return nil, fmt.Errorf("eventhubs connection-string needs Endpoint, SharedAccessKeyName and SharedAccessKey")
+	}
+	return m, nil
+}
+
+func openEventHubsSink(jctx *JCtx) (sinkWriter, BatchConfig, error) {
+	cfg := jctx.config.EventHubs
+	if cfg.ConnectionString == "" && cfg.Namespace == "" {
+		return nil, cfg.BatchConfig, nil
+	}
+
+	s := &eventHubsSink{
+		cfg:    cfg,
+		client: &http.Client{Timeout: time.Duration(DefaultIDBTimeout) * time.Second},
+	}
+
+	host := cfg.Namespace + ".servicebus.windows.net"
+	hub := cfg.EventHub
+	if cfg.ConnectionString != "" {
+		m, err := parseEventHubsConnectionString(cfg.ConnectionString)
+		if err != nil {
+			return nil, cfg.BatchConfig, err
+		}
+		host = strings.Trim(strings.TrimPrefix(m["Endpoint"], "sb://"), "/")
+		if hub == "" {
+			hub = m["EntityPath"]
+		}
+		s.keyName = m["SharedAccessKeyName"]
+		s.key = m["SharedAccessKey"]
+	} else if cfg.TenantID == "" || cfg.ClientID == "" || cfg.ClientSecret == "" {
+		return nil, cfg.BatchConfig, fmt.Errorf("eventhubs needs connection-string or tenant-id, client-id and client-secret")
+	}
+	if hub == "" {
+		return nil, cfg.BatchConfig, fmt.Errorf("eventhubs eventhub name is missing")
+	}
+
+	s.resource = "https://" + host + "/" + hub
+	base := "https://" + host
+	if cfg.Endpoint != "" {
+		base = strings.TrimSuffix(cfg.Endpoint, "/")
+	}
+	s.url = base + "/" + hub + "/messages?api-version=2014-01"
+
+	partitionKey := cfg.PartitionKey
+	if partitionKey == "" {
+		partitionKey = DefaultEventHubsPartitionKey
+	}
+	t, err := newKeyTemplate("partition-key", partitionKey)
+	if err != nil {
+		return nil, cfg.BatchConfig, err
+	}
+	s.partitionKey = t
+	return s, cfg.BatchConfig, nil
+}
+
+func eventHubsSASToken(resource, keyName, key string, expiry time.Time) string {
+	uri := url.QueryEscape(strings.ToLower(resource))
+	se := strconv.FormatInt(expiry.Unix(), 10)
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte(uri + "\n" + se))
+	sig := url.QueryEscape(base64.StdEncoding.EncodeToString(h.Sum(nil)))
+	return fmt.Sprintf("SharedAccessSignature sr=%s&sig=%s&se=%s&skn=%s", uri, sig, se, keyName)
+}
+
+// authorization returns cached SAS or AAD token, renewed ahead of its expiry
+func (s *eventHubsSink) authorization() (string, error) {
+	now := time.Now()
+	if s.token != "" && now.Add(5*time.Minute).Before(s.expiry) {
+		return s.token, nil
+	}
+
+	if s.key != "" {
+		s.expiry = now.Add(eventHubsTokenTTL)
+		s.token = eventHubsSASToken(s.resource, s.keyName, s.key, s.expiry)
+		return s.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {s.cfg.ClientID},
+		"client_secret": {s.cfg.ClientSecret},
+		"scope":         {"https://eventhubs.azure.net/.default"},
+	}
+	tokenURL := fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", s.cfg.TenantID)
+	if s.cfg.Endpoint != "" {
+		tokenURL = strings.TrimSuffix(s.cfg.Endpoint, "/") + "/" + s.cfg.TenantID + "/oauth2/v2.0/token"
+	}
+	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	body, err := sinkHTTPDo(s.client, req)
+	if err != nil {
+		return "", fmt.Errorf("can not get AAD token: %v", err)
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return "", fmt.Errorf("can not get AAD token: %v", err)
+	}
+	s.token = "Bearer " + tok.AccessToken
+	s.expiry = now.Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return s.token, nil
+}
+
+type eventHubsMessage struct {
+	Body             string            `json:"Body"`
+	UserProperties   map[string]string `json:"UserProperties,omitempty"`
+	BrokerProperties map[string]string `json:"BrokerProperties,omitempty"`
+}
+
+func (s *eventHubsSink) write(points []*point) error {
+	var batch []eventHubsMessage
+	size := 0
+	for _, p := range points {
+		data, err := json.Marshal(p)
+		if err != nil {
+			continue
+		}
+		key, err := execKeyTemplate(s.partitionKey, p)
+		if err != nil {
+			return err
+		}
+		m := eventHubsMessage{
+			Body:           string(data),
+			UserProperties: map[string]string{"device": p.Tags["device"], "measurement": p.Measurement},
+		}
+		if key != "" {
+			m.BrokerProperties = map[string]string{"PartitionKey": key}
+		}
+
+		if size+len(data) > eventHubsMaxBatchBytes && len(batch) > 0 {
+			if err := s.send(batch); err != nil {
+				return err
+			}
+			batch, size = nil, 0
+		}
+		batch = append(batch, m)
+		size += len(data)
+	}
+	if len(batch) > 0 {
+		return s.send(batch)
+	}
+	return nil
+}
+
+func (s *eventHubsSink) send(batch []eventHubsMessage) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	auth, err := s.authorization()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.microsoft.servicebus.json")
+	req.Header.Set("Authorization", auth)
+	_, err = sinkHTTPDo(s.client, req)
+	return err
+}
+
+func (s *eventHubsSink) close() {
+}
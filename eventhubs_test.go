@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventHubsSink(t *testing.T) {
+	var msgs []eventHubsMessage
+	var auth, contentType string
+	tokens := 0
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tenant/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("client_secret") != "secret" {
+			http.Error(w, "bad secret", http.StatusUnauthorized)
+			return
+		}
+		tokens++
+		w.Write([]byte(`{"access_token":"tok","expires_in":3600}`))
+	})
+	mux.HandleFunc("/hub/messages", func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		contentType = r.Header.Get("Content-Type")
+		msgs = nil
+		json.NewDecoder(r.Body).Decode(&msgs)
+		w.WriteHeader(http.StatusCreated)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		cfg          EventHubsConfig
+		auth         string
+		partitionKey string
+	}{
+		{
+			name: "connection-string",
+			cfg: EventHubsConfig{
+				ConnectionString: "Endpoint=sb://ns.servicebus.windows.net/;SharedAccessKeyName=send;SharedAccessKey=key;EntityPath=hub",
+				Endpoint:         server.URL,
+			},
+			auth:         "SharedAccessSignature sr=https%3A%2F%2Fns.servicebus.windows.net%2Fhub&sig=",
+			partitionKey: "r1",
+		},
+		{
+			name: "aad",
+			cfg: EventHubsConfig{
+				Namespace:    "ns",
+				EventHub:     "hub",
+				TenantID:     "tenant",
+				ClientID:     "id",
+				ClientSecret: "secret",
+				PartitionKey: "{{.Measurement}}",
+				Endpoint:     server.URL,
+			},
+			auth:         "Bearer tok",
+			partitionKey: "m",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jctx := &JCtx{}
+			jctx.config.EventHubs = test.cfg
+			w, _, err := openEventHubsSink(jctx)
+			if err != nil {
+				t.Fatalf("openEventHubsSink failed: %v", err)
+			}
+			defer w.close()
+
+			p := newPoint("m", map[string]string{"device": "r1"}, map[string]interface{}{"/a": 1.0}, time.Unix(1, 0))
+			for i := 0; i < 2; i++ {
+				if err := w.write([]*point{p, p}); err != nil {
+					t.Fatalf("write failed: %v", err)
+				}
+			}
+			if !strings.HasPrefix(auth, test.auth) {
+				t.Errorf("authorization: want prefix %q, got %q", test.auth, auth)
+			}
+			if contentType != "application/vnd.microsoft.servicebus.json" {
+				t.Errorf("content type: got %s", contentType)
+			}
+			if len(msgs) != 2 {
+				t.Fatalf("want 2 messages, got %d", len(msgs))
+			}
+			if key := msgs[0].BrokerProperties["PartitionKey"]; key != test.partitionKey {
+				t.Errorf("partition key: want %s, got %s", test.partitionKey, key)
+			}
+			var got point
+			if err := json.Unmarshal([]byte(msgs[0].Body), &got); err != nil || got.Measurement != "m" {
+				t.Errorf("body: got %s (%v)", msgs[0].Body, err)
+			}
+		})
+	}
+
+	// AAD token is cached across writes
+	if tokens != 1 {
+		t.Errorf("want 1 token request, got %d", tokens)
+	}
+}
+
+func TestEventHubsConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  EventHubsConfig
+	}{
+		{"bad-connection-string", EventHubsConfig{ConnectionString: "Endpoint=sb://ns/"}},
+		{"no-eventhub", EventHubsConfig{ConnectionString: "Endpoint=sb://ns/;SharedAccessKeyName=n;SharedAccessKey=k"}},
+		{"no-aad-secret", EventHubsConfig{Namespace: "ns", EventHub: "hub", TenantID: "t", ClientID: "c"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jctx := &JCtx{}
+			jctx.config.EventHubs = test.cfg
+			if _, _, err := openEventHubsSink(jctx); err == nil {
+				t.Errorf("want error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/status"
+)
+
+// Types of the events of a worker
+const (
+	EventConnect     = "connect"
+	EventDisconnect  = "disconnect"
+	EventResubscribe = "resubscribe"
+	EventReload      = "config-reload"
+	EventError       = "error"
+	EventStale       = "stale"
+	EventStaleClear  = "stale-cleared"
+	EventPause       = "paused"
+	EventResume      = "resumed"
+	EventTakeoverGap = "takeover-gap"
+	EventFailover    = "failover"
+	EventFreq        = "freq-changed"
+)
+
+// eventHistory is the number of events kept per worker
+const eventHistory = 100
+
+// event is a significant event of a worker, code is the gRPC code of
+// disconnects
+type event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Code    string    `json:"code,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+// eventRing keeps the last events of a worker
+type eventRing struct {
+	sync.Mutex
+	buf  []event
+	next int
+}
+
+func (r *eventRing) add(e event) {
+	r.Lock()
+	defer r.Unlock()
+	if len(r.buf) < eventHistory {
+		r.buf = append(r.buf, e)
+		return
+	}
+	r.buf[r.next] = e
+	r.next = (r.next + 1) % eventHistory
+}
+
+// events returns the events kept, oldest first
+func (r *eventRing) events() []event {
+	r.Lock()
+	defer r.Unlock()
+	events := make([]event, 0, len(r.buf))
+	events = append(events, r.buf[r.next:]...)
+	return append(events, r.buf[:r.next]...)
+}
+
+// recordEvent adds an event to the history of the worker
+func recordEvent(jctx *JCtx, typ, code, msg string) {
+	jctx.events.add(event{Time: time.Now().UTC(), Type: typ, Code: code, Message: msg})
+}
+
+// streamEnded records the end of the stream with the error of Recv
+func streamEnded(jctx *JCtx, err error) {
+	if err == io.EOF {
+		recordEvent(jctx, EventDisconnect, "OK", "stream closed by the device")
+		return
+	}
+	jctx.transport.streamReset()
+	recordEvent(jctx, EventDisconnect, status.Code(err).String(), err.Error())
+}
+
+// eventsHandler serves the event history of the workers as JSON, sorted by
+// device, or of the workers of the device query parameter only
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	type deviceEvents struct {
+		Device string  `json:"device"`
+		Port   int     `json:"port"`
+		Events []event `json:"events"`
+	}
+	device := r.URL.Query().Get("device")
+	scope := requestScope(r.Context())
+	devices := []deviceEvents{}
+	metricWorkers.Lock()
+	for jctx := range metricWorkers.m {
+		if (device != "" && jctx.config.Host != device) || !scope.allows(jctx) {
+			continue
+		}
+		devices = append(devices, deviceEvents{jctx.config.Host, jctx.config.Port, jctx.events.events()})
+	}
+	metricWorkers.Unlock()
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].Device != devices[j].Device {
+			return devices[i].Device < devices[j].Device
+		}
+		return devices[i].Port < devices[j].Port
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Devices []deviceEvents `json:"devices"`
+	}{devices})
+}
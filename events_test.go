@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestEventRing(t *testing.T) {
+	tests := []struct {
+		added int
+		first int
+		n     int
+	}{
+		{0, 0, 0},
+		{3, 0, 3},
+		{eventHistory, 0, eventHistory},
+		{eventHistory + 1, 1, eventHistory},
+		{3*eventHistory + 7, 2*eventHistory + 7, eventHistory},
+	}
+	for _, test := range tests {
+		var r eventRing
+		for i := 0; i < test.added; i++ {
+			r.add(event{Message: fmt.Sprint(i)})
+		}
+		events := r.events()
+		if len(events) != test.n {
+			t.Errorf("%d added: got %d events, want %d", test.added, len(events), test.n)
+			continue
+		}
+		for i, e := range events {
+			if e.Message != fmt.Sprint(test.first+i) {
+				t.Errorf("%d added: got event %s at %d, want %d", test.added, e.Message, i, test.first+i)
+				break
+			}
+		}
+	}
+}
+
+func TestEventsHandler(t *testing.T) {
+	r1 := &JCtx{config: Config{Host: "r1", Port: 32767}}
+	r2 := &JCtx{config: Config{Host: "r2", Port: 32767}}
+	setConnected(r1, true)
+	setConnected(r1, true)
+	streamEnded(r1, status.Error(codes.Unavailable, "transport is closing"))
+	setConnected(r1, false)
+	recordEvent(r1, EventResubscribe, "", "subscribing again with the new config")
+	streamEnded(r2, io.EOF)
+	recordEvent(r2, EventError, "", fmt.Sprintf("could not dial: %v", errors.New("connection refused")))
+	for _, jctx := range []*JCtx{r2, r1} {
+		dropsInit(jctx)
+		defer dropsStop(jctx)
+	}
+
+	tests := []struct {
+		url  string
+		want map[string][]string
+	}{
+		{
+			url: "/events",
+			want: map[string][]string{
+				"r1": {"connect  streaming from r1:32767", "disconnect Unavailable rpc error: code = Unavailable desc = transport is closing",
+					"resubscribe  subscribing again with the new config"},
+				"r2": {"disconnect OK stream closed by the device", "error  could not dial: connection refused"},
+			},
+		},
+		{
+			url: "/events?device=r2",
+			want: map[string][]string{
+				"r2": {"disconnect OK stream closed by the device", "error  could not dial: connection refused"},
+			},
+		},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		eventsHandler(rec, httptest.NewRequest("GET", test.url, nil))
+		var got struct {
+			Devices []struct {
+				Device string  `json:"device"`
+				Events []event `json:"events"`
+			} `json:"devices"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Devices) != len(test.want) {
+			t.Errorf("%s: got %d devices, want %d", test.url, len(got.Devices), len(test.want))
+			continue
+		}
+		for _, d := range got.Devices {
+			want := test.want[d.Device]
+			if len(d.Events) != len(want) {
+				t.Errorf("%s: %s: got %+v, want %v", test.url, d.Device, d.Events, want)
+				continue
+			}
+			for i, e := range d.Events {
+				if s := e.Type + " " + e.Code + " " + e.Message; s != want[i] || e.Time.IsZero() {
+					t.Errorf("%s: %s: got %s at %v, want %s", test.url, d.Device, s, e.Time, want[i])
+				}
+			}
+		}
+	}
+}
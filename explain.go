@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	na_pb "github.com/nileshsimaria/jtimon/telemetry"
+	flag "github.com/spf13/pflag"
+)
+
+var explain = flag.Bool("explain", false, "Print each telemetry packet as a tree of its paths, keys and values, to validate new sensors")
+
+// explainNode is an element of the paths of a packet, with the values of
+// its leaves, in the order they were received
+type explainNode struct {
+	name   string
+	kids   []*explainNode
+	values []string
+}
+
+func (n *explainNode) kid(name string) *explainNode {
+	for _, k := range n.kids {
+		if k.name == name {
+			return k
+		}
+	}
+	k := &explainNode{name: name}
+	n.kids = append(n.kids, k)
+	return k
+}
+
+func (n *explainNode) write(b *strings.Builder, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for _, v := range n.values {
+		fmt.Fprintf(b, "%s%s\n", indent, v)
+	}
+	for _, k := range n.kids {
+		fmt.Fprintf(b, "%s%s\n", indent, k.name)
+		k.write(b, depth+1)
+	}
+}
+
+// pathElems splits the path into its elements, the slashes of the list
+// keys, e.g. [name='ge-0/0/0'], do not split it
+func pathElems(path string) []string {
+	var elems []string
+	depth, start := 0, 0
+	for i := 0; i <= len(path); i++ {
+		switch {
+		case i == len(path) || path[i] == '/' && depth == 0:
+			if i > start {
+				elems = append(elems, path[start:i])
+			}
+			start = i + 1
+		case path[i] == '[':
+			depth++
+		case path[i] == ']' && depth > 0:
+			depth--
+		}
+	}
+	return elems
+}
+
+// packetLeaves calls fn with the values of the packet and their full
+// paths, the relative keys after the __prefix__ before them. The metadata
+// keys (__timestamp__ ...) have no path.
+func packetLeaves(ocData *na_pb.OpenConfigData, fn func(path string, kv *na_pb.KeyValue)) {
+	prefix := ""
+	for _, kv := range ocData.Kv {
+		switch {
+		case kv.Key == "__prefix__":
+			prefix = kv.GetStrValue()
+		case strings.HasPrefix(kv.Key, "__"):
+			fn("", kv)
+		case strings.HasPrefix(kv.Key, "/"):
+			fn(kv.Key, kv)
+		default:
+			fn(prefix+kv.Key, kv)
+		}
+	}
+}
+
+// explainValue is the value of kv and its type
+func explainValue(kv *na_pb.KeyValue) string {
+	switch v := kv.Value.(type) {
+	case *na_pb.KeyValue_DoubleValue:
+		return fmt.Sprintf("%v (double)", v.DoubleValue)
+	case *na_pb.KeyValue_IntValue:
+		return fmt.Sprintf("%d (int)", v.IntValue)
+	case *na_pb.KeyValue_UintValue:
+		return fmt.Sprintf("%d (uint)", v.UintValue)
+	case *na_pb.KeyValue_SintValue:
+		return fmt.Sprintf("%d (sint)", v.SintValue)
+	case *na_pb.KeyValue_BoolValue:
+		return fmt.Sprintf("%v (bool)", v.BoolValue)
+	case *na_pb.KeyValue_StrValue:
+		return fmt.Sprintf("%q (string)", v.StrValue)
+	case *na_pb.KeyValue_BytesValue:
+		return fmt.Sprintf("%x (%d bytes)", v.BytesValue, len(v.BytesValue))
+	}
+	return "(no value)"
+}
+
+// explainPacket describes the packet received at rtime as an indented
+// tree: its sensor, sequence number and timestamps, its metadata keys, and
+// the values under the elements of their paths, the relative keys under
+// the __prefix__ before them
+func explainPacket(ocData *na_pb.OpenConfigData, rtime time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "packet %d of %s\n", ocData.SequenceNumber, ocData.Path)
+	fmt.Fprintf(&b, "  system %s, component %d, sub-component %d\n", ocData.SystemId, ocData.ComponentId, ocData.SubComponentId)
+	ts := time.Unix(0, int64(ocData.Timestamp)*int64(time.Millisecond))
+	fmt.Fprintf(&b, "  timestamp %s, received %s (%v later)\n", ts.UTC().Format(time.RFC3339Nano),
+		rtime.UTC().Format(time.RFC3339Nano), rtime.Sub(ts).Round(time.Millisecond))
+	if ocData.SyncResponse {
+		fmt.Fprintf(&b, "  sync response\n")
+	}
+
+	meta := &explainNode{}
+	root := &explainNode{}
+	packetLeaves(ocData, func(path string, kv *na_pb.KeyValue) {
+		if path == "" {
+			meta.values = append(meta.values, kv.Key+": "+explainValue(kv))
+			return
+		}
+		elems := pathElems(path)
+		if len(elems) == 0 {
+			return
+		}
+		n := root
+		for i, e := range elems[:len(elems)-1] {
+			if i == 0 {
+				e = "/" + e
+			}
+			n = n.kid(e)
+		}
+		n.values = append(n.values, elems[len(elems)-1]+": "+explainValue(kv))
+	})
+	if len(meta.values) != 0 {
+		fmt.Fprintf(&b, "  metadata\n")
+		meta.write(&b, 2)
+	}
+	root.write(&b, 1)
+	for _, d := range ocData.Delete {
+		fmt.Fprintf(&b, "  delete %s\n", d.GetPath())
+	}
+	for _, e := range ocData.Eom {
+		fmt.Fprintf(&b, "  end of %s\n", e.GetPath())
+	}
+	return b.String()
+}
+
+// explainLog logs the tree of the packet of the worker received at rtime,
+// whatever the log level
+func explainLog(jctx *JCtx, ocData *na_pb.OpenConfigData, rtime time.Time) {
+	jLogWrite(jctx, LogLevelInfo, "", explainPacket(ocData, rtime), nil)
+}
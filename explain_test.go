@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	na_pb "github.com/nileshsimaria/jtimon/telemetry"
+)
+
+func TestPathElems(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"", nil},
+		{"/", nil},
+		{"/interfaces/interface/state/", []string{"interfaces", "interface", "state"}},
+		{"state/counters/in-octets", []string{"state", "counters", "in-octets"}},
+		{"/interfaces/interface[name='ge-0/0/0']/state", []string{"interfaces", "interface[name='ge-0/0/0']", "state"}},
+		{"/a[x='1/2'][y='[3/4]']/b", []string{"a[x='1/2'][y='[3/4]']", "b"}},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			if got := pathElems(test.path); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("pathElems() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExplainPacket(t *testing.T) {
+	str := func(key, v string) *na_pb.KeyValue {
+		return &na_pb.KeyValue{Key: key, Value: &na_pb.KeyValue_StrValue{StrValue: v}}
+	}
+	num := func(key string, v uint64) *na_pb.KeyValue {
+		return &na_pb.KeyValue{Key: key, Value: &na_pb.KeyValue_UintValue{UintValue: v}}
+	}
+	ocData := &na_pb.OpenConfigData{
+		SystemId:       "r1",
+		ComponentId:    1,
+		Path:           "sensor_1000:/interfaces/:/interfaces/:PFE",
+		SequenceNumber: 42,
+		Timestamp:      1583058600000,
+		SyncResponse:   true,
+		Kv: []*na_pb.KeyValue{
+			num("__timestamp__", 1583058600010),
+			str("__prefix__", "/interfaces/interface[name='ge-0/0/0']/"),
+			str("state/oper-status", "UP"),
+			num("state/counters/in-octets", 1000),
+			{Key: "state/counters/in-errors", Value: &na_pb.KeyValue_DoubleValue{DoubleValue: 0.5}},
+			{Key: "state/enabled", Value: &na_pb.KeyValue_BoolValue{BoolValue: true}},
+			str("__prefix__", "/interfaces/interface[name='ge-0/0/1']/"),
+			{Key: "state/mac", Value: &na_pb.KeyValue_BytesValue{BytesValue: []byte{0xab, 0xcd}}},
+			{Key: "/system/state/hostname", Value: &na_pb.KeyValue_SintValue{SintValue: -1}},
+			{Key: "state/unset"},
+		},
+		Delete: []*na_pb.Delete{{Path: "/interfaces/interface[name='ge-0/0/2']"}},
+		Eom:    []*na_pb.Eom{{Path: "/interfaces/"}},
+	}
+	want := `packet 42 of sensor_1000:/interfaces/:/interfaces/:PFE
+  system r1, component 1, sub-component 0
+  timestamp 2020-03-01T10:30:00Z, received 2020-03-01T10:30:00.015Z (15ms later)
+  sync response
+  metadata
+    __timestamp__: 1583058600010 (uint)
+  /interfaces
+    interface[name='ge-0/0/0']
+      state
+        oper-status: "UP" (string)
+        enabled: true (bool)
+        counters
+          in-octets: 1000 (uint)
+          in-errors: 0.5 (double)
+    interface[name='ge-0/0/1']
+      state
+        mac: abcd (2 bytes)
+        unset: (no value)
+  /system
+    state
+      hostname: -1 (sint)
+  delete /interfaces/interface[name='ge-0/0/2']
+  end of /interfaces/
+`
+	rtime := time.Unix(0, 1583058600015*int64(time.Millisecond))
+	if got := explainPacket(ocData, rtime); got != want {
+		t.Errorf("explainPacket() =\n%s\nwant\n%s", got, want)
+	}
+}
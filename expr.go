@@ -0,0 +1,390 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ExprConfig reshapes fields with jq like expressions. extract pulls values
+// out of fields holding JSON documents, compute adds fields derived from
+// other fields of the point.
+type ExprConfig struct {
+	Extract []ExprExtract `json:"extract"`
+	Compute []ExprCompute `json:"compute"`
+}
+
+// ExprExtract parses the fields matching match (regex) as JSON and writes
+// the value at path (e.g. ".counters.in-octets" or ".lanes[0].power") as
+// field, which can refer to submatches of match e.g. "${1}/in-octets".
+// The JSON field is dropped unless keep is set.
+type ExprExtract struct {
+	Match string `json:"match"`
+	Path  string `json:"path"`
+	Field string `json:"field"`
+	Keep  bool   `json:"keep"`
+}
+
+// ExprCompute writes the value of expr as field. expr is arithmetic
+// (+ - * / and parentheses) of numbers and fields written as {field name},
+// it is skipped if one of the fields is missing or not a number.
+type ExprCompute struct {
+	Field string `json:"field"`
+	Expr  string `json:"expr"`
+}
+
+type exprExtract struct {
+	re    *regexp.Regexp
+	path  []interface{} // string member or int index
+	field string
+	keep  bool
+}
+
+type exprCompute struct {
+	field string
+	eval  exprNode
+}
+
+type expr struct {
+	extract []exprExtract
+	compute []exprCompute
+}
+
+func newExprTransformer() *transformer {
+	return &transformer{
+		name: "expr",
+		new:  newExpr,
+	}
+}
+
+func newExpr(jctx *JCtx) (transform, error) {
+	cfg := jctx.config.Transform.Expr
+	if len(cfg.Extract) == 0 && len(cfg.Compute) == 0 {
+		return nil, nil
+	}
+
+	e := &expr{}
+	for i, x := range cfg.Extract {
+		re, err := regexp.Compile(x.Match)
+		if err != nil {
+			return nil, fmt.Errorf("extract %d: invalid match %q: %v", i, x.Match, err)
+		}
+		path, err := parseJSONPath(x.Path)
+		if err != nil {
+			return nil, fmt.Errorf("extract %d: %v", i, err)
+		}
+		if x.Field == "" {
+			return nil, fmt.Errorf("extract %d: field is missing", i)
+		}
+		e.extract = append(e.extract, exprExtract{re: re, path: path, field: x.Field, keep: x.Keep})
+	}
+	for i, c := range cfg.Compute {
+		if c.Field == "" {
+			return nil, fmt.Errorf("compute %d: field is missing", i)
+		}
+		n, err := parseExpr(c.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("compute %d: %v", i, err)
+		}
+		e.compute = append(e.compute, exprCompute{field: c.Field, eval: n})
+	}
+	return e, nil
+}
+
+// parseJSONPath parses .a.b[0]."c.d" into its members and indexes
+func parseJSONPath(path string) ([]interface{}, error) {
+	var elems []interface{}
+	s := path
+	for len(s) > 0 {
+		switch {
+		case s[0] == '.' && len(s) > 1 && s[1] == '"':
+			end := strings.IndexByte(s[2:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q: unterminated quote", path)
+			}
+			elems = append(elems, s[2:2+end])
+			s = s[3+end:]
+		case s[0] == '.':
+			end := strings.IndexAny(s[1:], ".[")
+			if end < 0 {
+				end = len(s) - 1
+			}
+			if end == 0 {
+				if len(s) == 1 {
+					// "." is the whole document
+					s = ""
+					continue
+				}
+				s = s[1:]
+				continue
+			}
+			elems = append(elems, s[1:1+end])
+			s = s[1+end:]
+		case s[0] == '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q: missing ]", path)
+			}
+			idx, err := strconv.Atoi(s[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid path %q: bad index %q", path, s[1:end])
+			}
+			elems = append(elems, idx)
+			s = s[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid path %q: expected . or [ at %q", path, s)
+		}
+	}
+	return elems, nil
+}
+
+func lookupJSONPath(doc interface{}, path []interface{}) (interface{}, bool) {
+	for _, elem := range path {
+		switch elem := elem.(type) {
+		case string:
+			m, ok := doc.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if doc, ok = m[elem]; !ok {
+				return nil, false
+			}
+		case int:
+			a, ok := doc.([]interface{})
+			if !ok || elem < 0 || elem >= len(a) {
+				return nil, false
+			}
+			doc = a[elem]
+		}
+	}
+	return doc, true
+}
+
+// jsonFieldValue converts a decoded JSON value to a field value, objects
+// and arrays are written as JSON
+func jsonFieldValue(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case float64, string, bool:
+		return v, true
+	case nil:
+		return nil, false
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, false
+		}
+		return string(b), true
+	}
+}
+
+func (e *expr) apply(points []*point) []*point {
+	out := make([]*point, 0, len(points))
+	for _, p := range points {
+		fields := p.Fields
+		copied := false
+		set := func(k string, v interface{}) {
+			if !copied {
+				fields = copyFields(fields)
+				copied = true
+			}
+			if v == nil {
+				delete(fields, k)
+			} else {
+				fields[k] = v
+			}
+		}
+
+		for k, v := range p.Fields {
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+			var doc interface{}
+			parsed := false
+			for _, x := range e.extract {
+				m := x.re.FindStringSubmatchIndex(k)
+				if m == nil {
+					continue
+				}
+				if !parsed {
+					parsed = true
+					if json.Unmarshal([]byte(s), &doc) != nil {
+						break
+					}
+				}
+				if value, ok := lookupJSONPath(doc, x.path); ok {
+					if fv, ok := jsonFieldValue(value); ok {
+						set(string(x.re.ExpandString(nil, x.field, k, m)), fv)
+					}
+				}
+				if !x.keep {
+					set(k, nil)
+				}
+			}
+		}
+
+		for _, c := range e.compute {
+			if v, ok := c.eval(fields); ok {
+				set(c.field, v)
+			}
+		}
+
+		if copied {
+			out = append(out, newPoint(p.Measurement, p.Tags, fields, p.Timestamp))
+		} else {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// exprNode evaluates to a number, ok is false if a field is not available
+type exprNode func(fields map[string]interface{}) (float64, bool)
+
+type exprParser struct {
+	s   string
+	pos int
+}
+
+func parseExpr(s string) (exprNode, error) {
+	p := &exprParser{s: s}
+	n, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	p.space()
+	if p.pos != len(p.s) {
+		return nil, fmt.Errorf("invalid expr %q: unexpected %q at %d", s, p.s[p.pos], p.pos)
+	}
+	return n, nil
+}
+
+func (p *exprParser) space() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *exprParser) peek() byte {
+	p.space()
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func (p *exprParser) sum() (exprNode, error) {
+	l, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return l, nil
+		}
+		p.pos++
+		r, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		l = exprBinary(op, l, r)
+	}
+}
+
+func (p *exprParser) product() (exprNode, error) {
+	l, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' {
+			return l, nil
+		}
+		p.pos++
+		r, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l = exprBinary(op, l, r)
+	}
+}
+
+func (p *exprParser) unary() (exprNode, error) {
+	c := p.peek()
+	switch {
+	case c == '-':
+		p.pos++
+		n, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(f map[string]interface{}) (float64, bool) {
+			v, ok := n(f)
+			return -v, ok
+		}, nil
+	case c == '(':
+		p.pos++
+		n, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("invalid expr %q: missing ) at %d", p.s, p.pos)
+		}
+		p.pos++
+		return n, nil
+	case c == '{':
+		end := strings.IndexByte(p.s[p.pos:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("invalid expr %q: missing } at %d", p.s, p.pos)
+		}
+		name := p.s[p.pos+1 : p.pos+end]
+		p.pos += end + 1
+		return func(f map[string]interface{}) (float64, bool) {
+			v, _, ok := numericValue(f[name])
+			return v, ok
+		}, nil
+	case c == '.' || (c >= '0' && c <= '9'):
+		start := p.pos
+		for p.pos < len(p.s) && strings.IndexByte("0123456789.eE", p.s[p.pos]) >= 0 {
+			p.pos++
+		}
+		v, err := strconv.ParseFloat(p.s[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expr %q: bad number %q", p.s, p.s[start:p.pos])
+		}
+		return func(map[string]interface{}) (float64, bool) { return v, true }, nil
+	case c == 0:
+		return nil, fmt.Errorf("invalid expr %q: unexpected end", p.s)
+	}
+	return nil, fmt.Errorf("invalid expr %q: unexpected %q at %d", p.s, c, p.pos)
+}
+
+func exprBinary(op byte, l, r exprNode) exprNode {
+	return func(f map[string]interface{}) (float64, bool) {
+		a, ok := l(f)
+		if !ok {
+			return 0, false
+		}
+		b, ok := r(f)
+		if !ok {
+			return 0, false
+		}
+		switch op {
+		case '+':
+			return a + b, true
+		case '-':
+			return a - b, true
+		case '*':
+			return a * b, true
+		}
+		if b == 0 {
+			return 0, false
+		}
+		return a / b, true
+	}
+}
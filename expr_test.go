@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseExpr(t *testing.T) {
+	fields := map[string]interface{}{"in": 10.0, "out": uint64(30), "name": "et-0/0/0", "zero": 0.0}
+	tests := []struct {
+		expr string
+		want float64
+		ok   bool
+		err  bool
+	}{
+		{expr: "1 + 2 * 3", want: 7, ok: true},
+		{expr: "(1 + 2) * 3", want: 9, ok: true},
+		{expr: "-{in} + {out}", want: 20, ok: true},
+		{expr: "({in} + {out}) * 8 / 1e3", want: 0.32, ok: true},
+		{expr: "{in} / {zero}", ok: false},
+		{expr: "{name} * 2", ok: false},
+		{expr: "{missing} + 1", ok: false},
+		{expr: "1 +", err: true},
+		{expr: "(1 + 2", err: true},
+		{expr: "{in", err: true},
+		{expr: "1 2", err: true},
+	}
+	for _, test := range tests {
+		n, err := parseExpr(test.expr)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: want error, got nil", test.expr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		got, ok := n(fields)
+		if ok != test.ok || (ok && got != test.want) {
+			t.Errorf("%s: got %v %v, want %v %v", test.expr, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestExpr(t *testing.T) {
+	in := newPoint("/optics/", map[string]string{"device": "r1"},
+		map[string]interface{}{
+			"/optics/lane-json": `{"lanes": [{"power": -2.5, "bias": {"ma": 31}}, {"power": -3.1}], "vendor": "x"}`,
+			"in-octets":         100.0,
+			"out-octets":        uint64(50),
+			"bad-json":          "{",
+		}, time.Unix(1, 0))
+
+	jctx := &JCtx{}
+	jctx.config.Transform.Expr = ExprConfig{
+		Extract: []ExprExtract{
+			{Match: `^(.*)/lane-json$`, Path: ".lanes[0].power", Field: "${1}/lane0/power", Keep: true},
+			{Match: `^(.*)/lane-json$`, Path: `.lanes[0]."bias".ma`, Field: "${1}/lane0/bias"},
+			{Match: `^(.*)/lane-json$`, Path: ".lanes[1].bias", Field: "missing"},
+			{Match: `^bad-json$`, Path: ".a", Field: "a"},
+		},
+		Compute: []ExprCompute{
+			{Field: "octets", Expr: "{in-octets} + {out-octets}"},
+			{Field: "missing", Expr: "{nope} * 8"},
+		},
+	}
+	if err := transformsInit(jctx); err != nil {
+		t.Fatalf("transformsInit failed: %v", err)
+	}
+	out := applyTransforms(jctx, []*point{in})
+	want := map[string]interface{}{
+		"/optics/lane0/power": -2.5,
+		"/optics/lane0/bias":  31.0,
+		"in-octets":           100.0,
+		"out-octets":          uint64(50),
+		"bad-json":            "{",
+		"octets":              150.0,
+	}
+	if len(out) != 1 || !reflect.DeepEqual(out[0].Fields, want) {
+		t.Errorf("got:  %v\nwant: %v", out[0].Fields, want)
+	}
+	if _, ok := in.Fields["octets"]; ok {
+		t.Errorf("input point modified")
+	}
+
+	for _, path := range []string{"a", ".a[x]", `."a`, ".a[0"} {
+		if _, err := parseJSONPath(path); err == nil {
+			t.Errorf("%s: want error, got nil", path)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	na_pb "github.com/nileshsimaria/jtimon/telemetry"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+var factsCacheFile = flag.String("facts-cache", "", "File the facts of the devices are kept in, their points are tagged with them from the start, before the devices are queried again")
+
+// FactsConfig queries the facts of the device once connected, e.g. its
+// model, serial number and OS version, and tags all its points with them.
+// The facts are the leaves of the subscription to path (default
+// /components/) matching the rules, by default the model and serial number
+// of the chassis and the software version of Junos.
+type FactsConfig struct {
+	Enable bool       `json:"enable"`
+	Path   string     `json:"path"`
+	Rules  []FactRule `json:"rules"`
+	// Timeout is the time in seconds the facts are waited for (default 30)
+	Timeout int `json:"timeout"`
+}
+
+// FactRule takes the value of the first leaf whose full path, with its
+// keys, matches match (regex) as the tag
+type FactRule struct {
+	Match string `json:"match"`
+	Tag   string `json:"tag"`
+}
+
+// defaultFactRules are the facts of the components of Junos
+var defaultFactRules = []FactRule{
+	{Match: `^/components/component\[name='Chassis'\]/state/description$`, Tag: "model"},
+	{Match: `^/components/component\[name='Chassis'\]/state/serial-no$`, Tag: "serial"},
+	{Match: `^/components/component\[name='[^']*'\]/state/software-version$`, Tag: "version"},
+}
+
+const (
+	defaultFactsPath    = "/components/"
+	defaultFactsTimeout = 30
+	// factsFreq is the sample frequency of the query in milliseconds, the
+	// facts are all sent in the first samples
+	factsFreq = 60000
+)
+
+type factRule struct {
+	re  *regexp.Regexp
+	tag string
+}
+
+// factRules returns the compiled rules of cfg, the default ones if it has
+// none
+func factRules(cfg FactsConfig) ([]factRule, error) {
+	rules := cfg.Rules
+	if len(rules) == 0 {
+		rules = defaultFactRules
+	}
+	var compiled []factRule
+	for i, rule := range rules {
+		if rule.Tag == "" || rule.Tag == "device" {
+			return nil, fmt.Errorf("facts rule %d: invalid tag %q", i, rule.Tag)
+		}
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("facts rule %d: invalid match %q: %v", i, rule.Match, err)
+		}
+		compiled = append(compiled, factRule{re: re, tag: rule.Tag})
+	}
+	return compiled, nil
+}
+
+func validateFactsConfig(cfg FactsConfig, vendor string) error {
+	if !cfg.Enable {
+		return nil
+	}
+	if vendor != "" && vendor != "juniper-junos" {
+		return fmt.Errorf("facts are not supported for vendor %s", vendor)
+	}
+	if cfg.Timeout < 0 {
+		return fmt.Errorf("facts timeout can not be negative")
+	}
+	_, err := factRules(cfg)
+	return err
+}
+
+// factsState are the facts of the device of a worker, its points are
+// tagged with them
+type factsState struct {
+	v atomic.Value
+}
+
+func (f *factsState) get() map[string]string {
+	m, _ := f.v.Load().(map[string]string)
+	return m
+}
+
+func (f *factsState) set(m map[string]string) {
+	f.v.Store(m)
+}
+
+// factTags tags the points with the facts of the device
+func factTags(jctx *JCtx, tags map[string]string) {
+	for k, v := range jctx.facts.get() {
+		if _, ok := tags[k]; !ok {
+			tags[k] = v
+		}
+	}
+}
+
+// cachedFacts are the facts of a device in --facts-cache
+type cachedFacts struct {
+	Time  time.Time         `json:"time"`
+	Facts map[string]string `json:"facts"`
+}
+
+// factsCache keeps the facts of the devices in --facts-cache, by device
+type factsCache struct {
+	sync.Mutex
+	file    string
+	devices map[string]cachedFacts
+}
+
+var facts = &factsCache{devices: map[string]cachedFacts{}}
+
+// factsInit reads the facts of --facts-cache, the file is created on the
+// first facts if it does not exist
+func factsInit() error {
+	if *factsCacheFile == "" {
+		return nil
+	}
+	facts.file = *factsCacheFile
+	b, err := ioutil.ReadFile(facts.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, &facts.devices); err != nil {
+		return fmt.Errorf("%s: %v", facts.file, err)
+	}
+	return nil
+}
+
+func (c *factsCache) get(device string) map[string]string {
+	c.Lock()
+	defer c.Unlock()
+	return c.devices[device].Facts
+}
+
+// put keeps the facts of the device, it writes the cache if they changed
+func (c *factsCache) put(device string, m map[string]string, now time.Time) error {
+	c.Lock()
+	defer c.Unlock()
+	old, ok := c.devices[device]
+	c.devices[device] = cachedFacts{Time: now.UTC(), Facts: m}
+	if c.file == "" || ok && sameFacts(old.Facts, m) {
+		return nil
+	}
+	b, err := json.MarshalIndent(c.devices, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(c.file); os.IsNotExist(err) {
+		return ioutil.WriteFile(c.file, b, 0644)
+	}
+	return replaceFile(c.file, b)
+}
+
+func sameFacts(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+// factsStart tags the points of the worker with the cached facts of its
+// device and queries them again over the connection
+func factsStart(jctx *JCtx, conn *grpc.ClientConn) {
+	if !jctx.config.Facts.Enable {
+		return
+	}
+	if jctx.facts.get() == nil {
+		if m := facts.get(jctx.config.Host); m != nil {
+			jctx.facts.set(m)
+		}
+	}
+	go func() {
+		m, err := queryFacts(jctx, conn)
+		if err != nil {
+			jLogWarn(jctx, fmt.Sprintf("Could not query the facts of the device: %v", err))
+			return
+		}
+		jctx.facts.set(m)
+		jLog(jctx, fmt.Sprintf("Facts of the device: %s", formatFacts(m)))
+		if err := facts.put(jctx.config.Host, m, time.Now()); err != nil {
+			jLogWarn(jctx, fmt.Sprintf("Could not write the facts to %s: %v", facts.file, err))
+		}
+	}()
+}
+
+// queryFacts subscribes to the path of the facts until all the tags of the
+// rules are found or the timeout, it fails if none is
+func queryFacts(jctx *JCtx, conn *grpc.ClientConn) (map[string]string, error) {
+	cfg := jctx.config.Facts
+	rules, err := factRules(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tags := map[string]bool{}
+	for _, r := range rules {
+		tags[r.tag] = true
+	}
+	path, timeout := cfg.Path, cfg.Timeout
+	if path == "" {
+		path = defaultFactsPath
+	}
+	if timeout == 0 {
+		timeout = defaultFactsTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+	sctx := ctx
+	if authMode(jctx.config) == AuthMeta {
+		md := metadata.New(map[string]string{"username": jctx.config.User, "password": jctx.config.Password})
+		sctx = metadata.NewOutgoingContext(ctx, md)
+	}
+	stream, err := na_pb.NewOpenConfigTelemetryClient(conn).TelemetrySubscribe(sctx, &na_pb.SubscriptionRequest{
+		PathList: []*na_pb.Path{{Path: path, SampleFrequency: factsFreq}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]string{}
+	for len(m) < len(tags) {
+		ocData, err := stream.Recv()
+		if err != nil {
+			if len(m) != 0 {
+				break
+			}
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("no facts in %s after %ds", path, timeout)
+			}
+			return nil, err
+		}
+		packetLeaves(ocData, func(leaf string, kv *na_pb.KeyValue) {
+			if leaf == "" {
+				return
+			}
+			for _, r := range rules {
+				if _, ok := m[r.tag]; !ok && r.re.MatchString(leaf) {
+					if v := kvValue(kv); v != nil {
+						m[r.tag] = fmt.Sprint(v)
+					}
+				}
+			}
+		})
+	}
+	return m, nil
+}
+
+// formatFacts is the "tag=value" list of the facts
+func formatFacts(m map[string]string) string {
+	var s []string
+	for k, v := range m {
+		s = append(s, k+"="+v)
+	}
+	sort.Strings(s)
+	return strings.Join(s, " ")
+}
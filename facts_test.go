@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nileshsimaria/jtimon/simulator"
+	"google.golang.org/grpc"
+)
+
+func TestValidateFactsConfig(t *testing.T) {
+	tests := []struct {
+		cfg    FactsConfig
+		vendor string
+		err    bool
+	}{
+		{cfg: FactsConfig{}, vendor: "cisco-iosxr"},
+		{cfg: FactsConfig{Enable: true}},
+		{cfg: FactsConfig{Enable: true}, vendor: "cisco-iosxr", err: true},
+		{cfg: FactsConfig{Enable: true, Timeout: -1}, err: true},
+		{cfg: FactsConfig{Enable: true, Rules: []FactRule{{Match: "(", Tag: "model"}}}, err: true},
+		{cfg: FactsConfig{Enable: true, Rules: []FactRule{{Match: "model", Tag: "device"}}}, err: true},
+	}
+	for _, test := range tests {
+		if err := validateFactsConfig(test.cfg, test.vendor); (err != nil) != test.err {
+			t.Errorf("%+v %s: got error %v", test.cfg, test.vendor, err)
+		}
+	}
+}
+
+func TestQueryFacts(t *testing.T) {
+	script := simulator.Script{SystemID: "mx1", Sensors: []simulator.Sensor{
+		{Path: "/components/", Prefixes: []string{"/components/component[name='Chassis']/"}, Fields: []simulator.Field{
+			{Key: "state/description", Value: "MX960"},
+			{Key: "state/serial-no", Value: "JN1234"},
+		}},
+		{Path: "/components/", Prefixes: []string{"/components/component[name='Routing Engine0']/"}, Fields: []simulator.Field{
+			{Key: "state/description", Value: "RE-S-1800x4"},
+			{Key: "state/software-version", Value: "21.4R3"},
+		}},
+	}}
+	s, err := simulator.Start("127.0.0.1:0", script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	host, port, _ := net.SplitHostPort(s.Addr())
+	p, _ := strconv.Atoi(port)
+	conn, err := grpc.Dial(s.Addr(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	jctx := &JCtx{config: Config{Host: host, Port: p, Facts: FactsConfig{Enable: true, Timeout: 5}}}
+	m, err := queryFacts(jctx, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"model": "MX960", "serial": "JN1234", "version": "21.4R3"}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("got facts %v, want %v", m, want)
+	}
+
+	jctx.config.Facts = FactsConfig{Enable: true, Path: "/components/", Timeout: 1,
+		Rules: []FactRule{{Match: "/state/hostname$", Tag: "hostname"}}}
+	if _, err := queryFacts(jctx, conn); err == nil {
+		t.Errorf("no facts: want an error")
+	}
+}
+
+func TestFactsCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-facts-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "facts.json")
+	c := &factsCache{file: file, devices: map[string]cachedFacts{}}
+	m := map[string]string{"model": "MX960", "version": "21.4R3"}
+	if err := c.put("r1", m, time.Unix(0, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	old := *factsCacheFile
+	defer func() {
+		*factsCacheFile = old
+		facts = &factsCache{devices: map[string]cachedFacts{}}
+	}()
+	*factsCacheFile = file
+	if err := factsInit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := facts.get("r1"); !reflect.DeepEqual(got, m) {
+		t.Errorf("got cached facts %v, want %v", got, m)
+	}
+
+	jctx := &JCtx{config: Config{Host: "r1"}}
+	jctx.facts.set(facts.get("r1"))
+	tags := map[string]string{"device": "r1", "version": "point"}
+	factTags(jctx, tags)
+	want := map[string]string{"device": "r1", "model": "MX960", "version": "point"}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("got tags %v, want %v", tags, want)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+)
+
+// UnmarshalJSON takes host as the address of the device or as the list of
+// its addresses, e.g. both RE management IPs, the first one is then the
+// host of the device in its tags and in the control endpoints
+func (c *Config) UnmarshalJSON(b []byte) error {
+	type config Config
+	aux := struct {
+		Host json.RawMessage `json:"host"`
+		*config
+	}{config: (*config)(c)}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	if len(aux.Host) == 0 || string(aux.Host) == "null" {
+		return nil
+	}
+	if aux.Host[0] != '[' {
+		return json.Unmarshal(aux.Host, &c.Host)
+	}
+	var addresses []string
+	if err := json.Unmarshal(aux.Host, &addresses); err != nil {
+		return fmt.Errorf("host: %v", err)
+	}
+	if len(addresses) == 0 {
+		return fmt.Errorf("host: the list of addresses is empty")
+	}
+	c.Host, c.Addresses = addresses[0], addresses
+	return nil
+}
+
+// validateAddresses checks the addresses of the device
+func validateAddresses(config Config) error {
+	for _, a := range config.Addresses {
+		if a == "" {
+			return fmt.Errorf("empty address in the addresses of %s", config.Host)
+		}
+	}
+	return nil
+}
+
+// deviceAddresses returns the addresses of the device of the worker, its
+// host if it has a single one
+func deviceAddresses(jctx *JCtx) []string {
+	if len(jctx.config.Addresses) == 0 {
+		return []string{jctx.config.Host}
+	}
+	return jctx.config.Addresses
+}
+
+// deviceAddress returns the address of the device the worker connects to
+func deviceAddress(jctx *JCtx) string {
+	addresses := deviceAddresses(jctx)
+	return addresses[int(atomic.LoadInt32(&jctx.metrics.address))%len(addresses)]
+}
+
+// failover moves the worker to the next address of its device after the
+// failure of the current one. It tells whether that address is still to be
+// tried, the worker then connects to it at once instead of waiting to
+// reconnect; the addresses are tried again from the first one.
+func failover(jctx *JCtx, err error) bool {
+	addresses := deviceAddresses(jctx)
+	if len(addresses) < 2 {
+		return false
+	}
+	from := deviceAddress(jctx)
+	next := (int(atomic.LoadInt32(&jctx.metrics.address)) + 1) % len(addresses)
+	atomic.StoreInt32(&jctx.metrics.address, int32(next))
+	msg := fmt.Sprintf("failing over from %s to %s", from, addresses[next])
+	if err != nil {
+		msg += fmt.Sprintf(": %v", err)
+	}
+	jLogWarn(jctx, msg)
+	recordEvent(jctx, EventFailover, "", msg)
+	return next != 0
+}
+
+// addressTag tags the points with the address of the device which served
+// them, if it has several
+func addressTag(jctx *JCtx, tags map[string]string) {
+	if len(jctx.config.Addresses) > 1 {
+		tags["address"] = deviceAddress(jctx)
+	}
+}
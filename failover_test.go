@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestConfigHostList(t *testing.T) {
+	tests := []struct {
+		json      string
+		host      string
+		addresses []string
+		err       bool
+	}{
+		{json: `{"host": "r1", "port": 32767}`, host: "r1"},
+		{json: `{"host": ["10.0.0.1", "10.0.0.2"], "port": 32767}`, host: "10.0.0.1", addresses: []string{"10.0.0.1", "10.0.0.2"}},
+		{json: `{"host": "r1", "addresses": ["10.0.0.1", "10.0.0.2"]}`, host: "r1", addresses: []string{"10.0.0.1", "10.0.0.2"}},
+		{json: `{"port": 32767}`},
+		{json: `{"host": []}`, err: true},
+		{json: `{"host": 1}`, err: true},
+		{json: `{"host": "r1", "port": "32767"}`, err: true},
+	}
+	for _, test := range tests {
+		var c Config
+		err := json.Unmarshal([]byte(test.json), &c)
+		if (err != nil) != test.err {
+			t.Errorf("%s: got error %v", test.json, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if c.Host != test.host || !reflect.DeepEqual(c.Addresses, test.addresses) {
+			t.Errorf("%s: got host %q addresses %v, want %q %v", test.json, c.Host, c.Addresses, test.host, test.addresses)
+		}
+	}
+	if c := (Config{Host: "r1", Addresses: []string{"10.0.0.1", ""}}); validateAddresses(c) == nil {
+		t.Errorf("empty address: want an error")
+	}
+}
+
+func TestFailover(t *testing.T) {
+	jctx := &JCtx{config: Config{Host: "r1"}}
+	if deviceAddress(jctx) != "r1" || failover(jctx, nil) || deviceAddress(jctx) != "r1" {
+		t.Errorf("single address: got %s, want no failover", deviceAddress(jctx))
+	}
+	tags := map[string]string{}
+	if addressTag(jctx, tags); len(tags) != 0 {
+		t.Errorf("single address: got tags %v", tags)
+	}
+
+	jctx = &JCtx{config: Config{Host: "10.0.0.1", Addresses: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}}}
+	want := []struct {
+		address string
+		next    bool
+	}{{"10.0.0.2", true}, {"10.0.0.3", true}, {"10.0.0.1", false}}
+	for _, w := range want {
+		next := failover(jctx, errors.New("unavailable"))
+		if got := deviceAddress(jctx); got != w.address || next != w.next {
+			t.Errorf("got %s %v, want %s %v", got, next, w.address, w.next)
+		}
+	}
+	failover(jctx, nil)
+	if addressTag(jctx, tags); tags["address"] != "10.0.0.2" {
+		t.Errorf("got tags %v, want address 10.0.0.2", tags)
+	}
+	if h := workerHealth(jctx); h.Device != "10.0.0.1" || h.Address != "10.0.0.2" {
+		t.Errorf("got health device %s address %s", h.Device, h.Address)
+	}
+	events := jctx.events.events()
+	if len(events) != 4 || events[0].Type != EventFailover ||
+		events[0].Message != "failing over from 10.0.0.1 to 10.0.0.2: unavailable" {
+		t.Errorf("got events %+v", events)
+	}
+}
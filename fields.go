@@ -0,0 +1,78 @@
+package main
+
+// FieldsRule trims the fields written for a measurement. With allow only
+// the named fields are kept, deny drops the named fields. Names are the
+// field names as written, i.e. after rename and sanitize.
+type FieldsRule struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+type fieldsRule struct {
+	allow, deny map[string]bool
+}
+
+// fieldsFilter is applied last so it sees the measurements and fields as
+// they are written
+type fieldsFilter struct {
+	rules map[string]fieldsRule
+}
+
+func newFieldsTransformer() *transformer {
+	return &transformer{
+		name: "fields",
+		new:  newFieldsFilter,
+	}
+}
+
+func stringSet(list []string) map[string]bool {
+	if len(list) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(list))
+	for _, s := range list {
+		set[s] = true
+	}
+	return set
+}
+
+func newFieldsFilter(jctx *JCtx) (transform, error) {
+	cfg := jctx.config.Transform.Fields
+	if len(cfg) == 0 {
+		return nil, nil
+	}
+
+	f := &fieldsFilter{rules: make(map[string]fieldsRule, len(cfg))}
+	for m, rule := range cfg {
+		f.rules[m] = fieldsRule{allow: stringSet(rule.Allow), deny: stringSet(rule.Deny)}
+	}
+	return f, nil
+}
+
+func (r fieldsRule) keep(name string) bool {
+	if r.allow != nil && !r.allow[name] {
+		return false
+	}
+	return !r.deny[name]
+}
+
+func (f *fieldsFilter) apply(points []*point) []*point {
+	out := make([]*point, 0, len(points))
+	for _, p := range points {
+		rule, ok := f.rules[p.Measurement]
+		if !ok {
+			out = append(out, p)
+			continue
+		}
+		fields := make(map[string]interface{}, len(p.Fields))
+		for k, v := range p.Fields {
+			if rule.keep(k) {
+				fields[k] = v
+			}
+		}
+		if len(fields) != 0 {
+			out = append(out, newPoint(p.Measurement, p.Tags, fields, p.Timestamp))
+		}
+	}
+	return out
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestFieldsFilter(t *testing.T) {
+	points := []*point{
+		newPoint("interfaces", map[string]string{"device": "r1"},
+			map[string]interface{}{"in-octets": 1.0, "out-octets": 2.0, "description": "core"}, time.Unix(1, 0)),
+		newPoint("components", map[string]string{"device": "r1"},
+			map[string]interface{}{"temperature": 40.0}, time.Unix(1, 0)),
+	}
+
+	tests := []struct {
+		name   string
+		cfg    map[string]FieldsRule
+		fields []string
+	}{
+		{
+			name:   "allow",
+			cfg:    map[string]FieldsRule{"interfaces": {Allow: []string{"in-octets", "out-octets"}}},
+			fields: []string{"components temperature", "interfaces in-octets", "interfaces out-octets"},
+		},
+		{
+			name:   "deny",
+			cfg:    map[string]FieldsRule{"interfaces": {Deny: []string{"description"}}},
+			fields: []string{"components temperature", "interfaces in-octets", "interfaces out-octets"},
+		},
+		{
+			name: "allow-and-deny",
+			cfg: map[string]FieldsRule{
+				"interfaces": {Allow: []string{"in-octets", "out-octets"}, Deny: []string{"out-octets"}},
+			},
+			fields: []string{"components temperature", "interfaces in-octets"},
+		},
+		{
+			name:   "empty-points-dropped",
+			cfg:    map[string]FieldsRule{"components": {Deny: []string{"temperature"}}},
+			fields: []string{"interfaces description", "interfaces in-octets", "interfaces out-octets"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jctx := &JCtx{}
+			jctx.config.Transform.Fields = test.cfg
+			if err := transformsInit(jctx); err != nil {
+				t.Fatalf("transformsInit failed: %v", err)
+			}
+			var fields []string
+			for _, p := range applyTransforms(jctx, points) {
+				for k := range p.Fields {
+					fields = append(fields, p.Measurement+" "+k)
+				}
+			}
+			sort.Strings(fields)
+			if !reflect.DeepEqual(fields, test.fields) {
+				t.Errorf("got %v, want %v", fields, test.fields)
+			}
+		})
+	}
+}
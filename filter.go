@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// FilterConfig drops updates and fields before they are exported. Paths are
+// matched against the sensor of the update (measurement if there is no
+// sensor tag) and fields against the field name. With include only matching
+// ones are kept, exclude drops the matching ones.
+type FilterConfig struct {
+	IncludePaths  []string `json:"include-paths"`
+	ExcludePaths  []string `json:"exclude-paths"`
+	IncludeFields []string `json:"include-fields"`
+	ExcludeFields []string `json:"exclude-fields"`
+}
+
+type filter struct {
+	includePaths, excludePaths   *regexSet
+	includeFields, excludeFields *regexSet
+}
+
+func newFilterTransformer() *transformer {
+	return &transformer{
+		name: "filter",
+		new:  newFilter,
+	}
+}
+
+func compileRegexList(what string, exprs []string) ([]*regexp.Regexp, error) {
+	var list []*regexp.Regexp
+	for _, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %v", what, expr, err)
+		}
+		list = append(list, re)
+	}
+	return list, nil
+}
+
+func matchAny(list []*regexp.Regexp, s string) bool {
+	for _, re := range list {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func newFilter(jctx *JCtx) (transform, error) {
+	cfg := jctx.config.Transform.Filter
+	f := &filter{}
+	lists := []struct {
+		what  string
+		exprs []string
+		set   **regexSet
+	}{
+		{"include-paths", cfg.IncludePaths, &f.includePaths},
+		{"exclude-paths", cfg.ExcludePaths, &f.excludePaths},
+		{"include-fields", cfg.IncludeFields, &f.includeFields},
+		{"exclude-fields", cfg.ExcludeFields, &f.excludeFields},
+	}
+	n := 0
+	for _, l := range lists {
+		list, err := compileRegexList(l.what, l.exprs)
+		if err != nil {
+			return nil, err
+		}
+		*l.set = newRegexSet(list)
+		n += len(list)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// pointPath is the path paths are matched against, the sensor of the
+// update or the measurement if there is no sensor tag
+func pointPath(p *point) string {
+	if path, ok := p.Tags["sensor"]; ok {
+		return path
+	}
+	return p.Measurement
+}
+
+func (f *filter) keepPath(p *point) bool {
+	path := pointPath(p)
+	if f.includePaths.len() != 0 && !f.includePaths.match(path) {
+		return false
+	}
+	return !f.excludePaths.match(path)
+}
+
+func (f *filter) keepField(name string) bool {
+	if f.includeFields.len() != 0 && !f.includeFields.match(name) {
+		return false
+	}
+	return !f.excludeFields.match(name)
+}
+
+func (f *filter) apply(points []*point) []*point {
+	out := make([]*point, 0, len(points))
+	for _, p := range points {
+		if !f.keepPath(p) {
+			continue
+		}
+		if f.includeFields.len() == 0 && f.excludeFields.len() == 0 {
+			out = append(out, p)
+			continue
+		}
+		fields := make(map[string]interface{}, len(p.Fields))
+		for k, v := range p.Fields {
+			if f.keepField(k) {
+				fields[k] = v
+			}
+		}
+		if len(fields) != 0 {
+			out = append(out, newPoint(p.Measurement, p.Tags, fields, p.Timestamp))
+		}
+	}
+	return out
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestFilter(t *testing.T) {
+	points := []*point{
+		newPoint("/interfaces/", map[string]string{"sensor": "sensor_1000:/interfaces/:/interfaces/:PFE"},
+			map[string]interface{}{
+				"/interfaces/interface/state/counters/in-octets":  1.0,
+				"/interfaces/interface/state/counters/out-octets": 2.0,
+				"/interfaces/interface/state/description":         "core",
+			}, time.Unix(1, 0)),
+		newPoint("/components/", map[string]string{},
+			map[string]interface{}{"/components/component/state/temperature/instant": 40.0}, time.Unix(1, 0)),
+	}
+
+	tests := []struct {
+		name   string
+		cfg    FilterConfig
+		fields []string
+	}{
+		{
+			name: "include-paths",
+			cfg:  FilterConfig{IncludePaths: []string{":/interfaces/:"}},
+			fields: []string{
+				"/interfaces/interface/state/counters/in-octets",
+				"/interfaces/interface/state/counters/out-octets",
+				"/interfaces/interface/state/description",
+			},
+		},
+		{
+			name:   "exclude-paths-by-measurement",
+			cfg:    FilterConfig{ExcludePaths: []string{":/interfaces/:", "^/components/$"}},
+			fields: nil,
+		},
+		{
+			name: "include-and-exclude-fields",
+			cfg: FilterConfig{
+				IncludeFields: []string{"/counters/", "temperature"},
+				ExcludeFields: []string{"out-"},
+			},
+			fields: []string{
+				"/components/component/state/temperature/instant",
+				"/interfaces/interface/state/counters/in-octets",
+			},
+		},
+		{
+			name:   "empty-points-dropped",
+			cfg:    FilterConfig{IncludeFields: []string{"description"}},
+			fields: []string{"/interfaces/interface/state/description"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jctx := &JCtx{}
+			jctx.config.Transform.Filter = test.cfg
+			if err := transformsInit(jctx); err != nil {
+				t.Fatalf("transformsInit failed: %v", err)
+			}
+			var fields []string
+			for _, p := range applyTransforms(jctx, points) {
+				if len(p.Fields) == 0 {
+					t.Errorf("point without fields must be dropped")
+				}
+				for k := range p.Fields {
+					fields = append(fields, k)
+				}
+			}
+			sort.Strings(fields)
+			if len(fields) != len(test.fields) {
+				t.Fatalf("got %v, want %v", fields, test.fields)
+			}
+			for i := range fields {
+				if fields[i] != test.fields[i] {
+					t.Errorf("got %v, want %v", fields, test.fields)
+				}
+			}
+		})
+	}
+
+	jctx := &JCtx{}
+	jctx.config.Transform.Filter = FilterConfig{ExcludeFields: []string{"["}}
+	if err := transformsInit(jctx); err == nil {
+		t.Errorf("want error for invalid regex, got nil")
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+var (
+	// fipsCipherSuites are the cipher suites of TLS 1.2 approved by FIPS
+	// 140-2, the ones of BoringCrypto
+	fipsCipherSuites = []uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	}
+	// fipsCurves are the approved curves of the key exchanges
+	fipsCurves = []tls.CurveID{tls.CurveP256, tls.CurveP384}
+)
+
+// fipsInit checks that the FIPS mode of --fips is backed by a validated
+// crypto module, a build with BoringCrypto (make fips)
+func fipsInit() error {
+	if !fipsBuild {
+		return fmt.Errorf("--fips needs a build with BoringCrypto, see make fips")
+	}
+	return nil
+}
+
+// validateFIPSTLS refuses the TLS settings of a device which are not
+// approved in FIPS mode
+func validateFIPSTLS(cfg TLSConfig) error {
+	if cfg.SkipVerify {
+		return fmt.Errorf("tls skip-verify is not allowed in FIPS mode")
+	}
+	if cfg.MinVersion == "1.0" || cfg.MinVersion == "1.1" {
+		return fmt.Errorf("tls min-version %s is not allowed in FIPS mode, use 1.2 or 1.3", cfg.MinVersion)
+	}
+	for _, name := range cfg.CipherSuites {
+		if !fipsCipherSuite(tlsCipherSuites[name]) {
+			return fmt.Errorf("tls cipher suite %s is not allowed in FIPS mode", name)
+		}
+	}
+	for _, name := range cfg.Curves {
+		if !fipsCurve(tlsCurves[name]) {
+			return fmt.Errorf("tls curve %s is not allowed in FIPS mode, use P256 or P384", name)
+		}
+	}
+	return nil
+}
+
+// fipsTLS restricts t to TLS 1.2 or newer and the approved cipher suites and
+// curves, the ones set are already checked by validateFIPSTLS
+func fipsTLS(t *tls.Config) {
+	if t.MinVersion < tls.VersionTLS12 {
+		t.MinVersion = tls.VersionTLS12
+	}
+	if len(t.CipherSuites) == 0 {
+		t.CipherSuites = fipsCipherSuites
+	}
+	if len(t.CurvePreferences) == 0 {
+		t.CurvePreferences = fipsCurves
+	}
+}
+
+func fipsCipherSuite(id uint16) bool {
+	for _, s := range fipsCipherSuites {
+		if s == id {
+			return true
+		}
+	}
+	return false
+}
+
+func fipsCurve(id tls.CurveID) bool {
+	for _, c := range fipsCurves {
+		if c == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,11 @@
+//go:build boringcrypto
+// +build boringcrypto
+
+package main
+
+// the TLS configs of the process are restricted to the FIPS approved
+// settings, by BoringCrypto
+import _ "crypto/tls/fipsonly"
+
+// fipsBuild tells whether jtimon is built with BoringCrypto
+const fipsBuild = true
@@ -0,0 +1,7 @@
+//go:build !boringcrypto
+// +build !boringcrypto
+
+package main
+
+// fipsBuild tells whether jtimon is built with BoringCrypto
+const fipsBuild = false
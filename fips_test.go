@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestFIPSTLS(t *testing.T) {
+	defer func(v bool) { *fipsMode = v }(*fipsMode)
+	*fipsMode = true
+
+	tests := []struct {
+		name string
+		cfg  TLSConfig
+		err  bool
+	}{
+		{name: "defaults", cfg: TLSConfig{CA: "ca.crt"}},
+		{name: "approved", cfg: TLSConfig{CA: "ca.crt", MinVersion: "1.2", CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"}, Curves: []string{"P384"}}},
+		{name: "tls 1.3", cfg: TLSConfig{CA: "ca.crt", MinVersion: "1.3"}},
+		{name: "tls 1.1", cfg: TLSConfig{CA: "ca.crt", MinVersion: "1.1"}, err: true},
+		{name: "chacha", cfg: TLSConfig{CA: "ca.crt", CipherSuites: []string{"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305"}}, err: true},
+		{name: "cbc", cfg: TLSConfig{CA: "ca.crt", CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA"}}, err: true},
+		{name: "x25519", cfg: TLSConfig{CA: "ca.crt", Curves: []string{"P256", "X25519"}}, err: true},
+		{name: "skip-verify", cfg: TLSConfig{SkipVerify: true}, err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := validateTLSConfig(test.cfg); (err != nil) != test.err {
+				t.Errorf("got %v", err)
+			}
+		})
+	}
+
+	// the settings Go would pick are restricted
+	cfg := &tls.Config{}
+	if err := applyTLSSettings(TLSConfig{CA: "ca.crt"}, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MinVersion != tls.VersionTLS12 || len(cfg.CipherSuites) != len(fipsCipherSuites) || len(cfg.CurvePreferences) != len(fipsCurves) {
+		t.Errorf("got %x %v %v", cfg.MinVersion, cfg.CipherSuites, cfg.CurvePreferences)
+	}
+	cfg = &tls.Config{}
+	if err := applyTLSSettings(TLSConfig{CA: "ca.crt", MinVersion: "1.3", Curves: []string{"P384"}}, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MinVersion != tls.VersionTLS13 || len(cfg.CurvePreferences) != 1 || cfg.CurvePreferences[0] != tls.CurveP384 {
+		t.Errorf("got %x %v %v", cfg.MinVersion, cfg.CipherSuites, cfg.CurvePreferences)
+	}
+
+	if err := fipsInit(); (err == nil) != fipsBuild {
+		t.Errorf("fipsInit %v with fipsBuild %v", err, fipsBuild)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FlattenConfig sets how the paths of the fields are flattened into
+// measurement and field names. The path elements are joined with separator
+// (default "/"), the first depth elements form the measurement and the rest
+// the field name. Without depth the measurement is kept and the whole path
+// is the field name. At least the last element always stays in the field
+// name.
+type FlattenConfig struct {
+	Separator string `json:"separator"`
+	Depth     int    `json:"depth"`
+}
+
+type flatten struct {
+	separator string
+	depth     int
+}
+
+func newFlattenTransformer() *transformer {
+	return &transformer{
+		name: "flatten",
+		new:  newFlatten,
+	}
+}
+
+func newFlatten(jctx *JCtx) (transform, error) {
+	cfg := jctx.config.Transform.Flatten
+	if cfg.Separator == "" && cfg.Depth == 0 {
+		return nil, nil
+	}
+	if cfg.Depth < 0 {
+		return nil, fmt.Errorf("depth can not be negative")
+	}
+	f := &flatten{separator: cfg.Separator, depth: cfg.Depth}
+	if f.separator == "" {
+		f.separator = "/"
+	}
+	return f, nil
+}
+
+// split returns the measurement (empty without depth) and field name of
+// the field path
+func (f *flatten) split(path string) (string, string) {
+	var elems []string
+	for _, e := range strings.Split(path, "/") {
+		if e != "" {
+			elems = append(elems, e)
+		}
+	}
+	if len(elems) == 0 {
+		return "", path
+	}
+
+	n := f.depth
+	if n > len(elems)-1 {
+		n = len(elems) - 1
+	}
+	return strings.Join(elems[:n], f.separator), strings.Join(elems[n:], f.separator)
+}
+
+func (f *flatten) apply(points []*point) []*point {
+	out := make([]*point, 0, len(points))
+	for _, p := range points {
+		// with depth the fields of one point may end up in several
+		// measurements, the points are written sorted by measurement
+		var order []string
+		byMeasurement := map[string]map[string]interface{}{}
+		for k, v := range p.Fields {
+			m, field := f.split(k)
+			if f.depth == 0 || m == "" {
+				m = p.Measurement
+			}
+			fields, ok := byMeasurement[m]
+			if !ok {
+				fields = map[string]interface{}{}
+				byMeasurement[m] = fields
+				order = append(order, m)
+			}
+			fields[field] = v
+		}
+		sort.Strings(order)
+		for _, m := range order {
+			out = append(out, newPoint(m, p.Tags, byMeasurement[m], p.Timestamp))
+		}
+	}
+	return out
+}
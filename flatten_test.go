@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFlatten(t *testing.T) {
+	points := []*point{
+		newPoint("/interfaces/", map[string]string{"device": "r1"},
+			map[string]interface{}{
+				"/interfaces/interface/state/counters/in-octets": 1.0,
+				"/interfaces/interface/state/oper-status":        "UP",
+			}, time.Unix(1, 0)),
+	}
+
+	tests := []struct {
+		name string
+		cfg  FlattenConfig
+		want map[string]map[string]interface{}
+	}{
+		{
+			name: "separator",
+			cfg:  FlattenConfig{Separator: "."},
+			want: map[string]map[string]interface{}{
+				"/interfaces/": {
+					"interfaces.interface.state.counters.in-octets": 1.0,
+					"interfaces.interface.state.oper-status":        "UP",
+				},
+			},
+		},
+		{
+			name: "depth",
+			cfg:  FlattenConfig{Separator: "_", Depth: 3},
+			want: map[string]map[string]interface{}{
+				"interfaces_interface_state": {"counters_in-octets": 1.0, "oper-status": "UP"},
+			},
+		},
+		{
+			name: "depth-splits-measurements",
+			cfg:  FlattenConfig{Depth: 4},
+			want: map[string]map[string]interface{}{
+				"interfaces/interface/state/counters": {"in-octets": 1.0},
+				"interfaces/interface/state":          {"oper-status": "UP"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jctx := &JCtx{}
+			jctx.config.Transform.Flatten = test.cfg
+			if err := transformsInit(jctx); err != nil {
+				t.Fatalf("transformsInit failed: %v", err)
+			}
+			got := map[string]map[string]interface{}{}
+			for _, p := range applyTransforms(jctx, points) {
+				if !reflect.DeepEqual(p.Tags, points[0].Tags) {
+					t.Errorf("tags: got %v", p.Tags)
+				}
+				got[p.Measurement] = p.Fields
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	jctx := &JCtx{}
+	jctx.config.Transform.Flatten = FlattenConfig{Depth: -1}
+	if err := transformsInit(jctx); err == nil {
+		t.Errorf("want error for negative depth, got nil")
+	}
+}
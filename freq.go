@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// freqState is the sample frequencies of the paths of a worker set over the
+// API, e.g. to raise the resolution of the interface counters during an
+// incident. They replace the configured ones, lowered by the adaptive
+// frequency or not, until they expire, are deleted or jtimon is restarted;
+// config reloads keep them. A path with its own frequency is subscribed in a
+// stream of its own so that a change resubscribes just that path.
+type freqState struct {
+	sync.Mutex
+	paths map[string]*freqOverride
+	// changed is notified of the changes while the worker streams in several
+	// streams, nil otherwise
+	changed chan struct{}
+}
+
+type freqOverride struct {
+	freq  uint64
+	until time.Time
+	timer *time.Timer
+}
+
+// set sets the frequency of the path until until, if not zero, expire is
+// then called with the override
+func (f *freqState) set(path string, freq uint64, until time.Time, expire func(*freqOverride)) {
+	f.Lock()
+	defer f.Unlock()
+	if o := f.paths[path]; o != nil && o.timer != nil {
+		o.timer.Stop()
+	}
+	o := &freqOverride{freq: freq, until: until}
+	if !until.IsZero() {
+		o.timer = time.AfterFunc(time.Until(until), func() { expire(o) })
+	}
+	if f.paths == nil {
+		f.paths = map[string]*freqOverride{}
+	}
+	f.paths[path] = o
+}
+
+// clear deletes the frequency of the path, only if it is o unless o is nil,
+// it returns false if there is none
+func (f *freqState) clear(path string, o *freqOverride) bool {
+	f.Lock()
+	defer f.Unlock()
+	cur := f.paths[path]
+	if cur == nil || o != nil && cur != o {
+		return false
+	}
+	if cur.timer != nil {
+		cur.timer.Stop()
+	}
+	delete(f.paths, path)
+	return true
+}
+
+// freqs returns the frequencies by path, nil if there are none
+func (f *freqState) freqs() map[string]uint64 {
+	f.Lock()
+	defer f.Unlock()
+	if len(f.paths) == 0 {
+		return nil
+	}
+	m := make(map[string]uint64, len(f.paths))
+	for path, o := range f.paths {
+		m[path] = o.freq
+	}
+	return m
+}
+
+// listen returns the channel the changes are notified on until unlisten
+func (f *freqState) listen() <-chan struct{} {
+	f.Lock()
+	defer f.Unlock()
+	f.changed = make(chan struct{}, 1)
+	return f.changed
+}
+
+func (f *freqState) unlisten() {
+	f.Lock()
+	defer f.Unlock()
+	f.changed = nil
+}
+
+// notify notifies the streams of a change, it returns false if the worker
+// does not listen to them
+func (f *freqState) notify() bool {
+	f.Lock()
+	defer f.Unlock()
+	if f.changed == nil {
+		return false
+	}
+	select {
+	case f.changed <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// apiPathFreq is the frequency of a path served by /devices/{name}/freq
+type apiPathFreq struct {
+	Path           string     `json:"path"`
+	Freq           uint64     `json:"freq"`
+	ConfiguredFreq uint64     `json:"configured-freq"`
+	Until          *time.Time `json:"until,omitempty"`
+}
+
+// devicePathFreqs is the body of GET /devices/{name}/freq
+type devicePathFreqs struct {
+	Paths []apiPathFreq `json:"paths"`
+}
+
+// pathFreqs returns the frequencies set over the API of the configured
+// paths of the worker, sorted by path
+func pathFreqs(jctx *JCtx) devicePathFreqs {
+	jctx.freqs.Lock()
+	defer jctx.freqs.Unlock()
+	paths := []apiPathFreq{}
+	for _, p := range jctx.config.Paths {
+		o := jctx.freqs.paths[p.Path]
+		if o == nil {
+			continue
+		}
+		f := apiPathFreq{Path: p.Path, Freq: o.freq, ConfiguredFreq: p.Freq}
+		if !o.until.IsZero() {
+			until := o.until.UTC()
+			f.Until = &until
+		}
+		paths = append(paths, f)
+	}
+	sort.Slice(paths, func(i, j int) bool { return paths[i].Path < paths[j].Path })
+	return devicePathFreqs{Paths: paths}
+}
+
+// freqRequest is the body of PUT /devices/{name}/freq, the frequency is in
+// milliseconds and lasts for duration, e.g. "15m", if set
+type freqRequest struct {
+	Path     string  `json:"path"`
+	Freq     *uint64 `json:"freq"`
+	Duration string  `json:"duration"`
+}
+
+// deviceFreq serves the frequencies of the paths of the worker set over the
+// API on GET, sets one on PUT and puts back the configured one of the path
+// query parameter on DELETE
+func deviceFreq(w http.ResponseWriter, r *http.Request, jctx *JCtx) {
+	switch r.Method {
+	case "GET":
+	case "PUT", "DELETE":
+		if vendor, err := getVendor(jctx); err != nil || vendor.name != "juniper-junos" {
+			http.Error(w, fmt.Sprintf("freq is not supported for vendor %s", jctx.config.Vendor.Name), http.StatusNotImplemented)
+			return
+		}
+		var code int
+		var err error
+		if r.Method == "PUT" {
+			code, err = putFreq(r, jctx)
+		} else {
+			code, err = deleteFreq(r.Context(), jctx, r.URL.Query().Get("path"))
+		}
+		if err != nil {
+			http.Error(w, err.Error(), code)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, pathFreqs(jctx))
+}
+
+func putFreq(r *http.Request, jctx *JCtx) (int, error) {
+	var req freqRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid freq: %v", err)
+	}
+	if req.Path == "" || req.Freq == nil {
+		return http.StatusBadRequest, fmt.Errorf("path or freq is missing")
+	}
+	var d time.Duration
+	if req.Duration != "" {
+		var err error
+		if d, err = time.ParseDuration(req.Duration); err != nil || d <= 0 {
+			return http.StatusBadRequest, fmt.Errorf("invalid duration %q", req.Duration)
+		}
+	}
+	return setFreq(r.Context(), jctx, req.Path, *req.Freq, d)
+}
+
+// setFreq sets the frequency of the path of the worker for d, or until it
+// is deleted if d is 0, for the request of ctx
+func setFreq(ctx context.Context, jctx *JCtx, path string, freq uint64, d time.Duration) (int, error) {
+	if !configuredPath(jctx, path) {
+		return http.StatusNotFound, fmt.Errorf("%s is not a path of %s", path, jctx.config.Host)
+	}
+	before := pathFreqs(jctx)
+	var until time.Time
+	msg := fmt.Sprintf("frequency of %s set to %dms", path, freq)
+	if d > 0 {
+		until = time.Now().Add(d)
+		msg += fmt.Sprintf(" for %v", d)
+	}
+	jctx.freqs.set(path, freq, until, func(o *freqOverride) {
+		if jctx.freqs.clear(path, o) {
+			freqChanged(jctx, fmt.Sprintf("frequency of %s set back to the configured one, %v passed", path, d))
+		}
+	})
+	auditChange(ctx, jctx.config.Host, before, pathFreqs(jctx))
+	freqChanged(jctx, msg)
+	return http.StatusOK, nil
+}
+
+// deleteFreq puts back the configured frequency of the path of the worker
+func deleteFreq(ctx context.Context, jctx *JCtx, path string) (int, error) {
+	if path == "" {
+		return http.StatusBadRequest, fmt.Errorf("path is missing")
+	}
+	before := pathFreqs(jctx)
+	if !jctx.freqs.clear(path, nil) {
+		return http.StatusNotFound, fmt.Errorf("the frequency of %s is not set", path)
+	}
+	auditChange(ctx, jctx.config.Host, before, pathFreqs(jctx))
+	freqChanged(jctx, fmt.Sprintf("frequency of %s set back to the configured one", path))
+	return http.StatusOK, nil
+}
+
+// freqChanged logs and records the change and resubscribes the path, the
+// whole device if it is streamed in a single stream
+func freqChanged(jctx *JCtx, msg string) {
+	jLog(jctx, fmt.Sprintf("%s: %s", jctx.config.Host, msg))
+	recordEvent(jctx, EventFreq, "", msg)
+	if !jctx.freqs.notify() {
+		resubscribe(jctx)
+	}
+}
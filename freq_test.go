@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/nileshsimaria/jtimon/simulator"
+	"google.golang.org/grpc"
+)
+
+func TestJunosSubscriptionRequestsFreq(t *testing.T) {
+	cfg := &Config{GRPC: GRPCConfig{Streams: 2}}
+	for _, path := range []string{"/interfaces", "/components", "/lldp", "/bgp"} {
+		cfg.Paths = append(cfg.Paths, PathsConfig{Path: path, Freq: 2000})
+	}
+	reqs := junosSubscriptionRequests(cfg, 2, map[string]uint64{"/interfaces": 500})
+	var got [][]string
+	for _, req := range reqs {
+		var paths []string
+		for _, p := range req.PathList {
+			paths = append(paths, p.Path+"@"+strconv.Itoa(int(p.SampleFrequency)))
+		}
+		got = append(got, paths)
+	}
+	want := [][]string{{"/components@4000", "/bgp@4000"}, {"/lldp@4000"}, {"/interfaces@500"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	cfg.Paths = cfg.Paths[:1]
+	if reqs := junosSubscriptionRequests(cfg, 1, map[string]uint64{"/interfaces": 500}); len(reqs) != 1 || reqs[0].PathList[0].SampleFrequency != 500 {
+		t.Errorf("single path: got %v", reqs)
+	}
+}
+
+func TestDeviceFreq(t *testing.T) {
+	jctx := &JCtx{
+		config:  Config{Host: "r1", Port: 32767, Paths: []PathsConfig{{Path: "/interfaces/", Freq: 30000}}},
+		control: make(chan os.Signal, 1),
+	}
+	dropsInit(jctx)
+	defer dropsStop(jctx)
+	do := func(method, url, body string) (int, devicePathFreqs) {
+		rec := httptest.NewRecorder()
+		devicesHandler(rec, httptest.NewRequest(method, url, strings.NewReader(body)))
+		var v devicePathFreqs
+		json.Unmarshal(rec.Body.Bytes(), &v)
+		return rec.Code, v
+	}
+
+	if code, _ := do("PUT", "/devices/r1/freq", `{"path": "/bgp/", "freq": 1000}`); code != http.StatusNotFound {
+		t.Errorf("path not configured: got code %d", code)
+	}
+	if code, _ := do("PUT", "/devices/r1/freq", `{"path": "/interfaces/", "freq": 1000, "duration": "-1s"}`); code != http.StatusBadRequest {
+		t.Errorf("invalid duration: got code %d", code)
+	}
+	code, v := do("PUT", "/devices/r1/freq", `{"path": "/interfaces/", "freq": 1000}`)
+	want := []apiPathFreq{{Path: "/interfaces/", Freq: 1000, ConfiguredFreq: 30000}}
+	if code != http.StatusOK || !reflect.DeepEqual(v.Paths, want) {
+		t.Errorf("PUT: got %d %+v, want %+v", code, v.Paths, want)
+	}
+	// not streaming in several streams, the worker subscribes again
+	select {
+	case s := <-jctx.control:
+		if s != syscall.SIGHUP {
+			t.Errorf("got signal %v", s)
+		}
+	default:
+		t.Errorf("the worker is not resubscribed")
+	}
+	if events := jctx.events.events(); len(events) != 1 || events[0].Type != EventFreq {
+		t.Errorf("got events %+v", events)
+	}
+
+	if code, v := do("DELETE", "/devices/r1/freq?path=/interfaces/", ""); code != http.StatusOK || len(v.Paths) != 0 {
+		t.Errorf("DELETE: got %d %+v", code, v.Paths)
+	}
+	if code, _ := do("DELETE", "/devices/r1/freq?path=/interfaces/", ""); code != http.StatusNotFound {
+		t.Errorf("DELETE again: got code %d", code)
+	}
+	<-jctx.control
+
+	// the frequency expires
+	do("PUT", "/devices/r1/freq", `{"path": "/interfaces/", "freq": 1000, "duration": "50ms"}`)
+	<-jctx.control
+	select {
+	case <-jctx.control:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the frequency did not expire")
+	}
+	if _, v := do("GET", "/devices/r1/freq", ""); len(v.Paths) != 0 {
+		t.Errorf("after the duration: got %+v", v.Paths)
+	}
+
+	jctx.config.Vendor.Name = "cisco-iosxr"
+	if code, _ := do("PUT", "/devices/r1/freq", `{"path": "/interfaces/", "freq": 1000}`); code != http.StatusNotImplemented {
+		t.Errorf("cisco-iosxr: got code %d", code)
+	}
+}
+
+func TestJunosStreamsFreq(t *testing.T) {
+	script := simulator.Script{Sensors: []simulator.Sensor{
+		{Path: "/a/", Fields: []simulator.Field{{Key: "/a/v", Value: 1}}},
+		{Path: "/b/", Fields: []simulator.Field{{Key: "/b/v", Value: 1}}},
+	}}
+	s, err := simulator.Start("127.0.0.1:0", script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	host, port, _ := net.SplitHostPort(s.Addr())
+	p, _ := strconv.Atoi(port)
+	conn, err := grpc.Dial(s.Addr(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	jctx := &JCtx{
+		config: Config{Host: host, Port: p, Paths: []PathsConfig{{Path: "/a/", Freq: 60000}, {Path: "/b/", Freq: 60000}}},
+		influxCtx: InfluxCtx{
+			reXpath: regexp.MustCompile(MatchExpressionXpath),
+			reKey:   regexp.MustCompile(MatchExpressionKey),
+		},
+		control: make(chan os.Signal),
+	}
+	jctx.freqs.set("/a/", 30000, time.Time{}, nil)
+	statusch := make(chan bool, 10)
+	codes := make(chan SubErrorCode)
+	go func() {
+		codes <- subscribeJunos(conn, jctx, statusch)
+	}()
+	started := func(n uint64) {
+		deadline := time.Now().Add(10 * time.Second)
+		for s.Stats().Subscriptions < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("got %d subscriptions, want %d", s.Stats().Subscriptions, n)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	started(2)
+
+	// only the stream of /a/ subscribes again
+	jctx.freqs.set("/a/", 1000, time.Time{}, nil)
+	if !jctx.freqs.notify() {
+		t.Fatalf("the streams do not listen to the changes")
+	}
+	started(3)
+	time.Sleep(100 * time.Millisecond)
+	if n := s.Stats().Subscriptions; n != 3 {
+		t.Errorf("got %d subscriptions, want 3", n)
+	}
+
+	// the paths move between the streams, all of them subscribe again
+	jctx.freqs.clear("/a/", nil)
+	jctx.freqs.notify()
+	select {
+	case code := <-codes:
+		if code != SubRcSighupRestart {
+			t.Errorf("got code %d, want %d", code, SubRcSighupRestart)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("streams did not stop")
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	na_pb "github.com/nileshsimaria/jtimon/telemetry"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// getTimeout is how long a get waits for the data of the device unless
+	// the request says otherwise, getTimeoutMax is the longest it may ask for
+	getTimeout    = 10 * time.Second
+	getTimeoutMax = time.Minute
+	// getFrequency is the sample frequency (ms) of the subscription of a get
+	getFrequency = 1000
+)
+
+// liveConn is the connection of a worker while it is subscribed
+type liveConn struct {
+	sync.Mutex
+	conn *grpc.ClientConn
+}
+
+func (c *liveConn) set(conn *grpc.ClientConn) {
+	c.Lock()
+	defer c.Unlock()
+	c.conn = conn
+}
+
+func (c *liveConn) get() *grpc.ClientConn {
+	c.Lock()
+	defer c.Unlock()
+	return c.conn
+}
+
+// getRequest is the body of POST /devices/{name}/get
+type getRequest struct {
+	Path    string `json:"path"`
+	Timeout string `json:"timeout"`
+}
+
+// getReply is the answer of POST /devices/{name}/get, complete tells whether
+// the device sent all the data of the path before the timeout
+type getReply struct {
+	Path     string   `json:"path"`
+	Complete bool     `json:"complete"`
+	Points   []*point `json:"points"`
+}
+
+// deviceGet fetches the current data of a path from the device over the
+// connection of the worker and answers the decoded points
+func deviceGet(w http.ResponseWriter, r *http.Request, jctx *JCtx) {
+	var req getRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Path == "" {
+		http.Error(w, "no path", http.StatusBadRequest)
+		return
+	}
+	timeout := getTimeout
+	if req.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(req.Timeout); err != nil || timeout <= 0 || timeout > getTimeoutMax {
+			http.Error(w, fmt.Sprintf("invalid timeout %q, up to %v", req.Timeout, getTimeoutMax), http.StatusBadRequest)
+			return
+		}
+	}
+
+	vendor, err := getVendor(jctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if vendor.get == nil {
+		http.Error(w, fmt.Sprintf("get is not supported for vendor %s", vendor.name), http.StatusNotImplemented)
+		return
+	}
+	conn := jctx.conn.get()
+	if conn == nil {
+		http.Error(w, fmt.Sprintf("device %s is not connected", jctx.config.Host), http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	points, complete, err := vendor.get(ctx, conn, jctx, req.Path)
+	if err != nil {
+		jLogError(jctx, req.Path, "get failed", err)
+		http.Error(w, fmt.Sprintf("get of %s failed: %v", req.Path, err), http.StatusBadGateway)
+		return
+	}
+	if len(points) == 0 && !complete {
+		http.Error(w, fmt.Sprintf("no data for %s within %v", req.Path, timeout), http.StatusGatewayTimeout)
+		return
+	}
+	if points == nil {
+		points = []*point{}
+	}
+	writeJSON(w, getReply{Path: req.Path, Complete: complete, Points: points})
+}
+
+// getJunos subscribes to the path on the connection and gathers the data of
+// one sample, until the sync response, an end of marker or the first data of
+// the next sample, or until ctx is done. The points are not transformed, the
+// transforms keep the state of the subscription.
+func getJunos(ctx context.Context, conn *grpc.ClientConn, jctx *JCtx, path string) ([]*point, bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if authMode(jctx.config) == AuthMeta {
+		md := metadata.New(map[string]string{"username": jctx.config.User, "password": jctx.config.Password})
+		ctx = metadata.NewOutgoingContext(ctx, md)
+	}
+	c := na_pb.NewOpenConfigTelemetryClient(conn)
+	stream, err := c.TelemetrySubscribe(ctx, &na_pb.SubscriptionRequest{
+		PathList:         []*na_pb.Path{{Path: path, SampleFrequency: getFrequency}},
+		AdditionalConfig: &na_pb.SubscriptionAdditionalConfig{NeedEos: true},
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	var points []*point
+	seen := map[string]bool{}
+	for {
+		ocData, err := stream.Recv()
+		if err == io.EOF {
+			return points, true, nil
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return points, false, nil
+			}
+			return nil, false, err
+		}
+		// the same sensor and prefix again starts the next sample
+		key := getSampleKey(ocData)
+		if seen[key] {
+			return points, true, nil
+		}
+		seen[key] = true
+		points = append(points, decodePoints(ocData, jctx, time.Now(), true)...)
+		if ocData.SyncResponse || len(ocData.Eom) != 0 {
+			return points, true, nil
+		}
+	}
+}
+
+func getSampleKey(ocData *na_pb.OpenConfigData) string {
+	prefix := ""
+	for _, kv := range ocData.Kv {
+		if kv.Key == "__prefix__" {
+			prefix = kv.GetStrValue()
+			break
+		}
+	}
+	return fmt.Sprintf("%s|%d|%d|%s", ocData.Path, ocData.ComponentId, ocData.SubComponentId, prefix)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+func TestDeviceGet(t *testing.T) {
+	jctx := &JCtx{
+		file:   "r1.json",
+		config: Config{Host: "127.0.0.1", Port: 50051},
+		influxCtx: InfluxCtx{
+			reXpath: regexp.MustCompile(MatchExpressionXpath),
+			reKey:   regexp.MustCompile(MatchExpressionKey),
+		},
+	}
+	dropsInit(jctx)
+	defer dropsStop(jctx)
+	xr := &JCtx{file: "xr.json", config: Config{Host: "xr", Vendor: VendorConfig{Name: "cisco-iosxr"}}}
+	dropsInit(xr)
+	defer dropsStop(xr)
+
+	get := func(method, url, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		devicesHandler(rec, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return rec
+	}
+	for _, test := range []struct {
+		method string
+		url    string
+		body   string
+		code   int
+	}{
+		{"GET", "/devices/127.0.0.1/get", "", http.StatusMethodNotAllowed},
+		{"POST", "/devices/127.0.0.1/get", "path=/interfaces/", http.StatusBadRequest},
+		{"POST", "/devices/127.0.0.1/get", `{}`, http.StatusBadRequest},
+		{"POST", "/devices/127.0.0.1/get", `{"path": "/interfaces/", "timeout": "1h"}`, http.StatusBadRequest},
+		{"POST", "/devices/127.0.0.1/get", `{"path": "/interfaces/", "timeout": "soon"}`, http.StatusBadRequest},
+		{"POST", "/devices/127.0.0.1/get", `{"path": "/interfaces/"}`, http.StatusServiceUnavailable},
+		{"POST", "/devices/xr/get", `{"path": "/interfaces/"}`, http.StatusNotImplemented},
+		{"POST", "/devices/r9/get", `{"path": "/interfaces/"}`, http.StatusNotFound},
+	} {
+		if rec := get(test.method, test.url, test.body); rec.Code != test.code {
+			t.Errorf("%s %s %s: got %d %s, want %d", test.method, test.url, test.body, rec.Code, rec.Body, test.code)
+		}
+	}
+
+	// from the simulator
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, "127.0.0.1:50051", grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	jctx.conn.set(conn)
+	defer jctx.conn.set(nil)
+
+	rec := get("POST", "/devices/127.0.0.1/get", `{"path": "/interfaces/", "timeout": "20s"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d %s", rec.Code, rec.Body)
+	}
+	var reply getReply
+	if err := json.Unmarshal(rec.Body.Bytes(), &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Path != "/interfaces/" || !reply.Complete || len(reply.Points) == 0 {
+		t.Fatalf("got %s", rec.Body)
+	}
+	seen := map[string]bool{}
+	for _, p := range reply.Points {
+		if p.Tags["device"] != "127.0.0.1" || !strings.Contains(p.Tags["sensor"], "/interfaces/") {
+			t.Errorf("got point %+v", p)
+		}
+		key := seriesKey(p, p.Measurement)
+		if seen[key] {
+			t.Errorf("got %s twice", key)
+		}
+		seen[key] = true
+		if len(p.Fields) == 0 {
+			t.Errorf("got no fields in %+v", p)
+		}
+	}
+}
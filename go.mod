@@ -12,10 +12,11 @@ require (
 	github.com/nileshsimaria/jtisim v0.0.0-20190103005352-93e1756cba8f
 	github.com/nileshsimaria/lpserver v0.0.0-20190104003445-1fca7666fe3e
 	github.com/prometheus/client_golang v0.8.0
-	github.com/prometheus/client_model v0.0.0-20171117100541-99fa1f4be8e5 // indirect
+	github.com/prometheus/client_model v0.0.0-20171117100541-99fa1f4be8e5
 	github.com/prometheus/common v0.0.0-20180413074202-d0f7cd64bda4 // indirect
 	github.com/prometheus/procfs v0.0.0-20180408092902-8b1c2da0d56d // indirect
 	github.com/spf13/pflag v1.0.1
+	github.com/yuin/gopher-lua v1.1.1
 	golang.org/x/net v0.0.0-20180420171651-5f9ae10d9af5
 	golang.org/x/text v0.3.0 // indirect
 	google.golang.org/genproto v0.0.0-20180413175816-7fd901a49ba6 // indirect
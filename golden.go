@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb/client/v2"
+	na_pb "github.com/nileshsimaria/jtimon/telemetry"
+	flag "github.com/spf13/pflag"
+)
+
+// The formats of the golden files
+const (
+	GoldenFormatLine = "line"
+	GoldenFormatJSON = "json"
+)
+
+var (
+	golden       = flag.Bool("golden", false, "jtimon replay compares the points of each config file with its golden file, {config}.golden.lp or .golden.json")
+	goldenUpdate = flag.Bool("golden-update", false, "jtimon replay writes the golden files instead of comparing them")
+	goldenFormat = flag.String("golden-format", GoldenFormatLine, "Format of the golden files (line for the InfluxDB line protocol, or json)")
+)
+
+// goldenFile is the golden file of the config file in format
+func goldenFile(config, format string) string {
+	if format == GoldenFormatJSON {
+		return config + ".golden.json"
+	}
+	return config + ".golden.lp"
+}
+
+// replayGolden replays the recording of the worker and returns the points
+// it exports after its transforms, one per line in format. The messages are
+// received at their device timestamp, the output does not change from one
+// run to the next.
+func replayGolden(jctx *JCtx, format string) ([]byte, error) {
+	if format != GoldenFormatLine && format != GoldenFormatJSON {
+		return nil, fmt.Errorf("golden format %q is not supported, use %s or %s", format, GoldenFormatLine, GoldenFormatJSON)
+	}
+	var buf bytes.Buffer
+	var err error
+	_, rerr := eachRecorded(jctx, func(ocData *na_pb.OpenConfigData) {
+		rtime := time.Unix(0, int64(ocData.Timestamp)*int64(time.Millisecond)).UTC()
+		points := applyTransforms(jctx, decodePoints(ocData, jctx, rtime, true))
+		for _, p := range points {
+			if err != nil {
+				return
+			}
+			var line string
+			if line, err = goldenLine(p, format); err == nil {
+				buf.WriteString(line)
+				buf.WriteByte('\n')
+			}
+		}
+	})
+	if rerr != nil {
+		return nil, rerr
+	}
+	return buf.Bytes(), err
+}
+
+// goldenLine renders the point in format, with the tags and fields sorted
+func goldenLine(p *point, format string) (string, error) {
+	if format == GoldenFormatJSON {
+		b, err := json.Marshal(p)
+		return string(b), err
+	}
+	pt, err := client.NewPoint(p.Measurement, p.Tags, p.Fields, p.Timestamp)
+	if err != nil {
+		return "", err
+	}
+	return pt.String(), nil
+}
+
+// goldenDiff describes the first difference between the output and the
+// golden file, "" if there is none
+func goldenDiff(got, want []byte) string {
+	if bytes.Equal(got, want) {
+		return ""
+	}
+	g, w := strings.Split(string(got), "\n"), strings.Split(string(want), "\n")
+	for i := 0; i < len(g) || i < len(w); i++ {
+		var gl, wl string
+		if i < len(g) {
+			gl = g[i]
+		}
+		if i < len(w) {
+			wl = w[i]
+		}
+		if gl != wl {
+			return fmt.Sprintf("line %d:\n-%s\n+%s", i+1, wl, gl)
+		}
+	}
+	return ""
+}
+
+// checkGolden compares the points of the recording of the worker with its
+// golden file, or writes the file with update
+func checkGolden(jctx *JCtx, format string, update bool) error {
+	got, err := replayGolden(jctx, format)
+	if err != nil {
+		return err
+	}
+	file := goldenFile(jctx.file, format)
+	if update {
+		return ioutil.WriteFile(file, got, 0644)
+	}
+	want, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if diff := goldenDiff(got, want); diff != "" {
+		return fmt.Errorf("the points differ from %s at %s", file, diff)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestGolden replays the recordings of tests/data/golden and compares the
+// points with the golden files, JTIMON_UPDATE_GOLDEN=1 writes them instead
+func TestGolden(t *testing.T) {
+	update := os.Getenv("JTIMON_UPDATE_GOLDEN") == "1"
+	configs, err := filepath.Glob("tests/data/golden/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, config := range configs {
+		if strings.Contains(config, ".golden.") {
+			continue
+		}
+		t.Run(filepath.Base(config), func(t *testing.T) {
+			jctx := &JCtx{file: config, stats: statsCtx{startTime: time.Now()}}
+			if err := ConfigRead(jctx, true, nil); err != nil {
+				t.Fatal(err)
+			}
+			defer dropsStop(jctx)
+			for _, format := range []string{GoldenFormatLine, GoldenFormatJSON} {
+				if _, err := os.Stat(goldenFile(config, format)); err != nil && !(update && format == GoldenFormatLine) {
+					continue
+				}
+				n++
+				if err := checkGolden(jctx, format, update); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+	if n < 3 {
+		t.Errorf("%d golden files", n)
+	}
+}
+
+func TestGoldenDiff(t *testing.T) {
+	tests := []struct {
+		got, want string
+		diff      string
+	}{
+		{got: "a\nb\n", want: "a\nb\n"},
+		{got: "a\nc\n", want: "a\nb\n", diff: "line 2:\n-b\n+c"},
+		{got: "a\n", want: "a\nb\n", diff: "line 2:\n-b\n+"},
+		{got: "a\nb\nc\n", want: "a\nb\n", diff: "line 3:\n-\n+c"},
+	}
+	for _, test := range tests {
+		if diff := goldenDiff([]byte(test.got), []byte(test.want)); diff != test.diff {
+			t.Errorf("%q %q: got %q, want %q", test.got, test.want, diff, test.diff)
+		}
+	}
+
+	jctx := &JCtx{file: "tests/data/golden/interfaces.json"}
+	if _, err := replayGolden(jctx, "csv"); err == nil {
+		t.Errorf("csv format accepted")
+	}
+}
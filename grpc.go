@@ -5,6 +5,9 @@ import (
 	"crypto/x509"
 	"fmt"
 	"io/ioutil"
+	"regexp"
+	"strconv"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
@@ -15,25 +18,49 @@ func getSecurityOptions(jctx *JCtx) (grpc.DialOption, error) {
 	var bs []byte
 	var err error
 
-	if jctx.config.TLS.CA == "" {
+	if !tlsEnabled(jctx.config.TLS) {
 		return grpc.WithInsecure(), nil
 	}
 
-	certificate, _ := tls.LoadX509KeyPair(jctx.config.TLS.ClientCrt, jctx.config.TLS.ClientKey)
-	certPool := x509.NewCertPool()
-	if bs, err = ioutil.ReadFile(jctx.config.TLS.CA); err != nil {
-		return nil, fmt.Errorf("[%s] failed to read ca cert: %s", jctx.config.Host, err)
+	var certificate tls.Certificate
+	if len(jctx.config.TLS.Signer) != 0 {
+		if certificate, err = loadSignerCertificate(jctx.config.TLS.ClientCrt, jctx.config.TLS.Signer); err != nil {
+			return nil, fmt.Errorf("[%s] failed to load client cert: %s", jctx.config.Host, err)
+		}
+	} else {
+		certificate, _ = tls.LoadX509KeyPair(jctx.config.TLS.ClientCrt, jctx.config.TLS.ClientKey)
 	}
+	var certPool *x509.CertPool
+	if jctx.config.TLS.CA != "" {
+		certPool = x509.NewCertPool()
+		if bs, err = ioutil.ReadFile(jctx.config.TLS.CA); err != nil {
+			return nil, fmt.Errorf("[%s] failed to read ca cert: %s", jctx.config.Host, err)
+		}
 
-	if ok := certPool.AppendCertsFromPEM(bs); !ok {
-		return nil, fmt.Errorf("[%s] failed to append certs", jctx.config.Host)
+		if ok := certPool.AppendCertsFromPEM(bs); !ok {
+			return nil, fmt.Errorf("[%s] failed to append certs", jctx.config.Host)
+		}
 	}
 
-	transportCreds := credentials.NewTLS(&tls.Config{
-		Certificates: []tls.Certificate{certificate},
-		ServerName:   jctx.config.TLS.ServerName,
-		RootCAs:      certPool,
-	})
+	tlsConfig := &tls.Config{
+		Certificates:       []tls.Certificate{certificate},
+		ServerName:         jctx.config.TLS.ServerName,
+		RootCAs:            certPool,
+		InsecureSkipVerify: jctx.config.TLS.SkipVerify,
+	}
+	if jctx.config.TLS.SkipVerify {
+		jLogWarn(jctx, fmt.Sprintf("INSECURE: the certificate of %s is not verified (skip-verify), the connection may be intercepted", jctx.config.Host))
+	}
+	if err := applyTLSSettings(jctx.config.TLS, tlsConfig); err != nil {
+		return nil, fmt.Errorf("[%s] %v", jctx.config.Host, err)
+	}
+	if jctx.config.TLS.SPIFFE {
+		if err := spiffeTLS(jctx.config.TLS, tlsConfig); err != nil {
+			return nil, fmt.Errorf("[%s] %v", jctx.config.Host, err)
+		}
+	}
+	revocationTLS(jctx, tlsConfig)
+	transportCreds := credentials.NewTLS(tlsConfig)
 
 	return grpc.WithTransportCredentials(transportCreds), nil
 }
@@ -47,7 +74,7 @@ func getGPRCDialOptions(jctx *JCtx, vendor *vendor) ([]grpc.DialOption, error) {
 		return nil, err
 	}
 
-	if *stateHandler {
+	if *stateHandler || jctx.config.Influx.SelfMeasurement != "" {
 		opts = append(opts, grpc.WithStatsHandler(&statshandler{jctx: jctx}))
 	}
 
@@ -60,8 +87,16 @@ func getGPRCDialOptions(jctx *JCtx, vendor *vendor) ([]grpc.DialOption, error) {
 		jLog(jctx, "compression = none")
 	}
 
-	ws := jctx.config.GRPC.WS
-	opts = append(opts, grpc.WithInitialWindowSize(ws))
+	opts = append(opts, windowSizeOptions(jctx)...)
+	if opt := perRPCCredentials(jctx); opt != nil {
+		opts = append(opts, opt)
+	}
+	if opt := bearerCredentials(jctx); opt != nil {
+		opts = append(opts, opt)
+	}
+	if opt := jctx.transport.dialOption(); opt != nil {
+		opts = append(opts, opt)
+	}
 
 	if vendor.dialExt != nil {
 		opt := vendor.dialExt(jctx)
@@ -71,3 +106,53 @@ func getGPRCDialOptions(jctx *JCtx, vendor *vendor) ([]grpc.DialOption, error) {
 	}
 	return opts, nil
 }
+
+// windowSizeOptions returns the flow control window of the connection. In
+// auto mode the window is left to gRPC which sizes it per connection to the
+// bandwidth-delay product it measures (throughput and ping RTT), instead of
+// one static size for near and far devices alike.
+func windowSizeOptions(jctx *JCtx) []grpc.DialOption {
+	if jctx.config.GRPC.WSAuto {
+		jLog(jctx, "window size = auto")
+		return nil
+	}
+	ws := jctx.config.GRPC.WS
+	jLog(jctx, fmt.Sprintf("window size = %d", ws))
+	return []grpc.DialOption{grpc.WithInitialWindowSize(ws)}
+}
+
+// deviceDialTimeout is how long the commands which connect to a device on
+// their own wait for the connection
+const deviceDialTimeout = 10 * time.Second
+
+// loadDevice reads the config file of a device for the commands which
+// connect to it on their own, without starting a worker. Its data can be
+// decoded, it has no outputs.
+func loadDevice(file string) (*JCtx, error) {
+	config, err := NewJTIMONConfig(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	jctx := &JCtx{file: file, config: config}
+	jctx.influxCtx.reXpath = regexp.MustCompile(MatchExpressionXpath)
+	jctx.influxCtx.reKey = regexp.MustCompile(MatchExpressionKey)
+	if jctx.config.Password, err = DecodePassword(jctx, config); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return jctx, nil
+}
+
+// dialDevice connects to the device of the worker and waits for the
+// connection, up to deviceDialTimeout
+func dialDevice(jctx *JCtx, vendor *vendor) (*grpc.ClientConn, error) {
+	opts, err := getGPRCDialOptions(jctx, vendor)
+	if err != nil {
+		return nil, err
+	}
+	hostname := deviceAddress(jctx) + ":" + strconv.Itoa(jctx.config.Port)
+	conn, err := grpc.Dial(hostname, append(opts, grpc.WithBlock(), grpc.WithTimeout(deviceDialTimeout))...)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %s: %v", hostname, err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+func TestWindowSizeOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		grpc GRPCConfig
+		want int
+	}{
+		{"static", GRPCConfig{WS: DefaultGRPCWindowSize}, 1},
+		{"auto", GRPCConfig{WS: DefaultGRPCWindowSize, WSAuto: true}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jctx := &JCtx{config: Config{GRPC: test.grpc}}
+			if got := len(windowSizeOptions(jctx)); got != test.want {
+				t.Errorf("got %d dial options, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSecurityOptionsSkipVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	testCert(t, dir, "device", nil, nil)
+	testCert(t, dir, "other-ca", nil, nil)
+	file := func(name string) string { return filepath.Join(dir, name) }
+	creds, err := credentials.NewServerTLSFromFile(file("device.crt"), file("device.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer(grpc.Creds(creds))
+	go s.Serve(lis)
+	defer s.Stop()
+
+	tests := []struct {
+		name string
+		tls  TLSConfig
+		ok   bool
+	}{
+		{name: "skip verify", tls: TLSConfig{SkipVerify: true}, ok: true},
+		{name: "unknown ca", tls: TLSConfig{CA: file("other-ca.crt")}, ok: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jctx := &JCtx{config: Config{Host: "r1", TLS: test.tls}}
+			opt, err := getSecurityOptions(jctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			conn, err := grpc.DialContext(ctx, lis.Addr().String(), opt, grpc.WithBlock())
+			if (err == nil) != test.ok {
+				t.Errorf("got %v", err)
+			}
+			if conn != nil {
+				conn.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,548 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	haLock = flag.String("ha", "", "Lock of the active-standby pair, only the instance holding it subscribes: consul://host:port/key, etcd://host:port/key or k8s://namespace/lease")
+	haID   = flag.String("ha-id", "", "Identity of this instance in the lock of --ha (default the hostname and pid)")
+	haTTL  = flag.Int("ha-ttl", 10, "Seconds the lock of --ha is held without being renewed, the standby takes over after them")
+)
+
+// haElector takes and renews the lock of the active-standby pair
+type haElector interface {
+	// campaign takes the lock, or renews it if this instance holds it, and
+	// tells whether it holds it
+	campaign() (bool, error)
+	// resign releases the lock if this instance holds it
+	resign() error
+}
+
+// haState is the role of the instance in the active-standby pair, the
+// workers of the standby do not connect to their devices
+type haState struct {
+	sync.Mutex
+	id string
+	// elected is closed when the instance becomes the leader, nil while it
+	// is the leader or runs alone
+	elected chan struct{}
+	// stop is closed to release the lock, done once it is released
+	stop    chan struct{}
+	done    chan struct{}
+	stopped bool
+}
+
+var ha haState
+
+// standby returns the channel closed when the instance is elected, nil if
+// it collects
+func (h *haState) standby() chan struct{} {
+	h.Lock()
+	defer h.Unlock()
+	return h.elected
+}
+
+// setLeader makes the instance the leader or the standby, it returns false
+// if it already was
+func (h *haState) setLeader(leader bool) bool {
+	h.Lock()
+	defer h.Unlock()
+	if leader == (h.elected == nil) {
+		return false
+	}
+	if leader {
+		close(h.elected)
+		h.elected = nil
+	} else {
+		h.elected = make(chan struct{})
+	}
+	return true
+}
+
+// haSetLeader changes the role of the instance, the workers of a former
+// leader stop streaming and wait to be elected again
+func haSetLeader(leader bool, why string) {
+	if !ha.setLeader(leader) {
+		return
+	}
+	if leader {
+		globalLog(LogLevelInfo, "HA: elected leader, collecting")
+		return
+	}
+	globalLog(LogLevelWarn, "HA: standby, not collecting: "+why)
+	for _, jctx := range deviceWorkers("") {
+		resubscribe(jctx)
+	}
+}
+
+// haInit makes the instance a standby until it takes the lock of --ha, it
+// does nothing without --ha
+func haInit() error {
+	if *haLock == "" {
+		return nil
+	}
+	if *haTTL <= 0 {
+		return fmt.Errorf("--ha-ttl must be positive")
+	}
+	ttl := time.Duration(*haTTL) * time.Second
+	id := instanceID(*haID)
+	e, err := newHAElector(*haLock, id, ttl)
+	if err != nil {
+		return err
+	}
+	ha.setLeader(false)
+	ha.id = id
+	ha.stop, ha.done = make(chan struct{}), make(chan struct{})
+	go haRun(e, ttl)
+	return nil
+}
+
+// instanceID is id, or the hostname and pid if it is not set
+func instanceID(id string) string {
+	if id != "" {
+		return id
+	}
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// haRun campaigns for the lock every third of the ttl. The leader steps down
+// when it could not renew the lock for half of the ttl, before the standby
+// can take it. The leader replicates the state of its subscriptions each
+// time, which the instance taking over restores before it subscribes.
+func haRun(e haElector, ttl time.Duration) {
+	renewed := time.Now()
+	failed, replFailed := "", ""
+	for {
+		leader, err := e.campaign()
+		switch {
+		case err != nil:
+			if err.Error() != failed {
+				globalLog(LogLevelError, fmt.Sprintf("HA: %v", err))
+				failed = err.Error()
+			}
+			if ha.standby() == nil && time.Since(renewed) > ttl/2 {
+				haSetLeader(false, "the lock could not be renewed")
+			}
+		default:
+			failed = ""
+			if leader {
+				renewed = time.Now()
+				if ha.standby() != nil {
+					if n, err := haRestore(e); err != nil {
+						globalLog(LogLevelWarn, fmt.Sprintf("HA: could not restore the state of the previous leader: %v", err))
+					} else if n != 0 {
+						globalLog(LogLevelInfo, fmt.Sprintf("HA: restored the state of the previous leader for %d devices", n))
+					}
+				}
+			}
+			haSetLeader(leader, "the lock is held by the other instance")
+			if !leader {
+				break
+			}
+			if err := haReplicate(e, ha.id); err != nil {
+				if err.Error() != replFailed {
+					globalLog(LogLevelWarn, fmt.Sprintf("HA: could not replicate the state: %v", err))
+					replFailed = err.Error()
+				}
+			} else {
+				replFailed = ""
+			}
+		}
+
+		t := time.NewTimer(ttl / 3)
+		select {
+		case <-ha.stop:
+			t.Stop()
+			if err := e.resign(); err != nil {
+				globalLog(LogLevelError, fmt.Sprintf("HA: could not release the lock: %v", err))
+			}
+			close(ha.done)
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// haStop releases the lock so that the standby takes over while this
+// instance drains, it returns once it is released
+func haStop() {
+	ha.Lock()
+	stop, done := ha.stop, ha.done
+	if stop != nil && !ha.stopped {
+		close(stop)
+		ha.stopped = true
+	}
+	ha.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// newHAElector returns the elector of the lock of --ha, the scheme of the
+// URL is the store of the lock, +https for TLS
+func newHAElector(lock, id string, ttl time.Duration) (haElector, error) {
+	return newStoreLock("--ha", lock, id, ttl)
+}
+
+// newStoreLock returns the lock of the URL of the flag name
+func newStoreLock(name, lock, id string, ttl time.Duration) (haElector, error) {
+	u, err := url.Parse(lock)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %v", name, lock, err)
+	}
+	scheme := "http"
+	store := u.Scheme
+	if strings.HasSuffix(store, "+https") {
+		scheme, store = "https", strings.TrimSuffix(store, "+https")
+	}
+	host := func(port string) string {
+		if u.Port() == "" {
+			return net.JoinHostPort(u.Hostname(), port)
+		}
+		return u.Host
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return nil, fmt.Errorf("invalid %s %q: no host or key", name, lock)
+	}
+	client := &http.Client{Timeout: ttl / 3}
+	switch store {
+	case "consul":
+		c := newConsulClient(scheme+"://"+host("8500"), ttl/3)
+		return &consulLock{consul: c, key: key, id: id, ttl: ttl}, nil
+	case "etcd":
+		return &etcdLock{client: client, base: scheme + "://" + host("2379"), key: "/" + key, id: id, ttl: ttl}, nil
+	case "k8s", "kubernetes":
+		return newK8sLease(u.Host, key, id, ttl)
+	}
+	return nil, fmt.Errorf("invalid %s %q: unknown store %s", name, lock, u.Scheme)
+}
+
+// consulLock is a lock on a key of the KV store of Consul, held by a session
+// which Consul deletes, releasing the lock, when it is not renewed within
+// the ttl (10s at least)
+type consulLock struct {
+	consul  *consulClient
+	key     string
+	id      string
+	ttl     time.Duration
+	session string
+}
+
+func (c *consulLock) campaign() (bool, error) {
+	if c.session != "" {
+		code, err := c.consul.do("PUT", "/v1/session/renew/"+c.session, nil, nil)
+		if code == http.StatusNotFound {
+			// the session expired, the lock is lost
+			c.session = ""
+		} else if err != nil {
+			return false, err
+		}
+	}
+	if c.session == "" {
+		var s struct {
+			ID string
+		}
+		ttl := c.ttl
+		if ttl < 10*time.Second {
+			ttl = 10 * time.Second
+		}
+		req := map[string]string{"Name": "jtimon " + c.id, "TTL": ttl.String(), "Behavior": "delete", "LockDelay": "0s"}
+		if _, err := c.consul.do("PUT", "/v1/session/create", req, &s); err != nil {
+			return false, err
+		}
+		c.session = s.ID
+	}
+	var held bool
+	_, err := c.consul.do("PUT", "/v1/kv/"+c.key+"?acquire="+c.session, map[string]string{"id": c.id}, &held)
+	return held, err
+}
+
+func (c *consulLock) resign() error {
+	if c.session == "" {
+		return nil
+	}
+	_, err := c.consul.do("PUT", "/v1/session/destroy/"+c.session, nil, nil)
+	c.session = ""
+	return err
+}
+
+// etcdLock is a key of etcd created with a lease, which etcd revokes,
+// deleting the key, when it is not kept alive within the ttl. It uses the
+// JSON gateway of etcd v3.
+type etcdLock struct {
+	client *http.Client
+	base   string
+	key    string
+	id     string
+	ttl    time.Duration
+	lease  string
+}
+
+// post calls the gateway, the int64 of its JSON are strings
+func (e *etcdLock) post(path string, in, out interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Post(e.base+path, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("etcd %s: %s: %s", path, resp.Status, strings.TrimSpace(string(b)))
+	}
+	// keepalive is a stream, its first answer is the one of the request
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (e *etcdLock) campaign() (bool, error) {
+	if e.lease != "" {
+		var r struct {
+			Result struct {
+				TTL string
+			} `json:"result"`
+		}
+		if err := e.post("/v3/lease/keepalive", map[string]string{"ID": e.lease}, &r); err != nil {
+			return false, err
+		}
+		if r.Result.TTL == "" || r.Result.TTL == "0" {
+			// the lease expired, the key is deleted
+			e.lease = ""
+		}
+	}
+	if e.lease == "" {
+		var r struct {
+			ID string
+		}
+		if err := e.post("/v3/lease/grant", map[string]string{"TTL": strconv.Itoa(int(e.ttl / time.Second))}, &r); err != nil {
+			return false, err
+		}
+		e.lease = r.ID
+	}
+
+	key := base64.StdEncoding.EncodeToString([]byte(e.key))
+	txn := map[string]interface{}{
+		// the key is put if it does not exist, read otherwise
+		"compare": []map[string]string{{"key": key, "target": "CREATE", "result": "EQUAL", "create_revision": "0"}},
+		"success": []map[string]interface{}{{"request_put": map[string]string{
+			"key": key, "value": base64.StdEncoding.EncodeToString([]byte(e.id)), "lease": e.lease}}},
+		"failure": []map[string]interface{}{{"request_range": map[string]string{"key": key}}},
+	}
+	var r struct {
+		Succeeded bool `json:"succeeded"`
+		Responses []struct {
+			Range struct {
+				Kvs []struct {
+					Lease string `json:"lease"`
+				} `json:"kvs"`
+			} `json:"response_range"`
+		} `json:"responses"`
+	}
+	if err := e.post("/v3/kv/txn", txn, &r); err != nil {
+		return false, err
+	}
+	if r.Succeeded {
+		return true, nil
+	}
+	for _, resp := range r.Responses {
+		for _, kv := range resp.Range.Kvs {
+			if kv.Lease == e.lease {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (e *etcdLock) resign() error {
+	if e.lease == "" {
+		return nil
+	}
+	var r struct{}
+	err := e.post("/v3/lease/revoke", map[string]string{"ID": e.lease}, &r)
+	e.lease = ""
+	return err
+}
+
+// k8sLease is a Lease of coordination.k8s.io in the namespace of the
+// cluster jtimon runs in. The lease is taken over when its holder did not
+// renew it for its duration, as seen by this instance, so that the clocks
+// of the instances do not matter.
+type k8sLease struct {
+	client    *http.Client
+	base      string
+	token     string
+	namespace string
+	name      string
+	id        string
+	ttl       time.Duration
+	// observed is the resource version of the lease last seen, at
+	// observedAt
+	observed   string
+	observedAt time.Time
+}
+
+// the service account of the pods
+var k8sServiceAccount = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+func newK8sLease(namespace, name, id string, ttl time.Duration) (*k8sLease, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("--ha k8s:// needs to run in a pod of the cluster")
+	}
+	token, err := ioutil.ReadFile(k8sServiceAccount + "/token")
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(k8sServiceAccount + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("failed to append the ca certs of the service account")
+	}
+	return &k8sLease{
+		client: &http.Client{
+			Timeout:   ttl / 3,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+		base:      "https://" + net.JoinHostPort(host, port),
+		token:     strings.TrimSpace(string(token)),
+		namespace: namespace,
+		name:      name,
+		id:        id,
+		ttl:       ttl,
+	}, nil
+}
+
+// k8sMicroTime is the format of the times of leases
+const k8sMicroTime = "2006-01-02T15:04:05.000000Z07:00"
+
+type lease struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name            string            `json:"name"`
+		Namespace       string            `json:"namespace"`
+		ResourceVersion string            `json:"resourceVersion,omitempty"`
+		Annotations     map[string]string `json:"annotations,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		HolderIdentity       string `json:"holderIdentity"`
+		LeaseDurationSeconds int    `json:"leaseDurationSeconds"`
+		AcquireTime          string `json:"acquireTime,omitempty"`
+		RenewTime            string `json:"renewTime,omitempty"`
+		LeaseTransitions     int    `json:"leaseTransitions"`
+	} `json:"spec"`
+}
+
+// do calls the API server, it returns the status code of the answer and
+// decodes the lease it returns
+func (k *k8sLease) do(method, path string, in, out *lease) (int, error) {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, k.base+path, body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+k.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+	case http.StatusNotFound, http.StatusConflict:
+		return resp.StatusCode, nil
+	}
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	return resp.StatusCode, fmt.Errorf("kubernetes %s lease %s/%s: %s: %s", method, k.namespace, k.name, resp.Status, strings.TrimSpace(string(b)))
+}
+
+func (k *k8sLease) campaign() (bool, error) {
+	leases := "/apis/coordination.k8s.io/v1/namespaces/" + k.namespace + "/leases"
+	var l lease
+	code, err := k.do("GET", leases+"/"+k.name, nil, &l)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	if code == http.StatusNotFound {
+		l.APIVersion, l.Kind = "coordination.k8s.io/v1", "Lease"
+		l.Metadata.Name, l.Metadata.Namespace = k.name, k.namespace
+		k.hold(&l, now)
+		code, err = k.do("POST", leases, &l, &l)
+		return code == http.StatusCreated, err
+	}
+
+	if l.Metadata.ResourceVersion != k.observed {
+		k.observed, k.observedAt = l.Metadata.ResourceVersion, now
+	}
+	expired := now.Sub(k.observedAt) > time.Duration(l.Spec.LeaseDurationSeconds)*time.Second
+	switch {
+	case l.Spec.HolderIdentity == k.id:
+		l.Spec.RenewTime = now.UTC().Format(k8sMicroTime)
+	case l.Spec.HolderIdentity == "" || expired:
+		l.Spec.LeaseTransitions++
+		k.hold(&l, now)
+	default:
+		return false, nil
+	}
+	// the update fails with a conflict if the lease was changed meanwhile
+	code, err = k.do("PUT", leases+"/"+k.name, &l, &l)
+	if code == http.StatusOK {
+		k.observed, k.observedAt = l.Metadata.ResourceVersion, now
+	}
+	return code == http.StatusOK, err
+}
+
+// hold makes this instance the holder of the lease
+func (k *k8sLease) hold(l *lease, now time.Time) {
+	l.Spec.HolderIdentity = k.id
+	l.Spec.LeaseDurationSeconds = int(k.ttl / time.Second)
+	l.Spec.AcquireTime = now.UTC().Format(k8sMicroTime)
+	l.Spec.RenewTime = l.Spec.AcquireTime
+}
+
+func (k *k8sLease) resign() error {
+	path := "/apis/coordination.k8s.io/v1/namespaces/" + k.namespace + "/leases/" + k.name
+	var l lease
+	if _, err := k.do("GET", path, nil, &l); err != nil || l.Spec.HolderIdentity != k.id {
+		return err
+	}
+	l.Spec.HolderIdentity = ""
+	_, err := k.do("PUT", path, &l, &l)
+	return err
+}
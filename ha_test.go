@@ -0,0 +1,424 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// resetHA restores the instance running alone
+func resetHA() {
+	ha.Lock()
+	ha.elected, ha.stop, ha.done, ha.stopped = nil, nil, nil, false
+	ha.Unlock()
+}
+
+func TestHAWaitResumed(t *testing.T) {
+	defer resetHA()
+	jctx := &JCtx{config: Config{Host: "r1", Paths: []PathsConfig{{Path: "/interfaces"}}}, control: make(chan os.Signal)}
+	haSetLeader(false, "test")
+	done := make(chan bool)
+	go func() { done <- waitResumed(jctx) }()
+	select {
+	case <-done:
+		t.Fatalf("waitResumed() returned on the standby")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if r := checkReadiness([]*JCtx{jctx}, 1, false); !r.Ready || !r.Standby {
+		t.Errorf("readiness of the standby %+v", r)
+	}
+	haSetLeader(true, "")
+	if !<-done {
+		t.Errorf("waitResumed() = false once elected")
+	}
+	if r := checkReadiness([]*JCtx{jctx}, 1, false); r.Ready || r.Standby {
+		t.Errorf("readiness of the leader not attempted yet %+v", r)
+	}
+}
+
+// fakeElector is the leader until it fails
+type fakeElector struct {
+	sync.Mutex
+	fail     bool
+	resigned bool
+}
+
+func (f *fakeElector) campaign() (bool, error) {
+	f.Lock()
+	defer f.Unlock()
+	if f.fail {
+		return false, fmt.Errorf("unreachable")
+	}
+	return true, nil
+}
+
+func (f *fakeElector) resign() error {
+	f.Lock()
+	f.resigned = true
+	f.Unlock()
+	return nil
+}
+
+func TestHARun(t *testing.T) {
+	defer resetHA()
+	ha.setLeader(false)
+	ha.stop, ha.done = make(chan struct{}), make(chan struct{})
+	e := &fakeElector{}
+	go haRun(e, 60*time.Millisecond)
+
+	wait := func(leader bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for (ha.standby() == nil) != leader {
+			if time.Now().After(deadline) {
+				t.Fatalf("not the leader %v", leader)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	wait(true)
+	// the leader steps down once it could not renew the lock for half of
+	// the ttl
+	e.Lock()
+	e.fail = true
+	e.Unlock()
+	wait(false)
+
+	haStop()
+	if !e.resigned {
+		t.Errorf("the lock was not released")
+	}
+}
+
+// fakeConsul serves the sessions and the locks of the KV store of Consul,
+// lists the held keys of a prefix and stores the values of the .state keys,
+// expire expires all the sessions
+func fakeConsul(t *testing.T) (s *httptest.Server, expire func()) {
+	var mu sync.Mutex
+	sessions, holders, values, n := map[string]bool{}, map[string]string{}, map[string][]byte{}, 0
+	release := func(session string) {
+		delete(sessions, session)
+		for k, v := range holders {
+			if v == session {
+				delete(holders, k)
+			}
+		}
+	}
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch p := r.URL.Path; {
+		case strings.HasSuffix(p, ".state") && r.Method == "PUT":
+			values[p], _ = ioutil.ReadAll(r.Body)
+			w.Write([]byte("true"))
+		case strings.HasSuffix(p, ".state"):
+			if values[p] == nil {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode([]map[string][]byte{{"Value": values[p]}})
+		case p == "/v1/session/create":
+			var req map[string]string
+			json.NewDecoder(r.Body).Decode(&req)
+			if req["TTL"] != "10s" || req["Behavior"] != "delete" {
+				t.Errorf("session %v", req)
+			}
+			n++
+			id := "s" + strconv.Itoa(n)
+			sessions[id] = true
+			fmt.Fprintf(w, `{"ID": %q}`, id)
+		case strings.HasPrefix(p, "/v1/session/renew/"):
+			if !sessions[strings.TrimPrefix(p, "/v1/session/renew/")] {
+				http.Error(w, "session not found", http.StatusNotFound)
+				return
+			}
+			w.Write([]byte("[]"))
+		case strings.HasPrefix(p, "/v1/session/destroy/"):
+			release(strings.TrimPrefix(p, "/v1/session/destroy/"))
+			w.Write([]byte("true"))
+		case strings.HasPrefix(p, "/v1/kv/") && r.Method == "GET":
+			prefix := strings.TrimPrefix(p, "/v1/kv/")
+			var kvs []map[string]interface{}
+			for k, v := range holders {
+				if strings.HasPrefix(k, prefix) {
+					kvs = append(kvs, map[string]interface{}{"Key": k, "Session": v, "Value": values[k]})
+				}
+			}
+			if kvs == nil {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(kvs)
+		case strings.HasPrefix(p, "/v1/kv/"):
+			key, session := strings.TrimPrefix(p, "/v1/kv/"), r.URL.Query().Get("acquire")
+			if !sessions[session] {
+				http.Error(w, "invalid session", http.StatusInternalServerError)
+				return
+			}
+			if holders[key] == "" {
+				holders[key] = session
+			}
+			if holders[key] == session {
+				values[key], _ = ioutil.ReadAll(r.Body)
+			}
+			fmt.Fprint(w, holders[key] == session)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return s, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for id := range sessions {
+			release(id)
+		}
+	}
+}
+
+// testElection checks that a and b, two instances of the lock, take it in
+// turn
+func testElection(t *testing.T, a, b haElector) {
+	campaign := func(e haElector, name string, want bool) {
+		t.Helper()
+		if leader, err := e.campaign(); err != nil || leader != want {
+			t.Fatalf("%s.campaign() = %v, %v, want %v", name, leader, err, want)
+		}
+	}
+	campaign(a, "a", true)
+	campaign(b, "b", false)
+	campaign(a, "a", true)
+	if err := a.resign(); err != nil {
+		t.Fatal(err)
+	}
+	campaign(b, "b", true)
+	campaign(a, "a", false)
+	campaign(b, "b", true)
+}
+
+func TestConsulLock(t *testing.T) {
+	s, expire := fakeConsul(t)
+	defer s.Close()
+	a, err := newHAElector("consul://"+strings.TrimPrefix(s.URL, "http://")+"/service/jtimon/leader", "a", 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := newHAElector("consul://"+strings.TrimPrefix(s.URL, "http://")+"/service/jtimon/leader", "b", 3*time.Second)
+	testElection(t, a, b)
+
+	// the session of b expired, the lock was released with it
+	expire()
+	if leader, err := b.campaign(); err != nil || !leader {
+		t.Errorf("campaign() after the session expired = %v, %v", leader, err)
+	}
+}
+
+// fakeEtcd serves the leases, the transactions of the locks, the ranges of
+// keys and the values put of the JSON gateway of etcd, expire expires all
+// the leases
+func fakeEtcd(t *testing.T) (s *httptest.Server, expire func()) {
+	var mu sync.Mutex
+	leases, keys, values, n := map[string]bool{}, map[string]string{}, map[string]string{}, 0
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		for k, lease := range keys {
+			if !leases[lease] {
+				delete(keys, k)
+			}
+		}
+		switch r.URL.Path {
+		case "/v3/lease/grant":
+			n++
+			id := strconv.Itoa(n)
+			leases[id] = true
+			fmt.Fprintf(w, `{"ID": %q, "TTL": %q}`, id, req["TTL"])
+		case "/v3/lease/keepalive":
+			if !leases[req["ID"].(string)] {
+				fmt.Fprintf(w, `{"result": {"ID": %q}}`, req["ID"])
+				return
+			}
+			fmt.Fprintf(w, `{"result": {"ID": %q, "TTL": "3"}}`, req["ID"])
+		case "/v3/lease/revoke":
+			delete(leases, req["ID"].(string))
+			w.Write([]byte("{}"))
+		case "/v3/kv/txn":
+			compare := req["compare"].([]interface{})[0].(map[string]interface{})
+			key, _ := base64.StdEncoding.DecodeString(compare["key"].(string))
+			if !strings.HasPrefix(string(key), "/jtimon/") {
+				t.Errorf("key %s", key)
+			}
+			if lease, ok := keys[string(key)]; ok {
+				fmt.Fprintf(w, `{"succeeded": false, "responses": [{"response_range": {"kvs": [{"lease": %q}]}}]}`, lease)
+				return
+			}
+			put := req["success"].([]interface{})[0].(map[string]interface{})["request_put"].(map[string]interface{})
+			keys[string(key)] = put["lease"].(string)
+			w.Write([]byte(`{"succeeded": true}`))
+		case "/v3/kv/put":
+			values[req["key"].(string)] = req["value"].(string)
+			if lease, ok := req["lease"].(string); ok {
+				key, _ := base64.StdEncoding.DecodeString(req["key"].(string))
+				keys[string(key)] = lease
+			}
+			w.Write([]byte("{}"))
+		case "/v3/kv/range":
+			if _, ok := req["range_end"]; !ok {
+				kvs := []map[string]string{}
+				if v, ok := values[req["key"].(string)]; ok {
+					kvs = append(kvs, map[string]string{"key": req["key"].(string), "value": v})
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"kvs": kvs})
+				return
+			}
+			start, _ := base64.StdEncoding.DecodeString(req["key"].(string))
+			end, _ := base64.StdEncoding.DecodeString(req["range_end"].(string))
+			kvs := []map[string]string{}
+			for k := range keys {
+				if k >= string(start) && k < string(end) {
+					key := base64.StdEncoding.EncodeToString([]byte(k))
+					kvs = append(kvs, map[string]string{"key": key, "value": values[key]})
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"kvs": kvs})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return s, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for id := range leases {
+			delete(leases, id)
+		}
+	}
+}
+
+func TestEtcdLock(t *testing.T) {
+	s, expire := fakeEtcd(t)
+	defer s.Close()
+	a, err := newHAElector("etcd://"+strings.TrimPrefix(s.URL, "http://")+"/jtimon/leader", "a", 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := newHAElector("etcd://"+strings.TrimPrefix(s.URL, "http://")+"/jtimon/leader", "b", 3*time.Second)
+	testElection(t, a, b)
+
+	// the lease of b expired, its key was deleted with it
+	expire()
+	if leader, err := b.campaign(); err != nil || !leader {
+		t.Errorf("campaign() after the lease expired = %v, %v", leader, err)
+	}
+}
+
+// fakeK8s serves a lease of the API server of Kubernetes, the updates of an
+// older resource version conflict
+func fakeK8s(t *testing.T) *httptest.Server {
+	var mu sync.Mutex
+	var current *lease
+	version := 0
+	const path = "/apis/coordination.k8s.io/v1/namespaces/monitoring/leases"
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var l lease
+		json.NewDecoder(r.Body).Decode(&l)
+		switch {
+		case r.Method == "GET" && r.URL.Path == path+"/jtimon":
+			if current == nil {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(current)
+		case r.Method == "POST" && r.URL.Path == path:
+			if current != nil {
+				http.Error(w, "exists", http.StatusConflict)
+				return
+			}
+			if l.Kind != "Lease" || l.Metadata.Name != "jtimon" {
+				t.Errorf("created %+v", l)
+			}
+			version++
+			l.Metadata.ResourceVersion = strconv.Itoa(version)
+			current = &l
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(current)
+		case r.Method == "PUT" && r.URL.Path == path+"/jtimon":
+			if current == nil || l.Metadata.ResourceVersion != current.Metadata.ResourceVersion {
+				http.Error(w, "conflict", http.StatusConflict)
+				return
+			}
+			version++
+			l.Metadata.ResourceVersion = strconv.Itoa(version)
+			current = &l
+			json.NewEncoder(w).Encode(current)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestK8sLease(t *testing.T) {
+	s := fakeK8s(t)
+	defer s.Close()
+	lease := func(id string) *k8sLease {
+		return &k8sLease{client: s.Client(), base: s.URL, token: "token", namespace: "monitoring", name: "jtimon", id: id, ttl: 3 * time.Second}
+	}
+	a, b := lease("a"), lease("b")
+	testElection(t, a, b)
+
+	// a has not seen the lease renewed for its duration
+	a.observedAt = a.observedAt.Add(-time.Minute)
+	if leader, err := a.campaign(); err != nil || leader {
+		t.Errorf("campaign() of a renewed lease = %v, %v", leader, err)
+	}
+	a.observedAt = time.Now().Add(-time.Minute)
+	b.observedAt = time.Now()
+	if leader, err := a.campaign(); err != nil || !leader {
+		t.Errorf("campaign() of an expired lease = %v, %v", leader, err)
+	}
+	if leader, err := b.campaign(); err != nil || leader {
+		t.Errorf("campaign() of a lease taken over = %v, %v", leader, err)
+	}
+}
+
+func TestNewHAElector(t *testing.T) {
+	tests := []struct {
+		lock string
+		err  string
+	}{
+		{"consul://127.0.0.1/jtimon", ""},
+		{"etcd+https://etcd:2379/jtimon", ""},
+		{"consul://127.0.0.1", `invalid --ha "consul://127.0.0.1": no host or key`},
+		{"zk://zk/jtimon", `invalid --ha "zk://zk/jtimon": unknown store zk`},
+		{"k8s://monitoring/jtimon", "--ha k8s:// needs to run in a pod of the cluster"},
+	}
+	defer setenv("KUBERNETES_SERVICE_HOST", "")()
+	for _, test := range tests {
+		_, err := newHAElector(test.lock, "a", 10*time.Second)
+		if (err == nil) != (test.err == "") || err != nil && err.Error() != test.err {
+			t.Errorf("newHAElector(%q) = %v, want %q", test.lock, err, test.err)
+		}
+	}
+	e, _ := newHAElector("consul://127.0.0.1/jtimon", "a", 10*time.Second)
+	if c := e.(*consulLock); c.consul.base != "http://127.0.0.1:8500" || c.key != "jtimon" {
+		t.Errorf("consul lock %+v", c)
+	}
+	e, _ = newHAElector("etcd+https://etcd/jtimon", "a", 10*time.Second)
+	if l := e.(*etcdLock); l.base != "https://etcd:2379" || l.key != "/jtimon" {
+		t.Errorf("etcd lock %+v", l)
+	}
+}
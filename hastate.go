@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	na_pb "github.com/nileshsimaria/jtimon/telemetry"
+)
+
+// haReplicator stores the state of the subscriptions of the leader next to
+// the lock of --ha, for the instance taking over
+type haReplicator interface {
+	putState(b []byte) error
+	// getState returns nil if no state was stored
+	getState() ([]byte, error)
+}
+
+// haSnapshot is the state replicated by the leader
+type haSnapshot struct {
+	Leader  string                   `json:"leader"`
+	Time    time.Time                `json:"time"`
+	Devices map[string]haDeviceState `json:"devices"`
+}
+
+// haDeviceState is the state of the subscriptions of a device: the device
+// timestamp in milliseconds of the last update of each path and the last
+// sequence number of each sequence
+type haDeviceState struct {
+	Paths     map[string]uint64 `json:"paths"`
+	Sequences map[string]uint64 `json:"sequences,omitempty"`
+}
+
+// handoffState is the state of the subscriptions of a worker replicated by
+// the leader. After a takeover, prev is the state of the previous leader
+// until the first update of each path and sequence.
+type handoffState struct {
+	sync.Mutex
+	last     map[string]uint64
+	seqs     map[string]uint64
+	prevLast map[string]uint64
+	prevSeqs map[string]uint64
+}
+
+// snapshot returns the state, the one of the previous leader for the paths
+// and sequences without update since the takeover
+func (h *handoffState) snapshot() haDeviceState {
+	h.Lock()
+	defer h.Unlock()
+	s := haDeviceState{Paths: map[string]uint64{}, Sequences: map[string]uint64{}}
+	for _, m := range []struct{ from, to map[string]uint64 }{
+		{h.prevLast, s.Paths}, {h.last, s.Paths}, {h.prevSeqs, s.Sequences}, {h.seqs, s.Sequences},
+	} {
+		for k, v := range m.from {
+			m.to[k] = v
+		}
+	}
+	return s
+}
+
+// restore takes the state of the previous leader, the one of an earlier
+// leadership of this instance is older
+func (h *handoffState) restore(s haDeviceState) {
+	h.Lock()
+	defer h.Unlock()
+	h.prevLast, h.prevSeqs = s.Paths, s.Sequences
+	h.last, h.seqs = nil, nil
+}
+
+// handoffGap is the gap of a path in the updates of a takeover
+type handoffGap struct {
+	since uint64
+	until uint64
+	lost  uint64
+}
+
+// update records the update of the path with the timestamp ts and the
+// sequence number seq of the sequence. It tells whether the previous leader
+// already had the update and returns the gap before it, if it is the first
+// update of the path since the takeover.
+func (h *handoffState) update(path, sequence string, ts, seq uint64) (bool, *handoffGap) {
+	h.Lock()
+	defer h.Unlock()
+	var gap *handoffGap
+	if prev, ok := h.prevLast[path]; ok && ts != 0 {
+		if ts <= prev {
+			return true, nil
+		}
+		delete(h.prevLast, path)
+		gap = &handoffGap{since: prev, until: ts}
+	}
+	if prev, ok := h.prevSeqs[sequence]; ok {
+		delete(h.prevSeqs, sequence)
+		// a new subscription may start the sequence over
+		if seq > prev+1 {
+			if gap == nil {
+				gap = &handoffGap{}
+			}
+			gap.lost = seq - prev - 1
+		}
+	}
+	if h.last == nil {
+		h.last, h.seqs = map[string]uint64{}, map[string]uint64{}
+	}
+	if ts != 0 {
+		h.last[path] = ts
+	}
+	h.seqs[sequence] = seq
+	return false, gap
+}
+
+// pathFreq returns the sample frequency of the subscription path in
+// milliseconds, 0 if it is not one of the worker
+func pathFreq(jctx *JCtx, path string) uint64 {
+	for _, p := range jctx.config.Paths {
+		if p.Path == path {
+			return p.Freq
+		}
+	}
+	return 0
+}
+
+// handoffUpdate records the update of the subscription path for the
+// standby of --ha and tells whether the previous leader already wrote it.
+// The first update of a path after a takeover marks the gap since the last
+// update the previous leader replicated, if one sample or more is missing.
+func handoffUpdate(jctx *JCtx, path string, ocData *na_pb.OpenConfigData) bool {
+	if path == "" {
+		path = sensorPath(ocData.Path)
+	}
+	sequence := fmt.Sprintf("%s %s %d/%d", ocData.Path, ocData.SystemId, ocData.ComponentId, ocData.SubComponentId)
+	dup, gap := jctx.handoff.update(path, sequence, ocData.Timestamp, ocData.SequenceNumber)
+	if gap == nil {
+		return dup
+	}
+	freq := pathFreq(jctx, path)
+	missing := gap.since != 0 && freq != 0 && gap.until-gap.since >= 2*freq
+	if !missing && gap.lost == 0 {
+		return dup
+	}
+	var msg string
+	if missing {
+		d := time.Duration(gap.until-gap.since) * time.Millisecond
+		msg = fmt.Sprintf("Takeover gap of %v on %s since the last update of the previous leader at %s", d, path,
+			time.Unix(0, int64(gap.since)*int64(time.Millisecond)).UTC().Format(time.RFC3339Nano))
+	} else {
+		msg = fmt.Sprintf("Takeover gap on %s", path)
+	}
+	if gap.lost != 0 {
+		msg += fmt.Sprintf(", %d packets lost from %s component %d/%d", gap.lost, ocData.Path, ocData.ComponentId, ocData.SubComponentId)
+	}
+	jLogWarn(jctx, msg)
+	recordEvent(jctx, EventTakeoverGap, "", msg)
+	return dup
+}
+
+// haSnapshotOf returns the state of the workers
+func haSnapshotOf(id string, workers []*JCtx, now time.Time) haSnapshot {
+	s := haSnapshot{Leader: id, Time: now.UTC(), Devices: map[string]haDeviceState{}}
+	for _, jctx := range workers {
+		s.Devices[clusterKey(jctx)] = jctx.handoff.snapshot()
+	}
+	return s
+}
+
+// haReplicate stores the state of the workers of the leader
+func haReplicate(e haElector, id string) error {
+	r, ok := e.(haReplicator)
+	if !ok {
+		return nil
+	}
+	b, err := json.Marshal(haSnapshotOf(id, deviceWorkers(""), time.Now()))
+	if err != nil {
+		return err
+	}
+	return r.putState(b)
+}
+
+// haRestore hands the state the previous leader stored to the workers, it
+// returns the number of devices restored
+func haRestore(e haElector) (int, error) {
+	r, ok := e.(haReplicator)
+	if !ok {
+		return 0, nil
+	}
+	b, err := r.getState()
+	if err != nil || b == nil {
+		return 0, err
+	}
+	var s haSnapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		return 0, fmt.Errorf("invalid state of the previous leader: %v", err)
+	}
+	n := 0
+	for _, jctx := range deviceWorkers("") {
+		if d, ok := s.Devices[clusterKey(jctx)]; ok {
+			jctx.handoff.restore(d)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// the state is stored in the key of the lock with .state
+func (c *consulLock) putState(b []byte) error {
+	_, err := c.consul.do("PUT", "/v1/kv/"+c.key+".state", json.RawMessage(b), nil)
+	return err
+}
+
+func (c *consulLock) getState() ([]byte, error) {
+	var kvs []struct {
+		Value []byte
+	}
+	code, err := c.consul.do("GET", "/v1/kv/"+c.key+".state", nil, &kvs)
+	if code == http.StatusNotFound || err == nil && len(kvs) == 0 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return kvs[0].Value, nil
+}
+
+func (e *etcdLock) putState(b []byte) error {
+	req := map[string]string{
+		"key":   base64.StdEncoding.EncodeToString([]byte(e.key + ".state")),
+		"value": base64.StdEncoding.EncodeToString(b),
+	}
+	var r struct{}
+	return e.post("/v3/kv/put", req, &r)
+}
+
+func (e *etcdLock) getState() ([]byte, error) {
+	var r struct {
+		Kvs []struct {
+			Value string `json:"value"`
+		} `json:"kvs"`
+	}
+	req := map[string]string{"key": base64.StdEncoding.EncodeToString([]byte(e.key + ".state"))}
+	if err := e.post("/v3/kv/range", req, &r); err != nil {
+		return nil, err
+	}
+	if len(r.Kvs) == 0 {
+		return nil, nil
+	}
+	return base64.StdEncoding.DecodeString(r.Kvs[0].Value)
+}
+
+// k8sStateAnnotation is the annotation of the lease with the state
+const k8sStateAnnotation = "jtimon/state"
+
+// putState annotates the lease if this instance holds it, the state is
+// stored again next time if the lease was changed meanwhile
+func (k *k8sLease) putState(b []byte) error {
+	path := "/apis/coordination.k8s.io/v1/namespaces/" + k.namespace + "/leases/" + k.name
+	var l lease
+	if _, err := k.do("GET", path, nil, &l); err != nil || l.Spec.HolderIdentity != k.id {
+		return err
+	}
+	if l.Metadata.Annotations == nil {
+		l.Metadata.Annotations = map[string]string{}
+	}
+	l.Metadata.Annotations[k8sStateAnnotation] = string(b)
+	code, err := k.do("PUT", path, &l, &l)
+	if code == http.StatusOK {
+		k.observed, k.observedAt = l.Metadata.ResourceVersion, time.Now()
+	}
+	return err
+}
+
+func (k *k8sLease) getState() ([]byte, error) {
+	path := "/apis/coordination.k8s.io/v1/namespaces/" + k.namespace + "/leases/" + k.name
+	var l lease
+	if _, err := k.do("GET", path, nil, &l); err != nil {
+		return nil, err
+	}
+	if s, ok := l.Metadata.Annotations[k8sStateAnnotation]; ok {
+		return []byte(s), nil
+	}
+	return nil, nil
+}
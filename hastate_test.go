@@ -0,0 +1,136 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	na_pb "github.com/nileshsimaria/jtimon/telemetry"
+)
+
+func TestHandoffUpdate(t *testing.T) {
+	jctx := &JCtx{config: Config{Host: "r1", Port: 32767, Paths: []PathsConfig{
+		{Path: "/interfaces", Freq: 2000}, {Path: "/bgp", Freq: 10000}}}}
+	jctx.handoff.restore(haDeviceState{
+		Paths:     map[string]uint64{"/interfaces": 100000, "/bgp": 100000},
+		Sequences: map[string]uint64{"/interfaces:/junos/ifd r1 1/0": 41},
+	})
+	packet := func(path string, ts, seq uint64) *na_pb.OpenConfigData {
+		return &na_pb.OpenConfigData{Path: path, SystemId: "r1", ComponentId: 1, Timestamp: ts, SequenceNumber: seq}
+	}
+
+	// the previous leader wrote the updates up to its last one
+	if !handoffUpdate(jctx, "/interfaces", packet("/interfaces:/junos/ifd", 99000, 40)) {
+		t.Errorf("an update written by the previous leader was not a duplicate")
+	}
+	if handoffUpdate(jctx, "/interfaces", packet("/interfaces:/junos/ifd", 108000, 45)) {
+		t.Errorf("the first update after the takeover was a duplicate")
+	}
+	// the next sample of a path is no gap
+	if handoffUpdate(jctx, "/bgp", packet("/bgp:/junos/bgp", 110000, 1)) {
+		t.Errorf("the next sample of /bgp was a duplicate")
+	}
+	if handoffUpdate(jctx, "/interfaces", packet("/interfaces:/junos/ifd", 100000, 46)) {
+		t.Errorf("an update once the gap is marked was a duplicate")
+	}
+
+	events := jctx.events.events()
+	if len(events) != 1 || events[0].Type != EventTakeoverGap ||
+		!strings.Contains(events[0].Message, "Takeover gap of 8s on /interfaces") || !strings.Contains(events[0].Message, "3 packets lost") {
+		t.Errorf("events %+v", events)
+	}
+
+	want := haDeviceState{
+		Paths:     map[string]uint64{"/interfaces": 100000, "/bgp": 110000},
+		Sequences: map[string]uint64{"/interfaces:/junos/ifd r1 1/0": 46, "/bgp:/junos/bgp r1 1/0": 1},
+	}
+	if s := jctx.handoff.snapshot(); !reflect.DeepEqual(s, want) {
+		t.Errorf("snapshot() = %+v, want %+v", s, want)
+	}
+}
+
+// fakeReplicator is a leader storing its state in memory
+type fakeReplicator struct {
+	fakeElector
+	state []byte
+}
+
+func (f *fakeReplicator) putState(b []byte) error {
+	f.state = b
+	return nil
+}
+
+func (f *fakeReplicator) getState() ([]byte, error) {
+	return f.state, nil
+}
+
+func TestHAReplicate(t *testing.T) {
+	leader := &JCtx{config: Config{Host: "r1", Port: 32767}}
+	leader.handoff.update("/interfaces", "s", 100000, 7)
+	standby := &JCtx{config: Config{Host: "r1", Port: 32767}}
+	other := &JCtx{config: Config{Host: "r2", Port: 32767}}
+	register := func(workers ...*JCtx) func() {
+		metricWorkers.Lock()
+		for _, jctx := range workers {
+			metricWorkers.m[jctx] = true
+		}
+		metricWorkers.Unlock()
+		return func() {
+			metricWorkers.Lock()
+			for _, jctx := range workers {
+				delete(metricWorkers.m, jctx)
+			}
+			metricWorkers.Unlock()
+		}
+	}
+
+	e := &fakeReplicator{}
+	if n, err := haRestore(e); err != nil || n != 0 {
+		t.Errorf("haRestore() without state = %d, %v", n, err)
+	}
+	unregister := register(leader)
+	if err := haReplicate(e, "a"); err != nil {
+		t.Fatal(err)
+	}
+	unregister()
+
+	defer register(standby, other)()
+	if n, err := haRestore(e); err != nil || n != 1 {
+		t.Errorf("haRestore() = %d, %v", n, err)
+	}
+	if !reflect.DeepEqual(standby.handoff.prevLast, map[string]uint64{"/interfaces": 100000}) || other.handoff.prevLast != nil {
+		t.Errorf("restored %v and %v", standby.handoff.prevLast, other.handoff.prevLast)
+	}
+}
+
+func TestHAStateStores(t *testing.T) {
+	consul, _ := fakeConsul(t)
+	defer consul.Close()
+	etcd, _ := fakeEtcd(t)
+	defer etcd.Close()
+	k8s := fakeK8s(t)
+	defer k8s.Close()
+
+	c, _ := newHAElector("consul://"+strings.TrimPrefix(consul.URL, "http://")+"/jtimon/leader", "a", 3*time.Second)
+	e, _ := newHAElector("etcd://"+strings.TrimPrefix(etcd.URL, "http://")+"/jtimon/leader", "a", 3*time.Second)
+	k := &k8sLease{client: k8s.Client(), base: k8s.URL, token: "token", namespace: "monitoring", name: "jtimon", id: "a", ttl: 3 * time.Second}
+	for name, r := range map[string]haReplicator{"consul": c.(haReplicator), "etcd": e.(haReplicator), "k8s": k} {
+		if leader, err := r.(haElector).campaign(); err != nil || !leader {
+			t.Fatalf("%s campaign() = %v, %v", name, leader, err)
+		}
+		if b, err := r.getState(); err != nil || b != nil {
+			t.Errorf("%s getState() before putState() = %q, %v", name, b, err)
+		}
+		if err := r.putState([]byte(`{"leader":"a"}`)); err != nil {
+			t.Fatalf("%s putState() = %v", name, err)
+		}
+		if b, err := r.getState(); err != nil || string(b) != `{"leader":"a"}` {
+			t.Errorf("%s getState() = %q, %v", name, b, err)
+		}
+		// the lease is still held with its annotation
+		if leader, err := r.(haElector).campaign(); err != nil || !leader {
+			t.Errorf("%s campaign() after putState() = %v, %v", name, leader, err)
+		}
+	}
+}
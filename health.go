@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// deviceHealth is the state of the connection to a device
+type deviceHealth struct {
+	Device string `json:"device"`
+	Port   int    `json:"port"`
+	// Address is the address of the device connected to, if it has several
+	Address   string `json:"address,omitempty"`
+	Connected bool   `json:"connected"`
+	Stale     bool   `json:"stale"`
+	Paused    bool   `json:"paused"`
+	// Owner is the member of --cluster the device is assigned to,
+	// Unassigned tells it is not this instance
+	Owner      string     `json:"owner,omitempty"`
+	Unassigned bool       `json:"unassigned,omitempty"`
+	Groups     []string   `json:"groups,omitempty"`
+	LastData   *time.Time `json:"last-data,omitempty"`
+	Paths      []string   `json:"paths"`
+	Packets    uint64     `json:"packets"`
+	Points     uint64     `json:"points"`
+	Reconnects uint64     `json:"reconnects"`
+	Drops      uint64     `json:"drops"`
+	// Latencies and LatencySum, in seconds, are the number and the sum of
+	// the latencies of the packets, from their timestamp to their receipt
+	Latencies  uint64  `json:"latencies"`
+	LatencySum float64 `json:"latency-sum"`
+}
+
+// packetReceived counts a packet received from the device
+func packetReceived(jctx *JCtx) {
+	atomic.AddUint64(&jctx.metrics.packets, 1)
+	atomic.StoreInt64(&jctx.metrics.lastData, time.Now().UnixNano())
+}
+
+// setConnected records whether the worker is streaming from the device,
+// and the connect in the event history
+func setConnected(jctx *JCtx, connected bool) {
+	var c int32
+	if connected {
+		c = 1
+	}
+	if connected {
+		atomic.StoreInt64(&jctx.metrics.connectedAt, time.Now().UnixNano())
+	}
+	if atomic.SwapInt32(&jctx.metrics.connected, c) == 0 && connected {
+		recordEvent(jctx, EventConnect, "", fmt.Sprintf("streaming from %s:%d", deviceAddress(jctx), jctx.config.Port))
+	}
+}
+
+// workerHealth returns the health of the worker, the paths are the
+// subscribed paths, without the paused ones, while it is connected
+func workerHealth(jctx *JCtx) deviceHealth {
+	h := deviceHealth{
+		Device:     jctx.config.Host,
+		Port:       jctx.config.Port,
+		Connected:  atomic.LoadInt32(&jctx.metrics.connected) == 1,
+		Stale:      isStale(jctx),
+		Groups:     jctx.config.Groups,
+		Paths:      []string{},
+		Packets:    atomic.LoadUint64(&jctx.metrics.packets),
+		Points:     atomic.LoadUint64(&jctx.metrics.points),
+		Reconnects: atomic.LoadUint64(&jctx.metrics.reconnects),
+		Drops:      jctx.drops.total(),
+	}
+	count, sum := jctx.stats.paths.latency()
+	h.Latencies, h.LatencySum = count, sum.Seconds()
+	h.Paused, _ = jctx.paused.state()
+	if len(jctx.config.Addresses) > 1 {
+		h.Address = deviceAddress(jctx)
+	}
+	owner, changed := cluster.assigned(jctx)
+	h.Owner, h.Unassigned = owner, changed != nil
+	if t := atomic.LoadInt64(&jctx.metrics.lastData); t != 0 {
+		last := time.Unix(0, t).UTC()
+		h.LastData = &last
+	}
+	if h.Connected {
+		for _, p := range jctx.paused.active(jctx.config.Paths) {
+			h.Paths = append(h.Paths, p.Path)
+		}
+	}
+	return h
+}
+
+// healthHandler serves the health of the workers in the scope of the
+// request as JSON, sorted by device
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	scope := requestScope(r.Context())
+	devices := []deviceHealth{}
+	metricWorkers.Lock()
+	for jctx := range metricWorkers.m {
+		if scope.allows(jctx) {
+			devices = append(devices, workerHealth(jctx))
+		}
+	}
+	metricWorkers.Unlock()
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].Device != devices[j].Device {
+			return devices[i].Device < devices[j].Device
+		}
+		return devices[i].Port < devices[j].Port
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Devices []deviceHealth `json:"devices"`
+	}{devices})
+}
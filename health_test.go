@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHealthHandler(t *testing.T) {
+	r1 := &JCtx{config: Config{Host: "r1", Port: 32767, Paths: []PathsConfig{{Path: "/interfaces"}, {Path: "/bgp"}}}}
+	r2 := &JCtx{config: Config{Host: "r2", Port: 32767, Paths: []PathsConfig{{Path: "/interfaces"}}, Groups: []string{"apac"}}}
+	setConnected(r1, true)
+	packetReceived(r1)
+	r1.metrics.reconnects = 2
+	r1.metrics.points = 12
+	r2.metrics.reconnects = 5
+	r1.drops.add("decode", 3)
+	r1.drops.add("influx", 4)
+	r1.stats.paths.add("/interfaces", 6, 100, 250*time.Millisecond, true)
+	for _, jctx := range []*JCtx{r2, r1} {
+		dropsInit(jctx)
+		defer dropsStop(jctx)
+	}
+
+	rec := httptest.NewRecorder()
+	healthHandler(rec, httptest.NewRequest("GET", "/health", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("got content type %s", ct)
+	}
+	var got struct {
+		Devices []deviceHealth `json:"devices"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Devices) != 2 {
+		t.Fatalf("got %+v", got.Devices)
+	}
+	if last := got.Devices[0].LastData; last == nil || time.Since(*last) > time.Minute {
+		t.Errorf("r1: got last data %v", last)
+	}
+	got.Devices[0].LastData = nil
+	want := []deviceHealth{
+		{Device: "r1", Port: 32767, Connected: true, Paths: []string{"/interfaces", "/bgp"},
+			Packets: 1, Points: 12, Reconnects: 2, Drops: 7, Latencies: 1, LatencySum: 0.25},
+		{Device: "r2", Port: 32767, Groups: []string{"apac"}, Paths: []string{}, Reconnects: 5},
+	}
+	if !reflect.DeepEqual(got.Devices, want) {
+		t.Errorf("got %+v, want %+v", got.Devices, want)
+	}
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	rec = httptest.NewRecorder()
+	healthHandler(rec, req.WithContext(withScope(req.Context(), apiScope{"apac": true})))
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Devices) != 1 || got.Devices[0].Device != "r2" {
+		t.Errorf("scope apac: got %+v", got.Devices)
+	}
+
+	setConnected(r1, false)
+	if h := workerHealth(r1); h.Connected || len(h.Paths) != 0 {
+		t.Errorf("disconnected: got %+v", h)
+	}
+}
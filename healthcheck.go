@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"golang.org/x/net/context"
+)
+
+var (
+	healthcheckReady   = flag.Bool("healthcheck-ready", false, "jtimon healthcheck checks /readyz instead of /healthz")
+	healthcheckTimeout = flag.Int("healthcheck-timeout", 5, "How long jtimon healthcheck waits for the internal metrics service, in seconds")
+)
+
+// localAPI returns the client and the URL of path on the internal metrics
+// service of the local jtimon, on its Unix socket if it has one. The
+// service is local, its certificate is not verified.
+func localAPI(path string, timeout time.Duration) (*http.Client, string, error) {
+	client := &http.Client{Timeout: timeout}
+	if *metricsSocket != "" {
+		socket := *metricsSocket
+		client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		return client, "http://jtimon" + path, nil
+	}
+	if *metricsPort == 0 {
+		return nil, "", fmt.Errorf("the internal metrics service is not enabled, set --internal-metrics-port or --internal-metrics-socket")
+	}
+	host := *metricsHost
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+		if ip != nil && ip.To4() == nil {
+			host = "::1"
+		}
+	}
+	scheme := "http"
+	if *apiTLSCert != "" {
+		scheme = "https"
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	return client, scheme + "://" + net.JoinHostPort(host, strconv.Itoa(int(*metricsPort))) + path, nil
+}
+
+// healthcheck gets the probe of the local jtimon, it fails unless the probe
+// answers 200. It returns the body of the answer, the readiness of /readyz.
+func healthcheck(ready bool, timeout time.Duration) (string, error) {
+	path := "/healthz"
+	if ready {
+		path = "/readyz"
+	}
+	client, url, err := localAPI(path, timeout)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	body := strings.TrimSpace(string(b))
+	if resp.StatusCode != http.StatusOK {
+		return body, fmt.Errorf("%s: %s", path, resp.Status)
+	}
+	return body, nil
+}
+
+// healthcheckMain runs jtimon healthcheck, it exits with status 0 if the
+// local jtimon is alive (ready with --healthcheck-ready) and 1 otherwise
+func healthcheckMain() {
+	body, err := healthcheck(*healthcheckReady, time.Duration(*healthcheckTimeout)*time.Second)
+	if body != "" {
+		fmt.Println(body)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "healthcheck: %v\n", err)
+		os.Exit(1)
+	}
+}
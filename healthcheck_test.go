@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHealthcheck(t *testing.T) {
+	defer func(host string, port int32, socket string) {
+		*metricsHost, *metricsPort, *metricsSocket = host, port, socket
+	}(*metricsHost, *metricsPort, *metricsSocket)
+	*metricsHost, *metricsPort, *metricsSocket = "127.0.0.1", 0, ""
+	if _, err := healthcheck(false, time.Second); err == nil {
+		t.Errorf("healthcheck() without the internal metrics service = nil")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"ready":false}` + "\n"))
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	_, port, _ := net.SplitHostPort(s.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	// the service listens on all the addresses, the local one is checked
+	*metricsHost, *metricsPort = "0.0.0.0", int32(p)
+	if body, err := healthcheck(false, time.Second); err != nil || body != "ok" {
+		t.Errorf("healthcheck() = %q, %v", body, err)
+	}
+	if body, err := healthcheck(true, time.Second); err == nil || err.Error() != "/readyz: 503 Service Unavailable" || body != `{"ready":false}` {
+		t.Errorf("healthcheck() of /readyz = %q, %v", body, err)
+	}
+
+	dir, err := ioutil.TempDir("", "jtimon-healthcheck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	*metricsSocket = filepath.Join(dir, "metrics.sock")
+	lis, err := net.Listen("unix", *metricsSocket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go http.Serve(lis, mux)
+	defer lis.Close()
+	*metricsPort = 0
+	if body, err := healthcheck(false, time.Second); err != nil || body != "ok" {
+		t.Errorf("healthcheck() on the socket = %q, %v", body, err)
+	}
+
+	lis.Close()
+	if _, err := healthcheck(false, time.Second); err == nil {
+		t.Errorf("healthcheck() of a stopped jtimon = nil")
+	}
+}
@@ -3,10 +3,10 @@ package main
 import (
 	"fmt"
 	"log"
+	"net"
 	"reflect"
 	"regexp"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/influxdata/influxdb/client/v2"
@@ -15,12 +15,15 @@ import (
 
 // InfluxCtx is run time info of InfluxDB data structures
 type InfluxCtx struct {
-	sync.Mutex
 	influxClient   *client.Client
 	batchWCh       chan []*client.Point
 	batchWMCh      chan *batchWMData
 	accumulatorCh  chan (*metricIDB)
 	reXpath, reKey *regexp.Regexp
+	writers        []*influxWriter
+	// the periodic tasks of the accumulator and of the batch writes
+	accumulateTask *schedTask
+	batchTask      *schedTask
 }
 
 type batchWMData struct {
@@ -30,19 +33,98 @@ type batchWMData struct {
 
 // InfluxConfig is the config of InfluxDB
 type InfluxConfig struct {
-	Server               string `json:"server"`
-	Port                 int    `json:"port"`
-	Dbname               string `json:"dbname"`
-	User                 string `json:"user"`
-	Password             string `json:"password"`
-	Recreate             bool   `json:"recreate"`
-	Measurement          string `json:"measurement"`
-	BatchSize            int    `json:"batchsize"`
-	BatchFrequency       int    `json:"batchfrequency"`
-	HTTPTimeout          int    `json:"http-timeout"`
-	RetentionPolicy      string `json:"retention-policy"`
-	AccumulatorFrequency int    `json:"accumulator-frequency"`
-	WritePerMeasurement  bool   `json:"write-per-measurement"`
+	Server               string           `json:"server"`
+	Port                 int              `json:"port"`
+	Dbname               string           `json:"dbname"`
+	User                 string           `json:"user"`
+	Password             string           `json:"password"`
+	Recreate             bool             `json:"recreate"`
+	Measurement          string           `json:"measurement"`
+	BatchSize            int              `json:"batchsize"`
+	BatchFrequency       int              `json:"batchfrequency"`
+	HTTPTimeout          int              `json:"http-timeout"`
+	RetentionPolicy      string           `json:"retention-policy"`
+	AccumulatorFrequency int              `json:"accumulator-frequency"`
+	WritePerMeasurement  bool             `json:"write-per-measurement"`
+	Precision            string           `json:"precision"`
+	TimestampRounding    string           `json:"timestamp-rounding"`
+	Mirrors              []InfluxEndpoint `json:"mirrors"`
+	QueueSize            int              `json:"queue-size"`
+	RetryInterval        int              `json:"retry-interval"`
+	Shared               bool             `json:"shared"`
+	SelfMeasurement      string           `json:"self-measurement"`
+	SelfInterval         int              `json:"self-interval"`
+}
+
+// InfluxEndpoint is an additional InfluxDB server which receives every batch
+type InfluxEndpoint struct {
+	Server   string `json:"server"`
+	Port     int    `json:"port"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+// influxWriter writes batches into one InfluxDB server. Every server has its
+// own queue so that an unreachable one does not hold up the others. With
+// influx shared the batches go to the writer shared with the other workers.
+type influxWriter struct {
+	timer  writeTimer
+	addr   string
+	c      client.Client
+	ch     chan client.BatchPoints
+	shared *sharedInfluxWriter
+	// flushed tells that the batches queued before a nil one are written
+	flushed chan struct{}
+}
+
+// influxPrecisions are the supported write precisions
+var influxPrecisions = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+
+func validateInfluxConfig(cfg InfluxConfig) error {
+	if _, ok := influxPrecisions[cfg.Precision]; cfg.Precision != "" && !ok {
+		return fmt.Errorf("influx precision %q is not supported, use ns, us, ms or s", cfg.Precision)
+	}
+	switch cfg.TimestampRounding {
+	case "", "truncate", "round":
+	default:
+		return fmt.Errorf("influx timestamp-rounding %q is not supported, use truncate or round", cfg.TimestampRounding)
+	}
+	if cfg.SelfInterval < 0 {
+		return fmt.Errorf("influx self-interval can not be negative")
+	}
+	if cfg.QueueSize < 0 {
+		return fmt.Errorf("influx queue-size can not be negative")
+	}
+	return nil
+}
+
+func influxPrecision(jctx *JCtx) string {
+	if jctx.config.Influx.Precision == "" {
+		return DefaultIDBPrecision
+	}
+	return jctx.config.Influx.Precision
+}
+
+func influxBatchPointsConfig(jctx *JCtx) client.BatchPointsConfig {
+	return client.BatchPointsConfig{
+		Database:        jctx.config.Influx.Dbname,
+		Precision:       influxPrecision(jctx),
+		RetentionPolicy: jctx.config.Influx.RetentionPolicy,
+	}
+}
+
+// influxTime rounds t to the write precision if asked to, otherwise it is
+// truncated by the client while the batch is encoded
+func influxTime(jctx *JCtx, t time.Time) time.Time {
+	if jctx.config.Influx.TimestampRounding == "round" {
+		return t.Round(influxPrecisions[influxPrecision(jctx)])
+	}
+	return t
 }
 
 type metricIDB struct {
@@ -69,135 +151,124 @@ func pointAcculumator(jctx *JCtx) {
 	jctx.influxCtx.accumulatorCh = accumulatorCh
 	jLog(jctx, fmt.Sprintln("Accumulator frequency:", freq))
 
-	ticker := time.NewTicker(time.Duration(freq) * time.Millisecond)
+	jctx.influxCtx.accumulateTask = schedule(time.Duration(freq)*time.Millisecond, func() {
+		n := len(accumulatorCh)
+		if n != 0 {
+			jLogDebug(jctx, fmt.Sprintf("Accumulated points : %d\n", n))
+			var lastPoint *client.Point
+			var points []*client.Point
+			for i := 0; i < n; i++ {
+				m := <-accumulatorCh
+				if lastPoint == nil {
+					mName := ""
+					if jctx.config.Influx.Measurement != "" {
+						mName = jctx.config.Influx.Measurement
+					} else {
+						mName = m.tags["sensor"]
+					}
 
-	go func() {
-		for range ticker.C {
-			n := len(accumulatorCh)
-			if n != 0 {
-				jLog(jctx, fmt.Sprintf("Accumulated points : %d\n", n))
-				var lastPoint *client.Point
-				var points []*client.Point
-				for i := 0; i < n; i++ {
-					m := <-accumulatorCh
-					if lastPoint == nil {
+					pt, err := client.NewPoint(mName, m.tags, m.fields, influxTime(jctx, time.Now()))
+					if err != nil {
+						jLogError(jctx, "", "pointAcculumator: Could not get NewPoint (first point)", err)
+						continue
+					}
+					lastPoint = pt
+				} else {
+					// let's see if we can merge
+					var fieldFound = false
+					eq := reflect.DeepEqual(m.tags, lastPoint.Tags())
+					if eq {
+						// tags are equal so most likely we will be able to merge.
+						// we would also need to see if the field is not already part of the point,
+						// if it is then we can merge because in 'config false' world of yang, keys
+						// are optional inside list so instead of losing the point we'd  not merge.
+						for mk := range m.fields {
+							lastKV, _ := lastPoint.Fields()
+							if _, ok := lastKV[mk]; ok {
+								fieldFound = true
+								break
+							}
+						}
+					}
+					if eq && !fieldFound {
+						// We can merge
+						lastKV, err := lastPoint.Fields()
+						name := lastPoint.Name()
+						if err != nil {
+							jLogError(jctx, "", "addIDB: Could not get fields of the last point", err)
+							continue
+						}
+						// get the fields from last point for merging
+						for k, v := range lastKV {
+							m.fields[k] = v
+						}
+						pt, err := client.NewPoint(name, m.tags, m.fields, influxTime(jctx, time.Now()))
+						if err != nil {
+							jLogError(jctx, "", "addIDB: Could not get NewPoint (merging)", err)
+							continue
+						}
+						lastPoint = pt
+					} else {
+						// lastPoint tags and current point tags differes so we can not merge.
+						// toss current point into the slice (points) and handle current point
+						// by creating new *client.Point
 						mName := ""
 						if jctx.config.Influx.Measurement != "" {
 							mName = jctx.config.Influx.Measurement
 						} else {
 							mName = m.tags["sensor"]
 						}
-
-						pt, err := client.NewPoint(mName, m.tags, m.fields, time.Now())
+						pt, err := client.NewPoint(mName, m.tags, m.fields, influxTime(jctx, time.Now()))
 						if err != nil {
-							jLog(jctx, fmt.Sprintf("pointAcculumator: Could not get NewPoint (first point): %v\n", err))
+							jLogError(jctx, "", "pointAcculumator: Could not get NewPoint (first point)", err)
 							continue
 						}
+						points = append(points, lastPoint)
 						lastPoint = pt
-					} else {
-						// let's see if we can merge
-						var fieldFound = false
-						eq := reflect.DeepEqual(m.tags, lastPoint.Tags())
-						if eq {
-							// tags are equal so most likely we will be able to merge.
-							// we would also need to see if the field is not already part of the point,
-							// if it is then we can merge because in 'config false' world of yang, keys
-							// are optional inside list so instead of losing the point we'd  not merge.
-							for mk := range m.fields {
-								lastKV, _ := lastPoint.Fields()
-								if _, ok := lastKV[mk]; ok {
-									fieldFound = true
-									break
-								}
-							}
-						}
-						if eq && !fieldFound {
-							// We can merge
-							lastKV, err := lastPoint.Fields()
-							name := lastPoint.Name()
-							if err != nil {
-								jLog(jctx, fmt.Sprintf("addIDB: Could not get fields of the last point: %v\n", err))
-								continue
-							}
-							// get the fields from last point for merging
-							for k, v := range lastKV {
-								m.fields[k] = v
-							}
-							pt, err := client.NewPoint(name, m.tags, m.fields, time.Now())
-							if err != nil {
-								jLog(jctx, fmt.Sprintf("addIDB: Could not get NewPoint (merging): %v\n", err))
-								continue
-							}
-							lastPoint = pt
-						} else {
-							// lastPoint tags and current point tags differes so we can not merge.
-							// toss current point into the slice (points) and handle current point
-							// by creating new *client.Point
-							mName := ""
-							if jctx.config.Influx.Measurement != "" {
-								mName = jctx.config.Influx.Measurement
-							} else {
-								mName = m.tags["sensor"]
-							}
-							pt, err := client.NewPoint(mName, m.tags, m.fields, time.Now())
-							if err != nil {
-								jLog(jctx, fmt.Sprintf("pointAcculumator: Could not get NewPoint (first point): %v\n", err))
-								continue
-							}
-							points = append(points, lastPoint)
-							lastPoint = pt
-						}
 					}
 				}
+			}
 
-				if len(points) > 0 {
-					// See if we need to add lastPoint we are processing
-					if eq := reflect.DeepEqual(points[len(points)-1], lastPoint); !eq {
-						points = append(points, lastPoint)
-					}
+			if len(points) > 0 {
+				// See if we need to add lastPoint we are processing
+				if eq := reflect.DeepEqual(points[len(points)-1], lastPoint); !eq {
+					points = append(points, lastPoint)
 				}
+			}
 
-				if len(points) > 0 {
-					bp, err := client.NewBatchPoints(client.BatchPointsConfig{
-						Database:        jctx.config.Influx.Dbname,
-						Precision:       "us",
-						RetentionPolicy: jctx.config.Influx.RetentionPolicy,
-					})
+			if len(points) > 0 {
+				bp, err := client.NewBatchPoints(influxBatchPointsConfig(jctx))
 
-					if err != nil {
-						jLog(jctx, fmt.Sprintf("NewBatchPoints failed, error: %v\n", err))
-						return
-					}
+				if err != nil {
+					jLogError(jctx, "", "NewBatchPoints failed", err)
+					return
+				}
 
-					for _, p := range points {
-						bp.AddPoint(p)
-						if jctx.config.Log.Verbose {
-							jLog(jctx, fmt.Sprintf("\n\nPoint Name = %s\n", p.Name()))
-							jLog(jctx, fmt.Sprintf("tags are following ...."))
-							for k, v := range p.Tags() {
-								jLog(jctx, fmt.Sprintf("%s = %s", k, v))
-							}
-							fields, err := p.Fields()
-							if err != nil {
-								jLog(jctx, fmt.Sprintf("%v", err))
-							} else {
-								jLog(jctx, fmt.Sprintf("fields are following ...."))
-								for k, v := range fields {
-									jLog(jctx, fmt.Sprintf("%s = %s", k, v))
-								}
+				for _, p := range points {
+					bp.AddPoint(p)
+					if IsVerboseLogging(jctx) {
+						jLogDebug(jctx, fmt.Sprintf("\n\nPoint Name = %s\n", p.Name()))
+						jLogDebug(jctx, fmt.Sprintf("tags are following ...."))
+						for k, v := range p.Tags() {
+							jLogDebug(jctx, fmt.Sprintf("%s = %s", k, v))
+						}
+						fields, err := p.Fields()
+						if err != nil {
+							jLogDebug(jctx, fmt.Sprintf("%v", err))
+						} else {
+							jLogDebug(jctx, fmt.Sprintf("fields are following ...."))
+							for k, v := range fields {
+								jLogDebug(jctx, fmt.Sprintf("%s = %s", k, v))
 							}
 						}
 					}
-					if err := (*jctx.influxCtx.influxClient).Write(bp); err != nil {
-						jLog(jctx, fmt.Sprintf("Batch DB write failed: %v", err))
-					} else {
-						jLog(jctx, fmt.Sprintln("Batch write successful! Number of points written post merge logic: ", len(points)))
-					}
-
 				}
+				jLogDebug(jctx, fmt.Sprintln("Number of points to write post merge logic: ", len(points)))
+				influxWrite(jctx, bp)
+
 			}
 		}
-	}()
+	})
 }
 
 func dbBatchWriteM(jctx *JCtx) {
@@ -213,74 +284,54 @@ func dbBatchWriteM(jctx *JCtx) {
 	bFreq := jctx.config.Influx.BatchFrequency
 	jLog(jctx, fmt.Sprintln("batch size:", batchSize, "batch frequency:", bFreq))
 
-	ticker := time.NewTicker(time.Duration(bFreq) * time.Millisecond)
-	go func() {
-		for range ticker.C {
-			m := map[string][]*batchWMData{}
-			n := len(batchMCh)
-			if n != 0 {
-				jLog(jctx, fmt.Sprintln("#elements in the batchMCh channel : ", n))
-				for i := 0; i < n; i++ {
-					d := <-batchMCh
-					v := m[d.measurement]
-					m[d.measurement] = append(v, d)
+	jctx.influxCtx.batchTask = schedule(time.Duration(bFreq)*time.Millisecond, func() {
+		m := map[string][]*batchWMData{}
+		n := len(batchMCh)
+		if n != 0 {
+			jLogDebug(jctx, fmt.Sprintln("#elements in the batchMCh channel : ", n))
+			for i := 0; i < n; i++ {
+				// the oldest packets may be dropped meanwhile
+				select {
+				case d := <-batchMCh:
+					m[d.measurement] = append(m[d.measurement], d)
+				default:
 				}
-				jLog(jctx, fmt.Sprintln("#elements in the measurement map : ", len(m)))
-
 			}
+			jLogDebug(jctx, fmt.Sprintln("#elements in the measurement map : ", len(m)))
 
-			for measurement, data := range m {
-				jLog(jctx, fmt.Sprintf("measurement: %s, data len: %d", measurement, len(data)))
+		}
 
-				bp, err := client.NewBatchPoints(client.BatchPointsConfig{
-					Database:        jctx.config.Influx.Dbname,
-					Precision:       "us",
-					RetentionPolicy: jctx.config.Influx.RetentionPolicy,
-				})
+		for measurement, data := range m {
+			jLogDebug(jctx, fmt.Sprintf("measurement: %s, data len: %d", measurement, len(data)))
 
-				if err != nil {
-					jLog(jctx, fmt.Sprintf("NewBatchPoints failed, error: %v", err))
-					continue
-				}
+			bp, err := client.NewBatchPoints(influxBatchPointsConfig(jctx))
 
-				for j := 0; j < len(data); j++ {
-					packet := data[j].points
-					k := 0
-					for k = 0; k < len(packet); k++ {
-						bp.AddPoint(packet[k])
-						if len(bp.Points()) >= batchSize {
-							jLog(jctx, fmt.Sprintf("Attempt to write %d points in %s", len(bp.Points()), measurement))
-							if err := (*jctx.influxCtx.influxClient).Write(bp); err != nil {
-								jLog(jctx, fmt.Sprintf("Batch DB write failed for measurement %s: %v", measurement, err))
-							} else {
-								jLog(jctx, fmt.Sprintln("Batch write successful for measurement: ", measurement))
-							}
+			if err != nil {
+				jLogError(jctx, "", "NewBatchPoints failed", err)
+				continue
+			}
 
-							bp, err = client.NewBatchPoints(client.BatchPointsConfig{
-								Database:        jctx.config.Influx.Dbname,
-								Precision:       "us",
-								RetentionPolicy: jctx.config.Influx.RetentionPolicy,
-							})
-						}
+			for j := 0; j < len(data); j++ {
+				packet := data[j].points
+				k := 0
+				for k = 0; k < len(packet); k++ {
+					bp.AddPoint(packet[k])
+					if len(bp.Points()) >= batchSize {
+						jLogDebug(jctx, fmt.Sprintf("Attempt to write %d points in %s", len(bp.Points()), measurement))
+						influxWrite(jctx, bp)
+
+						bp, err = client.NewBatchPoints(influxBatchPointsConfig(jctx))
 					}
 				}
-				if len(bp.Points()) > 0 {
-					jLog(jctx, fmt.Sprintf("Attempt to write %d points in %s", len(bp.Points()), measurement))
-					if err := (*jctx.influxCtx.influxClient).Write(bp); err != nil {
-						jLog(jctx, fmt.Sprintf("Batch DB write failed for measurement %s: %v", measurement, err))
-					} else {
-						jLog(jctx, fmt.Sprintln("Batch write successful for measurement: ", measurement))
-					}
+			}
+			if len(bp.Points()) > 0 {
+				jLogDebug(jctx, fmt.Sprintf("Attempt to write %d points in %s", len(bp.Points()), measurement))
+				influxWrite(jctx, bp)
 
-					bp, err = client.NewBatchPoints(client.BatchPointsConfig{
-						Database:        jctx.config.Influx.Dbname,
-						Precision:       "us",
-						RetentionPolicy: jctx.config.Influx.RetentionPolicy,
-					})
-				}
+				bp, err = client.NewBatchPoints(influxBatchPointsConfig(jctx))
 			}
 		}
-	}()
+	})
 }
 
 func dbBatchWrite(jctx *JCtx) {
@@ -296,39 +347,33 @@ func dbBatchWrite(jctx *JCtx) {
 	bFreq := jctx.config.Influx.BatchFrequency
 	jLog(jctx, fmt.Sprintln("batch size:", batchSize, "batch frequency:", bFreq))
 
-	ticker := time.NewTicker(time.Duration(bFreq) * time.Millisecond)
-	go func() {
-		for range ticker.C {
-			n := len(batchCh)
-			if n != 0 {
-				bp, err := client.NewBatchPoints(client.BatchPointsConfig{
-					Database:        jctx.config.Influx.Dbname,
-					Precision:       "us",
-					RetentionPolicy: jctx.config.Influx.RetentionPolicy,
-				})
+	jctx.influxCtx.batchTask = schedule(time.Duration(bFreq)*time.Millisecond, func() {
+		n := len(batchCh)
+		if n != 0 {
+			bp, err := client.NewBatchPoints(influxBatchPointsConfig(jctx))
 
-				if err != nil {
-					jLog(jctx, fmt.Sprintf("NewBatchPoints failed, error: %v\n", err))
-					return
-				}
+			if err != nil {
+				jLogError(jctx, "", "NewBatchPoints failed", err)
+				return
+			}
 
-				for i := 0; i < n; i++ {
-					packet := <-batchCh
-					for j := 0; j < len(packet); j++ {
-						bp.AddPoint(packet[j])
-					}
+			for i := 0; i < n; i++ {
+				// the oldest packets may be dropped meanwhile
+				var packet []*client.Point
+				select {
+				case packet = <-batchCh:
+				default:
 				}
-
-				jLog(jctx, fmt.Sprintf("Batch processing: #packets:%d #points:%d\n", n, len(bp.Points())))
-
-				if err := (*jctx.influxCtx.influxClient).Write(bp); err != nil {
-					jLog(jctx, fmt.Sprintf("Batch DB write failed: %v", err))
-				} else {
-					jLog(jctx, fmt.Sprintln("Batch write successful! Post batch write available points: ", len(batchCh)))
+				for j := 0; j < len(packet); j++ {
+					bp.AddPoint(packet[j])
 				}
 			}
+
+			jLogDebug(jctx, fmt.Sprintf("Batch processing: #packets:%d #points:%d\n", n, len(bp.Points())))
+
+			influxWrite(jctx, bp)
 		}
-	}()
+	})
 }
 
 // Takes in XML path with predicates and returns list of tags+values
@@ -360,7 +405,7 @@ func spitTagsNPath(jctx *JCtx, xmlpath string) (string, map[string]string) {
 						"/@" + strings.TrimSpace(keyValue[1])
 					tagValue := strings.Replace(strings.TrimSpace(keyValue[2]), "'", "", -1)
 					// Store as key value pairs
-					tags[getAlias(jctx.alias, tagKey)] = tagValue
+					tags[intern(getAlias(jctx.alias, tagKey))] = intern(tagValue)
 				}
 			}
 			// Remove the key value pairs from the given xpath
@@ -369,7 +414,7 @@ func spitTagsNPath(jctx *JCtx, xmlpath string) (string, map[string]string) {
 		}
 	}
 
-	return xmlpath, tags
+	return intern(xmlpath), tags
 }
 
 // SubscriptionPathFromPath to extract subscription path from path
@@ -406,7 +451,32 @@ func newRow(tags map[string]string, fields map[string]interface{}) (*row, error)
 }
 
 // A go routine to add one telemetry packet in to InfluxDB
-func addIDB(ocData *na_pb.OpenConfigData, jctx *JCtx, rtime time.Time) {
+func addIDB(ocData *na_pb.OpenConfigData, jctx *JCtx, rtime time.Time, tr *packetTrace) {
+	defer tr.finish()
+	start := time.Now()
+	points := decodeIDB(ocData, jctx, rtime)
+	tr.span("decode", start)
+	if len(points) == 0 {
+		return
+	}
+	start = time.Now()
+	points = applyTransforms(jctx, points)
+	tr.span("transform", start)
+	tr.setPoints(len(points))
+	start = time.Now()
+	exportIDB(jctx, mName(ocData, jctx.config), points)
+	tr.span("export", start)
+	pointsExported(jctx, len(points), rtime)
+}
+
+// decodeIDB turns one telemetry packet into points, one per list entry
+func decodeIDB(ocData *na_pb.OpenConfigData, jctx *JCtx, rtime time.Time) []*point {
+	return decodePoints(ocData, jctx, rtime, false)
+}
+
+// decodePoints decodes the packet into points, only when they are exported
+// somewhere unless all is set
+func decodePoints(ocData *na_pb.OpenConfigData, jctx *JCtx, rtime time.Time, all bool) []*point {
 	cfg := jctx.config
 
 	prefix := ""
@@ -416,12 +486,11 @@ func addIDB(ocData *na_pb.OpenConfigData, jctx *JCtx, rtime time.Time) {
 	var xmlpath string
 	prefixTags = nil
 
-	points := make([]*client.Point, 0)
-	rows := make([]*row, 0)
+	scratch := getDecodeScratch()
+	defer putDecodeScratch(scratch)
 
+	sensor := intern(ocData.Path)
 	for _, v := range ocData.Kv {
-		kv := make(map[string]interface{})
-
 		switch {
 		case v.Key == "__prefix__":
 			prefix = v.GetStrValue()
@@ -439,15 +508,19 @@ func addIDB(ocData *na_pb.OpenConfigData, jctx *JCtx, rtime time.Time) {
 			} else {
 				xmlpath = prefixXmlpath + key
 				tags = prefixTags
-				xmlpath = getAlias(jctx.alias, xmlpath)
+				xmlpath = intern(getAlias(jctx.alias, xmlpath))
 			}
 		} else {
 			xmlpath, tags = spitTagsNPath(jctx, key)
 		}
 
 		tags["device"] = cfg.Host
-		tags["sensor"] = ocData.Path
+		tags["sensor"] = sensor
+		addressTag(jctx, tags)
+		rttTag(jctx, tags)
+		factTags(jctx, tags)
 
+		kv := getFields()
 		switch v.Value.(type) {
 		case *na_pb.KeyValue_StrValue:
 			kv[xmlpath] = v.GetStrValue()
@@ -462,7 +535,13 @@ func addIDB(ocData *na_pb.OpenConfigData, jctx *JCtx, rtime time.Time) {
 		case *na_pb.KeyValue_BoolValue:
 			kv[xmlpath] = v.GetBoolValue()
 		case *na_pb.KeyValue_BytesValue:
-			kv[xmlpath] = v.GetBytesValue()
+			if fields, ok := decodeBytes(jctx, xmlpath, v.GetBytesValue()); ok {
+				for k, fv := range fields {
+					kv[intern(xmlpath+"/"+k)] = fv
+				}
+			} else {
+				kv[xmlpath] = v.GetBytesValue()
+			}
 		default:
 		}
 
@@ -473,81 +552,160 @@ func addIDB(ocData *na_pb.OpenConfigData, jctx *JCtx, rtime time.Time) {
 			testDataPoints(jctx, GENTESTRESDATA, tags, kv)
 		}
 
-		if jctx.influxCtx.influxClient == nil {
+		if (!all && jctx.influxCtx.influxClient == nil && len(jctx.sinks) == 0 && !tailing(jctx) && !recentEnabled()) || len(kv) == 0 {
+			putFields(kv)
 			continue
 		}
 
-		if len(kv) != 0 {
-			if len(rows) != 0 {
-				lastRow := rows[len(rows)-1]
-				eq := reflect.DeepEqual(tags, lastRow.tags)
-				if eq {
-					// We can merge
-					for k, v := range kv {
-						lastRow.fields[k] = v
-					}
-				} else {
-					// Could not merge as tags are different
-					rw, err := newRow(tags, kv)
-					if err != nil {
-						jLog(jctx, fmt.Sprintf("addIDB: Could not get NewRow (no merge): %v", err))
-						continue
-					}
-					rows = append(rows, rw)
-				}
-			} else {
-				// First row for this sensor
-				rw, err := newRow(tags, kv)
-				if err != nil {
-					jLog(jctx, fmt.Sprintf("addIDB: Could not get NewRow (first row): %v", err))
-					continue
-				}
-				rows = append(rows, rw)
+		// All leaves of the same list entry end up in one row, they do not
+		// have to be consecutive
+		rowKey := seriesKey(&point{Tags: tags}, "")
+		if rw, ok := scratch.index[rowKey]; ok {
+			for k, v := range kv {
+				rw.fields[k] = v
 			}
+			putFields(kv)
+			continue
+		}
+		rw, err := newRow(tags, kv)
+		if err != nil {
+			jLogError(jctx, "", "addIDB: Could not get NewRow", err)
+			putFields(kv)
+			continue
 		}
+		scratch.index[rowKey] = rw
+		scratch.rows = append(scratch.rows, rw)
 	}
-	if len(rows) > 0 {
-		for _, row := range rows {
-			pt, err := client.NewPoint(mName(ocData, jctx.config), row.tags, row.fields, rtime)
-			if err != nil {
-				jLog(jctx, fmt.Sprintf("addIDB: Could not get NewPoint : %v", err))
-				continue
-			}
-			points = append(points, pt)
+	if len(scratch.rows) == 0 {
+		return nil
+	}
+	rowPoints := make([]*point, 0, len(scratch.rows))
+	measurement := mName(ocData, jctx.config)
+	var dtime time.Time
+	if ocData.Timestamp != 0 {
+		dtime = time.Unix(0, int64(ocData.Timestamp)*int64(time.Millisecond))
+	}
+	for _, row := range scratch.rows {
+		ts := pointTime(jctx.config.Timestamp, rtime, dtime, row.fields)
+		rowPoints = append(rowPoints, newPoint(measurement, row.tags, row.fields, ts))
+	}
+	return rowPoints
+}
+
+// exportIDB writes the transformed points of one telemetry packet to the
+// sinks and InfluxDB, measurement is the one of the packet
+func exportIDB(jctx *JCtx, measurement string, rowPoints []*point) {
+	tailPoints(jctx, rowPoints)
+	keepRecent(jctx, rowPoints)
+	if jctx.routes != nil {
+		rowPoints = jctx.routes.route(jctx, measurement, rowPoints)
+	}
+	if len(jctx.sinks) != 0 {
+		writeSinks(jctx, rowPoints)
+	}
+	writeInflux(jctx, measurement, rowPoints)
+}
+
+// writeInflux queues the points for InfluxDB, measurement is the one of
+// their packet
+func writeInflux(jctx *JCtx, measurement string, rowPoints []*point) {
+	if jctx.influxCtx.influxClient == nil {
+		return
+	}
+
+	points := make([]*client.Point, 0, len(rowPoints))
+	for _, p := range rowPoints {
+		pt, err := client.NewPoint(p.Measurement, p.Tags, p.Fields, influxTime(jctx, p.Timestamp))
+		if err != nil {
+			jLogError(jctx, "", "addIDB: Could not get NewPoint", err)
+			continue
 		}
+		points = append(points, pt)
 	}
 
 	if len(points) > 0 {
+		policy := backpressurePolicy(jctx)
+		var dropped uint64
 		if jctx.config.Influx.WritePerMeasurement {
-			jctx.influxCtx.batchWMCh <- &batchWMData{
-				measurement: mName(ocData, jctx.config),
-				points:      points,
-			}
+			ch, d := jctx.influxCtx.batchWMCh, &batchWMData{measurement: measurement, points: points}
+			dropped = enqueue(policy, func() bool {
+				select {
+				case ch <- d:
+					return true
+				default:
+					return false
+				}
+			}, func() {
+				ch <- d
+			}, func() bool {
+				select {
+				case <-ch:
+					return true
+				default:
+					return false
+				}
+			})
 		} else {
-			jctx.influxCtx.batchWCh <- points
+			ch := jctx.influxCtx.batchWCh
+			dropped = enqueue(policy, func() bool {
+				select {
+				case ch <- points:
+					return true
+				default:
+					return false
+				}
+			}, func() {
+				ch <- points
+			}, func() bool {
+				select {
+				case <-ch:
+					return true
+				default:
+					return false
+				}
+			})
 		}
+		jctx.drops.add("influx/batch", dropped)
 
 		if IsVerboseLogging(jctx) {
-			jLog(jctx, fmt.Sprintf("Sending %d points to batch channel for path: %s\n", len(points), ocData.Path))
+			jLogDebug(jctx, fmt.Sprintf("Sending %d points to batch channel for path: %s\n", len(points), measurement))
 			for i := 0; i < len(points); i++ {
-				jLog(jctx, fmt.Sprintf("Tags: %+v\n", points[i].Tags()))
+				jLogDebug(jctx, fmt.Sprintf("Tags: %+v\n", points[i].Tags()))
 				if f, err := points[i].Fields(); err == nil {
-					jLog(jctx, fmt.Sprintf("KVs : %+v\n", f))
+					jLogDebug(jctx, fmt.Sprintf("KVs : %+v\n", f))
 				}
 			}
 		}
 	}
 }
 
+// influxEndpoints returns the primary InfluxDB server followed by the mirrors
+func influxEndpoints(cfg Config) []InfluxEndpoint {
+	if cfg.Influx.Server == "" {
+		return nil
+	}
+	primary := InfluxEndpoint{
+		Server:   cfg.Influx.Server,
+		Port:     cfg.Influx.Port,
+		User:     cfg.Influx.User,
+		Password: cfg.Influx.Password,
+	}
+	return append([]InfluxEndpoint{primary}, cfg.Influx.Mirrors...)
+}
+
 func getInfluxClient(cfg Config, timeout time.Duration) *client.Client {
 	if cfg.Influx.Server == "" {
 		return nil
 	}
-	addr := fmt.Sprintf("http://%v:%v", cfg.Influx.Server, cfg.Influx.Port)
+	return getInfluxEndpointClient(influxEndpoints(cfg)[0], timeout)
+}
+
+func getInfluxEndpointClient(e InfluxEndpoint, timeout time.Duration) *client.Client {
+	addr := fmt.Sprintf("http://%v:%v", e.Server, e.Port)
 	c, err := client.NewHTTPClient(client.HTTPConfig{
 		Addr:     addr,
-		Username: cfg.Influx.User,
-		Password: cfg.Influx.Password,
+		Username: e.User,
+		Password: e.Password,
 		Timeout:  timeout,
 	})
 
@@ -557,6 +715,106 @@ func getInfluxClient(cfg Config, timeout time.Duration) *client.Client {
 	return &c
 }
 
+// influxWrite hands the batch over to the writer of every InfluxDB server,
+// a batch is dropped for a server whose queue is full
+func influxWrite(jctx *JCtx, bp client.BatchPoints) {
+	dropOldest := backpressurePolicy(jctx) == BackpressureDropOldest
+	for _, w := range jctx.influxCtx.writers {
+		var dropped uint64
+		if w.shared != nil {
+			dropped = w.shared.queue(bp, dropOldest)
+		} else {
+			policy := BackpressureDropNewest
+			if dropOldest {
+				policy = BackpressureDropOldest
+			}
+			dropped = enqueue(policy, func() bool {
+				select {
+				case w.ch <- bp:
+					return true
+				default:
+					return false
+				}
+			}, nil, func() bool {
+				select {
+				case <-w.ch:
+					return true
+				default:
+					return false
+				}
+			})
+		}
+		if dropped != 0 {
+			jLogWarn(jctx, fmt.Sprintf("Batch DB write queue of %s is full, dropped %d batches", w.addr, dropped))
+			jctx.drops.add("influx/"+w.addr, dropped)
+		}
+	}
+}
+
+// influxWriteRetry writes the batch, it retries while the server is
+// unreachable and marks it failing meanwhile. The queue buffers the next
+// batches meanwhile. Rejected batch is not retried.
+func influxWriteRetry(c client.Client, addr string, bp client.BatchPoints, retry time.Duration, failing *int32,
+	logf func(level, msg string)) {
+	for {
+		err := c.Write(bp)
+		if _, ok := err.(net.Error); ok {
+			setFailing(failing, err)
+		} else {
+			setFailing(failing, nil)
+		}
+		if err == nil {
+			logf(LogLevelDebug, fmt.Sprintf("Batch write to %s successful! Number of points: %d", addr, len(bp.Points())))
+			return
+		}
+		if _, ok := err.(net.Error); !ok {
+			logf(LogLevelError, fmt.Sprintf("Batch DB write to %s failed: %v", addr, err))
+			return
+		}
+		logf(LogLevelWarn, fmt.Sprintf("Batch DB write to %s failed, retry in %v: %v", addr, retry, err))
+		time.Sleep(retry)
+	}
+}
+
+func (w *influxWriter) run(jctx *JCtx, retry time.Duration) {
+	logf := func(level, msg string) { jLogEntry(jctx, level, "", msg, nil) }
+	go func() {
+		for bp := range w.ch {
+			if bp == nil {
+				select {
+				case w.flushed <- struct{}{}:
+				default:
+				}
+				continue
+			}
+			start := time.Now()
+			influxWriteRetry(w.c, w.addr, bp, retry, &w.timer.failing, logf)
+			w.timer.observe(start)
+		}
+	}()
+}
+
+// flush waits until the batches queued so far are written, it gives up at
+// the deadline
+func (w *influxWriter) flush(deadline time.Time) bool {
+	if w.shared != nil {
+		return w.shared.flush(deadline)
+	}
+	t := time.NewTimer(time.Until(deadline))
+	defer t.Stop()
+	select {
+	case w.ch <- nil:
+	case <-t.C:
+		return false
+	}
+	select {
+	case <-w.flushed:
+		return true
+	case <-t.C:
+		return false
+	}
+}
+
 func queryIDB(clnt client.Client, cmd string, db string) (res []client.Result, err error) {
 	q := client.Query{
 		Command:  cmd,
@@ -583,17 +841,19 @@ func influxInit(jctx *JCtx) {
 
 	c := getInfluxClient(cfg, time.Duration(10*cfg.Influx.HTTPTimeout)*time.Second) // high timeout for init
 
-	if cfg.Influx.Server != "" && c != nil {
+	for _, e := range influxEndpoints(cfg) {
+		c := getInfluxEndpointClient(e, time.Duration(10*cfg.Influx.HTTPTimeout)*time.Second)
 		if cfg.Influx.Recreate {
 			_, err := queryIDB(*c, fmt.Sprintf("DROP DATABASE \"%s\"", cfg.Influx.Dbname), cfg.Influx.Dbname)
 			if err != nil {
-				log.Printf("influxInit failed to drop table %v\n", err)
+				log.Printf("influxInit failed to drop table on %s: %v\n", e.Server, err)
 			}
 		}
 		_, err := queryIDB(*c, fmt.Sprintf("CREATE DATABASE \"%s\"", cfg.Influx.Dbname), cfg.Influx.Dbname)
 		if err != nil {
-			log.Printf("influxInit failed to create database: %v\n", err)
+			log.Printf("influxInit failed to create database on %s: %v\n", e.Server, err)
 		}
+		closeInfluxClient(*c)
 	}
 
 	jLog(jctx, "invoking getInfluxClient")
@@ -601,6 +861,18 @@ func influxInit(jctx *JCtx) {
 	jctx.influxCtx.reXpath = regexp.MustCompile(MatchExpressionXpath)
 	jctx.influxCtx.reKey = regexp.MustCompile(MatchExpressionKey)
 	if cfg.Influx.Server != "" && c != nil {
+		for _, e := range influxEndpoints(cfg) {
+			w := &influxWriter{addr: fmt.Sprintf("%v:%v", e.Server, e.Port)}
+			jctx.influxCtx.writers = append(jctx.influxCtx.writers, w)
+			if cfg.Influx.Shared {
+				w.shared = getSharedInfluxWriter(e, cfg.Influx, influxBatchPointsConfig(jctx))
+				continue
+			}
+			w.c = *getInfluxEndpointClient(e, time.Duration(cfg.Influx.HTTPTimeout)*time.Second)
+			w.ch = make(chan client.BatchPoints, cfg.Influx.QueueSize)
+			w.flushed = make(chan struct{}, 1)
+			w.run(jctx, time.Duration(cfg.Influx.RetryInterval)*time.Millisecond)
+		}
 		if cfg.Influx.WritePerMeasurement {
 			dbBatchWriteM(jctx)
 		} else {
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb/client/v2"
+)
+
+// sharedInfluxWriter writes the batches of all workers with influx shared
+// set which write to the same server, database, retention policy and
+// precision. Batches queued while a write is in flight are merged into one
+// write of at most batch size points, so many devices flushing at the same
+// time end up in a few requests over one connection pool.
+type sharedInfluxWriter struct {
+	sync.Mutex
+	cond      *sync.Cond
+	addr      string
+	c         client.Client
+	bpc       client.BatchPointsConfig
+	pending   []client.BatchPoints
+	writing   bool
+	limit     int
+	batchSize int
+	failing   int32
+}
+
+var sharedInfluxWriters = struct {
+	sync.Mutex
+	m map[string]*sharedInfluxWriter
+}{m: map[string]*sharedInfluxWriter{}}
+
+// getSharedInfluxWriter returns the shared writer of the server, it is
+// created on first use. Every worker adds its queue size to the number of
+// batches the writer buffers.
+func getSharedInfluxWriter(e InfluxEndpoint, cfg InfluxConfig, bpc client.BatchPointsConfig) *sharedInfluxWriter {
+	key := fmt.Sprintf("%s:%d/%s/%s/%s/%s", e.Server, e.Port, e.User, bpc.Database, bpc.RetentionPolicy, bpc.Precision)
+
+	sharedInfluxWriters.Lock()
+	defer sharedInfluxWriters.Unlock()
+
+	w, ok := sharedInfluxWriters.m[key]
+	if !ok {
+		w = &sharedInfluxWriter{
+			addr: fmt.Sprintf("%v:%v", e.Server, e.Port),
+			c:    *getInfluxEndpointClient(e, time.Duration(cfg.HTTPTimeout)*time.Second),
+			bpc:  bpc,
+		}
+		w.cond = sync.NewCond(w)
+		sharedInfluxWriters.m[key] = w
+		go w.run(time.Duration(cfg.RetryInterval) * time.Millisecond)
+	}
+
+	w.Lock()
+	w.limit += cfg.QueueSize
+	if cfg.BatchSize > w.batchSize {
+		w.batchSize = cfg.BatchSize
+	}
+	w.Unlock()
+	return w
+}
+
+// queue adds the batch, if the queue is full the batch or, with
+// dropOldest, the oldest queued batch is dropped. It returns the number of
+// dropped batches.
+func (w *sharedInfluxWriter) queue(bp client.BatchPoints, dropOldest bool) uint64 {
+	w.Lock()
+	defer w.Unlock()
+	if len(w.pending) >= w.limit {
+		if !dropOldest || w.limit == 0 {
+			return 1
+		}
+		w.pending = append(w.pending[1:], bp)
+		return 1
+	}
+	w.pending = append(w.pending, bp)
+	w.cond.Broadcast()
+	return 0
+}
+
+// merge turns the batches into as few batches of at most batch size points
+// as possible
+func (w *sharedInfluxWriter) merge(pending []client.BatchPoints) []client.BatchPoints {
+	var merged []client.BatchPoints
+	var cur client.BatchPoints
+	for _, bp := range pending {
+		for _, p := range bp.Points() {
+			if cur == nil || len(cur.Points()) >= w.batchSize {
+				var err error
+				if cur, err = client.NewBatchPoints(w.bpc); err != nil {
+					log.Printf("NewBatchPoints failed, error: %v\n", err)
+					return merged
+				}
+				merged = append(merged, cur)
+			}
+			cur.AddPoint(p)
+		}
+	}
+	return merged
+}
+
+func (w *sharedInfluxWriter) run(retry time.Duration) {
+	logf := globalLog
+	for {
+		w.Lock()
+		for len(w.pending) == 0 {
+			w.cond.Wait()
+		}
+		pending := w.pending
+		w.pending = nil
+		w.writing = true
+		w.Unlock()
+
+		for _, bp := range w.merge(pending) {
+			influxWriteRetry(w.c, w.addr, bp, retry, &w.failing, logf)
+		}
+		w.Lock()
+		w.writing = false
+		w.cond.Broadcast()
+		w.Unlock()
+	}
+}
+
+// flush waits until the batches queued so far are written, it gives up at
+// the deadline
+func (w *sharedInfluxWriter) flush(deadline time.Time) bool {
+	done := make(chan struct{})
+	go func() {
+		w.Lock()
+		for len(w.pending) != 0 || w.writing {
+			w.cond.Wait()
+		}
+		w.Unlock()
+		close(done)
+	}()
+	t := time.NewTimer(time.Until(deadline))
+	defer t.Stop()
+	select {
+	case <-done:
+		return true
+	case <-t.C:
+		return false
+	}
+}
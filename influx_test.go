@@ -1,9 +1,21 @@
 package main
 
 import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	client "github.com/influxdata/influxdb/client/v2"
+	na_pb "github.com/nileshsimaria/jtimon/telemetry"
 )
 
 func TestSpitTagsNPath(t *testing.T) {
@@ -157,3 +169,279 @@ func TestSubscriptionPathFromPath(t *testing.T) {
 	}
 
 }
+
+func TestValidateInfluxConfig(t *testing.T) {
+	for _, cfg := range []InfluxConfig{{QueueSize: -1}, {SelfInterval: -1}} {
+		if err := validateInfluxConfig(cfg); err == nil {
+			t.Errorf("%+v: want error, got nil", cfg)
+		}
+	}
+	if err := validateInfluxConfig(InfluxConfig{QueueSize: 8}); err != nil {
+		t.Errorf("queue-size 8: %v", err)
+	}
+}
+
+func TestInfluxPrecision(t *testing.T) {
+	ts := time.Unix(1, 1999999)
+
+	tests := []struct {
+		name      string
+		precision string
+		rounding  string
+		want      time.Time
+		error     bool
+	}{
+		{"default", "", "", ts, false},
+		{"ms-truncate", "ms", "truncate", ts, false},
+		{"ms-round", "ms", "round", time.Unix(1, 2000000), false},
+		{"s-round", "s", "round", time.Unix(1, 0), false},
+		{"bad-precision", "m", "", ts, true},
+		{"bad-rounding", "ms", "ceil", ts, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jctx := &JCtx{}
+			jctx.config.Influx.Precision = test.precision
+			jctx.config.Influx.TimestampRounding = test.rounding
+
+			err := validateInfluxConfig(jctx.config.Influx)
+			if test.error {
+				if err == nil {
+					t.Errorf("want error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateInfluxConfig failed: %v", err)
+			}
+			if got := influxTime(jctx, ts); !got.Equal(test.want) {
+				t.Errorf("influxTime: want %v, got %v", test.want, got)
+			}
+			want := test.precision
+			if want == "" {
+				want = DefaultIDBPrecision
+			}
+			if got := influxBatchPointsConfig(jctx).Precision; got != want {
+				t.Errorf("precision: want %s, got %s", want, got)
+			}
+		})
+	}
+}
+
+func TestInfluxMirrors(t *testing.T) {
+	var mu sync.Mutex
+	writes := map[string]int{}
+
+	newServer := func(name string) (*httptest.Server, InfluxEndpoint) {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/write" {
+				mu.Lock()
+				writes[name]++
+				mu.Unlock()
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			w.Write([]byte(`{"results":[{}]}`))
+		}))
+		u, _ := url.Parse(s.URL)
+		host, port, _ := net.SplitHostPort(u.Host)
+		p, _ := strconv.Atoi(port)
+		return s, InfluxEndpoint{Server: host, Port: p}
+	}
+	primary, pe := newServer("primary")
+	defer primary.Close()
+	mirror, me := newServer("mirror")
+	defer mirror.Close()
+
+	// nobody listens here, it must not hold up the other servers
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	down := InfluxEndpoint{Server: "127.0.0.1", Port: l.Addr().(*net.TCPAddr).Port}
+	l.Close()
+
+	jctx := &JCtx{}
+	jctx.config.Influx = InfluxConfig{
+		Server:      pe.Server,
+		Port:        pe.Port,
+		Dbname:      "db",
+		Mirrors:     []InfluxEndpoint{me, down},
+		HTTPTimeout: 1,
+	}
+	fillupDefaults(&jctx.config)
+	influxInit(jctx)
+
+	if len(jctx.influxCtx.writers) != 3 {
+		t.Fatalf("want 3 writers, got %d", len(jctx.influxCtx.writers))
+	}
+
+	bp, _ := client.NewBatchPoints(influxBatchPointsConfig(jctx))
+	pt, _ := client.NewPoint("m", map[string]string{"device": "r1"}, map[string]interface{}{"/a": 1.0}, time.Unix(1, 0))
+	bp.AddPoint(pt)
+	for i := 0; i < 2; i++ {
+		influxWrite(jctx, bp)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		done := writes["primary"] == 2 && writes["mirror"] == 2 && len(jctx.influxCtx.writers[2].ch) == 1
+		mu.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if writes["primary"] != 2 || writes["mirror"] != 2 {
+		t.Errorf("want 2 writes on every reachable server, got %v", writes)
+	}
+	// the first batch is being retried, the second one is waiting in the queue
+	if n := len(jctx.influxCtx.writers[2].ch); n != 1 {
+		t.Errorf("want 1 queued batch for unreachable server, got %d", n)
+	}
+}
+
+func TestAddIDBRowMerge(t *testing.T) {
+	jctx := &JCtx{
+		config: Config{Host: "r1"},
+		influxCtx: InfluxCtx{
+			reXpath: regexp.MustCompile(MatchExpressionXpath),
+			reKey:   regexp.MustCompile(MatchExpressionKey),
+		},
+		sinks: []*sinkCtx{{name: "test", ch: make(chan *point, 10)}},
+	}
+	kv := func(key string, v uint64) *na_pb.KeyValue {
+		return &na_pb.KeyValue{Key: key, Value: &na_pb.KeyValue_UintValue{UintValue: v}}
+	}
+	ocData := &na_pb.OpenConfigData{
+		Path: "sensor_1:/interfaces/:/interfaces/:mib2d",
+		Kv: []*na_pb.KeyValue{
+			{Key: "__prefix__", Value: &na_pb.KeyValue_StrValue{StrValue: "/interfaces/"}},
+			kv("interface[name='ge-0/0/0']/state/counters/in-octets", 1),
+			kv("interface[name='ge-0/0/1']/state/counters/in-octets", 2),
+			kv("interface[name='ge-0/0/0']/state/counters/out-octets", 3),
+			kv("interface[name='ge-0/0/1']/state/counters/out-octets", 4),
+		},
+	}
+	addIDB(ocData, jctx, time.Now(), nil)
+	close(jctx.sinks[0].ch)
+
+	var got []map[string]interface{}
+	for p := range jctx.sinks[0].ch {
+		got = append(got, p.Fields)
+	}
+	want := []map[string]interface{}{
+		{
+			"/interfaces/interface/state/counters/in-octets":  float64(1),
+			"/interfaces/interface/state/counters/out-octets": float64(3),
+		},
+		{
+			"/interfaces/interface/state/counters/in-octets":  float64(2),
+			"/interfaces/interface/state/counters/out-octets": float64(4),
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func BenchmarkDecodeIDB(b *testing.B) {
+	jctx := &JCtx{
+		config: Config{Host: "r1"},
+		influxCtx: InfluxCtx{
+			reXpath: regexp.MustCompile(MatchExpressionXpath),
+			reKey:   regexp.MustCompile(MatchExpressionKey),
+		},
+		sinks: []*sinkCtx{{name: "test"}},
+	}
+	ocData := &na_pb.OpenConfigData{
+		Path: "sensor_1:/interfaces/:/interfaces/:mib2d",
+		Kv:   []*na_pb.KeyValue{{Key: "__prefix__", Value: &na_pb.KeyValue_StrValue{StrValue: "/interfaces/"}}},
+	}
+	for i := 0; i < 32; i++ {
+		for _, leaf := range []string{"in-octets", "out-octets", "in-pkts", "out-pkts"} {
+			ocData.Kv = append(ocData.Kv, &na_pb.KeyValue{
+				Key:   "interface[name='ge-0/0/" + strconv.Itoa(i) + "']/state/counters/" + leaf,
+				Value: &na_pb.KeyValue_UintValue{UintValue: uint64(i)},
+			})
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		decodeIDB(ocData, jctx, time.Now())
+	}
+}
+
+func TestInfluxShared(t *testing.T) {
+	var mu sync.Mutex
+	var writes, points int
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/write" {
+			b, _ := ioutil.ReadAll(r.Body)
+			mu.Lock()
+			writes++
+			points += strings.Count(string(b), "\n")
+			first := writes == 1
+			mu.Unlock()
+			if first {
+				started <- struct{}{}
+				<-release
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write([]byte(`{"results":[{}]}`))
+	}))
+	defer s.Close()
+	u, _ := url.Parse(s.URL)
+	host, port, _ := net.SplitHostPort(u.Host)
+	p, _ := strconv.Atoi(port)
+
+	var jctxs []*JCtx
+	for _, device := range []string{"r1", "r2"} {
+		jctx := &JCtx{}
+		jctx.config.Host = device
+		jctx.config.Influx = InfluxConfig{Server: host, Port: p, Dbname: "shared", HTTPTimeout: 1, Shared: true}
+		fillupDefaults(&jctx.config)
+		influxInit(jctx)
+		jctxs = append(jctxs, jctx)
+	}
+	if jctxs[0].influxCtx.writers[0].shared != jctxs[1].influxCtx.writers[0].shared {
+		t.Fatalf("workers do not share the writer")
+	}
+
+	write := func(jctx *JCtx) {
+		bp, _ := client.NewBatchPoints(influxBatchPointsConfig(jctx))
+		pt, _ := client.NewPoint("m", map[string]string{"device": jctx.config.Host}, map[string]interface{}{"/a": 1.0}, time.Unix(1, 0))
+		bp.AddPoint(pt)
+		influxWrite(jctx, bp)
+	}
+	write(jctxs[0])
+	<-started
+	// queued while the first write is in flight, they are merged
+	write(jctxs[0])
+	write(jctxs[1])
+	write(jctxs[1])
+	close(release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		done := points == 4
+		mu.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if writes != 2 || points != 4 {
+		t.Errorf("want 4 points in 2 writes, got %d points in %d writes", points, writes)
+	}
+}
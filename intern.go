@@ -0,0 +1,46 @@
+package main
+
+import (
+	"sync"
+)
+
+// The paths, keys and key values of the decoded telemetry repeat with every
+// packet. Interning them lets the points, batches and transform state share
+// one copy of each string instead of holding a copy per packet.
+const (
+	internShards = 32
+	// internShardSize bounds the table, a full shard is emptied
+	internShardSize = 1 << 15
+)
+
+type internShard struct {
+	sync.Mutex
+	m map[string]string
+}
+
+var internTable [internShards]internShard
+
+// intern returns the interned copy of s
+func intern(s string) string {
+	if s == "" {
+		return s
+	}
+	// FNV-1a, inline to not allocate
+	h := uint32(2166136261)
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= 16777619
+	}
+	sh := &internTable[h%internShards]
+
+	sh.Lock()
+	defer sh.Unlock()
+	if is, ok := sh.m[s]; ok {
+		return is
+	}
+	if sh.m == nil || len(sh.m) >= internShardSize {
+		sh.m = make(map[string]string, 1024)
+	}
+	sh.m[s] = s
+	return s
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func stringData(s string) uintptr {
+	return (*reflect.StringHeader)(unsafe.Pointer(&s)).Data
+}
+
+func TestIntern(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"path", "/interfaces/interface/state/counters/in-octets", "/interfaces/interface/state/counters/in-octets"},
+		{"key", "/interfaces/interface/@name", "/interfaces/interface/@name"},
+		{"value", "ge-0/0/0", "ge-0/0/0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// build the strings at run time so they don't share memory
+			a := strings.Join([]string{test.a}, "")
+			b := string([]byte(test.b))
+			if stringData(a) == stringData(b) {
+				t.Fatalf("test strings share memory")
+			}
+			ia, ib := intern(a), intern(b)
+			if ia != test.a || ib != test.b {
+				t.Errorf("got %q %q, want %q %q", ia, ib, test.a, test.b)
+			}
+			if stringData(ia) != stringData(ib) {
+				t.Errorf("interned copies of %q differ", test.a)
+			}
+		})
+	}
+	if intern("") != "" {
+		t.Errorf("empty string not interned as empty")
+	}
+}
+
+func TestInternBounded(t *testing.T) {
+	for i := 0; i < 2*internShards*internShardSize; i++ {
+		intern(fmt.Sprintf("/path/%d", i))
+	}
+	for i := range internTable {
+		sh := &internTable[i]
+		sh.Lock()
+		n := len(sh.m)
+		sh.Unlock()
+		if n > internShardSize {
+			t.Errorf("shard %d holds %d strings, want at most %d", i, n, internShardSize)
+		}
+	}
+}
+
+func BenchmarkIntern(b *testing.B) {
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("/interfaces/interface[name='ge-0/0/%d']/state/counters/in-octets", i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		intern(keys[i%len(keys)])
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// workerMetrics are the internal counters and the connection state of a
+// worker, accessed atomically
+type workerMetrics struct {
+	packets    uint64
+	points     uint64
+	decodeErrs uint64
+	reconnects uint64
+	lastData   int64
+	connected  int32
+	// connectedAt is the time of the last connect
+	connectedAt int64
+	// attempted is set once the worker dialed the device
+	attempted int32
+	// address is the index of the address of the device connected to
+	address int32
+}
+
+// writeTimer counts the writes of a sink and the time they took, and
+// whether the last write failed, accessed atomically
+type writeTimer struct {
+	writes  uint64
+	nanos   uint64
+	failing int32
+}
+
+// pointsExported counts the n points of a packet received at rtime handed
+// to the sinks and InfluxDB
+func pointsExported(jctx *JCtx, n int, rtime time.Time) {
+	atomic.AddUint64(&jctx.metrics.points, uint64(n))
+	jctx.self.exported(n, rtime)
+}
+
+func (t *writeTimer) observe(start time.Time) {
+	atomic.AddUint64(&t.writes, 1)
+	atomic.AddUint64(&t.nanos, uint64(time.Since(start)))
+}
+
+// setFailing records whether the last write failed
+func setFailing(failing *int32, err error) {
+	var f int32
+	if err != nil {
+		f = 1
+	}
+	atomic.StoreInt32(failing, f)
+}
+
+var (
+	packetsDesc = prometheus.NewDesc("jtimon_received_packets_total",
+		"Telemetry packets received from the device", []string{"device"}, nil)
+	decodeErrsDesc = prometheus.NewDesc("jtimon_decode_errors_total",
+		"Telemetry packets or values which could not be decoded", []string{"device"}, nil)
+	quarantinedDesc = prometheus.NewDesc("jtimon_undecodable_messages_total",
+		"Telemetry packets which could not be decoded, per sensor, quarantined to --quarantine-dir", []string{"device", "sensor"}, nil)
+	sinkWritesDesc = prometheus.NewDesc("jtimon_sink_writes_total",
+		"Batches written to the sink", []string{"device", "sink"}, nil)
+	sinkSecondsDesc = prometheus.NewDesc("jtimon_sink_write_seconds_total",
+		"Time spent writing batches to the sink", []string{"device", "sink"}, nil)
+	queueLenDesc = prometheus.NewDesc("jtimon_queue_length",
+		"Updates, points or batches waiting in the internal queue", []string{"device", "queue"}, nil)
+	queueCapDesc = prometheus.NewDesc("jtimon_queue_capacity",
+		"Capacity of the internal queue", []string{"device", "queue"}, nil)
+	latencyDesc = prometheus.NewDesc("jtimon_latency_seconds",
+		"Time from the timestamp of the telemetry packets to their receipt", []string{"device", "path"}, nil)
+	payloadDesc = prometheus.NewDesc("jtimon_payload_bytes",
+		"Size of the telemetry packets, quantile 0 is the smallest and 1 the largest", []string{"device", "path"}, nil)
+	seqGapsDesc = prometheus.NewDesc("jtimon_sequence_gaps_total",
+		"Gaps in the sequence numbers of the telemetry packets", []string{"device", "sensor", "component"}, nil)
+	seqLostDesc = prometheus.NewDesc("jtimon_sequence_lost_total",
+		"Telemetry packets missing in the gaps of the sequence numbers", []string{"device", "sensor", "component"}, nil)
+	wireBytesDesc = prometheus.NewDesc("jtimon_grpc_wire_bytes_total",
+		"Bytes of the gRPC connections on the wire (TCP)", []string{"device", "direction"}, nil)
+	streamResetsDesc = prometheus.NewDesc("jtimon_grpc_stream_errors_total",
+		"gRPC streams which ended with an error", []string{"device"}, nil)
+	windowDesc = prometheus.NewDesc("jtimon_grpc_window_bytes",
+		"Initial flow control window of the gRPC connection, unless gRPC sizes it", []string{"device"}, nil)
+	tcpRTTDesc = prometheus.NewDesc("jtimon_tcp_rtt_seconds",
+		"Smoothed round trip time of the connection to the device", []string{"device"}, nil)
+	rttDesc = prometheus.NewDesc("jtimon_device_rtt_seconds",
+		"Round trip time of the last probe of the device (rtt)", []string{"device"}, nil)
+	tcpRetransDesc = prometheus.NewDesc("jtimon_tcp_retransmits_total",
+		"TCP segments retransmitted on the connection to the device", []string{"device"}, nil)
+	staleDesc = prometheus.NewDesc("jtimon_device_stale",
+		"1 while the device is connected but sent no data for the stale window", []string{"device"}, nil)
+	seqLastGapDesc = prometheus.NewDesc("jtimon_sequence_last_gap_timestamp_seconds",
+		"Time of the last gap in the sequence numbers", []string{"device", "sensor", "component"}, nil)
+	haLeaderDesc = prometheus.NewDesc("jtimon_ha_leader",
+		"1 while the instance holds the lock of --ha and collects, 0 while it is the standby", nil, nil)
+	clusterMembersDesc = prometheus.NewDesc("jtimon_cluster_members",
+		"Members of --cluster sharing the devices, 0 while the instance is not one", nil, nil)
+)
+
+// internalCollector exports the internal counters of the workers
+type internalCollector struct{}
+
+// Describe implements prometheus.Collector
+func (internalCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- packetsDesc
+	ch <- decodeErrsDesc
+	ch <- quarantinedDesc
+	ch <- sinkWritesDesc
+	ch <- sinkSecondsDesc
+	ch <- queueLenDesc
+	ch <- queueCapDesc
+	ch <- latencyDesc
+	ch <- payloadDesc
+	ch <- seqGapsDesc
+	ch <- seqLostDesc
+	ch <- seqLastGapDesc
+	ch <- staleDesc
+	ch <- wireBytesDesc
+	ch <- streamResetsDesc
+	ch <- windowDesc
+	ch <- tcpRTTDesc
+	ch <- rttDesc
+	ch <- tcpRetransDesc
+	ch <- haLeaderDesc
+	ch <- clusterMembersDesc
+}
+
+// Collect implements prometheus.Collector
+func (internalCollector) Collect(ch chan<- prometheus.Metric) {
+	counter := func(desc *prometheus.Desc, v float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, v, labels...)
+	}
+	queue := func(device, name string, length, capacity int) {
+		ch <- prometheus.MustNewConstMetric(queueLenDesc, prometheus.GaugeValue, float64(length), device, name)
+		ch <- prometheus.MustNewConstMetric(queueCapDesc, prometheus.GaugeValue, float64(capacity), device, name)
+	}
+	timer := func(device, sink string, t *writeTimer) {
+		counter(sinkWritesDesc, float64(atomic.LoadUint64(&t.writes)), device, sink)
+		counter(sinkSecondsDesc, time.Duration(atomic.LoadUint64(&t.nanos)).Seconds(), device, sink)
+	}
+	latency := func(device, path string, h *latencyHistogram) {
+		count, sum, counts := h.snapshot()
+		if count == 0 {
+			return
+		}
+		quantiles := map[float64]float64{}
+		ps := []float64{50, 95, 99}
+		for i, d := range histPercentiles(counts, ps...) {
+			quantiles[ps[i]/100] = d.Seconds()
+		}
+		ch <- prometheus.MustNewConstSummary(latencyDesc, count, sum.Seconds(), quantiles, device, path)
+	}
+
+	if *haLock != "" {
+		leader := 1.0
+		if ha.standby() != nil {
+			leader = 0
+		}
+		ch <- prometheus.MustNewConstMetric(haLeaderDesc, prometheus.GaugeValue, leader)
+	}
+	if *clusterStore != "" {
+		ch <- prometheus.MustNewConstMetric(clusterMembersDesc, prometheus.GaugeValue, float64(len(cluster.members())))
+	}
+
+	metricWorkers.Lock()
+	defer metricWorkers.Unlock()
+	for jctx := range metricWorkers.m {
+		device := jctx.config.Host
+		counter(packetsDesc, float64(atomic.LoadUint64(&jctx.metrics.packets)), device)
+		counter(decodeErrsDesc, float64(atomic.LoadUint64(&jctx.metrics.decodeErrs)), device)
+		sensors, counts := jctx.quarantine.counts()
+		for i, s := range sensors {
+			counter(quarantinedDesc, float64(counts[i]), device, s)
+		}
+		t := &jctx.transport
+		counter(wireBytesDesc, float64(atomic.LoadUint64(&t.bytesIn)), device, "in")
+		counter(wireBytesDesc, float64(atomic.LoadUint64(&t.bytesOut)), device, "out")
+		counter(streamResetsDesc, float64(atomic.LoadUint64(&t.resets)), device)
+		if w := windowSize(jctx); w != 0 {
+			ch <- prometheus.MustNewConstMetric(windowDesc, prometheus.GaugeValue, float64(w), device)
+		}
+		if info, ok := t.tcpInfo(); ok {
+			ch <- prometheus.MustNewConstMetric(tcpRTTDesc, prometheus.GaugeValue, info.rtt.Seconds(), device)
+			counter(tcpRetransDesc, float64(info.retransmits), device)
+		}
+		if rtt, ok := jctx.rtt.get(); ok {
+			ch <- prometheus.MustNewConstMetric(rttDesc, prometheus.GaugeValue, rtt.Seconds(), device)
+		}
+		if jctx.stale != nil {
+			var stale float64
+			if isStale(jctx) {
+				stale = 1
+			}
+			ch <- prometheus.MustNewConstMetric(staleDesc, prometheus.GaugeValue, stale, device)
+		}
+
+		for _, s := range jctx.sinks {
+			timer(device, s.name, &s.timer)
+		}
+		for _, w := range jctx.influxCtx.writers {
+			if w.shared == nil {
+				timer(device, "influx/"+w.addr, &w.timer)
+			}
+		}
+		workerQueues(jctx, func(name string, length, capacity int) {
+			queue(device, name, length, capacity)
+		})
+		for _, p := range jctx.stats.paths.paths() {
+			c := jctx.stats.paths.counters(p)
+			latency(device, p, &c.latency)
+			if d := c.sizes(); d.packets != 0 {
+				ch <- prometheus.MustNewConstSummary(payloadDesc, d.packets, float64(atomic.LoadUint64(&c.bytes)),
+					map[float64]float64{0: float64(d.min), 0.5: float64(d.p50), 0.99: float64(d.p99), 1: float64(d.max)},
+					device, p)
+			}
+		}
+		jctx.stats.gaps.each(func(k seqKey, g seqGap) {
+			counter(seqGapsDesc, float64(g.gaps), device, k.sensor, k.componentName())
+			counter(seqLostDesc, float64(g.lost), device, k.sensor, k.componentName())
+			ch <- prometheus.MustNewConstMetric(seqLastGapDesc, prometheus.GaugeValue,
+				float64(g.lastTime.UnixNano())/float64(time.Second), device, k.sensor, k.componentName())
+		})
+	}
+}
+
+// workerQueues calls fn with the length and the capacity of each internal
+// queue of the worker
+func workerQueues(jctx *JCtx, fn func(name string, length, capacity int)) {
+	for _, s := range jctx.sinks {
+		fn("sink/"+s.name, len(s.ch), cap(s.ch))
+	}
+	for _, w := range jctx.influxCtx.writers {
+		if w.shared == nil {
+			fn("influx/"+w.addr, len(w.ch), cap(w.ch))
+		}
+	}
+	if c := jctx.influxCtx.batchWCh; c != nil {
+		fn("influx/batch", len(c), cap(c))
+	}
+	if c := jctx.influxCtx.batchWMCh; c != nil {
+		fn("influx/batch", len(c), cap(c))
+	}
+	if jctx.pipeline != nil {
+		for _, s := range jctx.pipeline.stages {
+			fn("pipeline/"+s.name, len(s.ch), cap(s.ch))
+		}
+	}
+}
+
+// internalMetricsInit serves the internal counters of jtimon in Prometheus
+// format on their own port, apart from the telemetry data of --prometheus,
+// the health and event history of the workers, their pause and resume,
+// their running config and a status page of them, and the profiles of
+// --pprof. The Unix socket of
+// --internal-metrics-socket serves them too, without TLS.
+func internalMetricsInit() {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(internalCollector{})
+	reg.MustRegister(prometheus.NewGoCollector())
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", readyzHandler)
+	mux.HandleFunc("/version", versionHandler)
+	// the control endpoints and the health of the devices are guarded, the
+	// metrics and the probes are left open to scrapers and kubelets
+	mux.HandleFunc("/health", apiHandler(healthHandler))
+	mux.HandleFunc("/events", apiHandler(eventsHandler))
+	mux.HandleFunc("/cluster", apiHandler(clusterHandler))
+	mux.HandleFunc("/pause", apiHandler(pauseHandler))
+	mux.HandleFunc("/resume", apiHandler(pauseHandler))
+	mux.HandleFunc("/devices/", apiHandler(devicesHandler))
+	mux.HandleFunc("/logs/", apiHandler(logsHandler))
+	mux.HandleFunc("/debug/vars", apiHandler(varsHandler))
+	if *pProf {
+		pprofHandle(mux, pprofGuard)
+	}
+	mux.HandleFunc("/", apiHandler(statusPageHandler))
+	if *metricsPort != 0 {
+		go func() {
+			srv := &http.Server{Addr: fmt.Sprintf("%s:%d", *metricsHost, *metricsPort), Handler: mux, TLSConfig: apiTLS}
+			if apiTLS != nil {
+				log.Println(srv.ListenAndServeTLS("", ""))
+				return
+			}
+			log.Println(srv.ListenAndServe())
+		}()
+	}
+	if *metricsSocket != "" {
+		lis, err := listenAPISocket(*metricsSocket, apiSocketAccess)
+		if err != nil {
+			log.Printf("Could not start the internal metrics service on %s: %v", *metricsSocket, err)
+			return
+		}
+		go func() {
+			log.Println(http.Serve(lis, mux))
+		}()
+	}
+}
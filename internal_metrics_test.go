@@ -0,0 +1,95 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/client/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestInternalCollector(t *testing.T) {
+	jctx := &JCtx{config: Config{Host: "r1"}}
+	jctx.metrics.packets = 42
+	jctx.metrics.decodeErrs = 2
+	jctx.config.GRPC.WS = 524288
+	jctx.transport.bytesIn = 9000
+	jctx.transport.bytesOut = 300
+	jctx.transport.resets = 1
+	s := &sinkCtx{name: "loki", ch: make(chan *point, 10)}
+	s.ch <- &point{}
+	s.timer.writes = 4
+	s.timer.nanos = uint64(2 * time.Second)
+	jctx.sinks = []*sinkCtx{s}
+	jctx.influxCtx.batchWCh = make(chan []*client.Point, 5)
+	jctx.stats.paths.add("/interfaces/", 10, 500, 20*time.Millisecond, true)
+	jctx.stats.paths.add("/bgp/", 1, 50, 0, false)
+	gap := seqKey{system: "r1", component: 1, sensor: "sensor_1000"}
+	jctx.stats.gaps.check(gap, 1, time.Unix(1583058600, 0))
+	jctx.stats.gaps.check(gap, 4, time.Unix(1583058600, 0))
+
+	dropsInit(jctx)
+	defer dropsStop(jctx)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(internalCollector{})
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			var labels []string
+			for _, l := range m.GetLabel() {
+				labels = append(labels, l.GetName()+"="+l.GetValue())
+			}
+			v := m.GetGauge().GetValue()
+			if m.Counter != nil {
+				v = m.GetCounter().GetValue()
+			}
+			if m.Summary != nil {
+				v = float64(m.GetSummary().GetSampleCount())
+				// one packet per path, all quantiles are its latency or size
+				want := 0.02
+				if f.GetName() == "jtimon_payload_bytes" {
+					want = m.GetSummary().GetSampleSum()
+				}
+				for _, q := range m.GetSummary().GetQuantile() {
+					if d := q.GetValue() - want; d > 0.001 || d < -0.001 {
+						t.Errorf("%s: got quantile %v %v, want %v", f.GetName(), q.GetQuantile(), q.GetValue(), want)
+					}
+				}
+			}
+			got = append(got, f.GetName()+"{"+strings.Join(labels, ",")+"} "+strconv.FormatFloat(v, 'g', -1, 64))
+		}
+	}
+	sort.Strings(got)
+	want := []string{
+		"jtimon_decode_errors_total{device=r1} 2",
+		"jtimon_grpc_stream_errors_total{device=r1} 1",
+		"jtimon_grpc_window_bytes{device=r1} 524288",
+		"jtimon_grpc_wire_bytes_total{device=r1,direction=in} 9000",
+		"jtimon_grpc_wire_bytes_total{device=r1,direction=out} 300",
+		"jtimon_latency_seconds{device=r1,path=/interfaces/} 1",
+		"jtimon_payload_bytes{device=r1,path=/bgp/} 1",
+		"jtimon_payload_bytes{device=r1,path=/interfaces/} 1",
+		"jtimon_queue_capacity{device=r1,queue=influx/batch} 5",
+		"jtimon_queue_capacity{device=r1,queue=sink/loki} 10",
+		"jtimon_queue_length{device=r1,queue=influx/batch} 0",
+		"jtimon_queue_length{device=r1,queue=sink/loki} 1",
+		"jtimon_received_packets_total{device=r1} 42",
+		"jtimon_sequence_gaps_total{component=1/0,device=r1,sensor=sensor_1000} 1",
+		"jtimon_sequence_last_gap_timestamp_seconds{component=1/0,device=r1,sensor=sensor_1000} 1.5830586e+09",
+		"jtimon_sequence_lost_total{component=1/0,device=r1,sensor=sensor_1000} 2",
+		"jtimon_sink_write_seconds_total{device=r1,sink=loki} 2",
+		"jtimon_sink_writes_total{device=r1,sink=loki} 4",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
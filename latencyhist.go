@@ -0,0 +1,107 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// latency histograms count microseconds in buckets of 1/16 of a power of two
+// (HDR style), values below 32us have a bucket each and the error of the
+// percentiles is below 1/32 of the value
+const (
+	histSubBits  = 4
+	histSubCount = 1 << histSubBits
+	histMaxShift = 32
+	histBuckets  = (histMaxShift + 2) * histSubCount
+)
+
+// latencyHistogram is a histogram of latencies, accessed atomically
+type latencyHistogram struct {
+	count   uint64
+	sum     uint64
+	buckets [histBuckets]uint64
+}
+
+func histBucket(us uint64) int {
+	if us < 2*histSubCount {
+		return int(us)
+	}
+	shift := bits.Len64(us) - histSubBits - 1
+	if shift > histMaxShift {
+		return histBuckets - 1
+	}
+	return shift*histSubCount + int(us>>uint(shift))
+}
+
+// histValue is the middle of the values of bucket i in microseconds
+func histValue(i int) float64 {
+	if i < 2*histSubCount {
+		return float64(i)
+	}
+	shift := uint(i/histSubCount - 1)
+	low := uint64(i%histSubCount+histSubCount) << shift
+	return float64(low) + float64(uint64(1)<<shift)/2
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	atomic.AddUint64(&h.buckets[histBucket(uint64(d/time.Microsecond))], 1)
+	atomic.AddUint64(&h.sum, uint64(d))
+	atomic.AddUint64(&h.count, 1)
+}
+
+// snapshot returns the number of latencies, their sum and the counts of the
+// buckets
+func (h *latencyHistogram) snapshot() (uint64, time.Duration, []uint64) {
+	counts := make([]uint64, histBuckets)
+	for i := range counts {
+		counts[i] = atomic.LoadUint64(&h.buckets[i])
+	}
+	return atomic.LoadUint64(&h.count), time.Duration(atomic.LoadUint64(&h.sum)), counts
+}
+
+// percentiles returns the latencies below which the percentiles ps (0-100)
+// of the latencies are, all 0 without latencies
+func (h *latencyHistogram) percentiles(ps ...float64) []time.Duration {
+	_, _, counts := h.snapshot()
+	return histPercentiles(counts, ps...)
+}
+
+func histPercentiles(counts []uint64, ps ...float64) []time.Duration {
+	res := make([]time.Duration, len(ps))
+	for j, v := range histRanks(counts, ps...) {
+		res[j] = time.Duration(v * float64(time.Microsecond))
+	}
+	return res
+}
+
+// histRanks returns the values of the buckets of the percentiles ps (0-100)
+// of the counts, all 0 without values
+func histRanks(counts []uint64, ps ...float64) []float64 {
+	var total uint64
+	for _, c := range counts {
+		total += c
+	}
+	res := make([]float64, len(ps))
+	if total == 0 {
+		return res
+	}
+	for j, p := range ps {
+		rank := uint64(math.Ceil(p / 100 * float64(total)))
+		if rank == 0 {
+			rank = 1
+		}
+		var n uint64
+		for i, c := range counts {
+			if n += c; n >= rank {
+				res[j] = histValue(i)
+				break
+			}
+		}
+	}
+	return res
+}
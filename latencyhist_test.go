@@ -0,0 +1,55 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestHistBucket(t *testing.T) {
+	prev := -1
+	for _, us := range []uint64{0, 1, 31, 32, 33, 63, 64, 1000, 20000, 1 << 20, 1<<37 - 1} {
+		i := histBucket(us)
+		if i < prev || i >= histBuckets {
+			t.Errorf("%d: got bucket %d after %d", us, i, prev)
+		}
+		prev = i
+		if v := histValue(i); v < float64(us)*31/32 || v > float64(us)*33/32+1 {
+			t.Errorf("%d: got value %v of bucket %d", us, v, i)
+		}
+	}
+	if i := histBucket(1 << 62); i != histBuckets-1 {
+		t.Errorf("got bucket %d for the largest latency, want %d", i, histBuckets-1)
+	}
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	var h latencyHistogram
+	if got := h.percentiles(50, 99); got[0] != 0 || got[1] != 0 {
+		t.Errorf("got %v without latencies", got)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	var latencies []time.Duration
+	for i := 0; i < 10000; i++ {
+		d := time.Duration(r.ExpFloat64() * float64(50*time.Millisecond))
+		latencies = append(latencies, d)
+		h.observe(d)
+	}
+	h.observe(-time.Second)
+	latencies = append(latencies, 0)
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	ps := []float64{0, 50, 95, 99, 100}
+	for i, got := range h.percentiles(ps...) {
+		want := percentile(latencies, int(ps[i]))
+		if d := got - want; d > want/32+time.Microsecond || d < -want/32-time.Microsecond {
+			t.Errorf("p%v: got %v, want %v", ps[i], got, want)
+		}
+	}
+	count, _, _ := h.snapshot()
+	if count != uint64(len(latencies)) {
+		t.Errorf("got count %d, want %d", count, len(latencies))
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	na_pb "github.com/nileshsimaria/jtimon/telemetry"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/metadata"
+)
+
+var (
+	lintPaths   = flag.Bool("lint-paths", false, "Check that each path of the devices gets an update within --lint-timeout and report the dead ones instead of running")
+	lintTimeout = flag.Int("lint-timeout", 30, "How long --lint-paths waits for the first update of the paths of a device, in seconds")
+)
+
+// lintDevice subscribes to each path of the Junos device of the worker on
+// its own, with its freq, and waits up to timeout for their first update.
+// The paths are ok once they got one, the others are dead: rejected by the
+// device, with no data or invalid.
+func lintDevice(jctx *JCtx, timeout time.Duration) ([]sensorResult, error) {
+	vendor, err := getVendor(jctx)
+	if err != nil {
+		return nil, err
+	}
+	if vendor.name != "juniper-junos" {
+		return nil, fmt.Errorf("--lint-paths does not support vendor %s", vendor.name)
+	}
+	conn, err := dialDevice(jctx, vendor)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if vendor.loginCheckRequired {
+		if err := vendor.sendLoginCheck(jctx, conn); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]sensorResult, len(jctx.config.Paths))
+	waiting := 0
+	for i, p := range jctx.config.Paths {
+		results[i].path = p.Path
+		if err := checkPathSyntax(p.Path); err != nil {
+			results[i].status, results[i].note = SensorInvalid, err.Error()
+		} else {
+			waiting++
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if authMode(jctx.config) == AuthMeta {
+		md := metadata.New(map[string]string{"username": jctx.config.User, "password": jctx.config.Password})
+		ctx = metadata.NewOutgoingContext(ctx, md)
+	}
+	client := na_pb.NewOpenConfigTelemetryClient(conn)
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	// done counts a path out once it got an update or its subscription
+	// ended, the subscriptions stop once all the paths are
+	done := func() {
+		if waiting--; waiting == 0 {
+			cancel()
+		}
+	}
+	for i, p := range jctx.config.Paths {
+		if results[i].status == SensorInvalid {
+			continue
+		}
+		wg.Add(1)
+		go func(r *sensorResult, freq uint64) {
+			defer wg.Done()
+			stream, err := client.TelemetrySubscribe(ctx, &na_pb.SubscriptionRequest{
+				PathList: []*na_pb.Path{{Path: r.path, SampleFrequency: uint32(freq)}},
+			})
+			for err == nil {
+				if _, err = stream.Recv(); err != nil {
+					break
+				}
+				mu.Lock()
+				if r.points++; r.points == 1 {
+					done()
+				}
+				mu.Unlock()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case r.points != 0:
+				r.status = SensorOK
+				return
+			case err != nil && err != io.EOF && ctx.Err() == nil:
+				r.status, r.note = SensorRejected, err.Error()
+			default:
+				r.status = SensorNoData
+			}
+			done()
+		}(&results[i], p.Freq)
+	}
+	wg.Wait()
+
+	for i := range results {
+		results[i].suggest()
+	}
+	return results, nil
+}
+
+// lintMain runs --lint-paths on the devices of the config files, it exits
+// with status 1 if a device could not be linted or one of its paths is dead
+func lintMain(files []string) {
+	if *lintTimeout <= 0 {
+		log.Printf("--lint-timeout must be positive")
+		os.Exit(1)
+	}
+	type lint struct {
+		results []sensorResult
+		err     error
+	}
+	lints := make([]lint, len(files))
+	var wg sync.WaitGroup
+	for i, file := range files {
+		wg.Add(1)
+		go func(l *lint, file string) {
+			defer wg.Done()
+			jctx, err := loadDevice(file)
+			if err != nil {
+				l.err = err
+				return
+			}
+			l.results, l.err = lintDevice(jctx, time.Duration(*lintTimeout)*time.Second)
+		}(&lints[i], file)
+	}
+	wg.Wait()
+
+	status := 0
+	for i, file := range files {
+		if i != 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s\n", file)
+		if lints[i].err != nil {
+			fmt.Printf("%v\n", lints[i].err)
+			status = 1
+			continue
+		}
+		if !writeSensorTable(os.Stdout, lints[i].results, "updates") {
+			status = 1
+		}
+	}
+	os.Exit(status)
+}
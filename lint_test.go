@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nileshsimaria/jtimon/simulator"
+)
+
+func TestLintDevice(t *testing.T) {
+	s, err := simulator.Start("127.0.0.1:0", simulator.DefaultScript())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	host, port, _ := net.SplitHostPort(s.Addr())
+	p, _ := strconv.Atoi(port)
+
+	jctx := &JCtx{config: Config{Host: host, Port: p, Paths: []PathsConfig{
+		{Path: "/interfaces/", Freq: 100},
+		{Path: "/lldpp/", Freq: 100},
+		{Path: "interfaces", Freq: 100},
+	}}}
+	results, err := lintDevice(jctx, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ status, note string }{
+		{SensorOK, ""},
+		{SensorRejected, "did you mean /lldp/?"},
+		{SensorInvalid, "does not start with /"},
+	}
+	for i, r := range results {
+		if r.status != want[i].status || !strings.HasSuffix(r.note, want[i].note) {
+			t.Errorf("%s: %s %q, want %s %q", r.path, r.status, r.note, want[i].status, want[i].note)
+		}
+	}
+	if results[0].points == 0 {
+		t.Errorf("%s ok without updates", results[0].path)
+	}
+	var b bytes.Buffer
+	if writeSensorTable(&b, results, "updates") {
+		t.Errorf("writeSensorTable() = true with dead paths")
+	}
+	if !strings.HasPrefix(b.String(), "path          status   updates  note\n/interfaces/  ok  ") {
+		t.Errorf("table\n%s", b.String())
+	}
+
+	// the lint stops before the timeout once all the paths got an update
+	// or were rejected
+	start := time.Now()
+	if results, err := lintDevice(jctx, time.Minute); err != nil || results[0].status != SensorOK || results[1].status != SensorRejected {
+		t.Errorf("lintDevice() = %+v, %v", results, err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("lintDevice() took %v with no path left to wait for", d)
+	}
+
+	jctx.config.Vendor.Name = "cisco-iosxr"
+	if _, err := lintDevice(jctx, time.Second); err == nil {
+		t.Errorf("lintDevice() of cisco-iosxr = nil")
+	}
+}
+
+func TestLintDeviceNoData(t *testing.T) {
+	script := simulator.DefaultScript()
+	script.Faults = simulator.Faults{Drop: 1}
+	s, err := simulator.Start("127.0.0.1:0", script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	host, port, _ := net.SplitHostPort(s.Addr())
+	p, _ := strconv.Atoi(port)
+
+	jctx := &JCtx{config: Config{Host: host, Port: p, Paths: []PathsConfig{{Path: "/interfaces/", Freq: 100}}}}
+	results, err := lintDevice(jctx, 500*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].status != SensorNoData || results[0].note != "" {
+		t.Errorf("%s: %s %q, want %s", results[0].path, results[0].status, results[0].note, SensorNoData)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ListKeysConfig promotes list keys still embedded in field names, e.g.
+// /interfaces/interface[name='xe-0/0/1']/state/oper-status, into tags named
+// like the ones of the Junos decoder (/interfaces/interface/@name) and
+// strips them from the field name. Map renames key tags, it is looked up
+// with the full tag name first and then with the last element and key
+// (interface/@name).
+type ListKeysConfig struct {
+	Extract bool              `json:"extract"`
+	Map     map[string]string `json:"map"`
+}
+
+type listKeys struct {
+	extract bool
+	names   map[string]string
+}
+
+func newListKeysTransformer() *transformer {
+	return &transformer{
+		name: "list-keys",
+		new:  newListKeys,
+	}
+}
+
+func newListKeys(jctx *JCtx) (transform, error) {
+	cfg := jctx.config.Transform.ListKeys
+	if !cfg.Extract && len(cfg.Map) == 0 {
+		return nil, nil
+	}
+	for k, v := range cfg.Map {
+		if v == "" {
+			return nil, fmt.Errorf("map: empty tag name for %q", k)
+		}
+	}
+	return &listKeys{extract: cfg.Extract, names: cfg.Map}, nil
+}
+
+// splitListKeys returns path without predicates and the keys of the
+// predicates as tags. Both [a='x' and b='y'] and [a='x'][b='y'] are
+// understood, values may be quoted with ' or " or not at all.
+func splitListKeys(path string) (string, map[string]string, error) {
+	var b strings.Builder
+	var tags map[string]string
+	for i := 0; i < len(path); i++ {
+		if path[i] != '[' {
+			b.WriteByte(path[i])
+			continue
+		}
+		end, preds, err := parsePredicates(path, i)
+		if err != nil {
+			return "", nil, err
+		}
+		if tags == nil {
+			tags = map[string]string{}
+		}
+		elemPath := b.String()
+		for _, kv := range preds {
+			tags[elemPath+"/@"+kv[0]] = kv[1]
+		}
+		i = end
+	}
+	return b.String(), tags, nil
+}
+
+// parsePredicates parses the predicates of the bracket starting at
+// path[start], end is the index of the closing bracket
+func parsePredicates(path string, start int) (end int, preds [][2]string, err error) {
+	i := start + 1
+	for {
+		for i < len(path) && path[i] == ' ' {
+			i++
+		}
+		eq := strings.IndexByte(path[i:], '=')
+		if eq < 0 {
+			return 0, nil, fmt.Errorf("%s: predicate without value at %d", path, i)
+		}
+		key := strings.TrimSpace(path[i : i+eq])
+		i += eq + 1
+		for i < len(path) && path[i] == ' ' {
+			i++
+		}
+
+		var value string
+		if i < len(path) && (path[i] == '\'' || path[i] == '"') {
+			q := strings.IndexByte(path[i+1:], path[i])
+			if q < 0 {
+				return 0, nil, fmt.Errorf("%s: unterminated quote at %d", path, i)
+			}
+			value = path[i+1 : i+1+q]
+			i += q + 2
+		} else {
+			j := i
+			for j < len(path) && path[j] != ']' && path[j] != ' ' {
+				j++
+			}
+			value = path[i:j]
+			i = j
+		}
+		preds = append(preds, [2]string{key, value})
+
+		for i < len(path) && path[i] == ' ' {
+			i++
+		}
+		switch {
+		case i >= len(path):
+			return 0, nil, fmt.Errorf("%s: missing ]", path)
+		case path[i] == ']':
+			return i, preds, nil
+		case strings.HasPrefix(path[i:], "and "):
+			i += len("and ")
+		default:
+			return 0, nil, fmt.Errorf("%s: unexpected %q at %d", path, path[i], i)
+		}
+	}
+}
+
+// tagName maps the key tag k
+func (l *listKeys) tagName(k string) string {
+	if name, ok := l.names[k]; ok {
+		return name
+	}
+	i := strings.LastIndex(k, "/@")
+	if i < 0 {
+		return k
+	}
+	short := k[strings.LastIndex(k[:i], "/")+1:]
+	if name, ok := l.names[short]; ok {
+		return name
+	}
+	return k
+}
+
+func (l *listKeys) mapTags(tags map[string]string) map[string]string {
+	if len(l.names) == 0 {
+		return tags
+	}
+	mapped := make(map[string]string, len(tags))
+	for k, v := range tags {
+		mapped[l.tagName(k)] = v
+	}
+	return mapped
+}
+
+func (l *listKeys) apply(points []*point) []*point {
+	out := make([]*point, 0, len(points))
+	for _, p := range points {
+		if !l.extract {
+			out = append(out, newPoint(p.Measurement, l.mapTags(p.Tags), p.Fields, p.Timestamp))
+			continue
+		}
+
+		names := make([]string, 0, len(p.Fields))
+		for k := range p.Fields {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		// fields are grouped into one point per distinct set of keys
+		var base map[string]interface{}
+		var groups []*point
+		index := map[string]*point{}
+		for _, k := range names {
+			v := p.Fields[k]
+			var field string
+			var keys map[string]string
+			if strings.IndexByte(k, '[') >= 0 {
+				var err error
+				if field, keys, err = splitListKeys(k); err != nil {
+					keys = nil
+				}
+			}
+			if keys == nil {
+				if base == nil {
+					base = map[string]interface{}{}
+				}
+				base[k] = v
+				continue
+			}
+
+			tags := make(map[string]string, len(p.Tags)+len(keys))
+			for tk, tv := range p.Tags {
+				tags[tk] = tv
+			}
+			for tk, tv := range keys {
+				tags[tk] = tv
+			}
+			g := newPoint(p.Measurement, tags, map[string]interface{}{}, p.Timestamp)
+			id := seriesKey(g, "")
+			if existing, ok := index[id]; ok {
+				g = existing
+			} else {
+				index[id] = g
+				groups = append(groups, g)
+			}
+			g.Fields[field] = v
+		}
+
+		if base != nil {
+			out = append(out, newPoint(p.Measurement, l.mapTags(p.Tags), base, p.Timestamp))
+		}
+		for _, g := range groups {
+			g.Tags = l.mapTags(g.Tags)
+			out = append(out, g)
+		}
+	}
+	return out
+}
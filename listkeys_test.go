@@ -0,0 +1,101 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplitListKeys(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+		tags map[string]string
+		err  bool
+	}{
+		{
+			path: "/interfaces/interface/state/mtu",
+			want: "/interfaces/interface/state/mtu",
+		},
+		{
+			path: "/interfaces/interface[name='xe-0/0/1']/state/mtu",
+			want: "/interfaces/interface/state/mtu",
+			tags: map[string]string{"/interfaces/interface/@name": "xe-0/0/1"},
+		},
+		{
+			path: `/network-instances/network-instance[name="default"]/protocols/protocol[identifier=BGP and name = 'bgp']/state/enabled`,
+			want: "/network-instances/network-instance/protocols/protocol/state/enabled",
+			tags: map[string]string{
+				"/network-instances/network-instance/@name":                          "default",
+				"/network-instances/network-instance/protocols/protocol/@identifier": "BGP",
+				"/network-instances/network-instance/protocols/protocol/@name":       "bgp",
+			},
+		},
+		{
+			path: "/lldp/interfaces/interface[name=et-0/0/0]/neighbors/neighbor[id='a]b'][port='1']/state/ttl",
+			want: "/lldp/interfaces/interface/neighbors/neighbor/state/ttl",
+			tags: map[string]string{
+				"/lldp/interfaces/interface/@name":                    "et-0/0/0",
+				"/lldp/interfaces/interface/neighbors/neighbor/@id":   "a]b",
+				"/lldp/interfaces/interface/neighbors/neighbor/@port": "1",
+			},
+		},
+		{path: "/interfaces/interface[name='xe-0/0/1/state", err: true},
+		{path: "/interfaces/interface[name]/state", err: true},
+	}
+
+	for _, test := range tests {
+		got, tags, err := splitListKeys(test.path)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: want error, got nil", test.path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.path, err)
+			continue
+		}
+		if got != test.want || !reflect.DeepEqual(tags, test.tags) {
+			t.Errorf("%s\ngot:  %s %v\nwant: %s %v", test.path, got, tags, test.want, test.tags)
+		}
+	}
+}
+
+func TestListKeys(t *testing.T) {
+	in := newPoint("/interfaces/", map[string]string{"device": "r1"},
+		map[string]interface{}{
+			"/interfaces/interface[name='xe-0/0/0']/state/mtu":         1500.0,
+			"/interfaces/interface[name='xe-0/0/0']/state/oper-status": "UP",
+			"/interfaces/interface[name='xe-0/0/1']/state/mtu":         9192.0,
+			"/system/state/hostname":                                   "r1",
+		}, time.Unix(1, 0))
+
+	jctx := &JCtx{}
+	jctx.config.Transform.ListKeys = ListKeysConfig{
+		Extract: true,
+		Map:     map[string]string{"interface/@name": "interface"},
+	}
+	if err := transformsInit(jctx); err != nil {
+		t.Fatalf("transformsInit failed: %v", err)
+	}
+	out := applyTransforms(jctx, []*point{in})
+
+	want := []*point{
+		newPoint("/interfaces/", map[string]string{"device": "r1"},
+			map[string]interface{}{"/system/state/hostname": "r1"}, time.Unix(1, 0)),
+		newPoint("/interfaces/", map[string]string{"device": "r1", "interface": "xe-0/0/0"},
+			map[string]interface{}{
+				"/interfaces/interface/state/mtu":         1500.0,
+				"/interfaces/interface/state/oper-status": "UP",
+			}, time.Unix(1, 0)),
+		newPoint("/interfaces/", map[string]string{"device": "r1", "interface": "xe-0/0/1"},
+			map[string]interface{}{"/interfaces/interface/state/mtu": 9192.0}, time.Unix(1, 0)),
+	}
+	if !reflect.DeepEqual(out, want) {
+		for _, p := range out {
+			t.Logf("got %v", *p)
+		}
+		t.Errorf("unexpected points")
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// logRepeat is a message which was repeated and not logged
+type logRepeat struct {
+	level   string
+	path    string
+	msg     string
+	err     error
+	repeats int
+	since   time.Time
+}
+
+// message is the line which stands for the repeats
+func (r *logRepeat) message() string {
+	msg := r.msg
+	if r.err != nil {
+		msg = fmt.Sprintf("%s: %v", msg, r.err)
+	}
+	return fmt.Sprintf("Last message repeated %d times since %s: %s", r.repeats, r.since.Format(time.RFC3339), msg)
+}
+
+// logDedup collapses a warning or error which repeats within the dedup
+// window of the log config, like the same dial failure every second, into
+// one line with the number of repeats
+type logDedup struct {
+	sync.Mutex
+	key  string
+	last logRepeat
+}
+
+// check tells whether the message is logged at now, repeats of the last
+// message within window are not. It also returns the repeats of the last
+// message to log first, nil if there are none.
+func (d *logDedup) check(level, path, msg string, err error, window time.Duration, now time.Time) (bool, *logRepeat) {
+	key := level + "\x00" + path + "\x00" + msg
+	if err != nil {
+		key += "\x00" + err.Error()
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	if key == d.key && now.Sub(d.last.since) < window {
+		d.last.repeats++
+		return false, nil
+	}
+	var r *logRepeat
+	if d.last.repeats != 0 {
+		repeat := d.last
+		r = &repeat
+	}
+	d.key = key
+	d.last = logRepeat{level: level, path: path, msg: msg, err: err, since: now}
+	return true, r
+}
+
+// flush returns the repeats of the last message not logged yet, nil if
+// there are none
+func (d *logDedup) flush() *logRepeat {
+	d.Lock()
+	defer d.Unlock()
+	if d.last.repeats == 0 {
+		return nil
+	}
+	r := d.last
+	d.key, d.last = "", logRepeat{}
+	return &r
+}
+
+// jLogRepeat logs the repeats of a message
+func jLogRepeat(jctx *JCtx, r *logRepeat) {
+	if r == nil {
+		return
+	}
+	jLogWrite(jctx, r.level, r.path, r.message(), nil)
+	logSyslog.log(r.level, jctx.config.Host, r.path, r.message(), nil)
+}
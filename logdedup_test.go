@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogDedupCheck(t *testing.T) {
+	var d logDedup
+	start := time.Date(2020, 3, 1, 10, 30, 0, 0, time.UTC)
+	dial := errors.New("connection refused")
+	tests := []struct {
+		name    string
+		msg     string
+		err     error
+		at      time.Duration
+		log     bool
+		repeats int
+	}{
+		{name: "first", msg: "dial failed", err: dial, log: true},
+		{name: "repeat", msg: "dial failed", err: dial, at: time.Second},
+		{name: "repeat again", msg: "dial failed", err: dial, at: 2 * time.Second},
+		{name: "other error", msg: "dial failed", err: errors.New("timeout"), at: 3 * time.Second, log: true, repeats: 2},
+		{name: "repeat of other", msg: "dial failed", err: errors.New("timeout"), at: 4 * time.Second},
+		{name: "after window", msg: "dial failed", err: errors.New("timeout"), at: 14 * time.Second, log: true, repeats: 1},
+		{name: "new message", msg: "login failed", at: 15 * time.Second, log: true},
+	}
+	for _, test := range tests {
+		ok, r := d.check(LogLevelError, "", test.msg, test.err, 10*time.Second, start.Add(test.at))
+		if ok != test.log {
+			t.Errorf("%s: got logged %v, want %v", test.name, ok, test.log)
+		}
+		repeats := 0
+		if r != nil {
+			repeats = r.repeats
+		}
+		if repeats != test.repeats {
+			t.Errorf("%s: got %d repeats, want %d", test.name, repeats, test.repeats)
+		}
+	}
+	if r := d.flush(); r != nil {
+		t.Errorf("got repeats %+v of a message logged once", r)
+	}
+}
+
+func TestJLogDedup(t *testing.T) {
+	f, err := ioutil.TempFile("", "jtimon-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	jctx := &JCtx{config: Config{Host: "r1", Log: LogConfig{Dedup: 60}}}
+	jctx.config.Log.logger = log.New(f, "", 0)
+	for i := 0; i < 5; i++ {
+		jLogError(jctx, "", "dial failed", errors.New("connection refused"))
+		jLog(jctx, "retrying")
+	}
+	jLogRepeat(jctx, jctx.logDedup.flush())
+
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 7 {
+		t.Fatalf("got %d lines:\n%s", len(lines), b)
+	}
+	if lines[0] != "dial failed: connection refused" {
+		t.Errorf("got first line %q", lines[0])
+	}
+	if last := lines[6]; !strings.HasPrefix(last, "Last message repeated 4 times since ") ||
+		!strings.HasSuffix(last, ": dial failed: connection refused") {
+		t.Errorf("got last line %q", last)
+	}
+}
@@ -1,14 +1,217 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
+	"sync"
+	"time"
 )
 
+// Log formats
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Log levels, a worker logs the messages of its level and above
+const (
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+)
+
+var logLevels = map[string]int{
+	LogLevelDebug: 0,
+	LogLevelInfo:  1,
+	LogLevelWarn:  2,
+	LogLevelError: 3,
+}
+
+// workerLogLevel is the level of the worker: the level of its log config,
+// debug if it is verbose or else --log-level
+func workerLogLevel(jctx *JCtx) string {
+	switch {
+	case jctx.config.Log.Level != "":
+		return jctx.config.Log.Level
+	case jctx.config.Log.Verbose:
+		return LogLevelDebug
+	}
+	return *logLevel
+}
+
+// logEnabled tells whether messages of level are logged at min level
+func logEnabled(level, min string) bool {
+	return logLevels[level] >= logLevels[min]
+}
+
+// logEntry is one line of the JSON log
+type logEntry struct {
+	Timestamp string `json:"timestamp"`
+	Level     string `json:"level"`
+	Device    string `json:"device,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Message   string `json:"message"`
+	Error     string `json:"error,omitempty"`
+}
+
+func validateLogConfig(cfg LogConfig) error {
+	switch cfg.Compression {
+	case "", LogCompressionGzip, LogCompressionNone:
+	default:
+		return fmt.Errorf("log compression %q is not supported, use gzip or none", cfg.Compression)
+	}
+	if _, ok := logLevels[cfg.Level]; cfg.Level != "" && !ok {
+		return fmt.Errorf("log level %q is not supported, use debug, info, warn or error", cfg.Level)
+	}
+	if cfg.RotateSize < 0 || cfg.RotateAge < 0 || cfg.RotateKeep < 0 {
+		return fmt.Errorf("log rotate-size, rotate-age and rotate-keep can not be negative")
+	}
+	if cfg.Dedup < 0 {
+		return fmt.Errorf("log dedup can not be negative")
+	}
+	return nil
+}
+
+// logLine formats one JSON log line, the trailing white space of msg is
+// dropped
+func logLine(t time.Time, level, device, path, msg string, err error) []byte {
+	e := logEntry{
+		Timestamp: t.UTC().Format(time.RFC3339Nano),
+		Level:     level,
+		Device:    device,
+		Path:      path,
+		Message:   strings.TrimRightFunc(msg, func(r rune) bool { return r == '\n' || r == ' ' || r == '\t' }),
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	b, _ := json.Marshal(e)
+	return append(b, '\n')
+}
+
+// muxLog is the log of --log-mux-stdout, the log package unless it also
+// sends to syslog
+var muxLog = log.New(os.Stderr, "", log.LstdFlags)
+
+// stderrLog serializes the JSON lines written to stderr
+var stderrLog sync.Mutex
+
+// jsonLogWriter turns the lines of the log package into JSON lines on
+// stderr
+type jsonLogWriter struct{}
+
+func (jsonLogWriter) Write(p []byte) (int, error) {
+	stderrLog.Lock()
+	defer stderrLog.Unlock()
+	if _, err := os.Stderr.Write(logLine(time.Now(), LogLevelInfo, "", "", string(p), nil)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// logFlagsInit sets up the format and syslog and checks the level of the
+// logs of jtimon
+func logFlagsInit() {
+	if _, ok := logLevels[*logLevel]; !ok {
+		log.Fatalf("log level %q is not supported, use debug, info, warn or error", *logLevel)
+	}
+	switch *logFormat {
+	case LogFormatText:
+	case LogFormatJSON:
+		log.SetFlags(0)
+		log.SetOutput(jsonLogWriter{})
+	default:
+		log.Fatalf("log format %q is not supported, use text or json", *logFormat)
+	}
+	if *logSyslogTo != "" {
+		s, err := newSyslogLogger(*logSyslogTo, *logSyslogFac)
+		if err != nil {
+			log.Fatalf("log syslog: %v", err)
+		}
+		logSyslog = s
+		go s.run()
+		// the workers send to syslog on their own
+		muxLog = log.New(log.Writer(), "", log.Flags())
+		log.SetOutput(io.MultiWriter(log.Writer(), syslogLogWriter{s}))
+	}
+}
+
+// globalLog logs msg of level to the log of jtimon, filtered by --log-level
+func globalLog(level, msg string) {
+	if logEnabled(level, *logLevel) {
+		log.Print(msg)
+	}
+}
+
 func jLog(jctx *JCtx, msg string) {
+	jLogEntry(jctx, LogLevelInfo, "", msg, nil)
+}
+
+func jLogDebug(jctx *JCtx, msg string) {
+	jLogEntry(jctx, LogLevelDebug, "", msg, nil)
+}
+
+func jLogWarn(jctx *JCtx, msg string) {
+	jLogEntry(jctx, LogLevelWarn, "", msg, nil)
+}
+
+// jLogError logs msg with the error and the path it is about (if any),
+// they are fields of their own in the JSON log
+func jLogError(jctx *JCtx, path, msg string, err error) {
+	jLogEntry(jctx, LogLevelError, path, msg, err)
+}
+
+// jLogData logs the telemetry data printed with --print, regardless of the
+// level, or at debug level otherwise
+func jLogData(jctx *JCtx, msg string) {
+	if *print {
+		jLogWrite(jctx, LogLevelInfo, "", msg, nil)
+		return
+	}
+	jLogDebug(jctx, msg)
+}
+
+func jLogEntry(jctx *JCtx, level, path, msg string, err error) {
+	if !logEnabled(level, workerLogLevel(jctx)) {
+		return
+	}
+	if window := jctx.config.Log.Dedup; window > 0 && logEnabled(level, LogLevelWarn) {
+		ok, r := jctx.logDedup.check(level, path, msg, err, time.Duration(window)*time.Second, time.Now())
+		jLogRepeat(jctx, r)
+		if !ok {
+			return
+		}
+	}
+	jLogWrite(jctx, level, path, msg, err)
+	logSyslog.log(level, jctx.config.Host, path, msg, err)
+}
+
+func jLogWrite(jctx *JCtx, level, path, msg string, err error) {
+	if *logFormat == LogFormatJSON {
+		line := logLine(time.Now(), level, jctx.config.Host, path, msg, err)
+		if *logMux {
+			stderrLog.Lock()
+			os.Stderr.Write(line)
+			stderrLog.Unlock()
+		} else if jctx.config.Log.logger != nil {
+			jctx.config.Log.logger.Print(string(line))
+		}
+		return
+	}
+
+	if path != "" {
+		msg = fmt.Sprintf("%s: %s", path, msg)
+	}
+	if err != nil {
+		msg = fmt.Sprintf("%s: %v", msg, err)
+	}
 	if *logMux {
-		log.Print(fmt.Sprintf("[%s]:%s", jctx.config.Host, msg))
+		muxLog.Print(fmt.Sprintf("[%s]:%s", jctx.config.Host, msg))
 		return
 	}
 
@@ -18,6 +221,7 @@ func jLog(jctx *JCtx, msg string) {
 }
 
 func logStop(jctx *JCtx) {
+	jLogRepeat(jctx, jctx.logDedup.flush())
 	if jctx.config.Log.out != nil {
 		jctx.config.Log.out.Close()
 		jctx.config.Log.out = nil
@@ -30,17 +234,17 @@ func logInit(jctx *JCtx) {
 	}
 
 	file := jctx.config.Log.File
-	var out *os.File
+	var out io.WriteCloser
 
-	if *print {
+	if *print || *explain {
 		out = os.Stdout
 		if file != "" {
 			log.Println("Both print and log options are used, ignoring log")
 		}
 	} else if file != "" {
-		var err error
-		out, err = os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
-		if err != nil {
+		if r, err := newRotatingFile(file, jctx.config.Log); err == nil {
+			out = r
+		} else {
 			log.Printf("Could not create log file(%s): %v\n", file, err)
 		}
 	}
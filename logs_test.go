@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestValidateLogConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  LogConfig
+		err  bool
+	}{
+		{name: "default", cfg: LogConfig{}},
+		{name: "gzip", cfg: LogConfig{RotateSize: 100, Compression: "gzip"}},
+		{name: "none", cfg: LogConfig{RotateSize: 100, Compression: "none"}},
+		{name: "zstd", cfg: LogConfig{RotateSize: 100, Compression: "zstd"}, err: true},
+		{name: "negative", cfg: LogConfig{RotateKeep: -1}, err: true},
+		{name: "level", cfg: LogConfig{Level: "warn"}},
+		{name: "unknown level", cfg: LogConfig{Level: "trace"}, err: true},
+		{name: "dedup", cfg: LogConfig{Dedup: 30}},
+		{name: "negative dedup", cfg: LogConfig{Dedup: -1}, err: true},
+	}
+	for _, test := range tests {
+		err := validateLogConfig(test.cfg)
+		if (err != nil) != test.err {
+			t.Errorf("%s: got error %v", test.name, err)
+		}
+	}
+}
+
+func TestLogLine(t *testing.T) {
+	ts := time.Date(2020, 3, 1, 10, 30, 0, 500000000, time.UTC)
+	tests := []struct {
+		name   string
+		level  string
+		device string
+		path   string
+		msg    string
+		err    error
+		want   string
+	}{
+		{
+			name:   "info",
+			level:  LogLevelInfo,
+			device: "r1",
+			msg:    "Connecting to r1:32767\n",
+			want:   `{"timestamp":"2020-03-01T10:30:00.5Z","level":"info","device":"r1","message":"Connecting to r1:32767"}`,
+		},
+		{
+			name:   "error",
+			level:  LogLevelError,
+			device: "r1",
+			path:   "/junos/system/linecard/cpu",
+			msg:    "decoding failed",
+			err:    errors.New("unexpected EOF"),
+			want: `{"timestamp":"2020-03-01T10:30:00.5Z","level":"error","device":"r1",` +
+				`"path":"/junos/system/linecard/cpu","message":"decoding failed","error":"unexpected EOF"}`,
+		},
+		{
+			name:  "escaped",
+			level: LogLevelInfo,
+			msg:   "gRPC headers \"x\"\n  a: b",
+			want:  `{"timestamp":"2020-03-01T10:30:00.5Z","level":"info","message":"gRPC headers \"x\"\n  a: b"}`,
+		},
+	}
+	for _, test := range tests {
+		got := string(logLine(ts, test.level, test.device, test.path, test.msg, test.err))
+		if got != test.want+"\n" {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestJLogFormats(t *testing.T) {
+	f, err := ioutil.TempFile("", "jtimon-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	format := *logFormat
+	defer func() { *logFormat = format }()
+
+	jctx := &JCtx{config: Config{Host: "r1"}}
+	jctx.config.Log.logger = log.New(f, "", 0)
+
+	*logFormat = LogFormatText
+	jLog(jctx, "Connecting to r1:32767")
+	jLogError(jctx, "/interfaces", "decoding failed", errors.New("unexpected EOF"))
+	*logFormat = LogFormatJSON
+	jLogError(jctx, "/interfaces", "decoding failed", errors.New("unexpected EOF"))
+
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(b), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines: %s", len(lines), b)
+	}
+	if want := "Connecting to r1:32767"; string(lines[0]) != want {
+		t.Errorf("text: got %s, want %s", lines[0], want)
+	}
+	if want := "/interfaces: decoding failed: unexpected EOF"; string(lines[1]) != want {
+		t.Errorf("text error: got %s, want %s", lines[1], want)
+	}
+	if want := []byte(`"level":"error","device":"r1","path":"/interfaces","message":"decoding failed","error":"unexpected EOF"}`); !bytes.HasSuffix(lines[2], want) {
+		t.Errorf("json error: got %s", lines[2])
+	}
+}
+
+func TestWorkerLogLevel(t *testing.T) {
+	level := *logLevel
+	defer func() { *logLevel = level }()
+
+	tests := []struct {
+		name    string
+		global  string
+		cfg     LogConfig
+		want    string
+		verbose bool
+	}{
+		{name: "global", global: LogLevelInfo, want: LogLevelInfo},
+		{name: "global warn", global: LogLevelWarn, want: LogLevelWarn},
+		{name: "verbose", global: LogLevelWarn, cfg: LogConfig{Verbose: true}, want: LogLevelDebug, verbose: true},
+		{name: "device", global: LogLevelDebug, cfg: LogConfig{Level: LogLevelError}, want: LogLevelError},
+		{name: "device over verbose", global: LogLevelInfo, cfg: LogConfig{Level: LogLevelWarn, Verbose: true}, want: LogLevelWarn},
+	}
+	for _, test := range tests {
+		*logLevel = test.global
+		jctx := &JCtx{config: Config{Log: test.cfg}}
+		if got := workerLogLevel(jctx); got != test.want {
+			t.Errorf("%s: got level %s, want %s", test.name, got, test.want)
+		}
+		if got := IsVerboseLogging(jctx); got != test.verbose {
+			t.Errorf("%s: got verbose %v", test.name, got)
+		}
+	}
+}
+
+func TestJLogLevels(t *testing.T) {
+	f, err := ioutil.TempFile("", "jtimon-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	jctx := &JCtx{config: Config{Host: "r1", Log: LogConfig{Level: LogLevelWarn}}}
+	jctx.config.Log.logger = log.New(f, "", 0)
+	jLogDebug(jctx, "debug")
+	jLog(jctx, "info")
+	jLogWarn(jctx, "warn")
+	jLogError(jctx, "", "error", nil)
+
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), "warn\nerror\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
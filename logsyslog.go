@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// syslogLogQueue is the number of log messages buffered while the syslog
+// daemon is slow or unreachable, further ones are dropped
+const syslogLogQueue = 1024
+
+// syslogLogRetry is the time between two connects to the syslog daemon
+const syslogLogRetry = 5 * time.Second
+
+// syslogLevels are the severities of the log levels
+var syslogLevels = map[string]int{
+	LogLevelDebug: 7,
+	LogLevelInfo:  6,
+	LogLevelWarn:  4,
+	LogLevelError: 3,
+}
+
+// syslogLogger sends the logs of jtimon as RFC5424 messages to a syslog
+// daemon, the target is network://address with network udp, tcp, tls or
+// unix (a local datagram socket like /dev/log)
+type syslogLogger struct {
+	network  string
+	addr     string
+	facility int
+	hostname string
+	ch       chan string
+	conn     net.Conn
+	retry    time.Time
+}
+
+// logSyslog is set with --log-syslog
+var logSyslog *syslogLogger
+
+func newSyslogLogger(target, facility string) (*syslogLogger, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	s := &syslogLogger{network: u.Scheme, addr: u.Host, ch: make(chan string, syslogLogQueue)}
+	if u.Host == "" && u.Path == "" {
+		return nil, fmt.Errorf("syslog %q has no address", target)
+	}
+	switch u.Scheme {
+	case "udp", "tcp":
+		if _, _, err := net.SplitHostPort(s.addr); err != nil {
+			s.addr = net.JoinHostPort(s.addr, strconv.Itoa(DefaultSyslogPort))
+		}
+	case "tls":
+		if _, _, err := net.SplitHostPort(s.addr); err != nil {
+			s.addr = net.JoinHostPort(s.addr, strconv.Itoa(DefaultSyslogTLSPort))
+		}
+	case "unix":
+		s.network, s.addr = "unixgram", u.Path
+	default:
+		return nil, fmt.Errorf("syslog %q is not supported, use udp://, tcp://, tls:// or unix://", target)
+	}
+	if s.addr == "" {
+		return nil, fmt.Errorf("syslog %q has no address", target)
+	}
+
+	f, ok := syslogFacilities[facility]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility %q", facility)
+	}
+	s.facility = f
+	s.hostname, _ = os.Hostname()
+	return s, nil
+}
+
+// message formats one log message, the device and path are structured
+// data
+func (s *syslogLogger) message(t time.Time, level, device, path, msg string, err error) string {
+	msg = strings.TrimRight(msg, "\n ")
+	if err != nil {
+		msg = fmt.Sprintf("%s: %v", msg, err)
+	}
+	sd := "-"
+	tags := map[string]string{}
+	if device != "" {
+		tags["device"] = device
+	}
+	if path != "" {
+		tags["path"] = path
+	}
+	if len(tags) != 0 {
+		sd = syslogStructuredData(tags)
+	}
+	return fmt.Sprintf("<%d>1 %s %s jtimon %d - %s %s", s.facility*8+syslogLevels[level],
+		t.UTC().Format("2006-01-02T15:04:05.000000Z07:00"), syslogHeaderField(s.hostname, 255),
+		os.Getpid(), sd, msg)
+}
+
+// log queues one message without blocking, s may be nil
+func (s *syslogLogger) log(level, device, path, msg string, err error) {
+	if s == nil {
+		return
+	}
+	select {
+	case s.ch <- s.message(time.Now(), level, device, path, msg, err):
+	default:
+	}
+}
+
+func (s *syslogLogger) dial() (net.Conn, error) {
+	timeout := time.Duration(DefaultIDBTimeout) * time.Second
+	if s.network == "tls" {
+		host, _, _ := net.SplitHostPort(s.addr)
+		return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", s.addr, &tls.Config{ServerName: host})
+	}
+	return net.DialTimeout(s.network, s.addr, timeout)
+}
+
+// run sends the queued messages, the ones which can not be sent are
+// dropped
+func (s *syslogLogger) run() {
+	for m := range s.ch {
+		if s.conn == nil {
+			if time.Now().Before(s.retry) {
+				continue
+			}
+			conn, err := s.dial()
+			if err != nil {
+				s.retry = time.Now().Add(syslogLogRetry)
+				continue
+			}
+			s.conn = conn
+		}
+		if err := syslogWrite(s.conn, s.network == "tcp" || s.network == "tls", m); err != nil {
+			s.conn.Close()
+			s.conn = nil
+		}
+	}
+}
+
+// syslogLogWriter sends the lines of the log package to syslog
+type syslogLogWriter struct {
+	s *syslogLogger
+}
+
+func (w syslogLogWriter) Write(p []byte) (int, error) {
+	w.s.log(LogLevelInfo, "", "", string(p), nil)
+	return len(p), nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewSyslogLogger(t *testing.T) {
+	tests := []struct {
+		target   string
+		facility string
+		network  string
+		addr     string
+		err      bool
+	}{
+		{target: "udp://10.0.0.1", facility: "daemon", network: "udp", addr: "10.0.0.1:514"},
+		{target: "tcp://syslog.example.net:1514", facility: "local3", network: "tcp", addr: "syslog.example.net:1514"},
+		{target: "tls://syslog.example.net", facility: "daemon", network: "tls", addr: "syslog.example.net:6514"},
+		{target: "unix:///dev/log", facility: "daemon", network: "unixgram", addr: "/dev/log"},
+		{target: "http://10.0.0.1", facility: "daemon", err: true},
+		{target: "udp://", facility: "daemon", err: true},
+		{target: "udp://10.0.0.1", facility: "local9", err: true},
+	}
+	for _, test := range tests {
+		s, err := newSyslogLogger(test.target, test.facility)
+		if (err != nil) != test.err {
+			t.Errorf("%s: got error %v", test.target, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if s.network != test.network || s.addr != test.addr {
+			t.Errorf("%s: got %s %s, want %s %s", test.target, s.network, s.addr, test.network, test.addr)
+		}
+	}
+}
+
+func TestSyslogLoggerMessage(t *testing.T) {
+	s, err := newSyslogLogger("udp://127.0.0.1", "daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.hostname = "collector1"
+	ts := time.Date(2020, 3, 1, 10, 30, 0, 0, time.UTC)
+	pid := strconv.Itoa(os.Getpid())
+
+	tests := []struct {
+		level  string
+		device string
+		path   string
+		msg    string
+		err    error
+		want   string
+	}{
+		{
+			level: LogLevelInfo, device: "r1", msg: "Connecting to r1:32767\n",
+			want: `<30>1 2020-03-01T10:30:00.000000Z collector1 jtimon ` + pid + ` - [jtimon@32473 device="r1"] Connecting to r1:32767`,
+		},
+		{
+			level: LogLevelError, device: "r1", path: "/interfaces", msg: "decoding failed", err: errors.New("unexpected EOF"),
+			want: `<27>1 2020-03-01T10:30:00.000000Z collector1 jtimon ` + pid + ` - [jtimon@32473 device="r1" path="/interfaces"] decoding failed: unexpected EOF`,
+		},
+		{
+			level: LogLevelWarn, msg: "all done",
+			want: `<28>1 2020-03-01T10:30:00.000000Z collector1 jtimon ` + pid + ` - - all done`,
+		},
+	}
+	for _, test := range tests {
+		if got := s.message(ts, test.level, test.device, test.path, test.msg, test.err); got != test.want {
+			t.Errorf("got  %s\nwant %s", got, test.want)
+		}
+	}
+}
+
+func TestSyslogLoggerSend(t *testing.T) {
+	t.Run("udp", func(t *testing.T) {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pc.Close()
+
+		s, err := newSyslogLogger("udp://"+pc.LocalAddr().String(), "daemon")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go s.run()
+		defer close(s.ch)
+		s.log(LogLevelWarn, "r1", "", "queue full", nil)
+
+		buf := make([]byte, 1024)
+		pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := string(buf[:n]); !strings.HasPrefix(m, "<28>1 ") || !strings.HasSuffix(m, `[jtimon@32473 device="r1"] queue full`) {
+			t.Errorf("got %s", m)
+		}
+	})
+
+	t.Run("tcp", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+
+		s, err := newSyslogLogger("tcp://"+l.Addr().String(), "daemon")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go s.run()
+		defer close(s.ch)
+		s.log(LogLevelInfo, "", "", "first", nil)
+		s.log(LogLevelInfo, "", "", "second", nil)
+
+		conn, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		r := bufio.NewReader(conn)
+		for _, want := range []string{"first", "second"} {
+			size, err := r.ReadString(' ')
+			if err != nil {
+				t.Fatal(err)
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(size))
+			m := make([]byte, n)
+			if _, err := r.Read(m); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(string(m), " - - "+want) {
+				t.Errorf("got %s, want message %s", m, want)
+			}
+		}
+	})
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// LokiConfig is the config of the Grafana Loki sink. Only the fields
+// matching match (string fields by default) are pushed as log lines,
+// labels are Go templates evaluated per point.
+type LokiConfig struct {
+	URL      string            `json:"url"`
+	TenantID string            `json:"tenant-id"`
+	User     string            `json:"user"`
+	Password string            `json:"password"`
+	Match    string            `json:"match"`
+	Labels   map[string]string `json:"labels"`
+	BatchConfig
+}
+
+type lokiLabel struct {
+	name string
+	t    *template.Template
+}
+
+type lokiSink struct {
+	cfg    LokiConfig
+	url    string
+	match  *regexp.Regexp
+	labels []lokiLabel
+	client *http.Client
+}
+
+func newLokiSink() *sink {
+	return &sink{
+		name: "loki",
+		open: openLokiSink,
+	}
+}
+
+func openLokiSink(jctx *JCtx) (sinkWriter, BatchConfig, error) {
+	cfg := jctx.config.Loki
+	if cfg.URL == "" {
+		return nil, cfg.BatchConfig, nil
+	}
+
+	s := &lokiSink{
+		cfg:    cfg,
+		url:    strings.TrimSuffix(cfg.URL, "/") + "/loki/api/v1/push",
+		client: &http.Client{Timeout: time.Duration(DefaultIDBTimeout) * time.Second},
+	}
+	if cfg.Match != "" {
+		re, err := regexp.Compile(cfg.Match)
+		if err != nil {
+			return nil, cfg.BatchConfig, fmt.Errorf("invalid loki match %q: %v", cfg.Match, err)
+		}
+		s.match = re
+	}
+
+	labels := cfg.Labels
+	if len(labels) == 0 {
+		labels = map[string]string{
+			"device":      "{{.Tags.device}}",
+			"measurement": "{{.Measurement}}",
+		}
+	}
+	for name, text := range labels {
+		t, err := newKeyTemplate("label "+name, text)
+		if err != nil {
+			return nil, cfg.BatchConfig, err
+		}
+		s.labels = append(s.labels, lokiLabel{name: name, t: t})
+	}
+	sort.Slice(s.labels, func(i, j int) bool { return s.labels[i].name < s.labels[j].name })
+	return s, cfg.BatchConfig, nil
+}
+
+// event returns the fields of the point which are pushed to Loki
+func (s *lokiSink) event(p *point) map[string]interface{} {
+	fields := map[string]interface{}{}
+	for k, v := range p.Fields {
+		if s.match == nil {
+			if _, ok := v.(string); !ok {
+				continue
+			}
+		} else if !s.match.MatchString(k) {
+			continue
+		}
+		fields[k] = v
+	}
+	return fields
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+	ts     []int64
+}
+
+func (s *lokiStream) Len() int           { return len(s.Values) }
+func (s *lokiStream) Less(i, j int) bool { return s.ts[i] < s.ts[j] }
+func (s *lokiStream) Swap(i, j int) {
+	s.Values[i], s.Values[j] = s.Values[j], s.Values[i]
+	s.ts[i], s.ts[j] = s.ts[j], s.ts[i]
+}
+
+func (s *lokiSink) write(points []*point) error {
+	streams := map[string]*lokiStream{}
+	var keys []string
+
+	for _, p := range points {
+		fields := s.event(p)
+		if len(fields) == 0 {
+			continue
+		}
+		line, err := json.Marshal(newPoint(p.Measurement, p.Tags, fields, p.Timestamp))
+		if err != nil {
+			continue
+		}
+
+		labels := map[string]string{}
+		var key strings.Builder
+		for _, l := range s.labels {
+			v, err := execKeyTemplate(l.t, p)
+			if err != nil {
+				return err
+			}
+			if v == "" {
+				continue
+			}
+			labels[l.name] = v
+			fmt.Fprintf(&key, "%s=%q,", l.name, v)
+		}
+
+		st, ok := streams[key.String()]
+		if !ok {
+			st = &lokiStream{Stream: labels}
+			streams[key.String()] = st
+			keys = append(keys, key.String())
+		}
+		ts := p.Timestamp.UnixNano()
+		st.Values = append(st.Values, [2]string{strconv.FormatInt(ts, 10), string(line)})
+		st.ts = append(st.ts, ts)
+	}
+	if len(streams) == 0 {
+		return nil
+	}
+
+	// Loki wants the entries of a stream in time order
+	req := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, k := range keys {
+		sort.Stable(streams[k])
+		req.Streams = append(req.Streams, streams[k])
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	r, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	if s.cfg.TenantID != "" {
+		r.Header.Set("X-Scope-OrgID", s.cfg.TenantID)
+	}
+	if s.cfg.User != "" {
+		r.SetBasicAuth(s.cfg.User, s.cfg.Password)
+	}
+	_, err = sinkHTTPDo(s.client, r)
+	return err
+}
+
+func (s *lokiSink) close() {
+}
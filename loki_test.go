@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLokiSink(t *testing.T) {
+	var got struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"streams"`
+	}
+	var tenant string
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/push" {
+			http.NotFound(w, r)
+			return
+		}
+		requests++
+		tenant = r.Header.Get("X-Scope-OrgID")
+		got.Streams = nil
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	alarm1 := newPoint("alarms", map[string]string{"device": "r1"},
+		map[string]interface{}{"/alarm/text": "fan failure", "/alarm/severity": uint32(2)}, time.Unix(2, 0))
+	alarm2 := newPoint("alarms", map[string]string{"device": "r1"},
+		map[string]interface{}{"/alarm/text": "fan ok"}, time.Unix(1, 0))
+	counters := newPoint("ifd", map[string]string{"device": "r2"},
+		map[string]interface{}{"/in-octets": uint64(10)}, time.Unix(1, 0))
+
+	tests := []struct {
+		name    string
+		cfg     LokiConfig
+		streams int
+		labels  map[string]string
+		fields  int
+	}{
+		{
+			name:    "defaults",
+			cfg:     LokiConfig{URL: server.URL},
+			streams: 1,
+			labels:  map[string]string{"device": "r1", "measurement": "alarms"},
+			fields:  1,
+		},
+		{
+			name:    "match-and-labels",
+			cfg:     LokiConfig{URL: server.URL, TenantID: "noc", Match: "^/alarm/", Labels: map[string]string{"host": "{{.Tags.device}}"}},
+			streams: 1,
+			labels:  map[string]string{"host": "r1"},
+			fields:  2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jctx := &JCtx{}
+			jctx.config.Loki = test.cfg
+			w, _, err := openLokiSink(jctx)
+			if err != nil {
+				t.Fatalf("openLokiSink failed: %v", err)
+			}
+			if err := w.write([]*point{alarm1, alarm2, counters}); err != nil {
+				t.Fatalf("write failed: %v", err)
+			}
+			if tenant != test.cfg.TenantID {
+				t.Errorf("tenant: want %q, got %q", test.cfg.TenantID, tenant)
+			}
+			if len(got.Streams) != test.streams {
+				t.Fatalf("want %d streams, got %d", test.streams, len(got.Streams))
+			}
+			st := got.Streams[0]
+			if len(st.Stream) != len(test.labels) {
+				t.Errorf("labels: want %v, got %v", test.labels, st.Stream)
+			}
+			for k, v := range test.labels {
+				if st.Stream[k] != v {
+					t.Errorf("labels: want %v, got %v", test.labels, st.Stream)
+				}
+			}
+			if len(st.Values) != 2 || st.Values[0][0] != "1000000000" || st.Values[1][0] != "2000000000" {
+				t.Fatalf("entries must be in time order, got %v", st.Values)
+			}
+			var p point
+			if err := json.Unmarshal([]byte(st.Values[1][1]), &p); err != nil || len(p.Fields) != test.fields {
+				t.Errorf("want %d fields in line, got %s (%v)", test.fields, st.Values[1][1], err)
+			}
+		})
+	}
+
+	t.Run("nothing-to-push", func(t *testing.T) {
+		requests = 0
+		jctx := &JCtx{}
+		jctx.config.Loki = LokiConfig{URL: server.URL}
+		w, _, _ := openLokiSink(jctx)
+		if err := w.write([]*point{counters}); err != nil || requests != 0 {
+			t.Errorf("want no request, got %d (%v)", requests, err)
+		}
+	})
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// luaScript runs the Lua script of ScriptConfig in jtimon. The script
+// defines function process(p), called for each point with p the table
+// {measurement = .., tags = {..}, fields = {..}, time = unix nanoseconds}.
+// process modifies p in place and returns nothing to pass it on, false or
+// nil to drop it, or the points to pass on instead of it, p and new ones.
+// The globals of the script persist between the calls.
+type luaScript struct {
+	sync.Mutex
+	jctx    *JCtx
+	file    string
+	source  string
+	timeout time.Duration
+	l       *lua.LState
+}
+
+// luaLibs are the libraries the scripts get, they have no access to the
+// files or processes of jtimon
+var luaLibs = []struct {
+	name string
+	open lua.LGFunction
+}{
+	{lua.BaseLibName, lua.OpenBase},
+	{lua.TabLibName, lua.OpenTable},
+	{lua.StringLibName, lua.OpenString},
+	{lua.MathLibName, lua.OpenMath},
+}
+
+func newLuaScript(jctx *JCtx, file string, timeout time.Duration) (*luaScript, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	s := &luaScript{jctx: jctx, file: file, source: string(b), timeout: timeout}
+	if err := s.start(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// start loads the script in a new Lua state
+func (s *luaScript) start() error {
+	l := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range luaLibs {
+		l.Push(l.NewFunction(lib.open))
+		l.Push(lua.LString(lib.name))
+		l.Call(1, 0)
+	}
+	// the base library can load files
+	for _, f := range []string{"dofile", "loadfile"} {
+		l.SetGlobal(f, lua.LNil)
+	}
+	if err := l.DoString(s.source); err != nil {
+		l.Close()
+		return fmt.Errorf("%s: %v", s.file, err)
+	}
+	if _, ok := l.GetGlobal("process").(*lua.LFunction); !ok {
+		l.Close()
+		return fmt.Errorf("%s: no function process", s.file)
+	}
+	s.l = l
+	return nil
+}
+
+func (s *luaScript) stop() {
+	if s.l != nil {
+		s.l.Close()
+		s.l = nil
+	}
+}
+
+// call runs process for each of the points
+func (s *luaScript) call(points []*point) ([]*point, error) {
+	if s.l == nil {
+		if err := s.start(); err != nil {
+			return nil, err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	s.l.SetContext(ctx)
+	defer s.l.RemoveContext()
+
+	process := s.l.GetGlobal("process")
+	out := make([]*point, 0, len(points))
+	for _, p := range points {
+		t := luaPoint(s.l, p)
+		top := s.l.GetTop()
+		if err := s.l.CallByParam(lua.P{Fn: process, NRet: lua.MultRet, Protect: true}, t); err != nil {
+			return nil, err
+		}
+		n := s.l.GetTop() - top
+		if n == 0 {
+			q, err := goPoint(t, p)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, q)
+			continue
+		}
+		for i := 1; i <= n; i++ {
+			v := s.l.Get(top + i)
+			if v == lua.LNil || v == lua.LFalse {
+				continue
+			}
+			r, ok := v.(*lua.LTable)
+			if !ok {
+				s.l.SetTop(top)
+				return nil, fmt.Errorf("process returned a %s", v.Type())
+			}
+			q, err := goPoint(r, p)
+			if err != nil {
+				s.l.SetTop(top)
+				return nil, err
+			}
+			out = append(out, q)
+		}
+		s.l.SetTop(top)
+	}
+	return out, nil
+}
+
+func (s *luaScript) apply(points []*point) []*point {
+	s.Lock()
+	defer s.Unlock()
+
+	out, err := s.call(points)
+	if err != nil {
+		jLogError(s.jctx, "", fmt.Sprintf("script %s failed", s.file), err)
+		s.stop()
+		return points
+	}
+	return out
+}
+
+// luaPoint returns the table of the point
+func luaPoint(l *lua.LState, p *point) *lua.LTable {
+	tags := l.NewTable()
+	for k, v := range p.Tags {
+		tags.RawSetString(k, lua.LString(v))
+	}
+	fields := l.NewTable()
+	for k, v := range p.Fields {
+		fields.RawSetString(k, luaValue(v))
+	}
+	t := l.NewTable()
+	t.RawSetString("measurement", lua.LString(p.Measurement))
+	t.RawSetString("tags", tags)
+	t.RawSetString("fields", fields)
+	t.RawSetString("time", lua.LNumber(p.Timestamp.UnixNano()))
+	return t
+}
+
+func luaValue(v interface{}) lua.LValue {
+	switch v := v.(type) {
+	case string:
+		return lua.LString(v)
+	case bool:
+		return lua.LBool(v)
+	}
+	if f, _, ok := numericValue(v); ok {
+		return lua.LNumber(f)
+	}
+	return lua.LString(fmt.Sprint(v))
+}
+
+// goPoint returns the point of the table t, a point returned for orig or
+// orig itself. The fields and the time the script did not change keep their
+// value, the numbers of the fields orig had get their type, integers stay
+// integers unless the script made them fractional. The numbers of new
+// fields are float64.
+func goPoint(t *lua.LTable, orig *point) (*point, error) {
+	p := newPoint(orig.Measurement, map[string]string{}, map[string]interface{}{}, orig.Timestamp)
+	if m, ok := t.RawGetString("measurement").(lua.LString); ok {
+		p.Measurement = string(m)
+	}
+	if tags, ok := t.RawGetString("tags").(*lua.LTable); ok {
+		tags.ForEach(func(k, v lua.LValue) {
+			p.Tags[k.String()] = v.String()
+		})
+	}
+	var err error
+	if fields, ok := t.RawGetString("fields").(*lua.LTable); ok {
+		fields.ForEach(func(k, v lua.LValue) {
+			name := k.String()
+			switch v := v.(type) {
+			case lua.LString:
+				p.Fields[name] = string(v)
+			case lua.LBool:
+				p.Fields[name] = bool(v)
+			case lua.LNumber:
+				p.Fields[name] = fieldNumber(float64(v), orig.Fields[name])
+			default:
+				err = fmt.Errorf("field %s is a %s", name, v.Type())
+			}
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ts, ok := t.RawGetString("time").(lua.LNumber); ok && float64(ts) != float64(orig.Timestamp.UnixNano()) {
+		p.Timestamp = time.Unix(0, int64(ts)).UTC()
+	}
+	return p, nil
+}
+
+// fieldNumber returns f, the number of a field, as the value the field had
+// if it did not change or as the integer type it had
+func fieldNumber(f float64, like interface{}) interface{} {
+	if prev, _, ok := numericValue(like); ok && prev == f {
+		return like
+	}
+	if f != math.Trunc(f) {
+		return f
+	}
+	switch like.(type) {
+	case int64:
+		if f >= math.MinInt64 && f < math.MaxInt64 {
+			return int64(f)
+		}
+	case int:
+		if f >= math.MinInt64 && f < math.MaxInt64 {
+			return int(f)
+		}
+	case int32:
+		if f >= math.MinInt32 && f <= math.MaxInt32 {
+			return int32(f)
+		}
+	case uint64:
+		if f >= 0 && f < math.MaxUint64 {
+			return uint64(f)
+		}
+	case uint32:
+		if f >= 0 && f <= math.MaxUint32 {
+			return uint32(f)
+		}
+	}
+	return f
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLuaScript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	at := time.Unix(1, 0).UTC()
+	in := func() []*point {
+		return []*point{newPoint("/interfaces/", map[string]string{"device": "r1"}, map[string]interface{}{
+			"in-octets": uint64(18446744073709551557),
+			"in-pkts":   int64(7),
+			"load":      float64(1),
+			"name":      "ge-0/0/0",
+		}, at)}
+	}
+	tests := []struct {
+		name   string
+		script string
+		want   []*point
+	}{
+		{
+			name: "modify",
+			script: `function process(p)
+				p.tags.site = "ams"
+				p.fields["in-pkts"] = p.fields["in-pkts"] * 2
+				p.fields.ratio = 0.5
+				p.fields.name = nil
+			end`,
+			want: []*point{newPoint("/interfaces/", map[string]string{"device": "r1", "site": "ams"}, map[string]interface{}{
+				"in-octets": uint64(18446744073709551557),
+				"in-pkts":   int64(14),
+				"load":      float64(1),
+				"ratio":     float64(0.5),
+			}, at)},
+		},
+		{
+			name:   "drop",
+			script: `function process(p) return false end`,
+			want:   []*point{},
+		},
+		{
+			name: "add",
+			script: `function process(p)
+				return p, {measurement = "errors", tags = {device = p.tags.device}, fields = {count = 1}}
+			end`,
+			want: append(in(), newPoint("errors", map[string]string{"device": "r1"}, map[string]interface{}{
+				"count": float64(1),
+			}, at)),
+		},
+		{
+			name: "time",
+			script: `function process(p)
+				p.time = p.time + 1e9
+			end`,
+			want: []*point{newPoint("/interfaces/", map[string]string{"device": "r1"}, in()[0].Fields, at.Add(time.Second))},
+		},
+		{
+			name:   "state",
+			script: `n = 0 function process(p) n = n + 1 p.fields.n = n end`,
+			want: []*point{newPoint("/interfaces/", map[string]string{"device": "r1"}, map[string]interface{}{
+				"in-octets": uint64(18446744073709551557),
+				"in-pkts":   int64(7),
+				"load":      float64(1),
+				"name":      "ge-0/0/0",
+				"n":         float64(1),
+			}, at)},
+		},
+		{
+			name:   "error",
+			script: `function process(p) error("bad point") end`,
+			want:   in(),
+		},
+		{
+			name:   "no os",
+			script: `function process(p) os.execute("true") end`,
+			want:   in(),
+		},
+		{
+			name:   "timeout",
+			script: `function process(p) while true do end end`,
+			want:   in(),
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(dir, test.name+".lua")
+			if err := ioutil.WriteFile(file, []byte(test.script), 0644); err != nil {
+				t.Fatal(err)
+			}
+			jctx := &JCtx{}
+			jctx.config.Transform.Script = ScriptConfig{File: file, Timeout: 200}
+			if err := transformsInit(jctx); err != nil {
+				t.Fatalf("transformsInit failed: %v", err)
+			}
+			out := applyTransforms(jctx, in())
+			if !reflect.DeepEqual(out, test.want) {
+				for _, p := range out {
+					t.Logf("%+v", *p)
+				}
+				t.Errorf("%d: got %v, want %v", i, out, test.want)
+			}
+		})
+	}
+
+	for name, script := range map[string]string{
+		"syntax":     `function process(p`,
+		"no process": `function transform(p) end`,
+		"missing":    "",
+	} {
+		file := filepath.Join(dir, "invalid.lua")
+		if script != "" {
+			if err := ioutil.WriteFile(file, []byte(script), 0644); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			file = filepath.Join(dir, "nonexistent.lua")
+		}
+		jctx := &JCtx{}
+		jctx.config.Transform.Script = ScriptConfig{File: file}
+		if err := transformsInit(jctx); err == nil {
+			t.Errorf("%s: want error, got nil", name)
+		}
+	}
+
+	jctx := &JCtx{}
+	jctx.config.Transform.Script = ScriptConfig{File: "a.lua", Command: []string{"sh"}}
+	if err := transformsInit(jctx); err == nil {
+		t.Errorf("file and command: want error, got nil")
+	}
+}
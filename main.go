@@ -1,10 +1,10 @@
 package main
 
 import (
-	"fmt"
 	"log"
-	"net/http"
-	_ "net/http/pprof"
+	"os"
+	"sync/atomic"
+	"time"
 
 	flag "github.com/spf13/pflag"
 )
@@ -16,6 +16,10 @@ var (
 	print          = flag.Bool("print", false, "Print Telemetry data")
 	outJSON        = flag.Bool("json", false, "Convert telemetry packet into JSON")
 	logMux         = flag.Bool("log-mux-stdout", false, "All logs to stdout")
+	logFormat      = flag.String("log-format", LogFormatText, "Format of the logs (text or json)")
+	logLevel       = flag.String("log-level", LogLevelInfo, "Log level of the workers without one (debug, info, warn or error)")
+	logSyslogTo    = flag.String("log-syslog", "", "Send the logs of JTIMON to syslog (udp://, tcp://, tls://host[:port] or unix:///dev/log)")
+	logSyslogFac   = flag.String("log-syslog-facility", "daemon", "Syslog facility of the logs of JTIMON")
 	maxRun         = flag.Int64("max-run", 0, "Max run time in seconds")
 	stateHandler   = flag.Bool("stats-handler", false, "Use GRPC statshandler")
 	versionOnly    = flag.Bool("version", false, "Print version and build-time of the binary and exit")
@@ -25,53 +29,190 @@ var (
 	promPort       = flag.Int32("prometheus-port", 8090, "Prometheus port")
 	prefixCheck    = flag.Bool("prefix-check", false, "Report missing __prefix__ in telemetry packet")
 	pProf          = flag.Bool("pprof", false, "Profile JTIMON")
-	pProfPort      = flag.Int32("pprof-port", 6060, "Profile port")
+	pProfPort      = flag.Int32("pprof-port", 0, "Port of a profile service of its own, not authenticated, 0 disables")
+	pProfHost      = flag.String("pprof-host", "localhost", "IP to bind the profile service of --pprof-port to")
+	pProfDumpDir   = flag.String("pprof-dump-dir", "", "Directory of periodic CPU and heap profile dumps")
+	pProfDumpIntvl = flag.Int("pprof-dump-interval", 300, "Interval of profile dumps in seconds")
 	noppgoroutines = flag.Bool("no-per-packet-goroutines", false, "Spawn per packet go routines")
 	genTestData    = flag.Bool("generate-test-data", false, "Generate test data")
 	conTestData    = flag.Bool("consume-test-data", false, "Consume test data")
+	memoryLimit    = flag.Int("memory-limit", 0, "Memory budget in MB, updates of low priority paths are dropped when approached")
+	metricsHost    = flag.String("internal-metrics-host", "127.0.0.1", "IP to bind the internal metrics service to")
+	metricsPort    = flag.Int32("internal-metrics-port", 0, "Port of the internal metrics of JTIMON in Prometheus format, 0 disables")
+	metricsSocket  = flag.String("internal-metrics-socket", "", "Unix socket the internal metrics service is served on too, for the users and groups of --api-socket-users and --api-socket-groups")
+	adminHost      = flag.String("admin-host", "127.0.0.1", "IP to bind the gRPC admin service to")
+	adminPort      = flag.Int32("admin-port", 0, "Port of the gRPC admin service of JTIMON (admin/admin.proto), 0 disables")
+	adminSocket    = flag.String("admin-socket", "", "Unix socket the gRPC admin service is served on too, for the users and groups of --api-socket-users and --api-socket-groups")
+	apiSockUsers   = flag.String("api-socket-users", "", "Users (names or uids, separated by commas) allowed on the API sockets, by their peer credentials (default the user of JTIMON)")
+	apiSockGroups  = flag.String("api-socket-groups", "", "Groups (names or gids, separated by commas) allowed on the API sockets, by their peer credentials")
+	readyConnected = flag.Float64("ready-connected", 0, "Fraction of the devices which must be connected for /readyz, 0 to 1")
+	readySinks     = flag.Bool("ready-sinks", true, "/readyz requires the sinks and InfluxDB servers to be writable")
+	apiTLSCert     = flag.String("api-tls-cert", "", "Certificate of the internal metrics and admin services, they serve TLS with it")
+	apiTLSKey      = flag.String("api-tls-key", "", "Key of the certificate of --api-tls-cert")
+	apiTLSClientCA = flag.String("api-tls-client-ca", "", "CA of the client certificates the internal metrics and admin services require")
+	apiTokenFile   = flag.String("api-token-file", "", "File with the bearer token of the control endpoints")
+	apiUsersFile   = flag.String("api-users-file", "", "File with the user:password lines of the basic auth of the control endpoints")
+	apiScopesFile  = flag.String("api-scopes-file", "", "File with the \"name group[,group...]\" lines limiting users and named tokens to the devices of the groups")
+	apiRate        = flag.Float64("api-rate", 0, "Requests per second each client may make to the control endpoints, 0 is no limit")
+	apiBurst       = flag.Int("api-burst", 20, "Requests a client may make at once to the control endpoints with --api-rate")
+	apiAuditFile   = flag.String("api-audit-log", "", "File the changes made over the control endpoints are logged to as JSON lines")
+	auditFile      = flag.String("audit-log", "", "File the config reloads, the changes made over the control endpoints and the credential rotations are logged to as JSON lines")
+	tlsReload      = flag.Int("tls-reload-interval", 60, "Interval in seconds of the checks of the TLS files of the devices, they connect again when the files change, 0 disables")
+	fipsMode       = flag.Bool("fips", false, "FIPS mode: refuse to start without BoringCrypto and refuse the TLS settings which are not FIPS approved")
+	passwordSource = flag.String("password-source", "", "Where the passwords the device configs omit are taken from, keyring and/or prompt in order (e.g. keyring,prompt)")
+	masterKeyFile  = flag.String("master-key-file", "", "File with the base64 master key of the encrypted config files (default $JTIMON_MASTER_KEY or the KMS encrypted $JTIMON_MASTER_KEY_KMS)")
+	spiffeSocket   = flag.String("spiffe-socket", "", "SPIFFE Workload API socket the devices with spiffe get their client certificate from (default $SPIFFE_ENDPOINT_SOCKET)")
+	recentPoints   = flag.Int("recent-points", 0, "Number of the last points of each path kept for /devices/{name}/last, 0 disables")
+	otlpEndpoint   = flag.String("otlp-endpoint", "", "OpenTelemetry collector to export traces of sampled packets to (OTLP/HTTP, e.g. http://127.0.0.1:4318)")
+	traceSample    = flag.Float64("trace-sample", 0.001, "Fraction of the packets traced with --otlp-endpoint")
+	statsdAddr     = flag.String("statsd", "", "StatsD or DogStatsD server (host:port) to push the internal counters of JTIMON to")
+	statsdFormat   = flag.String("statsd-format", StatsdFormatDogStatsD, "Format of the StatsD metrics (dogstatsd with tags, or statsd)")
+	statsdPrefix   = flag.String("statsd-prefix", "jtimon", "Prefix of the StatsD metric names")
+	statsdIntvl    = flag.Int("statsd-interval", 10, "Interval of the StatsD pushes in seconds")
+	summaryFile    = flag.String("summary-file", "", "Write a JSON summary of the run per device and path to the file on exit (- is stdout)")
 
 	jtimonVersion = "version-not-available"
+	gitCommit     = "commit-not-available"
 	buildTime     = "build-time-not-available"
 
 	exporter *jtimonPExporter
 )
 
 func main() {
-	flag.Parse()
-	if *pProf {
-		go func() {
-			addr := fmt.Sprintf("localhost:%d", *pProfPort)
-			log.Println(http.ListenAndServe(addr, nil))
-		}()
+	flag.CommandLine.MarkDeprecated("api-audit-log", "use --audit-log")
+	flag.CommandLine.MarkDeprecated("version", "use jtimon version")
+	flag.CommandLine.MarkDeprecated("explore-config", "use jtimon explore")
+	flag.CommandLine.Usage = func() { usage(os.Stderr) }
+	c, args, err := parseCommand(os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		os.Exit(2)
 	}
+	if c.name != "version" && c.name != "help" {
+		commandInit()
+	}
+	c.run(args)
+}
+
+// runMain runs jtimon run, the workers of the config files
+func runMain() {
 	if *prom {
 		exporter = promInit()
 	}
-
-	log.Printf("Version: %s BuildTime %s\n", jtimonVersion, buildTime)
-	if *versionOnly {
-		return
+	if err := auditInit(); err != nil {
+		log.Fatalf("Audit log: %v", err)
 	}
-
-	if *expConfig {
-		config, err := ExploreConfig()
-		if err == nil {
-			log.Printf("\n%s\n", config)
-		} else {
-			log.Printf("can not generate config")
+	if metricsEnabled() || adminEnabled() {
+		if err := apiSecurityInit(); err != nil {
+			log.Fatalf("API security: %v", err)
 		}
-		return
+	}
+	if *readyConnected < 0 || *readyConnected > 1 {
+		log.Fatalf("--ready-connected must be between 0 and 1")
+	}
+	if metricsEnabled() {
+		internalMetricsInit()
+	}
+	if adminEnabled() {
+		adminInit()
+	}
+	statsdInit()
+	tracingInit()
+	if *memoryLimit > 0 {
+		memGuard = newMemoryGuard(uint64(*memoryLimit) << 20)
+		go memGuard.run(time.Second)
 	}
 
+	log.Printf("Version: %s BuildTime %s\n", jtimonVersion, buildTime)
+	// the config files are optional with discovered devices
 	err := GetConfigFiles(configFiles, *configFileList)
-	if err != nil {
+	if err != nil && (!discoveryEnabled() || *configFileList != "") {
 		log.Printf("config parsing error: %s", err)
 		return
 	}
+	watchers, err := discoveryInit()
+	if err != nil {
+		log.Fatalf("Discovery: %v", err)
+	}
+	if *lintPaths {
+		lintMain(*configFiles)
+	}
 
+	if err := pathSetsInit(); err != nil {
+		log.Fatalf("Path sets: %v", err)
+	}
+	if err := factsInit(); err != nil {
+		log.Fatalf("Facts: %v", err)
+	}
+	if err := haInit(); err != nil {
+		log.Fatalf("HA: %v", err)
+	}
+	if err := clusterInit(); err != nil {
+		log.Fatalf("Cluster: %v", err)
+	}
+	startInit()
+	summaryStart(time.Now())
 	workers := NewJWorkers(*configFiles, *configFileList, *maxRun)
+	workers.watchers = watchers
 	workers.StartWorkers()
+	if err := controlBusInit(workers.SIGHUPWorkers); err != nil {
+		log.Fatalf("Control bus: %v", err)
+	}
+	systemdInit()
 	workers.Wait()
+	haStop()
+	clusterStop()
+	if summaryEnabled() {
+		if err := summaryWrite(*summaryFile, time.Now()); err != nil {
+			log.Printf("Could not write the summary of the run: %v", err)
+		}
+	}
+
+	status := atomic.LoadInt32(&exitStatus)
+	log.Printf("all done ... exiting with status %d", status)
+	os.Exit(int(status))
+}
 
-	log.Printf("all done ... exiting!")
+// exploreMain runs jtimon explore
+func exploreMain() {
+	config, err := ExploreConfig()
+	if err == nil {
+		log.Printf("\n%s\n", config)
+	} else {
+		log.Printf("can not generate config")
+	}
+}
+
+// validateMain runs jtimon validate, it exits with status 1 if a config
+// file is invalid
+func validateMain() {
+	if err := GetConfigFiles(configFiles, *configFileList); err != nil {
+		log.Fatalf("config parsing error: %s", err)
+	}
+	invalid := 0
+	configs := map[string]Config{}
+	for _, file := range *configFiles {
+		if err := ValidateConfigFile(file); err != nil {
+			log.Printf("%s: %v", file, err)
+			invalid++
+			continue
+		}
+		config, err := NewJTIMONConfig(file)
+		if err == nil {
+			err = cidDuplicate(file, config, configs)
+			configs[file] = config
+		}
+		if err != nil {
+			log.Printf("%s: %v", file, err)
+			invalid++
+			continue
+		}
+		log.Printf("%s: ok", file)
+	}
+	if invalid != 0 {
+		log.Printf("%d of %d config files are invalid", invalid, len(*configFiles))
+		os.Exit(1)
+	}
 }
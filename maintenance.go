@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// logsHandler serves the maintenance of the log files on POST:
+//
+//	/logs/rotate    rotates the log files which are not empty now
+//	/logs/reopen    reopens the log files after an external tool moved them,
+//	                as on SIGUSR1
+func logsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if requestScope(r.Context()) != nil {
+		http.Error(w, "the log files are of all devices", http.StatusForbidden)
+		return
+	}
+	switch r.URL.Path {
+	case "/logs/rotate":
+		rotated, err := rotateLogFiles()
+		if err != nil {
+			globalLog(LogLevelError, fmt.Sprintf("Log rotation: %v", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		globalLog(LogLevelInfo, fmt.Sprintf("Rotated the log files %v", rotated))
+		writeJSON(w, struct {
+			Rotated []string `json:"rotated"`
+		}{rotated})
+	case "/logs/reopen":
+		reopenLogFiles()
+		globalLog(LogLevelInfo, "Reopened the log files")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// deviceResetStats starts the stats of the worker over
+func deviceResetStats(w http.ResponseWriter, jctx *JCtx) {
+	jctx.stats.reset(&jctx.drops)
+	jLog(jctx, fmt.Sprintf("%s: stats reset", jctx.config.Host))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deviceFlushStats writes the csv stats of the worker now
+func deviceFlushStats(w http.ResponseWriter, jctx *JCtx) {
+	c := jctx.csv
+	if c == nil {
+		http.Error(w, fmt.Sprintf("no csv stats for %s", jctx.config.Host), http.StatusNotFound)
+		return
+	}
+	if err := c.write(jctx, time.Now()); err != nil {
+		jLogError(jctx, "", "Could not write csv stats", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogsHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the rotated file is read back as it is, not compressed in the background
+	full, err := newRotatingFile(filepath.Join(dir, "r1.log"), LogConfig{Compression: LogCompressionNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer full.Close()
+	empty, err := newRotatingFile(filepath.Join(dir, "r2.log"), LogConfig{Compression: LogCompressionNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer empty.Close()
+	full.Write([]byte("connected\n"))
+
+	post := func(method, url string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		logsHandler(rec, httptest.NewRequest(method, url, nil))
+		return rec
+	}
+	if rec := post("GET", "/logs/rotate"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: got %d", rec.Code)
+	}
+	if rec := post("POST", "/logs/compress"); rec.Code != http.StatusNotFound {
+		t.Errorf("compress: got %d", rec.Code)
+	}
+
+	rec := post("POST", "/logs/rotate")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d %s", rec.Code, rec.Body)
+	}
+	var got struct {
+		Rotated []string `json:"rotated"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	rotated := map[string]bool{}
+	for _, name := range got.Rotated {
+		rotated[name] = true
+	}
+	if !rotated[full.name] || rotated[empty.name] {
+		t.Errorf("got rotated %v", got.Rotated)
+	}
+	full.Write([]byte("disconnected\n"))
+	files, _ := filepath.Glob(full.name + "*")
+	if len(files) != 2 {
+		t.Fatalf("got files %v", files)
+	}
+	for _, f := range files {
+		b, _ := ioutil.ReadFile(f)
+		want := "disconnected\n"
+		if f != full.name {
+			want = "connected\n"
+		}
+		if string(b) != want {
+			t.Errorf("%s: got %q, want %q", f, b, want)
+		}
+	}
+
+	if rec := post("POST", "/logs/reopen"); rec.Code != http.StatusNoContent {
+		t.Errorf("reopen: got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestDeviceStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	started := time.Now().Add(-time.Hour)
+	jctx := &JCtx{file: "r1.json", config: Config{Host: "r1"}, stats: statsCtx{startTime: started}}
+	dropsInit(jctx)
+	defer dropsStop(jctx)
+	jctx.metrics.packets = 3
+	jctx.stats.totalIn = 3
+	jctx.stats.totalKV = 30
+	jctx.stats.totalInPayloadLength = 900
+	jctx.stats.paths.add("/interfaces/", 20, 600, 20*time.Millisecond, true)
+	jctx.stats.gaps.check(seqKey{sensor: "/interfaces/"}, 1, time.Now())
+	jctx.stats.gaps.check(seqKey{sensor: "/interfaces/"}, 5, time.Now())
+	jctx.drops.add("pipeline", 7)
+
+	post := func(url string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		devicesHandler(rec, httptest.NewRequest("POST", url, nil))
+		return rec
+	}
+	if rec := post("/devices/r1/flush-stats"); rec.Code != http.StatusNotFound {
+		t.Errorf("flush without csv stats: got %d", rec.Code)
+	}
+	f, err := newRotatingFile(filepath.Join(dir, "stats.csv"), LogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	jctx.csv = &csvStats{file: f, columns: []string{"device", "packets", "kv"}, perPath: true}
+	if rec := post("/devices/r1/flush-stats"); rec.Code != http.StatusNoContent {
+		t.Errorf("flush: got %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := post("/devices/r1/reset-stats"); rec.Code != http.StatusNoContent {
+		t.Fatalf("reset: got %d %s", rec.Code, rec.Body)
+	}
+	gaps, _ := jctx.stats.gaps.totals()
+	if jctx.stats.totalIn != 0 || jctx.stats.totalKV != 0 || jctx.stats.totalInPayloadLength != 0 {
+		t.Errorf("got %d packets, %d kv and %d bytes after the reset", jctx.stats.totalIn, jctx.stats.totalKV, jctx.stats.totalInPayloadLength)
+	}
+	if len(jctx.stats.paths.paths()) != 0 || gaps != 0 || jctx.drops.get("pipeline") != 0 {
+		t.Errorf("got paths %v, %d gaps and %d drops after the reset", jctx.stats.paths.paths(), gaps, jctx.drops.get("pipeline"))
+	}
+	if !jctx.stats.started().After(started) {
+		t.Errorf("the stats start at %v", jctx.stats.started())
+	}
+	if jctx.metrics.packets != 3 {
+		t.Errorf("got %d packets, the internal metrics are not reset", jctx.metrics.packets)
+	}
+	// the sequences go on
+	if lost := jctx.stats.gaps.check(seqKey{sensor: "/interfaces/"}, 6, time.Now()); lost != 0 {
+		t.Errorf("got %d lost", lost)
+	}
+	if rec := post("/devices/r1/flush-stats"); rec.Code != http.StatusNoContent {
+		t.Errorf("flush: got %d %s", rec.Code, rec.Body)
+	}
+
+	b, err := ioutil.ReadFile(f.name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "r1,3,30\nr1,1,20\nr1,3,0\n"; string(b) != want {
+		t.Errorf("got csv stats %q, want %q", b, want)
+	}
+	rec := httptest.NewRecorder()
+	devicesHandler(rec, httptest.NewRequest("GET", "/devices/r1/reset-stats", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: got %d", rec.Code)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"log"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// memoryGuardHigh is the share of the budget (in percent) above which
+	// one more priority is shed every check
+	memoryGuardHigh = 90
+	// memoryGuardLow is the share of the budget below which one priority
+	// after the other is resumed
+	memoryGuardLow = 70
+	// memoryGuardGCPercent is used while shedding
+	memoryGuardGCPercent = 25
+)
+
+// memGuard is set with --memory-limit
+var memGuard *memoryGuard
+
+// maxPathPriority is the highest priority of the paths of all workers
+var maxPathPriority int32
+
+// memoryGuard sheds load when the memory of jtimon approaches the budget.
+// The updates of the paths with the lowest priority are dropped first (level
+// 1 drops priority 0, level 2 priority 1 and below and so on), the GC runs
+// more often while shedding and the memory is returned to the OS.
+type memoryGuard struct {
+	limit     uint64
+	usage     func() uint64
+	gcPercent int
+	level     int32 // accessed atomically
+}
+
+func newMemoryGuard(limit uint64) *memoryGuard {
+	return &memoryGuard{
+		limit: limit,
+		usage: func() uint64 {
+			var m runtime.MemStats
+			runtime.ReadMemStats(&m)
+			return m.Sys - m.HeapReleased
+		},
+	}
+}
+
+func (g *memoryGuard) run(interval time.Duration) {
+	for range time.NewTicker(interval).C {
+		g.check()
+	}
+}
+
+// check adjusts the shedding level to the memory usage
+func (g *memoryGuard) check() {
+	usage := g.usage()
+	level := atomic.LoadInt32(&g.level)
+	switch {
+	case usage >= g.limit*memoryGuardHigh/100 && level <= atomic.LoadInt32(&maxPathPriority):
+		if level == 0 {
+			g.gcPercent = debug.SetGCPercent(memoryGuardGCPercent)
+		}
+		level++
+		atomic.StoreInt32(&g.level, level)
+		debug.FreeOSMemory()
+		log.Printf("memory usage %d MB of %d MB, shedding updates of paths with priority below %d",
+			usage>>20, g.limit>>20, level)
+	case usage < g.limit*memoryGuardLow/100 && level > 0:
+		level--
+		atomic.StoreInt32(&g.level, level)
+		if level == 0 {
+			debug.SetGCPercent(g.gcPercent)
+			log.Printf("memory usage %d MB of %d MB, shedding stopped", usage>>20, g.limit>>20)
+		} else {
+			log.Printf("memory usage %d MB of %d MB, shedding updates of paths with priority below %d",
+				usage>>20, g.limit>>20, level)
+		}
+	}
+}
+
+// shedUpdate tells whether the update of a path with priority is dropped,
+// the drops are counted by the shed queue of the worker
+func shedUpdate(jctx *JCtx, priority int) bool {
+	g := memGuard
+	if g == nil || int32(priority) >= atomic.LoadInt32(&g.level) {
+		return false
+	}
+	jctx.drops.add("shed", 1)
+	return true
+}
+
+// registerPathPriorities raises maxPathPriority to the paths of cfg
+func registerPathPriorities(cfg *Config) {
+	for _, p := range cfg.Paths {
+		for {
+			max := atomic.LoadInt32(&maxPathPriority)
+			if int32(p.Priority) <= max || atomic.CompareAndSwapInt32(&maxPathPriority, max, int32(p.Priority)) {
+				break
+			}
+		}
+	}
+}
+
+// sensorPath returns the subscribed path of the Junos sensor name, e.g.
+// /junos/system/linecard/interface/ of
+// sensor_1000_1_1:/junos/system/linecard/interface/:/interfaces/:PFE
+func sensorPath(sensor string) string {
+	tokens := strings.Split(sensor, ":")
+	if len(tokens) == 4 {
+		return tokens[1]
+	}
+	return sensor
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestMemoryGuard(t *testing.T) {
+	var usage uint64
+	g := &memoryGuard{limit: 100, usage: func() uint64 { return usage }}
+	memGuard = g
+	defer func() { memGuard = nil }()
+	atomic.StoreInt32(&maxPathPriority, 0)
+	registerPathPriorities(&Config{Paths: []PathsConfig{{Path: "/a", Priority: 1}, {Path: "/b"}}})
+
+	jctx := &JCtx{}
+	steps := []struct {
+		usage uint64
+		level int32
+	}{
+		{usage: 50, level: 0},
+		{usage: 90, level: 1},
+		{usage: 95, level: 2},
+		{usage: 99, level: 2}, // everything is shed already
+		{usage: 80, level: 2},
+		{usage: 60, level: 1},
+		{usage: 60, level: 0},
+		{usage: 60, level: 0},
+	}
+	for i, step := range steps {
+		usage = step.usage
+		g.check()
+		if level := atomic.LoadInt32(&g.level); level != step.level {
+			t.Fatalf("step %d: got level %d, want %d", i, level, step.level)
+		}
+		for priority := 0; priority <= 2; priority++ {
+			if got, want := shedUpdate(jctx, priority), int32(priority) < step.level; got != want {
+				t.Errorf("step %d: priority %d: got shed %v, want %v", i, priority, got, want)
+			}
+		}
+	}
+	if got := jctx.drops.get("shed"); got != 8 {
+		t.Errorf("got %d shed updates, want 8", got)
+	}
+}
+
+func TestPathPriority(t *testing.T) {
+	cfg := &Config{Paths: []PathsConfig{
+		{Path: "/interfaces", Priority: 1},
+		{Path: "/junos/system/linecard/interface/", Priority: 2},
+		{Path: "/junos/system/linecard/interface/logical/usage", Priority: 3},
+	}}
+	tests := []struct {
+		sensor   string
+		priority int
+	}{
+		{sensor: "sensor_1000_5_1:/interfaces/:/interfaces/:xmlproxyd", priority: 1},
+		{sensor: "sensor_1000_1_1:/junos/system/linecard/interface/:/interfaces/:PFE", priority: 2},
+		{sensor: "sensor_1001:/junos/system/linecard/interface/logical/usage/:/junos/system/linecard/interface/logical/usage/:PFE", priority: 3},
+		{sensor: "sensor_1002:/components/:/components/:chassisd", priority: 0},
+		{sensor: "/interfacesX", priority: 0},
+	}
+	for _, test := range tests {
+		if got := newPathTrie(cfg.Paths).lookup(sensorPath(test.sensor)); got != test.priority {
+			t.Errorf("%s: got priority %d, want %d", test.sensor, got, test.priority)
+		}
+	}
+}
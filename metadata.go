@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// MetadataConfig attaches slow changing values of the stream, e.g. the
+// interface description from a low frequency subscription of
+// /interfaces/interface/state/description, as tags to the other points of
+// the same keys. Points are matched on the values of the keys tags (default
+// device and "/interfaces/interface/@name"), a point without all keys is
+// left as it is.
+type MetadataConfig struct {
+	Keys  []string       `json:"keys"`
+	Rules []MetadataRule `json:"rules"`
+}
+
+// MetadataRule remembers the value of the fields matching match (regex)
+// as tag
+type MetadataRule struct {
+	Match string `json:"match"`
+	Tag   string `json:"tag"`
+}
+
+type metadataRule struct {
+	re  *regexp.Regexp
+	tag string
+}
+
+type streamMeta struct {
+	sync.Mutex
+	keys  []string
+	rules []metadataRule
+	tags  map[string]map[string]string
+}
+
+func newMetadataTransformer() *transformer {
+	return &transformer{
+		name: "metadata",
+		new:  newMetadata,
+	}
+}
+
+func newMetadata(jctx *JCtx) (transform, error) {
+	cfg := jctx.config.Transform.Metadata
+	if len(cfg.Rules) == 0 {
+		return nil, nil
+	}
+
+	m := &streamMeta{keys: cfg.Keys, tags: map[string]map[string]string{}}
+	if len(m.keys) == 0 {
+		m.keys = []string{"device", "/interfaces/interface/@name"}
+	}
+	for i, rule := range cfg.Rules {
+		if rule.Tag == "" {
+			return nil, fmt.Errorf("rule %d: tag is missing", i)
+		}
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: invalid match %q: %v", i, rule.Match, err)
+		}
+		m.rules = append(m.rules, metadataRule{re: re, tag: rule.Tag})
+	}
+	return m, nil
+}
+
+// key returns the values of the key tags of p, ok is false if one is missing
+func (m *streamMeta) key(p *point) (key string, ok bool) {
+	values := make([]string, 0, len(m.keys))
+	for _, k := range m.keys {
+		v, ok := p.Tags[k]
+		if !ok {
+			return "", false
+		}
+		values = append(values, v)
+	}
+	return strings.Join(values, "\x00"), true
+}
+
+func (m *streamMeta) learn(key string, p *point) {
+	for k, v := range p.Fields {
+		for _, rule := range m.rules {
+			if !rule.re.MatchString(k) {
+				continue
+			}
+			if m.tags[key] == nil {
+				m.tags[key] = map[string]string{}
+			}
+			m.tags[key][rule.tag] = fmt.Sprint(v)
+			break
+		}
+	}
+}
+
+func (m *streamMeta) apply(points []*point) []*point {
+	m.Lock()
+	defer m.Unlock()
+
+	// learn first so that the metadata applies to the points of the same batch
+	keys := make([]string, len(points))
+	for i, p := range points {
+		key, ok := m.key(p)
+		if !ok {
+			continue
+		}
+		keys[i] = key
+		m.learn(key, p)
+	}
+
+	out := make([]*point, 0, len(points))
+	for i, p := range points {
+		meta := m.tags[keys[i]]
+		if keys[i] == "" || len(meta) == 0 {
+			out = append(out, p)
+			continue
+		}
+		tags := make(map[string]string, len(p.Tags)+len(meta))
+		for k, v := range meta {
+			tags[k] = v
+		}
+		for k, v := range p.Tags {
+			tags[k] = v
+		}
+		out = append(out, newPoint(p.Measurement, tags, p.Fields, p.Timestamp))
+	}
+	return out
+}
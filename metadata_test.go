@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMetadata(t *testing.T) {
+	jctx := &JCtx{}
+	jctx.config.Transform.Metadata = MetadataConfig{
+		Rules: []MetadataRule{{Match: `/state/description$`, Tag: "description"}},
+	}
+	if err := transformsInit(jctx); err != nil {
+		t.Fatalf("transformsInit failed: %v", err)
+	}
+
+	intf := func(name string, fields map[string]interface{}) *point {
+		return newPoint("/interfaces/", map[string]string{"device": "r1", "/interfaces/interface/@name": name},
+			fields, time.Unix(1, 0))
+	}
+	counters := map[string]interface{}{"/interfaces/interface/state/counters/in-octets": 1.0}
+
+	tests := []struct {
+		name string
+		in   []*point
+		want []map[string]string
+	}{
+		{
+			name: "unknown",
+			in:   []*point{intf("et-0/0/0", counters)},
+			want: []map[string]string{{"device": "r1", "/interfaces/interface/@name": "et-0/0/0"}},
+		},
+		{
+			name: "same-batch",
+			in: []*point{
+				intf("et-0/0/0", counters),
+				intf("et-0/0/0", map[string]interface{}{"/interfaces/interface/state/description": "to-ams"}),
+			},
+			want: []map[string]string{
+				{"device": "r1", "/interfaces/interface/@name": "et-0/0/0", "description": "to-ams"},
+				{"device": "r1", "/interfaces/interface/@name": "et-0/0/0", "description": "to-ams"},
+			},
+		},
+		{
+			name: "remembered",
+			in: []*point{
+				intf("et-0/0/0", counters),
+				intf("et-0/0/1", counters),
+				newPoint("/components/", map[string]string{"device": "r1"}, counters, time.Unix(1, 0)),
+			},
+			want: []map[string]string{
+				{"device": "r1", "/interfaces/interface/@name": "et-0/0/0", "description": "to-ams"},
+				{"device": "r1", "/interfaces/interface/@name": "et-0/0/1"},
+				{"device": "r1"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := applyTransforms(jctx, test.in)
+			if len(out) != len(test.want) {
+				t.Fatalf("want %d points, got %d", len(test.want), len(out))
+			}
+			for i, p := range out {
+				if !reflect.DeepEqual(p.Tags, test.want[i]) {
+					t.Errorf("point %d\ngot:  %v\nwant: %v", i, p.Tags, test.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,531 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	migrateFrom = flag.String("from", "telegraf", "What the configs jtimon migrate converts are of, only telegraf")
+	migrateDir  = flag.String("migrate-dir", ".", "Directory jtimon migrate writes the config files of the devices to")
+)
+
+// migratedConfig is the config file jtimon migrate writes of a device, the
+// fields of Config it sets
+type migratedConfig struct {
+	Host      string             `json:"host"`
+	Port      int                `json:"port"`
+	User      string             `json:"user,omitempty"`
+	Password  string             `json:"password,omitempty"`
+	CID       string             `json:"cid,omitempty"`
+	TLS       *migratedTLS       `json:"tls,omitempty"`
+	Influx    *migratedInflux    `json:"influx,omitempty"`
+	Transform *migratedTransform `json:"transform,omitempty"`
+	Paths     []migratedPath     `json:"paths"`
+}
+
+type migratedTLS struct {
+	ClientCrt  string `json:"clientcrt,omitempty"`
+	ClientKey  string `json:"clientkey,omitempty"`
+	CA         string `json:"ca,omitempty"`
+	ServerName string `json:"servername,omitempty"`
+	SkipVerify bool   `json:"skip-verify,omitempty"`
+}
+
+type migratedInflux struct {
+	Server          string           `json:"server"`
+	Port            int              `json:"port"`
+	Dbname          string           `json:"dbname,omitempty"`
+	User            string           `json:"user,omitempty"`
+	Password        string           `json:"password,omitempty"`
+	RetentionPolicy string           `json:"retention-policy,omitempty"`
+	Mirrors         []InfluxEndpoint `json:"mirrors,omitempty"`
+}
+
+type migratedTransform struct {
+	Sanitize struct {
+		Preset string `json:"preset"`
+	} `json:"sanitize"`
+}
+
+type migratedPath struct {
+	Path string `json:"path"`
+	Freq uint64 `json:"freq"`
+}
+
+// telegrafTable reads the options of a table of a Telegraf config, it keeps
+// the first error and the options which were read
+type telegrafTable struct {
+	name string
+	t    map[string]interface{}
+	read map[string]bool
+	err  error
+}
+
+func newTelegrafTable(name string, t map[string]interface{}) *telegrafTable {
+	return &telegrafTable{name: name, t: t, read: map[string]bool{}}
+}
+
+func (t *telegrafTable) get(key string) (interface{}, bool) {
+	t.read[key] = true
+	v, ok := t.t[key]
+	return v, ok
+}
+
+func (t *telegrafTable) fail(key string, want string) {
+	if t.err == nil {
+		t.err = fmt.Errorf("%s: %s is not %s", t.name, key, want)
+	}
+}
+
+func (t *telegrafTable) str(key string) string {
+	v, ok := t.get(key)
+	if !ok {
+		return ""
+	}
+	s, ok := v.(string)
+	if !ok {
+		t.fail(key, "a string")
+	}
+	return s
+}
+
+func (t *telegrafTable) strs(key string) []string {
+	v, ok := t.get(key)
+	if !ok {
+		return nil
+	}
+	a, ok := v.([]interface{})
+	if !ok {
+		t.fail(key, "an array of strings")
+		return nil
+	}
+	var ss []string
+	for _, e := range a {
+		s, ok := e.(string)
+		if !ok {
+			t.fail(key, "an array of strings")
+			return nil
+		}
+		ss = append(ss, s)
+	}
+	return ss
+}
+
+func (t *telegrafTable) boolean(key string) bool {
+	v, ok := t.get(key)
+	if !ok {
+		return false
+	}
+	b, ok := v.(bool)
+	if !ok {
+		t.fail(key, "a boolean")
+	}
+	return b
+}
+
+// duration reads a duration of Telegraf, a string like "10s" or a number
+// of seconds
+func (t *telegrafTable) duration(key string) time.Duration {
+	v, ok := t.get(key)
+	if !ok {
+		return 0
+	}
+	switch v := v.(type) {
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			t.fail(key, "a duration")
+		}
+		return d
+	case int64:
+		return time.Duration(v) * time.Second
+	case float64:
+		return time.Duration(v * float64(time.Second))
+	}
+	t.fail(key, "a duration")
+	return 0
+}
+
+func (t *telegrafTable) tables(key string) []*telegrafTable {
+	v, ok := t.get(key)
+	if !ok {
+		return nil
+	}
+	a, ok := v.([]map[string]interface{})
+	if !ok {
+		t.fail(key, "an array of tables")
+		return nil
+	}
+	var tables []*telegrafTable
+	for i, e := range a {
+		tables = append(tables, newTelegrafTable(fmt.Sprintf("%s.%s[%d]", t.name, key, i), e))
+	}
+	return tables
+}
+
+// unread warns of the options which were not read, jtimon has none like them
+func (t *telegrafTable) unread() []string {
+	var keys []string
+	for k := range t.t {
+		if !t.read[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var warnings []string
+	for _, k := range keys {
+		if t.name == "" {
+			warnings = append(warnings, fmt.Sprintf("%s is not migrated", k))
+		} else {
+			warnings = append(warnings, fmt.Sprintf("%s: %s is not migrated", t.name, k))
+		}
+	}
+	return warnings
+}
+
+// tls reads the TLS options of a Telegraf input, nil if it has none. jtimon
+// needs the CA of the devices or skip-verify, it does not use the system
+// roots.
+func (t *telegrafTable) tls() (*migratedTLS, []string) {
+	enable := t.boolean("enable_tls") || t.boolean("tls_enable")
+	c := &migratedTLS{
+		ClientCrt:  t.str("tls_cert"),
+		ClientKey:  t.str("tls_key"),
+		CA:         t.str("tls_ca"),
+		ServerName: t.str("tls_server_name"),
+		SkipVerify: t.boolean("insecure_skip_verify"),
+	}
+	if *c == (migratedTLS{}) {
+		if enable {
+			return nil, []string{fmt.Sprintf("%s: TLS with the system roots is not migrated, set tls ca", t.name)}
+		}
+		return nil, nil
+	}
+	if c.CA == "" && !c.SkipVerify {
+		return c, []string{fmt.Sprintf("%s: TLS with the system roots is not migrated, set tls ca", t.name)}
+	}
+	return c, nil
+}
+
+// migration is the config files of the devices converted so far, in the
+// order of their addresses
+type migration struct {
+	configs  []*migratedConfig
+	devices  map[string]*migratedConfig
+	warnings []string
+}
+
+// device returns the config of the address host:port, the inputs of the
+// same address are merged
+func (m *migration) device(name, address string) (*migratedConfig, error) {
+	if c, ok := m.devices[address]; ok {
+		return c, nil
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("%s: address %s: %v", name, address, err)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, fmt.Errorf("%s: address %s: invalid port", name, address)
+	}
+	c := &migratedConfig{Host: host, Port: p}
+	m.devices[address] = c
+	m.configs = append(m.configs, c)
+	return c, nil
+}
+
+// login sets the credentials of an input of the device, the ones it has are
+// kept when the input has none
+func (c *migratedConfig) login(user, password, cid string, tlsc *migratedTLS) {
+	if user != "" {
+		c.User, c.Password = user, password
+	}
+	if cid != "" {
+		c.CID = cid
+	}
+	if tlsc != nil {
+		c.TLS = tlsc
+	}
+}
+
+func (m *migration) warn(warnings ...string) {
+	m.warnings = append(m.warnings, warnings...)
+}
+
+// gnmi converts an inputs.gnmi of Telegraf. jtimon subscribes with the
+// OpenConfig telemetry RPC of Junos, served on the same port as gNMI, and
+// names the fields like the input with the telegraf preset of sanitize.
+func (m *migration) gnmi(t *telegrafTable) error {
+	addresses := t.strs("addresses")
+	user, password := t.str("username"), t.str("password")
+	tlsc, warnings := t.tls()
+	m.warn(warnings...)
+	var paths []migratedPath
+	for _, s := range t.tables("subscription") {
+		path := s.str("path")
+		if path != "" && !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		p := migratedPath{Path: path}
+		switch mode := s.str("subscription_mode"); mode {
+		case "on_change":
+		case "", "sample", "target_defined":
+			p.Freq = uint64(s.duration("sample_interval") / time.Millisecond)
+			if mode == "target_defined" {
+				m.warn(fmt.Sprintf("%s: subscription_mode target_defined is migrated as sample", s.name))
+			}
+		default:
+			return fmt.Errorf("%s: unknown subscription_mode %q", s.name, mode)
+		}
+		s.get("name")
+		s.get("origin")
+		if s.err != nil {
+			return s.err
+		}
+		if path == "" {
+			return fmt.Errorf("%s: no path", s.name)
+		}
+		paths = append(paths, p)
+		m.warn(s.unread()...)
+	}
+	if t.err != nil {
+		return t.err
+	}
+	for _, a := range addresses {
+		c, err := m.device(t.name, a)
+		if err != nil {
+			return err
+		}
+		c.login(user, password, "", tlsc)
+		c.Transform = &migratedTransform{}
+		c.Transform.Sanitize.Preset = "telegraf"
+		c.Paths = append(c.Paths, paths...)
+	}
+	m.warn(t.unread()...)
+	return nil
+}
+
+// jti converts an inputs.jti_openconfig_telemetry of Telegraf. Its sensors
+// are paths, optionally preceded by their sample frequency and by the name
+// of their measurement.
+func (m *migration) jti(t *telegrafTable) error {
+	servers := t.strs("servers")
+	user, password, cid := t.str("username"), t.str("password"), t.str("client_id")
+	freq := t.duration("sample_frequency")
+	tlsc, warnings := t.tls()
+	m.warn(warnings...)
+	var paths []migratedPath
+	for _, sensor := range t.strs("sensors") {
+		tokens := strings.Fields(sensor)
+		f := freq
+		if len(tokens) != 0 {
+			if d, err := time.ParseDuration(tokens[0]); err == nil {
+				f, tokens = d, tokens[1:]
+			}
+		}
+		if len(tokens) != 0 && !strings.HasPrefix(tokens[0], "/") {
+			m.warn(fmt.Sprintf("%s: measurement %s of sensor %q is not migrated", t.name, tokens[0], sensor))
+			tokens = tokens[1:]
+		}
+		if len(tokens) == 0 {
+			return fmt.Errorf("%s: sensor %q has no path", t.name, sensor)
+		}
+		for _, path := range tokens {
+			paths = append(paths, migratedPath{Path: path, Freq: uint64(f / time.Millisecond)})
+		}
+	}
+	if t.err != nil {
+		return t.err
+	}
+	for _, a := range servers {
+		c, err := m.device(t.name, a)
+		if err != nil {
+			return err
+		}
+		c.login(user, password, cid, tlsc)
+		c.Paths = append(c.Paths, paths...)
+	}
+	m.warn(t.unread()...)
+	return nil
+}
+
+// influxdb converts the first outputs.influxdb of Telegraf into the influx
+// of the devices, its other URLs are mirrors
+func (m *migration) influxdb(t *telegrafTable) (*migratedInflux, error) {
+	urls := t.strs("urls")
+	if u := t.str("url"); u != "" {
+		urls = append([]string{u}, urls...)
+	}
+	user, password := t.str("username"), t.str("password")
+	database, rp := t.str("database"), t.str("retention_policy")
+	if t.err != nil {
+		return nil, t.err
+	}
+	if len(urls) == 0 {
+		urls = []string{"http://localhost:8086"}
+	}
+	c := &migratedInflux{Dbname: database, User: user, Password: password, RetentionPolicy: rp}
+	if c.Dbname == "" {
+		c.Dbname = "telegraf"
+	}
+	for i, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil || u.Hostname() == "" {
+			return nil, fmt.Errorf("%s: invalid url %q", t.name, raw)
+		}
+		if u.Scheme != "http" {
+			m.warn(fmt.Sprintf("%s: url %s is migrated as http", t.name, raw))
+		}
+		port := 8086
+		if u.Port() != "" {
+			port, _ = strconv.Atoi(u.Port())
+		}
+		if i == 0 {
+			c.Server, c.Port = u.Hostname(), port
+		} else {
+			c.Mirrors = append(c.Mirrors, InfluxEndpoint{Server: u.Hostname(), Port: port, User: user, Password: password})
+		}
+	}
+	m.warn(t.unread()...)
+	return c, nil
+}
+
+// migrateTelegraf converts the gnmi and jti_openconfig_telemetry inputs of
+// the Telegraf config into the configs of their devices, which write into
+// the first influxdb output. The warnings are the options not migrated.
+func migrateTelegraf(b []byte) ([]*migratedConfig, []string, error) {
+	doc, err := parseTOML(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	m := &migration{devices: map[string]*migratedConfig{}}
+	root := newTelegrafTable("", doc)
+	inputs := newTelegrafTable("inputs", map[string]interface{}{})
+	if t, ok := doc["inputs"].(map[string]interface{}); ok {
+		inputs.t = t
+	}
+	for _, t := range inputs.tables("gnmi") {
+		if err := m.gnmi(t); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, t := range inputs.tables("jti_openconfig_telemetry") {
+		if err := m.jti(t); err != nil {
+			return nil, nil, err
+		}
+	}
+	if inputs.err != nil {
+		return nil, nil, inputs.err
+	}
+	if len(m.configs) == 0 {
+		return nil, nil, fmt.Errorf("no gnmi or jti_openconfig_telemetry input")
+	}
+	m.warn(inputs.unread()...)
+
+	if t, ok := doc["outputs"].(map[string]interface{}); ok {
+		outputs := newTelegrafTable("outputs", t)
+		influxdbs := outputs.tables("influxdb")
+		if outputs.err != nil {
+			return nil, nil, outputs.err
+		}
+		if len(influxdbs) > 1 {
+			m.warn(fmt.Sprintf("outputs.influxdb: the %d outputs after the first are not migrated", len(influxdbs)-1))
+		}
+		if len(influxdbs) != 0 {
+			influx, err := m.influxdb(influxdbs[0])
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, c := range m.configs {
+				c.Influx = influx
+			}
+		}
+		m.warn(outputs.unread()...)
+	}
+	root.read["inputs"], root.read["outputs"] = true, true
+	m.warn(root.unread()...)
+	return m.configs, m.warnings, nil
+}
+
+// migratedFiles are the names of the config files of the devices, {host}.json
+// or {host}-{port}.json if several devices have the host
+func migratedFiles(configs []*migratedConfig) []string {
+	hosts := map[string]int{}
+	for _, c := range configs {
+		hosts[c.Host]++
+	}
+	var files []string
+	for _, c := range configs {
+		name := strings.Replace(c.Host, ":", "_", -1)
+		if hosts[c.Host] > 1 {
+			name += "-" + strconv.Itoa(c.Port)
+		}
+		files = append(files, name+".json")
+	}
+	return files
+}
+
+// migrateMain runs jtimon migrate on the config files, it writes the config
+// files of their devices to --migrate-dir and exits with status 1 if one of
+// them could not be converted
+func migrateMain(args []string) {
+	if *migrateFrom != "telegraf" {
+		log.Printf("migrate: unknown --from %q, only telegraf is supported", *migrateFrom)
+		os.Exit(1)
+	}
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "jtimon migrate: no config file to convert, run \"jtimon help migrate\"\n")
+		os.Exit(1)
+	}
+	failed := false
+	for _, file := range args {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Printf("migrate: %v", err)
+			failed = true
+			continue
+		}
+		configs, warnings, err := migrateTelegraf(b)
+		if err != nil {
+			log.Printf("migrate: %s: %v", file, err)
+			failed = true
+			continue
+		}
+		for _, w := range warnings {
+			log.Printf("migrate: %s: %s", file, w)
+		}
+		files := migratedFiles(configs)
+		for i, c := range configs {
+			b, err := json.MarshalIndent(c, "", "    ")
+			if err != nil {
+				log.Printf("migrate: %v", err)
+				failed = true
+				continue
+			}
+			out := filepath.Join(*migrateDir, files[i])
+			if err := ioutil.WriteFile(out, append(b, '\n'), 0600); err != nil {
+				log.Printf("migrate: %v", err)
+				failed = true
+				continue
+			}
+			log.Printf("wrote %s (%d paths)", out, len(c.Paths))
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
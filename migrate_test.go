@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMigrateTelegraf(t *testing.T) {
+	in := `[agent]
+  interval = "10s"
+
+[[outputs.influxdb]]
+  urls = ["http://influx1:8086", "https://influx2"]
+  database = "telemetry"
+  username = "telegraf"
+
+[[inputs.gnmi]]
+  addresses = ["r1:32767", "r2:32767"]
+  username = "jtimon"
+  password = "secret"
+  encoding = "proto"
+  tls_ca = "/etc/ssl/ca.pem"
+  [[inputs.gnmi.subscription]]
+    name = "counters"
+    origin = "openconfig"
+    path = "/interfaces/interface/state/counters"
+    sample_interval = "10s"
+  [[inputs.gnmi.subscription]]
+    name = "oper"
+    path = "interfaces/interface/state/oper-status"
+    subscription_mode = "on_change"
+
+[[inputs.jti_openconfig_telemetry]]
+  servers = ["r3:50051", "r1:32767"]
+  client_id = "telegraf"
+  sample_frequency = "1000ms"
+  enable_tls = true
+  sensors = [
+    "/interfaces/",
+    "2000ms collection /components/ /lldp/",
+  ]
+`
+	configs, warnings, err := migrateTelegraf([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(configs)
+	influx := `"influx":{"server":"influx1","port":8086,"dbname":"telemetry","user":"telegraf",` +
+		`"mirrors":[{"server":"influx2","port":8086,"user":"telegraf","password":""}]}`
+	gnmi := `"paths":[{"path":"/interfaces/interface/state/counters","freq":10000},{"path":"/interfaces/interface/state/oper-status","freq":0}`
+	want := `[{"host":"r1","port":32767,"user":"jtimon","password":"secret","cid":"telegraf","tls":{"ca":"/etc/ssl/ca.pem"},` + influx + `,"transform":{"sanitize":{"preset":"telegraf"}},` +
+		gnmi + `,{"path":"/interfaces/","freq":1000},{"path":"/components/","freq":2000},{"path":"/lldp/","freq":2000}]},` +
+		`{"host":"r2","port":32767,"user":"jtimon","password":"secret","tls":{"ca":"/etc/ssl/ca.pem"},` + influx +
+		`,"transform":{"sanitize":{"preset":"telegraf"}},` + gnmi + `]},` +
+		`{"host":"r3","port":50051,"cid":"telegraf",` + influx +
+		`,"paths":[{"path":"/interfaces/","freq":1000},{"path":"/components/","freq":2000},{"path":"/lldp/","freq":2000}]}]`
+	if string(b) != want {
+		t.Errorf("migrateTelegraf() =\n%s\nwant\n%s", b, want)
+	}
+	wantWarnings := []string{
+		"inputs.gnmi[0]: encoding is not migrated",
+		"inputs.jti_openconfig_telemetry[0]: TLS with the system roots is not migrated, set tls ca",
+		`inputs.jti_openconfig_telemetry[0]: measurement collection of sensor "2000ms collection /components/ /lldp/" is not migrated`,
+		"outputs.influxdb[0]: url https://influx2 is migrated as http",
+		"agent is not migrated",
+	}
+	if !reflect.DeepEqual(warnings, wantWarnings) {
+		t.Errorf("migrateTelegraf() warnings =\n%q\nwant\n%q", warnings, wantWarnings)
+	}
+}
+
+func TestMigrateTelegrafErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		err  string
+	}{
+		{"no input", "[[inputs.cpu]]\n", "no gnmi or jti_openconfig_telemetry input"},
+		{"syntax", "[[inputs.gnmi]\n", "line 1: expected ']'"},
+		{"address", "[[inputs.gnmi]]\naddresses = [\"r1\"]\n", "inputs.gnmi[0]: address r1: address r1: missing port in address"},
+		{"port", "[[inputs.gnmi]]\naddresses = [\"r1:gnmi\"]\n", "inputs.gnmi[0]: address r1:gnmi: invalid port"},
+		{"type", "[[inputs.gnmi]]\naddresses = \"r1:32767\"\n", "inputs.gnmi[0]: addresses is not an array of strings"},
+		{"mode", "[[inputs.gnmi]]\naddresses = [\"r1:32767\"]\n[[inputs.gnmi.subscription]]\npath = \"/a\"\nsubscription_mode = \"poll\"\n",
+			"inputs.gnmi[0].subscription[0]: unknown subscription_mode \"poll\""},
+		{"interval", "[[inputs.gnmi]]\naddresses = [\"r1:32767\"]\n[[inputs.gnmi.subscription]]\npath = \"/a\"\nsample_interval = \"10\"\n",
+			"inputs.gnmi[0].subscription[0]: sample_interval is not a duration"},
+		{"sensor", "[[inputs.jti_openconfig_telemetry]]\nservers = [\"r1:32767\"]\nsensors = [\"1s name\"]\n",
+			"inputs.jti_openconfig_telemetry[0]: sensor \"1s name\" has no path"},
+		{"url", "[[inputs.gnmi]]\naddresses = [\"r1:32767\"]\n[[outputs.influxdb]]\nurls = [\"influx1\"]\n",
+			"outputs.influxdb[0]: invalid url \"influx1\""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, _, err := migrateTelegraf([]byte(test.in)); err == nil || err.Error() != test.err {
+				t.Errorf("migrateTelegraf() error = %v, want %s", err, test.err)
+			}
+		})
+	}
+}
+
+func TestMigratedFiles(t *testing.T) {
+	configs := []*migratedConfig{
+		{Host: "r1", Port: 32767},
+		{Host: "r2", Port: 32767},
+		{Host: "r2", Port: 50051},
+		{Host: "2001:db8::1", Port: 32767},
+	}
+	want := []string{"r1.json", "r2-32767.json", "r2-50051.json", "2001_db8__1.json"}
+	if got := migratedFiles(configs); !reflect.DeepEqual(got, want) {
+		t.Errorf("migratedFiles() = %q, want %q", got, want)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 
+	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 )
 
@@ -14,6 +15,7 @@ type vendor struct {
 	sendLoginCheck     func(*JCtx, *grpc.ClientConn) error
 	dialExt            func(*JCtx) grpc.DialOption
 	subscribe          func(*grpc.ClientConn, *JCtx, chan<- bool) SubErrorCode
+	get                func(context.Context, *grpc.ClientConn, *JCtx, string) ([]*point, bool, error)
 }
 
 func getVendor(jctx *JCtx) (*vendor, error) {
@@ -37,6 +39,7 @@ func newJuniperJUNOS() *vendor {
 		sendLoginCheck:     loginCheckJunos,
 		dialExt:            nil,
 		subscribe:          subscribeJunos,
+		get:                getJunos,
 	}
 }
 
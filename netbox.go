@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	netboxURL    = flag.String("netbox", "", "NetBox whose devices are discovered and collected with the config of --discovery-template (e.g. https://netbox.example.com), with the API token of $NETBOX_TOKEN")
+	netboxFilter = flag.String("netbox-filter", "", "Filters of the devices of --netbox as in the query of /api/dcim/devices/ (e.g. tag=jti&role=core&site=ams1)")
+)
+
+// netboxPageSize is the number of devices asked for per page
+const netboxPageSize = 1000
+
+// netboxSource finds the devices of the DCIM of NetBox matching the filters
+type netboxSource struct {
+	client *http.Client
+	// base is the URL of NetBox, e.g. https://netbox.example.com
+	base   string
+	filter url.Values
+	token  string
+}
+
+func newNetboxSource(base, filter string) (*netboxSource, error) {
+	u, err := url.Parse(base)
+	if err != nil || u.Host == "" || u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid --netbox %q: not an http:// or https:// URL", base)
+	}
+	q, err := url.ParseQuery(filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --netbox-filter %q: %v", filter, err)
+	}
+	return &netboxSource{
+		client: &http.Client{Timeout: 30 * time.Second},
+		base:   strings.TrimSuffix(base, "/"),
+		filter: q,
+		token:  os.Getenv("NETBOX_TOKEN"),
+	}, nil
+}
+
+func (n *netboxSource) name() string {
+	return "netbox"
+}
+
+// netboxRef is a nested object of a device, e.g. its site
+type netboxRef struct {
+	Slug string `json:"slug"`
+}
+
+func (r *netboxRef) slug() string {
+	if r == nil {
+		return ""
+	}
+	return r.Slug
+}
+
+// netboxDevice is a device of /api/dcim/devices/, its role is device_role
+// before NetBox 3.6
+type netboxDevice struct {
+	Name      string `json:"name"`
+	PrimaryIP *struct {
+		Address string `json:"address"`
+	} `json:"primary_ip"`
+	Site         *netboxRef             `json:"site"`
+	Role         *netboxRef             `json:"role"`
+	DeviceRole   *netboxRef             `json:"device_role"`
+	Platform     *netboxRef             `json:"platform"`
+	Tags         []netboxRef            `json:"tags"`
+	CustomFields map[string]interface{} `json:"custom_fields"`
+}
+
+// devices returns the devices with a name and a primary IP, the address is
+// the primary IP without its prefix length
+func (n *netboxSource) devices() ([]discoveredDevice, error) {
+	q := url.Values{}
+	for k, v := range n.filter {
+		q[k] = v
+	}
+	if q.Get("limit") == "" {
+		q.Set("limit", fmt.Sprint(netboxPageSize))
+	}
+	next := n.base + "/api/dcim/devices/?" + q.Encode()
+	devices := []discoveredDevice{}
+	for next != "" {
+		var page struct {
+			Next    *string        `json:"next"`
+			Results []netboxDevice `json:"results"`
+		}
+		if err := n.get(next, &page); err != nil {
+			return nil, err
+		}
+		for _, d := range page.Results {
+			if d.Name == "" || d.PrimaryIP == nil {
+				continue
+			}
+			dev := discoveredDevice{
+				Name:     d.Name,
+				Address:  strings.SplitN(d.PrimaryIP.Address, "/", 2)[0],
+				Site:     d.Site.slug(),
+				Role:     d.Role.slug(),
+				Platform: d.Platform.slug(),
+				Tags:     []string{},
+				Meta:     map[string]string{},
+			}
+			if dev.Role == "" {
+				dev.Role = d.DeviceRole.slug()
+			}
+			for _, t := range d.Tags {
+				dev.Tags = append(dev.Tags, t.Slug)
+			}
+			for k, v := range d.CustomFields {
+				if v != nil {
+					dev.Meta[k] = fmt.Sprint(v)
+				}
+			}
+			devices = append(devices, dev)
+		}
+		next = ""
+		if page.Next != nil {
+			next = *page.Next
+		}
+	}
+	return devices, nil
+}
+
+// get decodes the JSON of the page of the API
+func (n *netboxSource) get(page string, out interface{}) error {
+	req, err := http.NewRequest("GET", page, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if n.token != "" {
+		req.Header.Set("Authorization", "Token "+n.token)
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("netbox GET /api/dcim/devices/: %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("netbox GET /api/dcim/devices/: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestNetboxDevices(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/dcim/devices/" || r.Header.Get("Authorization") != "Token secret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if q := r.URL.Query(); q.Get("tag") != "jti" || q.Get("limit") != "1000" {
+			t.Errorf("query %s", r.URL.RawQuery)
+		}
+		if r.URL.Query().Get("offset") == "" {
+			fmt.Fprintf(w, `{"count": 3, "next": "%s/api/dcim/devices/?tag=jti&limit=1000&offset=2", "results": [
+				{"name": "r1", "primary_ip": {"address": "10.0.0.1/32"}, "site": {"slug": "ams1"}, "role": {"slug": "core"},
+				 "platform": {"slug": "junos"}, "tags": [{"slug": "jti"}], "custom_fields": {"jti_port": 32767, "unset": null}},
+				{"name": "r2", "primary_ip": null}]}`, srv.URL)
+			return
+		}
+		fmt.Fprint(w, `{"count": 3, "next": null, "results": [
+			{"name": "r3", "primary_ip": {"address": "2001:db8::3/128"}, "site": {"slug": "fra1"}, "device_role": {"slug": "edge"}, "platform": null, "tags": []}]}`)
+	}))
+	defer srv.Close()
+
+	n, err := newNetboxSource(srv.URL+"/", "tag=jti")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.devices(); err == nil {
+		t.Errorf("devices() without the token did not fail")
+	}
+	n.token = "secret"
+	devices, err := n.devices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []discoveredDevice{
+		{Name: "r1", Address: "10.0.0.1", Site: "ams1", Role: "core", Platform: "junos", Tags: []string{"jti"}, Meta: map[string]string{"jti_port": "32767"}},
+		{Name: "r3", Address: "2001:db8::3", Site: "fra1", Role: "edge", Tags: []string{}, Meta: map[string]string{}},
+	}
+	if !reflect.DeepEqual(devices, want) {
+		t.Errorf("devices() = %+v, want %+v", devices, want)
+	}
+
+	for _, base := range []string{"", "netbox.example.com", "ftp://netbox.example.com"} {
+		if _, err := newNetboxSource(base, ""); err == nil {
+			t.Errorf("newNetboxSource(%q) did not fail", base)
+		}
+	}
+}
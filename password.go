@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Sources of the passwords the device configs omit
+const (
+	PasswordSourceKeyring = "keyring"
+	PasswordSourcePrompt  = "prompt"
+)
+
+// keyringService is the service of the passwords of jtimon in the OS keyring
+const keyringService = "jtimon"
+
+// keyringCommand returns the command which writes the password of account in
+// the OS keyring to its stdout, the macOS keychain or the Secret Service of
+// the Linux desktops (secret-tool of libsecret)
+var keyringCommand = func(service, account string) ([]string, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"security", "find-generic-password", "-s", service, "-a", account, "-w"}, nil
+	case "linux", "freebsd", "openbsd", "netbsd":
+		return []string{"secret-tool", "lookup", "service", service, "account", account}, nil
+	}
+	return nil, fmt.Errorf("no OS keyring on %s", runtime.GOOS)
+}
+
+var (
+	// promptIn and promptOut are the terminal of the password prompts
+	promptIn  io.Reader = os.Stdin
+	promptOut io.Writer = os.Stderr
+	// promptTTY tells whether the prompts can be answered
+	promptTTY = func() bool {
+		info, err := os.Stdin.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0
+	}
+	// promptEcho turns the echo of the terminal on and off
+	promptEcho = func(on bool) {
+		arg := "-echo"
+		if on {
+			arg = "echo"
+		}
+		cmd := exec.Command("stty", arg)
+		cmd.Stdin = os.Stdin
+		cmd.Run()
+	}
+)
+
+// prompted are the passwords answered to the prompts by user@host, the
+// devices are asked once, the reloads reuse them
+var prompted = struct {
+	sync.Mutex
+	passwords map[string]string
+}{passwords: map[string]string{}}
+
+// passwordSources returns the sources of --password-source in order
+func passwordSources() ([]string, error) {
+	var sources []string
+	for _, s := range strings.Split(*passwordSource, ",") {
+		s = strings.TrimSpace(s)
+		switch s {
+		case "":
+			continue
+		case PasswordSourceKeyring, PasswordSourcePrompt:
+			sources = append(sources, s)
+		default:
+			return nil, fmt.Errorf("invalid password source %q, want %s or %s", s, PasswordSourceKeyring, PasswordSourcePrompt)
+		}
+	}
+	return sources, nil
+}
+
+// missingPassword returns the password of a device whose config has a user
+// and no password from the sources of --password-source, the first one
+// which has it
+func missingPassword(config Config) (string, error) {
+	sources, err := passwordSources()
+	if err != nil || len(sources) == 0 {
+		return "", err
+	}
+	account := config.User + "@" + config.Host
+	var errs []string
+	for _, source := range sources {
+		var password string
+		switch source {
+		case PasswordSourceKeyring:
+			password, err = keyringPassword(account)
+		case PasswordSourcePrompt:
+			password, err = promptPassword(account)
+		}
+		if err == nil && password != "" {
+			return password, nil
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", source, err))
+		}
+	}
+	if len(errs) > 0 {
+		return "", fmt.Errorf("no password for %s (%s)", account, strings.Join(errs, ", "))
+	}
+	return "", fmt.Errorf("no password for %s", account)
+}
+
+// keyringPassword reads the password of account from the OS keyring
+func keyringPassword(account string) (string, error) {
+	command, err := keyringCommand(keyringService, account)
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s: %v %s", command[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// promptPassword asks for the password of account on the terminal, without
+// echo, the workers ask one after the other
+func promptPassword(account string) (string, error) {
+	prompted.Lock()
+	defer prompted.Unlock()
+	if password, ok := prompted.passwords[account]; ok {
+		return password, nil
+	}
+	if !promptTTY() {
+		return "", fmt.Errorf("stdin is not a terminal")
+	}
+
+	fmt.Fprintf(promptOut, "Password for %s: ", account)
+	promptEcho(false)
+	password, err := readLine(promptIn)
+	promptEcho(true)
+	fmt.Fprintln(promptOut)
+	if err != nil {
+		return "", err
+	}
+	if password != "" {
+		prompted.passwords[account] = password
+	}
+	return password, nil
+}
+
+// readLine reads a line byte by byte, nothing past it is consumed for the
+// next prompts
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n == 1 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF && len(line) > 0 {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimRight(string(line), "\r"), nil
+}
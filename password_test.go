@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMissingPassword(t *testing.T) {
+	defer func(source string) { *passwordSource = source }(*passwordSource)
+	defer func(f func(string, string) ([]string, error)) { keyringCommand = f }(keyringCommand)
+	defer func(tty func() bool, echo func(bool)) { promptTTY, promptEcho = tty, echo }(promptTTY, promptEcho)
+	defer func(in io.Reader, out io.Writer) { promptIn, promptOut = in, out }(promptIn, promptOut)
+
+	// the keyring has the password of jtimon@r1 only
+	keyringCommand = func(service, account string) ([]string, error) {
+		return []string{"sh", "-c", `[ "$0 $1" = "jtimon jtimon@r1" ] && echo keyring-secret || { echo not found >&2; exit 1; }`, service, account}, nil
+	}
+	var echo []bool
+	promptEcho = func(on bool) { echo = append(echo, on) }
+
+	tests := []struct {
+		name   string
+		source string
+		host   string
+		tty    bool
+		input  string
+		want   string
+		err    string
+	}{
+		{name: "no source", host: "r1", want: ""},
+		{name: "keyring", source: "keyring", host: "r1", want: "keyring-secret"},
+		{name: "keyring missing", source: "keyring", host: "r2", err: "not found"},
+		{name: "prompt", source: "prompt", host: "r3", tty: true, input: "typed\nnext\n", want: "typed"},
+		{name: "prompt asked once", source: "prompt", host: "r3", tty: true, input: "", want: "typed"},
+		{name: "prompt no tty", source: "prompt", host: "r4", input: "typed\n", err: "not a terminal"},
+		{name: "keyring then prompt", source: "keyring, prompt", host: "r5", tty: true, input: "typed-r5\r\n", want: "typed-r5"},
+		{name: "keyring first", source: "keyring,prompt", host: "r1", want: "keyring-secret"},
+		{name: "invalid", source: "vault", host: "r1", err: "invalid password source"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			*passwordSource = test.source
+			tty := test.tty
+			promptTTY = func() bool { return tty }
+			promptIn = strings.NewReader(test.input)
+			var out bytes.Buffer
+			promptOut = &out
+
+			got, err := DecodePassword(&JCtx{}, Config{Host: test.host, User: "jtimon"})
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("got %q %v, want error %s", got, err, test.err)
+				}
+				return
+			}
+			if err != nil || got != test.want {
+				t.Errorf("got %q %v, want %q", got, err, test.want)
+			}
+			if test.input != "" && !strings.Contains(out.String(), "Password for jtimon@"+test.host) {
+				t.Errorf("prompt %q", out.String())
+			}
+		})
+	}
+	if len(echo) != 4 || echo[0] || !echo[1] {
+		t.Errorf("echo %v", echo)
+	}
+
+	// the passwords of the configs are kept
+	*passwordSource = "prompt"
+	if got, err := DecodePassword(&JCtx{}, Config{Host: "r6", User: "jtimon", Password: "file"}); err != nil || got != "file" {
+		t.Errorf("got %q %v", got, err)
+	}
+}
+
+func TestReadLine(t *testing.T) {
+	r := strings.NewReader("first\r\nsecond\nlast")
+	for _, want := range []string{"first", "second", "last"} {
+		if got, err := readLine(r); err != nil || got != want {
+			t.Errorf("got %q %v, want %q", got, err, want)
+		}
+	}
+	if _, err := readLine(r); err == nil {
+		t.Errorf("no error at EOF")
+	}
+}
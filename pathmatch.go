@@ -0,0 +1,184 @@
+package main
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// prefixTrie matches strings against many literal prefixes and exact
+// strings at once, the cost depends on the length of the string and not on
+// the number of literals
+type prefixTrie struct {
+	children map[byte]*prefixTrie
+	prefix   bool
+	exact    bool
+}
+
+func (t *prefixTrie) insert(s string, exact bool) {
+	n := t
+	for i := 0; i < len(s); i++ {
+		c, ok := n.children[s[i]]
+		if !ok {
+			if n.children == nil {
+				n.children = map[byte]*prefixTrie{}
+			}
+			c = &prefixTrie{}
+			n.children[s[i]] = c
+		}
+		n = c
+	}
+	if exact {
+		n.exact = true
+	} else {
+		n.prefix = true
+	}
+}
+
+func (t *prefixTrie) match(s string) bool {
+	n := t
+	for i := 0; ; i++ {
+		if n.prefix {
+			return true
+		}
+		if i == len(s) {
+			return n.exact
+		}
+		if n = n.children[s[i]]; n == nil {
+			return false
+		}
+	}
+}
+
+// anchoredLiteral returns the literal of the regex if it only matches
+// strings starting with the literal (^literal) or the literal itself
+// (^literal$)
+func anchoredLiteral(re *regexp.Regexp) (literal string, exact bool, ok bool) {
+	r, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return "", false, false
+	}
+	r = r.Simplify()
+	if r.Op != syntax.OpConcat || len(r.Sub) < 2 || len(r.Sub) > 3 {
+		return "", false, false
+	}
+	begin, lit := r.Sub[0], r.Sub[1]
+	if begin.Op != syntax.OpBeginText || lit.Op != syntax.OpLiteral || lit.Flags&syntax.FoldCase != 0 {
+		return "", false, false
+	}
+	if len(r.Sub) == 3 {
+		if r.Sub[2].Op != syntax.OpEndText {
+			return "", false, false
+		}
+		exact = true
+	}
+	return string(lit.Rune), exact, true
+}
+
+// regexSet matches a string against a list of regexes. The anchored
+// literals (^/interfaces/, ^/interfaces$), the usual way to match paths,
+// are matched in a prefixTrie, only the others one by one.
+type regexSet struct {
+	trie *prefixTrie
+	rest []*regexp.Regexp
+	n    int
+}
+
+func newRegexSet(list []*regexp.Regexp) *regexSet {
+	s := &regexSet{n: len(list)}
+	for _, re := range list {
+		if literal, exact, ok := anchoredLiteral(re); ok {
+			if s.trie == nil {
+				s.trie = &prefixTrie{}
+			}
+			s.trie.insert(literal, exact)
+			continue
+		}
+		s.rest = append(s.rest, re)
+	}
+	return s
+}
+
+func (s *regexSet) len() int {
+	return s.n
+}
+
+func (s *regexSet) match(str string) bool {
+	if s.trie != nil && s.trie.match(str) {
+		return true
+	}
+	return matchAny(s.rest, str)
+}
+
+// pathTrie holds the priorities of the configured paths by path element,
+// the priority of a path is the one of the longest configured path which is
+// the path or a parent of it
+type pathTrie struct {
+	children map[string]*pathTrie
+	path     string
+	priority int
+	set      bool
+}
+
+func newPathTrie(paths []PathsConfig) *pathTrie {
+	t := &pathTrie{}
+	for _, p := range paths {
+		n := t
+		for _, elem := range strings.Split(strings.TrimSuffix(p.Path, "/"), "/") {
+			c, ok := n.children[elem]
+			if !ok {
+				if n.children == nil {
+					n.children = map[string]*pathTrie{}
+				}
+				c = &pathTrie{}
+				n.children[elem] = c
+			}
+			n = c
+		}
+		// the first of the same paths wins
+		if !n.set {
+			n.path, n.priority, n.set = p.Path, p.Priority, true
+		}
+	}
+	return t
+}
+
+// lookup returns the priority of path, 0 if no configured path is the path
+// or a parent of it
+func (t *pathTrie) lookup(path string) int {
+	_, priority := t.match(path)
+	return priority
+}
+
+// match returns the longest configured path which is the path or a parent
+// of it and its priority, "" and 0 if there is none
+func (t *pathTrie) match(path string) (string, int) {
+	if t == nil {
+		return "", 0
+	}
+	var match *pathTrie
+	n := t
+	path = strings.TrimSuffix(path, "/")
+	for {
+		var elem string
+		i := strings.IndexByte(path, '/')
+		if i < 0 {
+			elem, path = path, ""
+		} else {
+			elem, path = path[:i], path[i+1:]
+		}
+		if n = n.children[elem]; n == nil {
+			break
+		}
+		if n.set {
+			match = n
+		}
+		if i < 0 {
+			break
+		}
+	}
+	if match == nil {
+		return "", 0
+	}
+	return match.path, match.priority
+}
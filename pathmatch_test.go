@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+)
+
+func TestAnchoredLiteral(t *testing.T) {
+	tests := []struct {
+		expr    string
+		literal string
+		exact   bool
+		ok      bool
+	}{
+		{"^/interfaces/", "/interfaces/", false, true},
+		{"^/interfaces$", "/interfaces", true, true},
+		{`^/a\[x\]`, "/a[x]", false, true},
+		{"/interfaces", "", false, false},
+		{"^/a.b", "", false, false},
+		{"(?i)^/abc", "", false, false},
+		{"^/a|^/b", "", false, false},
+	}
+	for _, test := range tests {
+		literal, exact, ok := anchoredLiteral(regexp.MustCompile(test.expr))
+		if literal != test.literal || exact != test.exact || ok != test.ok {
+			t.Errorf("%s: got %q %v %v, want %q %v %v", test.expr, literal, exact, ok, test.literal, test.exact, test.ok)
+		}
+	}
+}
+
+func TestRegexSet(t *testing.T) {
+	exprs := []string{"^/interfaces/", "^/junos/system$", "linecard", "^/a.b", "(?i)^/BGP"}
+	list, err := compileRegexList("test", exprs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := newRegexSet(list)
+	if set.len() != len(exprs) || len(set.rest) != 3 {
+		t.Errorf("got len %d with %d regexes, want %d with 3", set.len(), len(set.rest), len(exprs))
+	}
+
+	for _, s := range []string{
+		"/interfaces/", "/interfaces/interface", "/interfaces", "/junos/system", "/junos/system/",
+		"/junos/system/linecard/interface/", "/a-b", "/ab", "/bgp/neighbors", "", "/",
+	} {
+		if got, want := set.match(s), matchAny(list, s); got != want {
+			t.Errorf("%q: got %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestPathTrie(t *testing.T) {
+	paths := []PathsConfig{
+		{Path: "/interfaces/", Priority: 1},
+		{Path: "/interfaces/interface/subinterfaces", Priority: 3},
+		{Path: "/junos/system/linecard/packet/usage"},
+		{Path: "/network-instances", Priority: 2},
+		{Path: "/network-instances", Priority: 5},
+	}
+	trie := newPathTrie(paths)
+	for _, path := range []string{
+		"/interfaces", "/interfaces/", "/interfaces/interface", "/interfacesX",
+		"/interfaces/interface/subinterfaces/subinterface", "/junos/system/linecard/packet/usage/",
+		"/network-instances/network-instance", "/bgp", "", "/",
+	} {
+		// the longest of the configured paths matching at a path element
+		// boundary, the first of equal ones
+		want, wantPath, n := 0, "", -1
+		for _, p := range paths {
+			pp := p.Path
+			if pp[len(pp)-1] == '/' {
+				pp = pp[:len(pp)-1]
+			}
+			tp := path
+			if len(tp) > 0 && tp[len(tp)-1] == '/' {
+				tp = tp[:len(tp)-1]
+			}
+			if (tp == pp || len(tp) > len(pp) && tp[:len(pp)+1] == pp+"/") && len(pp) > n {
+				want, wantPath, n = p.Priority, p.Path, len(pp)
+			}
+		}
+		if got := trie.lookup(path); got != want {
+			t.Errorf("%q: got priority %d, want %d", path, got, want)
+		}
+		if got, _ := trie.match(path); got != wantPath {
+			t.Errorf("%q: got path %q, want %q", path, got, wantPath)
+		}
+	}
+	var nilTrie *pathTrie
+	if nilTrie.lookup("/interfaces") != 0 {
+		t.Errorf("nil trie priority is not 0")
+	}
+}
+
+func BenchmarkRegexSet(b *testing.B) {
+	var exprs []string
+	for i := 0; i < 500; i++ {
+		exprs = append(exprs, fmt.Sprintf("^/junos/system/linecard/sensor-%d/", i))
+	}
+	list, _ := compileRegexList("bench", exprs)
+	path := "/interfaces/interface/state/counters/"
+
+	b.Run("regexes", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			matchAny(list, path)
+		}
+	})
+	b.Run("set", func(b *testing.B) {
+		set := newRegexSet(list)
+		for i := 0; i < b.N; i++ {
+			set.match(path)
+		}
+	})
+}
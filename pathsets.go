@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	flag "github.com/spf13/pflag"
+)
+
+var pathSetsFile = flag.String("path-sets", "", "File with the named path sets and the path sets of the device groups, the paths of the devices are completed with those of their path-sets and groups")
+
+// PathSets are the path sets of --path-sets, e.g. "core-v1", and the path
+// sets of the device groups, e.g. "core-routers": {"path-sets": ["core-v1"]}
+type PathSets struct {
+	Sets   map[string][]PathsConfig `json:"path-sets"`
+	Groups map[string]PathSetsGroup `json:"groups"`
+}
+
+// PathSetsGroup is a device group of --path-sets
+type PathSetsGroup struct {
+	PathSets []string `json:"path-sets"`
+}
+
+// readPathSets reads and checks the path sets of file
+func readPathSets(file string) (PathSets, error) {
+	var p PathSets
+	f, err := readConfigFile(file)
+	if err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(f, &p); err != nil {
+		return p, fmt.Errorf("%s: %v", file, err)
+	}
+	for name, paths := range p.Sets {
+		for _, path := range paths {
+			if path.Path == "" {
+				return p, fmt.Errorf("%s: path set %s has a path without path", file, name)
+			}
+		}
+	}
+	for group, g := range p.Groups {
+		for _, set := range g.PathSets {
+			if _, ok := p.Sets[set]; !ok {
+				return p, fmt.Errorf("%s: group %s uses path set %s which is not defined", file, group, set)
+			}
+		}
+	}
+	return p, nil
+}
+
+// pathSetsInit checks the file of --path-sets, it is read again with each
+// config so that a SIGHUP applies its changes
+func pathSetsInit() error {
+	if *pathSetsFile == "" {
+		return nil
+	}
+	_, err := readPathSets(*pathSetsFile)
+	return err
+}
+
+// expandPathSets completes the paths of the config with the paths of the
+// path sets of its groups, then of its path-sets. A path of the config
+// replaces the one of a path set, as a path of a later set replaces the one
+// of an earlier set.
+func expandPathSets(config *Config) error {
+	if *pathSetsFile == "" {
+		if len(config.PathSets) != 0 {
+			return fmt.Errorf("path-sets %v without --path-sets", config.PathSets)
+		}
+		return nil
+	}
+	if len(config.PathSets) == 0 && len(config.Groups) == 0 {
+		return nil
+	}
+	p, err := readPathSets(*pathSetsFile)
+	if err != nil {
+		return err
+	}
+	var sets []string
+	for _, group := range config.Groups {
+		sets = append(sets, p.Groups[group].PathSets...)
+	}
+	for _, set := range config.PathSets {
+		if _, ok := p.Sets[set]; !ok {
+			return fmt.Errorf("path set %s is not defined in %s", set, *pathSetsFile)
+		}
+		sets = append(sets, set)
+	}
+	if len(sets) == 0 {
+		return nil
+	}
+
+	var paths []PathsConfig
+	index := map[string]int{}
+	add := func(path PathsConfig) {
+		if i, ok := index[path.Path]; ok {
+			paths[i] = path
+			return
+		}
+		index[path.Path] = len(paths)
+		paths = append(paths, path)
+	}
+	for _, set := range sets {
+		for _, path := range p.Sets[set] {
+			add(path)
+		}
+	}
+	for _, path := range config.Paths {
+		add(path)
+	}
+	config.Paths = paths
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpandPathSets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-pathsets-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "path-sets.json")
+	err = ioutil.WriteFile(file, []byte(`{
+		"path-sets": {
+			"core-v1": [{"path": "/interfaces/", "freq": 10000}, {"path": "/bgp/", "freq": 30000}],
+			"mpls": [{"path": "/mpls/", "freq": 60000}, {"path": "/bgp/", "freq": 60000}]
+		},
+		"groups": {"core-routers": {"path-sets": ["core-v1"]}}
+	}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := *pathSetsFile
+	defer func() { *pathSetsFile = old }()
+	*pathSetsFile = file
+	if err := pathSetsInit(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		config Config
+		want   []PathsConfig
+		err    bool
+	}{
+		{name: "no set", config: Config{Paths: []PathsConfig{{Path: "/junos/system/"}}},
+			want: []PathsConfig{{Path: "/junos/system/"}}},
+		{name: "group", config: Config{Groups: []string{"core-routers"}, Paths: []PathsConfig{{Path: "/junos/system/"}}},
+			want: []PathsConfig{{Path: "/interfaces/", Freq: 10000}, {Path: "/bgp/", Freq: 30000}, {Path: "/junos/system/"}}},
+		{name: "group without path set", config: Config{Groups: []string{"edge"}}},
+		{name: "group and path set", config: Config{Groups: []string{"core-routers"}, PathSets: []string{"mpls"}},
+			want: []PathsConfig{{Path: "/interfaces/", Freq: 10000}, {Path: "/bgp/", Freq: 60000}, {Path: "/mpls/", Freq: 60000}}},
+		{name: "path of the config", config: Config{Groups: []string{"core-routers"}, Paths: []PathsConfig{{Path: "/bgp/", Freq: 5000}}},
+			want: []PathsConfig{{Path: "/interfaces/", Freq: 10000}, {Path: "/bgp/", Freq: 5000}}},
+		{name: "unknown path set", config: Config{PathSets: []string{"core-v2"}}, err: true},
+	}
+	for _, test := range tests {
+		config := test.config
+		err := expandPathSets(&config)
+		if (err != nil) != test.err {
+			t.Errorf("%s: got error %v", test.name, err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(config.Paths, test.want) {
+			t.Errorf("%s: got paths %+v, want %+v", test.name, config.Paths, test.want)
+		}
+	}
+
+	*pathSetsFile = ""
+	if err := expandPathSets(&Config{PathSets: []string{"core-v1"}}); err == nil {
+		t.Errorf("path-sets without --path-sets: want an error")
+	}
+}
+
+func TestReadPathSets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-pathsets-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, content := range []string{
+		`{"path-sets": {"core-v1": [{"freq": 10000}]}}`,
+		`{"path-sets": {"core-v1": []}, "groups": {"core-routers": {"path-sets": ["core-v2"]}}}`,
+		`{"path-sets": []}`,
+	} {
+		file := filepath.Join(dir, "path-sets.json")
+		if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readPathSets(file); err == nil {
+			t.Errorf("%s: want an error", content)
+		}
+	}
+}
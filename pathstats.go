@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pathCounters are the stats of one subscription path, accessed atomically
+type pathCounters struct {
+	packets  uint64
+	kv       uint64
+	bytes    uint64
+	latency  latencyHistogram
+	sizeHist sizeHistogram
+}
+
+// pathStats breaks the stats of a worker down by subscription path
+type pathStats struct {
+	sync.Mutex
+	m map[string]*pathCounters
+}
+
+func (s *pathStats) counters(path string) *pathCounters {
+	s.Lock()
+	defer s.Unlock()
+	c, ok := s.m[path]
+	if !ok {
+		if s.m == nil {
+			s.m = map[string]*pathCounters{}
+		}
+		c = &pathCounters{}
+		s.m[path] = c
+	}
+	return c
+}
+
+// add counts one packet of path with kv key values and size bytes, latency
+// is the time from the timestamp of the packet to its receipt, if known
+func (s *pathStats) add(path string, kv, size int, latency time.Duration, known bool) {
+	c := s.counters(path)
+	atomic.AddUint64(&c.packets, 1)
+	atomic.AddUint64(&c.kv, uint64(kv))
+	atomic.AddUint64(&c.bytes, uint64(size))
+	c.sizeHist.observe(uint64(size))
+	if known {
+		// clocks of the device and the collector may be apart, observe
+		// counts negative latencies as 0
+		c.latency.observe(latency)
+	}
+}
+
+// latency returns the number and the sum of the latencies of all paths
+func (s *pathStats) latency() (uint64, time.Duration) {
+	var count uint64
+	var sum time.Duration
+	for _, p := range s.paths() {
+		h := &s.counters(p).latency
+		count += atomic.LoadUint64(&h.count)
+		sum += time.Duration(atomic.LoadUint64(&h.sum))
+	}
+	return count, sum
+}
+
+// reset forgets the stats of all paths
+func (s *pathStats) reset() {
+	s.Lock()
+	s.m = nil
+	s.Unlock()
+}
+
+// paths returns the paths with stats, sorted
+func (s *pathStats) paths() []string {
+	s.Lock()
+	paths := make([]string, 0, len(s.m))
+	for p := range s.m {
+		paths = append(paths, p)
+	}
+	s.Unlock()
+	sort.Strings(paths)
+	return paths
+}
+
+// table describes the stats of the paths, one line per path sorted by path
+func (s *pathStats) table() string {
+	paths := s.paths()
+	if len(paths) == 0 {
+		return ""
+	}
+
+	t := fmt.Sprintf("%-50s | %12s | %12s | %14s | %8s | %8s | %8s\n", "Path", "Packets", "KV", "Bytes",
+		"p50(ms)", "p95(ms)", "p99(ms)")
+	for _, p := range paths {
+		c := s.counters(p)
+		latency := []string{"-", "-", "-"}
+		if atomic.LoadUint64(&c.latency.count) != 0 {
+			for i, d := range c.latency.percentiles(50, 95, 99) {
+				latency[i] = fmt.Sprintf("%.1f", float64(d)/float64(time.Millisecond))
+			}
+		}
+		t += fmt.Sprintf("%-50s | %12v | %12v | %14v | %8s | %8s | %8s\n", p, atomic.LoadUint64(&c.packets),
+			atomic.LoadUint64(&c.kv), atomic.LoadUint64(&c.bytes), latency[0], latency[1], latency[2])
+	}
+	return t
+}
+
+// pathStatsEnabled tells whether the stats of the paths of the worker are
+// kept, for --stats-handler, the internal metrics, StatsD, the summary of the
+// run or the self-telemetry
+func pathStatsEnabled(jctx *JCtx) bool {
+	return *stateHandler || metricsEnabled() || *statsdAddr != "" || summaryEnabled() || jctx.self != nil
+}
+
+// updatePathStats counts a packet of the subscription path, sent is the
+// timestamp of the packet in milliseconds (0 if it has none) and rtime the
+// time it was received. It is called if pathStatsEnabled only.
+func updatePathStats(jctx *JCtx, path string, kv, size int, sent uint64, rtime time.Time) {
+	var latency time.Duration
+	if sent != 0 {
+		latency = rtime.Sub(time.Unix(0, int64(sent)*int64(time.Millisecond)))
+	}
+	jctx.stats.paths.add(path, kv, size, latency, sent != 0)
+}
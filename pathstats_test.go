@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPathStats(t *testing.T) {
+	jctx := &JCtx{}
+	rtime := time.Date(2020, 3, 1, 10, 30, 0, 0, time.UTC)
+	sent := uint64(rtime.UnixNano() / int64(time.Millisecond))
+
+	updatePathStats(jctx, "/interfaces/", 10, 500, sent-20, rtime)
+	updatePathStats(jctx, "/interfaces/", 6, 300, sent-40, rtime)
+	updatePathStats(jctx, "/bgp/", 3, 100, 0, rtime)
+	// the clock of the device is ahead
+	updatePathStats(jctx, "/junos/system/", 1, 50, sent+1000, rtime)
+
+	lines := strings.Split(strings.TrimSpace(jctx.stats.paths.table()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines: %v", len(lines), lines)
+	}
+	tests := []struct {
+		fields []string
+	}{
+		{[]string{"/bgp/", "1", "3", "100", "-", "-", "-"}},
+		{[]string{"/interfaces/", "2", "16", "800", "20.0", "39.9", "39.9"}},
+		{[]string{"/junos/system/", "1", "1", "50", "0.0", "0.0", "0.0"}},
+	}
+	for i, test := range tests {
+		var got []string
+		for _, f := range strings.Split(lines[i+1], "|") {
+			got = append(got, strings.TrimSpace(f))
+		}
+		if strings.Join(got, " ") != strings.Join(test.fields, " ") {
+			t.Errorf("got %v, want %v", got, test.fields)
+		}
+	}
+
+	var empty pathStats
+	if s := empty.table(); s != "" {
+		t.Errorf("got table %q without paths", s)
+	}
+}
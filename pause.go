@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+
+	"golang.org/x/net/context"
+)
+
+// pauseState is what the operator paused of a worker: the whole device or
+// some of its paths. Paused paths are left out of the subscription, a
+// paused device is not connected to until it is resumed. The config is kept.
+type pauseState struct {
+	sync.Mutex
+	// resumed is closed when the device is resumed, nil if it is not paused
+	resumed chan struct{}
+	paths   map[string]bool
+}
+
+// pauseDevice pauses the device, it returns false if it was paused already
+func (p *pauseState) pauseDevice() bool {
+	p.Lock()
+	defer p.Unlock()
+	if p.resumed != nil {
+		return false
+	}
+	p.resumed = make(chan struct{})
+	return true
+}
+
+// resumeDevice resumes the device, it returns false if it was not paused
+func (p *pauseState) resumeDevice() bool {
+	p.Lock()
+	defer p.Unlock()
+	if p.resumed == nil {
+		return false
+	}
+	close(p.resumed)
+	p.resumed = nil
+	return true
+}
+
+// setPath pauses or resumes the path, it returns false if it was already
+func (p *pauseState) setPath(path string, paused bool) bool {
+	p.Lock()
+	defer p.Unlock()
+	if p.paths[path] == paused {
+		return false
+	}
+	if paused {
+		if p.paths == nil {
+			p.paths = map[string]bool{}
+		}
+		p.paths[path] = true
+	} else {
+		delete(p.paths, path)
+	}
+	return true
+}
+
+// active returns the paths which are not paused
+func (p *pauseState) active(paths []PathsConfig) []PathsConfig {
+	p.Lock()
+	defer p.Unlock()
+	if len(p.paths) == 0 {
+		return paths
+	}
+	active := make([]PathsConfig, 0, len(paths))
+	for _, path := range paths {
+		if !p.paths[path.Path] {
+			active = append(active, path)
+		}
+	}
+	return active
+}
+
+// state returns whether the device is paused and the paused paths, sorted
+func (p *pauseState) state() (bool, []string) {
+	p.Lock()
+	defer p.Unlock()
+	paths := []string{}
+	for path := range p.paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return p.resumed != nil, paths
+}
+
+// waitResumed blocks while the device or all of its paths are paused, the
+// instance is the standby of --ha or the device is assigned to another
+// member of --cluster, it returns false if the worker is interrupted
+// meanwhile
+func waitResumed(jctx *JCtx) bool {
+	logged := ""
+	for {
+		jctx.paused.Lock()
+		resumed := jctx.paused.resumed
+		jctx.paused.Unlock()
+		elected := ha.standby()
+		owner, changed := cluster.assigned(jctx)
+		if resumed == nil && elected == nil && changed == nil && (len(jctx.config.Paths) == 0 || len(jctx.paused.active(jctx.config.Paths)) != 0) {
+			return true
+		}
+		var msg string
+		switch {
+		case elected != nil:
+			msg = fmt.Sprintf("Standby, not collecting from %s until elected", jctx.config.Host)
+		case changed != nil && owner == "":
+			msg = fmt.Sprintf("Not collecting from %s until this instance joins the cluster", jctx.config.Host)
+		case changed != nil:
+			msg = fmt.Sprintf("Not collecting from %s, it is assigned to %s", jctx.config.Host, owner)
+		default:
+			msg = fmt.Sprintf("Collection from %s is paused", jctx.config.Host)
+		}
+		if msg != logged {
+			jLog(jctx, msg)
+			logged = msg
+		}
+		select {
+		case <-resumed:
+		case <-elected:
+		case <-changed:
+		case s := <-jctx.control:
+			if s == os.Interrupt {
+				return false
+			}
+			// a path is resumed or the config is changed
+		}
+	}
+}
+
+// resubscribe makes the worker subscribe again if it is streaming, or
+// check the pause state again if it is paused
+func resubscribe(jctx *JCtx) {
+	select {
+	case jctx.control <- syscall.SIGHUP:
+	default:
+	}
+}
+
+// setPaused pauses or resumes the device or, if path is set, the path of
+// the worker. It returns false if nothing changed.
+func setPaused(jctx *JCtx, path string, paused bool) bool {
+	var changed bool
+	switch {
+	case path != "":
+		changed = jctx.paused.setPath(path, paused)
+	case paused:
+		changed = jctx.paused.pauseDevice()
+	default:
+		changed = jctx.paused.resumeDevice()
+	}
+	if !changed {
+		return false
+	}
+
+	what := "collection"
+	if path != "" {
+		what = "path " + path
+	}
+	typ, msg := EventPause, fmt.Sprintf("%s paused", what)
+	if !paused {
+		typ, msg = EventResume, fmt.Sprintf("%s resumed", what)
+	}
+	jLog(jctx, fmt.Sprintf("%s: %s", jctx.config.Host, msg))
+	recordEvent(jctx, typ, "", msg)
+	if path != "" || paused {
+		resubscribe(jctx)
+	}
+	return true
+}
+
+// devicePause is the pause state of a worker served by /pause
+type devicePause struct {
+	Device string   `json:"device"`
+	Port   int      `json:"port"`
+	Paused bool     `json:"paused"`
+	Paths  []string `json:"paused-paths"`
+}
+
+func workerPause(jctx *JCtx) devicePause {
+	paused, paths := jctx.paused.state()
+	return devicePause{Device: jctx.config.Host, Port: jctx.config.Port, Paused: paused, Paths: paths}
+}
+
+// pauseHandler serves the pause state of the workers on GET and pauses
+// (/pause) or resumes (/resume) the device of the device query parameter, or
+// its path of the path query parameter, on POST
+func pauseHandler(w http.ResponseWriter, r *http.Request) {
+	paused := r.URL.Path == "/pause"
+	device, path := r.URL.Query().Get("device"), r.URL.Query().Get("path")
+	switch r.Method {
+	case "GET":
+	case "POST":
+		if device == "" {
+			http.Error(w, "device is missing", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	scope := requestScope(r.Context())
+	workers := scope.filter(deviceWorkers(device))
+	if r.Method == "POST" {
+		if workers = pauseWorkers(r.Context(), device, path, paused); len(workers) == 0 {
+			http.Error(w, "no such device or path", http.StatusNotFound)
+			return
+		}
+	}
+	devices := []devicePause{}
+	for _, jctx := range workers {
+		devices = append(devices, workerPause(jctx))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Devices []devicePause `json:"devices"`
+	}{devices})
+}
+
+// pauseWorkers pauses or resumes the workers of the device in the scope of
+// the request of ctx, or their path if set, and returns them sorted, without
+// those which do not have the path
+func pauseWorkers(ctx context.Context, device, path string, paused bool) []*JCtx {
+	var workers []*JCtx
+	for _, jctx := range requestScope(ctx).filter(deviceWorkers(device)) {
+		// a paused path which is no longer configured can be resumed
+		if _, pausedPaths := jctx.paused.state(); path != "" && !configuredPath(jctx, path) &&
+			!StringInSlice(path, pausedPaths) {
+			continue
+		}
+		before := workerPause(jctx)
+		setPaused(jctx, path, paused)
+		auditChange(ctx, jctx.config.Host, before, workerPause(jctx))
+		workers = append(workers, jctx)
+	}
+	return workers
+}
+
+// configuredPath tells whether path is a subscription path of the worker
+func configuredPath(jctx *JCtx, path string) bool {
+	for _, p := range jctx.config.Paths {
+		if p.Path == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPauseStateActive(t *testing.T) {
+	paths := []PathsConfig{{Path: "/interfaces/"}, {Path: "/bgp/"}, {Path: "/junos/system/"}}
+	var p pauseState
+	if got := p.active(paths); !reflect.DeepEqual(got, paths) {
+		t.Errorf("nothing paused: got %v", got)
+	}
+	if !p.setPath("/bgp/", true) || p.setPath("/bgp/", true) {
+		t.Errorf("pausing /bgp/ twice: want one change")
+	}
+	want := []PathsConfig{{Path: "/interfaces/"}, {Path: "/junos/system/"}}
+	if got := p.active(paths); !reflect.DeepEqual(got, want) {
+		t.Errorf("/bgp/ paused: got %v, want %v", got, want)
+	}
+	p.setPath("/bgp/", false)
+	if got := p.active(paths); !reflect.DeepEqual(got, paths) {
+		t.Errorf("/bgp/ resumed: got %v", got)
+	}
+	if !p.pauseDevice() || p.pauseDevice() || !p.resumeDevice() || p.resumeDevice() {
+		t.Errorf("pausing and resuming the device twice: want one change each")
+	}
+}
+
+func TestWaitResumed(t *testing.T) {
+	jctx := &JCtx{config: Config{Host: "r1", Paths: []PathsConfig{{Path: "/interfaces/"}}}}
+	jctx.control = make(chan os.Signal)
+	if !waitResumed(jctx) {
+		t.Fatalf("not paused: got interrupted")
+	}
+
+	done := make(chan bool, 1)
+	setPaused(jctx, "", true)
+	go func() { done <- waitResumed(jctx) }()
+	select {
+	case <-done:
+		t.Fatalf("paused: waitResumed returned")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// the only path paused keeps the device paused
+	setPaused(jctx, "/interfaces/", true)
+	setPaused(jctx, "", false)
+	select {
+	case <-done:
+		t.Fatalf("all paths paused: waitResumed returned")
+	case <-time.After(50 * time.Millisecond):
+	}
+	setPaused(jctx, "/interfaces/", false)
+	select {
+	case ok := <-done:
+		if !ok {
+			t.Errorf("resumed: got interrupted")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("resumed: waitResumed did not return")
+	}
+
+	setPaused(jctx, "", true)
+	go func() { done <- waitResumed(jctx) }()
+	jctx.control <- os.Interrupt
+	if <-done {
+		t.Errorf("interrupted: got resumed")
+	}
+}
+
+func TestPauseHandler(t *testing.T) {
+	r1 := &JCtx{config: Config{Host: "r1", Port: 32767, Paths: []PathsConfig{{Path: "/interfaces/"}, {Path: "/bgp/"}}}}
+	r2 := &JCtx{config: Config{Host: "r2", Port: 32767, Paths: []PathsConfig{{Path: "/interfaces/"}}}}
+	for _, jctx := range []*JCtx{r1, r2} {
+		jctx.control = make(chan os.Signal)
+		dropsInit(jctx)
+		defer dropsStop(jctx)
+	}
+
+	tests := []struct {
+		method string
+		url    string
+		code   int
+		want   []devicePause
+	}{
+		{method: "POST", url: "/pause?device=r1", code: http.StatusOK,
+			want: []devicePause{{Device: "r1", Port: 32767, Paused: true, Paths: []string{}}}},
+		{method: "POST", url: "/pause?device=r2&path=/interfaces/", code: http.StatusOK,
+			want: []devicePause{{Device: "r2", Port: 32767, Paths: []string{"/interfaces/"}}}},
+		{method: "POST", url: "/pause?device=r2&path=/bgp/", code: http.StatusNotFound},
+		{method: "POST", url: "/pause?device=r3", code: http.StatusNotFound},
+		{method: "POST", url: "/pause", code: http.StatusBadRequest},
+		{method: "DELETE", url: "/pause?device=r1", code: http.StatusMethodNotAllowed},
+		{method: "GET", url: "/pause", code: http.StatusOK, want: []devicePause{
+			{Device: "r1", Port: 32767, Paused: true, Paths: []string{}},
+			{Device: "r2", Port: 32767, Paths: []string{"/interfaces/"}},
+		}},
+		{method: "POST", url: "/resume?device=r1", code: http.StatusOK,
+			want: []devicePause{{Device: "r1", Port: 32767, Paths: []string{}}}},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		pauseHandler(rec, httptest.NewRequest(test.method, test.url, nil))
+		if rec.Code != test.code {
+			t.Errorf("%s %s: got code %d, want %d", test.method, test.url, rec.Code, test.code)
+			continue
+		}
+		if test.code != http.StatusOK {
+			continue
+		}
+		var got struct {
+			Devices []devicePause `json:"devices"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got.Devices, test.want) {
+			t.Errorf("%s %s: got %+v, want %+v", test.method, test.url, got.Devices, test.want)
+		}
+	}
+
+	if got := workerHealth(r2); !reflect.DeepEqual(got.Paths, []string{}) || got.Paused {
+		t.Errorf("health of r2: got %+v", got)
+	}
+	events := r2.events.events()
+	if len(events) != 1 || events[0].Type != EventPause || events[0].Message != "path /interfaces/ paused" {
+		t.Errorf("events of r2: got %+v", events)
+	}
+}
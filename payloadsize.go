@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// sizeHistogram is the distribution of the payload sizes of a path in bytes,
+// in the buckets of the latency histograms, accessed atomically. The number
+// and the sum of the sizes are the packets and bytes of the path.
+type sizeHistogram struct {
+	min     uint64
+	max     uint64
+	buckets [histBuckets]uint64
+}
+
+func (h *sizeHistogram) observe(size uint64) {
+	atomic.AddUint64(&h.buckets[histBucket(size)], 1)
+	for {
+		// min is 0 until the first payload which is not empty
+		min := atomic.LoadUint64(&h.min)
+		if (min != 0 && min <= size) || atomic.CompareAndSwapUint64(&h.min, min, size) {
+			break
+		}
+	}
+	for {
+		max := atomic.LoadUint64(&h.max)
+		if max >= size || atomic.CompareAndSwapUint64(&h.max, max, size) {
+			break
+		}
+	}
+}
+
+// percentiles returns the sizes below which the percentiles ps (0-100) of
+// the sizes are
+func (h *sizeHistogram) percentiles(ps ...float64) []uint64 {
+	counts := make([]uint64, histBuckets)
+	for i := range counts {
+		counts[i] = atomic.LoadUint64(&h.buckets[i])
+	}
+	res := make([]uint64, len(ps))
+	for i, v := range histRanks(counts, ps...) {
+		res[i] = uint64(v)
+	}
+	return res
+}
+
+// sizeDist is the distribution of the payload sizes of a path
+type sizeDist struct {
+	packets uint64
+	min     uint64
+	avg     uint64
+	max     uint64
+	p50     uint64
+	p99     uint64
+}
+
+// sizes returns the distribution of the payload sizes of the path
+func (c *pathCounters) sizes() sizeDist {
+	d := sizeDist{
+		packets: atomic.LoadUint64(&c.packets),
+		min:     atomic.LoadUint64(&c.sizeHist.min),
+		max:     atomic.LoadUint64(&c.sizeHist.max),
+	}
+	if d.packets != 0 {
+		d.avg = atomic.LoadUint64(&c.bytes) / d.packets
+	}
+	p := c.sizeHist.percentiles(50, 99)
+	d.p50, d.p99 = p[0], p[1]
+	// the percentiles are the middle of their buckets
+	for _, v := range []*uint64{&d.p50, &d.p99} {
+		if *v > d.max {
+			*v = d.max
+		}
+		if *v < d.min {
+			*v = d.min
+		}
+	}
+	return d
+}
+
+// sizeTable describes the payload sizes of the paths, one line per path
+// sorted by path
+func (s *pathStats) sizeTable() string {
+	paths := s.paths()
+	if len(paths) == 0 {
+		return ""
+	}
+
+	t := fmt.Sprintf("%-50s | %10s | %10s | %10s | %10s | %10s\n", "Path", "Min(B)", "Avg(B)", "p50(B)",
+		"p99(B)", "Max(B)")
+	for _, p := range paths {
+		d := s.counters(p).sizes()
+		t += fmt.Sprintf("%-50s | %10v | %10v | %10v | %10v | %10v\n", p, d.min, d.avg, d.p50, d.p99, d.max)
+	}
+	return t
+}
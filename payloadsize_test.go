@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPayloadSizes(t *testing.T) {
+	var s pathStats
+	for _, size := range []int{100, 200, 300, 400, 10000} {
+		s.add("/interfaces/", 1, size, 0, false)
+	}
+	for i := 0; i < 100; i++ {
+		s.add("/bgp/", 1, 1000+i, time.Millisecond, true)
+	}
+
+	tests := []struct {
+		path string
+		want sizeDist
+	}{
+		{"/interfaces/", sizeDist{packets: 5, min: 100, avg: 2200, p50: 300, p99: 10000, max: 10000}},
+		{"/bgp/", sizeDist{packets: 100, min: 1000, avg: 1049, p50: 1056, p99: 1099, max: 1099}},
+	}
+	for _, test := range tests {
+		got := s.counters(test.path).sizes()
+		// the percentiles are within 1/32 of the sizes
+		for _, p := range []struct{ got, want *uint64 }{{&got.p50, &test.want.p50}, {&got.p99, &test.want.p99}} {
+			if d := int64(*p.got) - int64(*p.want); d > int64(*p.want)/32 || d < -int64(*p.want)/32 {
+				t.Errorf("%s: got percentile %d, want %d", test.path, *p.got, *p.want)
+			}
+			*p.got = *p.want
+		}
+		if got != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.path, got, test.want)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(s.sizeTable()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "/bgp/") || !strings.Contains(lines[2], "10000") {
+		t.Errorf("got table:\n%s", strings.Join(lines, "\n"))
+	}
+	var empty pathStats
+	if got := empty.sizeTable(); got != "" {
+		t.Errorf("got table %q without paths", got)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// peerCredSupported tells whether peerCred knows the clients of Unix sockets
+const peerCredSupported = true
+
+// peerCred reads SO_PEERCRED of the Unix socket connection
+func peerCred(conn net.Conn) (peerCredentials, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return peerCredentials{}, fmt.Errorf("not a Unix socket")
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return peerCredentials{}, err
+	}
+	var cred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return peerCredentials{}, err
+	}
+	if credErr != nil {
+		return peerCredentials{}, fmt.Errorf("SO_PEERCRED: %v", credErr)
+	}
+	return peerCredentials{uid: cred.Uid, gid: cred.Gid, pid: cred.Pid}, nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+// peerCredSupported tells whether peerCred knows the clients of Unix sockets,
+// SO_PEERCRED is known on Linux only
+const peerCredSupported = false
+
+func peerCred(conn net.Conn) (peerCredentials, error) {
+	return peerCredentials{}, fmt.Errorf("peer credentials are not supported")
+}
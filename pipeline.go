@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	na_pb "github.com/nileshsimaria/jtimon/telemetry"
+)
+
+// PipelineConfig decouples receiving, decoding, transforming and exporting
+// of the Junos updates. Each stage runs in its own go routine fed by a
+// queue of at most queue updates, so a slow InfluxDB or sink only stalls
+// the export stage until its queue is full. What happens then is up to the
+// backpressure policy, drop is the same as drop-newest if there is none.
+type PipelineConfig struct {
+	Queue int  `json:"queue"`
+	Drop  bool `json:"drop"`
+}
+
+// pipelineMsg is the update passed between the stages
+type pipelineMsg struct {
+	ocData      *na_pb.OpenConfigData
+	rtime       time.Time
+	measurement string
+	points      []*point
+	trace       *packetTrace
+}
+
+type pipelineStage struct {
+	name    string
+	ch      chan *pipelineMsg
+	process func(*pipelineMsg) *pipelineMsg
+	next    *pipelineStage
+
+	// accessed atomically
+	in      uint64
+	dropped uint64
+	busy    int64
+}
+
+type pipeline struct {
+	policy string
+	drops  *dropCounters
+	stages []*pipelineStage
+	// pending are the updates submitted and not yet through, accessed
+	// atomically
+	pending int64
+}
+
+func newPipeline(jctx *JCtx) *pipeline {
+	cfg := jctx.config.Pipeline
+	p := &pipeline{policy: backpressurePolicy(jctx), drops: &jctx.drops}
+	if jctx.config.Backpressure.Policy == "" && cfg.Drop {
+		p.policy = BackpressureDropNewest
+	}
+	stage := func(name string, process func(*pipelineMsg) *pipelineMsg) {
+		s := &pipelineStage{
+			name:    name,
+			ch:      make(chan *pipelineMsg, cfg.Queue),
+			process: process,
+		}
+		if n := len(p.stages); n != 0 {
+			p.stages[n-1].next = s
+		}
+		p.stages = append(p.stages, s)
+	}
+
+	stage("decode", func(m *pipelineMsg) *pipelineMsg {
+		m.points = decodeIDB(m.ocData, jctx, m.rtime)
+		if len(m.points) == 0 {
+			return nil
+		}
+		m.measurement = mName(m.ocData, jctx.config)
+		m.ocData = nil
+		return m
+	})
+	stage("transform", func(m *pipelineMsg) *pipelineMsg {
+		m.points = applyTransforms(jctx, m.points)
+		if len(m.points) == 0 {
+			return nil
+		}
+		return m
+	})
+	stage("export", func(m *pipelineMsg) *pipelineMsg {
+		m.trace.setPoints(len(m.points))
+		exportIDB(jctx, m.measurement, m.points)
+		pointsExported(jctx, len(m.points), m.rtime)
+		return nil
+	})
+	return p
+}
+
+func pipelineInit(jctx *JCtx) {
+	if jctx.config.Pipeline.Queue <= 0 {
+		return
+	}
+	jctx.pipeline = newPipeline(jctx)
+	for _, s := range jctx.pipeline.stages {
+		go jctx.pipeline.run(s)
+	}
+}
+
+func (p *pipeline) send(s *pipelineStage, m *pipelineMsg) {
+	// the dropped message is m with drop-newest, a queued one otherwise
+	var old *pipelineMsg
+	dropped := enqueue(p.policy, func() bool {
+		select {
+		case s.ch <- m:
+			return true
+		default:
+			return false
+		}
+	}, func() {
+		s.ch <- m
+	}, func() bool {
+		select {
+		case old = <-s.ch:
+			putPipelineMsg(old)
+			atomic.AddInt64(&p.pending, -1)
+			return true
+		default:
+			return false
+		}
+	})
+	if dropped == 0 || old != nil {
+		atomic.AddUint64(&s.in, 1)
+	} else {
+		putPipelineMsg(m)
+		atomic.AddInt64(&p.pending, -1)
+	}
+	atomic.AddUint64(&s.dropped, dropped)
+	p.drops.add("pipeline/"+s.name, dropped)
+}
+
+func (p *pipeline) run(s *pipelineStage) {
+	for m := range s.ch {
+		start := time.Now()
+		out := s.process(m)
+		atomic.AddInt64(&s.busy, int64(time.Since(start)))
+		m.trace.span(s.name, start)
+		if out == nil || s.next == nil {
+			m.trace.finish()
+			putPipelineMsg(m)
+			atomic.AddInt64(&p.pending, -1)
+			continue
+		}
+		p.send(s.next, out)
+	}
+}
+
+// submit queues one received update, tr is its trace if it is sampled
+func (p *pipeline) submit(ocData *na_pb.OpenConfigData, rtime time.Time, tr *packetTrace) {
+	m := getPipelineMsg()
+	m.ocData, m.rtime, m.trace = ocData, rtime, tr
+	atomic.AddInt64(&p.pending, 1)
+	p.send(p.stages[0], m)
+}
+
+// wait waits until the updates submitted so far are through the stages, it
+// gives up at the deadline
+func (p *pipeline) wait(deadline time.Time) bool {
+	for atomic.LoadInt64(&p.pending) > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+// stats describes the stages, one line each
+func (p *pipeline) stats() string {
+	s := ""
+	for _, st := range p.stages {
+		s += fmt.Sprintf("%-12v : %s stage updates (%d dropped, %d queued, busy %v)\n", atomic.LoadUint64(&st.in),
+			st.name, atomic.LoadUint64(&st.dropped), len(st.ch), time.Duration(atomic.LoadInt64(&st.busy)))
+	}
+	return s
+}
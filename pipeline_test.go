@@ -0,0 +1,82 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	na_pb "github.com/nileshsimaria/jtimon/telemetry"
+)
+
+func TestPipeline(t *testing.T) {
+	newJctx := func(cfg PipelineConfig, sinkQueue int) *JCtx {
+		jctx := &JCtx{
+			config: Config{Host: "r1", Pipeline: cfg},
+			influxCtx: InfluxCtx{
+				reXpath: regexp.MustCompile(MatchExpressionXpath),
+				reKey:   regexp.MustCompile(MatchExpressionKey),
+			},
+			sinks: []*sinkCtx{{name: "test", ch: make(chan *point, sinkQueue)}},
+		}
+		pipelineInit(jctx)
+		return jctx
+	}
+	ocData := &na_pb.OpenConfigData{
+		Path: "sensor_1:/interfaces/:/interfaces/:mib2d",
+		Kv: []*na_pb.KeyValue{
+			{Key: "/interfaces/interface[name='ge-0/0/0']/state/counters/in-octets", Value: &na_pb.KeyValue_UintValue{UintValue: 1}},
+		},
+	}
+
+	t.Run("export", func(t *testing.T) {
+		jctx := newJctx(PipelineConfig{Queue: 4}, 4)
+		for i := 0; i < 3; i++ {
+			jctx.pipeline.submit(ocData, time.Now(), nil)
+		}
+		for i := 0; i < 3; i++ {
+			select {
+			case p := <-jctx.sinks[0].ch:
+				if p.Measurement != "/interfaces/" || p.Tags["/interfaces/interface/@name"] != "ge-0/0/0" {
+					t.Errorf("got %v", p)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timeout waiting for point %d", i)
+			}
+		}
+		for _, s := range jctx.pipeline.stages {
+			if in := atomic.LoadUint64(&s.in); in != 3 {
+				t.Errorf("%s stage: got %d updates, want 3", s.name, in)
+			}
+		}
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		// nobody reads the sink, the export stage stalls
+		jctx := newJctx(PipelineConfig{Queue: 1, Drop: true}, 0)
+		done := make(chan struct{})
+		go func() {
+			for i := 0; i < 20; i++ {
+				jctx.pipeline.submit(ocData, time.Now(), nil)
+			}
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("submit blocked")
+		}
+
+		var dropped uint64
+		for _, s := range jctx.pipeline.stages {
+			dropped += atomic.LoadUint64(&s.dropped)
+		}
+		if dropped == 0 {
+			t.Errorf("want dropped updates, got none")
+		}
+		if stats := jctx.pipeline.stats(); !strings.Contains(stats, "decode stage updates") {
+			t.Errorf("got stats %q", stats)
+		}
+	})
+}
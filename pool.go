@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+)
+
+// Pools of the scratch objects of the hot path. Only objects which do not
+// escape the processing of one update are pooled, the points with their
+// tags and fields are handed to the transforms and sinks which may keep
+// them.
+var (
+	fieldsPool = sync.Pool{
+		New: func() interface{} { return make(map[string]interface{}) },
+	}
+	decodeScratchPool = sync.Pool{
+		New: func() interface{} { return &decodeScratch{index: make(map[string]*row)} },
+	}
+	keyScratchPool = sync.Pool{
+		New: func() interface{} { return &keyScratch{} },
+	}
+	pipelineMsgPool = sync.Pool{
+		New: func() interface{} { return &pipelineMsg{} },
+	}
+)
+
+// decodeScratch holds the rows of the update being decoded
+type decodeScratch struct {
+	rows  []*row
+	index map[string]*row
+}
+
+// keyScratch is used to build series keys
+type keyScratch struct {
+	keys []string
+	buf  bytes.Buffer
+}
+
+func getFields() map[string]interface{} {
+	return fieldsPool.Get().(map[string]interface{})
+}
+
+// putFields returns fields which did not end up in a point
+func putFields(fields map[string]interface{}) {
+	for k := range fields {
+		delete(fields, k)
+	}
+	fieldsPool.Put(fields)
+}
+
+func getDecodeScratch() *decodeScratch {
+	return decodeScratchPool.Get().(*decodeScratch)
+}
+
+func putDecodeScratch(d *decodeScratch) {
+	for i := range d.rows {
+		d.rows[i] = nil
+	}
+	d.rows = d.rows[:0]
+	for k := range d.index {
+		delete(d.index, k)
+	}
+	decodeScratchPool.Put(d)
+}
+
+func getPipelineMsg() *pipelineMsg {
+	return pipelineMsgPool.Get().(*pipelineMsg)
+}
+
+func putPipelineMsg(m *pipelineMsg) {
+	*m = pipelineMsg{}
+	pipelineMsgPool.Put(m)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"sort"
+	"strings"
+	"time"
+)
+
+// pprofDumpKeep is the number of dumps of each profile kept in the dump
+// directory, older ones are removed
+const pprofDumpKeep = 24
+
+// pprofHandle registers the net/http/pprof endpoints under /debug/pprof/,
+// wrapped in guard if it is not nil
+func pprofHandle(mux *http.ServeMux, guard func(http.HandlerFunc) http.HandlerFunc) {
+	for path, h := range map[string]http.HandlerFunc{
+		"/debug/pprof/":        pprof.Index,
+		"/debug/pprof/cmdline": pprof.Cmdline,
+		"/debug/pprof/profile": pprof.Profile,
+		"/debug/pprof/symbol":  pprof.Symbol,
+		"/debug/pprof/trace":   pprof.Trace,
+	} {
+		if guard != nil {
+			h = guard(h)
+		}
+		mux.HandleFunc(path, h)
+	}
+}
+
+// pprofGuard guards the profiles of the internal metrics service like its
+// control endpoints. The profiles are of the whole process, they are for
+// the users and tokens without a scope only.
+func pprofGuard(h http.HandlerFunc) http.HandlerFunc {
+	return apiHandler(func(w http.ResponseWriter, r *http.Request) {
+		if requestScope(r.Context()) != nil {
+			http.Error(w, "the profiles are of all devices", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	})
+}
+
+// pprofInit serves the profiling endpoints on their own port, without
+// authentication
+func pprofInit() {
+	mux := http.NewServeMux()
+	pprofHandle(mux, nil)
+	go func() {
+		addr := fmt.Sprintf("%s:%d", *pProfHost, *pProfPort)
+		log.Println(http.ListenAndServe(addr, mux))
+	}()
+}
+
+// pprofDump writes a CPU profile of cpu duration and a heap profile to dir,
+// the files are named after kind and the time the dump started
+func pprofDump(dir string, cpu time.Duration) error {
+	stamp := time.Now().Format("20060102-150405")
+
+	if cpu > 0 {
+		f, err := os.Create(filepath.Join(dir, "cpu-"+stamp+".pprof"))
+		if err != nil {
+			return err
+		}
+		if err := runtimepprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return err
+		}
+		time.Sleep(cpu)
+		runtimepprof.StopCPUProfile()
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Create(filepath.Join(dir, "heap-"+stamp+".pprof"))
+	if err != nil {
+		return err
+	}
+	runtime.GC()
+	if err := runtimepprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// pprofPrune removes all but the newest keep dumps of each profile kind
+func pprofPrune(dir string, keep int) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	kinds := map[string][]string{}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, ".pprof") {
+			continue
+		}
+		if i := strings.Index(name, "-"); i > 0 {
+			kinds[name[:i]] = append(kinds[name[:i]], name)
+		}
+	}
+	for _, names := range kinds {
+		// time stamps sort in the order of the dumps
+		sort.Strings(names)
+		for len(names) > keep {
+			if err := os.Remove(filepath.Join(dir, names[0])); err != nil {
+				return err
+			}
+			names = names[1:]
+		}
+	}
+	return nil
+}
+
+// pprofDumps dumps the profiles every interval until the process ends, the
+// CPU is profiled for the first 30 seconds (at most half) of each interval
+func pprofDumps(dir string, interval time.Duration) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("pprof dumps disabled: %v", err)
+		return
+	}
+	cpu := 30 * time.Second
+	if cpu > interval/2 {
+		cpu = interval / 2
+	}
+	for {
+		start := time.Now()
+		if err := pprofDump(dir, cpu); err != nil {
+			log.Printf("pprof dump failed: %v", err)
+		} else if err := pprofPrune(dir, pprofDumpKeep); err != nil {
+			log.Printf("pprof dump prune failed: %v", err)
+		}
+		time.Sleep(interval - time.Since(start))
+	}
+}
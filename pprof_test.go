@@ -0,0 +1,153 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestPprofHandle(t *testing.T) {
+	mux := http.NewServeMux()
+	pprofHandle(mux, nil)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/debug/pprof/", http.StatusOK},
+		{"/debug/pprof/heap", http.StatusOK},
+		{"/debug/pprof/goroutine?debug=1", http.StatusOK},
+		{"/metrics", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != test.code {
+				t.Errorf("got status %d, want %d", resp.StatusCode, test.code)
+			}
+		})
+	}
+}
+
+func TestPprofGuard(t *testing.T) {
+	apiAuthn = &apiAuth{
+		token:  "t0ken",
+		tokens: map[string]string{"emea-noc": "em3a"},
+		scopes: map[string]apiScope{"emea-noc": {"emea": true}},
+	}
+	defer func() { apiAuthn = nil }()
+	mux := http.NewServeMux()
+	pprofHandle(mux, pprofGuard)
+
+	tests := []struct {
+		path  string
+		token string
+		code  int
+	}{
+		{"/debug/pprof/", "", http.StatusUnauthorized},
+		{"/debug/pprof/heap", "wrong", http.StatusUnauthorized},
+		{"/debug/pprof/heap", "em3a", http.StatusForbidden},
+		{"/debug/pprof/", "t0ken", http.StatusOK},
+		{"/debug/pprof/heap", "t0ken", http.StatusOK},
+		{"/debug/pprof/cmdline", "t0ken", http.StatusOK},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.path, nil)
+		if test.token != "" {
+			r.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		if rec.Code != test.code {
+			t.Errorf("%s with %q: got status %d, want %d", test.path, test.token, rec.Code, test.code)
+		}
+	}
+}
+
+func TestPprofDump(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-pprof")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := pprofDump(dir, 0); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "heap-*.pprof"))
+	if len(files) != 1 {
+		t.Errorf("got heap dumps %v, want one", files)
+	}
+}
+
+func TestPprofPrune(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		keep  int
+		want  []string
+	}{
+		{
+			name:  "under-limit",
+			files: []string{"cpu-20200101-000000.pprof", "heap-20200101-000000.pprof"},
+			keep:  2,
+			want:  []string{"cpu-20200101-000000.pprof", "heap-20200101-000000.pprof"},
+		},
+		{
+			name: "per-kind",
+			files: []string{
+				"cpu-20200101-000000.pprof", "cpu-20200101-000500.pprof", "cpu-20200101-001000.pprof",
+				"heap-20200101-000000.pprof", "heap-20200101-000500.pprof",
+			},
+			keep: 2,
+			want: []string{
+				"cpu-20200101-000500.pprof", "cpu-20200101-001000.pprof",
+				"heap-20200101-000000.pprof", "heap-20200101-000500.pprof",
+			},
+		},
+		{
+			name:  "other-files",
+			files: []string{"notes.txt", "heap-20200101-000000.pprof", "heap-20200101-000500.pprof"},
+			keep:  1,
+			want:  []string{"heap-20200101-000500.pprof", "notes.txt"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "jtimon-pprof")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			for _, f := range test.files {
+				if err := ioutil.WriteFile(filepath.Join(dir, f), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := pprofPrune(dir, test.keep); err != nil {
+				t.Fatal(err)
+			}
+			infos, _ := ioutil.ReadDir(dir)
+			var got []string
+			for _, info := range infos {
+				got = append(got, info.Name())
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	na_pb "github.com/nileshsimaria/jtimon/telemetry"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	probePath     = flag.String("probe-path", "/junos/system/linecard/cpu/memory/", "Sensor jtimon probe subscribes to, a small one")
+	probeFreq     = flag.Int("probe-freq", 1000, "Sample frequency of the sensor of jtimon probe in ms, and interval of its round trips")
+	probeDuration = flag.Int("probe-duration", 30, "How long jtimon probe measures the latencies, in seconds")
+)
+
+// probeReport are the latencies jtimon probe measured of a device
+type probeReport struct {
+	device   string
+	path     string
+	duration time.Duration
+	connect  time.Duration
+	login    time.Duration
+	// first is the time from the subscription to the first message
+	first    time.Duration
+	messages uint64
+	gaps     uint64
+	lost     uint64
+	// skewed are the messages received before their device timestamp, the
+	// clocks of jtimon and of the device differ
+	skewed      uint64
+	rtt         latencyHistogram
+	rttFailures uint64
+	export      latencyHistogram
+}
+
+// latencies describes the latencies of h: their number, min, average,
+// median, 99th percentile and max
+func latencies(h *latencyHistogram) string {
+	count, sum, counts := h.snapshot()
+	if count == 0 {
+		return "none"
+	}
+	p := histPercentiles(counts, 0, 50, 99, 100)
+	round := func(d time.Duration) time.Duration {
+		return d.Round(10 * time.Microsecond)
+	}
+	return fmt.Sprintf("%d, min %v avg %v p50 %v p99 %v max %v", count,
+		round(p[0]), round(sum/time.Duration(count)), round(p[1]), round(p[2]), round(p[3]))
+}
+
+func (r *probeReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "probe of %s, %s for %v\n", r.device, r.path, r.duration)
+	fmt.Fprintf(&b, "  connect         %v\n", r.connect.Round(10*time.Microsecond))
+	if r.login == 0 {
+		fmt.Fprintf(&b, "  login           none\n")
+	} else {
+		fmt.Fprintf(&b, "  login           %v\n", r.login.Round(10*time.Microsecond))
+	}
+	if r.messages == 0 {
+		fmt.Fprintf(&b, "  first message   none\n")
+	} else {
+		fmt.Fprintf(&b, "  first message   %v\n", r.first.Round(10*time.Microsecond))
+	}
+	fmt.Fprintf(&b, "  messages        %d, %d lost in %d gaps\n", r.messages, r.lost, r.gaps)
+	fmt.Fprintf(&b, "  round trip      %s", latencies(&r.rtt))
+	if r.rttFailures != 0 {
+		fmt.Fprintf(&b, ", %d failed", r.rttFailures)
+	}
+	fmt.Fprintf(&b, "\n  export latency  %s", latencies(&r.export))
+	if r.skewed != 0 {
+		fmt.Fprintf(&b, ", %d before their timestamp (clock skew)", r.skewed)
+	}
+	fmt.Fprintf(&b, "\n")
+	return b.String()
+}
+
+// probeRoundTrips measures the round trips of the connection with a small
+// RPC every interval until ctx is done. Any answer of the device is a round
+// trip, the RPC need not be supported.
+func probeRoundTrips(ctx context.Context, conn *grpc.ClientConn, interval time.Duration, r *probeReport) {
+	c := na_pb.NewOpenConfigTelemetryClient(conn)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		start := time.Now()
+		_, err := c.GetDataEncodings(ctx, &na_pb.DataEncodingRequest{})
+		if ctx.Err() != nil {
+			return
+		}
+		switch status.Code(err) {
+		case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled:
+			r.rttFailures++
+		default:
+			r.rtt.observe(time.Since(start))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// runProbe connects to the Junos device of the worker, subscribes to path
+// at freq ms for d and measures the latencies: of the connection and the
+// login, of the round trips, and from the device timestamp of the messages
+// to their receipt
+func runProbe(jctx *JCtx, path string, freq int, d time.Duration) (*probeReport, error) {
+	hostname := jctx.config.Host + ":" + strconv.Itoa(jctx.config.Port)
+	r := &probeReport{device: hostname, path: path, duration: d}
+	vendor, err := getVendor(jctx)
+	if err != nil {
+		return nil, err
+	}
+	if vendor.name != "juniper-junos" {
+		return nil, fmt.Errorf("jtimon probe does not support vendor %s", vendor.name)
+	}
+
+	start := time.Now()
+	conn, err := dialDevice(jctx, vendor)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	r.connect = time.Since(start)
+
+	if jctx.config.User != "" {
+		start = time.Now()
+		if err := vendor.sendLoginCheck(jctx, conn); err != nil {
+			return nil, err
+		}
+		r.login = time.Since(start)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	rtts := make(chan struct{})
+	go func() {
+		probeRoundTrips(ctx, conn, time.Duration(freq)*time.Millisecond, r)
+		close(rtts)
+	}()
+	defer func() {
+		cancel()
+		<-rtts
+	}()
+
+	sctx := ctx
+	if authMode(jctx.config) == AuthMeta {
+		md := metadata.New(map[string]string{"username": jctx.config.User, "password": jctx.config.Password})
+		sctx = metadata.NewOutgoingContext(ctx, md)
+	}
+	start = time.Now()
+	stream, err := na_pb.NewOpenConfigTelemetryClient(conn).TelemetrySubscribe(sctx, &na_pb.SubscriptionRequest{
+		PathList: []*na_pb.Path{{Path: path, SampleFrequency: uint32(freq)}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not subscribe to %s: %v", path, err)
+	}
+	var gaps seqGaps
+	for {
+		ocData, err := stream.Recv()
+		rtime := time.Now()
+		if err == io.EOF || ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("the subscription to %s failed: %v", path, err)
+		}
+		if r.messages == 0 {
+			r.first = rtime.Sub(start)
+		}
+		r.messages++
+		export := rtime.Sub(time.Unix(0, int64(ocData.Timestamp)*int64(time.Millisecond)))
+		if export < 0 {
+			r.skewed++
+		}
+		r.export.observe(export)
+		key := seqKey{system: ocData.SystemId, component: ocData.ComponentId, subComponent: ocData.SubComponentId, sensor: ocData.Path}
+		if lost := gaps.check(key, ocData.SequenceNumber, rtime); lost != 0 {
+			r.gaps++
+			r.lost += lost
+		}
+	}
+	return r, nil
+}
+
+// probeMain runs jtimon probe on the device of the config file, it exits
+// with status 1 if the device could not be probed or sent no message
+func probeMain() {
+	if len(*configFiles) == 0 {
+		log.Printf("jtimon probe needs the config file of the device (--config)")
+		os.Exit(1)
+	}
+	jctx, err := loadDevice((*configFiles)[0])
+	if err != nil {
+		log.Printf("%v", err)
+		os.Exit(1)
+	}
+	if *probeFreq <= 0 || *probeDuration <= 0 {
+		log.Printf("probe-freq and probe-duration must be positive")
+		os.Exit(1)
+	}
+
+	log.Printf("probing %s:%d for %ds", jctx.config.Host, jctx.config.Port, *probeDuration)
+	r, err := runProbe(jctx, *probePath, *probeFreq, time.Duration(*probeDuration)*time.Second)
+	if err != nil {
+		log.Printf("probe: %v", err)
+		os.Exit(1)
+	}
+	fmt.Print(r)
+	if r.messages == 0 {
+		os.Exit(1)
+	}
+}
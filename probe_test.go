@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nileshsimaria/jtimon/simulator"
+)
+
+func TestProbe(t *testing.T) {
+	script := simulator.DefaultScript()
+	script.User, script.Password = "jtimon", "secret"
+	script.Faults = simulator.Faults{Drop: 0.2, Seed: 1}
+	s, err := simulator.Start("127.0.0.1:0", script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	host, port, _ := net.SplitHostPort(s.Addr())
+	p, _ := strconv.Atoi(port)
+
+	jctx := &JCtx{config: Config{Host: host, Port: p, User: "jtimon", Password: "secret"}}
+	r, err := runProbe(jctx, "/interfaces", 50, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.connect <= 0 || r.login <= 0 || r.first <= 0 || r.first > time.Second {
+		t.Errorf("connect %v, login %v, first message %v", r.connect, r.login, r.first)
+	}
+	if r.messages == 0 || r.gaps == 0 || r.lost == 0 {
+		t.Errorf("%d messages, %d lost in %d gaps of %+v", r.messages, r.lost, r.gaps, s.Stats())
+	}
+	if n, _, _ := r.rtt.snapshot(); n < 10 || r.rttFailures != 0 {
+		t.Errorf("%d round trips, %d failed", n, r.rttFailures)
+	}
+	if n, _, _ := r.export.snapshot(); n != r.messages {
+		t.Errorf("%d export latencies of %d messages", n, r.messages)
+	}
+	report := r.String()
+	for _, want := range []string{"probe of " + s.Addr() + ", /interfaces for 1s\n", "  round trip      ", "  export latency  ", " p99 "} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report\n%s\nwithout %q", report, want)
+		}
+	}
+
+	jctx.config.Password = "wrong"
+	if _, err := runProbe(jctx, "/interfaces", 50, time.Second); err == nil {
+		t.Errorf("runProbe() with a wrong password = nil")
+	}
+	jctx.config.Vendor.Name = "cisco-iosxr"
+	if _, err := runProbe(jctx, "/interfaces", 50, time.Second); err == nil {
+		t.Errorf("runProbe() of cisco-iosxr = nil")
+	}
+}
+
+func TestProbeReport(t *testing.T) {
+	r := &probeReport{device: "r1:32767", path: "/components/", duration: 30 * time.Second,
+		connect: 12 * time.Millisecond, login: 8 * time.Millisecond, first: 1020 * time.Millisecond,
+		messages: 30, gaps: 1, lost: 2, skewed: 3, rttFailures: 1}
+	for _, d := range []time.Duration{2 * time.Millisecond, 4 * time.Millisecond} {
+		r.rtt.observe(d)
+	}
+	want := `probe of r1:32767, /components/ for 30s
+  connect         12ms
+  login           8ms
+  first message   1.02s
+  messages        30, 2 lost in 1 gaps
+  round trip      2, min 2.02ms avg 3ms p50 2.02ms p99 4.03ms max 4.03ms, 1 failed
+  export latency  none, 3 before their timestamp (clock skew)
+`
+	if got := r.String(); got != want {
+		t.Errorf("String() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"hash/fnv"
 	"net/http"
 	"regexp"
 	"sort"
@@ -32,49 +33,70 @@ type jtimonMetric struct {
 	metricExpiration time.Time
 }
 
+// promShards is the number of shards of the metrics, the workers storing
+// metrics of different series rarely wait for each other
+const promShards = 64
+
+type promShard struct {
+	sync.Mutex
+	m map[string]*jtimonMetric
+}
+
 type jtimonPExporter struct {
-	m  map[string]*jtimonMetric
-	mu sync.Mutex
-	ch chan *jtimonMetric
+	shards [promShards]promShard
 }
 
 func newJTIMONPExporter() *jtimonPExporter {
-	return (&jtimonPExporter{
-		ch: make(chan *jtimonMetric),
-		m:  map[string]*jtimonMetric{},
-	})
+	c := &jtimonPExporter{}
+	for i := range c.shards {
+		c.shards[i].m = map[string]*jtimonMetric{}
+	}
+	return c
 }
 
+func (c *jtimonPExporter) shard(mapKey string) *promShard {
+	h := fnv.New32a()
+	h.Write([]byte(mapKey))
+	return &c.shards[h.Sum32()%promShards]
+}
+
+// store keeps the latest value of the metric
+func (c *jtimonPExporter) store(metric *jtimonMetric) {
+	sh := c.shard(metric.mapKey)
+	sh.Lock()
+	sh.m[metric.mapKey] = metric
+	sh.Unlock()
+}
+
+// processJTIMONMetric expires the metrics not updated for a minute
 func (c *jtimonPExporter) processJTIMONMetric() {
 	ticker := time.NewTicker(time.Minute).C
-	for {
-		select {
-		case s := <-c.ch:
-			c.mu.Lock()
-			c.m[s.mapKey] = s
-			c.mu.Unlock()
-
-		case <-ticker:
-			ageLimit := time.Now().Add(-time.Minute)
-			c.mu.Lock()
-			for k, metric := range c.m {
+	for range ticker {
+		ageLimit := time.Now().Add(-time.Minute)
+		for i := range c.shards {
+			sh := &c.shards[i]
+			sh.Lock()
+			for k, metric := range sh.m {
 				if ageLimit.After(metric.metricExpiration) {
-					delete(c.m, k)
+					delete(sh.m, k)
 				}
 			}
-			c.mu.Unlock()
+			sh.Unlock()
 		}
 	}
 }
 
 // Collect implements prometheus.Collector
 func (c *jtimonPExporter) Collect(ch chan<- prometheus.Metric) {
-	c.mu.Lock()
-	metrics := make([]*jtimonMetric, 0, len(c.m))
-	for _, metric := range c.m {
-		metrics = append(metrics, metric)
+	var metrics []*jtimonMetric
+	for i := range c.shards {
+		sh := &c.shards[i]
+		sh.Lock()
+		for _, metric := range sh.m {
+			metrics = append(metrics, metric)
+		}
+		sh.Unlock()
 	}
-	c.mu.Unlock()
 
 	for _, metric := range metrics {
 		ch <- prometheus.MustNewConstMetric(
@@ -131,6 +153,8 @@ func addPrometheus(ocData *na_pb.OpenConfigData, jctx *JCtx) {
 
 		field, tags := spitTagsNPath(jctx, key)
 		tags["device"] = cfg.Host
+		addressTag(jctx, tags)
+		factTags(jctx, tags)
 
 		var fieldValue float64
 
@@ -171,7 +195,7 @@ func addPrometheus(ocData *na_pb.OpenConfigData, jctx *JCtx) {
 		}
 
 		metric.mapKey = getMapKey(metric)
-		exporter.ch <- metric
+		exporter.store(metric)
 	}
 }
 
@@ -179,13 +203,15 @@ func promInit() *jtimonPExporter {
 
 	c := newJTIMONPExporter()
 	prometheus.MustRegister(c)
+	prometheus.MustRegister(dropCollector{})
 
 	go func() {
 		go c.processJTIMONMetric()
 
 		addr := fmt.Sprintf("%s:%d", *promHost, *promPort)
-		http.Handle("/metrics", promhttp.Handler())
-		fmt.Println(http.ListenAndServe(addr, nil))
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		fmt.Println(http.ListenAndServe(addr, mux))
 	}()
 
 	return c
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestPExporterStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		series  int
+		want    int
+	}{
+		{"single", 1, 10, 10},
+		{"same-series", 8, 10, 10},
+		{"many-devices", 100, 50, 5000},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newJTIMONPExporter()
+			var wg sync.WaitGroup
+			for w := 0; w < test.workers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					device := "d"
+					if test.want > test.series {
+						device = fmt.Sprintf("d%d", w)
+					}
+					for i := 0; i < test.series; i++ {
+						metric := &jtimonMetric{
+							metricName:       "in_octets",
+							metricLabels:     map[string]string{"device": device, "if": fmt.Sprintf("ge-0/0/%d", i)},
+							metricValue:      float64(i),
+							metricExpiration: time.Now(),
+						}
+						metric.mapKey = getMapKey(metric)
+						c.store(metric)
+					}
+				}(w)
+			}
+			wg.Wait()
+
+			ch := make(chan prometheus.Metric, test.want+1)
+			c.Collect(ch)
+			if len(ch) != test.want {
+				t.Errorf("collected %d metrics, want %d", len(ch), test.want)
+			}
+		})
+	}
+}
+
+func TestUpdateStatsConcurrent(t *testing.T) {
+	saved := *stateHandler
+	*stateHandler = true
+	defer func() { *stateHandler = saved }()
+
+	jctx := &JCtx{}
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				updateStats(jctx, nil)
+				updateStatsKV(jctx)
+			}
+		}()
+	}
+	wg.Wait()
+	if jctx.stats.totalIn != 8000 || jctx.stats.totalKV != 8000 {
+		t.Errorf("got totalIn %d totalKV %d, want 8000", jctx.stats.totalIn, jctx.stats.totalKV)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// PromoteConfig turns string fields into tags so they are indexed. Fields
+// matching fields (regex) are always promoted. With auto string fields are
+// promoted as long as they did not show more than max-values distinct
+// values per measurement, once they do they stay fields for good. With
+// keep the promoted fields are written as fields too. A point whose fields
+// would all be promoted keeps them as fields, fields named like an existing
+// tag are not promoted.
+type PromoteConfig struct {
+	Fields    []string `json:"fields"`
+	Auto      bool     `json:"auto"`
+	MaxValues int      `json:"max-values"`
+	Keep      bool     `json:"keep"`
+}
+
+// promoteValues are the distinct values of a field seen in auto mode, nil
+// once there were too many
+type promoteValues map[string]bool
+
+type promote struct {
+	sync.Mutex
+	fields    []*regexp.Regexp
+	auto      bool
+	maxValues int
+	keep      bool
+	values    map[string]promoteValues
+}
+
+func newPromoteTransformer() *transformer {
+	return &transformer{
+		name: "promote",
+		new:  newPromote,
+	}
+}
+
+func newPromote(jctx *JCtx) (transform, error) {
+	cfg := jctx.config.Transform.Promote
+	if len(cfg.Fields) == 0 && !cfg.Auto {
+		return nil, nil
+	}
+	if cfg.MaxValues < 0 {
+		return nil, fmt.Errorf("max-values can not be negative")
+	}
+
+	fields, err := compileRegexList("fields", cfg.Fields)
+	if err != nil {
+		return nil, err
+	}
+	p := &promote{
+		fields:    fields,
+		auto:      cfg.Auto,
+		maxValues: cfg.MaxValues,
+		keep:      cfg.Keep,
+		values:    map[string]promoteValues{},
+	}
+	if p.maxValues == 0 {
+		p.maxValues = DefaultPromoteMaxValues
+	}
+	return p, nil
+}
+
+// lowCardinality tells whether the field still has few enough distinct
+// values, it records v
+func (p *promote) lowCardinality(measurement, field, v string) bool {
+	key := measurement + " " + field
+	values, seen := p.values[key]
+	if seen && values == nil {
+		return false
+	}
+	if values == nil {
+		values = promoteValues{}
+		p.values[key] = values
+	}
+	values[v] = true
+	if len(values) > p.maxValues {
+		p.values[key] = nil
+		return false
+	}
+	return true
+}
+
+func (p *promote) apply(points []*point) []*point {
+	p.Lock()
+	defer p.Unlock()
+
+	out := make([]*point, 0, len(points))
+	for _, pt := range points {
+		var promoted map[string]string
+		for k, v := range pt.Fields {
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+			if _, ok := pt.Tags[k]; ok {
+				continue
+			}
+			if !matchAny(p.fields, k) && !(p.auto && p.lowCardinality(pt.Measurement, k, s)) {
+				continue
+			}
+			if promoted == nil {
+				promoted = map[string]string{}
+			}
+			promoted[k] = s
+		}
+		if promoted == nil {
+			out = append(out, pt)
+			continue
+		}
+
+		tags := make(map[string]string, len(pt.Tags)+len(promoted))
+		for k, v := range pt.Tags {
+			tags[k] = v
+		}
+		for k, v := range promoted {
+			tags[k] = v
+		}
+		fields := pt.Fields
+		if !p.keep && len(promoted) < len(pt.Fields) {
+			fields = make(map[string]interface{}, len(pt.Fields)-len(promoted))
+			for k, v := range pt.Fields {
+				if _, ok := promoted[k]; !ok {
+					fields[k] = v
+				}
+			}
+		}
+		out = append(out, newPoint(pt.Measurement, tags, fields, pt.Timestamp))
+	}
+	return out
+}
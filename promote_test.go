@@ -0,0 +1,92 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPromote(t *testing.T) {
+	pt := func(status, descr string) *point {
+		return newPoint("/interfaces/", map[string]string{"device": "r1"},
+			map[string]interface{}{"in-octets": 1.0, "oper-status": status, "description": descr}, time.Unix(1, 0))
+	}
+
+	tests := []struct {
+		name   string
+		cfg    PromoteConfig
+		points []*point
+		tags   []map[string]string
+		fields []map[string]interface{}
+	}{
+		{
+			name:   "fields",
+			cfg:    PromoteConfig{Fields: []string{"status$"}},
+			points: []*point{pt("UP", "core")},
+			tags:   []map[string]string{{"device": "r1", "oper-status": "UP"}},
+			fields: []map[string]interface{}{{"in-octets": 1.0, "description": "core"}},
+		},
+		{
+			name:   "keep",
+			cfg:    PromoteConfig{Fields: []string{"status$"}, Keep: true},
+			points: []*point{pt("UP", "core")},
+			tags:   []map[string]string{{"device": "r1", "oper-status": "UP"}},
+			fields: []map[string]interface{}{{"in-octets": 1.0, "oper-status": "UP", "description": "core"}},
+		},
+		{
+			name:   "auto",
+			cfg:    PromoteConfig{Auto: true, MaxValues: 2},
+			points: []*point{pt("UP", "a"), pt("DOWN", "b"), pt("UP", "c")},
+			tags: []map[string]string{
+				{"device": "r1", "oper-status": "UP", "description": "a"},
+				{"device": "r1", "oper-status": "DOWN", "description": "b"},
+				{"device": "r1", "oper-status": "UP"},
+			},
+			fields: []map[string]interface{}{
+				{"in-octets": 1.0},
+				{"in-octets": 1.0},
+				{"in-octets": 1.0, "description": "c"},
+			},
+		},
+		{
+			name: "all-fields-promoted",
+			cfg:  PromoteConfig{Fields: []string{"."}},
+			points: []*point{newPoint("/interfaces/", map[string]string{"device": "r1"},
+				map[string]interface{}{"oper-status": "UP"}, time.Unix(1, 0))},
+			tags:   []map[string]string{{"device": "r1", "oper-status": "UP"}},
+			fields: []map[string]interface{}{{"oper-status": "UP"}},
+		},
+		{
+			name: "existing-tag",
+			cfg:  PromoteConfig{Fields: []string{"."}},
+			points: []*point{newPoint("/interfaces/", map[string]string{"device": "r1"},
+				map[string]interface{}{"oper-status": "UP", "device": "r2"}, time.Unix(1, 0))},
+			tags:   []map[string]string{{"device": "r1", "oper-status": "UP"}},
+			fields: []map[string]interface{}{{"device": "r2"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jctx := &JCtx{}
+			jctx.config.Transform.Promote = test.cfg
+			if err := transformsInit(jctx); err != nil {
+				t.Fatalf("transformsInit failed: %v", err)
+			}
+			var tags []map[string]string
+			var fields []map[string]interface{}
+			for _, p := range test.points {
+				for _, p := range applyTransforms(jctx, []*point{p}) {
+					tags = append(tags, p.Tags)
+					fields = append(fields, p.Fields)
+				}
+			}
+			if !reflect.DeepEqual(tags, test.tags) {
+				t.Errorf("tags: got %v, want %v", tags, test.tags)
+			}
+			if !reflect.DeepEqual(fields, test.fields) {
+				t.Errorf("fields: got %v, want %v", fields, test.fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// PubSubConfig is the config of the Google Cloud Pub/Sub sink
+type PubSubConfig struct {
+	Project         string `json:"project"`
+	Topic           string `json:"topic"`
+	OrderingKey     string `json:"ordering-key"`
+	CredentialsFile string `json:"credentials-file"`
+	Endpoint        string `json:"endpoint"`
+	BatchConfig
+}
+
+const (
+	pubsubScope       = "https://www.googleapis.com/auth/pubsub"
+	pubsubMaxMessages = 1000
+	gcpMetadataToken  = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// gcpServiceAccount is the part of the service account key file we need
+type gcpServiceAccount struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// gcpTokenSource hands out OAuth2 access tokens either from a service
+// account key (JWT bearer grant) or from the GCE metadata server
+type gcpTokenSource struct {
+	client *http.Client
+	sa     *gcpServiceAccount
+	key    *rsa.PrivateKey
+	token  string
+	expiry time.Time
+}
+
+func newGCPTokenSource(client *http.Client, file string) (*gcpTokenSource, error) {
+	ts := &gcpTokenSource{client: client}
+	if file == "" {
+		return ts, nil
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	sa := &gcpServiceAccount{}
+	if err := json.Unmarshal(b, sa); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	if sa.TokenURI == "" {
+		sa.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	block, _ := pem.Decode([]byte(sa.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("%s: private_key is not PEM encoded", file)
+	}
+	var key interface{}
+	if key, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+		if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("%s: can not parse private_key: %v", file, err)
+		}
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: private_key is not a RSA key", file)
+	}
+
+	ts.sa = sa
+	ts.key = rsaKey
+	return ts, nil
+}
+
+func (ts *gcpTokenSource) assertion(now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	hdr, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": ts.sa.PrivateKeyID})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   ts.sa.ClientEmail,
+		"scope": pubsubScope,
+		"aud":   ts.sa.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := enc.EncodeToString(hdr) + "." + enc.EncodeToString(claims)
+
+	sum := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, ts.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+// get returns cached access token, refreshed a minute before it expires
+func (ts *gcpTokenSource) get() (string, error) {
+	now := time.Now()
+	if ts.token != "" && now.Add(time.Minute).Before(ts.expiry) {
+		return ts.token, nil
+	}
+
+	var req *http.Request
+	var err error
+	if ts.sa != nil {
+		assertion, err := ts.assertion(now)
+		if err != nil {
+			return "", err
+		}
+		form := url.Values{
+			"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+			"assertion":  {assertion},
+		}
+		if req, err = http.NewRequest("POST", ts.sa.TokenURI, strings.NewReader(form.Encode())); err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		if req, err = http.NewRequest("GET", gcpMetadataToken, nil); err != nil {
+			return "", err
+		}
+		req.Header.Set("Metadata-Flavor", "Google")
+	}
+
+	body, err := sinkHTTPDo(ts.client, req)
+	if err != nil {
+		return "", fmt.Errorf("can not get access token: %v", err)
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return "", fmt.Errorf("can not get access token: %v", err)
+	}
+	ts.token = tok.AccessToken
+	ts.expiry = now.Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return ts.token, nil
+}
+
+type pubsubSink struct {
+	cfg         PubSubConfig
+	url         string
+	orderingKey *template.Template
+	client      *http.Client
+	ts          *gcpTokenSource
+}
+
+func newPubSubSink() *sink {
+	return &sink{
+		name: "pubsub",
+		open: openPubSubSink,
+	}
+}
+
+func openPubSubSink(jctx *JCtx) (sinkWriter, BatchConfig, error) {
+	cfg := jctx.config.PubSub
+	if cfg.Topic == "" {
+		return nil, cfg.BatchConfig, nil
+	}
+	if cfg.Project == "" {
+		return nil, cfg.BatchConfig, fmt.Errorf("pubsub project is missing")
+	}
+
+	s := &pubsubSink{
+		cfg:    cfg,
+		client: &http.Client{Timeout: time.Duration(DefaultIDBTimeout) * time.Second},
+	}
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultPubSubEndpoint
+	}
+	s.url = fmt.Sprintf("%s/v1/projects/%s/topics/%s:publish", strings.TrimSuffix(endpoint, "/"), cfg.Project, cfg.Topic)
+
+	// emulator (custom endpoint without credentials) does not need any token
+	if cfg.CredentialsFile != "" || cfg.Endpoint == "" {
+		ts, err := newGCPTokenSource(s.client, cfg.CredentialsFile)
+		if err != nil {
+			return nil, cfg.BatchConfig, err
+		}
+		s.ts = ts
+	}
+
+	orderingKey := cfg.OrderingKey
+	if orderingKey == "" {
+		orderingKey = DefaultPubSubOrderingKey
+	}
+	t, err := newKeyTemplate("ordering-key", orderingKey)
+	if err != nil {
+		return nil, cfg.BatchConfig, err
+	}
+	s.orderingKey = t
+	return s, cfg.BatchConfig, nil
+}
+
+type pubsubMessage struct {
+	Data        []byte            `json:"data"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	OrderingKey string            `json:"orderingKey,omitempty"`
+}
+
+func (s *pubsubSink) write(points []*point) error {
+	for len(points) > 0 {
+		n := len(points)
+		if n > pubsubMaxMessages {
+			n = pubsubMaxMessages
+		}
+		if err := s.publish(points[:n]); err != nil {
+			return err
+		}
+		points = points[n:]
+	}
+	return nil
+}
+
+func (s *pubsubSink) publish(points []*point) error {
+	msgs := make([]pubsubMessage, 0, len(points))
+	for _, p := range points {
+		data, err := json.Marshal(p)
+		if err != nil {
+			continue
+		}
+		key, err := execKeyTemplate(s.orderingKey, p)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, pubsubMessage{
+			Data:        data,
+			Attributes:  map[string]string{"device": p.Tags["device"], "measurement": p.Measurement},
+			OrderingKey: key,
+		})
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"messages": msgs})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.ts != nil {
+		token, err := s.ts.get()
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	_, err = sinkHTTPDo(s.client, req)
+	return err
+}
+
+func (s *pubsubSink) close() {
+}
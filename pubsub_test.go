@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPubSubSink(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	var published struct {
+		Messages []pubsubMessage `json:"messages"`
+	}
+	var auth string
+	tokens := 0
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if len(strings.Split(r.Form.Get("assertion"), ".")) != 3 {
+			http.Error(w, "bad assertion", http.StatusBadRequest)
+			return
+		}
+		tokens++
+		w.Write([]byte(`{"access_token":"tok","expires_in":3600}`))
+	})
+	mux.HandleFunc("/v1/projects/p/topics/t:publish", func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&published)
+		w.Write([]byte(`{"messageIds":["1"]}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	f, err := ioutil.TempFile("", "sa-*.json")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.Remove(f.Name())
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: func() []byte {
+		b, _ := x509.MarshalPKCS8PrivateKey(key)
+		return b
+	}()})
+	json.NewEncoder(f).Encode(gcpServiceAccount{
+		ClientEmail: "jtimon@p.iam.gserviceaccount.com",
+		PrivateKey:  string(pemKey),
+		TokenURI:    server.URL + "/token",
+	})
+	f.Close()
+
+	tests := []struct {
+		name        string
+		cfg         PubSubConfig
+		auth        string
+		orderingKey string
+	}{
+		{
+			name:        "service-account",
+			cfg:         PubSubConfig{Project: "p", Topic: "t", Endpoint: server.URL, CredentialsFile: f.Name()},
+			auth:        "Bearer tok",
+			orderingKey: "r1",
+		},
+		{
+			name:        "emulator",
+			cfg:         PubSubConfig{Project: "p", Topic: "t", Endpoint: server.URL, OrderingKey: "{{.Measurement}}"},
+			auth:        "",
+			orderingKey: "m",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jctx := &JCtx{}
+			jctx.config.PubSub = test.cfg
+			w, _, err := openPubSubSink(jctx)
+			if err != nil {
+				t.Fatalf("openPubSubSink failed: %v", err)
+			}
+			defer w.close()
+
+			p := newPoint("m", map[string]string{"device": "r1"}, map[string]interface{}{"/a": 1.0}, time.Unix(1, 0))
+			for i := 0; i < 2; i++ {
+				if err := w.write([]*point{p}); err != nil {
+					t.Fatalf("write failed: %v", err)
+				}
+			}
+			if auth != test.auth {
+				t.Errorf("authorization: want %q, got %q", test.auth, auth)
+			}
+			if len(published.Messages) != 1 {
+				t.Fatalf("want 1 message, got %d", len(published.Messages))
+			}
+			m := published.Messages[0]
+			if m.OrderingKey != test.orderingKey {
+				t.Errorf("ordering key: want %s, got %s", test.orderingKey, m.OrderingKey)
+			}
+			var got point
+			if err := json.Unmarshal(m.Data, &got); err != nil || got.Measurement != "m" {
+				t.Errorf("data: got %s (%v)", m.Data, err)
+			}
+		})
+	}
+
+	// token is cached across writes
+	if tokens != 1 {
+		t.Errorf("want 1 token request, got %d", tokens)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	quarantineDir = flag.String("quarantine-dir", "", "Directory the messages which can not be decoded are written to, {device}-{time}-{n}.bin with their metadata in .json")
+	quarantineMax = flag.Int("quarantine-max", 1000, "Most messages a worker writes to --quarantine-dir, 0 for no limit")
+)
+
+const (
+	// the fields of the sensor of the messages of Junos (OpenConfigData) and
+	// of Cisco (Telemetry)
+	junosPathField = 4
+	ciscoPathField = 6
+	// unknownSensor is the sensor of the messages which tell none
+	unknownSensor = "unknown"
+)
+
+// quarantineMeta describes a quarantined message, in the .json next to it
+type quarantineMeta struct {
+	Device   string    `json:"device"`
+	Port     int       `json:"port"`
+	Vendor   string    `json:"vendor"`
+	Sensor   string    `json:"sensor"`
+	Error    string    `json:"error"`
+	Received time.Time `json:"received"`
+	Size     int       `json:"size"`
+}
+
+// quarantineState counts the messages of a worker which could not be
+// decoded per sensor, and the ones it wrote
+type quarantineState struct {
+	sync.Mutex
+	sensors map[string]uint64
+	written int
+}
+
+// counts returns the messages counted per sensor, by sensor
+func (q *quarantineState) counts() ([]string, []uint64) {
+	q.Lock()
+	defer q.Unlock()
+	sensors := make([]string, 0, len(q.sensors))
+	for s := range q.sensors {
+		sensors = append(sensors, s)
+	}
+	sort.Strings(sensors)
+	counts := make([]uint64, len(sensors))
+	for i, s := range sensors {
+		counts[i] = q.sensors[s]
+	}
+	return sensors, counts
+}
+
+// add counts a message of sensor and tells whether it is written, n is the
+// number of the message in the file names
+func (q *quarantineState) add(sensor string, max int) (n int, write bool) {
+	q.Lock()
+	defer q.Unlock()
+	if q.sensors == nil {
+		q.sensors = map[string]uint64{}
+	}
+	q.sensors[sensor]++
+	if *quarantineDir == "" || max > 0 && q.written >= max {
+		return 0, false
+	}
+	q.written++
+	return q.written, true
+}
+
+// wireSensor finds the sensor of the message data, its field num, without
+// decoding the rest of it, def if there is none. The messages which can not
+// be decoded often have it before the field that is broken.
+func wireSensor(data []byte, num uint64, def string) string {
+	sensor := def
+	walkWire(data, func(n uint64, raw, value []byte) error {
+		if n == num && value != nil {
+			sensor = sensorPath(string(value))
+		}
+		return nil
+	})
+	return sensor
+}
+
+// quarantine counts the message data of the worker which could not be
+// decoded (err) per sensor, and writes it with its metadata to
+// --quarantine-dir for a bug report. The stream goes on.
+func quarantine(jctx *JCtx, sensor string, data []byte, err error) {
+	now := time.Now()
+	n, write := jctx.quarantine.add(sensor, *quarantineMax)
+	if !write {
+		jLogError(jctx, "", fmt.Sprintf("Can not decode message of %s", sensor), err)
+		return
+	}
+
+	name := fmt.Sprintf("%s-%s-%d", strings.Replace(jctx.config.Host, ":", "_", -1), now.UTC().Format("20060102T150405.000000000Z"), n)
+	file := filepath.Join(*quarantineDir, name)
+	vendor := jctx.config.Vendor.Name
+	if vendor == "" {
+		vendor = "juniper-junos"
+	}
+	meta, _ := json.MarshalIndent(quarantineMeta{
+		Device:   jctx.config.Host,
+		Port:     jctx.config.Port,
+		Vendor:   vendor,
+		Sensor:   sensor,
+		Error:    err.Error(),
+		Received: now,
+		Size:     len(data),
+	}, "", "  ")
+	werr := os.MkdirAll(*quarantineDir, 0755)
+	if werr == nil {
+		werr = ioutil.WriteFile(file+".bin", data, 0644)
+	}
+	if werr == nil {
+		werr = ioutil.WriteFile(file+".json", append(meta, '\n'), 0644)
+	}
+	if werr != nil {
+		jLogError(jctx, "", fmt.Sprintf("Can not decode message of %s, nor quarantine it", sensor), werr)
+		return
+	}
+	jLogError(jctx, "", fmt.Sprintf("Can not decode message of %s, quarantined to %s.bin", sensor, file), err)
+}
+
+// quarantineCodec is the proto codec of gRPC for a stream, it keeps the
+// messages which can not be unmarshalled instead of ending the stream with
+// them. Recv returns an empty message for them, which take tells apart.
+type quarantineCodec struct {
+	data []byte
+	err  error
+}
+
+func (c *quarantineCodec) Marshal(v interface{}) ([]byte, error) {
+	return proto.Marshal(v.(proto.Message))
+}
+
+func (c *quarantineCodec) Unmarshal(data []byte, v interface{}) error {
+	m := v.(proto.Message)
+	if err := proto.Unmarshal(data, m); err != nil {
+		m.Reset()
+		c.data = append([]byte(nil), data...)
+		c.err = err
+	}
+	return nil
+}
+
+func (c *quarantineCodec) String() string {
+	return "proto"
+}
+
+// take returns the last message which could not be unmarshalled and its
+// error, nil if the last one was
+func (c *quarantineCodec) take() ([]byte, error) {
+	data, err := c.data, c.err
+	c.data, c.err = nil, nil
+	return data, err
+}
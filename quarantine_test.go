@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/nileshsimaria/jtimon/simulator"
+	na_pb "github.com/nileshsimaria/jtimon/telemetry"
+)
+
+func TestWireSensor(t *testing.T) {
+	good, err := proto.Marshal(&na_pb.OpenConfigData{SystemId: "r1", Path: "sensor_1000:/interfaces/:/interfaces/:PFE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"whole", good, "/interfaces/"},
+		{"cut after the path", append(good, 0x2a, 0x10), "/interfaces/"},
+		{"cut before the path", good[:3], unknownSensor},
+		{"empty", nil, unknownSensor},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := wireSensor(test.data, junosPathField, unknownSensor); got != test.want {
+				t.Errorf("wireSensor() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-quarantine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(d string, m int) { *quarantineDir, *quarantineMax = d, m }(*quarantineDir, *quarantineMax)
+	*quarantineDir, *quarantineMax = dir, 2
+
+	jctx := &JCtx{config: Config{Host: "r1", Port: 32767}}
+	for i := 0; i < 3; i++ {
+		quarantine(jctx, "/interfaces/", []byte{0x0a, 0xff, byte(i)}, errors.New("unexpected EOF"))
+	}
+	quarantine(jctx, unknownSensor, []byte{0x0a}, errors.New("unexpected EOF"))
+
+	sensors, counts := jctx.quarantine.counts()
+	if fmt.Sprint(sensors, counts) != "[/interfaces/ unknown] [3 1]" {
+		t.Errorf("counted %v %v", sensors, counts)
+	}
+	bins, _ := filepath.Glob(filepath.Join(dir, "r1-*.bin"))
+	metas, _ := filepath.Glob(filepath.Join(dir, "r1-*.json"))
+	if len(bins) != 2 || len(metas) != 2 {
+		t.Fatalf("quarantined %v %v, want the first 2 messages", bins, metas)
+	}
+	b, err := ioutil.ReadFile(metas[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta quarantineMeta
+	if err := json.Unmarshal(b, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta.Device != "r1" || meta.Port != 32767 || meta.Vendor != "juniper-junos" || meta.Sensor != "/interfaces/" ||
+		meta.Error != "unexpected EOF" || meta.Size != 3 {
+		t.Errorf("metadata %+v", meta)
+	}
+
+	// without a directory the messages are counted only
+	*quarantineDir = ""
+	jctx = &JCtx{}
+	quarantine(jctx, unknownSensor, []byte{0x0a}, errors.New("unexpected EOF"))
+	if _, counts := jctx.quarantine.counts(); len(counts) != 1 || counts[0] != 1 {
+		t.Errorf("counted %v", counts)
+	}
+}
+
+func TestQuarantineCodec(t *testing.T) {
+	c := &quarantineCodec{}
+	good, _ := proto.Marshal(&na_pb.OpenConfigData{SystemId: "r1"})
+
+	m := new(na_pb.OpenConfigData)
+	if err := c.Unmarshal(good, m); err != nil || m.SystemId != "r1" {
+		t.Fatalf("Unmarshal() = %v, %+v", err, m)
+	}
+	if data, err := c.take(); data != nil || err != nil {
+		t.Errorf("take() = %v, %v after a message", data, err)
+	}
+
+	bad := []byte{0x0a, 0xff, 0x01}
+	if err := c.Unmarshal(bad, m); err != nil || m.SystemId != "" {
+		t.Fatalf("Unmarshal() = %v, %+v of a malformed message", err, m)
+	}
+	if data, err := c.take(); string(data) != string(bad) || err == nil {
+		t.Errorf("take() = %v, %v after a malformed message", data, err)
+	}
+	if data, err := c.take(); data != nil || err != nil {
+		t.Errorf("take() = %v, %v twice", data, err)
+	}
+}
+
+func TestQuarantineStream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-quarantine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(d string, n bool) { *quarantineDir, *noppgoroutines = d, n }(*quarantineDir, *noppgoroutines)
+	*quarantineDir, *noppgoroutines = filepath.Join(dir, "quarantine"), true
+
+	script := simulator.DefaultScript()
+	script.Faults = simulator.Faults{Malformed: 0.2, Seed: 1}
+	s, err := simulator.Start("127.0.0.1:0", script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the receive loop of the worker reads --no-per-packet-goroutines until
+	// its stream ends, the flags are restored once it recorded the disconnect
+	var jctx *JCtx
+	defer func() {
+		s.Stop()
+		if jctx != nil {
+			waitDisconnect(t, jctx)
+		}
+	}()
+	_, port, _ := net.SplitHostPort(s.Addr())
+
+	file := filepath.Join(dir, "sim.json")
+	config := fmt.Sprintf(`{"host": "127.0.0.1", "port": %s, "paths": [{"path": "/interfaces", "freq": 20}]}`, port)
+	if err := ioutil.WriteFile(file, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	workers := NewJWorkers([]string{file}, "", 2)
+	workers.StartWorkers()
+	workers.Wait()
+
+	jctx = workers.m[file].jctx
+	stats := s.Stats()
+	if stats.Malformed == 0 {
+		t.Fatalf("simulated %+v", stats)
+	}
+	if reconnects := atomic.LoadUint64(&jctx.metrics.reconnects); reconnects != 0 {
+		t.Errorf("%d reconnects after %d malformed messages", reconnects, stats.Malformed)
+	}
+	sensors, counts := jctx.quarantine.counts()
+	if len(sensors) != 1 || sensors[0] != unknownSensor || counts[0] == 0 || counts[0] > stats.Malformed {
+		t.Errorf("counted %v %v of %d malformed messages", sensors, counts, stats.Malformed)
+	}
+	bins, _ := filepath.Glob(filepath.Join(*quarantineDir, "127.0.0.1-*.bin"))
+	if uint64(len(bins)) != atomic.LoadUint64(&jctx.metrics.decodeErrs) {
+		t.Errorf("quarantined %d of %d decode errors", len(bins), atomic.LoadUint64(&jctx.metrics.decodeErrs))
+	}
+	if packets := atomic.LoadUint64(&jctx.metrics.packets); packets <= counts[0] {
+		t.Errorf("received %d packets, %d of them malformed", packets, counts[0])
+	}
+}
+
+// waitDisconnect waits for the last stream of the ended worker to end, its
+// disconnect is then the last event
+func waitDisconnect(t *testing.T, jctx *JCtx) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if events := jctx.events.events(); len(events) != 0 && events[len(events)-1].Type == EventDisconnect {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("the stream of %s did not end", jctx.config.Host)
+}
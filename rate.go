@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// RateRule derives the per second rate of monotonic counters matching match
+// and adds it as a parallel field named field+suffix (default "_rate").
+// bits is the counter width (32 or 64) used to tell rollover from reset,
+// 0 picks 32 if the previous value fits into 32 bits. A decreasing counter
+// is a rollover if the previous value was in the upper half of the range,
+// a reset otherwise. There is no rate for the first sample and after reset.
+type RateRule struct {
+	Match  string `json:"match"`
+	Suffix string `json:"suffix"`
+	Bits   int    `json:"bits"`
+}
+
+type rateRule struct {
+	re     *regexp.Regexp
+	suffix string
+	bits   int
+}
+
+// counterSample is the previous sample of a series, seen is when it was
+// received
+type counterSample struct {
+	value float64
+	t     time.Time
+	seen  time.Time
+}
+
+type rate struct {
+	sync.Mutex
+	rules []rateRule
+	last  map[string]counterSample
+	now   func() time.Time
+	swept time.Time
+}
+
+func newRateTransformer() *transformer {
+	return &transformer{
+		name: "rate",
+		new:  newRate,
+	}
+}
+
+func newRate(jctx *JCtx) (transform, error) {
+	rules := jctx.config.Transform.Rate
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	r := &rate{last: map[string]counterSample{}, now: time.Now}
+	for i, rule := range rules {
+		if rule.Bits != 0 && rule.Bits != 32 && rule.Bits != 64 {
+			return nil, fmt.Errorf("rule %d: bits must be 32 or 64", i)
+		}
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: invalid match %q: %v", i, rule.Match, err)
+		}
+		suffix := rule.Suffix
+		if suffix == "" {
+			suffix = "_rate"
+		}
+		r.rules = append(r.rules, rateRule{re: re, suffix: suffix, bits: rule.Bits})
+	}
+	return r, nil
+}
+
+// counterDiff returns the increase of the counter from prev to cur, false
+// if the counter was reset
+func counterDiff(prev, cur float64, bits int) (float64, bool) {
+	if cur >= prev {
+		return cur - prev, true
+	}
+	if bits == 0 {
+		bits = 64
+		if prev <= math.MaxUint32 {
+			bits = 32
+		}
+	}
+	max := float64(math.MaxUint32)
+	if bits == 64 {
+		max = float64(math.MaxUint64)
+	}
+	if prev < max/2 {
+		return 0, false
+	}
+	return max - prev + cur + 1, true
+}
+
+func (r *rate) rule(field string) *rateRule {
+	for i, rule := range r.rules {
+		if rule.re.MatchString(field) {
+			return &r.rules[i]
+		}
+	}
+	return nil
+}
+
+// sweep forgets the series without a sample for seriesExpiry, at most once
+// per seriesExpiry
+func (r *rate) sweep(now time.Time) {
+	if now.Sub(r.swept) < seriesExpiry {
+		return
+	}
+	for key, s := range r.last {
+		if now.Sub(s.seen) >= seriesExpiry {
+			delete(r.last, key)
+		}
+	}
+	r.swept = now
+}
+
+func (r *rate) apply(points []*point) []*point {
+	r.Lock()
+	defer r.Unlock()
+
+	now := r.now()
+	r.sweep(now)
+	out := make([]*point, 0, len(points))
+	for _, p := range points {
+		var fields map[string]interface{}
+		for k, v := range p.Fields {
+			rule := r.rule(k)
+			if rule == nil {
+				continue
+			}
+			cur, _, ok := numericValue(v)
+			if !ok {
+				continue
+			}
+
+			key := seriesKey(p, k)
+			prev, seen := r.last[key]
+			r.last[key] = counterSample{value: cur, t: p.Timestamp, seen: now}
+			if !seen {
+				continue
+			}
+			dt := p.Timestamp.Sub(prev.t).Seconds()
+			if dt <= 0 {
+				continue
+			}
+			diff, ok := counterDiff(prev.value, cur, rule.bits)
+			if !ok {
+				continue
+			}
+			if fields == nil {
+				fields = copyFields(p.Fields)
+			}
+			fields[k+rule.suffix] = diff / dt
+		}
+		if fields == nil {
+			out = append(out, p)
+		} else {
+			out = append(out, newPoint(p.Measurement, p.Tags, fields, p.Timestamp))
+		}
+	}
+	return out
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCounterDiff(t *testing.T) {
+	tests := []struct {
+		name      string
+		prev, cur float64
+		bits      int
+		diff      float64
+		ok        bool
+	}{
+		{"increase", 10, 25, 0, 15, true},
+		{"rollover-32", math.MaxUint32 - 4, 5, 0, 10, true},
+		{"rollover-64", math.MaxUint64 - 4096, 4096, 64, 8193, true},
+		{"reset", 1000, 5, 0, 0, false},
+		{"reset-64-with-small-prev", math.MaxUint32 - 4, 5, 64, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff, ok := counterDiff(test.prev, test.cur, test.bits)
+			if ok != test.ok || (ok && diff != test.diff) {
+				t.Errorf("got %v %v, want %v %v", diff, ok, test.diff, test.ok)
+			}
+		})
+	}
+}
+
+func TestRate(t *testing.T) {
+	jctx := &JCtx{}
+	jctx.config.Transform.Rate = []RateRule{{Match: "octets$"}}
+	if err := transformsInit(jctx); err != nil {
+		t.Fatalf("transformsInit failed: %v", err)
+	}
+
+	sample := func(ifd string, octets float64, sec int64) *point {
+		return newPoint("m", map[string]string{"device": "r1", "name": ifd},
+			map[string]interface{}{"in-octets": octets, "oper-status": "UP"}, time.Unix(sec, 0))
+	}
+
+	tests := []struct {
+		name string
+		in   *point
+		rate interface{}
+	}{
+		{"first-sample", sample("et-0/0/0", 1000, 10), nil},
+		{"other-series", sample("et-0/0/1", 5000, 10), nil},
+		{"rate", sample("et-0/0/0", 3000, 12), 1000.0},
+		{"same-timestamp", sample("et-0/0/0", 4000, 12), nil},
+		{"reset", sample("et-0/0/0", 10, 14), nil},
+		{"after-reset", sample("et-0/0/0", 110, 24), 10.0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := applyTransforms(jctx, []*point{test.in})
+			if got := out[0].Fields["in-octets_rate"]; got != test.rate {
+				t.Errorf("got %v, want %v", got, test.rate)
+			}
+			if _, ok := out[0].Fields["oper-status_rate"]; ok {
+				t.Errorf("rate of not matching field")
+			}
+		})
+	}
+}
+
+func TestRateExpiry(t *testing.T) {
+	jctx := &JCtx{}
+	jctx.config.Transform.Rate = []RateRule{{Match: "octets$"}}
+	tr, err := newRate(jctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := tr.(*rate)
+	now := time.Unix(1000, 0)
+	r.now = func() time.Time { return now }
+
+	sample := func(ifd string, sec int64) *point {
+		return newPoint("m", map[string]string{"device": "r1", "name": ifd},
+			map[string]interface{}{"in-octets": float64(sec)}, time.Unix(sec, 0))
+	}
+	r.apply([]*point{sample("et-0/0/0", 10), sample("et-0/0/1", 10)})
+	now = now.Add(seriesExpiry / 2)
+	r.apply([]*point{sample("et-0/0/0", 20)})
+	if len(r.last) != 2 {
+		t.Fatalf("got %d series before the expiry, want 2", len(r.last))
+	}
+	now = now.Add(seriesExpiry / 2)
+	out := r.apply([]*point{sample("et-0/0/0", 30)})
+	if len(r.last) != 1 {
+		t.Errorf("got %d series after the expiry, want 1", len(r.last))
+	}
+	if got := out[0].Fields["in-octets_rate"]; got != 1.0 {
+		t.Errorf("rate of the kept series: got %v, want 1", got)
+	}
+	now = now.Add(seriesExpiry)
+	if out := r.apply([]*point{sample("et-0/0/1", 40)}); out[0].Fields["in-octets_rate"] != nil {
+		t.Errorf("rate of an expired series: got %v", out[0].Fields["in-octets_rate"])
+	}
+}
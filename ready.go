@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// readiness is the state of the collector /readyz reports
+type readiness struct {
+	Ready     bool     `json:"ready"`
+	Devices   int      `json:"devices"`
+	Attempted int      `json:"attempted"`
+	Connected int      `json:"connected"`
+	Failing   []string `json:"failing-sinks"`
+	// Standby is the standby of --ha, it is ready without collecting
+	Standby bool `json:"standby,omitempty"`
+	// Unassigned are the devices assigned to the other members of
+	// --cluster, they are not in Devices
+	Unassigned int      `json:"unassigned,omitempty"`
+	Reasons    []string `json:"reasons,omitempty"`
+}
+
+// failingSinks returns the sinks and InfluxDB servers of the worker whose
+// last write failed, as device/sink
+func failingSinks(jctx *JCtx) []string {
+	var failing []string
+	for _, s := range jctx.sinks {
+		if atomic.LoadInt32(&s.timer.failing) == 1 {
+			failing = append(failing, jctx.config.Host+"/"+s.name)
+		}
+	}
+	for _, w := range jctx.influxCtx.writers {
+		f := &w.timer.failing
+		if w.shared != nil {
+			f = &w.shared.failing
+		}
+		if atomic.LoadInt32(f) == 1 {
+			failing = append(failing, jctx.config.Host+"/influx/"+w.addr)
+		}
+	}
+	return failing
+}
+
+// checkReadiness tells whether the collector is ready: every device was
+// attempted (or is paused), at least the connected fraction of them is
+// connected and, with sinks, no sink fails to write. The standby of --ha
+// needs the sinks only, the devices assigned to the other members of
+// --cluster are left out.
+func checkReadiness(workers []*JCtx, connected float64, sinks bool) readiness {
+	r := readiness{Failing: []string{}, Standby: ha.standby() != nil}
+	for _, jctx := range workers {
+		if !cluster.owns(jctx) {
+			r.Unassigned++
+			continue
+		}
+		r.Devices++
+		paused, _ := jctx.paused.state()
+		if paused || atomic.LoadInt32(&jctx.metrics.attempted) == 1 {
+			r.Attempted++
+		}
+		if atomic.LoadInt32(&jctx.metrics.connected) == 1 {
+			r.Connected++
+		}
+		if sinks {
+			r.Failing = append(r.Failing, failingSinks(jctx)...)
+		}
+	}
+	sort.Strings(r.Failing)
+
+	if len(workers) == 0 {
+		r.Reasons = append(r.Reasons, "no devices")
+	}
+	if cluster.outside() {
+		r.Reasons = append(r.Reasons, "not a member of the cluster")
+	}
+	if r.Attempted < r.Devices && !r.Standby {
+		r.Reasons = append(r.Reasons, fmt.Sprintf("%d of %d devices not attempted yet", r.Devices-r.Attempted, r.Devices))
+	}
+	if want := int(math.Ceil(connected * float64(r.Devices))); r.Connected < want && !r.Standby {
+		r.Reasons = append(r.Reasons, fmt.Sprintf("%d of %d devices connected, %d wanted", r.Connected, r.Devices, want))
+	}
+	if len(r.Failing) != 0 {
+		r.Reasons = append(r.Reasons, "sinks failing: "+strings.Join(r.Failing, ", "))
+	}
+	r.Ready = len(r.Reasons) == 0
+	return r
+}
+
+// healthzHandler is the liveness probe, jtimon is alive while it serves it
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// readyzHandler is the readiness probe, it serves the readiness with 200 if
+// the collector is ready and 503 otherwise
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	ready := checkReadiness(deviceWorkers(""), *readyConnected, *readySinks)
+	w.Header().Set("Content-Type", "application/json")
+	if !ready.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(ready)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestCheckReadiness(t *testing.T) {
+	newWorker := func(host string, attempted, connected int32) *JCtx {
+		jctx := &JCtx{config: Config{Host: host}}
+		jctx.metrics.attempted, jctx.metrics.connected = attempted, connected
+		return jctx
+	}
+	paused := newWorker("r4", 0, 0)
+	paused.paused.pauseDevice()
+	failing := newWorker("r5", 1, 1)
+	failing.sinks = []*sinkCtx{{name: "kafka"}, {name: "loki"}}
+	failing.sinks[1].timer.failing = 1
+	shared := &sharedInfluxWriter{failing: 1}
+	failing.influxCtx.writers = []*influxWriter{{addr: "db1:8086"}, {addr: "db2:8086", shared: shared}}
+
+	tests := []struct {
+		name      string
+		workers   []*JCtx
+		connected float64
+		sinks     bool
+		want      readiness
+	}{
+		{
+			name:    "no devices",
+			workers: nil,
+			want:    readiness{Failing: []string{}, Reasons: []string{"no devices"}},
+		},
+		{
+			name:    "all attempted",
+			workers: []*JCtx{newWorker("r1", 1, 1), newWorker("r2", 1, 0), paused},
+			want:    readiness{Ready: true, Devices: 3, Attempted: 3, Connected: 1, Failing: []string{}},
+		},
+		{
+			name:    "not attempted yet",
+			workers: []*JCtx{newWorker("r1", 1, 1), newWorker("r3", 0, 0)},
+			want: readiness{Devices: 2, Attempted: 1, Connected: 1, Failing: []string{},
+				Reasons: []string{"1 of 2 devices not attempted yet"}},
+		},
+		{
+			name:      "connected fraction",
+			workers:   []*JCtx{newWorker("r1", 1, 1), newWorker("r2", 1, 0), newWorker("r3", 1, 0)},
+			connected: 0.5,
+			want: readiness{Devices: 3, Attempted: 3, Connected: 1, Failing: []string{},
+				Reasons: []string{"1 of 3 devices connected, 2 wanted"}},
+		},
+		{
+			name:    "failing sinks",
+			workers: []*JCtx{failing},
+			sinks:   true,
+			want: readiness{Devices: 1, Attempted: 1, Connected: 1, Failing: []string{"r5/influx/db2:8086", "r5/loki"},
+				Reasons: []string{"sinks failing: r5/influx/db2:8086, r5/loki"}},
+		},
+		{
+			name:    "sinks not checked",
+			workers: []*JCtx{failing},
+			want:    readiness{Ready: true, Devices: 1, Attempted: 1, Connected: 1, Failing: []string{}},
+		},
+	}
+	for _, test := range tests {
+		if got := checkReadiness(test.workers, test.connected, test.sinks); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestReadyzHandler(t *testing.T) {
+	r1 := &JCtx{config: Config{Host: "r1"}}
+	dropsInit(r1)
+	defer dropsStop(r1)
+
+	get := func() (int, readiness) {
+		rec := httptest.NewRecorder()
+		readyzHandler(rec, httptest.NewRequest("GET", "/readyz", nil))
+		var got readiness
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, got
+	}
+	if code, got := get(); code != http.StatusServiceUnavailable || got.Ready {
+		t.Errorf("not attempted: got %d %+v", code, got)
+	}
+	r1.metrics.attempted = 1
+	if code, got := get(); code != http.StatusOK || !got.Ready {
+		t.Errorf("attempted: got %d %+v", code, got)
+	}
+
+	rec := httptest.NewRecorder()
+	healthzHandler(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "ok\n" {
+		t.Errorf("healthz: got %d %q", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recentState keeps the last points of each subscription path of a worker
+type recentState struct {
+	sync.Mutex
+	rings map[string]*recentRing
+}
+
+// recentRing is the ring buffer of the last points of a path
+type recentRing struct {
+	points []*point
+	next   int
+	last   time.Time
+}
+
+func (r *recentRing) add(p *point, n int) {
+	if len(r.points) < n {
+		r.points = append(r.points, p)
+		return
+	}
+	r.points[r.next] = p
+	r.next = (r.next + 1) % len(r.points)
+}
+
+// list returns the points of the ring, the oldest first
+func (r *recentRing) list() []*point {
+	l := make([]*point, 0, len(r.points))
+	l = append(l, r.points[r.next:]...)
+	return append(l, r.points[:r.next]...)
+}
+
+// recentKey is the subscription path the point is kept for
+func recentKey(jctx *JCtx, p *point) string {
+	sensor := sensorPath(p.Tags["sensor"])
+	if path, _ := jctx.paths.match(sensor); path != "" {
+		return path
+	}
+	if sensor != "" {
+		return sensor
+	}
+	return p.Measurement
+}
+
+// recentEnabled tells whether the last points are kept, the telemetry is
+// decoded for them even without sinks
+func recentEnabled() bool {
+	return *recentPoints > 0
+}
+
+// keepRecent keeps copies of the points of the worker for GET
+// /devices/{name}/last, the sinks may change theirs
+func keepRecent(jctx *JCtx, points []*point) {
+	if !recentEnabled() || len(points) == 0 {
+		return
+	}
+	now := time.Now()
+	jctx.recent.Lock()
+	defer jctx.recent.Unlock()
+	if jctx.recent.rings == nil {
+		jctx.recent.rings = map[string]*recentRing{}
+	}
+	for _, p := range points {
+		c := newPoint(p.Measurement, make(map[string]string, len(p.Tags)), copyFields(p.Fields), p.Timestamp)
+		for k, v := range p.Tags {
+			c.Tags[k] = v
+		}
+		key := recentKey(jctx, p)
+		r, ok := jctx.recent.rings[key]
+		if !ok {
+			r = &recentRing{}
+			jctx.recent.rings[key] = r
+		}
+		r.add(c, *recentPoints)
+		r.last = now
+	}
+}
+
+// recentPath is a path in the answer of GET /devices/{name}/last
+type recentPath struct {
+	Path     string    `json:"path"`
+	Received time.Time `json:"received"`
+	Points   []*point  `json:"points"`
+}
+
+// deviceLast answers the last points of the paths of the worker starting
+// with ?path=, the last ?count= of each, oldest first
+func deviceLast(w http.ResponseWriter, r *http.Request, jctx *JCtx) {
+	if !recentEnabled() {
+		http.Error(w, "the last points are not kept, see --recent-points", http.StatusNotFound)
+		return
+	}
+	count := *recentPoints
+	if v := r.URL.Query().Get("count"); v != "" {
+		var err error
+		if count, err = strconv.Atoi(v); err != nil || count <= 0 {
+			http.Error(w, fmt.Sprintf("invalid count %q", v), http.StatusBadRequest)
+			return
+		}
+	}
+	path := r.URL.Query().Get("path")
+
+	paths := []recentPath{}
+	jctx.recent.Lock()
+	for key, ring := range jctx.recent.rings {
+		if !strings.HasPrefix(key, path) {
+			continue
+		}
+		points := ring.list()
+		if len(points) > count {
+			points = points[len(points)-count:]
+		}
+		paths = append(paths, recentPath{Path: key, Received: ring.last, Points: points})
+	}
+	jctx.recent.Unlock()
+	sort.Slice(paths, func(i, j int) bool { return paths[i].Path < paths[j].Path })
+
+	if path != "" && len(paths) == 0 {
+		http.Error(w, fmt.Sprintf("no points of %s", path), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, paths)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestKeepRecent(t *testing.T) {
+	defer func(n int) { *recentPoints = n }(*recentPoints)
+	jctx := &JCtx{file: "r1.json", config: Config{Host: "r1"}, paths: newPathTrie([]PathsConfig{{Path: "/junos/system/linecard/interface/"}})}
+	dropsInit(jctx)
+	defer dropsStop(jctx)
+
+	ifd := func(i int) *point {
+		return newPoint("/interfaces/", map[string]string{"sensor": "sensor_1000_1_1:/junos/system/linecard/interface/:/interfaces/:PFE"},
+			map[string]interface{}{"in-pkts": float64(i)}, time.Unix(int64(i), 0))
+	}
+	bgp := newPoint("/bgp/", map[string]string{"sensor": "/bgp/"}, map[string]interface{}{"state": "up"}, time.Unix(9, 0))
+	last := func(url string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		devicesHandler(rec, httptest.NewRequest("GET", url, nil))
+		return rec
+	}
+
+	*recentPoints = 0
+	keepRecent(jctx, []*point{ifd(0)})
+	if rec := last("/devices/r1/last"); rec.Code != http.StatusNotFound || jctx.recent.rings != nil {
+		t.Errorf("disabled: got %d %s", rec.Code, rec.Body)
+	}
+
+	*recentPoints = 3
+	points := []*point{ifd(1), ifd(2), bgp, ifd(3), ifd(4)}
+	keepRecent(jctx, points[:3])
+	keepRecent(jctx, points[3:])
+	points[4].Fields["in-pkts"] = float64(40)
+	points[4].Tags["device"] = "r1"
+
+	tests := []struct {
+		url   string
+		code  int
+		paths map[string][]float64
+	}{
+		{url: "/devices/r1/last", code: http.StatusOK, paths: map[string][]float64{"/bgp/": nil, "/junos/system/linecard/interface/": {2, 3, 4}}},
+		{url: "/devices/r1/last?path=/junos/", code: http.StatusOK, paths: map[string][]float64{"/junos/system/linecard/interface/": {2, 3, 4}}},
+		{url: "/devices/r1/last?path=/junos/&count=1", code: http.StatusOK, paths: map[string][]float64{"/junos/system/linecard/interface/": {4}}},
+		{url: "/devices/r1/last?path=/lldp/", code: http.StatusNotFound},
+		{url: "/devices/r1/last?count=0", code: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		rec := last(test.url)
+		if rec.Code != test.code {
+			t.Errorf("%s: got %d %s, want %d", test.url, rec.Code, rec.Body, test.code)
+			continue
+		}
+		if test.code != http.StatusOK {
+			continue
+		}
+		var got []recentPath
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(test.paths) {
+			t.Errorf("%s: got %s", test.url, rec.Body)
+			continue
+		}
+		for _, p := range got {
+			want, ok := test.paths[p.Path]
+			if !ok || p.Received.IsZero() {
+				t.Errorf("%s: got path %+v", test.url, p)
+				continue
+			}
+			if want == nil {
+				if len(p.Points) != 1 || p.Points[0].Fields["state"] != "up" {
+					t.Errorf("%s: got %s points %+v", test.url, p.Path, p.Points)
+				}
+				continue
+			}
+			if len(p.Points) != len(want) {
+				t.Errorf("%s: got %s points %+v", test.url, p.Path, p.Points)
+				continue
+			}
+			for i, pt := range p.Points {
+				if pt.Fields["in-pkts"] != want[i] || pt.Tags["device"] != "" {
+					t.Errorf("%s: got point %d %+v, want in-pkts %v", test.url, i, pt, want[i])
+				}
+			}
+		}
+	}
+}
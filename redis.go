@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+// RedisConfig is the config of the Redis Streams sink
+type RedisConfig struct {
+	Server   string `json:"server"`
+	Port     int    `json:"port"`
+	Password string `json:"password"`
+	DB       int    `json:"db"`
+	Stream   string `json:"stream"`
+	MaxLen   int    `json:"maxlen"`
+	BatchConfig
+}
+
+const redisTimeout = 30 * time.Second
+
+type redisSink struct {
+	cfg    RedisConfig
+	stream *template.Template
+	conn   net.Conn
+	r      *bufio.Reader
+}
+
+func newRedisSink() *sink {
+	return &sink{
+		name: "redis",
+		open: openRedisSink,
+	}
+}
+
+func openRedisSink(jctx *JCtx) (sinkWriter, BatchConfig, error) {
+	cfg := jctx.config.Redis
+	if cfg.Server == "" {
+		return nil, cfg.BatchConfig, nil
+	}
+	if cfg.Port == 0 {
+		cfg.Port = DefaultRedisPort
+	}
+
+	stream := cfg.Stream
+	if stream == "" {
+		stream = DefaultRedisStream
+	}
+	t, err := newKeyTemplate("stream", stream)
+	if err != nil {
+		return nil, cfg.BatchConfig, err
+	}
+	return &redisSink{cfg: cfg, stream: t}, cfg.BatchConfig, nil
+}
+
+// redisCommand encodes one command as RESP array of bulk strings
+func redisCommand(buf *bytes.Buffer, args ...string) {
+	fmt.Fprintf(buf, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+}
+
+// redisReply reads one RESP reply, error replies are returned as error
+func redisReply(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 3 {
+		return "", fmt.Errorf("redis: short reply %q", line)
+	}
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	case '+', ':':
+		return line[1:], nil
+	case '-':
+		return "", fmt.Errorf("redis: %s", line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", fmt.Errorf("redis: bad bulk length %q", line)
+		}
+		if n < 0 {
+			return "", nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", err
+		}
+		return string(b[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", fmt.Errorf("redis: bad array length %q", line)
+		}
+		for i := 0; i < n; i++ {
+			if _, err := redisReply(r); err != nil {
+				return "", err
+			}
+		}
+		return "", nil
+	}
+	return "", fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+func (s *redisSink) connect() error {
+	addr := net.JoinHostPort(s.cfg.Server, strconv.Itoa(s.cfg.Port))
+	conn, err := net.DialTimeout("tcp", addr, redisTimeout)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.r = bufio.NewReader(conn)
+
+	var buf bytes.Buffer
+	n := 0
+	if s.cfg.Password != "" {
+		redisCommand(&buf, "AUTH", s.cfg.Password)
+		n++
+	}
+	if s.cfg.DB != 0 {
+		redisCommand(&buf, "SELECT", strconv.Itoa(s.cfg.DB))
+		n++
+	}
+	if n != 0 {
+		if err := s.roundTrip(&buf, n); err != nil {
+			s.close()
+			return err
+		}
+	}
+	return nil
+}
+
+// roundTrip writes pipelined commands and reads n replies
+func (s *redisSink) roundTrip(buf *bytes.Buffer, n int) error {
+	s.conn.SetDeadline(time.Now().Add(redisTimeout))
+	defer s.conn.SetDeadline(time.Time{})
+
+	if _, err := s.conn.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	// read all of the replies to keep the connection in sync, report first error
+	var rerr error
+	for i := 0; i < n; i++ {
+		if _, err := redisReply(s.r); err != nil {
+			if _, ok := err.(net.Error); ok || err == io.EOF {
+				return err
+			}
+			if rerr == nil {
+				rerr = err
+			}
+		}
+	}
+	return rerr
+}
+
+func (s *redisSink) write(points []*point) error {
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	n := 0
+	for _, p := range points {
+		stream, err := execKeyTemplate(s.stream, p)
+		if err != nil {
+			return err
+		}
+		tags, err := json.Marshal(p.Tags)
+		if err != nil {
+			continue
+		}
+		fields, err := json.Marshal(p.Fields)
+		if err != nil {
+			continue
+		}
+
+		args := []string{"XADD", stream}
+		if s.cfg.MaxLen > 0 {
+			args = append(args, "MAXLEN", "~", strconv.Itoa(s.cfg.MaxLen))
+		}
+		args = append(args, "*",
+			"measurement", p.Measurement,
+			"timestamp", strconv.FormatInt(p.Timestamp.UnixNano(), 10),
+			"tags", string(tags),
+			"fields", string(fields))
+		redisCommand(&buf, args...)
+		n++
+	}
+
+	err := s.roundTrip(&buf, n)
+	if _, ok := err.(net.Error); ok || err == io.EOF {
+		// start over with a new connection next time
+		s.close()
+	}
+	return err
+}
+
+func (s *redisSink) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+		s.r = nil
+	}
+}
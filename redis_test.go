@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRedis answers every command with reply and sends the commands on cmds
+func fakeRedis(t *testing.T, reply string, cmds chan<- []string) (string, int) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			cmd := []string{}
+			for i := 0; i < n; i++ {
+				line, _ = r.ReadString('\n')
+				size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+				b := make([]byte, size+2)
+				io.ReadFull(r, b)
+				cmd = append(cmd, string(b[:size]))
+			}
+			cmds <- cmd
+			fmt.Fprint(conn, reply)
+		}
+	}()
+
+	addr := l.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func TestRedisSink(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    RedisConfig
+		reply  string
+		err    bool
+		auth   bool
+		stream string
+		maxlen bool
+	}{
+		{
+			name:   "default-stream",
+			reply:  "$3\r\n1-0\r\n",
+			stream: "jtimon:r1",
+		},
+		{
+			name:   "auth-stream-template-maxlen",
+			cfg:    RedisConfig{Password: "secret", Stream: "{{.Measurement}}:{{.Tags.device}}", MaxLen: 100},
+			reply:  "+OK\r\n",
+			auth:   true,
+			stream: "m:r1",
+			maxlen: true,
+		},
+		{
+			name:   "error-reply",
+			reply:  "-ERR wrong type\r\n",
+			err:    true,
+			stream: "jtimon:r1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmds := make(chan []string, 10)
+			jctx := &JCtx{}
+			jctx.config.Redis = test.cfg
+			jctx.config.Redis.Server, jctx.config.Redis.Port = fakeRedis(t, test.reply, cmds)
+
+			w, _, err := openRedisSink(jctx)
+			if err != nil {
+				t.Fatalf("openRedisSink failed: %v", err)
+			}
+			defer w.close()
+
+			p := newPoint("m", map[string]string{"device": "r1"}, map[string]interface{}{"/a": 1.0}, time.Unix(1, 0))
+			err = w.write([]*point{p})
+			if test.err && err == nil {
+				t.Errorf("want error, got nil")
+			}
+			if !test.err && err != nil {
+				t.Errorf("write failed: %v", err)
+			}
+
+			if test.auth {
+				if cmd := <-cmds; cmd[0] != "AUTH" || cmd[1] != "secret" {
+					t.Errorf("want AUTH secret, got %v", cmd)
+				}
+			}
+			cmd := <-cmds
+			if cmd[0] != "XADD" || cmd[1] != test.stream {
+				t.Errorf("want XADD %s, got %v", test.stream, cmd)
+			}
+			if test.maxlen && (cmd[2] != "MAXLEN" || cmd[4] != "100") {
+				t.Errorf("want MAXLEN ~ 100, got %v", cmd)
+			}
+			if last := cmd[len(cmd)-1]; last != `{"/a":1}` {
+				t.Errorf("fields: want {\"/a\":1}, got %s", last)
+			}
+		})
+	}
+}
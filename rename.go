@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// RenameRule maps field names to aliases. Either field (exact name) or
+// match (regex) is given, with match the alias can refer to submatches
+// e.g. "${1}". Exact names win over regexes, among regexes the first
+// one which matches the field wins.
+type RenameRule struct {
+	Field string `json:"field"`
+	Match string `json:"match"`
+	Alias string `json:"alias"`
+}
+
+type renameRegex struct {
+	re    *regexp.Regexp
+	alias string
+}
+
+type rename struct {
+	exact map[string]string
+	rules []renameRegex
+}
+
+func newRenameTransformer() *transformer {
+	return &transformer{
+		name: "rename",
+		new:  newRename,
+	}
+}
+
+func newRename(jctx *JCtx) (transform, error) {
+	rules := jctx.config.Transform.Rename
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	r := &rename{exact: map[string]string{}}
+	for i, rule := range rules {
+		switch {
+		case rule.Field != "" && rule.Match != "":
+			return nil, fmt.Errorf("rule %d: use either field or match", i)
+		case rule.Field != "":
+			if _, ok := r.exact[rule.Field]; !ok {
+				r.exact[rule.Field] = rule.Alias
+			}
+		case rule.Match != "":
+			re, err := regexp.Compile(rule.Match)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid match %q: %v", i, rule.Match, err)
+			}
+			r.rules = append(r.rules, renameRegex{re: re, alias: rule.Alias})
+		default:
+			return nil, fmt.Errorf("rule %d: field or match is missing", i)
+		}
+	}
+	return r, nil
+}
+
+func (r *rename) name(field string) string {
+	// exact names are looked up first as they are cheap
+	if alias, ok := r.exact[field]; ok {
+		return alias
+	}
+	for _, rule := range r.rules {
+		if m := rule.re.FindStringSubmatchIndex(field); m != nil {
+			return string(rule.re.ExpandString(nil, rule.alias, field, m))
+		}
+	}
+	return field
+}
+
+func (r *rename) apply(points []*point) []*point {
+	out := make([]*point, 0, len(points))
+	for _, p := range points {
+		fields := make(map[string]interface{}, len(p.Fields))
+		for k, v := range p.Fields {
+			fields[r.name(k)] = v
+		}
+		out = append(out, newPoint(p.Measurement, p.Tags, fields, p.Timestamp))
+	}
+	return out
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRename(t *testing.T) {
+	rules := []RenameRule{
+		{Field: "/interfaces/interface/state/counters/in-octets", Alias: "rx-bytes"},
+		{Match: `^/interfaces/interface/state/counters/(.*)$`, Alias: "${1}"},
+		{Match: `counters`, Alias: "never"},
+	}
+
+	tests := []struct {
+		name  string
+		field string
+		want  string
+	}{
+		{"exact", "/interfaces/interface/state/counters/in-octets", "rx-bytes"},
+		{"regex", "/interfaces/interface/state/counters/out-octets", "out-octets"},
+		{"first-regex-wins", "/interfaces/interface/state/counters/in-errors", "in-errors"},
+		{"no-match", "/interfaces/interface/state/oper-status", "/interfaces/interface/state/oper-status"},
+	}
+
+	jctx := &JCtx{}
+	jctx.config.Transform.Rename = rules
+	if err := transformsInit(jctx); err != nil {
+		t.Fatalf("transformsInit failed: %v", err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			in := newPoint("m", map[string]string{"device": "r1"}, map[string]interface{}{test.field: 1.0}, time.Unix(1, 0))
+			out := applyTransforms(jctx, []*point{in})
+			want := map[string]interface{}{test.want: 1.0}
+			if !reflect.DeepEqual(out[0].Fields, want) {
+				t.Errorf("got %v, want %v", out[0].Fields, want)
+			}
+			if _, ok := in.Fields[test.field]; !ok {
+				t.Errorf("input point must not be modified")
+			}
+		})
+	}
+
+	for _, bad := range [][]RenameRule{
+		{{Alias: "x"}},
+		{{Field: "a", Match: "b", Alias: "x"}},
+		{{Match: "(", Alias: "x"}},
+	} {
+		jctx := &JCtx{}
+		jctx.config.Transform.Rename = bad
+		if err := transformsInit(jctx); err == nil {
+			t.Errorf("%+v: want error, got nil", bad)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	na_pb "github.com/nileshsimaria/jtimon/telemetry"
+)
+
+// replayRecording feeds the messages jtimon record recorded for the config
+// file of the worker, {config}.testmeta and {config}.testbytes, through its
+// transforms and outputs. It returns the number of messages replayed.
+func replayRecording(jctx *JCtx) (int, error) {
+	return eachRecorded(jctx, func(ocData *na_pb.OpenConfigData) {
+		rtime := time.Now()
+		if *print {
+			handleOnePacket(ocData, jctx)
+		}
+		if *explain {
+			explainLog(jctx, ocData, rtime)
+		}
+		addIDB(ocData, jctx, rtime, nil)
+	})
+}
+
+// eachRecorded calls fn with the messages recorded for the config file of
+// the worker, in order, and returns their number
+func eachRecorded(jctx *JCtx, fn func(*na_pb.OpenConfigData)) (int, error) {
+	if name := jctx.config.Vendor.Name; name != "" && name != "juniper-junos" {
+		return 0, fmt.Errorf("the recordings of vendor %s can not be replayed", name)
+	}
+	meta, err := ioutil.ReadFile(jctx.file + ".testmeta")
+	if err != nil {
+		return 0, err
+	}
+	data, err := ioutil.ReadFile(jctx.file + ".testbytes")
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, size := range strings.Split(string(meta), ":") {
+		if size == "" {
+			continue
+		}
+		l, err := strconv.Atoi(size)
+		if err != nil || l < 0 || l > len(data) {
+			return n, fmt.Errorf("%s.testmeta: invalid size %q of message %d", jctx.file, size, n+1)
+		}
+		ocData := new(na_pb.OpenConfigData)
+		if err := proto.Unmarshal(data[:l], ocData); err != nil {
+			return n, fmt.Errorf("%s.testbytes: message %d: %v", jctx.file, n+1, err)
+		}
+		data = data[l:]
+		fn(ocData)
+		n++
+	}
+	if len(data) != 0 {
+		return n, fmt.Errorf("%s.testbytes: %d bytes after the messages of %s.testmeta", jctx.file, len(data), jctx.file)
+	}
+	return n, nil
+}
+
+// replayWait is how long the outputs of a worker take to write what they
+// are given, one batch of InfluxDB or of the sinks
+func replayWait(jctx *JCtx) time.Duration {
+	wait := time.Duration(0)
+	if jctx.influxCtx.influxClient != nil {
+		wait = time.Duration(jctx.config.Influx.BatchFrequency) * time.Millisecond
+	}
+	if len(jctx.sinks) != 0 && time.Duration(DefaultSinkBatchFreq)*time.Millisecond > wait {
+		wait = time.Duration(DefaultSinkBatchFreq) * time.Millisecond
+	}
+	return wait
+}
+
+// replayMain runs jtimon replay with the config files, it exits with status
+// 1 if one fails or differs from its golden file
+func replayMain() {
+	if err := GetConfigFiles(configFiles, *configFileList); err != nil {
+		log.Printf("config parsing error: %s", err)
+		return
+	}
+	wait := time.Duration(0)
+	failed := 0
+	for _, file := range *configFiles {
+		jctx := &JCtx{file: file, stats: statsCtx{startTime: time.Now()}}
+		if err := ConfigRead(jctx, true, nil); err != nil {
+			log.Printf("%v", err)
+			failed++
+			continue
+		}
+		if alias, err := NewAlias(jctx.config.Alias); err == nil {
+			jctx.alias = alias
+		}
+		if *golden || *goldenUpdate {
+			if err := checkGolden(jctx, *goldenFormat, *goldenUpdate); err != nil {
+				log.Printf("%s: %v", file, err)
+				failed++
+				continue
+			}
+			if *goldenUpdate {
+				log.Printf("%s: wrote %s", file, goldenFile(file, *goldenFormat))
+			} else {
+				log.Printf("%s: matches %s", file, goldenFile(file, *goldenFormat))
+			}
+			continue
+		}
+		n, err := replayRecording(jctx)
+		if err != nil {
+			log.Printf("%s: %v", file, err)
+		}
+		log.Printf("%s: replayed %d messages", file, n)
+		if w := replayWait(jctx); w > wait {
+			wait = w
+		}
+	}
+	// the last batches are written
+	time.Sleep(wait)
+	if failed != 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(c, n bool) { *conTestData, *noppgoroutines = c, n }(*conTestData, *noppgoroutines)
+	*conTestData, *noppgoroutines = true, true
+
+	// the recording of the junos tests
+	src := "tests/data/juniper-junos/config/interfaces.json"
+	file := filepath.Join(dir, "interfaces.json")
+	for _, ext := range []string{"", ".testmeta", ".testbytes", ".testexp"} {
+		b, err := ioutil.ReadFile(src + ext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file+ext, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	jctx := &JCtx{file: file, stats: statsCtx{startTime: time.Now()}}
+	if err := ConfigRead(jctx, true, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer dropsStop(jctx)
+	testRes, err := os.Create(file + ".testres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testRes.Close()
+	jctx.testRes = testRes
+
+	n, err := replayRecording(jctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 6 {
+		t.Errorf("replayed %d messages", n)
+	}
+	if err := compareResults(jctx); err != nil {
+		t.Error(err)
+	}
+
+	// the broken recordings
+	*conTestData = false
+	tests := []struct {
+		name string
+		meta string
+		data string
+		err  string
+	}{
+		{name: "invalid size", meta: "12:x:", err: "invalid size"},
+		{name: "short", meta: "1000000:", err: "invalid size"},
+		{name: "trailing bytes", meta: "", data: "abc", err: "3 bytes after"},
+		{name: "not a message", meta: "3:", data: "\xff\xff\xff", err: "message 1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ioutil.WriteFile(file+".testmeta", []byte(test.meta), 0600)
+			ioutil.WriteFile(file+".testbytes", []byte(test.data), 0600)
+			if _, err := replayRecording(jctx); err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got %v, want %q", err, test.err)
+			}
+		})
+	}
+	jctx.config.Vendor.Name = "cisco-iosxr"
+	if _, err := replayRecording(jctx); err == nil {
+		t.Errorf("cisco recording replayed")
+	}
+}
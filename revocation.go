@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// revocationTimeout is how long a fetch of a CRL or OCSP response may take
+	revocationTimeout = 10 * time.Second
+	// revocationMaxSize is the largest CRL or OCSP response read
+	revocationMaxSize = 32 << 20
+	// revocationTTL is how long the CRLs and OCSP responses without a next
+	// update are kept
+	revocationTTL = 5 * time.Minute
+)
+
+var revocationClient = &http.Client{Timeout: revocationTimeout}
+
+// revocationCache keeps the CRLs of the URLs and the OCSP responses until
+// their next update
+var revocationCache = struct {
+	sync.Mutex
+	crls map[string]cachedCRL
+	ocsp map[string]cachedOCSP
+}{crls: map[string]cachedCRL{}, ocsp: map[string]cachedOCSP{}}
+
+type cachedCRL struct {
+	crl     *pkix.CertificateList
+	expires time.Time
+}
+
+type cachedOCSP struct {
+	revoked bool
+	expires time.Time
+}
+
+// revocationEnabled tells whether the device certificates are checked for
+// revocation
+func revocationEnabled(cfg TLSConfig) bool {
+	return len(cfg.CRL) != 0 || cfg.OCSP
+}
+
+// validateRevocation checks the revocation settings of the TLS config of a
+// device, they need the certificate of the device to be verified
+func validateRevocation(cfg TLSConfig) error {
+	if !revocationEnabled(cfg) {
+		if cfg.RevocationSoftFail {
+			return fmt.Errorf("tls revocation-soft-fail needs crl or ocsp")
+		}
+		return nil
+	}
+	if cfg.CA == "" && !cfg.SPIFFE {
+		return fmt.Errorf("tls crl and ocsp need a ca or spiffe")
+	}
+	return nil
+}
+
+// revocationTLS makes t check the certificate of the device against the CRLs
+// and its OCSP responder after the verification of its chain. A revoked
+// certificate always fails the handshake, CRLs or responders which can not
+// be had fail it unless revocation-soft-fail is set.
+func revocationTLS(jctx *JCtx, t *tls.Config) {
+	cfg := jctx.config.TLS
+	if !revocationEnabled(cfg) {
+		return
+	}
+	t.VerifyPeerCertificate = func(rawCerts [][]byte, chains [][]*x509.Certificate) error {
+		if len(chains) == 0 || len(chains[0]) == 0 {
+			return fmt.Errorf("revocation: no verified chain")
+		}
+		leaf, issuer := chains[0][0], chains[0][0]
+		if len(chains[0]) > 1 {
+			issuer = chains[0][1]
+		}
+		return checkRevocation(cfg, leaf, issuer, time.Now(), func(err error) {
+			jLogWarn(jctx, fmt.Sprintf("[%s] revocation of %s not checked (revocation-soft-fail): %v", jctx.config.Host, leaf.Subject, err))
+		})
+	}
+}
+
+// checkRevocation checks leaf against the CRLs and the OCSP responder of the
+// TLS config, the errors other than a revocation go to softFail when set
+func checkRevocation(cfg TLSConfig, leaf, issuer *x509.Certificate, now time.Time, softFail func(error)) error {
+	check := func(revoked bool, err error) error {
+		if revoked {
+			return fmt.Errorf("certificate %s (serial %s) is revoked", leaf.Subject, leaf.SerialNumber)
+		}
+		if err != nil && cfg.RevocationSoftFail {
+			softFail(err)
+			return nil
+		}
+		return err
+	}
+	if len(cfg.CRL) != 0 {
+		if err := check(crlRevoked(cfg.CRL, leaf, issuer, now)); err != nil {
+			return err
+		}
+	}
+	if cfg.OCSP {
+		if err := check(ocspRevoked(leaf, issuer, now)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// crlRevoked looks for leaf in the CRLs of its issuer, files or URLs
+func crlRevoked(locations []string, leaf, issuer *x509.Certificate, now time.Time) (bool, error) {
+	found := false
+	for _, location := range locations {
+		crl, err := loadCRL(location, now)
+		if err != nil {
+			return false, err
+		}
+		if crl.TBSCertList.Issuer.String() != leaf.Issuer.String() {
+			continue
+		}
+		if err := issuer.CheckCRLSignature(crl); err != nil {
+			return false, fmt.Errorf("crl %s: %v", location, err)
+		}
+		if crl.HasExpired(now) {
+			return false, fmt.Errorf("crl %s expired on %v", location, crl.TBSCertList.NextUpdate)
+		}
+		found = true
+		for _, revoked := range crl.TBSCertList.RevokedCertificates {
+			if revoked.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+				return true, nil
+			}
+		}
+	}
+	if !found {
+		return false, fmt.Errorf("no crl of %s", leaf.Issuer)
+	}
+	return false, nil
+}
+
+// loadCRL reads the CRL of a file, PEM or DER, at each handshake, the ones
+// of URLs are kept until their next update
+func loadCRL(location string, now time.Time) (*pkix.CertificateList, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		b, err := ioutil.ReadFile(location)
+		if err != nil {
+			return nil, err
+		}
+		crl, err := x509.ParseCRL(b)
+		if err != nil {
+			return nil, fmt.Errorf("crl %s: %v", location, err)
+		}
+		return crl, nil
+	}
+
+	revocationCache.Lock()
+	cached, ok := revocationCache.crls[location]
+	revocationCache.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.crl, nil
+	}
+	resp, err := revocationClient.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("crl %s: %s", location, resp.Status)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, revocationMaxSize))
+	if err != nil {
+		return nil, err
+	}
+	crl, err := x509.ParseCRL(b)
+	if err != nil {
+		return nil, fmt.Errorf("crl %s: %v", location, err)
+	}
+	expires := crl.TBSCertList.NextUpdate
+	if expires.IsZero() {
+		expires = now.Add(revocationTTL)
+	}
+	revocationCache.Lock()
+	revocationCache.crls[location] = cachedCRL{crl: crl, expires: expires}
+	revocationCache.Unlock()
+	return crl, nil
+}
+
+// The OCSP messages of RFC 6960 jtimon sends and reads
+type ocspCertID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+type ocspRequest struct {
+	TBSRequest struct {
+		RequestList []struct {
+			Cert ocspCertID
+		}
+	}
+}
+
+type ocspResponse struct {
+	Status   asn1.Enumerated
+	Response struct {
+		ResponseType asn1.ObjectIdentifier
+		Response     []byte
+	} `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseData struct {
+	Version     int `asn1:"optional,default:0,explicit,tag:0"`
+	ResponderID asn1.RawValue
+	ProducedAt  time.Time `asn1:"generalized"`
+	Responses   []ocspSingleResponse
+	Extensions  []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspSingleResponse struct {
+	CertID  ocspCertID
+	Good    asn1.Flag `asn1:"tag:0,optional"`
+	Revoked struct {
+		RevocationTime time.Time       `asn1:"generalized"`
+		Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+	} `asn1:"tag:1,optional"`
+	Unknown    asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate time.Time        `asn1:"generalized"`
+	NextUpdate time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	Extensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+var (
+	oidSHA1              = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidOCSPBasicResponse = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+	// ocspSignatureAlgorithms are the signatures of the OCSP responses
+	ocspSignatureAlgorithms = []struct {
+		oid  asn1.ObjectIdentifier
+		algo x509.SignatureAlgorithm
+	}{
+		{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}, x509.SHA1WithRSA},
+		{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, x509.SHA256WithRSA},
+		{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}, x509.SHA384WithRSA},
+		{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}, x509.SHA512WithRSA},
+		{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}, x509.ECDSAWithSHA1},
+		{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}, x509.ECDSAWithSHA256},
+		{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}, x509.ECDSAWithSHA384},
+		{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}, x509.ECDSAWithSHA512},
+		{asn1.ObjectIdentifier{1, 3, 101, 112}, x509.PureEd25519},
+	}
+)
+
+// ocspID returns the OCSP certificate ID of leaf, with SHA-1 as most
+// responders only know it
+func ocspID(leaf, issuer *x509.Certificate) (ocspCertID, error) {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return ocspCertID{}, err
+	}
+	nameHash := sha1.Sum(issuer.RawSubject)
+	keyHash := sha1.Sum(spki.PublicKey.RightAlign())
+	return ocspCertID{
+		HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+		NameHash:      nameHash[:],
+		IssuerKeyHash: keyHash[:],
+		SerialNumber:  leaf.SerialNumber,
+	}, nil
+}
+
+// ocspRevoked asks the OCSP responder of leaf whether it is revoked, the
+// answers are kept until their next update
+func ocspRevoked(leaf, issuer *x509.Certificate, now time.Time) (bool, error) {
+	if len(leaf.OCSPServer) == 0 {
+		return false, fmt.Errorf("certificate %s has no OCSP responder", leaf.Subject)
+	}
+	id, err := ocspID(leaf, issuer)
+	if err != nil {
+		return false, err
+	}
+	key := string(id.IssuerKeyHash) + id.SerialNumber.String()
+	revocationCache.Lock()
+	cached, ok := revocationCache.ocsp[key]
+	revocationCache.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.revoked, nil
+	}
+
+	var req ocspRequest
+	req.TBSRequest.RequestList = append(req.TBSRequest.RequestList, struct{ Cert ocspCertID }{id})
+	body, err := asn1.Marshal(req)
+	if err != nil {
+		return false, err
+	}
+	url := leaf.OCSPServer[0]
+	resp, err := revocationClient.Post(url, "application/ocsp-request", bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("ocsp %s: %s", url, resp.Status)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, revocationMaxSize))
+	if err != nil {
+		return false, err
+	}
+	single, err := parseOCSPResponse(b, id, issuer, now)
+	if err != nil {
+		return false, fmt.Errorf("ocsp %s: %v", url, err)
+	}
+	revoked := !single.Revoked.RevocationTime.IsZero()
+	if bool(single.Unknown) || (!bool(single.Good) && !revoked) {
+		return false, fmt.Errorf("ocsp %s: certificate %s is unknown", url, leaf.Subject)
+	}
+	expires := single.NextUpdate
+	if expires.IsZero() {
+		expires = now.Add(revocationTTL)
+	}
+	revocationCache.Lock()
+	revocationCache.ocsp[key] = cachedOCSP{revoked: revoked, expires: expires}
+	revocationCache.Unlock()
+	return revoked, nil
+}
+
+// parseOCSPResponse returns the status of id in the OCSP response, signed by
+// the issuer or by a responder the issuer delegated to
+func parseOCSPResponse(b []byte, id ocspCertID, issuer *x509.Certificate, now time.Time) (*ocspSingleResponse, error) {
+	var resp ocspResponse
+	if _, err := asn1.Unmarshal(b, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Status != 0 {
+		return nil, fmt.Errorf("response status %d", resp.Status)
+	}
+	if !resp.Response.ResponseType.Equal(oidOCSPBasicResponse) {
+		return nil, fmt.Errorf("response type %v is not supported", resp.Response.ResponseType)
+	}
+	var basic ocspBasicResponse
+	if _, err := asn1.Unmarshal(resp.Response.Response, &basic); err != nil {
+		return nil, err
+	}
+	var data ocspResponseData
+	if _, err := asn1.Unmarshal(basic.TBSResponseData.FullBytes, &data); err != nil {
+		return nil, err
+	}
+
+	signer := issuer
+	if len(basic.Certificates) != 0 {
+		cert, err := x509.ParseCertificate(basic.Certificates[0].FullBytes)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(cert.Raw, issuer.Raw) {
+			if err := cert.CheckSignatureFrom(issuer); err != nil {
+				return nil, fmt.Errorf("responder %s is not delegated by the issuer: %v", cert.Subject, err)
+			}
+			delegated := false
+			for _, usage := range cert.ExtKeyUsage {
+				delegated = delegated || usage == x509.ExtKeyUsageOCSPSigning
+			}
+			if !delegated {
+				return nil, fmt.Errorf("responder %s is not an OCSP signer", cert.Subject)
+			}
+			signer = cert
+		}
+	}
+	algo := x509.UnknownSignatureAlgorithm
+	for _, a := range ocspSignatureAlgorithms {
+		if a.oid.Equal(basic.SignatureAlgorithm.Algorithm) {
+			algo = a.algo
+		}
+	}
+	if err := signer.CheckSignature(algo, basic.TBSResponseData.FullBytes, basic.Signature.RightAlign()); err != nil {
+		return nil, fmt.Errorf("signature: %v", err)
+	}
+
+	for i := range data.Responses {
+		single := &data.Responses[i]
+		if single.CertID.SerialNumber.Cmp(id.SerialNumber) != 0 ||
+			!bytes.Equal(single.CertID.NameHash, id.NameHash) || !bytes.Equal(single.CertID.IssuerKeyHash, id.IssuerKeyHash) {
+			continue
+		}
+		if single.ThisUpdate.After(now.Add(time.Minute)) {
+			return nil, fmt.Errorf("response is not valid before %v", single.ThisUpdate)
+		}
+		if !single.NextUpdate.IsZero() && single.NextUpdate.Before(now) {
+			return nil, fmt.Errorf("response expired on %v", single.NextUpdate)
+		}
+		return single, nil
+	}
+	return nil, fmt.Errorf("no response for serial %s", id.SerialNumber)
+}
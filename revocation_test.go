@@ -0,0 +1,230 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testLeaf returns a certificate of serial signed by the CA, with the OCSP
+// responder ocsp
+func testLeaf(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey, serial int64, ocsp string) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: fmt.Sprintf("device-%x", serial)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ocsp != "" {
+		tmpl.OCSPServer = []string{ocsp}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// testCRL writes the CRL of the CA revoking serials to file
+func testCRL(t *testing.T, file string, ca *x509.Certificate, caKey *ecdsa.PrivateKey, next time.Time, serials ...*big.Int) {
+	var revoked []pkix.RevokedCertificate
+	for _, serial := range serials {
+		revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: serial, RevocationTime: time.Now().Add(-time.Minute)})
+	}
+	der, err := ca.CreateCRL(rand.Reader, caKey, revoked, time.Now().Add(-time.Hour), next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCRL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-crl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := func(name string) string { return filepath.Join(dir, name) }
+	ca, caKey := testCert(t, dir, "ca", nil, nil)
+	other, otherKey := testCert(t, dir, "other", nil, nil)
+	good := testLeaf(t, ca, caKey, 0x1001, "")
+	revoked := testLeaf(t, ca, caKey, 0x1002, "")
+	testCRL(t, file("ca.crl"), ca, caKey, time.Now().Add(time.Hour), revoked.SerialNumber)
+	testCRL(t, file("expired.crl"), ca, caKey, time.Now().Add(-time.Minute))
+	testCRL(t, file("other.crl"), other, otherKey, time.Now().Add(time.Hour))
+
+	var fetches int32
+	crl, _ := ioutil.ReadFile(file("ca.crl"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Write(crl)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		crl      []string
+		leaf     *x509.Certificate
+		softFail bool
+		err      string
+		soft     bool
+	}{
+		{name: "good", crl: []string{file("ca.crl")}, leaf: good},
+		{name: "revoked", crl: []string{file("ca.crl")}, leaf: revoked, err: "is revoked"},
+		{name: "url good", crl: []string{server.URL + "/ca.crl"}, leaf: good},
+		{name: "url revoked", crl: []string{server.URL + "/ca.crl"}, leaf: revoked, err: "is revoked"},
+		{name: "crls of several issuers", crl: []string{file("other.crl"), file("ca.crl")}, leaf: revoked, err: "is revoked"},
+		{name: "no crl of the issuer", crl: []string{file("other.crl")}, leaf: good, err: "no crl"},
+		{name: "expired", crl: []string{file("expired.crl")}, leaf: good, err: "expired"},
+		{name: "missing", crl: []string{file("missing.crl")}, leaf: good, err: "no such file"},
+		{name: "soft fail", crl: []string{file("missing.crl")}, leaf: good, softFail: true, soft: true},
+		{name: "soft fail revoked", crl: []string{file("ca.crl")}, leaf: revoked, softFail: true, err: "is revoked"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := TLSConfig{CA: file("ca.crt"), CRL: test.crl, RevocationSoftFail: test.softFail}
+			if err := validateTLSConfig(cfg); err != nil {
+				t.Fatal(err)
+			}
+			soft := false
+			err := checkRevocation(cfg, test.leaf, ca, time.Now(), func(error) { soft = true })
+			if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("got %v, want %q", err, test.err)
+			}
+			if soft != test.soft {
+				t.Errorf("soft fail %v", soft)
+			}
+		})
+	}
+	if fetches != 1 {
+		t.Errorf("the crl of the url was fetched %d times", fetches)
+	}
+
+	for _, invalid := range []TLSConfig{
+		{SkipVerify: true, CRL: []string{file("ca.crl")}},
+		{OCSP: true},
+		{CA: file("ca.crt"), RevocationSoftFail: true},
+	} {
+		if err := validateTLSConfig(invalid); err == nil {
+			t.Errorf("%+v: no error", invalid)
+		}
+	}
+
+	// the handshakes are refused
+	jctx := &JCtx{config: Config{Host: "r1", TLS: TLSConfig{CA: file("ca.crt"), CRL: []string{file("ca.crl")}}}}
+	tlsConfig := &tls.Config{}
+	revocationTLS(jctx, tlsConfig)
+	if err := tlsConfig.VerifyPeerCertificate(nil, [][]*x509.Certificate{{revoked, ca}}); err == nil {
+		t.Errorf("revoked device accepted")
+	}
+	if err := tlsConfig.VerifyPeerCertificate(nil, [][]*x509.Certificate{{good, ca}}); err != nil {
+		t.Error(err)
+	}
+
+	// and the devices which are not revoked connect
+	testCert(t, dir, "device", ca, caKey)
+	testCert(t, dir, "client", ca, caKey)
+	addr, clients, stop := testTLSDevice(t, dir, ca)
+	defer stop()
+	cfg := TLSConfig{CA: file("ca.crt"), ClientCrt: file("client.crt"), ClientKey: file("client.key"), CRL: []string{file("ca.crl")}}
+	if got := testTLSClient(t, addr, cfg, clients); got != "client" {
+		t.Errorf("got client certificate %q", got)
+	}
+}
+
+func TestOCSP(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("no openssl")
+	}
+	dir, err := ioutil.TempDir("", "jtimon-ocsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := func(name string) string { return filepath.Join(dir, name) }
+	ca, caKey := testCert(t, dir, "ca", nil, nil)
+
+	// openssl is the responder of the CA
+	expiry := time.Now().Add(time.Hour).UTC().Format("060102150405Z")
+	index := "V\t" + expiry + "\t\t1001\tunknown\t/CN=device-1001\n" +
+		"R\t" + expiry + "\t" + time.Now().Add(-time.Hour).UTC().Format("060102150405Z") + "\t1002\tunknown\t/CN=device-1002\n"
+	ioutil.WriteFile(file("index.txt"), []byte(index), 0600)
+	var requests int32
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		req, _ := ioutil.ReadAll(r.Body)
+		reqFile, respFile := file(fmt.Sprintf("req-%d", requests)), file(fmt.Sprintf("resp-%d", requests))
+		ioutil.WriteFile(reqFile, req, 0600)
+		out, err := exec.Command("openssl", "ocsp", "-index", file("index.txt"), "-CA", file("ca.crt"),
+			"-rsigner", file("ca.crt"), "-rkey", file("ca.key"), "-reqin", reqFile, "-respout", respFile, "-ndays", "1").CombinedOutput()
+		if err != nil {
+			t.Errorf("openssl ocsp: %v %s", err, out)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		resp, _ := ioutil.ReadFile(respFile)
+		w.Write(resp)
+	}))
+	defer responder.Close()
+
+	tests := []struct {
+		name     string
+		leaf     *x509.Certificate
+		softFail bool
+		err      string
+	}{
+		{name: "good", leaf: testLeaf(t, ca, caKey, 0x1001, responder.URL)},
+		{name: "revoked", leaf: testLeaf(t, ca, caKey, 0x1002, responder.URL), err: "is revoked"},
+		{name: "unknown", leaf: testLeaf(t, ca, caKey, 0x1003, responder.URL), err: "unknown"},
+		{name: "no responder", leaf: testLeaf(t, ca, caKey, 0x1004, ""), err: "no OCSP responder"},
+		{name: "unreachable", leaf: testLeaf(t, ca, caKey, 0x1005, "http://127.0.0.1:1"), err: "refused"},
+		{name: "unreachable soft fail", leaf: testLeaf(t, ca, caKey, 0x1005, "http://127.0.0.1:1"), softFail: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := TLSConfig{CA: file("ca.crt"), OCSP: true, RevocationSoftFail: test.softFail}
+			err := checkRevocation(cfg, test.leaf, ca, time.Now(), func(error) {})
+			if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("got %v, want %q", err, test.err)
+			}
+		})
+	}
+
+	// the answers are kept until their next update
+	n := atomic.LoadInt32(&requests)
+	if err := checkRevocation(TLSConfig{OCSP: true}, tests[0].leaf, ca, time.Now(), nil); err != nil {
+		t.Error(err)
+	}
+	if atomic.LoadInt32(&requests) != n {
+		t.Errorf("the OCSP response was not cached")
+	}
+
+	// signed by another CA
+	other, _ := testCert(t, dir, "other", nil, nil)
+	leaf := testLeaf(t, ca, caKey, 0x1006, responder.URL)
+	if _, err := ocspRevoked(leaf, other, time.Now()); err == nil {
+		t.Errorf("response of the wrong issuer accepted")
+	}
+}
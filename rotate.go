@@ -0,0 +1,279 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Compressions of the rotated log files
+const (
+	LogCompressionGzip = "gzip"
+	LogCompressionNone = "none"
+)
+
+// logRotateKeep is the default number of rotated log files kept
+const logRotateKeep = 7
+
+// rotatingFile is a log file which is rotated once it reaches max bytes or
+// is older than age, if set. The rotated files get the time of the rotation
+// as suffix and are compressed in the background, the oldest ones beyond
+// keep are removed. The file can be reopened after an external rotation.
+type rotatingFile struct {
+	sync.Mutex
+	name   string
+	max    int64
+	age    time.Duration
+	keep   int
+	gzip   bool
+	f      *os.File
+	size   int64
+	opened time.Time
+	// header is written at the start of every file
+	header []byte
+	// comp serializes the compressions and the pruning
+	comp sync.Mutex
+	wg   sync.WaitGroup
+}
+
+// logFiles are the open log files, reopened on SIGUSR1
+var logFiles = struct {
+	sync.Mutex
+	m map[*rotatingFile]bool
+}{m: map[*rotatingFile]bool{}}
+
+func newRotatingFile(name string, cfg LogConfig) (*rotatingFile, error) {
+	return openRotatingFile(name, cfg, os.O_TRUNC)
+}
+
+// newAppendingFile is a rotatingFile which keeps what the file has, for
+// records which must survive restarts
+func newAppendingFile(name string, cfg LogConfig) (*rotatingFile, error) {
+	return openRotatingFile(name, cfg, os.O_APPEND)
+}
+
+func openRotatingFile(name string, cfg LogConfig, flag int) (*rotatingFile, error) {
+	r := &rotatingFile{
+		name: name,
+		max:  int64(cfg.RotateSize) << 20,
+		age:  time.Duration(cfg.RotateAge) * time.Hour,
+		keep: cfg.RotateKeep,
+		gzip: cfg.Compression != LogCompressionNone,
+	}
+	if r.keep == 0 {
+		r.keep = logRotateKeep
+	}
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|flag, 0600)
+	if err != nil {
+		return nil, err
+	}
+	r.f = f
+	r.opened = time.Now()
+	if info, err := f.Stat(); err == nil {
+		r.size = info.Size()
+	}
+
+	logFiles.Lock()
+	logFiles.m[r] = true
+	logFiles.Unlock()
+	return r, nil
+}
+
+// reopen opens the file again, appending to it if it is still there. It is
+// used after an external tool like logrotate has moved the file.
+func (r *rotatingFile) reopen() error {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.f == nil {
+		return nil
+	}
+	r.f.Close()
+	f, err := os.OpenFile(r.name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		r.f = nil
+		return err
+	}
+	r.f = f
+	r.size = 0
+	if info, err := f.Stat(); err == nil {
+		r.size = info.Size()
+	}
+	r.opened = time.Now()
+	return nil
+}
+
+// reopenLogFiles reopens all open log files
+func reopenLogFiles() {
+	logFiles.Lock()
+	defer logFiles.Unlock()
+	for r := range logFiles.m {
+		if err := r.reopen(); err != nil {
+			log.Printf("Could not reopen log file(%s): %v\n", r.name, err)
+		}
+	}
+}
+
+// rotateNow rotates the file unless it is empty, it returns whether it did
+func (r *rotatingFile) rotateNow() (bool, error) {
+	r.Lock()
+	defer r.Unlock()
+	if r.f == nil || r.size == 0 {
+		return false, nil
+	}
+	if err := r.rotate(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// rotateLogFiles rotates all open log files which are not empty, it returns
+// the names of the files rotated, sorted
+func rotateLogFiles() ([]string, error) {
+	logFiles.Lock()
+	defer logFiles.Unlock()
+	rotated := []string{}
+	var errs []string
+	for r := range logFiles.m {
+		ok, err := r.rotateNow()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", r.name, err))
+			continue
+		}
+		if ok {
+			rotated = append(rotated, r.name)
+		}
+	}
+	sort.Strings(rotated)
+	if len(errs) != 0 {
+		sort.Strings(errs)
+		return rotated, fmt.Errorf("could not rotate %s", strings.Join(errs, ", "))
+	}
+	return rotated, nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	full := r.max > 0 && r.size+int64(len(p)) > r.max
+	old := r.age > 0 && time.Since(r.opened) >= r.age
+	if r.size > 0 && (full || old) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	if r.size == 0 && len(r.header) > 0 {
+		n, err := r.f.Write(r.header)
+		r.size += int64(n)
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate moves the current file aside and opens a new one, it is called
+// with the lock held
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	rotated := r.name + "." + time.Now().Format("20060102T150405.000000000")
+	if err := os.Rename(r.name, rotated); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(r.name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		r.f = nil
+		return err
+	}
+	r.f = f
+	r.size = 0
+	r.opened = time.Now()
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.comp.Lock()
+		defer r.comp.Unlock()
+		if r.gzip {
+			if err := gzipFile(rotated); err != nil {
+				fmt.Fprintf(os.Stderr, "could not compress %s: %v\n", rotated, err)
+			}
+		}
+		r.prune()
+	}()
+	return nil
+}
+
+// prune removes the oldest rotated files beyond keep
+func (r *rotatingFile) prune() {
+	files, err := filepath.Glob(r.name + ".[0-9]*")
+	if err != nil {
+		return
+	}
+	sort.Strings(files)
+	for len(files) > r.keep {
+		os.Remove(files[0])
+		files = files[1:]
+	}
+}
+
+// Close closes the file and waits for the compressions in flight
+func (r *rotatingFile) Close() error {
+	logFiles.Lock()
+	delete(logFiles.m, r)
+	logFiles.Unlock()
+
+	r.Lock()
+	var err error
+	if r.f != nil {
+		err = r.f.Close()
+		r.f = nil
+	}
+	r.Unlock()
+	r.wg.Wait()
+	return err
+}
+
+// gzipFile compresses name into name.gz and removes name
+func gzipFile(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		os.Remove(name + ".gz")
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		os.Remove(name + ".gz")
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(name + ".gz")
+		return err
+	}
+	return os.Remove(name)
+}
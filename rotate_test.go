@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		compression string
+		suffix      string
+	}{
+		{name: "gzip", compression: "gzip", suffix: ".gz"},
+		{name: "none", compression: "none"},
+	}
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "jtimon-rotate")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		name := filepath.Join(dir, "device.log")
+		r, err := newRotatingFile(name, LogConfig{RotateSize: 1, RotateKeep: 2, Compression: test.compression})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 256 KB lines, every file holds 4 of them
+		line := append(bytes.Repeat([]byte("x"), 256<<10-1), '\n')
+		for i := 0; i < 13; i++ {
+			if _, err := r.Write(line); err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+		}
+		if err := r.Close(); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		files, _ := filepath.Glob(name + ".*")
+		if len(files) != 2 {
+			t.Fatalf("%s: got rotated files %v, want 2", test.name, files)
+		}
+		for _, file := range files {
+			if strings.HasSuffix(file, ".gz") != (test.suffix == ".gz") {
+				t.Errorf("%s: unexpected rotated file %s", test.name, file)
+			}
+			b, err := readRotated(file)
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			if len(b) != 4*len(line) {
+				t.Errorf("%s: %s has %d bytes, want %d", test.name, file, len(b), 4*len(line))
+			}
+		}
+		if info, err := os.Stat(name); err != nil || info.Size() != int64(len(line)) {
+			t.Errorf("%s: current file %v %v", test.name, info, err)
+		}
+	}
+}
+
+func readRotated(file string) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if !strings.HasSuffix(file, ".gz") {
+		return ioutil.ReadAll(f)
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(zr)
+}
+
+func TestRotatingFileAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "device.log")
+	r, err := newRotatingFile(name, LogConfig{RotateAge: 24, Compression: "none"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("day 1\n"))
+	r.Write([]byte("day 1\n"))
+	// a day later
+	r.opened = r.opened.Add(-24 * time.Hour)
+	r.Write([]byte("day 2\n"))
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(name + ".*")
+	if len(files) != 1 {
+		t.Fatalf("got rotated files %v, want 1", files)
+	}
+	if b, _ := ioutil.ReadFile(files[0]); string(b) != "day 1\nday 1\n" {
+		t.Errorf("got rotated %q", b)
+	}
+	if b, _ := ioutil.ReadFile(name); string(b) != "day 2\n" {
+		t.Errorf("got current %q", b)
+	}
+}
+
+func TestRotatingFileReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "device.log")
+	r, err := newRotatingFile(name, LogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	r.Write([]byte("before\n"))
+	// logrotate moves the file and sends SIGUSR1
+	if err := os.Rename(name, name+".1"); err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("moved\n"))
+	reopenLogFiles()
+	r.Write([]byte("after\n"))
+
+	if b, _ := ioutil.ReadFile(name + ".1"); string(b) != "before\nmoved\n" {
+		t.Errorf("got moved file %q", b)
+	}
+	if b, _ := ioutil.ReadFile(name); string(b) != "after\n" {
+		t.Errorf("got reopened file %q", b)
+	}
+
+	// copytruncate leaves the file in place, it is appended to
+	reopenLogFiles()
+	r.Write([]byte("again\n"))
+	if b, _ := ioutil.ReadFile(name); string(b) != "after\nagain\n" {
+		t.Errorf("got reopened file %q", b)
+	}
+}
+
+func TestRotatingFileHeader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "stats.csv")
+	r, err := newRotatingFile(name, LogConfig{Compression: LogCompressionNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.header = []byte("a,b\n")
+	r.max = 12
+	r.Write([]byte("1,2\n"))
+	r.Write([]byte("3,4\n"))
+	r.Write([]byte("5,6\n"))
+	r.Close()
+
+	files, _ := filepath.Glob(name + "*")
+	if len(files) != 2 {
+		t.Fatalf("got files %v", files)
+	}
+	for _, f := range files {
+		b, _ := ioutil.ReadFile(f)
+		if !strings.HasPrefix(string(b), "a,b\n") {
+			t.Errorf("%s: got %q without header", f, b)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RouteConfig sends the points of the paths matching path (regex, matched
+// like the filter paths) at full resolution to the outputs of raw and,
+// aggregated over an interval, to those of aggregate, e.g. the raw stream to
+// the data lake and 1 minute averages to InfluxDB for the dashboards. The
+// outputs are "influx" and the names of the sinks, e.g. "kinesis", an output
+// in neither list gets none of the points of the route. The first matching
+// route applies, the points of no route go to all outputs.
+type RouteConfig struct {
+	Path      string          `json:"path"`
+	Raw       []string        `json:"raw"`
+	Aggregate AggregateConfig `json:"aggregate"`
+}
+
+// AggregateConfig aggregates the numeric fields of each series over
+// intervals of interval seconds with function: avg (default), min, max, sum
+// or last; the other fields keep their last value. The points of an
+// interval are written when the first point of the next one comes, or when
+// the series got no point for an interval, with the start of the interval
+// as timestamp.
+type AggregateConfig struct {
+	To       []string `json:"to"`
+	Interval int      `json:"interval"`
+	Function string   `json:"function"`
+}
+
+const (
+	routeInflux       = "influx"
+	defaultAggregate  = "avg"
+	routeFlushDivisor = 4
+)
+
+func validateRoutes(routes []RouteConfig, vendor string) error {
+	if len(routes) != 0 && vendor != "" && vendor != "juniper-junos" {
+		return fmt.Errorf("routes are not supported for vendor %s", vendor)
+	}
+	for i, r := range routes {
+		if _, err := regexp.Compile(r.Path); err != nil {
+			return fmt.Errorf("route %d: invalid path %q: %v", i, r.Path, err)
+		}
+		if len(r.Raw) == 0 && len(r.Aggregate.To) == 0 {
+			return fmt.Errorf("route %d: raw or aggregate to is missing", i)
+		}
+		for _, out := range append(append([]string{}, r.Raw...), r.Aggregate.To...) {
+			if !routeOutput(out) {
+				return fmt.Errorf("route %d: unknown output %q", i, out)
+			}
+		}
+		if len(r.Aggregate.To) == 0 {
+			continue
+		}
+		if r.Aggregate.Interval <= 0 {
+			return fmt.Errorf("route %d: aggregate interval must be positive", i)
+		}
+		switch r.Aggregate.Function {
+		case "", "avg", "min", "max", "sum", "last":
+		default:
+			return fmt.Errorf("route %d: unknown aggregate function %q", i, r.Aggregate.Function)
+		}
+	}
+	return nil
+}
+
+// routeOutput tells whether out is influx or the name of a sink
+func routeOutput(out string) bool {
+	if out == routeInflux {
+		return true
+	}
+	for _, s := range sinks {
+		if s.name == out {
+			return true
+		}
+	}
+	return false
+}
+
+type route struct {
+	re  *regexp.Regexp
+	raw map[string]bool
+	agg *aggregator
+}
+
+// routes are the routes of a worker
+type routes struct {
+	routes []route
+	task   *schedTask
+}
+
+func outputSet(outputs []string) map[string]bool {
+	m := map[string]bool{}
+	for _, out := range outputs {
+		m[out] = true
+	}
+	return m
+}
+
+func routesInit(jctx *JCtx) {
+	if len(jctx.config.Routes) == 0 {
+		return
+	}
+	rs := &routes{}
+	var tick time.Duration
+	for _, r := range jctx.config.Routes {
+		rt := route{re: regexp.MustCompile(r.Path), raw: outputSet(r.Raw)}
+		if len(r.Aggregate.To) != 0 {
+			rt.agg = newAggregator(r.Aggregate)
+			if tick == 0 || rt.agg.interval < tick {
+				tick = rt.agg.interval
+			}
+		}
+		rs.routes = append(rs.routes, rt)
+	}
+	jctx.routes = rs
+	if tick != 0 {
+		rs.task = schedule(tick/routeFlushDivisor, func() {
+			rs.flush(jctx, time.Now(), false)
+		})
+	}
+	jLog(jctx, fmt.Sprintf("Successfully initialized %d routes", len(rs.routes)))
+}
+
+func routesStop(jctx *JCtx) {
+	if jctx.routes != nil && jctx.routes.task != nil {
+		jctx.routes.task.stop()
+	}
+}
+
+// routesFlush writes the aggregates of the intervals in progress, when the
+// worker is drained
+func routesFlush(jctx *JCtx) {
+	if jctx.routes != nil {
+		jctx.routes.flush(jctx, time.Now(), true)
+	}
+}
+
+// route writes the points of the routes to their outputs and returns the
+// others
+func (rs *routes) route(jctx *JCtx, measurement string, points []*point) []*point {
+	var rest []*point
+	raw := make([][]*point, len(rs.routes))
+	var aggregated [][]*point
+	for _, p := range points {
+		path := pointPath(p)
+		matched := false
+		for i := range rs.routes {
+			r := &rs.routes[i]
+			if !r.re.MatchString(path) {
+				continue
+			}
+			matched = true
+			if len(r.raw) != 0 {
+				raw[i] = append(raw[i], p)
+			}
+			if r.agg != nil {
+				if done := r.agg.add(p, time.Now()); done != nil {
+					if aggregated == nil {
+						aggregated = make([][]*point, len(rs.routes))
+					}
+					aggregated[i] = append(aggregated[i], done)
+				}
+			}
+			break
+		}
+		if !matched {
+			rest = append(rest, p)
+		}
+	}
+	for i := range rs.routes {
+		exportTo(jctx, measurement, raw[i], rs.routes[i].raw)
+		if aggregated != nil && rs.routes[i].agg != nil {
+			exportTo(jctx, measurement, aggregated[i], rs.routes[i].agg.to)
+		}
+	}
+	return rest
+}
+
+// flush writes the aggregates of the series without a point for an
+// interval, of all of them with all
+func (rs *routes) flush(jctx *JCtx, now time.Time, all bool) {
+	for _, r := range rs.routes {
+		if r.agg == nil {
+			continue
+		}
+		points := r.agg.flush(now, all)
+		// with write-per-measurement InfluxDB takes the points of a
+		// measurement at a time
+		sort.SliceStable(points, func(i, j int) bool { return points[i].Measurement < points[j].Measurement })
+		for len(points) != 0 {
+			n := 1
+			for n < len(points) && points[n].Measurement == points[0].Measurement {
+				n++
+			}
+			exportTo(jctx, points[0].Measurement, points[:n], r.agg.to)
+			points = points[n:]
+		}
+	}
+}
+
+// exportTo writes the points to the sinks of to and to InfluxDB if it is in
+func exportTo(jctx *JCtx, measurement string, points []*point, to map[string]bool) {
+	if len(points) == 0 {
+		return
+	}
+	for _, s := range jctx.sinks {
+		if to[s.name] {
+			writeSink(jctx, s, points)
+		}
+	}
+	if to[routeInflux] {
+		writeInflux(jctx, measurement, points)
+	}
+}
+
+// aggregator aggregates the points of the series of a route
+type aggregator struct {
+	sync.Mutex
+	interval time.Duration
+	function string
+	to       map[string]bool
+	series   map[string]*aggSeries
+}
+
+// aggSeries is the interval in progress of a series
+type aggSeries struct {
+	start       time.Time
+	seen        time.Time
+	measurement string
+	tags        map[string]string
+	count       map[string]int
+	values      map[string]float64
+	integer     map[string]bool
+	other       map[string]interface{}
+}
+
+func newAggregator(cfg AggregateConfig) *aggregator {
+	a := &aggregator{
+		interval: time.Duration(cfg.Interval) * time.Second,
+		function: cfg.Function,
+		to:       outputSet(cfg.To),
+		series:   map[string]*aggSeries{},
+	}
+	if a.function == "" {
+		a.function = defaultAggregate
+	}
+	return a
+}
+
+// add adds the point received at now to its series, it returns the
+// aggregate of the previous interval of the series if the point starts a new
+// one
+func (a *aggregator) add(p *point, now time.Time) *point {
+	a.Lock()
+	defer a.Unlock()
+	key := seriesKey(p, "")
+	start := p.Timestamp.Truncate(a.interval)
+	var done *point
+	s := a.series[key]
+	if s != nil && start.After(s.start) {
+		done = a.point(s)
+		s = nil
+	}
+	if s == nil {
+		s = &aggSeries{
+			start:       start,
+			measurement: p.Measurement,
+			tags:        p.Tags,
+			count:       map[string]int{},
+			values:      map[string]float64{},
+			integer:     map[string]bool{},
+			other:       map[string]interface{}{},
+		}
+		a.series[key] = s
+	}
+	s.seen = now
+	for k, v := range p.Fields {
+		f, integer, ok := numericValue(v)
+		if !ok {
+			s.other[k] = v
+			continue
+		}
+		n := s.count[k]
+		s.count[k] = n + 1
+		if n == 0 {
+			s.values[k], s.integer[k] = f, integer
+			continue
+		}
+		s.integer[k] = s.integer[k] && integer
+		switch a.function {
+		case "avg", "sum":
+			s.values[k] += f
+		case "min":
+			s.values[k] = math.Min(s.values[k], f)
+		case "max":
+			s.values[k] = math.Max(s.values[k], f)
+		case "last":
+			s.values[k] = f
+		}
+	}
+	return done
+}
+
+// flush returns the aggregates of the series which got no point for an
+// interval until now, of all of them with all, and forgets them
+func (a *aggregator) flush(now time.Time, all bool) []*point {
+	a.Lock()
+	defer a.Unlock()
+	var points []*point
+	for key, s := range a.series {
+		if all || now.Sub(s.seen) >= a.interval {
+			points = append(points, a.point(s))
+			delete(a.series, key)
+		}
+	}
+	return points
+}
+
+// point is the aggregate of the interval of the series
+func (a *aggregator) point(s *aggSeries) *point {
+	fields := make(map[string]interface{}, len(s.values)+len(s.other))
+	for k, v := range s.other {
+		fields[k] = v
+	}
+	for k, v := range s.values {
+		switch {
+		case a.function == "avg":
+			fields[k] = v / float64(s.count[k])
+		case s.integer[k]:
+			fields[k] = int64(v)
+		default:
+			fields[k] = v
+		}
+	}
+	return newPoint(s.measurement, s.tags, fields, s.start)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestValidateRoutes(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes []RouteConfig
+		vendor string
+		err    bool
+	}{
+		{name: "none", vendor: "cisco-iosxr"},
+		{name: "raw and aggregate", routes: []RouteConfig{{Path: "^/interfaces/", Raw: []string{"kinesis"},
+			Aggregate: AggregateConfig{To: []string{"influx"}, Interval: 60, Function: "max"}}}},
+		{name: "raw only", routes: []RouteConfig{{Path: "^/interfaces/", Raw: []string{"influx"}}}},
+		{name: "vendor", routes: []RouteConfig{{Raw: []string{"influx"}}}, vendor: "cisco-iosxr", err: true},
+		{name: "invalid path", routes: []RouteConfig{{Path: "(", Raw: []string{"influx"}}}, err: true},
+		{name: "no output", routes: []RouteConfig{{Path: "^/interfaces/"}}, err: true},
+		{name: "unknown output", routes: []RouteConfig{{Raw: []string{"kafka"}}}, err: true},
+		{name: "no interval", routes: []RouteConfig{{Aggregate: AggregateConfig{To: []string{"influx"}}}}, err: true},
+		{name: "unknown function", routes: []RouteConfig{{Aggregate: AggregateConfig{To: []string{"influx"}, Interval: 60,
+			Function: "median"}}}, err: true},
+	}
+	for _, test := range tests {
+		if err := validateRoutes(test.routes, test.vendor); (err != nil) != test.err {
+			t.Errorf("%s: got error %v", test.name, err)
+		}
+	}
+}
+
+func TestAggregator(t *testing.T) {
+	start := time.Unix(600, 0)
+	point := func(offset time.Duration, in, oper interface{}) *point {
+		return newPoint("ifd", map[string]string{"device": "r1", "if": "et-0/0/0"},
+			map[string]interface{}{"in-octets": in, "oper-status": oper}, start.Add(offset))
+	}
+	tests := []struct {
+		function string
+		want     interface{}
+	}{
+		{function: "avg", want: float64(20)},
+		{function: "min", want: int64(10)},
+		{function: "max", want: int64(30)},
+		{function: "sum", want: int64(60)},
+		{function: "last", want: int64(30)},
+	}
+	for _, test := range tests {
+		a := newAggregator(AggregateConfig{Interval: 60, Function: test.function})
+		for i, v := range []uint64{10, 20, 30} {
+			if done := a.add(point(time.Duration(i)*10*time.Second, v, "DOWN"), start); done != nil {
+				t.Errorf("%s: got %v within the interval", test.function, done)
+			}
+		}
+		done := a.add(point(time.Minute, uint64(40), "UP"), start)
+		want := point(0, test.want, "DOWN")
+		if done == nil || !reflect.DeepEqual(done, want) {
+			t.Errorf("%s: got %+v, want %+v", test.function, done, want)
+		}
+	}
+
+	a := newAggregator(AggregateConfig{Interval: 60})
+	a.add(point(0, 1.5, "UP"), start)
+	if points := a.flush(start.Add(30*time.Second), false); len(points) != 0 {
+		t.Errorf("flush within the interval: got %v", points)
+	}
+	if points := a.flush(start.Add(time.Minute), false); len(points) != 1 || points[0].Fields["in-octets"] != 1.5 {
+		t.Errorf("flush after the interval: got %v", points)
+	}
+	a.add(point(0, 1.5, "UP"), start)
+	if points := a.flush(start, true); len(points) != 1 {
+		t.Errorf("flush all: got %v", points)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	jctx := &JCtx{config: Config{Routes: []RouteConfig{{
+		Path:      "^/interfaces/",
+		Raw:       []string{"kinesis"},
+		Aggregate: AggregateConfig{To: []string{"splunk"}, Interval: 60},
+	}}}}
+	dropsInit(jctx)
+	defer dropsStop(jctx)
+	kinesis := &sinkCtx{name: "kinesis", ch: make(chan *point, 10)}
+	splunk := &sinkCtx{name: "splunk", ch: make(chan *point, 10)}
+	jctx.sinks = []*sinkCtx{kinesis, splunk}
+	routesInit(jctx)
+	defer routesStop(jctx)
+
+	start := time.Unix(600, 0)
+	ifd := func(offset time.Duration, v float64) *point {
+		return newPoint("ifd", map[string]string{"sensor": "/interfaces/", "device": "r1"},
+			map[string]interface{}{"in-octets": v}, start.Add(offset))
+	}
+	bgp := newPoint("bgp", map[string]string{"sensor": "/bgp/", "device": "r1"}, map[string]interface{}{"state": "up"}, start)
+	exportIDB(jctx, "ifd", []*point{ifd(0, 10), ifd(30*time.Second, 20)})
+	exportIDB(jctx, "bgp", []*point{bgp})
+	exportIDB(jctx, "ifd", []*point{ifd(time.Minute, 30)})
+
+	received := func(s *sinkCtx) []*point {
+		var points []*point
+		for len(s.ch) != 0 {
+			points = append(points, <-s.ch)
+		}
+		return points
+	}
+	if got := received(kinesis); len(got) != 4 || got[2] != bgp {
+		t.Errorf("kinesis: got %v, want the raw points and bgp", got)
+	}
+	got := received(splunk)
+	if len(got) != 2 || got[0] != bgp || !reflect.DeepEqual(got[1], ifd(0, 15)) {
+		t.Errorf("splunk: got %v, want bgp and the average of the first minute", got)
+	}
+
+	routesFlush(jctx)
+	if got := received(splunk); len(got) != 1 || !reflect.DeepEqual(got[0], ifd(time.Minute, 30)) {
+		t.Errorf("splunk after the flush: got %v", got)
+	}
+}
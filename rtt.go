@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RTTConfig measures the round trip time between jtimon and the device
+// every interval seconds, over the connection of the worker, to tell the
+// network delay from the export delay of the device. The probe is a unary
+// call the gRPC server of the device answers at once, whether it serves it
+// or not. Each RTT is written as a point of measurement (default jtimon-rtt)
+// with the field rtt-ms and, on Linux, tcp-rtt-ms, the smoothed RTT of the
+// kernel. With buckets (upper bounds in milliseconds, ascending) the points
+// of the device are tagged rtt with the bucket of the last RTT, e.g. 10-50ms.
+type RTTConfig struct {
+	Interval    int       `json:"interval"`
+	Measurement string    `json:"measurement"`
+	Buckets     []float64 `json:"buckets"`
+}
+
+const (
+	defaultRTTMeasurement = "jtimon-rtt"
+	// rttMethod is the method of the probe, the standard health check
+	rttMethod     = "/grpc.health.v1.Health/Check"
+	rttMaxTimeout = 10 * time.Second
+)
+
+func validateRTTConfig(cfg RTTConfig) error {
+	if cfg.Interval < 0 {
+		return fmt.Errorf("rtt interval can not be negative")
+	}
+	if len(cfg.Buckets) != 0 && cfg.Interval == 0 {
+		return fmt.Errorf("rtt buckets without interval")
+	}
+	for i, b := range cfg.Buckets {
+		if b <= 0 || i > 0 && b <= cfg.Buckets[i-1] {
+			return fmt.Errorf("rtt buckets must be positive and ascending")
+		}
+	}
+	return nil
+}
+
+// rttProbe is the RTT measurement of a worker
+type rttProbe struct {
+	// last is the last RTT in nanoseconds, 0 until measured and while the
+	// device is not connected
+	last   int64
+	bucket atomic.Value
+	// running is 1 while a probe is in flight, the probes do not block the
+	// scheduler
+	running     int32
+	task        *schedTask
+	measurement string
+	collector   string
+	timeout     time.Duration
+	// failed is the last error logged
+	failed string
+}
+
+// get returns the last RTT, p may be nil
+func (p *rttProbe) get() (time.Duration, bool) {
+	if p == nil {
+		return 0, false
+	}
+	rtt := atomic.LoadInt64(&p.last)
+	return time.Duration(rtt), rtt != 0
+}
+
+func (p *rttProbe) set(rtt time.Duration, bucket string) {
+	atomic.StoreInt64(&p.last, int64(rtt))
+	p.bucket.Store(bucket)
+}
+
+// rttBucket names the bucket of rtt, e.g. 0-10ms, 10-50ms or 50ms+
+func rttBucket(buckets []float64, rtt time.Duration) string {
+	if len(buckets) == 0 {
+		return ""
+	}
+	ms := float64(rtt) / float64(time.Millisecond)
+	lower := "0"
+	for _, b := range buckets {
+		upper := strconv.FormatFloat(b, 'f', -1, 64)
+		if ms < b {
+			return lower + "-" + upper + "ms"
+		}
+		lower = upper
+	}
+	return lower + "ms+"
+}
+
+// rttTag tags the points with the bucket of the last RTT of the device
+func rttTag(jctx *JCtx, tags map[string]string) {
+	if jctx.rtt == nil {
+		return
+	}
+	if b, _ := jctx.rtt.bucket.Load().(string); b != "" {
+		tags["rtt"] = b
+	}
+}
+
+// rttCodec sends an empty message and ignores the reply
+type rttCodec struct{}
+
+func (rttCodec) Marshal(v interface{}) ([]byte, error) {
+	return nil, nil
+}
+
+func (rttCodec) Unmarshal(data []byte, v interface{}) error {
+	return nil
+}
+
+func (rttCodec) String() string {
+	return "proto"
+}
+
+// measureRTT times the probe on conn. Any status of the device is an
+// answer, only the failures of the connection are errors.
+func measureRTT(conn *grpc.ClientConn, timeout time.Duration) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	err := conn.Invoke(ctx, rttMethod, nil, nil, grpc.CallCustomCodec(rttCodec{}), grpc.FailFast(true))
+	rtt := time.Since(start)
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled:
+		return 0, err
+	}
+	return rtt, nil
+}
+
+func rttInit(jctx *JCtx) {
+	cfg := jctx.config.RTT
+	if cfg.Interval == 0 {
+		return
+	}
+	interval := time.Duration(cfg.Interval) * time.Second
+	p := &rttProbe{measurement: cfg.Measurement, timeout: interval}
+	if p.measurement == "" {
+		p.measurement = defaultRTTMeasurement
+	}
+	if p.timeout > rttMaxTimeout {
+		p.timeout = rttMaxTimeout
+	}
+	p.collector, _ = os.Hostname()
+	jctx.rtt = p
+	p.task = schedule(interval, func() {
+		conn := jctx.conn.get()
+		if conn == nil {
+			p.set(0, "")
+			return
+		}
+		if !atomic.CompareAndSwapInt32(&p.running, 0, 1) {
+			return
+		}
+		go func() {
+			defer atomic.StoreInt32(&p.running, 0)
+			p.probe(jctx, conn)
+		}()
+	})
+}
+
+// probe measures the RTT of the device over conn and writes it
+func (p *rttProbe) probe(jctx *JCtx, conn *grpc.ClientConn) {
+	rtt, err := measureRTT(conn, p.timeout)
+	if err != nil {
+		if err.Error() != p.failed {
+			jLogWarn(jctx, fmt.Sprintf("Could not measure the RTT of %s: %v", jctx.config.Host, err))
+			p.failed = err.Error()
+		}
+		p.set(0, "")
+		return
+	}
+	p.failed = ""
+	p.set(rtt, rttBucket(jctx.config.RTT.Buckets, rtt))
+
+	fields := map[string]interface{}{"rtt-ms": float64(rtt) / float64(time.Millisecond)}
+	if info, ok := jctx.transport.tcpInfo(); ok {
+		fields["tcp-rtt-ms"] = float64(info.rtt) / float64(time.Millisecond)
+	}
+	tags := map[string]string{"device": jctx.config.Host, "collector": p.collector}
+	addressTag(jctx, tags)
+	exportIDB(jctx, p.measurement, []*point{newPoint(p.measurement, tags, fields, time.Now())})
+}
+
+func rttStop(jctx *JCtx) {
+	if jctx.rtt != nil {
+		jctx.rtt.task.stop()
+	}
+}
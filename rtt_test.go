@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nileshsimaria/jtimon/simulator"
+	"google.golang.org/grpc"
+)
+
+func TestValidateRTTConfig(t *testing.T) {
+	tests := []struct {
+		cfg RTTConfig
+		err bool
+	}{
+		{cfg: RTTConfig{}},
+		{cfg: RTTConfig{Interval: 10, Buckets: []float64{10, 50}}},
+		{cfg: RTTConfig{Interval: -1}, err: true},
+		{cfg: RTTConfig{Buckets: []float64{10}}, err: true},
+		{cfg: RTTConfig{Interval: 10, Buckets: []float64{50, 10}}, err: true},
+		{cfg: RTTConfig{Interval: 10, Buckets: []float64{0}}, err: true},
+	}
+	for _, test := range tests {
+		if err := validateRTTConfig(test.cfg); (err != nil) != test.err {
+			t.Errorf("%+v: got error %v", test.cfg, err)
+		}
+	}
+}
+
+func TestRTTBucket(t *testing.T) {
+	buckets := []float64{10, 50.5}
+	tests := []struct {
+		rtt  time.Duration
+		want string
+	}{
+		{rtt: time.Millisecond, want: "0-10ms"},
+		{rtt: 10 * time.Millisecond, want: "10-50.5ms"},
+		{rtt: time.Second, want: "50.5ms+"},
+	}
+	for _, test := range tests {
+		if got := rttBucket(buckets, test.rtt); got != test.want {
+			t.Errorf("%v: got %q, want %q", test.rtt, got, test.want)
+		}
+	}
+	if got := rttBucket(nil, time.Second); got != "" {
+		t.Errorf("no buckets: got %q", got)
+	}
+}
+
+func TestRTTProbe(t *testing.T) {
+	s, err := simulator.Start("127.0.0.1:0", simulator.Script{Sensors: []simulator.Sensor{{Path: "/interfaces/"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := grpc.Dial(s.Addr(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the device does not serve the health check, its answer is timed
+	if rtt, err := measureRTT(conn, 5*time.Second); err != nil || rtt <= 0 {
+		t.Errorf("got %v, %v", rtt, err)
+	}
+
+	jctx := &JCtx{config: Config{Host: "r1", RTT: RTTConfig{Interval: 3600, Buckets: []float64{1000}}}}
+	dropsInit(jctx)
+	defer dropsStop(jctx)
+	sctx := &sinkCtx{name: "kinesis", ch: make(chan *point, 1)}
+	jctx.sinks = []*sinkCtx{sctx}
+	rttInit(jctx)
+	defer rttStop(jctx)
+	if _, ok := jctx.rtt.get(); ok {
+		t.Errorf("RTT before the first probe")
+	}
+	jctx.rtt.probe(jctx, conn)
+	if _, ok := jctx.rtt.get(); !ok {
+		t.Errorf("no RTT after the probe")
+	}
+	p := <-sctx.ch
+	if p.Measurement != defaultRTTMeasurement || p.Tags["device"] != "r1" || p.Fields["rtt-ms"] == nil {
+		t.Errorf("got point %+v", p)
+	}
+	tags := map[string]string{}
+	rttTag(jctx, tags)
+	if tags["rtt"] != "0-1000ms" {
+		t.Errorf("got tags %v", tags)
+	}
+
+	s.Stop()
+	conn.Close()
+	jctx.rtt.probe(jctx, conn)
+	if _, ok := jctx.rtt.get(); ok {
+		t.Errorf("RTT of a closed connection")
+	}
+	tags = map[string]string{}
+	if rttTag(jctx, tags); len(tags) != 0 {
+		t.Errorf("tags of a closed connection: %v", tags)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"text/template"
+	"time"
+)
+
+// UpdateRule selects decoded updates which are turned into events (SNMP traps,
+// syslog messages). measurement, field and value are regexes, empty matches
+// everything. With on-change only transitions of the value are selected, the
+// first value seen for a field is just remembered.
+type UpdateRule struct {
+	Measurement string `json:"measurement"`
+	Field       string `json:"field"`
+	Value       string `json:"value"`
+	OnChange    bool   `json:"on-change"`
+}
+
+// updateEvent is one selected update, it is the data of event templates
+// e.g. {{.Tags.device}} {{.Field}} changed to {{.Value}}
+type updateEvent struct {
+	*point
+	Field string
+	Value interface{}
+	// Previous is the value before the change with on-change
+	Previous interface{}
+}
+
+type updateRule struct {
+	measurement *regexp.Regexp
+	field       *regexp.Regexp
+	value       *regexp.Regexp
+	onChange    bool
+	last        map[string]interface{}
+}
+
+func compileRuleRegex(what, expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rule %s %q: %v", what, expr, err)
+	}
+	return re, nil
+}
+
+func newUpdateRule(r UpdateRule) (*updateRule, error) {
+	var err error
+	u := &updateRule{onChange: r.OnChange}
+	if u.measurement, err = compileRuleRegex("measurement", r.Measurement); err != nil {
+		return nil, err
+	}
+	if u.field, err = compileRuleRegex("field", r.Field); err != nil {
+		return nil, err
+	}
+	if u.value, err = compileRuleRegex("value", r.Value); err != nil {
+		return nil, err
+	}
+	if u.onChange {
+		u.last = map[string]interface{}{}
+	}
+	return u, nil
+}
+
+// seriesExpiry is how long the rate and delta transforms keep the previous
+// sample of a series without a new one, the series of removed interfaces
+// and of keys which change are forgotten after it
+const seriesExpiry = 15 * time.Minute
+
+// seriesKey identifies a field of a point across updates
+func seriesKey(p *point, field string) string {
+	ks := keyScratchPool.Get().(*keyScratch)
+	defer keyScratchPool.Put(ks)
+
+	ks.keys = ks.keys[:0]
+	for k := range p.Tags {
+		ks.keys = append(ks.keys, k)
+	}
+	sort.Strings(ks.keys)
+
+	ks.buf.Reset()
+	ks.buf.WriteString(p.Measurement)
+	for _, k := range ks.keys {
+		ks.buf.WriteByte(',')
+		ks.buf.WriteString(k)
+		ks.buf.WriteByte('=')
+		ks.buf.WriteString(p.Tags[k])
+	}
+	ks.buf.WriteByte(' ')
+	ks.buf.WriteString(field)
+	return ks.buf.String()
+}
+
+// match returns the events of the point selected by the rule
+func (u *updateRule) match(p *point) []*updateEvent {
+	if u.measurement != nil && !u.measurement.MatchString(p.Measurement) {
+		return nil
+	}
+
+	fields := make([]string, 0, len(p.Fields))
+	for k := range p.Fields {
+		if u.field == nil || u.field.MatchString(k) {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+
+	var events []*updateEvent
+	for _, k := range fields {
+		v := p.Fields[k]
+		e := &updateEvent{point: p, Field: k, Value: v}
+		if u.onChange {
+			key := seriesKey(p, k)
+			prev, seen := u.last[key]
+			u.last[key] = v
+			if !seen || prev == v {
+				continue
+			}
+			e.Previous = prev
+		}
+		if u.value != nil && !u.value.MatchString(fmt.Sprint(v)) {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+// execEventTemplate is execKeyTemplate for templates parsed with
+// newKeyTemplate which refer to the event
+func execEventTemplate(t *template.Template, e *updateEvent) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, e); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
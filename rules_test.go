@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpdateRule(t *testing.T) {
+	up := func(status string) *point {
+		return newPoint("ifd", map[string]string{"device": "r1", "interface-name": "et-0/0/0"},
+			map[string]interface{}{"/oper-status": status, "/in-octets": uint64(1)}, time.Unix(1, 0))
+	}
+
+	tests := []struct {
+		name   string
+		rule   UpdateRule
+		input  []string
+		events []int
+	}{
+		{
+			name:   "field-and-value",
+			rule:   UpdateRule{Measurement: "^ifd$", Field: "oper-status", Value: "DOWN"},
+			input:  []string{"UP", "DOWN", "DOWN"},
+			events: []int{0, 1, 1},
+		},
+		{
+			name:   "on-change",
+			rule:   UpdateRule{Field: "oper-status", OnChange: true},
+			input:  []string{"UP", "UP", "DOWN", "DOWN", "UP"},
+			events: []int{0, 0, 1, 0, 1},
+		},
+		{
+			name:   "on-change-to-down",
+			rule:   UpdateRule{Field: "oper-status", Value: "^DOWN$", OnChange: true},
+			input:  []string{"DOWN", "UP", "DOWN", "UP"},
+			events: []int{0, 0, 1, 0},
+		},
+		{
+			name:   "other-measurement",
+			rule:   UpdateRule{Measurement: "^cpu$"},
+			input:  []string{"UP"},
+			events: []int{0},
+		},
+		{
+			name:   "all-fields",
+			rule:   UpdateRule{},
+			input:  []string{"UP"},
+			events: []int{2},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u, err := newUpdateRule(test.rule)
+			if err != nil {
+				t.Fatalf("newUpdateRule failed: %v", err)
+			}
+			for i, status := range test.input {
+				events := u.match(up(status))
+				if len(events) != test.events[i] {
+					t.Fatalf("update %d (%s): want %d events, got %d", i, status, test.events[i], len(events))
+				}
+				if test.rule.OnChange && len(events) == 1 && events[0].Previous == events[0].Value {
+					t.Errorf("update %d: previous must differ from value", i)
+				}
+			}
+		})
+	}
+
+	if _, err := newUpdateRule(UpdateRule{Field: "("}); err == nil {
+		t.Errorf("want error for invalid regex, got nil")
+	}
+}
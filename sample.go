@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// SampleRule thins out the updates of the paths matching path (regex,
+// matched like the filter paths) per series. With every only one in every
+// updates is kept, with interval (milliseconds) at most one update per
+// interval by the update timestamp. The first matching rule applies.
+type SampleRule struct {
+	Path     string `json:"path"`
+	Every    int    `json:"every"`
+	Interval int    `json:"interval"`
+}
+
+type sampleState struct {
+	count int
+	last  time.Time
+}
+
+type sampleRule struct {
+	re       *regexp.Regexp
+	every    int
+	interval time.Duration
+}
+
+type sample struct {
+	sync.Mutex
+	rules []sampleRule
+	state map[string]*sampleState
+}
+
+func newSampleTransformer() *transformer {
+	return &transformer{
+		name: "sample",
+		new:  newSample,
+	}
+}
+
+func newSample(jctx *JCtx) (transform, error) {
+	rules := jctx.config.Transform.Sample
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	s := &sample{state: map[string]*sampleState{}}
+	for i, rule := range rules {
+		re, err := regexp.Compile(rule.Path)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: invalid path %q: %v", i, rule.Path, err)
+		}
+		if rule.Every < 0 || rule.Interval < 0 || (rule.Every == 0 && rule.Interval == 0) {
+			return nil, fmt.Errorf("rule %d: every or interval must be positive", i)
+		}
+		s.rules = append(s.rules, sampleRule{
+			re:       re,
+			every:    rule.Every,
+			interval: time.Duration(rule.Interval) * time.Millisecond,
+		})
+	}
+	return s, nil
+}
+
+// keep tells whether the update of the series is kept
+func (s *sample) keep(rule *sampleRule, key string, ts time.Time) bool {
+	st := s.state[key]
+	if st == nil {
+		st = &sampleState{}
+		s.state[key] = st
+	}
+	if rule.every > 0 {
+		n := st.count
+		st.count++
+		if n%rule.every != 0 {
+			return false
+		}
+	}
+	if rule.interval > 0 {
+		if !st.last.IsZero() && ts.Sub(st.last) < rule.interval {
+			return false
+		}
+		st.last = ts
+	}
+	return true
+}
+
+func (s *sample) apply(points []*point) []*point {
+	s.Lock()
+	defer s.Unlock()
+
+	out := make([]*point, 0, len(points))
+	for _, p := range points {
+		path := pointPath(p)
+		var rule *sampleRule
+		for i := range s.rules {
+			if s.rules[i].re.MatchString(path) {
+				rule = &s.rules[i]
+				break
+			}
+		}
+		if rule == nil || s.keep(rule, seriesKey(p, ""), p.Timestamp) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
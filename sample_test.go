@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSample(t *testing.T) {
+	update := func(path string, ms int64) []*point {
+		return []*point{newPoint(path, map[string]string{"device": "r1"},
+			map[string]interface{}{"v": 1.0}, time.Unix(0, ms*int64(time.Millisecond)))}
+	}
+
+	tests := []struct {
+		name string
+		rule SampleRule
+		path string
+		ms   []int64
+		want int
+	}{
+		{name: "every", rule: SampleRule{Path: "^/interfaces/", Every: 3}, path: "/interfaces/", ms: []int64{0, 1, 2, 3, 4, 5, 6}, want: 3},
+		{name: "interval", rule: SampleRule{Path: "^/interfaces/", Interval: 1000}, path: "/interfaces/", ms: []int64{0, 500, 999, 1000, 1500, 2100}, want: 3},
+		{name: "both", rule: SampleRule{Path: "^/interfaces/", Every: 2, Interval: 1500}, path: "/interfaces/", ms: []int64{0, 500, 1000, 1500, 2000, 2500}, want: 2},
+		{name: "other-path", rule: SampleRule{Path: "^/interfaces/", Every: 10}, path: "/components/", ms: []int64{0, 1, 2}, want: 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jctx := &JCtx{}
+			jctx.config.Transform.Sample = []SampleRule{test.rule}
+			if err := transformsInit(jctx); err != nil {
+				t.Fatalf("transformsInit failed: %v", err)
+			}
+			got := 0
+			for _, ms := range test.ms {
+				got += len(applyTransforms(jctx, update(test.path, ms)))
+			}
+			if got != test.want {
+				t.Errorf("got %d updates, want %d", got, test.want)
+			}
+		})
+	}
+
+	t.Run("no-rate", func(t *testing.T) {
+		jctx := &JCtx{}
+		jctx.config.Transform.Sample = []SampleRule{{Path: "."}}
+		if err := transformsInit(jctx); err == nil {
+			t.Errorf("want error, got nil")
+		}
+	})
+}
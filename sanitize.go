@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SanitizeConfig controls how XPath characters are translated into field
+// and tag keys. preset is applied first ("telegraf" or "prometheus"),
+// then the replace rules in order and at last ascii replaces non ASCII
+// characters with underscore.
+type SanitizeConfig struct {
+	Preset  string            `json:"preset"`
+	Replace []SanitizeReplace `json:"replace"`
+	ASCII   bool              `json:"ascii"`
+}
+
+// SanitizeReplace replaces all matches of the regex match with replace,
+// replace can refer to submatches e.g. ${1}
+type SanitizeReplace struct {
+	Match   string `json:"match"`
+	Replace string `json:"replace"`
+}
+
+type sanitizeReplace struct {
+	re      *regexp.Regexp
+	replace string
+}
+
+type sanitize struct {
+	preset  string
+	replace []sanitizeReplace
+	ascii   bool
+}
+
+func newSanitizeTransformer() *transformer {
+	return &transformer{
+		name: "sanitize",
+		new:  newSanitize,
+	}
+}
+
+func newSanitize(jctx *JCtx) (transform, error) {
+	cfg := jctx.config.Transform.Sanitize
+	if cfg.Preset == "" && len(cfg.Replace) == 0 && !cfg.ASCII {
+		return nil, nil
+	}
+	switch cfg.Preset {
+	case "", "telegraf", "prometheus":
+	default:
+		return nil, fmt.Errorf("unknown preset %q, use telegraf or prometheus", cfg.Preset)
+	}
+
+	s := &sanitize{preset: cfg.Preset, ascii: cfg.ASCII}
+	for _, r := range cfg.Replace {
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid match %q: %v", r.Match, err)
+		}
+		s.replace = append(s.replace, sanitizeReplace{re: re, replace: r.Replace})
+	}
+	return s, nil
+}
+
+// telegrafTagKey names list keys the way Telegraf's gnmi input does, short
+// key name unless that is taken already, then element/key
+func telegrafTagKey(key string, tags map[string]string) string {
+	i := strings.LastIndex(key, "/@")
+	if i < 0 {
+		return strings.Replace(key, "-", "_", -1)
+	}
+	short := strings.Replace(key[i+2:], "-", "_", -1)
+	if _, taken := tags[short]; !taken {
+		return short
+	}
+	elem := key[:i]
+	elem = elem[strings.LastIndex(elem, "/")+1:]
+	return strings.Replace(elem, "-", "_", -1) + "/" + short
+}
+
+// telegrafFieldKey is the path relative to the subscription (measurement),
+// without leading slash and with underscores instead of dashes
+func telegrafFieldKey(key, measurement string) string {
+	if strings.HasPrefix(measurement, "/") && strings.HasPrefix(key, measurement) && len(key) > len(measurement) {
+		key = key[len(measurement):]
+	}
+	return strings.Replace(strings.TrimPrefix(key, "/"), "-", "_", -1)
+}
+
+func (s *sanitize) key(k string) string {
+	if s.preset == "prometheus" {
+		k = promName(k)
+	}
+	for _, r := range s.replace {
+		k = r.re.ReplaceAllString(k, r.replace)
+	}
+	if s.ascii {
+		k = strings.Map(func(r rune) rune {
+			if r > 127 {
+				return '_'
+			}
+			return r
+		}, k)
+	}
+	return k
+}
+
+func (s *sanitize) apply(points []*point) []*point {
+	out := make([]*point, 0, len(points))
+	for _, p := range points {
+		// sorted so that the outer list key gets the short name
+		keys := make([]string, 0, len(p.Tags))
+		for k := range p.Tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		tags := make(map[string]string, len(p.Tags))
+		for _, k := range keys {
+			v := p.Tags[k]
+			if s.preset == "telegraf" {
+				k = telegrafTagKey(k, tags)
+			}
+			tags[s.key(k)] = v
+		}
+		fields := make(map[string]interface{}, len(p.Fields))
+		for k, v := range p.Fields {
+			if s.preset == "telegraf" {
+				k = telegrafFieldKey(k, p.Measurement)
+			}
+			fields[s.key(k)] = v
+		}
+		out = append(out, newPoint(p.Measurement, tags, fields, p.Timestamp))
+	}
+	return out
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSanitize(t *testing.T) {
+	in := newPoint("/interfaces/",
+		map[string]string{
+			"device":                      "r1",
+			"/interfaces/interface/@name": "et-0/0/0",
+			"/interfaces/interface/subinterfaces/subinterface/@name": "0",
+		},
+		map[string]interface{}{"/interfaces/interface/state/counters/in-octets": 1.0},
+		time.Unix(1, 0))
+
+	tests := []struct {
+		name   string
+		cfg    SanitizeConfig
+		tags   map[string]string
+		fields map[string]interface{}
+	}{
+		{
+			name: "telegraf",
+			cfg:  SanitizeConfig{Preset: "telegraf"},
+			tags: map[string]string{
+				"device":            "r1",
+				"name":              "et-0/0/0",
+				"subinterface/name": "0",
+			},
+			fields: map[string]interface{}{"interface/state/counters/in_octets": 1.0},
+		},
+		{
+			name: "prometheus",
+			cfg:  SanitizeConfig{Preset: "prometheus"},
+			tags: map[string]string{
+				"device":                      "r1",
+				"_interfaces_interface__name": "et-0/0/0",
+				"_interfaces_interface_subinterfaces_subinterface__name": "0",
+			},
+			fields: map[string]interface{}{"_interfaces_interface_state_counters_in_octets": 1.0},
+		},
+		{
+			name: "replace",
+			cfg: SanitizeConfig{Replace: []SanitizeReplace{
+				{Match: `^/interfaces/interface`, Replace: ""},
+				{Match: `/@?`, Replace: "."},
+				{Match: `^\.`, Replace: ""},
+			}},
+			tags: map[string]string{
+				"device":                          "r1",
+				"name":                            "et-0/0/0",
+				"subinterfaces.subinterface.name": "0",
+			},
+			fields: map[string]interface{}{"state.counters.in-octets": 1.0},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jctx := &JCtx{}
+			jctx.config.Transform.Sanitize = test.cfg
+			if err := transformsInit(jctx); err != nil {
+				t.Fatalf("transformsInit failed: %v", err)
+			}
+			out := applyTransforms(jctx, []*point{in})
+			if len(out) != 1 {
+				t.Fatalf("want 1 point, got %d", len(out))
+			}
+			if !reflect.DeepEqual(out[0].Tags, test.tags) {
+				t.Errorf("tags\ngot:  %v\nwant: %v", out[0].Tags, test.tags)
+			}
+			if !reflect.DeepEqual(out[0].Fields, test.fields) {
+				t.Errorf("fields\ngot:  %v\nwant: %v", out[0].Fields, test.fields)
+			}
+		})
+	}
+
+	t.Run("ascii", func(t *testing.T) {
+		s := &sanitize{ascii: true}
+		if got := s.key("/températures/°C"); got != "/temp_ratures/_C" {
+			t.Errorf("got %s", got)
+		}
+	})
+
+	t.Run("bad-preset", func(t *testing.T) {
+		jctx := &JCtx{}
+		jctx.config.Transform.Sanitize = SanitizeConfig{Preset: "graphite"}
+		if err := transformsInit(jctx); err == nil {
+			t.Errorf("want error, got nil")
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"container/heap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// schedRunners is the number of goroutines running the periodic tasks of
+// all workers, a task due while all of them are busy gets a goroutine of
+// its own for that run
+const schedRunners = 32
+
+// schedTask is a function run every interval by the shared scheduler
+// instead of a goroutine and a ticker of its own
+type schedTask struct {
+	every   time.Duration
+	next    time.Time
+	fn      func()
+	running int32
+	index   int
+}
+
+type schedHeap []*schedTask
+
+func (h schedHeap) Len() int           { return len(h) }
+func (h schedHeap) Less(i, j int) bool { return h[i].next.Before(h[j].next) }
+func (h schedHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *schedHeap) Push(x interface{}) {
+	t := x.(*schedTask)
+	t.index = len(*h)
+	*h = append(*h, t)
+}
+func (h *schedHeap) Pop() interface{} {
+	old := *h
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	t.index = -1
+	return t
+}
+
+// scheduler runs the periodic tasks of all workers (batch writes, stats)
+// with one timer and a fixed set of goroutines
+type scheduler struct {
+	sync.Mutex
+	tasks schedHeap
+	wake  chan struct{}
+	run   chan *schedTask
+}
+
+var (
+	sched     *scheduler
+	schedOnce sync.Once
+)
+
+func newScheduler(runners int) *scheduler {
+	s := &scheduler{
+		wake: make(chan struct{}, 1),
+		run:  make(chan *schedTask, runners),
+	}
+	for i := 0; i < runners; i++ {
+		go func() {
+			for t := range s.run {
+				s.exec(t)
+			}
+		}()
+	}
+	go s.loop()
+	return s
+}
+
+// schedule runs fn every interval on the shared scheduler, the first run is
+// one interval from now. A run is skipped while the previous one is still
+// going on.
+func schedule(every time.Duration, fn func()) *schedTask {
+	if every <= 0 {
+		panic("non-positive interval for schedule")
+	}
+	schedOnce.Do(func() {
+		sched = newScheduler(schedRunners)
+	})
+	return sched.add(every, fn)
+}
+
+func (s *scheduler) add(every time.Duration, fn func()) *schedTask {
+	t := &schedTask{every: every, next: time.Now().Add(every), fn: fn}
+	s.Lock()
+	heap.Push(&s.tasks, t)
+	s.Unlock()
+	s.notify()
+	return t
+}
+
+// stop removes the task from the scheduler, a run in progress completes
+func (t *schedTask) stop() {
+	sched.Lock()
+	if t.index >= 0 {
+		heap.Remove(&sched.tasks, t.index)
+	}
+	sched.Unlock()
+}
+
+// flush stops the task and runs it one last time, once the run in progress
+// if any completes
+func (t *schedTask) flush() {
+	t.stop()
+	for !atomic.CompareAndSwapInt32(&t.running, 0, 1) {
+		time.Sleep(time.Millisecond)
+	}
+	t.fn()
+	atomic.StoreInt32(&t.running, 0)
+}
+
+func (s *scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *scheduler) exec(t *schedTask) {
+	t.fn()
+	atomic.StoreInt32(&t.running, 0)
+}
+
+// due returns the tasks to run now and reschedules them, along with the
+// time until the next task is due
+func (s *scheduler) due(now time.Time) ([]*schedTask, time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	var tasks []*schedTask
+	for len(s.tasks) > 0 && !s.tasks[0].next.After(now) {
+		t := s.tasks[0]
+		tasks = append(tasks, t)
+		t.next = t.next.Add(t.every)
+		if t.next.Before(now) {
+			// we fell behind, don't run the missed ones
+			t.next = now.Add(t.every)
+		}
+		heap.Fix(&s.tasks, 0)
+	}
+	if len(s.tasks) == 0 {
+		return tasks, time.Hour
+	}
+	return tasks, s.tasks[0].next.Sub(now)
+}
+
+func (s *scheduler) loop() {
+	timer := time.NewTimer(time.Hour)
+	for {
+		tasks, wait := s.due(time.Now())
+		for _, t := range tasks {
+			if !atomic.CompareAndSwapInt32(&t.running, 0, 1) {
+				continue
+			}
+			select {
+			case s.run <- t:
+			default:
+				go s.exec(t)
+			}
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+		}
+	}
+}
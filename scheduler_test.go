@@ -0,0 +1,50 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	tests := []struct {
+		name  string
+		tasks int
+		every time.Duration
+		run   time.Duration
+		min   int64
+		max   int64
+	}{
+		{"single", 1, 10 * time.Millisecond, 0, 5, 15},
+		{"many", 1000, 20 * time.Millisecond, 0, 2000, 6000},
+		{"slow-skipped", 1, 10 * time.Millisecond, 45 * time.Millisecond, 1, 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var runs int64
+			run := test.run
+			tasks := make([]*schedTask, test.tasks)
+			for i := range tasks {
+				tasks[i] = schedule(test.every, func() {
+					atomic.AddInt64(&runs, 1)
+					time.Sleep(run)
+				})
+			}
+			time.Sleep(110 * time.Millisecond)
+			for _, task := range tasks {
+				task.stop()
+			}
+			// runs dispatched before the stop complete
+			time.Sleep(test.run + 20*time.Millisecond)
+
+			got := atomic.LoadInt64(&runs)
+			if got < test.min || got > test.max {
+				t.Errorf("got %d runs, want %d to %d", got, test.min, test.max)
+			}
+			time.Sleep(3 * test.every)
+			if after := atomic.LoadInt64(&runs); after != got {
+				t.Errorf("got %d runs after stop, want %d", after, got)
+			}
+		})
+	}
+}
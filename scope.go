@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// apiScope is the set of device groups a user or token of the control
+// endpoints may see and control, nil for all devices
+type apiScope map[string]bool
+
+// allows tells whether the worker is in one of the groups of the scope
+func (s apiScope) allows(jctx *JCtx) bool {
+	if s == nil {
+		return true
+	}
+	for _, g := range jctx.config.Groups {
+		if s[g] {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns the workers the scope allows
+func (s apiScope) filter(workers []*JCtx) []*JCtx {
+	if s == nil {
+		return workers
+	}
+	allowed := make([]*JCtx, 0, len(workers))
+	for _, jctx := range workers {
+		if s.allows(jctx) {
+			allowed = append(allowed, jctx)
+		}
+	}
+	return allowed
+}
+
+type scopeKey struct{}
+
+// withScope returns ctx with the scope of the authenticated request
+func withScope(ctx context.Context, s apiScope) context.Context {
+	return context.WithValue(ctx, scopeKey{}, s)
+}
+
+// requestScope returns the scope of the request, nil for all devices
+func requestScope(ctx context.Context) apiScope {
+	s, _ := ctx.Value(scopeKey{}).(apiScope)
+	return s
+}
+
+// validateGroups checks the group names of a device
+func validateGroups(groups []string) error {
+	for _, g := range groups {
+		if g == "" || strings.ContainsAny(g, ", \t") {
+			return fmt.Errorf("invalid group name %q", g)
+		}
+	}
+	return nil
+}
+
+// readScopes reads the scopes of the lines "name group[,group...]" of file,
+// name is a user or the name of a token of a
+func readScopes(file string, a *apiAuth) (map[string]apiScope, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	scopes := map[string]apiScope{}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want name group[,group...]", file, n)
+		}
+		name := fields[0]
+		if !a.known(name) {
+			return nil, fmt.Errorf("%s:%d: no user or token %s", file, n, name)
+		}
+		groups := strings.Split(fields[1], ",")
+		if err := validateGroups(groups); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", file, n, err)
+		}
+		s := apiScope{}
+		for _, g := range groups {
+			s[g] = true
+		}
+		scopes[name] = s
+	}
+	return scopes, nil
+}
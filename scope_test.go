@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nileshsimaria/jtimon/admin"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestNewAPIAuthScopes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-scopes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, content string) string {
+		file := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	tests := []struct {
+		name   string
+		tokens string
+		users  string
+		scopes string
+		err    bool
+		want   map[string]apiScope
+	}{
+		{name: "no scopes", tokens: "t0ken\n", want: map[string]apiScope{}},
+		{
+			name:   "scopes",
+			tokens: "# all devices\nt0ken\n\nemea-noc em3a\napac-noc ap4c\n",
+			users:  "alice:pa:ss\n",
+			scopes: "# regional NOCs\nemea-noc emea\napac-noc apac,oceania\nalice emea\n",
+			want: map[string]apiScope{
+				"emea-noc": {"emea": true},
+				"apac-noc": {"apac": true, "oceania": true},
+				"alice":    {"emea": true},
+			},
+		},
+		{name: "named tokens only", tokens: "emea-noc em3a\n", want: map[string]apiScope{}},
+		{name: "two tokens", tokens: "t0ken\nt1ken\n", err: true},
+		{name: "token name", tokens: "token t0ken\n", err: true},
+		{name: "token line", tokens: "emea-noc em3a extra\n", err: true},
+		{name: "unknown name", tokens: "emea-noc em3a\n", scopes: "apac-noc apac\n", err: true},
+		{name: "no groups", tokens: "emea-noc em3a\n", scopes: "emea-noc\n", err: true},
+		{name: "empty group", tokens: "emea-noc em3a\n", scopes: "emea-noc emea,\n", err: true},
+		{name: "scopes only", scopes: "emea-noc emea\n", err: true},
+	}
+	for _, test := range tests {
+		var tokenFile, usersFile, scopesFile string
+		if test.tokens != "" {
+			tokenFile = write("tokens", test.tokens)
+		}
+		if test.users != "" {
+			usersFile = write("users", test.users)
+		}
+		if test.scopes != "" {
+			scopesFile = write("scopes", test.scopes)
+		}
+		a, err := newAPIAuth(tokenFile, usersFile, scopesFile)
+		if (err != nil) != test.err {
+			t.Errorf("%s: got error %v", test.name, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if len(a.scopes) != len(test.want) {
+			t.Errorf("%s: got scopes %v, want %v", test.name, a.scopes, test.want)
+		}
+		for name, want := range test.want {
+			if got := a.scopes[name]; len(got) != len(want) {
+				t.Errorf("%s: got scope %v of %s, want %v", test.name, got, name, want)
+			}
+			for g := range want {
+				if !a.scopes[name][g] {
+					t.Errorf("%s: %s is not in %s", test.name, name, g)
+				}
+			}
+		}
+	}
+}
+
+func TestScopedAPI(t *testing.T) {
+	apiAuthn = &apiAuth{
+		token:  "t0ken",
+		tokens: map[string]string{"emea-noc": "em3a"},
+		users:  map[string]string{"alice": "pa:ss"},
+		scopes: map[string]apiScope{"emea-noc": {"emea": true}, "alice": {"apac": true, "emea": true}},
+	}
+	defer func() { apiAuthn = nil }()
+	r1 := &JCtx{file: "r1.json", config: Config{Host: "r1", Port: 32767, Groups: []string{"emea"}}}
+	r2 := &JCtx{file: "r2.json", config: Config{Host: "r2", Port: 32767, Groups: []string{"apac"}}}
+	r3 := &JCtx{file: "r3.json", config: Config{Host: "r3", Port: 32767}}
+	for _, jctx := range []*JCtx{r1, r2, r3} {
+		dropsInit(jctx)
+		defer dropsStop(jctx)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", apiHandler(eventsHandler))
+	mux.HandleFunc("/pause", apiHandler(pauseHandler))
+	mux.HandleFunc("/resume", apiHandler(pauseHandler))
+	mux.HandleFunc("/devices/", apiHandler(devicesHandler))
+	mux.HandleFunc("/logs/", apiHandler(logsHandler))
+	do := func(method, url, authorization string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, url, nil)
+		r.Header.Set("Authorization", authorization)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, r)
+		return rec
+	}
+	devices := func(rec *httptest.ResponseRecorder) []string {
+		var reply struct {
+			Devices []struct {
+				Device string `json:"device"`
+			} `json:"devices"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &reply); err != nil {
+			t.Fatalf("%v: %s", err, rec.Body)
+		}
+		var names []string
+		for _, d := range reply.Devices {
+			names = append(names, d.Device)
+		}
+		return names
+	}
+
+	emea, all := "Bearer em3a", "Bearer t0ken"
+	tests := []struct {
+		method        string
+		url           string
+		authorization string
+		code          int
+		devices       []string
+	}{
+		{method: "GET", url: "/events", authorization: emea, code: http.StatusOK, devices: []string{"r1"}},
+		{method: "GET", url: "/events", authorization: basicAuth("alice", "pa:ss"), code: http.StatusOK, devices: []string{"r1", "r2"}},
+		{method: "GET", url: "/events", authorization: all, code: http.StatusOK, devices: []string{"r1", "r2", "r3"}},
+		{method: "GET", url: "/pause", authorization: emea, code: http.StatusOK, devices: []string{"r1"}},
+		{method: "POST", url: "/pause?device=r2", authorization: emea, code: http.StatusNotFound},
+		{method: "POST", url: "/pause?device=r3", authorization: emea, code: http.StatusNotFound},
+		{method: "POST", url: "/pause?device=r1", authorization: emea, code: http.StatusOK, devices: []string{"r1"}},
+		{method: "POST", url: "/resume?device=r1", authorization: emea, code: http.StatusOK, devices: []string{"r1"}},
+		{method: "GET", url: "/devices/r1/paths", authorization: emea, code: http.StatusOK},
+		{method: "GET", url: "/devices/r2/paths", authorization: emea, code: http.StatusNotFound},
+		{method: "GET", url: "/devices/r2/paths", authorization: all, code: http.StatusOK},
+		{method: "POST", url: "/logs/reopen", authorization: emea, code: http.StatusForbidden},
+		{method: "POST", url: "/logs/reopen", authorization: all, code: http.StatusNoContent},
+		{method: "GET", url: "/events", authorization: "Bearer ap4c", code: http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		rec := do(test.method, test.url, test.authorization)
+		if rec.Code != test.code {
+			t.Errorf("%s %s as %s: got %d %s, want %d", test.method, test.url, test.authorization, rec.Code, rec.Body, test.code)
+			continue
+		}
+		if test.devices == nil {
+			continue
+		}
+		if got := devices(rec); len(got) != len(test.devices) || (len(got) != 0 && got[0] != test.devices[0]) ||
+			(len(got) > 1 && got[len(got)-1] != test.devices[len(test.devices)-1]) {
+			t.Errorf("%s %s as %s: got devices %v, want %v", test.method, test.url, test.authorization, got, test.devices)
+		}
+	}
+	if paused, _ := r2.paused.state(); paused {
+		t.Errorf("r2 is paused")
+	}
+
+	// the admin service
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer(adminServerOptions()...)
+	admin.RegisterAdminServer(s, adminServer{})
+	go s.Serve(lis)
+	defer s.Stop()
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := admin.NewAdminClient(conn)
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", emea))
+
+	reply, err := c.Status(ctx, &admin.StatusRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reply.Devices) != 1 || reply.Devices[0].Device != "r1" {
+		t.Errorf("got status %v", reply.Devices)
+	}
+	if _, err := c.Pause(ctx, &admin.PauseRequest{Device: "r2"}); status.Code(err) != codes.NotFound {
+		t.Errorf("pause r2: got %v", err)
+	}
+	if _, err := c.GetPaths(ctx, &admin.DeviceRequest{Device: "r2"}); status.Code(err) != codes.NotFound {
+		t.Errorf("paths of r2: got %v", err)
+	}
+	if _, err := c.GetPaths(ctx, &admin.DeviceRequest{Device: "r1"}); err != nil {
+		t.Errorf("paths of r1: got %v", err)
+	}
+}
+
+func TestValidateGroups(t *testing.T) {
+	for _, test := range []struct {
+		groups []string
+		err    bool
+	}{
+		{groups: nil},
+		{groups: []string{"emea", "core-routers"}},
+		{groups: []string{""}, err: true},
+		{groups: []string{"emea,apac"}, err: true},
+		{groups: []string{"emea west"}, err: true},
+	} {
+		if _, err := ValidateConfig(Config{Groups: test.groups}); (err != nil) != test.err {
+			t.Errorf("%q: got error %v", test.groups, err)
+		}
+	}
+}
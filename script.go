@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ScriptConfig runs the Lua script of file in jtimon for each point (see
+// luaScript), or command as a long lived process which gets the points of
+// every update as one JSON array per line on stdin and answers with one
+// JSON array of points per line on stdout. The answer replaces the points,
+// so the script can modify, drop or add points. If the script fails or does
+// not answer within timeout milliseconds the points are passed on as they
+// are and the script is started again with the next update.
+type ScriptConfig struct {
+	File    string   `json:"file"`
+	Command []string `json:"command"`
+	Timeout int      `json:"timeout"`
+}
+
+type script struct {
+	sync.Mutex
+	jctx    *JCtx
+	command []string
+	timeout time.Duration
+
+	cmd *exec.Cmd
+	in  io.WriteCloser
+	out *bufio.Reader
+}
+
+func newScriptTransformer() *transformer {
+	return &transformer{
+		name: "script",
+		new:  newScript,
+	}
+}
+
+func newScript(jctx *JCtx) (transform, error) {
+	cfg := jctx.config.Transform.Script
+	if cfg.File == "" && len(cfg.Command) == 0 {
+		return nil, nil
+	}
+	if cfg.File != "" && len(cfg.Command) != 0 {
+		return nil, fmt.Errorf("file and command are exclusive")
+	}
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = DefaultScriptTimeout
+	}
+	if cfg.File != "" {
+		return newLuaScript(jctx, cfg.File, time.Duration(timeout)*time.Millisecond)
+	}
+	if _, err := exec.LookPath(cfg.Command[0]); err != nil {
+		return nil, err
+	}
+	return &script{
+		jctx:    jctx,
+		command: cfg.Command,
+		timeout: time.Duration(timeout) * time.Millisecond,
+	}, nil
+}
+
+func (s *script) start() error {
+	cmd := exec.Command(s.command[0], s.command[1:]...)
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	s.cmd, s.in, s.out = cmd, in, bufio.NewReader(out)
+	return nil
+}
+
+func (s *script) stop() {
+	if s.cmd == nil {
+		return
+	}
+	s.in.Close()
+	s.cmd.Process.Kill()
+	s.cmd.Wait()
+	s.cmd = nil
+}
+
+// call sends the points to the script and reads its answer
+func (s *script) call(points []*point) ([]*point, error) {
+	if s.cmd == nil {
+		if err := s.start(); err != nil {
+			return nil, err
+		}
+	}
+	b, err := json.Marshal(points)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.in.Write(append(b, '\n')); err != nil {
+		return nil, err
+	}
+
+	type answer struct {
+		line []byte
+		err  error
+	}
+	ch := make(chan answer, 1)
+	go func() {
+		line, err := s.out.ReadBytes('\n')
+		ch <- answer{line, err}
+	}()
+
+	select {
+	case a := <-ch:
+		if a.err != nil {
+			return nil, a.err
+		}
+		var out []*point
+		d := json.NewDecoder(bytes.NewReader(a.line))
+		d.UseNumber()
+		if err := d.Decode(&out); err != nil {
+			return nil, fmt.Errorf("invalid answer: %v", err)
+		}
+		for _, p := range out {
+			if p == nil {
+				return nil, fmt.Errorf("invalid answer: null point")
+			}
+		}
+		restoreFieldTypes(points, out)
+		return out, nil
+	case <-time.After(s.timeout):
+		return nil, fmt.Errorf("no answer within %v", s.timeout)
+	}
+}
+
+// restoreFieldTypes gives the numbers of the fields of the answer the type
+// the field of the same name had in the points sent to the script, by
+// measurement, so that integer fields stay integers, exact above 2^53.
+// Numbers of new fields and integer fields the script made fractional are
+// float64.
+func restoreFieldTypes(in, out []*point) {
+	types := map[string]interface{}{}
+	for _, p := range in {
+		for k, v := range p.Fields {
+			types[p.Measurement+"\x00"+k] = v
+			types["\x00"+k] = v
+		}
+	}
+	for _, p := range out {
+		for k, v := range p.Fields {
+			n, ok := v.(json.Number)
+			if !ok {
+				continue
+			}
+			like, ok := types[p.Measurement+"\x00"+k]
+			if !ok {
+				like = types["\x00"+k]
+			}
+			p.Fields[k] = numberAs(n, like)
+		}
+	}
+}
+
+// numberAs returns n as the integer type of like, as float64 if like is not
+// an integer or n does not fit in its type
+func numberAs(n json.Number, like interface{}) interface{} {
+	s := string(n)
+	switch like.(type) {
+	case int64:
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
+	case int:
+		if i, err := strconv.ParseInt(s, 10, 0); err == nil {
+			return int(i)
+		}
+	case int32:
+		if i, err := strconv.ParseInt(s, 10, 32); err == nil {
+			return int32(i)
+		}
+	case uint64:
+		if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return u
+		}
+	case uint32:
+		if u, err := strconv.ParseUint(s, 10, 32); err == nil {
+			return uint32(u)
+		}
+	}
+	f, _ := n.Float64()
+	return f
+}
+
+func (s *script) apply(points []*point) []*point {
+	s.Lock()
+	defer s.Unlock()
+
+	out, err := s.call(points)
+	if err != nil {
+		jLogError(s.jctx, "", fmt.Sprintf("script %s failed", s.command[0]), err)
+		s.stop()
+		return points
+	}
+	return out
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScript(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+
+	in := []*point{
+		newPoint("/interfaces/", map[string]string{"device": "r1"}, map[string]interface{}{"in-octets": 1.0}, time.Unix(1, 0).UTC()),
+	}
+	tests := []struct {
+		name   string
+		script string
+		tags   []map[string]string
+	}{
+		{
+			name:   "modify",
+			script: `while read l; do echo "$l" | sed 's/"tags":{/"tags":{"site":"ams",/g'; done`,
+			tags:   []map[string]string{{"device": "r1", "site": "ams"}},
+		},
+		{
+			name:   "drop",
+			script: `while read l; do echo "[]"; done`,
+			tags:   []map[string]string{},
+		},
+		{
+			name:   "add",
+			script: `while read l; do echo "$l" | sed 's/^\[\(.*\)\]$/[\1,\1]/'; done`,
+			tags:   []map[string]string{{"device": "r1"}, {"device": "r1"}},
+		},
+		{
+			name:   "timeout",
+			script: `read l; exec sleep 10`,
+			tags:   []map[string]string{{"device": "r1"}},
+		},
+		{
+			name:   "garbage",
+			script: `while read l; do echo "not json"; done`,
+			tags:   []map[string]string{{"device": "r1"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jctx := &JCtx{}
+			jctx.config.Transform.Script = ScriptConfig{Command: []string{"sh", "-c", test.script}, Timeout: 200}
+			if err := transformsInit(jctx); err != nil {
+				t.Fatalf("transformsInit failed: %v", err)
+			}
+			defer jctx.transforms[0].(*script).stop()
+
+			out := applyTransforms(jctx, in)
+			tags := []map[string]string{}
+			for _, p := range out {
+				tags = append(tags, p.Tags)
+				if !reflect.DeepEqual(p.Fields, in[0].Fields) || !p.Timestamp.Equal(in[0].Timestamp) {
+					t.Errorf("unexpected point %v", *p)
+				}
+			}
+			if !reflect.DeepEqual(tags, test.tags) {
+				t.Errorf("got:  %v\nwant: %v", tags, test.tags)
+			}
+		})
+	}
+
+	t.Run("types", func(t *testing.T) {
+		jctx := &JCtx{}
+		// doubles the counters of the answer, adds a field
+		jctx.config.Transform.Script = ScriptConfig{Command: []string{"sh", "-c",
+			`while read -r l; do echo "$l" | sed 's/"in-pkts":7/"in-pkts":14/; s/"fields":{/"fields":{"new":3,/'; done`}, Timeout: 1000}
+		if err := transformsInit(jctx); err != nil {
+			t.Fatalf("transformsInit failed: %v", err)
+		}
+		defer jctx.transforms[0].(*script).stop()
+
+		in := []*point{newPoint("/interfaces/", map[string]string{"device": "r1"}, map[string]interface{}{
+			"in-octets": uint64(18446744073709551557),
+			"in-pkts":   int64(7),
+			"errors":    uint32(2),
+			"load":      float64(1),
+			"name":      "ge-0/0/0",
+		}, time.Unix(1, 0).UTC())}
+		out := applyTransforms(jctx, in)
+		want := map[string]interface{}{
+			"in-octets": uint64(18446744073709551557),
+			"in-pkts":   int64(14),
+			"errors":    uint32(2),
+			"load":      float64(1),
+			"name":      "ge-0/0/0",
+			"new":       float64(3),
+		}
+		if len(out) != 1 || !reflect.DeepEqual(out[0].Fields, want) {
+			for _, p := range out {
+				for k, v := range p.Fields {
+					t.Logf("%s: %T %v", k, v, v)
+				}
+			}
+			t.Errorf("got %v, want %v", out, want)
+		}
+	})
+
+	t.Run("not-found", func(t *testing.T) {
+		jctx := &JCtx{}
+		jctx.config.Transform.Script = ScriptConfig{Command: []string{"/nonexistent/script"}}
+		if err := transformsInit(jctx); err == nil {
+			t.Errorf("want error, got nil")
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// selfInterval is the default interval of the self-telemetry in seconds
+const selfInterval = 10
+
+// selfTelemetry counts what a worker receives and exports, the counters are
+// written every interval as one point of the self-measurement
+type selfTelemetry struct {
+	points     uint64
+	latency    uint64
+	latencyN   uint64
+	reconnects uint64
+	task       *schedTask
+
+	// the counters at the previous write
+	last     time.Time
+	lastPkts uint64
+	lastPts  uint64
+	lastByte uint64
+	lastLat  uint64
+	lastLatN uint64
+	lastDev  time.Duration
+	lastDevN uint64
+}
+
+// exported counts n points exported of a packet received at rtime (zero
+// if unknown), s may be nil
+func (s *selfTelemetry) exported(n int, rtime time.Time) {
+	if s == nil || n == 0 {
+		return
+	}
+	atomic.AddUint64(&s.points, uint64(n))
+	if rtime.IsZero() {
+		return
+	}
+	atomic.AddUint64(&s.latency, uint64(time.Since(rtime)))
+	atomic.AddUint64(&s.latencyN, 1)
+}
+
+// reconnect counts a reconnect to the device, s may be nil
+func (s *selfTelemetry) reconnect() {
+	if s != nil {
+		atomic.AddUint64(&s.reconnects, 1)
+	}
+}
+
+// fields returns the fields of the self-measurement at now, packets, bytes
+// and drops are the totals of the worker so far
+func (s *selfTelemetry) fields(now time.Time, packets, bytes, drops uint64) map[string]interface{} {
+	points := atomic.LoadUint64(&s.points)
+	latency := atomic.LoadUint64(&s.latency)
+	latencyN := atomic.LoadUint64(&s.latencyN)
+
+	secs := now.Sub(s.last).Seconds()
+	if secs <= 0 {
+		secs = 1
+	}
+	fields := map[string]interface{}{
+		"packets-per-sec": float64(packets-s.lastPkts) / secs,
+		"points-per-sec":  float64(points-s.lastPts) / secs,
+		"bytes-per-sec":   float64(bytes-s.lastByte) / secs,
+		"drops":           float64(drops),
+		"reconnects":      float64(atomic.LoadUint64(&s.reconnects)),
+		"latency-ms":      0.0,
+	}
+	if n := latencyN - s.lastLatN; n != 0 {
+		fields["latency-ms"] = float64(latency-s.lastLat) / float64(n) / float64(time.Millisecond)
+	}
+
+	s.last, s.lastPkts, s.lastPts, s.lastByte = now, packets, points, bytes
+	s.lastLat, s.lastLatN = latency, latencyN
+	return fields
+}
+
+// checkFields returns the fields of the self-measurement of the checks of
+// the data: the gaps in the sequence numbers and the packets lost in them so
+// far, and the latency from the timestamp of the packets to their receipt
+// since the previous write (count and sum of the latencies of the worker)
+func (s *selfTelemetry) checkFields(gaps, lost, latencyN uint64, latency time.Duration) map[string]interface{} {
+	fields := map[string]interface{}{
+		"sequence-gaps":     float64(gaps),
+		"sequence-lost":     float64(lost),
+		"device-latency-ms": 0.0,
+	}
+	if n := latencyN - s.lastDevN; n != 0 {
+		fields["device-latency-ms"] = float64(latency-s.lastDev) / float64(n) / float64(time.Millisecond)
+	}
+	s.lastDev, s.lastDevN = latency, latencyN
+	return fields
+}
+
+// selfInit schedules the self-telemetry of the worker if the influx
+// self-measurement is set
+func selfInit(jctx *JCtx) {
+	cfg := jctx.config.Influx
+	if cfg.SelfMeasurement == "" {
+		return
+	}
+	interval := cfg.SelfInterval
+	if interval == 0 {
+		interval = selfInterval
+	}
+	collector, _ := os.Hostname()
+
+	s := &selfTelemetry{last: time.Now()}
+	jctx.self = s
+	s.task = schedule(time.Duration(interval)*time.Second, func() {
+		var drops uint64
+		for _, q := range jctx.drops.queues() {
+			drops += jctx.drops.get(q)
+		}
+		now := time.Now()
+		fields := s.fields(now, atomic.LoadUint64(&jctx.metrics.packets),
+			atomic.LoadUint64(&jctx.stats.totalInPayloadWireLength), drops)
+		gaps, lost := jctx.stats.gaps.totals()
+		latencyN, latency := jctx.stats.paths.latency()
+		for k, v := range s.checkFields(gaps, lost, latencyN, latency) {
+			fields[k] = v
+		}
+		tags := map[string]string{"device": jctx.config.Host, "collector": collector}
+		exportIDB(jctx, cfg.SelfMeasurement, []*point{newPoint(cfg.SelfMeasurement, tags, fields, now)})
+	})
+}
+
+func selfStop(jctx *JCtx) {
+	if jctx.self != nil {
+		jctx.self.task.stop()
+	}
+}
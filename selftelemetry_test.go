@@ -0,0 +1,92 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSelfTelemetryFields(t *testing.T) {
+	start := time.Now()
+	s := &selfTelemetry{last: start}
+
+	s.exported(100, time.Now().Add(-20*time.Millisecond))
+	s.exported(50, time.Now().Add(-40*time.Millisecond))
+	s.exported(10, time.Time{})
+	s.exported(0, time.Now().Add(-time.Hour))
+	s.reconnect()
+
+	got := s.fields(start.Add(10*time.Second), 20, 5000, 7)
+	latency := got["latency-ms"].(float64)
+	if latency < 30 || latency > 1000 {
+		t.Errorf("got latency %v ms, want about 30", latency)
+	}
+	delete(got, "latency-ms")
+	want := map[string]interface{}{
+		"packets-per-sec": 2.0,
+		"points-per-sec":  16.0,
+		"bytes-per-sec":   500.0,
+		"drops":           7.0,
+		"reconnects":      1.0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("first interval: got %v, want %v", got, want)
+	}
+
+	// only the changes since the previous write count for the rates
+	got = s.fields(start.Add(15*time.Second), 21, 6000, 9)
+	want = map[string]interface{}{
+		"packets-per-sec": 0.2,
+		"points-per-sec":  0.0,
+		"bytes-per-sec":   200.0,
+		"drops":           9.0,
+		"reconnects":      1.0,
+		"latency-ms":      0.0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("second interval: got %v, want %v", got, want)
+	}
+
+	// a worker without self-telemetry has none
+	var none *selfTelemetry
+	none.exported(1, time.Now())
+	none.reconnect()
+}
+
+func TestSelfTelemetryCheckFields(t *testing.T) {
+	s := &selfTelemetry{last: time.Now()}
+	var gaps seqGaps
+	key := seqKey{system: "r1", sensor: "sensor_1000"}
+	gaps.check(key, 1, time.Now())
+	gaps.check(key, 5, time.Now())
+	gaps.check(key, 7, time.Now())
+	var paths pathStats
+	paths.add("/interfaces/", 1, 100, 20*time.Millisecond, true)
+	paths.add("/bgp/", 1, 100, 40*time.Millisecond, true)
+
+	g, lost := gaps.totals()
+	n, sum := paths.latency()
+	got := s.checkFields(g, lost, n, sum)
+	want := map[string]interface{}{
+		"sequence-gaps":     2.0,
+		"sequence-lost":     4.0,
+		"device-latency-ms": 30.0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("first interval: got %v, want %v", got, want)
+	}
+
+	// the latency is the average of the packets since the previous write
+	paths.add("/bgp/", 1, 100, 10*time.Millisecond, true)
+	n, sum = paths.latency()
+	got = s.checkFields(g, lost, n, sum)
+	want["device-latency-ms"] = 10.0
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("second interval: got %v, want %v", got, want)
+	}
+	got = s.checkFields(g, lost, n, sum)
+	want["device-latency-ms"] = 0.0
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("without packets: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"golang.org/x/net/context"
+)
+
+var sensorsTimeout = flag.Int("sensors-timeout", 10, "How long jtimon sensors waits for the data of each path, in seconds")
+
+// knownSensors are the paths of the sensors of Junos commonly subscribed to,
+// jtimon sensors suggests them for the paths which look misspelled
+var knownSensors = []string{
+	"/interfaces/",
+	"/components/",
+	"/lldp/",
+	"/system/",
+	"/local-routes/",
+	"/network-instances/network-instance/protocols/protocol/bgp/",
+	"/network-instances/network-instance/protocols/protocol/isis/",
+	"/network-instances/network-instance/protocols/protocol/ospfv2/",
+	"/network-instances/network-instance/mpls/",
+	"/network-instances/network-instance/afts/",
+	"/arp-information/",
+	"/nd6-information/",
+	"/ipv6-ra/",
+	"/junos/events/",
+	"/junos/kernel-ifstate/",
+	"/junos/system/cmerror/configuration/",
+	"/junos/system/cmerror/counters/",
+	"/junos/system/linecard/cpu/memory/",
+	"/junos/system/linecard/firewall/",
+	"/junos/system/linecard/interface/",
+	"/junos/system/linecard/interface/logical/usage/",
+	"/junos/system/linecard/interface/queue/",
+	"/junos/system/linecard/npu/memory/",
+	"/junos/system/linecard/npu/utilization/",
+	"/junos/system/linecard/optics/",
+	"/junos/system/linecard/packet/usage/",
+	"/junos/system/linecard/qmon-sw/",
+	"/junos/services/label-switched-path/usage/",
+	"/junos/system/subscriber-management/",
+}
+
+// The results of the paths of jtimon sensors
+const (
+	SensorOK       = "ok"
+	SensorNoData   = "no data"
+	SensorRejected = "rejected"
+	SensorInvalid  = "invalid"
+)
+
+// sensorResult is what jtimon sensors found of a configured path
+type sensorResult struct {
+	path   string
+	status string
+	points int
+	// note is the error of the device or of the syntax of the path, and the
+	// known sensors it may be a misspelling of
+	note string
+}
+
+// suggest notes the known sensor the path of a result which is not ok may
+// be a misspelling of
+func (r *sensorResult) suggest() {
+	if r.status == SensorOK {
+		return
+	}
+	if s := suggestSensor(r.path); s != "" {
+		if r.note != "" {
+			r.note += ", "
+		}
+		r.note += "did you mean " + s + "?"
+	}
+}
+
+// checkPathSyntax tells what is wrong with the syntax of the path, nil if
+// nothing is
+func checkPathSyntax(path string) error {
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("does not start with /")
+	}
+	depth := 0
+	for i := 0; i < len(path); i++ {
+		switch path[i] {
+		case '[':
+			depth++
+		case ']':
+			if depth--; depth < 0 {
+				return fmt.Errorf("] without [ at %d", i)
+			}
+		case '/':
+			if depth == 0 && i > 0 && path[i-1] == '/' {
+				return fmt.Errorf("empty element at %d", i)
+			}
+		case ' ':
+			if depth == 0 {
+				return fmt.Errorf("space at %d", i)
+			}
+		}
+	}
+	if depth != 0 {
+		return fmt.Errorf("[ without ]")
+	}
+	return nil
+}
+
+// editDistance is the Levenshtein distance of a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// suggestSensor returns the known sensor the path is likely a misspelling
+// of, "" if it is one or is not close to any. The list keys and the
+// trailing slash are not compared.
+func suggestSensor(path string) string {
+	norm := func(p string) string {
+		elems := pathElems(p)
+		for i, e := range elems {
+			if j := strings.Index(e, "["); j >= 0 {
+				elems[i] = e[:j]
+			}
+		}
+		return "/" + strings.Join(elems, "/") + "/"
+	}
+	p := norm(path)
+	best, bestDist := "", 0
+	for _, s := range knownSensors {
+		d := editDistance(p, s)
+		if d == 0 {
+			return ""
+		}
+		// a few typos, fewer in short paths
+		if max := 1 + len(s)/10; d <= max && (best == "" || d < bestDist) {
+			best, bestDist = s, d
+		}
+	}
+	return best
+}
+
+// auditSensors checks the paths of the worker: their syntax, then whether
+// get fetches data of them from the device within timeout each
+func auditSensors(jctx *JCtx, get func(context.Context, string) ([]*point, error), timeout time.Duration) []sensorResult {
+	var results []sensorResult
+	for _, p := range jctx.config.Paths {
+		r := sensorResult{path: p.Path}
+		if err := checkPathSyntax(p.Path); err != nil {
+			r.status, r.note = SensorInvalid, err.Error()
+			results = append(results, r)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		points, err := get(ctx, p.Path)
+		cancel()
+		switch {
+		case err != nil:
+			r.status, r.note = SensorRejected, err.Error()
+		case len(points) == 0:
+			r.status = SensorNoData
+		default:
+			r.status, r.points = SensorOK, len(points)
+		}
+		r.suggest()
+		results = append(results, r)
+	}
+	return results
+}
+
+// writeSensors writes the results as a table and tells whether all the
+// paths are ok
+func writeSensors(w io.Writer, results []sensorResult) bool {
+	return writeSensorTable(w, results, "points")
+}
+
+// writeSensorTable writes the results as a table with the counts of the
+// ok paths in the column named count
+func writeSensorTable(w io.Writer, results []sensorResult, count string) bool {
+	width := len("path")
+	for _, r := range results {
+		if len(r.path) > width {
+			width = len(r.path)
+		}
+	}
+	ok := true
+	line := func(path, status, points, note string) {
+		fmt.Fprintf(w, "%s\n", strings.TrimRight(fmt.Sprintf("%-*s  %-8s %7s  %s", width, path, status, points, note), " "))
+	}
+	line("path", "status", count, "note")
+	for _, r := range results {
+		points := "-"
+		if r.status == SensorOK {
+			points = fmt.Sprint(r.points)
+		} else {
+			ok = false
+		}
+		line(r.path, r.status, points, r.note)
+	}
+	return ok
+}
+
+// sensorsMain runs jtimon sensors on the device of the config file, it
+// exits with status 1 if one of its paths is not ok
+func sensorsMain() {
+	if len(*configFiles) == 0 {
+		log.Printf("jtimon sensors needs the config file of the device (--config)")
+		os.Exit(1)
+	}
+	jctx, err := loadDevice((*configFiles)[0])
+	if err != nil {
+		log.Printf("%v", err)
+		os.Exit(1)
+	}
+	vendor, err := getVendor(jctx)
+	if err != nil {
+		log.Printf("sensors: %v", err)
+		os.Exit(1)
+	}
+	if vendor.get == nil {
+		log.Printf("sensors: jtimon sensors does not support vendor %s", vendor.name)
+		os.Exit(1)
+	}
+	conn, err := dialDevice(jctx, vendor)
+	if err != nil {
+		log.Printf("sensors: %v", err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+	if vendor.loginCheckRequired {
+		if err := vendor.sendLoginCheck(jctx, conn); err != nil {
+			log.Printf("sensors: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	get := func(ctx context.Context, path string) ([]*point, error) {
+		points, _, err := vendor.get(ctx, conn, jctx, path)
+		return points, err
+	}
+	results := auditSensors(jctx, get, time.Duration(*sensorsTimeout)*time.Second)
+	if !writeSensors(os.Stdout, results) {
+		conn.Close()
+		os.Exit(1)
+	}
+}
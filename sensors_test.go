@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nileshsimaria/jtimon/simulator"
+	"golang.org/x/net/context"
+)
+
+func TestCheckPathSyntax(t *testing.T) {
+	tests := []struct {
+		path string
+		err  string
+	}{
+		{"/interfaces/", ""},
+		{"/interfaces/interface[name='ge-0/0/0']/state", ""},
+		{"/a[x='a b']", ""},
+		{"interfaces", "does not start with /"},
+		{"/interfaces//state", "empty element at 12"},
+		{"/interfaces/interface[name='ge-0/0/0'/", "[ without ]"},
+		{"/interfaces/interface]", "] without [ at 21"},
+		{"/interfaces/ state", "space at 12"},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			err := checkPathSyntax(test.path)
+			if got := ""; err != nil {
+				got = err.Error()
+				if got != test.err {
+					t.Errorf("checkPathSyntax() = %q, want %q", got, test.err)
+				}
+			} else if test.err != "" {
+				t.Errorf("checkPathSyntax() = nil, want %q", test.err)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+		{"/interfaces/", "/intefaces/", 1},
+		{"/interfaces/", "/interfaces/", 0},
+	}
+	for _, test := range tests {
+		if got := editDistance(test.a, test.b); got != test.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestSuggestSensor(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/interfaces/", ""},
+		{"/interfaces", ""},
+		{"/interfaces/interface[name='ge-0/0/0']/", ""},
+		{"/intefaces/", "/interfaces/"},
+		{"/interface", "/interfaces/"},
+		{"/junos/system/linecard/cpu/memry", "/junos/system/linecard/cpu/memory/"},
+		{"/junos/system/linecard/npu/utilisation/", "/junos/system/linecard/npu/utilization/"},
+		{"/lldq/", "/lldp/"},
+		{"/acme/widgets/", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			if got := suggestSensor(test.path); got != test.want {
+				t.Errorf("suggestSensor() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAuditSensors(t *testing.T) {
+	jctx := &JCtx{config: Config{Paths: []PathsConfig{
+		{Path: "/interfaces/"},
+		{Path: "/intefaces/"},
+		{Path: "/junos/system/linecard/cpu/memory/"},
+		{Path: "lldp"},
+	}}}
+	get := func(ctx context.Context, path string) ([]*point, error) {
+		switch path {
+		case "/interfaces/":
+			return []*point{{}, {}}, nil
+		case "/junos/system/linecard/cpu/memory/":
+			<-ctx.Done()
+			return nil, nil
+		}
+		return nil, errors.New("rpc error: code = InvalidArgument")
+	}
+	var buf bytes.Buffer
+	if writeSensors(&buf, auditSensors(jctx, get, 10*time.Millisecond)) {
+		t.Errorf("writeSensors() = true")
+	}
+	want := `path                                status    points  note
+/interfaces/                        ok             2
+/intefaces/                         rejected       -  rpc error: code = InvalidArgument, did you mean /interfaces/?
+/junos/system/linecard/cpu/memory/  no data        -
+lldp                                invalid        -  does not start with /
+`
+	if buf.String() != want {
+		t.Errorf("writeSensors() wrote\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestSensorsDevice(t *testing.T) {
+	script := simulator.DefaultScript()
+	script.User, script.Password = "jtimon", "secret"
+	s, err := simulator.Start("127.0.0.1:0", script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	host, port, _ := net.SplitHostPort(s.Addr())
+	p, _ := strconv.Atoi(port)
+
+	jctx := &JCtx{config: Config{Host: host, Port: p, User: "jtimon", Password: "secret",
+		Paths: []PathsConfig{{Path: "/interfaces"}, {Path: "/intefaces"}}}}
+	jctx.influxCtx.reXpath = regexp.MustCompile(MatchExpressionXpath)
+	jctx.influxCtx.reKey = regexp.MustCompile(MatchExpressionKey)
+	vendor, _ := getVendor(jctx)
+	conn, err := dialDevice(jctx, vendor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := vendor.sendLoginCheck(jctx, conn); err != nil {
+		t.Fatal(err)
+	}
+	get := func(ctx context.Context, path string) ([]*point, error) {
+		points, _, err := vendor.get(ctx, conn, jctx, path)
+		return points, err
+	}
+	results := auditSensors(jctx, get, 5*time.Second)
+	if len(results) != 2 || results[0].status != SensorOK || results[0].points == 0 ||
+		results[1].status != SensorRejected || results[1].note == "" {
+		t.Errorf("auditSensors() = %+v", results)
+	}
+}
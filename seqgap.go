@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	na_pb "github.com/nileshsimaria/jtimon/telemetry"
+)
+
+// seqKey identifies a sequence of Junos telemetry packets, their sequence
+// numbers increase by one per system, component, sub-component and sensor
+type seqKey struct {
+	system       string
+	component    uint32
+	subComponent uint32
+	sensor       string
+}
+
+func (k seqKey) componentName() string {
+	return fmt.Sprintf("%d/%d", k.component, k.subComponent)
+}
+
+// seqGap are the gaps found in one sequence
+type seqGap struct {
+	gaps     uint64
+	lost     uint64
+	lastSize uint64
+	lastTime time.Time
+}
+
+// seqGaps tracks the sequence numbers of the packets of a worker and the
+// gaps in them, the packets the device sent but jtimon never received
+type seqGaps struct {
+	sync.Mutex
+	last map[seqKey]uint64
+	m    map[seqKey]*seqGap
+}
+
+// restart forgets the sequence numbers seen, a new subscription starts new
+// sequences
+func (s *seqGaps) restart() {
+	s.Lock()
+	s.last = nil
+	s.Unlock()
+}
+
+// reset forgets the gaps seen so far, the sequences go on
+func (s *seqGaps) reset() {
+	s.Lock()
+	s.m = nil
+	s.Unlock()
+}
+
+// check records the sequence number of the packet received at rtime and
+// returns the number of packets missing before it. Smaller sequence numbers
+// than the last one start the sequence over.
+func (s *seqGaps) check(key seqKey, seq uint64, rtime time.Time) uint64 {
+	s.Lock()
+	defer s.Unlock()
+	prev, ok := s.last[key]
+	if s.last == nil {
+		s.last = map[seqKey]uint64{}
+	}
+	s.last[key] = seq
+	if !ok || seq <= prev+1 {
+		return 0
+	}
+
+	lost := seq - prev - 1
+	g, ok := s.m[key]
+	if !ok {
+		if s.m == nil {
+			s.m = map[seqKey]*seqGap{}
+		}
+		g = &seqGap{}
+		s.m[key] = g
+	}
+	g.gaps++
+	g.lost += lost
+	g.lastSize = lost
+	g.lastTime = rtime
+	return lost
+}
+
+// each calls fn with the gaps of every sequence which had gaps, sorted by
+// sensor and component
+func (s *seqGaps) each(fn func(key seqKey, g seqGap)) {
+	s.Lock()
+	keys := make([]seqKey, 0, len(s.m))
+	gaps := make(map[seqKey]seqGap, len(s.m))
+	for k, g := range s.m {
+		keys = append(keys, k)
+		gaps[k] = *g
+	}
+	s.Unlock()
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.sensor != b.sensor {
+			return a.sensor < b.sensor
+		}
+		if a.system != b.system {
+			return a.system < b.system
+		}
+		if a.component != b.component {
+			return a.component < b.component
+		}
+		return a.subComponent < b.subComponent
+	})
+	for _, k := range keys {
+		fn(k, gaps[k])
+	}
+}
+
+// totals returns the gaps of all sequences and the packets lost in them
+func (s *seqGaps) totals() (gaps, lost uint64) {
+	s.Lock()
+	defer s.Unlock()
+	for _, g := range s.m {
+		gaps += g.gaps
+		lost += g.lost
+	}
+	return gaps, lost
+}
+
+// table describes the gaps, one line per sequence which had gaps
+func (s *seqGaps) table() string {
+	t := ""
+	s.each(func(k seqKey, g seqGap) {
+		if t == "" {
+			t = fmt.Sprintf("%-60s | %9s | %8s | %10s | %s\n", "Sensor", "Component", "Gaps", "Lost", "Last gap")
+		}
+		t += fmt.Sprintf("%-60s | %9s | %8v | %10v | %d at %s\n", k.sensor, k.componentName(), g.gaps, g.lost,
+			g.lastSize, g.lastTime.Format(time.RFC3339))
+	})
+	return t
+}
+
+// checkSequence looks for packets missing before the Junos packet received
+// at rtime and logs the gap
+func checkSequence(jctx *JCtx, ocData *na_pb.OpenConfigData, rtime time.Time) {
+	key := seqKey{
+		system:       ocData.SystemId,
+		component:    ocData.ComponentId,
+		subComponent: ocData.SubComponentId,
+		sensor:       ocData.Path,
+	}
+	if lost := jctx.stats.gaps.check(key, ocData.SequenceNumber, rtime); lost != 0 {
+		jLogWarn(jctx, fmt.Sprintf("Sequence gap of %d packets from %s component %s before sequence number %d",
+			lost, key.sensor, key.componentName(), ocData.SequenceNumber))
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	na_pb "github.com/nileshsimaria/jtimon/telemetry"
+)
+
+func TestSeqGaps(t *testing.T) {
+	rtime := time.Date(2020, 3, 1, 10, 30, 0, 0, time.UTC)
+	cpu := seqKey{system: "r1", component: 1, sensor: "sensor_1001:/junos/system/linecard/cpu/:/junos/system/linecard/cpu/:PFE"}
+	ifd := seqKey{system: "r1", component: 1, subComponent: 1, sensor: "sensor_1000:/interfaces/:/interfaces/:PFE"}
+
+	tests := []struct {
+		key  seqKey
+		seq  uint64
+		lost uint64
+	}{
+		{cpu, 10, 0},
+		{cpu, 11, 0},
+		{ifd, 0, 0},
+		{cpu, 15, 3},
+		{ifd, 1, 0},
+		{cpu, 15, 0},
+		// the device started the sequence over
+		{cpu, 2, 0},
+		{cpu, 3, 0},
+		{cpu, 5, 1},
+		{ifd, 3, 1},
+	}
+	var s seqGaps
+	for i, test := range tests {
+		if lost := s.check(test.key, test.seq, rtime.Add(time.Duration(i)*time.Second)); lost != test.lost {
+			t.Errorf("%d: got %d lost, want %d", i, lost, test.lost)
+		}
+	}
+
+	got := map[seqKey]seqGap{}
+	s.each(func(k seqKey, g seqGap) { got[k] = g })
+	want := map[seqKey]seqGap{
+		cpu: {gaps: 2, lost: 4, lastSize: 1, lastTime: rtime.Add(8 * time.Second)},
+		ifd: {gaps: 1, lost: 1, lastSize: 1, lastTime: rtime.Add(9 * time.Second)},
+	}
+	for k, w := range want {
+		if g := got[k]; g != w {
+			t.Errorf("%s: got %+v, want %+v", k.sensor, g, w)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(s.table()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "sensor_1000:") || !strings.HasSuffix(lines[2], "1 at 2020-03-01T10:30:08Z") {
+		t.Errorf("got table\n%s", strings.Join(lines, "\n"))
+	}
+
+	// a new subscription starts new sequences
+	s.restart()
+	if lost := s.check(cpu, 100, rtime); lost != 0 {
+		t.Errorf("got %d lost after restart", lost)
+	}
+}
+
+func TestCheckSequence(t *testing.T) {
+	jctx := &JCtx{config: Config{Log: LogConfig{Level: LogLevelError}}}
+	for _, seq := range []uint64{1, 2, 6} {
+		checkSequence(jctx, &na_pb.OpenConfigData{SystemId: "r1", ComponentId: 2, Path: "sensor_1000", SequenceNumber: seq}, time.Now())
+	}
+	jctx.stats.gaps.each(func(k seqKey, g seqGap) {
+		if k.componentName() != "2/0" || g.lost != 3 {
+			t.Errorf("got %s %+v", k.componentName(), g)
+		}
+	})
+}
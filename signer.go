@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// signerTimeout is how long a signature of the signer command may take
+const signerTimeout = 10 * time.Second
+
+// signerHashes are the names of the hashes in JTIMON_SIGN_HASH
+var signerHashes = map[crypto.Hash]string{
+	crypto.MD5SHA1: "MD5SHA1",
+	crypto.SHA1:    "SHA1",
+	crypto.SHA256:  "SHA256",
+	crypto.SHA384:  "SHA384",
+	crypto.SHA512:  "SHA512",
+}
+
+// commandSigner signs with the client key of a device kept out of jtimon, in
+// a PKCS#11 token or HSM, by running the signer command of the TLS config.
+// The command gets the digest on its stdin, the hash in JTIMON_SIGN_HASH
+// and, for RSA keys, the padding (pkcs1 or pss) in JTIMON_SIGN_PADDING, and
+// writes the signature to its stdout as crypto.Signer returns it: ASN.1 DER
+// for ECDSA and the raw signature for RSA.
+type commandSigner struct {
+	command []string
+	pub     crypto.PublicKey
+}
+
+func (s *commandSigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+func (s *commandSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash, ok := signerHashes[opts.HashFunc()]
+	if !ok {
+		return nil, fmt.Errorf("signer: hash %d is not supported", opts.HashFunc())
+	}
+	env := append(os.Environ(), "JTIMON_SIGN_HASH="+hash)
+	if _, ok := s.pub.(*rsa.PublicKey); ok {
+		padding := "pkcs1"
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			padding = "pss"
+		}
+		env = append(env, "JTIMON_SIGN_PADDING="+padding)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), signerTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, s.command[0], s.command[1:]...)
+	cmd.Env = env
+	cmd.Stdin = bytes.NewReader(digest)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	sig, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("signer %s: %v: %s", s.command[0], err, strings.TrimSpace(stderr.String()))
+	}
+	if len(sig) == 0 {
+		return nil, fmt.Errorf("signer %s: no signature", s.command[0])
+	}
+	return sig, nil
+}
+
+// loadSignerCertificate returns the client certificate of crtFile whose key
+// is used by the signer command
+func loadSignerCertificate(crtFile string, command []string) (tls.Certificate, error) {
+	var cert tls.Certificate
+	b, err := ioutil.ReadFile(crtFile)
+	if err != nil {
+		return cert, err
+	}
+	for {
+		var block *pem.Block
+		if block, b = pem.Decode(b); block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			cert.Certificate = append(cert.Certificate, block.Bytes)
+		}
+	}
+	if len(cert.Certificate) == 0 {
+		return cert, fmt.Errorf("no certificate in %s", crtFile)
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return cert, err
+	}
+	cert.PrivateKey = &commandSigner{command: command, pub: cert.Leaf.PublicKey}
+	return cert, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommandSigner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-signer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := func(name string) string { return filepath.Join(dir, name) }
+	// the signer writes what it got and signs everything with "sig"
+	command := []string{"sh", "-c", `echo "$JTIMON_SIGN_HASH $JTIMON_SIGN_PADDING" > ` + file("env") + `; cat > ` + file("digest") + `; printf sig`}
+
+	tests := []struct {
+		name string
+		pub  crypto.PublicKey
+		opts crypto.SignerOpts
+		env  string
+	}{
+		{name: "ecdsa", pub: &ecdsa.PublicKey{}, opts: crypto.SHA384, env: "SHA384 "},
+		{name: "rsa", pub: &rsa.PublicKey{}, opts: crypto.SHA256, env: "SHA256 pkcs1"},
+		{name: "rsa pss", pub: &rsa.PublicKey{}, opts: &rsa.PSSOptions{Hash: crypto.SHA256}, env: "SHA256 pss"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &commandSigner{command: command, pub: test.pub}
+			sig, err := s.Sign(nil, []byte("digest"), test.opts)
+			if err != nil || string(sig) != "sig" {
+				t.Fatalf("got %q %v", sig, err)
+			}
+			env, _ := ioutil.ReadFile(file("env"))
+			digest, _ := ioutil.ReadFile(file("digest"))
+			if strings.TrimSuffix(string(env), "\n") != test.env || string(digest) != "digest" {
+				t.Errorf("the signer got %q and %q", env, digest)
+			}
+		})
+	}
+
+	s := &commandSigner{command: []string{"sh", "-c", "echo no token >&2; exit 1"}, pub: &ecdsa.PublicKey{}}
+	if _, err := s.Sign(nil, []byte("digest"), crypto.SHA256); err == nil || !strings.Contains(err.Error(), "no token") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestSignerTLS(t *testing.T) {
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("no openssl")
+	}
+	dir, err := ioutil.TempDir("", "jtimon-signer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := func(name string) string { return filepath.Join(dir, name) }
+	ca, caKey := testCert(t, dir, "ca", nil, nil)
+	testCert(t, dir, "device", ca, caKey)
+	testCert(t, dir, "client", ca, caKey)
+	addr, clients, stop := testTLSDevice(t, dir, ca)
+	defer stop()
+
+	// openssl stands for the HSM, the key is not given to jtimon
+	cfg := TLSConfig{
+		CA:        file("ca.crt"),
+		ClientCrt: file("client.crt"),
+		Signer:    []string{"openssl", "pkeyutl", "-sign", "-inkey", file("client.key")},
+	}
+	if err := validateTLSConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := testTLSClient(t, addr, cfg, clients); got != "client" {
+		t.Errorf("got client certificate %q", got)
+	}
+
+	for _, invalid := range []TLSConfig{
+		{CA: file("ca.crt"), Signer: cfg.Signer},
+		{CA: file("ca.crt"), ClientCrt: file("client.crt"), ClientKey: file("client.key"), Signer: cfg.Signer},
+	} {
+		if err := validateTLSConfig(invalid); err == nil {
+			t.Errorf("%+v: no error", invalid)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nileshsimaria/jtimon/simulator"
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	simulateListen = flag.String("simulate-listen", "127.0.0.1:50051", "Address jtimon simulate serves the simulated Junos device on")
+	simulateScript = flag.String("simulate-script", "", "JSON script of the sensors and faults of jtimon simulate (default the counters of four interfaces)")
+)
+
+// simulateMain runs jtimon simulate, a simulated Junos device until it is
+// interrupted
+func simulateMain() {
+	script := simulator.DefaultScript()
+	if *simulateScript != "" {
+		var err error
+		if script, err = simulator.LoadScript(*simulateScript); err != nil {
+			log.Fatalf("simulate: %v", err)
+		}
+	}
+	s, err := simulator.Start(*simulateListen, script)
+	if err != nil {
+		log.Fatalf("simulate: %v", err)
+	}
+	log.Printf("simulating %s on %s", script.SystemID, s.Addr())
+
+	sigch := make(chan os.Signal, 1)
+	signal.Notify(sigch, os.Interrupt, syscall.SIGTERM)
+	<-sigch
+	s.Stop()
+	b, _ := json.Marshal(s.Stats())
+	log.Printf("simulated %s", b)
+}
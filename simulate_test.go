@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nileshsimaria/jtimon/simulator"
+)
+
+func TestSimulatedDevice(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-simulate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(d time.Duration, n bool) { reconnectDelay, *noppgoroutines = d, n }(reconnectDelay, *noppgoroutines)
+	reconnectDelay, *noppgoroutines = 100*time.Millisecond, true
+
+	script := simulator.DefaultScript()
+	script.User, script.Password = "jtimon", "secret"
+	script.Faults = simulator.Faults{Drop: 0.1, Malformed: 0.02, DisconnectAfter: 40, Seed: 1}
+	s, err := simulator.Start("127.0.0.1:0", script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the receive loop of the worker reads --no-per-packet-goroutines until
+	// its stream ends, the flags are restored once it recorded the disconnect
+	var jctx *JCtx
+	defer func() {
+		s.Stop()
+		if jctx != nil {
+			waitDisconnect(t, jctx)
+		}
+	}()
+	_, port, _ := net.SplitHostPort(s.Addr())
+
+	file := filepath.Join(dir, "sim.json")
+	config := fmt.Sprintf(`{"host": "127.0.0.1", "port": %s, "user": "jtimon", "password": "secret", "paths": [{"path": "/interfaces", "freq": 20}]}`, port)
+	if err := ioutil.WriteFile(file, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	workers := NewJWorkers([]string{file}, "", 3)
+	workers.StartWorkers()
+	workers.Wait()
+
+	jctx = workers.m[file].jctx
+	stats := s.Stats()
+	if stats.Logins == 0 || stats.Disconnects == 0 || stats.Dropped == 0 || stats.Malformed == 0 {
+		t.Fatalf("simulated %+v", stats)
+	}
+	if packets := atomic.LoadUint64(&jctx.metrics.packets); packets == 0 || packets > stats.Messages {
+		t.Errorf("received %d packets of %d", packets, stats.Messages)
+	}
+	if reconnects := atomic.LoadUint64(&jctx.metrics.reconnects); reconnects < stats.Disconnects {
+		t.Errorf("%d reconnects after %d disconnects", reconnects, stats.Disconnects)
+	}
+	if decodeErrs := atomic.LoadUint64(&jctx.metrics.decodeErrs); decodeErrs == 0 {
+		t.Errorf("no decode errors of %d malformed messages", stats.Malformed)
+	}
+	if gaps, lost := jctx.stats.gaps.totals(); gaps == 0 || lost == 0 {
+		t.Errorf("no sequence gaps of %d dropped messages", stats.Dropped)
+	}
+}
@@ -0,0 +1,408 @@
+// Package simulator is a simulated Junos device for the integration tests of
+// jtimon. It serves the telemetry RPC and LoginCheck, streaming the updates
+// of scripted sensors, and drops, disconnects and malformed messages on
+// demand.
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	auth_pb "github.com/nileshsimaria/jtimon/authentication"
+	na_pb "github.com/nileshsimaria/jtimon/telemetry"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultInterval is the interval of the updates of the subscriptions
+// without a sample frequency
+const DefaultInterval = time.Second
+
+// Script is what the simulated device streams
+type Script struct {
+	// SystemID is the system_id of the messages
+	SystemID string `json:"system-id"`
+	// User and Password are the credentials LoginCheck accepts, any
+	// without them
+	User     string   `json:"user"`
+	Password string   `json:"password"`
+	Sensors  []Sensor `json:"sensors"`
+	Faults   Faults   `json:"faults"`
+}
+
+// Sensor is a scripted sensor, it streams to the subscriptions of the paths
+// above or under its path
+type Sensor struct {
+	Path string `json:"path"`
+	// Name is the sensor name of the messages, sensor_1000 by default
+	Name        string `json:"name"`
+	ComponentID uint32 `json:"component-id"`
+	// Prefixes are the __prefix__ of the messages of an update, one message
+	// each; one message without prefix if there are none
+	Prefixes []string `json:"prefixes"`
+	Fields   []Field  `json:"fields"`
+}
+
+// Field is a value of the messages of a sensor
+type Field struct {
+	Key string `json:"key"`
+	// Value is a string, a bool or a number
+	Value interface{} `json:"value"`
+	// Step is added to a number at each update
+	Step float64 `json:"step"`
+}
+
+// Faults are the failures the device simulates
+type Faults struct {
+	// Drop is the fraction of the messages which are not sent, their
+	// sequence numbers are skipped
+	Drop float64 `json:"drop"`
+	// Malformed is the fraction of the messages sent as bytes which are
+	// not a message, the client fails to decode them
+	Malformed float64 `json:"malformed"`
+	// DisconnectAfter ends the streams with Unavailable after that many
+	// messages, 0 never
+	DisconnectAfter int `json:"disconnect-after"`
+	// Reject is the number of the first subscriptions refused with
+	// Unavailable
+	Reject int `json:"reject"`
+	// Seed is the seed of the random faults
+	Seed int64 `json:"seed"`
+}
+
+// Stats are the counters of a simulated device
+type Stats struct {
+	Logins        uint64 `json:"logins"`
+	Subscriptions uint64 `json:"subscriptions"`
+	Rejected      uint64 `json:"rejected"`
+	Messages      uint64 `json:"messages"`
+	Dropped       uint64 `json:"dropped"`
+	Malformed     uint64 `json:"malformed"`
+	Disconnects   uint64 `json:"disconnects"`
+}
+
+// LoadScript reads the JSON script of file
+func LoadScript(file string) (Script, error) {
+	var script Script
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return script, err
+	}
+	if err := json.Unmarshal(b, &script); err != nil {
+		return script, fmt.Errorf("%s: %v", file, err)
+	}
+	return script, script.validate()
+}
+
+// DefaultScript streams the counters of four interfaces
+func DefaultScript() Script {
+	s := Sensor{Path: "/interfaces/", Fields: []Field{
+		{Key: "state/oper-status", Value: "UP"},
+		{Key: "state/counters/in-octets", Value: 0.0, Step: 125000},
+		{Key: "state/counters/out-octets", Value: 0.0, Step: 62500},
+		{Key: "state/counters/in-pkts", Value: 0.0, Step: 100},
+		{Key: "state/counters/out-pkts", Value: 0.0, Step: 50},
+	}}
+	for i := 0; i < 4; i++ {
+		s.Prefixes = append(s.Prefixes, fmt.Sprintf("/interfaces/interface[name='ge-0/0/%d']/", i))
+	}
+	return Script{SystemID: "jtimon-simulator", Sensors: []Sensor{s}}
+}
+
+func (s Script) validate() error {
+	if len(s.Sensors) == 0 {
+		return fmt.Errorf("the script has no sensors")
+	}
+	for _, sensor := range s.Sensors {
+		if sensor.Path == "" {
+			return fmt.Errorf("a sensor has no path")
+		}
+		for _, f := range sensor.Fields {
+			switch f.Value.(type) {
+			case string, bool, float64, int:
+			default:
+				return fmt.Errorf("field %s of sensor %s: value %v is not a string, bool or number", f.Key, sensor.Path, f.Value)
+			}
+		}
+	}
+	f := s.Faults
+	if f.Drop < 0 || f.Malformed < 0 || f.Drop+f.Malformed > 1 {
+		return fmt.Errorf("the drop and malformed fractions must be between 0 and 1")
+	}
+	if f.DisconnectAfter < 0 || f.Reject < 0 {
+		return fmt.Errorf("disconnect-after and reject can not be negative")
+	}
+	return nil
+}
+
+// Server is a simulated device
+type Server struct {
+	script Script
+	lis    net.Listener
+	grpc   *grpc.Server
+
+	mu    sync.Mutex
+	rand  *rand.Rand
+	stats Stats
+}
+
+// Start serves the script on addr, 127.0.0.1:0 picks a free port
+func Start(addr string, script Script) (*Server, error) {
+	if err := script.validate(); err != nil {
+		return nil, err
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		script: script,
+		lis:    lis,
+		grpc:   grpc.NewServer(grpc.CustomCodec(codec{})),
+		rand:   rand.New(rand.NewSource(script.Faults.Seed)),
+	}
+	na_pb.RegisterOpenConfigTelemetryServer(s.grpc, s)
+	auth_pb.RegisterLoginServer(s.grpc, s)
+	go s.grpc.Serve(lis)
+	return s, nil
+}
+
+// Addr is the address the device listens on
+func (s *Server) Addr() string {
+	return s.lis.Addr().String()
+}
+
+// Stop closes the streams and the listener
+func (s *Server) Stop() {
+	s.grpc.Stop()
+}
+
+// Stats returns the counters of the device
+func (s *Server) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// LoginCheck accepts the credentials of the script
+func (s *Server) LoginCheck(ctx context.Context, req *auth_pb.LoginRequest) (*auth_pb.LoginReply, error) {
+	ok := s.script.User == "" || req.UserName == s.script.User && req.Password == s.script.Password
+	if ok {
+		s.mu.Lock()
+		s.stats.Logins++
+		s.mu.Unlock()
+	}
+	return &auth_pb.LoginReply{Result: ok}, nil
+}
+
+// subscription is a sensor streamed to a subscription
+type subscription struct {
+	sensor   *Sensor
+	interval time.Duration
+	next     time.Time
+	seq      uint64
+	updates  uint64
+}
+
+// TelemetrySubscribe streams the sensors of the paths of the request
+func (s *Server) TelemetrySubscribe(req *na_pb.SubscriptionRequest, stream na_pb.OpenConfigTelemetry_TelemetrySubscribeServer) error {
+	s.mu.Lock()
+	s.stats.Subscriptions++
+	reject := s.stats.Subscriptions <= uint64(s.script.Faults.Reject)
+	if reject {
+		s.stats.Rejected++
+	}
+	s.mu.Unlock()
+	if reject {
+		return status.Error(codes.Unavailable, "simulated rejection")
+	}
+
+	var subs []*subscription
+	now := time.Now()
+	for _, p := range req.PathList {
+		interval := time.Duration(p.SampleFrequency) * time.Millisecond
+		if interval == 0 {
+			interval = DefaultInterval
+		}
+		for i := range s.script.Sensors {
+			if matches(s.script.Sensors[i].Path, p.Path) {
+				subs = append(subs, &subscription{sensor: &s.script.Sensors[i], interval: interval, next: now})
+			}
+		}
+	}
+	if len(subs) == 0 {
+		return status.Error(codes.InvalidArgument, "no sensor of the paths")
+	}
+
+	sent := 0
+	for {
+		sub := subs[0]
+		for _, other := range subs[1:] {
+			if other.next.Before(sub.next) {
+				sub = other
+			}
+		}
+		timer := time.NewTimer(time.Until(sub.next))
+		select {
+		case <-stream.Context().Done():
+			timer.Stop()
+			return stream.Context().Err()
+		case <-timer.C:
+		}
+		sub.next = sub.next.Add(sub.interval)
+
+		for _, m := range s.update(sub) {
+			if m == nil {
+				continue
+			}
+			if err := stream.SendMsg(m); err != nil {
+				return err
+			}
+			sent++
+			if s.script.Faults.DisconnectAfter != 0 && sent >= s.script.Faults.DisconnectAfter {
+				s.mu.Lock()
+				s.stats.Disconnects++
+				s.mu.Unlock()
+				return status.Error(codes.Unavailable, "simulated disconnect")
+			}
+		}
+	}
+}
+
+// update returns the messages of the next update of the subscription, nil
+// for the dropped ones
+func (s *Server) update(sub *subscription) []interface{} {
+	sensor := sub.sensor
+	name := sensor.Name
+	if name == "" {
+		name = "sensor_1000"
+	}
+	prefixes := sensor.Prefixes
+	if len(prefixes) == 0 {
+		prefixes = []string{""}
+	}
+	ts := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+
+	var msgs []interface{}
+	for _, prefix := range prefixes {
+		sub.seq++
+		m := &na_pb.OpenConfigData{
+			SystemId:       s.script.SystemID,
+			ComponentId:    sensor.ComponentID,
+			Path:           fmt.Sprintf("%s:%s:%s:PFE", name, sensor.Path, sensor.Path),
+			SequenceNumber: sub.seq,
+			Timestamp:      ts,
+		}
+		if prefix != "" {
+			m.Kv = append(m.Kv, &na_pb.KeyValue{Key: "__prefix__", Value: &na_pb.KeyValue_StrValue{StrValue: prefix}})
+		}
+		for _, f := range sensor.Fields {
+			m.Kv = append(m.Kv, keyValue(f, sub.updates))
+		}
+
+		s.mu.Lock()
+		r := s.rand.Float64()
+		switch {
+		case r < s.script.Faults.Drop:
+			s.stats.Dropped++
+			msgs = append(msgs, nil)
+		case r < s.script.Faults.Drop+s.script.Faults.Malformed:
+			s.stats.Malformed++
+			msgs = append(msgs, malformed{})
+		default:
+			s.stats.Messages++
+			msgs = append(msgs, m)
+		}
+		s.mu.Unlock()
+	}
+	sub.updates++
+	return msgs
+}
+
+// keyValue is the field at the n-th update, the whole numbers are uint or
+// int values
+func keyValue(f Field, n uint64) *na_pb.KeyValue {
+	kv := &na_pb.KeyValue{Key: f.Key}
+	var x float64
+	switch v := f.Value.(type) {
+	case string:
+		kv.Value = &na_pb.KeyValue_StrValue{StrValue: v}
+		return kv
+	case bool:
+		kv.Value = &na_pb.KeyValue_BoolValue{BoolValue: v}
+		return kv
+	case int:
+		x = float64(v)
+	case float64:
+		x = v
+	}
+	x += f.Step * float64(n)
+	switch {
+	case x != math.Trunc(x):
+		kv.Value = &na_pb.KeyValue_DoubleValue{DoubleValue: x}
+	case x < 0:
+		kv.Value = &na_pb.KeyValue_IntValue{IntValue: int64(x)}
+	default:
+		kv.Value = &na_pb.KeyValue_UintValue{UintValue: uint64(x)}
+	}
+	return kv
+}
+
+// matches tells whether the sensor of path streams to a subscription of
+// sub, one is under the other
+func matches(path, sub string) bool {
+	path, sub = strings.TrimSuffix(path, "/")+"/", strings.TrimSuffix(sub, "/")+"/"
+	return strings.HasPrefix(path, sub) || strings.HasPrefix(sub, path)
+}
+
+// CancelTelemetrySubscription is not simulated
+func (s *Server) CancelTelemetrySubscription(context.Context, *na_pb.CancelSubscriptionRequest) (*na_pb.CancelSubscriptionReply, error) {
+	return nil, status.Error(codes.Unimplemented, "not simulated")
+}
+
+// GetTelemetrySubscriptions is not simulated
+func (s *Server) GetTelemetrySubscriptions(context.Context, *na_pb.GetSubscriptionsRequest) (*na_pb.GetSubscriptionsReply, error) {
+	return nil, status.Error(codes.Unimplemented, "not simulated")
+}
+
+// GetTelemetryOperationalState is not simulated
+func (s *Server) GetTelemetryOperationalState(context.Context, *na_pb.GetOperationalStateRequest) (*na_pb.GetOperationalStateReply, error) {
+	return nil, status.Error(codes.Unimplemented, "not simulated")
+}
+
+// GetDataEncodings is not simulated
+func (s *Server) GetDataEncodings(context.Context, *na_pb.DataEncodingRequest) (*na_pb.DataEncodingReply, error) {
+	return nil, status.Error(codes.Unimplemented, "not simulated")
+}
+
+// malformed is a message which is not one, a length delimited field cut
+// short
+type malformed struct{}
+
+// codec is the proto codec of gRPC which also sends malformed messages
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	if _, ok := v.(malformed); ok {
+		return []byte{0x0a, 0xff, 0x01}, nil
+	}
+	return proto.Marshal(v.(proto.Message))
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	return proto.Unmarshal(data, v.(proto.Message))
+}
+
+func (codec) String() string {
+	return "proto"
+}
@@ -0,0 +1,205 @@
+package simulator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	auth_pb "github.com/nileshsimaria/jtimon/authentication"
+	na_pb "github.com/nileshsimaria/jtimon/telemetry"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// subscribe returns the stream of the subscription of path to the device
+func subscribe(t *testing.T, s *Server, path string) (na_pb.OpenConfigTelemetry_TelemetrySubscribeClient, func()) {
+	conn, err := grpc.Dial(s.Addr(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	stream, err := na_pb.NewOpenConfigTelemetryClient(conn).TelemetrySubscribe(ctx, &na_pb.SubscriptionRequest{
+		PathList: []*na_pb.Path{{Path: path, SampleFrequency: 10}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stream, func() {
+		cancel()
+		conn.Close()
+	}
+}
+
+func TestSimulator(t *testing.T) {
+	s, err := Start("127.0.0.1:0", DefaultScript())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	stream, stop := subscribe(t, s, "/interfaces")
+	defer stop()
+
+	for i := 0; i < 8; i++ {
+		m, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.SystemId != "jtimon-simulator" || m.Path != "sensor_1000:/interfaces/:/interfaces/:PFE" || m.SequenceNumber != uint64(i+1) {
+			t.Errorf("got %v", m)
+		}
+		if len(m.Kv) != 6 || m.Kv[0].Key != "__prefix__" || m.Kv[0].GetStrValue() != DefaultScript().Sensors[0].Prefixes[i%4] {
+			t.Errorf("got %v", m.Kv)
+		}
+		// the counters go up at each update
+		if got, want := m.Kv[2].GetUintValue(), uint64(i/4)*125000; got != want {
+			t.Errorf("%s %d, want %d", m.Kv[2].Key, got, want)
+		}
+	}
+	if got := s.Stats(); got.Subscriptions != 1 || got.Messages < 8 {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestSimulatorFaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		faults Faults
+		path   string
+		code   codes.Code
+		recv   int
+		stats  func(Stats) bool
+	}{
+		{name: "disconnect", faults: Faults{DisconnectAfter: 3}, code: codes.Unavailable, recv: 3,
+			stats: func(s Stats) bool { return s.Disconnects == 1 }},
+		{name: "malformed", faults: Faults{Malformed: 1}, code: codes.Internal,
+			stats: func(s Stats) bool { return s.Malformed >= 1 && s.Messages == 0 }},
+		{name: "reject", faults: Faults{Reject: 1}, code: codes.Unavailable,
+			stats: func(s Stats) bool { return s.Rejected == 1 }},
+		{name: "no sensor", path: "/bgp", code: codes.InvalidArgument},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			script := DefaultScript()
+			script.Faults = test.faults
+			s, err := Start("127.0.0.1:0", script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Stop()
+			path := test.path
+			if path == "" {
+				path = "/interfaces/"
+			}
+			stream, stop := subscribe(t, s, path)
+			defer stop()
+			n := 0
+			for {
+				_, err := stream.Recv()
+				if err != nil {
+					if status.Code(err) != test.code {
+						t.Errorf("got %v, want %v", err, test.code)
+					}
+					break
+				}
+				n++
+			}
+			if n != test.recv {
+				t.Errorf("received %d messages, want %d", n, test.recv)
+			}
+			if test.stats != nil && !test.stats(s.Stats()) {
+				t.Errorf("got %+v", s.Stats())
+			}
+		})
+	}
+
+	// the sequence numbers of the dropped messages are skipped
+	script := DefaultScript()
+	script.Faults = Faults{Drop: 0.5, Seed: 1}
+	s, err := Start("127.0.0.1:0", script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	stream, stop := subscribe(t, s, "/interfaces/")
+	defer stop()
+	last := uint64(0)
+	for i := 0; i < 20; i++ {
+		m, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = m.SequenceNumber
+	}
+	if last <= 20 {
+		t.Errorf("no gaps in the sequence numbers, last %d", last)
+	}
+	if s.Stats().Dropped == 0 {
+		t.Errorf("got %+v", s.Stats())
+	}
+}
+
+func TestSimulatorLogin(t *testing.T) {
+	script := DefaultScript()
+	script.User, script.Password = "jtimon", "secret"
+	s, err := Start("127.0.0.1:0", script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	conn, err := grpc.Dial(s.Addr(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, test := range []struct {
+		user, password string
+		ok             bool
+	}{
+		{"jtimon", "secret", true},
+		{"jtimon", "wrong", false},
+	} {
+		reply, err := auth_pb.NewLoginClient(conn).LoginCheck(context.Background(), &auth_pb.LoginRequest{UserName: test.user, Password: test.password})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply.Result != test.ok {
+			t.Errorf("%s/%s: got %v", test.user, test.password, reply.Result)
+		}
+	}
+	if s.Stats().Logins != 1 {
+		t.Errorf("got %+v", s.Stats())
+	}
+}
+
+func TestLoadScript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-simulator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tests := []struct {
+		name   string
+		script string
+		ok     bool
+	}{
+		{name: "valid", script: `{"sensors": [{"path": "/bgp/", "fields": [{"key": "state/up", "value": true}, {"key": "count", "value": 1, "step": 1}]}], "faults": {"drop": 0.1}}`, ok: true},
+		{name: "no sensors", script: `{}`},
+		{name: "no path", script: `{"sensors": [{}]}`},
+		{name: "invalid value", script: `{"sensors": [{"path": "/bgp/", "fields": [{"key": "k", "value": [1]}]}]}`},
+		{name: "fractions", script: `{"sensors": [{"path": "/bgp/"}], "faults": {"drop": 0.6, "malformed": 0.6}}`},
+		{name: "not json", script: `{`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(dir, "script.json")
+			ioutil.WriteFile(file, []byte(test.script), 0600)
+			if _, err := LoadScript(file); (err == nil) != test.ok {
+				t.Errorf("got %v", err)
+			}
+		})
+	}
+}
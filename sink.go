@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// point is one decoded data point as it is handed over to the sinks.
+// Fields are exported so that key templates can refer to them,
+// e.g. {{.Measurement}} or {{.Tags.device}}
+type point struct {
+	Measurement string                 `json:"measurement"`
+	Tags        map[string]string      `json:"tags"`
+	Fields      map[string]interface{} `json:"fields"`
+	Timestamp   time.Time              `json:"timestamp"`
+}
+
+func newPoint(measurement string, tags map[string]string, fields map[string]interface{}, t time.Time) *point {
+	return &point{
+		Measurement: measurement,
+		Tags:        tags,
+		Fields:      fields,
+		Timestamp:   t,
+	}
+}
+
+// BatchConfig is the batching config shared by all of the sinks
+type BatchConfig struct {
+	BatchSize      int `json:"batchsize"`
+	BatchFrequency int `json:"batchfrequency"`
+}
+
+// sinkWriter is the connection of one worker to one sink
+type sinkWriter interface {
+	write(points []*point) error
+	close()
+}
+
+// sink is an output for decoded telemetry other than InfluxDB and
+// Prometheus. open returns nil sinkWriter if the sink is not configured.
+type sink struct {
+	name string
+	open func(*JCtx) (sinkWriter, BatchConfig, error)
+}
+
+var sinks = []*sink{
+	newAMQPSink(),
+	newRedisSink(),
+	newPubSubSink(),
+	newKinesisSink(),
+	newTimestreamSink(),
+	newEventHubsSink(),
+	newSplunkSink(),
+	newVictoriaMetricsSink(),
+	newLokiSink(),
+	newSNMPTrapSink(),
+	newSyslogSink(),
+	newAlertSink(),
+}
+
+// sinkCtx is run time info of one sink of the worker
+type sinkCtx struct {
+	timer writeTimer
+	name  string
+	ch    chan *point
+	w     sinkWriter
+	spool *spool
+	task  *schedTask
+}
+
+func sinksInit(jctx *JCtx) {
+	for _, s := range sinks {
+		w, bc, err := s.open(jctx)
+		if err != nil {
+			jLogError(jctx, "", fmt.Sprintf("%s sink init failed", s.name), err)
+			continue
+		}
+		if w == nil {
+			continue
+		}
+		if bc.BatchSize == 0 {
+			bc.BatchSize = DefaultSinkBatchSize
+		}
+		if bc.BatchFrequency == 0 {
+			bc.BatchFrequency = DefaultSinkBatchFreq
+		}
+
+		sctx := &sinkCtx{
+			name: s.name,
+			ch:   make(chan *point, bc.BatchSize),
+			w:    w,
+		}
+		if jctx.config.Spool.Dir != "" {
+			if sctx.spool, err = newSpool(spoolDir(jctx, s.name), jctx.config.Spool); err != nil {
+				jLogError(jctx, "", fmt.Sprintf("%s sink spool init failed", s.name), err)
+			}
+		}
+		jctx.sinks = append(jctx.sinks, sctx)
+		sinkBatchWrite(jctx, sctx, bc)
+		jLog(jctx, fmt.Sprintf("Successfully initialized %s sink", s.name))
+	}
+}
+
+// wake up periodically and write whatever is accumulated into the sink
+func sinkBatchWrite(jctx *JCtx, sctx *sinkCtx, bc BatchConfig) {
+	jLog(jctx, fmt.Sprintln(sctx.name, "batch size:", bc.BatchSize, "batch frequency:", bc.BatchFrequency))
+
+	sctx.task = schedule(time.Duration(bc.BatchFrequency)*time.Millisecond, func() {
+		// while the spooled batches can't be written the new ones are
+		// spooled behind them
+		spooling := sctx.spool != nil && !spoolWrite(jctx, sctx)
+		n := len(sctx.ch)
+		for n > 0 {
+			size := n
+			if size > bc.BatchSize {
+				size = bc.BatchSize
+			}
+			points := make([]*point, 0, size)
+			for i := 0; i < size; i++ {
+				// the oldest points may be dropped meanwhile
+				select {
+				case p := <-sctx.ch:
+					points = append(points, p)
+				default:
+					n = size
+				}
+			}
+			n -= size
+			if len(points) == 0 {
+				break
+			}
+
+			if spooling {
+				spoolPush(jctx, sctx, points)
+				continue
+			}
+			start := time.Now()
+			err := sctx.w.write(points)
+			sctx.timer.observe(start)
+			setFailing(&sctx.timer.failing, err)
+			if err != nil {
+				jLogError(jctx, "", fmt.Sprintf("Batch write to %s failed", sctx.name), err)
+				if sctx.spool != nil {
+					spoolPush(jctx, sctx, points)
+					spooling = true
+				}
+			} else if IsVerboseLogging(jctx) {
+				jLogDebug(jctx, fmt.Sprintf("Batch write to %s successful! Number of points: %d", sctx.name, len(points)))
+			}
+		}
+	})
+}
+
+func writeSinks(jctx *JCtx, points []*point) {
+	for _, s := range jctx.sinks {
+		writeSink(jctx, s, points)
+	}
+}
+
+func writeSink(jctx *JCtx, s *sinkCtx, points []*point) {
+	policy := backpressurePolicy(jctx)
+	for _, p := range points {
+		dropped := enqueue(policy, func() bool {
+			select {
+			case s.ch <- p:
+				return true
+			default:
+				return false
+			}
+		}, func() {
+			s.ch <- p
+		}, func() bool {
+			select {
+			case <-s.ch:
+				return true
+			default:
+				return false
+			}
+		})
+		jctx.drops.add("sink/"+s.name, dropped)
+	}
+}
+
+// newKeyTemplate parses templates used by the sinks to derive routing keys,
+// stream names, partition keys etc,. from the point
+func newKeyTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template %q: %v", name, text, err)
+	}
+	return t, nil
+}
+
+func execKeyTemplate(t *template.Template, p *point) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, p); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// sinkHTTPDo performs the request of HTTP based sinks, anything but 2xx is an error
+func sinkHTTPDo(c *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if len(body) > 512 {
+			body = body[:512]
+		}
+		return nil, fmt.Errorf("%s %s: %s: %s", req.Method, req.URL, resp.Status, bytes.TrimSpace(body))
+	}
+	return body, nil
+}
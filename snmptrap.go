@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// SNMPTrapConfig is the config of the SNMP trap translation. Every update
+// selected by one of the rules is sent as SNMPv2c trap to target.
+type SNMPTrapConfig struct {
+	Target    string         `json:"target"`
+	Community string         `json:"community"`
+	Rules     []SNMPTrapRule `json:"rules"`
+	BatchConfig
+}
+
+// SNMPTrapRule maps selected updates to a trap
+type SNMPTrapRule struct {
+	UpdateRule
+	TrapOID  string        `json:"trap-oid"`
+	VarBinds []SNMPVarBind `json:"varbinds"`
+}
+
+// SNMPVarBind is a variable binding of the trap, value is a Go template
+// evaluated per update and type is one of string, integer, gauge, counter64
+type SNMPVarBind struct {
+	OID   string `json:"oid"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// ASN.1 BER and SNMP tags
+const (
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berOID         = 0x06
+	berSequence    = 0x30
+	snmpGauge32    = 0x42
+	snmpTimeTicks  = 0x43
+	snmpCounter64  = 0x46
+	snmpV2Trap     = 0xa7
+	snmpVersion2c  = 1
+)
+
+var (
+	snmpSysUpTimeOID = "1.3.6.1.2.1.1.3.0"
+	snmpTrapOIDOID   = "1.3.6.1.6.3.1.1.4.1.0"
+	snmpStartTime    = time.Now()
+)
+
+type snmpVarBind struct {
+	oid   []byte
+	tag   byte
+	value *template.Template
+}
+
+type snmpTrapRule struct {
+	*updateRule
+	trapOID  []byte
+	varBinds []snmpVarBind
+}
+
+type snmpTrapSink struct {
+	community string
+	rules     []*snmpTrapRule
+	conn      net.Conn
+	requestID int32
+}
+
+func newSNMPTrapSink() *sink {
+	return &sink{
+		name: "snmp-trap",
+		open: openSNMPTrapSink,
+	}
+}
+
+func openSNMPTrapSink(jctx *JCtx) (sinkWriter, BatchConfig, error) {
+	cfg := jctx.config.SNMPTrap
+	if cfg.Target == "" {
+		return nil, cfg.BatchConfig, nil
+	}
+	if len(cfg.Rules) == 0 {
+		return nil, cfg.BatchConfig, fmt.Errorf("snmp-trap needs at least one rule")
+	}
+
+	s := &snmpTrapSink{community: cfg.Community}
+	if s.community == "" {
+		s.community = DefaultSNMPCommunity
+	}
+
+	for i, r := range cfg.Rules {
+		u, err := newUpdateRule(r.UpdateRule)
+		if err != nil {
+			return nil, cfg.BatchConfig, err
+		}
+		rule := &snmpTrapRule{updateRule: u}
+		if rule.trapOID, err = berEncodeOID(r.TrapOID); err != nil {
+			return nil, cfg.BatchConfig, fmt.Errorf("snmp-trap rule %d: trap-oid: %v", i, err)
+		}
+		for _, vb := range r.VarBinds {
+			oid, err := berEncodeOID(vb.OID)
+			if err != nil {
+				return nil, cfg.BatchConfig, fmt.Errorf("snmp-trap rule %d: %v", i, err)
+			}
+			var tag byte
+			switch vb.Type {
+			case "", "string":
+				tag = berOctetString
+			case "integer":
+				tag = berInteger
+			case "gauge":
+				tag = snmpGauge32
+			case "counter64":
+				tag = snmpCounter64
+			default:
+				return nil, cfg.BatchConfig, fmt.Errorf("snmp-trap rule %d: unknown varbind type %q", i, vb.Type)
+			}
+			t, err := newKeyTemplate("varbind "+vb.OID, vb.Value)
+			if err != nil {
+				return nil, cfg.BatchConfig, err
+			}
+			rule.varBinds = append(rule.varBinds, snmpVarBind{oid: oid, tag: tag, value: t})
+		}
+		s.rules = append(s.rules, rule)
+	}
+
+	target := cfg.Target
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		target = net.JoinHostPort(target, strconv.Itoa(DefaultSNMPTrapPort))
+	}
+	conn, err := net.Dial("udp", target)
+	if err != nil {
+		return nil, cfg.BatchConfig, err
+	}
+	s.conn = conn
+	return s, cfg.BatchConfig, nil
+}
+
+func berLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+func berTLV(tag byte, value []byte) []byte {
+	b := append([]byte{tag}, berLength(len(value))...)
+	return append(b, value...)
+}
+
+// berInt is the minimal two's complement encoding of v
+func berInt(v int64) []byte {
+	b := []byte{byte(v)}
+	for v > 127 || v < -128 {
+		v >>= 8
+		b = append([]byte{byte(v)}, b...)
+	}
+	return b
+}
+
+// berUint is the minimal encoding of unsigned v
+func berUint(v uint64) []byte {
+	b := []byte{byte(v)}
+	for v >>= 8; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	if b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return b
+}
+
+func berEncodeOID(oid string) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(oid, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid OID %q", oid)
+	}
+	arcs := make([]uint64, len(parts))
+	for i, p := range parts {
+		v, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %q", oid)
+		}
+		arcs[i] = v
+	}
+	if arcs[0] > 2 || (arcs[0] < 2 && arcs[1] > 39) {
+		return nil, fmt.Errorf("invalid OID %q", oid)
+	}
+
+	var b []byte
+	arcs = append([]uint64{arcs[0]*40 + arcs[1]}, arcs[2:]...)
+	for _, a := range arcs {
+		enc := []byte{byte(a & 0x7f)}
+		for a >>= 7; a > 0; a >>= 7 {
+			enc = append([]byte{byte(a&0x7f) | 0x80}, enc...)
+		}
+		b = append(b, enc...)
+	}
+	return berTLV(berOID, b), nil
+}
+
+func berVarBind(oid []byte, value []byte) []byte {
+	return berTLV(berSequence, append(append([]byte{}, oid...), value...))
+}
+
+// snmpValue encodes the rendered varbind value as tag
+func snmpValue(tag byte, v string) ([]byte, error) {
+	switch tag {
+	case berInteger:
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		return berTLV(tag, berInt(n)), nil
+	case snmpGauge32:
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		return berTLV(tag, berUint(n)), nil
+	case snmpCounter64:
+		n, ok := new(big.Int).SetString(v, 10)
+		if !ok || !n.IsUint64() {
+			return nil, fmt.Errorf("invalid counter64 %q", v)
+		}
+		return berTLV(tag, berUint(n.Uint64())), nil
+	}
+	return berTLV(berOctetString, []byte(v)), nil
+}
+
+func (s *snmpTrapSink) trap(rule *snmpTrapRule, e *updateEvent) ([]byte, error) {
+	uptime := uint64(time.Since(snmpStartTime) / (10 * time.Millisecond))
+	sysUpTime, _ := berEncodeOID(snmpSysUpTimeOID)
+	trapOID, _ := berEncodeOID(snmpTrapOIDOID)
+
+	vbs := berVarBind(sysUpTime, berTLV(snmpTimeTicks, berUint(uptime&0xffffffff)))
+	vbs = append(vbs, berVarBind(trapOID, rule.trapOID)...)
+	for _, vb := range rule.varBinds {
+		v, err := execEventTemplate(vb.value, e)
+		if err != nil {
+			return nil, err
+		}
+		value, err := snmpValue(vb.tag, v)
+		if err != nil {
+			return nil, fmt.Errorf("varbind value %q: %v", v, err)
+		}
+		vbs = append(vbs, berVarBind(vb.oid, value)...)
+	}
+
+	s.requestID++
+	pdu := berTLV(berInteger, berInt(int64(s.requestID)))
+	pdu = append(pdu, berTLV(berInteger, []byte{0})...)
+	pdu = append(pdu, berTLV(berInteger, []byte{0})...)
+	pdu = append(pdu, berTLV(berSequence, vbs)...)
+
+	msg := berTLV(berInteger, berInt(snmpVersion2c))
+	msg = append(msg, berTLV(berOctetString, []byte(s.community))...)
+	msg = append(msg, berTLV(snmpV2Trap, pdu)...)
+	return berTLV(berSequence, msg), nil
+}
+
+func (s *snmpTrapSink) write(points []*point) error {
+	var errs []string
+	for _, p := range points {
+		for _, rule := range s.rules {
+			for _, e := range rule.match(p) {
+				b, err := s.trap(rule, e)
+				if err == nil {
+					_, err = s.conn.Write(b)
+				}
+				if err != nil {
+					errs = append(errs, err.Error())
+				}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d traps failed: %s", len(errs), errs[0])
+	}
+	return nil
+}
+
+func (s *snmpTrapSink) close() {
+	s.conn.Close()
+}
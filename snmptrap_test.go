@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBEREncoding(t *testing.T) {
+	oid, err := berEncodeOID("1.3.6.1.2.1.1.3.0")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	tests := []struct {
+		name string
+		got  []byte
+		want []byte
+	}{
+		{"oid", oid, []byte{0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x03, 0x00}},
+		{"int-128", berInt(128), []byte{0x00, 0x80}},
+		{"int-minus-129", berInt(-129), []byte{0xff, 0x7f}},
+		{"int-zero", berInt(0), []byte{0x00}},
+		{"uint-128", berUint(128), []byte{0x00, 0x80}},
+		{"uint-max", berUint(1<<64 - 1), []byte{0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{"length-short", berLength(127), []byte{0x7f}},
+		{"length-long", berLength(300), []byte{0x82, 0x01, 0x2c}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !bytes.Equal(test.got, test.want) {
+				t.Errorf("want % x, got % x", test.want, test.got)
+			}
+		})
+	}
+
+	for _, bad := range []string{"1", "1.x.3", "3.1", "1.40"} {
+		if _, err := berEncodeOID(bad); err == nil {
+			t.Errorf("want error for OID %q, got nil", bad)
+		}
+	}
+}
+
+func TestSNMPTrapSink(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer pc.Close()
+
+	jctx := &JCtx{}
+	jctx.config.SNMPTrap = SNMPTrapConfig{
+		Target:    pc.LocalAddr().String(),
+		Community: "noc",
+		Rules: []SNMPTrapRule{{
+			UpdateRule: UpdateRule{Field: "oper-status$", Value: "DOWN", OnChange: true},
+			TrapOID:    "1.3.6.1.6.3.1.1.5.3",
+			VarBinds: []SNMPVarBind{
+				{OID: "1.3.6.1.2.1.2.2.1.2", Value: "{{.Tags.device}} {{index .Tags \"interface-name\"}}"},
+				{OID: "1.3.6.1.2.1.2.2.1.8", Type: "integer", Value: "2"},
+			},
+		}},
+	}
+	w, _, err := openSNMPTrapSink(jctx)
+	if err != nil {
+		t.Fatalf("openSNMPTrapSink failed: %v", err)
+	}
+	defer w.close()
+
+	status := func(s string) *point {
+		return newPoint("ifd", map[string]string{"device": "r1", "interface-name": "et-0/0/0"},
+			map[string]interface{}{"/oper-status": s}, time.Unix(1, 0))
+	}
+	if err := w.write([]*point{status("UP"), status("UP"), status("DOWN")}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1500)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("no trap received: %v", err)
+	}
+	trap := buf[:n]
+
+	trapOID, _ := berEncodeOID("1.3.6.1.6.3.1.1.5.3")
+	for _, want := range [][]byte{
+		{0x30},             // message sequence
+		{0x02, 0x01, 0x01}, // version 2c
+		berTLV(berOctetString, []byte("noc")),
+		trapOID,
+		berTLV(berOctetString, []byte("r1 et-0/0/0")),
+		berTLV(berInteger, []byte{0x02}),
+	} {
+		if !bytes.Contains(trap, want) {
+			t.Errorf("trap % x does not contain % x", trap, want)
+		}
+	}
+	if trap[1] != byte(n-2) {
+		t.Errorf("message length: want %d, got %d", n-2, trap[1])
+	}
+
+	// only the transition to DOWN is a trap
+	pc.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, _, err := pc.ReadFrom(buf); err == nil {
+		t.Errorf("want exactly one trap")
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nileshsimaria/jtimon/spiffe"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// spiffeWait is how long a connect waits for the first SVID of the
+	// Workload API
+	spiffeWait = 30 * time.Second
+	// spiffeRetry is the delay of the fetches of the SVIDs after an error
+	spiffeRetry = 5 * time.Second
+)
+
+// spiffeEndpoint is the socket of the SPIFFE Workload API, --spiffe-socket
+// or SPIFFE_ENDPOINT_SOCKET
+func spiffeEndpoint() string {
+	if *spiffeSocket != "" {
+		return *spiffeSocket
+	}
+	return os.Getenv("SPIFFE_ENDPOINT_SOCKET")
+}
+
+// svidSource keeps the X.509-SVID of jtimon up to date from the Workload
+// API, the agent streams a new one each time it is rotated
+type svidSource struct {
+	socket string
+	cancel context.CancelFunc
+	ready  chan struct{}
+	sync.Mutex
+	cert  *tls.Certificate
+	roots *x509.CertPool
+	id    string
+}
+
+var (
+	svidsMu sync.Mutex
+	// svids is the SVID source of the devices with spiffe, it is started by
+	// the first one
+	svids *svidSource
+)
+
+// spiffeSource returns the SVID source, started on the first call
+func spiffeSource() *svidSource {
+	svidsMu.Lock()
+	defer svidsMu.Unlock()
+	if svids == nil {
+		svids = newSVIDSource(spiffeEndpoint())
+	}
+	return svids
+}
+
+func newSVIDSource(socket string) *svidSource {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &svidSource{socket: strings.TrimPrefix(socket, "unix://"), cancel: cancel, ready: make(chan struct{})}
+	go s.watch(ctx)
+	return s
+}
+
+func (s *svidSource) stop() {
+	s.cancel()
+}
+
+func (s *svidSource) watch(ctx context.Context) {
+	for {
+		err := s.fetch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("SPIFFE Workload API %s: %v, retrying in %v", s.socket, err, spiffeRetry)
+		select {
+		case <-time.After(spiffeRetry):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *svidSource) fetch(ctx context.Context) error {
+	conn, err := grpc.Dial(s.socket, grpc.WithInsecure(), grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+		return net.DialTimeout("unix", addr, timeout)
+	}))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	ctx = metadata.NewOutgoingContext(ctx, metadata.Pairs("workload.spiffe.io", "true"))
+	stream, err := spiffe.NewSpiffeWorkloadAPIClient(conn).FetchX509SVID(ctx, &spiffe.X509SVIDRequest{})
+	if err != nil {
+		return err
+	}
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if err := s.update(resp); err != nil {
+			log.Printf("SPIFFE Workload API %s: %v", s.socket, err)
+		}
+	}
+}
+
+// update takes the default SVID of the response
+func (s *svidSource) update(resp *spiffe.X509SVIDResponse) error {
+	if len(resp.Svids) == 0 {
+		return fmt.Errorf("no SVID")
+	}
+	svid := resp.Svids[0]
+	certs, err := x509.ParseCertificates(svid.X509Svid)
+	if err != nil || len(certs) == 0 {
+		return fmt.Errorf("invalid SVID %s: %v", svid.SpiffeId, err)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(svid.X509SvidKey)
+	if err != nil {
+		return fmt.Errorf("invalid key of SVID %s: %v", svid.SpiffeId, err)
+	}
+	bundle, err := x509.ParseCertificates(svid.Bundle)
+	if err != nil {
+		return fmt.Errorf("invalid bundle of SVID %s: %v", svid.SpiffeId, err)
+	}
+	cert := &tls.Certificate{PrivateKey: key, Leaf: certs[0]}
+	for _, c := range certs {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+	roots := x509.NewCertPool()
+	for _, c := range bundle {
+		roots.AddCert(c)
+	}
+
+	s.Lock()
+	first := s.cert == nil
+	old, oldID := s.cert, s.id
+	s.cert, s.roots, s.id = cert, roots, svid.SpiffeId
+	s.Unlock()
+	if first {
+		close(s.ready)
+	} else {
+		auditRotation("", "spiffe", svidSummary(oldID, old), svidSummary(svid.SpiffeId, cert))
+	}
+	log.Printf("SPIFFE SVID %s, valid until %v", svid.SpiffeId, certs[0].NotAfter)
+	return nil
+}
+
+// svidSummary is the SVID in the audit records
+func svidSummary(id string, cert *tls.Certificate) map[string]string {
+	return map[string]string{"id": id, "serial": cert.Leaf.SerialNumber.String(), "not-after": cert.Leaf.NotAfter.UTC().Format(time.RFC3339)}
+}
+
+// get returns the current SVID and the CAs of the trust domain, it waits up
+// to timeout for the first one
+func (s *svidSource) get(timeout time.Duration) (*tls.Certificate, *x509.CertPool, error) {
+	select {
+	case <-s.ready:
+	case <-time.After(timeout):
+		return nil, nil, fmt.Errorf("no SPIFFE SVID from %s within %v", s.socket, timeout)
+	}
+	s.Lock()
+	defer s.Unlock()
+	return s.cert, s.roots, nil
+}
+
+// spiffeTLS makes t present the SVID of jtimon, the current one at each
+// handshake, and verify the device with the CAs of the trust domain unless
+// the TLS config has a ca
+func spiffeTLS(cfg TLSConfig, t *tls.Config) error {
+	s := spiffeSource()
+	_, roots, err := s.get(spiffeWait)
+	if err != nil {
+		return err
+	}
+	t.Certificates = nil
+	t.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		cert, _, err := s.get(spiffeWait)
+		return cert, err
+	}
+	if cfg.CA == "" {
+		t.RootCAs = roots
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: workload.proto
+
+/*
+Package spiffe is a generated protocol buffer package.
+
+It is generated from these files:
+
+	workload.proto
+
+It has these top-level messages:
+
+	X509SVIDRequest
+	X509SVIDResponse
+	X509SVID
+*/
+package spiffe
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type X509SVIDRequest struct {
+}
+
+func (m *X509SVIDRequest) Reset()                    { *m = X509SVIDRequest{} }
+func (m *X509SVIDRequest) String() string            { return proto.CompactTextString(m) }
+func (*X509SVIDRequest) ProtoMessage()               {}
+func (*X509SVIDRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+type X509SVIDResponse struct {
+	// svids are the identities of the workload, the first one is the default
+	Svids []*X509SVID `protobuf:"bytes,1,rep,name=svids" json:"svids,omitempty"`
+}
+
+func (m *X509SVIDResponse) Reset()                    { *m = X509SVIDResponse{} }
+func (m *X509SVIDResponse) String() string            { return proto.CompactTextString(m) }
+func (*X509SVIDResponse) ProtoMessage()               {}
+func (*X509SVIDResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *X509SVIDResponse) GetSvids() []*X509SVID {
+	if m != nil {
+		return m.Svids
+	}
+	return nil
+}
+
+type X509SVID struct {
+	// spiffe_id is the SPIFFE ID of the SVID
+	SpiffeId string `protobuf:"bytes,1,opt,name=spiffe_id,json=spiffeId" json:"spiffe_id,omitempty"`
+	// x509_svid is the certificate chain in ASN.1 DER, leaf first
+	X509Svid []byte `protobuf:"bytes,2,opt,name=x509_svid,json=x509Svid,proto3" json:"x509_svid,omitempty"`
+	// x509_svid_key is the private key in PKCS#8 DER
+	X509SvidKey []byte `protobuf:"bytes,3,opt,name=x509_svid_key,json=x509SvidKey,proto3" json:"x509_svid_key,omitempty"`
+	// bundle are the CA certificates of the trust domain in ASN.1 DER
+	Bundle []byte `protobuf:"bytes,4,opt,name=bundle,proto3" json:"bundle,omitempty"`
+}
+
+func (m *X509SVID) Reset()                    { *m = X509SVID{} }
+func (m *X509SVID) String() string            { return proto.CompactTextString(m) }
+func (*X509SVID) ProtoMessage()               {}
+func (*X509SVID) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *X509SVID) GetSpiffeId() string {
+	if m != nil {
+		return m.SpiffeId
+	}
+	return ""
+}
+
+func (m *X509SVID) GetX509Svid() []byte {
+	if m != nil {
+		return m.X509Svid
+	}
+	return nil
+}
+
+func (m *X509SVID) GetX509SvidKey() []byte {
+	if m != nil {
+		return m.X509SvidKey
+	}
+	return nil
+}
+
+func (m *X509SVID) GetBundle() []byte {
+	if m != nil {
+		return m.Bundle
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*X509SVIDRequest)(nil), "X509SVIDRequest")
+	proto.RegisterType((*X509SVIDResponse)(nil), "X509SVIDResponse")
+	proto.RegisterType((*X509SVID)(nil), "X509SVID")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for SpiffeWorkloadAPI service
+
+type SpiffeWorkloadAPIClient interface {
+	// FetchX509SVID streams the X.509-SVIDs of the workload, again each time
+	// they are rotated
+	FetchX509SVID(ctx context.Context, in *X509SVIDRequest, opts ...grpc.CallOption) (SpiffeWorkloadAPI_FetchX509SVIDClient, error)
+}
+
+type spiffeWorkloadAPIClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewSpiffeWorkloadAPIClient(cc *grpc.ClientConn) SpiffeWorkloadAPIClient {
+	return &spiffeWorkloadAPIClient{cc}
+}
+
+func (c *spiffeWorkloadAPIClient) FetchX509SVID(ctx context.Context, in *X509SVIDRequest, opts ...grpc.CallOption) (SpiffeWorkloadAPI_FetchX509SVIDClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_SpiffeWorkloadAPI_serviceDesc.Streams[0], c.cc, "/SpiffeWorkloadAPI/FetchX509SVID", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &spiffeWorkloadAPIFetchX509SVIDClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type SpiffeWorkloadAPI_FetchX509SVIDClient interface {
+	Recv() (*X509SVIDResponse, error)
+	grpc.ClientStream
+}
+
+type spiffeWorkloadAPIFetchX509SVIDClient struct {
+	grpc.ClientStream
+}
+
+func (x *spiffeWorkloadAPIFetchX509SVIDClient) Recv() (*X509SVIDResponse, error) {
+	m := new(X509SVIDResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Server API for SpiffeWorkloadAPI service
+
+type SpiffeWorkloadAPIServer interface {
+	// FetchX509SVID streams the X.509-SVIDs of the workload, again each time
+	// they are rotated
+	FetchX509SVID(*X509SVIDRequest, SpiffeWorkloadAPI_FetchX509SVIDServer) error
+}
+
+func RegisterSpiffeWorkloadAPIServer(s *grpc.Server, srv SpiffeWorkloadAPIServer) {
+	s.RegisterService(&_SpiffeWorkloadAPI_serviceDesc, srv)
+}
+
+func _SpiffeWorkloadAPI_FetchX509SVID_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(X509SVIDRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SpiffeWorkloadAPIServer).FetchX509SVID(m, &spiffeWorkloadAPIFetchX509SVIDServer{stream})
+}
+
+type SpiffeWorkloadAPI_FetchX509SVIDServer interface {
+	Send(*X509SVIDResponse) error
+	grpc.ServerStream
+}
+
+type spiffeWorkloadAPIFetchX509SVIDServer struct {
+	grpc.ServerStream
+}
+
+func (x *spiffeWorkloadAPIFetchX509SVIDServer) Send(m *X509SVIDResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _SpiffeWorkloadAPI_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "SpiffeWorkloadAPI",
+	HandlerType: (*SpiffeWorkloadAPIServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "FetchX509SVID",
+			Handler:       _SpiffeWorkloadAPI_FetchX509SVID_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "workload.proto",
+}
+
+func init() { proto.RegisterFile("workload.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 223 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0x2b, 0xcf, 0x2f, 0xca,
+	0xce, 0xc9, 0x4f, 0x4c, 0xd1, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x57, 0x12, 0xe4, 0xe2, 0x8f, 0x30,
+	0x35, 0xb0, 0x0c, 0x0e, 0xf3, 0x74, 0x09, 0x4a, 0x2d, 0x2c, 0x4d, 0x2d, 0x2e, 0x51, 0x32, 0xe6,
+	0x12, 0x40, 0x08, 0x15, 0x17, 0xe4, 0xe7, 0x15, 0xa7, 0x0a, 0xc9, 0x73, 0xb1, 0x16, 0x97, 0x65,
+	0xa6, 0x14, 0x4b, 0x30, 0x2a, 0x30, 0x6b, 0x70, 0x1b, 0x71, 0xea, 0xc1, 0x55, 0x40, 0xc4, 0x95,
+	0x1a, 0x18, 0xb9, 0x38, 0x60, 0x62, 0x42, 0xd2, 0x5c, 0x9c, 0xc5, 0x05, 0x99, 0x69, 0x69, 0xa9,
+	0xf1, 0x99, 0x29, 0x12, 0x8c, 0x0a, 0x8c, 0x1a, 0x9c, 0x41, 0x1c, 0x10, 0x01, 0xcf, 0x14, 0x90,
+	0x64, 0x85, 0xa9, 0x81, 0x65, 0x3c, 0x48, 0x9f, 0x04, 0x93, 0x02, 0xa3, 0x06, 0x4f, 0x10, 0x07,
+	0x48, 0x20, 0xb8, 0x2c, 0x33, 0x45, 0x48, 0x89, 0x8b, 0x17, 0x2e, 0x19, 0x9f, 0x9d, 0x5a, 0x29,
+	0xc1, 0x0c, 0x56, 0xc0, 0x0d, 0x53, 0xe0, 0x9d, 0x5a, 0x29, 0x24, 0xc6, 0xc5, 0x96, 0x54, 0x9a,
+	0x97, 0x92, 0x93, 0x2a, 0xc1, 0x02, 0x96, 0x84, 0xf2, 0x8c, 0x7c, 0xb9, 0x04, 0x83, 0xc1, 0x96,
+	0x84, 0x43, 0xbd, 0xe8, 0x18, 0xe0, 0x29, 0x64, 0xc1, 0xc5, 0xeb, 0x96, 0x5a, 0x92, 0x9c, 0x01,
+	0x77, 0x9b, 0x80, 0x1e, 0x9a, 0x7f, 0xa5, 0x04, 0xf5, 0xd0, 0xbd, 0xab, 0xc4, 0x60, 0xc0, 0x98,
+	0xc4, 0x06, 0x0e, 0x20, 0x63, 0xc0, 0x00, 0x1c, 0x2f, 0x13, 0x88, 0x32, 0x01, 0x00, 0x00,
+}
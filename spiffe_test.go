@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	auth_pb "github.com/nileshsimaria/jtimon/authentication"
+	"github.com/nileshsimaria/jtimon/spiffe"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// testWorkloadAPI is a SPIFFE Workload API which streams the SVIDs of svids
+type testWorkloadAPI struct {
+	svids chan *spiffe.X509SVIDResponse
+}
+
+func (w *testWorkloadAPI) FetchX509SVID(req *spiffe.X509SVIDRequest, stream spiffe.SpiffeWorkloadAPI_FetchX509SVIDServer) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	if v := md["workload.spiffe.io"]; len(v) != 1 || v[0] != "true" {
+		return status.Error(codes.InvalidArgument, "security header missing")
+	}
+	for {
+		select {
+		case resp := <-w.svids:
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// testTLSDevice serves TLS with the certificate device.crt of dir, it
+// requires a client certificate signed by ca and hands its name to clients
+func testTLSDevice(t *testing.T, dir string, ca *x509.Certificate) (addr string, clients chan string, stop func()) {
+	deviceCert, err := tls.LoadX509KeyPair(filepath.Join(dir, "device.crt"), filepath.Join(dir, "device.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients = make(chan string, 1)
+	device := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{deviceCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})), grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+		p, _ := peer.FromContext(stream.Context())
+		clients <- p.AuthInfo.(credentials.TLSInfo).State.PeerCertificates[0].Subject.CommonName
+		return nil
+	}))
+	go device.Serve(lis)
+	return lis.Addr().String(), clients, device.Stop
+}
+
+// testTLSClient makes an RPC to the device at addr with the security options
+// of the TLS config and returns the client certificate the device got
+func testTLSClient(t *testing.T, addr string, cfg TLSConfig, clients chan string) string {
+	jctx := &JCtx{config: Config{Host: "r1", TLS: cfg}}
+	opt, err := getSecurityOptions(jctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := grpc.Dial(addr, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = auth_pb.NewLoginClient(conn).LoginCheck(ctx, &auth_pb.LoginRequest{})
+	select {
+	case name := <-clients:
+		return name
+	case <-time.After(time.Second):
+		t.Fatalf("no RPC: %v", err)
+	}
+	return ""
+}
+
+func TestSPIFFE(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-spiffe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca, caKey := testCert(t, dir, "ca", nil, nil)
+	testCert(t, dir, "device", ca, caKey)
+	svid := func(name string) *spiffe.X509SVIDResponse {
+		cert, key := testCert(t, dir, name, ca, caKey)
+		keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &spiffe.X509SVIDResponse{Svids: []*spiffe.X509SVID{{
+			SpiffeId: "spiffe://example.org/" + name, X509Svid: cert.Raw, X509SvidKey: keyDer, Bundle: ca.Raw,
+		}}}
+	}
+
+	// the Workload API of the agent
+	socket := filepath.Join(dir, "agent.sock")
+	lis, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := &testWorkloadAPI{svids: make(chan *spiffe.X509SVIDResponse, 1)}
+	agent := grpc.NewServer()
+	spiffe.RegisterSpiffeWorkloadAPIServer(agent, api)
+	go agent.Serve(lis)
+	defer agent.Stop()
+
+	// the device requires a client certificate of the trust domain
+	addr, clients, stop := testTLSDevice(t, dir, ca)
+	defer stop()
+
+	defer func(v string) { *spiffeSocket = v }(*spiffeSocket)
+	*spiffeSocket = "unix://" + socket
+	defer func() {
+		svidsMu.Lock()
+		if svids != nil {
+			svids.stop()
+			svids = nil
+		}
+		svidsMu.Unlock()
+	}()
+
+	cfg := TLSConfig{SPIFFE: true}
+	if err := validateTLSConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateTLSConfig(TLSConfig{SPIFFE: true, ClientCrt: "client.crt"}); err == nil {
+		t.Errorf("no error with spiffe and a client certificate")
+	}
+
+	api.svids <- svid("jtimon")
+	if got := testTLSClient(t, addr, cfg, clients); got != "jtimon" {
+		t.Errorf("got client certificate %s", got)
+	}
+
+	// rotated by the agent
+	api.svids <- svid("jtimon-rotated")
+	for i := 0; ; i++ {
+		s := spiffeSource()
+		s.Lock()
+		id := s.id
+		s.Unlock()
+		if id == "spiffe://example.org/jtimon-rotated" {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("SVID not rotated, got %s", id)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := testTLSClient(t, addr, cfg, clients); got != "jtimon-rotated" {
+		t.Errorf("got client certificate %s after the rotation", got)
+	}
+}
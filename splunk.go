@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// SplunkConfig is the config of the Splunk HTTP Event Collector sink
+type SplunkConfig struct {
+	URL        string `json:"url"`
+	Token      string `json:"token"`
+	Index      string `json:"index"`
+	Source     string `json:"source"`
+	SourceType string `json:"sourcetype"`
+	Host       string `json:"host"`
+	BatchConfig
+}
+
+type splunkSink struct {
+	cfg        SplunkConfig
+	url        string
+	sourceType *template.Template
+	host       *template.Template
+	client     *http.Client
+}
+
+func newSplunkSink() *sink {
+	return &sink{
+		name: "splunk",
+		open: openSplunkSink,
+	}
+}
+
+func openSplunkSink(jctx *JCtx) (sinkWriter, BatchConfig, error) {
+	cfg := jctx.config.Splunk
+	if cfg.URL == "" {
+		return nil, cfg.BatchConfig, nil
+	}
+	if cfg.Token == "" {
+		return nil, cfg.BatchConfig, fmt.Errorf("splunk token is missing")
+	}
+
+	s := &splunkSink{
+		cfg:    cfg,
+		url:    strings.TrimSuffix(cfg.URL, "/") + "/services/collector/event",
+		client: &http.Client{Timeout: time.Duration(DefaultIDBTimeout) * time.Second},
+	}
+	if s.cfg.Source == "" {
+		s.cfg.Source = DefaultSplunkSource
+	}
+
+	sourceType := cfg.SourceType
+	if sourceType == "" {
+		sourceType = DefaultSplunkSourceType
+	}
+	t, err := newKeyTemplate("sourcetype", sourceType)
+	if err != nil {
+		return nil, cfg.BatchConfig, err
+	}
+	s.sourceType = t
+
+	host := cfg.Host
+	if host == "" {
+		host = DefaultSplunkHost
+	}
+	if s.host, err = newKeyTemplate("host", host); err != nil {
+		return nil, cfg.BatchConfig, err
+	}
+	return s, cfg.BatchConfig, nil
+}
+
+type splunkEvent struct {
+	Time       float64 `json:"time"`
+	Host       string  `json:"host,omitempty"`
+	Source     string  `json:"source,omitempty"`
+	SourceType string  `json:"sourcetype,omitempty"`
+	Index      string  `json:"index,omitempty"`
+	Event      *point  `json:"event"`
+}
+
+func (s *splunkSink) write(points []*point) error {
+	// HEC takes a batch as concatenated JSON objects
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, p := range points {
+		sourceType, err := execKeyTemplate(s.sourceType, p)
+		if err != nil {
+			return err
+		}
+		host, err := execKeyTemplate(s.host, p)
+		if err != nil {
+			return err
+		}
+		e := splunkEvent{
+			Time:       float64(p.Timestamp.UnixNano()/int64(time.Millisecond)) / 1000,
+			Host:       host,
+			Source:     s.cfg.Source,
+			SourceType: sourceType,
+			Index:      s.cfg.Index,
+			Event:      p,
+		}
+		if err := enc.Encode(e); err != nil {
+			continue
+		}
+	}
+
+	req, err := http.NewRequest("POST", s.url, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Splunk "+s.cfg.Token)
+
+	body, err := sinkHTTPDo(s.client, req)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Text string `json:"text"`
+		Code int    `json:"code"`
+	}
+	if json.Unmarshal(body, &resp) == nil && resp.Code != 0 {
+		return fmt.Errorf("splunk HEC error %d: %s", resp.Code, resp.Text)
+	}
+	return nil
+}
+
+func (s *splunkSink) close() {
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSplunkSink(t *testing.T) {
+	var events []splunkEvent
+	code := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/services/collector/event" || r.Header.Get("Authorization") != "Splunk tok" {
+			http.Error(w, `{"text":"Invalid token","code":4}`, http.StatusForbidden)
+			return
+		}
+		events = nil
+		dec := json.NewDecoder(r.Body)
+		for {
+			var e splunkEvent
+			if err := dec.Decode(&e); err == io.EOF {
+				break
+			} else if err != nil {
+				http.Error(w, `{"text":"Invalid data format","code":6}`, http.StatusBadRequest)
+				return
+			}
+			events = append(events, e)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"text": "Success", "code": code})
+	}))
+	defer server.Close()
+
+	p1 := newPoint("m1", map[string]string{"device": "r1"}, map[string]interface{}{"/a": 1.0}, time.Unix(1, 500000000))
+	p2 := newPoint("m2", map[string]string{"device": "r2"}, map[string]interface{}{"/a": 2.0}, time.Unix(2, 0))
+
+	tests := []struct {
+		name       string
+		cfg        SplunkConfig
+		sourceType string
+		host       string
+		err        bool
+	}{
+		{
+			name:       "defaults",
+			cfg:        SplunkConfig{URL: server.URL, Token: "tok"},
+			sourceType: "jtimon:m1",
+			host:       "r1",
+		},
+		{
+			name:       "templates",
+			cfg:        SplunkConfig{URL: server.URL + "/", Token: "tok", Index: "net", SourceType: "telemetry", Host: "{{.Tags.device}}.lab"},
+			sourceType: "telemetry",
+			host:       "r1.lab",
+		},
+		{
+			name: "bad-token",
+			cfg:  SplunkConfig{URL: server.URL, Token: "bad"},
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jctx := &JCtx{}
+			jctx.config.Splunk = test.cfg
+			w, _, err := openSplunkSink(jctx)
+			if err != nil {
+				t.Fatalf("openSplunkSink failed: %v", err)
+			}
+			defer w.close()
+
+			err = w.write([]*point{p1, p2})
+			if test.err {
+				if err == nil {
+					t.Errorf("want error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("write failed: %v", err)
+			}
+			if len(events) != 2 {
+				t.Fatalf("want 2 events, got %d", len(events))
+			}
+			e := events[0]
+			if e.SourceType != test.sourceType || e.Host != test.host || e.Index != test.cfg.Index || e.Source != "jtimon" {
+				t.Errorf("unexpected event metadata %+v", e)
+			}
+			if e.Time != 1.5 {
+				t.Errorf("time: want 1.5, got %v", e.Time)
+			}
+			if e.Event.Measurement != "m1" || e.Event.Fields["/a"] != 1.0 {
+				t.Errorf("unexpected event %+v", e.Event)
+			}
+		})
+	}
+
+	t.Run("hec-error", func(t *testing.T) {
+		code = 5
+		defer func() { code = 0 }()
+		jctx := &JCtx{}
+		jctx.config.Splunk = SplunkConfig{URL: server.URL, Token: "tok"}
+		w, _, _ := openSplunkSink(jctx)
+		if err := w.write([]*point{p1}); err == nil {
+			t.Errorf("want error, got nil")
+		}
+	})
+}
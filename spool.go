@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Compressions of the spooled batches
+const (
+	SpoolCompressionGzip = "gzip"
+	SpoolCompressionNone = "none"
+)
+
+// SpoolConfig spools the batches a sink fails to write into dir, one
+// directory per worker and sink, and writes them once the sink is back,
+// oldest first. Batches are compressed (gzip by default) and the spool of a
+// sink is capped to max-size MB, the oldest batches are evicted to make room.
+type SpoolConfig struct {
+	Dir         string `json:"dir"`
+	MaxSize     int    `json:"max-size"`
+	Compression string `json:"compression"`
+}
+
+func validateSpoolConfig(cfg SpoolConfig) error {
+	switch cfg.Compression {
+	case "", SpoolCompressionGzip, SpoolCompressionNone:
+	default:
+		return fmt.Errorf("spool compression %q is not supported, use gzip or none", cfg.Compression)
+	}
+	if cfg.MaxSize < 0 {
+		return fmt.Errorf("spool max-size can not be negative")
+	}
+	return nil
+}
+
+// spool is the on-disk queue of the batches of one sink
+type spool struct {
+	sync.Mutex
+	dir   string
+	max   int64
+	gzip  bool
+	seq   uint64
+	files []string
+	sizes map[string]int64
+	size  int64
+}
+
+// spoolDir is the spool directory of sink name of the worker
+func spoolDir(jctx *JCtx, name string) string {
+	worker := strings.TrimSuffix(filepath.Base(jctx.file), filepath.Ext(jctx.file))
+	return filepath.Join(jctx.config.Spool.Dir, worker, name)
+}
+
+// newSpool opens the spool in dir, batches left by an earlier run are
+// written first
+func newSpool(dir string, cfg SpoolConfig) (*spool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &spool{
+		dir:   dir,
+		max:   int64(cfg.MaxSize) << 20,
+		gzip:  cfg.Compression != SpoolCompressionNone,
+		sizes: map[string]int64{},
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".batch") && !strings.HasSuffix(info.Name(), ".batch.gz") {
+			continue
+		}
+		s.files = append(s.files, info.Name())
+		s.sizes[info.Name()] = info.Size()
+		s.size += info.Size()
+	}
+	// the names start with the time of the batch
+	sort.Strings(s.files)
+	return s, nil
+}
+
+// len returns the number of spooled batches
+func (s *spool) len() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.files)
+}
+
+// push spools the batch and returns the number of points of the batches
+// evicted to stay within the size cap
+func (s *spool) push(points []*point) (uint64, error) {
+	s.Lock()
+	s.seq++
+	name := fmt.Sprintf("%020d-%06d.batch", time.Now().UnixNano(), s.seq%1000000)
+	s.Unlock()
+	if s.gzip {
+		name += ".gz"
+	}
+
+	size, err := s.writeFile(name, points)
+	if err != nil {
+		return 0, err
+	}
+
+	s.Lock()
+	s.files = append(s.files, name)
+	s.sizes[name] = size
+	s.size += size
+	var evict []string
+	for s.max > 0 && s.size > s.max && len(s.files) > 1 {
+		evict = append(evict, s.files[0])
+		s.size -= s.sizes[s.files[0]]
+		delete(s.sizes, s.files[0])
+		s.files = s.files[1:]
+	}
+	s.Unlock()
+
+	var evicted uint64
+	for _, f := range evict {
+		if points, err := s.readFile(f); err == nil {
+			evicted += uint64(len(points))
+		}
+		os.Remove(filepath.Join(s.dir, f))
+	}
+	return evicted, nil
+}
+
+// peek returns the oldest batch, nil if the spool is empty
+func (s *spool) peek() (string, []*point, error) {
+	s.Lock()
+	if len(s.files) == 0 {
+		s.Unlock()
+		return "", nil, nil
+	}
+	name := s.files[0]
+	s.Unlock()
+
+	points, err := s.readFile(name)
+	return name, points, err
+}
+
+// remove drops the batch once it is written or found unreadable
+func (s *spool) remove(name string) {
+	s.Lock()
+	for i, f := range s.files {
+		if f == name {
+			s.files = append(s.files[:i], s.files[i+1:]...)
+			s.size -= s.sizes[name]
+			delete(s.sizes, name)
+			break
+		}
+	}
+	s.Unlock()
+	os.Remove(filepath.Join(s.dir, name))
+}
+
+func (s *spool) writeFile(name string, points []*point) (int64, error) {
+	tmp, err := ioutil.TempFile(s.dir, "tmp-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	var w io.Writer = tmp
+	var zw *gzip.Writer
+	if strings.HasSuffix(name, ".gz") {
+		zw = gzip.NewWriter(tmp)
+		w = zw
+	}
+	bw := bufio.NewWriter(w)
+	err = gob.NewEncoder(bw).Encode(points)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil && zw != nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		// the batch is on disk once it is in the spool
+		err = tmp.Sync()
+	}
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	return info.Size(), os.Rename(tmp.Name(), filepath.Join(s.dir, name))
+}
+
+func (s *spool) readFile(name string) ([]*point, error) {
+	f, err := os.Open(filepath.Join(s.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReader(f)
+	if strings.HasSuffix(name, ".gz") {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	var points []*point
+	if err := gob.NewDecoder(r).Decode(&points); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return points, nil
+}
+
+// spoolWrite writes the spooled batches of the sink oldest first, it
+// returns false if the sink is still failing and batches are left
+func spoolWrite(jctx *JCtx, sctx *sinkCtx) bool {
+	for {
+		name, points, err := sctx.spool.peek()
+		if name == "" {
+			return true
+		}
+		if err != nil {
+			jLogWarn(jctx, fmt.Sprintf("Dropping unreadable spooled batch of %s: %v", sctx.name, err))
+			sctx.spool.remove(name)
+			continue
+		}
+		if err := sctx.w.write(points); err != nil {
+			return false
+		}
+		sctx.spool.remove(name)
+		if IsVerboseLogging(jctx) {
+			jLogDebug(jctx, fmt.Sprintf("Wrote spooled batch of %s, points: %d", sctx.name, len(points)))
+		}
+	}
+}
+
+// spoolPush spools the batch the sink failed to write
+func spoolPush(jctx *JCtx, sctx *sinkCtx, points []*point) {
+	evicted, err := sctx.spool.push(points)
+	if err != nil {
+		jLogError(jctx, "", fmt.Sprintf("Spooling batch of %s failed", sctx.name), err)
+		jctx.drops.add("spool/"+sctx.name, uint64(len(points)))
+		return
+	}
+	if evicted > 0 {
+		jLogWarn(jctx, fmt.Sprintf("Spool of %s is full, evicted %d points", sctx.name, evicted))
+		jctx.drops.add("spool/"+sctx.name, evicted)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func spoolTestPoints(batch, n int) []*point {
+	points := make([]*point, n)
+	for i := range points {
+		points[i] = newPoint("/interfaces/",
+			map[string]string{"device": "d1", "/interfaces/interface/@name": fmt.Sprintf("ge-0/0/%d", i)},
+			map[string]interface{}{"in-octets": float64(batch*1000 + i), "oper-status": "UP", "count": int64(i)},
+			time.Unix(int64(batch), 0).UTC())
+	}
+	return points
+}
+
+func TestSpool(t *testing.T) {
+	tests := []struct {
+		name        string
+		compression string
+		maxSize     int
+		batches     int
+		left        int
+	}{
+		{"gzip", SpoolCompressionGzip, 0, 5, 5},
+		{"none", SpoolCompressionNone, 0, 5, 5},
+		{"evict", SpoolCompressionNone, 1, 40, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "jtimon-spool")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			s, err := newSpool(dir, SpoolConfig{Dir: dir, MaxSize: test.maxSize, Compression: test.compression})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var evicted uint64
+			for b := 0; b < test.batches; b++ {
+				n, err := s.push(spoolTestPoints(b, 1000))
+				if err != nil {
+					t.Fatal(err)
+				}
+				evicted += n
+			}
+			if test.maxSize > 0 {
+				if s.size > int64(test.maxSize)<<20 {
+					t.Errorf("spool size %d is above the cap", s.size)
+				}
+				if evicted == 0 {
+					t.Errorf("no points evicted")
+				}
+			}
+			left := s.len()
+			if test.left > 0 && left != test.left {
+				t.Errorf("got %d batches, want %d", left, test.left)
+			}
+			if uint64(left)*1000+evicted != uint64(test.batches)*1000 {
+				t.Errorf("%d batches left and %d points evicted of %d batches", left, evicted, test.batches)
+			}
+
+			// a new run picks up the batches, oldest first
+			s, err = newSpool(dir, SpoolConfig{Dir: dir, MaxSize: test.maxSize, Compression: test.compression})
+			if err != nil {
+				t.Fatal(err)
+			}
+			first := test.batches - left
+			for b := first; b < test.batches; b++ {
+				name, points, err := s.peek()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := spoolTestPoints(b, 1000); !reflect.DeepEqual(points, want) {
+					t.Fatalf("batch %d mismatch, got %v", b, points[0])
+				}
+				s.remove(name)
+			}
+			if name, _, _ := s.peek(); name != "" || s.size != 0 {
+				t.Errorf("spool not empty: %s size %d", name, s.size)
+			}
+		})
+	}
+}
+
+func TestSpoolCompression(t *testing.T) {
+	sizes := map[string]int64{}
+	for _, compression := range []string{SpoolCompressionGzip, SpoolCompressionNone} {
+		dir, err := ioutil.TempDir("", "jtimon-spool")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		s, err := newSpool(dir, SpoolConfig{Dir: dir, Compression: compression})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.push(spoolTestPoints(0, 1000)); err != nil {
+			t.Fatal(err)
+		}
+		sizes[compression] = s.size
+	}
+	if sizes[SpoolCompressionGzip]*2 > sizes[SpoolCompressionNone] {
+		t.Errorf("gzip spool %d bytes, uncompressed %d bytes", sizes[SpoolCompressionGzip], sizes[SpoolCompressionNone])
+	}
+}
+
+// flakySinkWriter fails while down is set
+type flakySinkWriter struct {
+	sync.Mutex
+	down   bool
+	points []*point
+}
+
+func (w *flakySinkWriter) write(points []*point) error {
+	w.Lock()
+	defer w.Unlock()
+	if w.down {
+		return errors.New("sink is down")
+	}
+	w.points = append(w.points, points...)
+	return nil
+}
+
+func (w *flakySinkWriter) close() {}
+
+func (w *flakySinkWriter) written() []*point {
+	w.Lock()
+	defer w.Unlock()
+	return append([]*point(nil), w.points...)
+}
+
+func TestSpoolSinkOutage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jtimon-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w := &flakySinkWriter{down: true}
+	jctx := &JCtx{file: "device.json", config: Config{Spool: SpoolConfig{Dir: dir}}}
+	s, err := newSpool(spoolDir(jctx, "test"), jctx.config.Spool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sctx := &sinkCtx{name: "test", ch: make(chan *point, 100), w: w, spool: s}
+	jctx.sinks = []*sinkCtx{sctx}
+	sinkBatchWrite(jctx, sctx, BatchConfig{BatchSize: 10, BatchFrequency: 10})
+
+	var want []*point
+	for b := 0; b < 3; b++ {
+		points := spoolTestPoints(b, 10)
+		want = append(want, points...)
+		writeSinks(jctx, points)
+		time.Sleep(30 * time.Millisecond)
+	}
+	if n := s.len(); n != 3 {
+		t.Fatalf("got %d spooled batches during the outage, want 3", n)
+	}
+
+	w.Lock()
+	w.down = false
+	w.Unlock()
+	points := spoolTestPoints(3, 10)
+	want = append(want, points...)
+	writeSinks(jctx, points)
+
+	for i := 0; i < 100 && len(w.written()) < len(want); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := w.written(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %d points after the outage, want %d in order", len(got), len(want))
+	}
+	if n := s.len(); n != 0 {
+		t.Errorf("got %d spooled batches after the outage, want 0", n)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// StaleConfig raises an alarm once a connected device sent no data for
+// window seconds, and clears it when data resumes or the device
+// disconnects. The alarm is logged, exported as jtimon_device_stale and,
+// with url, posted to a webhook (format json or slack).
+type StaleConfig struct {
+	Window  int               `json:"window"`
+	URL     string            `json:"url"`
+	Format  string            `json:"format"`
+	Headers map[string]string `json:"headers"`
+}
+
+func validateStaleConfig(cfg StaleConfig) error {
+	if cfg.Window < 0 {
+		return fmt.Errorf("stale window can not be negative")
+	}
+	switch cfg.Format {
+	case "", "json", "slack":
+	default:
+		return fmt.Errorf("stale format %q is not supported, use json or slack", cfg.Format)
+	}
+	return nil
+}
+
+// staleCheck is the stale alarm of a worker
+type staleCheck struct {
+	cfg    StaleConfig
+	window time.Duration
+	client *http.Client
+	task   *schedTask
+	// firing is accessed atomically, it is only changed by check
+	firing int32
+}
+
+// check returns "firing" if the alarm is raised and "resolved" if it is
+// cleared at now
+func (s *staleCheck) check(m *workerMetrics, now time.Time) string {
+	connected := atomic.LoadInt32(&m.connected) == 1
+	last := atomic.LoadInt64(&m.lastData)
+	// a device which just connected had no time to send data yet
+	if since := atomic.LoadInt64(&m.connectedAt); since > last {
+		last = since
+	}
+	stale := connected && now.Sub(time.Unix(0, last)) >= s.window
+
+	firing := atomic.LoadInt32(&s.firing) == 1
+	switch {
+	case stale && !firing:
+		atomic.StoreInt32(&s.firing, 1)
+		return "firing"
+	case !stale && firing:
+		atomic.StoreInt32(&s.firing, 0)
+		return "resolved"
+	}
+	return ""
+}
+
+// isStale tells whether the stale alarm of the worker is raised
+func isStale(jctx *JCtx) bool {
+	return jctx.stale != nil && atomic.LoadInt32(&jctx.stale.firing) == 1
+}
+
+func (s *staleCheck) payload(device, status, msg string, last time.Time) interface{} {
+	if s.cfg.Format == "slack" {
+		return map[string]string{"text": msg}
+	}
+	p := map[string]interface{}{
+		"device":    device,
+		"status":    status,
+		"window":    s.cfg.Window,
+		"message":   msg,
+		"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	if !last.IsZero() {
+		p["last-data"] = last.UTC().Format(time.RFC3339Nano)
+	}
+	return p
+}
+
+func (s *staleCheck) notify(body interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", s.cfg.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	_, err = sinkHTTPDo(s.client, req)
+	return err
+}
+
+// staleRun checks the worker for the stale alarm and reports changes
+func staleRun(jctx *JCtx, s *staleCheck, now time.Time) {
+	status := s.check(&jctx.metrics, now)
+	if status == "" {
+		return
+	}
+	var last time.Time
+	if t := atomic.LoadInt64(&jctx.metrics.lastData); t != 0 {
+		last = time.Unix(0, t)
+	}
+	device := jctx.config.Host
+	var msg string
+	if status == "firing" {
+		msg = fmt.Sprintf("Device %s is connected but sent no data for %ds", device, s.cfg.Window)
+		jLogWarn(jctx, msg)
+		recordEvent(jctx, EventStale, "", msg)
+	} else {
+		msg = fmt.Sprintf("Device %s is no longer stale", device)
+		jLog(jctx, msg)
+		recordEvent(jctx, EventStaleClear, "", msg)
+	}
+	if s.cfg.URL == "" {
+		return
+	}
+	if err := s.notify(s.payload(device, status, msg, last)); err != nil {
+		jLogError(jctx, "", "Could not send the stale notification", err)
+	}
+}
+
+// staleInit schedules the stale check of the worker if the stale window is
+// set, the check runs every second
+func staleInit(jctx *JCtx) {
+	cfg := jctx.config.Stale
+	if cfg.Window == 0 {
+		return
+	}
+	s := &staleCheck{
+		cfg:    cfg,
+		window: time.Duration(cfg.Window) * time.Second,
+		client: &http.Client{Timeout: time.Duration(DefaultIDBTimeout) * time.Second},
+	}
+	jctx.stale = s
+	s.task = schedule(time.Second, func() {
+		staleRun(jctx, s, time.Now())
+	})
+}
+
+func staleStop(jctx *JCtx) {
+	if jctx.stale != nil {
+		jctx.stale.task.stop()
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestValidateStaleConfig(t *testing.T) {
+	tests := []struct {
+		cfg StaleConfig
+		err bool
+	}{
+		{cfg: StaleConfig{}},
+		{cfg: StaleConfig{Window: 60, URL: "http://127.0.0.1/hook", Format: "slack"}},
+		{cfg: StaleConfig{Window: -1}, err: true},
+		{cfg: StaleConfig{Window: 60, Format: "pagerduty"}, err: true},
+	}
+	for _, test := range tests {
+		if err := validateStaleConfig(test.cfg); (err != nil) != test.err {
+			t.Errorf("%+v: got error %v", test.cfg, err)
+		}
+	}
+}
+
+func TestStaleCheck(t *testing.T) {
+	start := time.Unix(1583058600, 0)
+	at := func(s int) int64 { return start.Add(time.Duration(s) * time.Second).UnixNano() }
+	s := &staleCheck{window: 60 * time.Second}
+	var m workerMetrics
+
+	tests := []struct {
+		name      string
+		connected int32
+		connectAt int64
+		lastData  int64
+		now       int
+		want      string
+	}{
+		{name: "disconnected", now: 1000},
+		{name: "just connected", connected: 1, connectAt: at(0), now: 30},
+		{name: "silent since connect", connected: 1, connectAt: at(0), now: 60, want: "firing"},
+		{name: "still silent", connected: 1, connectAt: at(0), now: 120},
+		{name: "data resumed", connected: 1, connectAt: at(0), lastData: at(119), now: 121, want: "resolved"},
+		{name: "silent again", connected: 1, connectAt: at(0), lastData: at(119), now: 179, want: "firing"},
+		{name: "device disconnected", connectAt: at(0), lastData: at(119), now: 180, want: "resolved"},
+		{name: "old data before reconnect", connected: 1, connectAt: at(300), lastData: at(119), now: 330},
+	}
+	for _, test := range tests {
+		m.connected, m.connectedAt, m.lastData = test.connected, test.connectAt, test.lastData
+		if got := s.check(&m, start.Add(time.Duration(test.now)*time.Second)); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestStaleRun(t *testing.T) {
+	var got []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		var m map[string]interface{}
+		json.Unmarshal(b, &m)
+		got = append(got, m)
+	}))
+	defer server.Close()
+
+	jctx := &JCtx{config: Config{Host: "r1", Log: LogConfig{Level: LogLevelError},
+		Stale: StaleConfig{Window: 10, URL: server.URL}}}
+	staleInit(jctx)
+	defer staleStop(jctx)
+	s := jctx.stale
+
+	now := time.Now()
+	setConnected(jctx, true)
+	staleRun(jctx, s, now.Add(5*time.Second))
+	staleRun(jctx, s, now.Add(11*time.Second))
+	if !isStale(jctx) || !workerHealth(jctx).Stale {
+		t.Errorf("device is not stale")
+	}
+	packetReceived(jctx)
+	staleRun(jctx, s, time.Now())
+	if isStale(jctx) {
+		t.Errorf("device is still stale")
+	}
+
+	if len(got) != 2 || got[0]["status"] != "firing" || got[0]["device"] != "r1" || got[0]["window"] != 10.0 ||
+		got[1]["status"] != "resolved" || got[1]["last-data"] == nil {
+		t.Errorf("got notifications %v", got)
+	}
+	events := jctx.events.events()
+	if n := len(events); n != 3 || events[1].Type != EventStale || events[2].Type != EventStaleClear {
+		t.Errorf("got events %+v", events)
+	}
+}
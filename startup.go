@@ -0,0 +1,79 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	startConcurrency = flag.Int("start-concurrency", 0, "Max number of workers connecting at the same time at startup (0 is no limit)")
+	startRamp        = flag.Int("start-ramp", 0, "Delay between the first connects of two workers in milliseconds")
+)
+
+// startLimiter paces the first connects of the workers so that starting a
+// big fleet doesn't hit DNS, TLS and the devices all at once. At most
+// concurrency workers connect at the same time and two connects start at
+// least ramp apart.
+type startLimiter struct {
+	sync.Mutex
+	sem  chan struct{}
+	ramp time.Duration
+	next time.Time
+}
+
+var starts *startLimiter
+
+func newStartLimiter(concurrency int, ramp time.Duration) *startLimiter {
+	l := &startLimiter{ramp: ramp}
+	if concurrency > 0 {
+		l.sem = make(chan struct{}, concurrency)
+	}
+	return l
+}
+
+// acquire waits for the turn of the worker to connect, the returned
+// function ends the connect and may be called more than once
+func (l *startLimiter) acquire() func() {
+	if l == nil {
+		return func() {}
+	}
+	if l.sem != nil {
+		l.sem <- struct{}{}
+	}
+	if l.ramp > 0 {
+		l.Lock()
+		now := time.Now()
+		at := l.next
+		if at.Before(now) {
+			at = now
+		}
+		l.next = at.Add(l.ramp)
+		l.Unlock()
+		time.Sleep(at.Sub(now))
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if l.sem != nil {
+				<-l.sem
+			}
+		})
+	}
+}
+
+func startInit() {
+	if *startConcurrency > 0 || *startRamp > 0 {
+		starts = newStartLimiter(*startConcurrency, time.Duration(*startRamp)*time.Millisecond)
+	}
+}
+
+// startDone ends the first connect of the worker, when the streaming has
+// started or the connect failed
+func startDone(jctx *JCtx) {
+	if jctx.startSlot != nil {
+		jctx.startSlot()
+	}
+}
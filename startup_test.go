@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStartLimiter(t *testing.T) {
+	tests := []struct {
+		name        string
+		nilLimiter  bool
+		concurrency int
+		ramp        time.Duration
+		workers     int
+		maxActive   int32
+		minElapsed  time.Duration
+	}{
+		{name: "none", nilLimiter: true, workers: 10, maxActive: 10},
+		{name: "concurrency", concurrency: 2, workers: 10, maxActive: 2, minElapsed: 5 * 20 * time.Millisecond},
+		{name: "ramp", ramp: 10 * time.Millisecond, workers: 5, maxActive: 5, minElapsed: 4 * 10 * time.Millisecond},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var l *startLimiter
+			if !test.nilLimiter {
+				l = newStartLimiter(test.concurrency, test.ramp)
+			}
+
+			var active, maxActive int32
+			var wg sync.WaitGroup
+			start := time.Now()
+			for i := 0; i < test.workers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					done := l.acquire()
+					n := atomic.AddInt32(&active, 1)
+					for {
+						m := atomic.LoadInt32(&maxActive)
+						if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+							break
+						}
+					}
+					time.Sleep(20 * time.Millisecond)
+					atomic.AddInt32(&active, -1)
+					done()
+					// releasing twice must not free another slot
+					done()
+				}()
+			}
+			wg.Wait()
+
+			if maxActive > test.maxActive {
+				t.Errorf("%d workers connected at the same time, want at most %d", maxActive, test.maxActive)
+			}
+			if elapsed := time.Since(start); elapsed < test.minElapsed {
+				t.Errorf("start took %s, want at least %s", elapsed, test.minElapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// statsdPacket is the max size of the datagrams, below the common MTU
+const statsdPacket = 1432
+
+// Formats of the StatsD metrics
+const (
+	StatsdFormatDogStatsD = "dogstatsd"
+	StatsdFormatStatsD    = "statsd"
+)
+
+var statsdNameRe = regexp.MustCompile(`[^A-Za-z0-9_\-]`)
+
+// statsdPusher pushes the internal counters of jtimon to StatsD or
+// DogStatsD. Counters are sent as the increase since the last push.
+type statsdPusher struct {
+	format string
+	prefix string
+	reg    *prometheus.Registry
+	conn   net.Conn
+	last   map[string]float64
+}
+
+func newStatsdPusher(addr, format, prefix string) (*statsdPusher, error) {
+	switch format {
+	case StatsdFormatDogStatsD, StatsdFormatStatsD:
+	default:
+		return nil, fmt.Errorf("statsd format %q is not supported, use dogstatsd or statsd", format)
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(internalCollector{})
+	reg.MustRegister(dropCollector{})
+	return &statsdPusher{
+		format: format,
+		prefix: prefix,
+		reg:    reg,
+		conn:   conn,
+		last:   map[string]float64{},
+	}, nil
+}
+
+// statsdInit pushes the internal counters to --statsd every
+// --statsd-interval seconds
+func statsdInit() {
+	if *statsdAddr == "" {
+		return
+	}
+	if *statsdIntvl <= 0 {
+		log.Printf("statsd interval must be positive")
+		return
+	}
+	p, err := newStatsdPusher(*statsdAddr, *statsdFormat, *statsdPrefix)
+	if err != nil {
+		log.Printf("Could not start pushing to statsd(%s): %v", *statsdAddr, err)
+		return
+	}
+	schedule(time.Duration(*statsdIntvl)*time.Second, p.push)
+}
+
+func (p *statsdPusher) push() {
+	families, err := p.reg.Gather()
+	if err != nil {
+		globalLog(LogLevelWarn, fmt.Sprintf("Could not gather the metrics for statsd: %v", err))
+	}
+	for _, b := range statsdPackets(p.lines(families)) {
+		if _, err := p.conn.Write(b); err != nil {
+			globalLog(LogLevelWarn, fmt.Sprintf("Could not push the metrics to statsd: %v", err))
+			return
+		}
+	}
+}
+
+// name is the StatsD name of the Prometheus metric, jtimon_queue_drops_total
+// is jtimon.queue_drops. With plain StatsD the label values are part of the
+// name as it has no tags.
+func (p *statsdPusher) name(metric string, labels []*dto.LabelPair) string {
+	metric = strings.TrimSuffix(strings.TrimPrefix(metric, "jtimon_"), "_total")
+	parts := []string{}
+	if p.prefix != "" {
+		parts = append(parts, p.prefix)
+	}
+	parts = append(parts, metric)
+	if p.format == StatsdFormatStatsD {
+		for _, l := range labels {
+			parts = append(parts, statsdNameRe.ReplaceAllString(l.GetValue(), "_"))
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// tags are the DogStatsD tags of the labels
+func (p *statsdPusher) tags(labels []*dto.LabelPair) string {
+	if p.format != StatsdFormatDogStatsD || len(labels) == 0 {
+		return ""
+	}
+	tags := make([]string, 0, len(labels))
+	for _, l := range labels {
+		v := strings.NewReplacer(",", "_", "|", "_", "#", "_").Replace(l.GetValue())
+		tags = append(tags, l.GetName()+":"+v)
+	}
+	return "|#" + strings.Join(tags, ",")
+}
+
+// increase returns the increase of the counter since the last push, a
+// counter which went down started over
+func (p *statsdPusher) increase(key string, v float64) float64 {
+	last, ok := p.last[key]
+	p.last[key] = v
+	if !ok || v < last {
+		return v
+	}
+	return v - last
+}
+
+func statsdValue(v float64) string {
+	if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+		return fmt.Sprintf("%d", int64(v))
+	}
+	return fmt.Sprintf("%g", v)
+}
+
+// lines are the StatsD lines of the metrics, sorted
+func (p *statsdPusher) lines(families []*dto.MetricFamily) []string {
+	var lines []string
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			name, tags := p.name(f.GetName(), m.GetLabel()), p.tags(m.GetLabel())
+			key := name + tags
+			switch f.GetType() {
+			case dto.MetricType_COUNTER:
+				lines = append(lines, name+":"+statsdValue(p.increase(key, m.GetCounter().GetValue()))+"|c"+tags)
+			case dto.MetricType_GAUGE:
+				lines = append(lines, name+":"+statsdValue(m.GetGauge().GetValue())+"|g"+tags)
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				count := p.increase(key+".count", float64(s.GetSampleCount()))
+				lines = append(lines, name+".count:"+statsdValue(count)+"|c"+tags)
+				for _, q := range s.GetQuantile() {
+					if math.IsNaN(q.GetValue()) {
+						continue
+					}
+					lines = append(lines, fmt.Sprintf("%s.p%g:%s|g%s", name, q.GetQuantile()*100,
+						statsdValue(q.GetValue()), tags))
+				}
+			}
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// statsdPackets packs the lines into datagrams of statsdPacket bytes at most
+func statsdPackets(lines []string) [][]byte {
+	var packets [][]byte
+	var b []byte
+	for _, l := range lines {
+		if len(b) != 0 && len(b)+1+len(l) > statsdPacket {
+			packets = append(packets, b)
+			b = nil
+		}
+		if len(b) != 0 {
+			b = append(b, '\n')
+		}
+		b = append(b, l...)
+	}
+	if len(b) != 0 {
+		packets = append(packets, b)
+	}
+	return packets
+}
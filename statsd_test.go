@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type statsdTestCollector struct {
+	drops float64
+}
+
+func (statsdTestCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dropDesc
+	ch <- queueLenDesc
+	ch <- latencyDesc
+}
+
+func (c statsdTestCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(dropDesc, prometheus.CounterValue, c.drops, "r1", "sink/kafka")
+	ch <- prometheus.MustNewConstMetric(queueLenDesc, prometheus.GaugeValue, 12, "r1", "sink/kafka")
+	ch <- prometheus.MustNewConstSummary(latencyDesc, 4, 0.2, map[float64]float64{0.5: 0.05}, "r1", "/bgp/")
+}
+
+func TestStatsdLines(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		prefix string
+		want   []string
+	}{
+		{
+			name:   "dogstatsd",
+			format: StatsdFormatDogStatsD,
+			prefix: "jtimon",
+			want: []string{
+				"jtimon.latency_seconds.count:4|c|#device:r1,path:/bgp/",
+				"jtimon.latency_seconds.p50:0.05|g|#device:r1,path:/bgp/",
+				"jtimon.queue_drops:7|c|#device:r1,queue:sink/kafka",
+				"jtimon.queue_length:12|g|#device:r1,queue:sink/kafka",
+			},
+		},
+		{
+			name:   "statsd",
+			format: StatsdFormatStatsD,
+			prefix: "collector",
+			want: []string{
+				"collector.latency_seconds.r1._bgp_.count:4|c",
+				"collector.latency_seconds.r1._bgp_.p50:0.05|g",
+				"collector.queue_drops.r1.sink_kafka:7|c",
+				"collector.queue_length.r1.sink_kafka:12|g",
+			},
+		},
+	}
+	for _, test := range tests {
+		p := &statsdPusher{format: test.format, prefix: test.prefix, last: map[string]float64{}}
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(statsdTestCollector{drops: 7})
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.lines(families); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestStatsdIncrease(t *testing.T) {
+	p := &statsdPusher{last: map[string]float64{}}
+	for i, test := range []struct{ v, want float64 }{{5, 5}, {8, 3}, {8, 0}, {2, 2}} {
+		if got := p.increase("k", test.v); got != test.want {
+			t.Errorf("push %d: got %v, want %v", i, got, test.want)
+		}
+	}
+}
+
+func TestStatsdPackets(t *testing.T) {
+	line := strings.Repeat("x", 500)
+	packets := statsdPackets([]string{line, line, line, "y"})
+	if len(packets) != 2 {
+		t.Fatalf("got %d packets, want 2", len(packets))
+	}
+	if got := string(packets[1]); got != line+"\ny" {
+		t.Errorf("second packet: got %d bytes", len(got))
+	}
+	for _, b := range packets {
+		if len(b) > statsdPacket {
+			t.Errorf("packet of %d bytes", len(b))
+		}
+	}
+}
+
+func TestStatsdPush(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	p, err := newStatsdPusher(conn.LocalAddr().String(), StatsdFormatDogStatsD, "jtimon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.reg = prometheus.NewRegistry()
+	p.reg.MustRegister(statsdTestCollector{drops: 3})
+	p.push()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	b := make([]byte, statsdPacket)
+	n, _, err := conn.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(b[:n]); !strings.Contains(got, "jtimon.queue_drops:3|c|#device:r1,queue:sink/kafka") {
+		t.Errorf("got %q", got)
+	}
+
+	if _, err := newStatsdPusher(conn.LocalAddr().String(), "graphite", ""); err == nil {
+		t.Errorf("graphite format: expected an error")
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	na_pb "github.com/nileshsimaria/jtimon/telemetry"
@@ -10,16 +11,26 @@ import (
 	"google.golang.org/grpc/stats"
 )
 
+// statsCtx holds the stats of a worker, the counters are updated and read
+// atomically so that packets never wait for each other or for the periodic
+// stats
 type statsCtx struct {
-	sync.Mutex               // guarding following stats
-	startTime                time.Time
+	// guards startTime
+	sync.Mutex
 	totalIn                  uint64
 	totalKV                  uint64
 	totalInPayloadLength     uint64
 	totalInPayloadWireLength uint64
 	totalInHeaderWireLength  uint64
+	startTime                time.Time
+	paths                    pathStats
+	gaps                     seqGaps
 }
 
+// grpcConns are the open gRPC connections of the workers, accessed
+// atomically
+var grpcConns int64
+
 type statshandler struct {
 	jctx *JCtx
 }
@@ -35,52 +46,44 @@ func (h *statshandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) conte
 func (h *statshandler) HandleConn(ctx context.Context, s stats.ConnStats) {
 	switch s.(type) {
 	case *stats.ConnBegin:
+		atomic.AddInt64(&grpcConns, 1)
 	case *stats.ConnEnd:
+		atomic.AddInt64(&grpcConns, -1)
 	default:
 	}
 }
 
 func (h *statshandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
-	h.jctx.stats.Lock()
-	defer h.jctx.stats.Unlock()
-
 	switch s.(type) {
 	case *stats.InHeader:
-		h.jctx.stats.totalInHeaderWireLength += uint64(s.(*stats.InHeader).WireLength)
+		atomic.AddUint64(&h.jctx.stats.totalInHeaderWireLength, uint64(s.(*stats.InHeader).WireLength))
 	case *stats.OutHeader:
 	case *stats.OutPayload:
 	case *stats.InPayload:
-		h.jctx.stats.totalInPayloadLength += uint64(s.(*stats.InPayload).Length)
-		h.jctx.stats.totalInPayloadWireLength += uint64(s.(*stats.InPayload).WireLength)
+		atomic.AddUint64(&h.jctx.stats.totalInPayloadLength, uint64(s.(*stats.InPayload).Length))
+		atomic.AddUint64(&h.jctx.stats.totalInPayloadWireLength, uint64(s.(*stats.InPayload).WireLength))
 	case *stats.InTrailer:
 	case *stats.End:
 	default:
 	}
 }
 
-func updateStats(jctx *JCtx, ocData *na_pb.OpenConfigData, needLock bool) {
+func updateStats(jctx *JCtx, ocData *na_pb.OpenConfigData) {
 	if !*stateHandler {
 		return
 	}
-	if needLock {
-		jctx.stats.Lock()
-		defer jctx.stats.Unlock()
-	}
-	jctx.stats.totalIn++
+	atomic.AddUint64(&jctx.stats.totalIn, 1)
 }
 
-func updateStatsKV(jctx *JCtx, needLock bool) {
+func updateStatsKV(jctx *JCtx) {
 	if !*stateHandler {
 		return
 	}
-
-	if needLock {
-		jctx.stats.Lock()
-		defer jctx.stats.Unlock()
-	}
-	jctx.stats.totalKV++
+	atomic.AddUint64(&jctx.stats.totalKV, 1)
 }
 
+// periodicStats schedules the periodic stats of the worker, the task is
+// stopped by statsStop
 func periodicStats(jctx *JCtx) {
 	if !*stateHandler {
 		return
@@ -91,16 +94,12 @@ func periodicStats(jctx *JCtx) {
 	}
 
 	headerCounter := 0
-	for {
-		tickChan := time.NewTicker(time.Second * time.Duration(pstats)).C
-		<-tickChan
-
+	jctx.statsTask = schedule(time.Second*time.Duration(pstats), func() {
 		// Do nothing if we haven't heard back anything from the device
 
-		jctx.stats.Lock()
-		if jctx.stats.totalIn == 0 {
-			jctx.stats.Unlock()
-			continue
+		totalIn := atomic.LoadUint64(&jctx.stats.totalIn)
+		if totalIn == 0 {
+			return
 		}
 
 		s := fmt.Sprintf("\n")
@@ -113,15 +112,51 @@ func periodicStats(jctx *JCtx) {
 		}
 
 		s += fmt.Sprintf("| %s | %18v | %18v | %18v | %18v |\n", time.Now().Format(time.UnixDate),
-			jctx.stats.totalKV,
-			jctx.stats.totalIn,
-			jctx.stats.totalInPayloadLength,
-			jctx.stats.totalInPayloadWireLength)
-		jctx.stats.Unlock()
+			atomic.LoadUint64(&jctx.stats.totalKV),
+			totalIn,
+			atomic.LoadUint64(&jctx.stats.totalInPayloadLength),
+			atomic.LoadUint64(&jctx.stats.totalInPayloadWireLength))
+		if jctx.pipeline != nil {
+			s += jctx.pipeline.stats()
+		}
+		s += jctx.stats.paths.table()
+		s += jctx.stats.paths.sizeTable()
+		s += jctx.stats.gaps.table()
+		s += jctx.drops.stats()
+		s += jctx.transport.stats(jctx)
+		s += runtimeStats()
 		headerCounter++
 		if s != "" {
 			jLog(jctx, fmt.Sprintf("%s\n", s))
 		}
+	})
+}
+
+// started returns the time the stats are counted from
+func (s *statsCtx) started() time.Time {
+	s.Lock()
+	defer s.Unlock()
+	return s.startTime
+}
+
+// reset starts the stats of the worker over: the counters of the packets,
+// of the paths, the sequence gaps and the drops
+func (s *statsCtx) reset(drops *dropCounters) {
+	s.Lock()
+	s.startTime = time.Now()
+	s.Unlock()
+	for _, c := range []*uint64{&s.totalIn, &s.totalKV, &s.totalInPayloadLength, &s.totalInPayloadWireLength, &s.totalInHeaderWireLength} {
+		atomic.StoreUint64(c, 0)
+	}
+	s.paths.reset()
+	s.gaps.reset()
+	drops.reset()
+}
+
+func statsStop(jctx *JCtx) {
+	if jctx.statsTask != nil {
+		jctx.statsTask.stop()
+		jctx.statsTask = nil
 	}
 }
 
@@ -130,18 +165,29 @@ func printSummary(jctx *JCtx) {
 		return
 	}
 
-	endTime := time.Since(jctx.stats.startTime)
+	endTime := time.Since(jctx.stats.started())
+
+	payload := atomic.LoadUint64(&jctx.stats.totalInPayloadLength)
 
 	s := fmt.Sprintf("\nCollector Stats for %s:%d (Run time : %s)\n", jctx.config.Host, jctx.config.Port, endTime)
-	s += fmt.Sprintf("%-12v : in-packets\n", jctx.stats.totalIn)
-	s += fmt.Sprintf("%-12v : data points (KV pairs)\n", jctx.stats.totalKV)
+	s += fmt.Sprintf("%-12v : in-packets\n", atomic.LoadUint64(&jctx.stats.totalIn))
+	s += fmt.Sprintf("%-12v : data points (KV pairs)\n", atomic.LoadUint64(&jctx.stats.totalKV))
 
-	s += fmt.Sprintf("%-12v : in-header wirelength (bytes)\n", jctx.stats.totalInHeaderWireLength)
-	s += fmt.Sprintf("%-12v : in-payload length (bytes)\n", jctx.stats.totalInPayloadLength)
-	s += fmt.Sprintf("%-12v : in-payload wirelength (bytes)\n", jctx.stats.totalInPayloadWireLength)
+	s += fmt.Sprintf("%-12v : in-header wirelength (bytes)\n", atomic.LoadUint64(&jctx.stats.totalInHeaderWireLength))
+	s += fmt.Sprintf("%-12v : in-payload length (bytes)\n", payload)
+	s += fmt.Sprintf("%-12v : in-payload wirelength (bytes)\n", atomic.LoadUint64(&jctx.stats.totalInPayloadWireLength))
 	if uint64(endTime.Seconds()) != 0 {
-		s += fmt.Sprintf("%-12v : throughput (bytes per seconds)\n", jctx.stats.totalInPayloadLength/uint64(endTime.Seconds()))
+		s += fmt.Sprintf("%-12v : throughput (bytes per seconds)\n", payload/uint64(endTime.Seconds()))
+	}
+	if jctx.pipeline != nil {
+		s += jctx.pipeline.stats()
 	}
+	s += jctx.stats.paths.table()
+	s += jctx.stats.paths.sizeTable()
+	s += jctx.stats.gaps.table()
+	s += jctx.drops.stats()
+	s += jctx.transport.stats(jctx)
+	s += runtimeStats()
 
 	s += fmt.Sprintf("\n")
 	jLog(jctx, fmt.Sprintf("\n%s\n", s))
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/stats"
+)
+
+func TestStatsHandlerConns(t *testing.T) {
+	h := &statshandler{jctx: &JCtx{}}
+	before := atomic.LoadInt64(&grpcConns)
+	h.HandleConn(context.Background(), &stats.ConnBegin{Client: true})
+	h.HandleConn(context.Background(), &stats.ConnBegin{Client: true})
+	if got := atomic.LoadInt64(&grpcConns) - before; got != 2 {
+		t.Errorf("after 2 connects: got %d open connections, want 2", got)
+	}
+	h.HandleConn(context.Background(), &stats.ConnEnd{Client: true})
+	if got := atomic.LoadInt64(&grpcConns) - before; got != 1 {
+		t.Errorf("after a disconnect: got %d open connections, want 1", got)
+	}
+	h.HandleConn(context.Background(), &stats.ConnEnd{Client: true})
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"net/http"
+)
+
+// statusPageHandler serves the status page of the workers on /, the page
+// polls /health and /events and pauses and resumes with /pause and /resume
+func statusPageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(statusPage))
+}
+
+// statusPage is self-contained so that it works without internet access
+const statusPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>jtimon</title>
+<style>
+body { font-family: sans-serif; margin: 1.5em; color: #222; }
+h1 { font-size: 1.3em; }
+h2 { font-size: 1.1em; margin-top: 1.5em; }
+table { border-collapse: collapse; }
+th, td { padding: 0.3em 0.8em; border-bottom: 1px solid #ddd; text-align: left; vertical-align: top; }
+td.num { text-align: right; }
+.connected { color: #1a7f37; }
+.stale, .paused { color: #9a6700; }
+.disconnected { color: #cf222e; }
+#error { color: #cf222e; }
+small { color: #666; }
+</style>
+</head>
+<body>
+<h1>jtimon <small id="updated"></small></h1>
+<p id="error"></p>
+<table>
+<thead><tr><th>Device</th><th>State</th><th>Last data</th><th>Packets/s</th><th>Points/s</th><th>Reconnects</th><th>Paths</th><th></th></tr></thead>
+<tbody id="devices"></tbody>
+</table>
+<h2>Recent errors</h2>
+<table>
+<thead><tr><th>Time</th><th>Device</th><th>Type</th><th>Message</th></tr></thead>
+<tbody id="events"></tbody>
+</table>
+<script>
+"use strict";
+var interval = 5000, last = {};
+
+function cell(row, text, cls) {
+  var td = document.createElement("td");
+  td.textContent = text;
+  if (cls) td.className = cls;
+  row.appendChild(td);
+  return td;
+}
+
+function state(d) {
+  if (d.paused) return "paused";
+  if (!d.connected) return "disconnected";
+  return d.stale ? "stale" : "connected";
+}
+
+function age(t) {
+  if (!t) return "never";
+  var s = Math.max(0, Math.round((Date.now() - Date.parse(t)) / 1000));
+  return s < 60 ? s + "s ago" : Math.round(s / 60) + "m ago";
+}
+
+function rate(key, now, n) {
+  var prev = last[key];
+  last[key] = {time: now, n: n};
+  if (!prev || n < prev.n) return "";
+  return ((n - prev.n) / ((now - prev.time) / 1000)).toFixed(1);
+}
+
+function get(url) {
+  return fetch(url, {credentials: "same-origin"}).then(function (r) {
+    if (!r.ok) throw new Error(url + ": " + r.status + " " + r.statusText);
+    return r.json();
+  });
+}
+
+function pause(d, paused) {
+  fetch((paused ? "/pause" : "/resume") + "?device=" + encodeURIComponent(d.device),
+    {method: "POST", credentials: "same-origin"}).then(refresh);
+}
+
+function showDevices(devices) {
+  var now = Date.now(), tbody = document.getElementById("devices");
+  tbody.textContent = "";
+  devices.forEach(function (d) {
+    var key = d.device + ":" + d.port, row = document.createElement("tr");
+    cell(row, key);
+    cell(row, state(d), state(d));
+    cell(row, age(d["last-data"]));
+    cell(row, rate(key + "/packets", now, d.packets), "num");
+    cell(row, rate(key + "/points", now, d.points), "num");
+    cell(row, d.reconnects, "num");
+    cell(row, d.paths.join(" "));
+    var button = document.createElement("button");
+    button.textContent = d.paused ? "Resume" : "Pause";
+    button.onclick = function () { pause(d, !d.paused); };
+    cell(row, "").appendChild(button);
+    tbody.appendChild(row);
+  });
+}
+
+function showEvents(devices) {
+  var events = [], tbody = document.getElementById("events");
+  devices.forEach(function (d) {
+    d.events.forEach(function (e) {
+      if (e.type === "error" || e.type === "disconnect" || e.type === "stale") {
+        e.device = d.device + ":" + d.port;
+        events.push(e);
+      }
+    });
+  });
+  events.sort(function (a, b) { return Date.parse(b.time) - Date.parse(a.time); });
+  tbody.textContent = "";
+  events.slice(0, 20).forEach(function (e) {
+    var row = document.createElement("tr");
+    cell(row, new Date(e.time).toLocaleString());
+    cell(row, e.device);
+    cell(row, e.code ? e.type + " (" + e.code + ")" : e.type);
+    cell(row, e.message || "");
+    tbody.appendChild(row);
+  });
+}
+
+function refresh() {
+  Promise.all([get("/health"), get("/events")]).then(function (r) {
+    showDevices(r[0].devices);
+    showEvents(r[1].devices);
+    document.getElementById("error").textContent = "";
+    document.getElementById("updated").textContent = new Date().toLocaleTimeString();
+  }).catch(function (err) {
+    document.getElementById("error").textContent = err.message;
+  });
+}
+
+refresh();
+setInterval(refresh, interval);
+</script>
+</body>
+</html>
+`
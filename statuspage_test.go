@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStatusPageHandler(t *testing.T) {
+	tests := []struct {
+		method string
+		url    string
+		code   int
+	}{
+		{method: "GET", url: "/", code: http.StatusOK},
+		{method: "POST", url: "/", code: http.StatusMethodNotAllowed},
+		{method: "GET", url: "/index.html", code: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		statusPageHandler(rec, httptest.NewRequest(test.method, test.url, nil))
+		if rec.Code != test.code {
+			t.Errorf("%s %s: got code %d, want %d", test.method, test.url, rec.Code, test.code)
+			continue
+		}
+		if test.code != http.StatusOK {
+			continue
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Errorf("got content type %s", ct)
+		}
+		for _, want := range []string{`get("/health")`, `get("/events")`, `"/pause"`, `"/resume"`} {
+			if !strings.Contains(rec.Body.String(), want) {
+				t.Errorf("the page does not use %s", want)
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/nileshsimaria/jtimon/multi-vendor/cisco/iosxr/telemetry-proto"
+)
+
+// telemetryDataGpbkv is the field number of the data_gpbkv rows of the Cisco
+// telemetry message
+const telemetryDataGpbkv = 11
+
+var errTruncated = errors.New("truncated protobuf message")
+
+// walkWire calls fn for every top-level field of the protobuf message b with
+// the encoded field (key and value) and, for length delimited fields, its
+// value. Nothing is decoded beyond the field boundaries.
+func walkWire(b []byte, fn func(num uint64, raw, value []byte) error) error {
+	for i := 0; i < len(b); {
+		start := i
+		key, n := proto.DecodeVarint(b[i:])
+		if n == 0 {
+			return errTruncated
+		}
+		i += n
+
+		var value []byte
+		switch key & 7 {
+		case proto.WireVarint:
+			if _, n = proto.DecodeVarint(b[i:]); n == 0 {
+				return errTruncated
+			}
+			i += n
+		case proto.WireFixed64:
+			i += 8
+		case proto.WireFixed32:
+			i += 4
+		case proto.WireBytes:
+			l, n := proto.DecodeVarint(b[i:])
+			if n == 0 || l > uint64(len(b)-i-n) {
+				return errTruncated
+			}
+			i += n
+			value = b[i : i+int(l)]
+			i += int(l)
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d", key&7)
+		}
+		if i > len(b) {
+			return errTruncated
+		}
+
+		if err := fn(key>>3, b[start:i], value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// telemetryHeader decodes the Cisco telemetry message b without its
+// data_gpbkv rows
+func telemetryHeader(b []byte) (*telemetry.Telemetry, error) {
+	var header []byte
+	err := walkWire(b, func(num uint64, raw, value []byte) error {
+		if num != telemetryDataGpbkv {
+			header = append(header, raw...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	message := new(telemetry.Telemetry)
+	if err := proto.Unmarshal(header, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// telemetryRows decodes the data_gpbkv rows of the Cisco telemetry message b
+// one at a time, so that only one row is materialized at any time however
+// big the message is
+func telemetryRows(b []byte, fn func(*telemetry.TelemetryField)) error {
+	return walkWire(b, func(num uint64, raw, value []byte) error {
+		if num != telemetryDataGpbkv {
+			return nil
+		}
+		row := new(telemetry.TelemetryField)
+		if err := proto.Unmarshal(value, row); err != nil {
+			return err
+		}
+		fn(row)
+		return nil
+	})
+}
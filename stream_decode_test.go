@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/nileshsimaria/jtimon/multi-vendor/cisco/iosxr/telemetry-proto"
+)
+
+func streamTestMessage(rows int) *telemetry.Telemetry {
+	message := &telemetry.Telemetry{
+		NodeId:              &telemetry.Telemetry_NodeIdStr{NodeIdStr: "xr-1"},
+		Subscription:        &telemetry.Telemetry_SubscriptionIdStr{SubscriptionIdStr: "sub-1"},
+		EncodingPath:        "Cisco-IOS-XR-infra-statsd-oper:infra-statistics/interfaces/interface/latest/generic-counters",
+		CollectionId:        42,
+		CollectionStartTime: 1000,
+		MsgTimestamp:        1001,
+		CollectionEndTime:   1002,
+	}
+	for i := 0; i < rows; i++ {
+		message.DataGpbkv = append(message.DataGpbkv, &telemetry.TelemetryField{
+			Timestamp: uint64(i),
+			Fields: []*telemetry.TelemetryField{
+				{Name: "keys", Fields: []*telemetry.TelemetryField{
+					{Name: "interface-name", ValueByType: &telemetry.TelemetryField_StringValue{StringValue: fmt.Sprintf("Gi0/0/0/%d", i)}},
+				}},
+				{Name: "content", Fields: []*telemetry.TelemetryField{
+					{Name: "bytes-received", ValueByType: &telemetry.TelemetryField_Uint64Value{Uint64Value: uint64(i * 100)}},
+				}},
+			},
+		})
+	}
+	return message
+}
+
+func TestTelemetryStreamDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		rows int
+	}{
+		{"no-rows", 0},
+		{"one-row", 1},
+		{"many-rows", 1000},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message := streamTestMessage(test.rows)
+			b, err := proto.Marshal(message)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			header, err := telemetryHeader(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := *message
+			want.DataGpbkv = nil
+			if !proto.Equal(header, &want) {
+				t.Errorf("header mismatch\ngot  %v\nwant %v", header, &want)
+			}
+
+			i := 0
+			err = telemetryRows(b, func(row *telemetry.TelemetryField) {
+				if i >= len(message.DataGpbkv) || !proto.Equal(row, message.DataGpbkv[i]) {
+					t.Errorf("row %d mismatch: %v", i, row)
+				}
+				i++
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i != test.rows {
+				t.Errorf("got %d rows, want %d", i, test.rows)
+			}
+		})
+	}
+}
+
+func TestTelemetryStreamDecodeTruncated(t *testing.T) {
+	b, err := proto.Marshal(streamTestMessage(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{1, len(b) / 2, len(b) - 1} {
+		if err := telemetryRows(b[:n], func(*telemetry.TelemetryField) {}); err == nil {
+			t.Errorf("no error for message truncated to %d of %d bytes", n, len(b))
+		}
+	}
+}
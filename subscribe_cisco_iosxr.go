@@ -7,11 +7,15 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
+	"time"
 	"unicode"
 
 	"github.com/golang/protobuf/proto"
@@ -46,6 +50,10 @@ func (c *loginCreds) RequireTransportSecurity() bool {
 }
 
 func dialExtensionXR(jctx *JCtx) grpc.DialOption {
+	// the credentials of auth per-rpc require TLS
+	if authMode(jctx.config) == AuthPerRPC {
+		return nil
+	}
 	if jctx.config.User != "" && jctx.config.Password != "" {
 		return grpc.WithPerRPCCredentials(&loginCreds{
 			Username:   jctx.config.User,
@@ -61,11 +69,121 @@ type schema struct {
 	nodes [][]*schemaNode
 }
 
-// schemaNode holds individual JSON schema
+// schemaNode holds individual JSON schema. Type of leaves (int, uint, float,
+// string, bool or identityref) converts the value, enum maps raw values to
+// names.
 type schemaNode struct {
-	Name string        `json:"name"`
-	Key  bool          `json:"key"`
-	Kids []*schemaNode `json:"kids"`
+	Name string            `json:"name"`
+	Key  bool              `json:"key"`
+	Type string            `json:"type"`
+	Enum map[string]string `json:"enum"`
+	Kids []*schemaNode     `json:"kids"`
+}
+
+// value types v as given by the schema, v is returned as it is if it can
+// not be converted
+func (snode *schemaNode) value(v interface{}) interface{} {
+	if snode == nil {
+		return v
+	}
+	raw := fmt.Sprint(v)
+	if name, ok := snode.Enum[raw]; ok {
+		return name
+	}
+
+	switch snode.Type {
+	case "identityref":
+		// module-name:IDENTITY
+		if s, ok := v.(string); ok {
+			return s[strings.LastIndex(s, ":")+1:]
+		}
+	case "string":
+		return raw
+	case "int":
+		if i, ok := intValue(v); ok {
+			return i
+		}
+	case "uint":
+		if u, ok := uintValue(v); ok {
+			return u
+		}
+	case "float":
+		if f, _, ok := numericValue(v); ok {
+			return f
+		}
+		if f, err := strconv.ParseFloat(raw, 64); err == nil {
+			return f
+		}
+	case "bool":
+		if b, err := strconv.ParseBool(raw); err == nil {
+			return b
+		}
+	}
+	return v
+}
+
+// intValue returns v as an int64 if it is an integer in its range, a whole
+// float or a decimal string
+func intValue(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v, true
+	case int32:
+		return int64(v), true
+	case int:
+		return int64(v), true
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v), true
+		}
+	case uint32:
+		return int64(v), true
+	case float64:
+		if v == math.Trunc(v) && v >= math.MinInt64 && v < math.MaxInt64 {
+			return int64(v), true
+		}
+	case float32:
+		return intValue(float64(v))
+	case string:
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// uintValue returns v as an uint64 if it is a non-negative integer, a whole
+// float or a decimal string
+func uintValue(v interface{}) (uint64, bool) {
+	switch v := v.(type) {
+	case uint64:
+		return v, true
+	case uint32:
+		return uint64(v), true
+	case int64:
+		if v >= 0 {
+			return uint64(v), true
+		}
+	case int32:
+		if v >= 0 {
+			return uint64(v), true
+		}
+	case int:
+		if v >= 0 {
+			return uint64(v), true
+		}
+	case float64:
+		if v == math.Trunc(v) && v >= 0 && v < math.MaxUint64 {
+			return uint64(v), true
+		}
+	case float32:
+		return uintValue(float64(v))
+	case string:
+		if u, err := strconv.ParseUint(v, 10, 64); err == nil {
+			return u, true
+		}
+	}
+	return 0, false
 }
 
 func (snode *schemaNode) String() string {
@@ -194,7 +312,7 @@ func transformPath(path string) string {
 	return path
 }
 
-func handleOnePath(schema *schema, id int64, path string, conn *grpc.ClientConn, jctx *JCtx, statusch chan<- bool, datach chan<- struct{}) {
+func handleOnePath(schema *schema, nsRules []namespaceRule, id int64, path string, conn *grpc.ClientConn, jctx *JCtx, statusch chan<- bool, datach chan<- struct{}) {
 	c := pb.NewGRPCConfigOperClient(conn)
 
 	jLog(jctx, fmt.Sprintf("path transformation: %s --> %s", path, transformPath(path)))
@@ -206,14 +324,14 @@ func handleOnePath(schema *schema, id int64, path string, conn *grpc.ClientConn,
 
 	stream, err := c.CreateSubs(context.Background(), &subsArg)
 	if err != nil {
-		jLog(jctx, fmt.Sprintf("Could not create subscription: %v (retry)", err))
+		jLogWarn(jctx, fmt.Sprintf("Could not create subscription: %v (retry)", err))
 		datach <- struct{}{}
 		return
 	}
 
 	hdr, errh := stream.Header()
 	if errh != nil {
-		jLog(jctx, fmt.Sprintf("Failed to get header for stream: %v", errh))
+		jLogWarn(jctx, fmt.Sprintf("Failed to get header for stream: %v", errh))
 	}
 
 	jLog(jctx, fmt.Sprintf("gRPC headers from host %s:%d\n", jctx.config.Host, jctx.config.Port))
@@ -225,69 +343,102 @@ func handleOnePath(schema *schema, id int64, path string, conn *grpc.ClientConn,
 	statusch <- true
 	// Go Routine which actually starts the streaming connection and receives the data
 	jLog(jctx, fmt.Sprintf("Receiving telemetry data from %s:%d\n", jctx.config.Host, jctx.config.Port))
+	priority := jctx.paths.lookup(path)
 	for {
 		d, err := stream.Recv()
 		if err == io.EOF {
+			streamEnded(jctx, err)
 			datach <- struct{}{}
 			return
 		}
 		if err != nil {
-			jLog(jctx, fmt.Sprintf("%v.CreateSubs(_) = _, %v", conn, err))
+			jLogError(jctx, "", fmt.Sprintf("%v.CreateSubs(_) = _", conn), err)
+			streamEnded(jctx, err)
 			datach <- struct{}{}
 			return
 		}
-		message := new(telemetry.Telemetry)
-		err = proto.Unmarshal(d.GetData(), message)
+		packetReceived(jctx)
+		captureMessage(jctx, d.GetData())
+		if shedUpdate(jctx, priority) {
+			continue
+		}
+		data := d.GetData()
+		// big messages are decoded one row at a time
+		streamed := jctx.config.Vendor.StreamDecode > 0 && len(data) >= jctx.config.Vendor.StreamDecode
+		var message *telemetry.Telemetry
+		if streamed {
+			message, err = telemetryHeader(data)
+		} else {
+			message = new(telemetry.Telemetry)
+			err = proto.Unmarshal(data, message)
+		}
 		if err != nil {
-			jLog(jctx, fmt.Sprintf("Can not unmarshal proto message:\n%q\n", message))
+			atomic.AddUint64(&jctx.metrics.decodeErrs, 1)
+			quarantine(jctx, wireSensor(data, ciscoPathField, path), data, err)
 			continue
 		}
+		rows := func(fn func(*telemetry.TelemetryField)) {
+			for _, field := range message.GetDataGpbkv() {
+				fn(field)
+			}
+		}
+		if streamed {
+			rows = func(fn func(*telemetry.TelemetryField)) {
+				if err := telemetryRows(data, fn); err != nil {
+					atomic.AddUint64(&jctx.metrics.decodeErrs, 1)
+					quarantine(jctx, wireSensor(data, ciscoPathField, path), data, err)
+				}
+			}
+		}
 		if *genTestData {
 			generateTestData(jctx, d.GetData())
 		}
-		jLog(jctx, fmt.Sprintf("Received telemetry data from %v (vendor - cisco)", jctx.config.Host))
+		jLogDebug(jctx, fmt.Sprintf("Received telemetry data from %v (vendor - cisco)", jctx.config.Host))
 
 		path := message.GetEncodingPath()
 		if path == "" {
-			jLog(jctx, "Device did not send encoding path - ignoring this message")
+			jLogWarn(jctx, "Device did not send encoding path - ignoring this message")
 			continue
 		}
+		if pathStatsEnabled(jctx) {
+			// rows of streamed messages are not counted up front
+			updatePathStats(jctx, path, len(message.GetDataGpbkv()), len(data), message.GetMsgTimestamp(), time.Now())
+		}
 
+		ns := matchNamespaces(nsRules, jctx.config.Vendor, path)
 		ePath := strings.Split(path, "/")
 		if len(ePath) == 1 {
-			jLog(jctx, fmt.Sprintf("The message matched with top-level subscription %s\n", ePath))
+			jLogDebug(jctx, fmt.Sprintf("The message matched with top-level subscription %s\n", ePath))
 			for _, nodes := range schema.nodes {
 				for _, node := range nodes {
 					if strings.Compare(ePath[0], node.Name) == 0 {
-						for _, fields := range message.GetDataGpbkv() {
+						rows(func(fields *telemetry.TelemetryField) {
 							parentPath := []string{node.Name}
-							processTopLevelMsg(jctx, node, fields, parentPath)
-						}
+							processTopLevelMsg(jctx, ns, node, fields, parentPath)
+						})
 					}
 				}
 			}
 		} else if len(ePath) >= 2 {
-			jLog(jctx, fmt.Sprintf("Multi level path %s", ePath))
+			jLogDebug(jctx, fmt.Sprintf("Multi level path %s", ePath))
 			for _, nodes := range schema.nodes {
 				for _, node := range nodes {
 					if strings.Compare(ePath[0], node.Name) == 0 {
-						if jctx.config.Vendor.RemoveNS {
-							strs := strings.Split(ePath[0], ":")
-							if len(strs) == 2 {
-								ePath[0] = strs[1]
-							}
-						}
-
-						processMultiLevelMsg(jctx, node, ePath, message)
+						ePath[0] = ns.elem(ePath[0])
+						rows(func(m *telemetry.TelemetryField) {
+							processMultiLevelField(jctx, ns, node, ePath, m)
+						})
 					}
 				}
 			}
 
 		}
 
-		if jctx.config.Log.Verbose {
-			jLog(jctx, fmt.Sprintf("%q", message))
-			printFields(jctx, message.GetDataGpbkv(), nil)
+		if IsVerboseLogging(jctx) {
+			jLogDebug(jctx, fmt.Sprintf("%q", message))
+			rows(func(field *telemetry.TelemetryField) {
+				printFields(jctx, ns, []*telemetry.TelemetryField{field}, nil)
+			})
 		}
 	}
 }
@@ -295,20 +446,26 @@ func handleOnePath(schema *schema, id int64, path string, conn *grpc.ClientConn,
 func subscribeXR(conn *grpc.ClientConn, jctx *JCtx, statusch chan<- bool) SubErrorCode {
 	schema, err := getXRSchema(jctx)
 	if err != nil {
-		jLog(jctx, fmt.Sprintf("%s", err))
+		jLogError(jctx, "", "Could not get the schema", err)
 		return SubRcConnRetry
 	}
 
-	jLog(jctx, fmt.Sprintf("%s", schema))
+	jLogDebug(jctx, fmt.Sprintf("%s", schema))
+
+	nsRules, err := newNamespaceRules(jctx.config.Vendor)
+	if err != nil {
+		jLogError(jctx, "", "Invalid vendor namespaces", err)
+		return SubRcConnRetry
+	}
 
 	datach := make(chan struct{})
 	id, err := strconv.ParseInt(jctx.config.CID, 10, 64)
 	if err != nil {
-		jLog(jctx, fmt.Sprintf("can not convert CID - %s to int64", jctx.config.CID))
+		jLogError(jctx, "", fmt.Sprintf("can not convert CID - %s to int64", jctx.config.CID), nil)
 	}
 
-	for index, path := range jctx.config.Paths {
-		go handleOnePath(schema, id+int64(index), path.Path, conn, jctx, statusch, datach)
+	for index, path := range jctx.paused.active(jctx.config.Paths) {
+		go handleOnePath(schema, nsRules, id+int64(index), path.Path, conn, jctx, statusch, datach)
 	}
 
 	for {
@@ -466,18 +623,22 @@ func multiLevelMsgTags(jctx *JCtx, node *schemaNode, ePath []string, m *telemetr
 	return tags, node
 }
 
-func processMultiLevelMsg(jctx *JCtx, node *schemaNode, ePath []string, message *telemetry.Telemetry) {
+func processMultiLevelMsg(jctx *JCtx, ns namespaces, node *schemaNode, ePath []string, message *telemetry.Telemetry) {
 	for _, m := range message.GetDataGpbkv() {
-		tags, matchedNode := multiLevelMsgTags(jctx, node, ePath, m)
-		content := getContentFromMessage(jctx, m)
-		if content == nil {
-			continue
-		}
-		walk(jctx, matchedNode, content.GetFields(), ePath, tags)
+		processMultiLevelField(jctx, ns, node, ePath, m)
 	}
 }
 
-func processTopLevelMsg(jctx *JCtx, node *schemaNode, field *telemetry.TelemetryField, parentPath []string) {
+func processMultiLevelField(jctx *JCtx, ns namespaces, node *schemaNode, ePath []string, m *telemetry.TelemetryField) {
+	tags, matchedNode := multiLevelMsgTags(jctx, node, ePath, m)
+	content := getContentFromMessage(jctx, m)
+	if content == nil {
+		return
+	}
+	walk(jctx, ns, matchedNode, content.GetFields(), ePath, tags)
+}
+
+func processTopLevelMsg(jctx *JCtx, ns namespaces, node *schemaNode, field *telemetry.TelemetryField, parentPath []string) {
 	content := getContentFromMessage(jctx, field)
 
 	if content != nil {
@@ -496,7 +657,7 @@ func processTopLevelMsg(jctx *JCtx, node *schemaNode, field *telemetry.Telemetry
 				value: "cisco",
 			},
 		}
-		walk(jctx, node, content.GetFields(), parentPath, tags)
+		walk(jctx, ns, node, content.GetFields(), parentPath, tags)
 	}
 }
 
@@ -509,23 +670,25 @@ func (k keyInfo) String() string {
 	return fmt.Sprintf("key=%s value=%s", k.key, k.value)
 }
 
-func walk(jctx *JCtx, n *schemaNode, f []*telemetry.TelemetryField, p []string, tags []keyInfo) {
+func walk(jctx *JCtx, ns namespaces, n *schemaNode, f []*telemetry.TelemetryField, p []string, tags []keyInfo) {
 	var matchedNode *schemaNode
 	newTags := tags
 
 	for _, field := range f {
 		name := field.GetName()
+		var leaf *schemaNode
 		if n != nil {
 			for _, node := range n.Kids {
 				if name == node.Name {
 					if node.Key {
 						kinfo := keyInfo{
-							key:   fmt.Sprintf("%s@%s", getParentPath(p, jctx.config.Vendor.RemoveNS), name),
-							value: getFieldStringValue(field),
+							key:   fmt.Sprintf("%s@%s", getParentPath(p, ns), name),
+							value: fmt.Sprint(node.value(getFieldStringValue(field))),
 						}
 						newTags = append(tags, kinfo)
 					}
 					matchedNode = node
+					leaf = node
 				}
 			}
 		}
@@ -533,11 +696,11 @@ func walk(jctx *JCtx, n *schemaNode, f []*telemetry.TelemetryField, p []string,
 		switch field.GetFields() {
 		case nil:
 
-			k := getParentPath(p, jctx.config.Vendor.RemoveNS) + field.GetName()
+			k := getParentPath(p, ns) + field.GetName()
 			v := getFieldStringValue(field)
-			if jctx.config.Log.Verbose {
-				jLog(jctx, fmt.Sprintf("\nTAGS: %v\n", newTags))
-				jLog(jctx, fmt.Sprintf("\nPOINT: %s = %s\n", k, v))
+			if IsVerboseLogging(jctx) {
+				jLogDebug(jctx, fmt.Sprintf("\nTAGS: %v\n", newTags))
+				jLogDebug(jctx, fmt.Sprintf("\nPOINT: %s = %s\n", k, v))
 			}
 
 			if *genTestData {
@@ -559,9 +722,24 @@ func walk(jctx *JCtx, n *schemaNode, f []*telemetry.TelemetryField, p []string,
 			for _, t := range newTags {
 				tagsM[t.key] = t.value
 			}
-			fieldsM[k] = getFieldValueInterface(field)
-			m := newMetricIDB(tagsM, fieldsM)
-			m.accumulate(jctx)
+			fieldsM[k] = leaf.value(getFieldValueInterface(field))
+
+			mName := jctx.config.Influx.Measurement
+			if mName == "" {
+				mName = tagsM["sensor"]
+			}
+			points := applyTransforms(jctx, []*point{newPoint(mName, tagsM, fieldsM, time.Now())})
+			for _, p := range points {
+				// pointAcculumator merges into the fields so it gets its own copy
+				m := newMetricIDB(p.Tags, copyFields(p.Fields))
+				m.accumulate(jctx)
+			}
+			tailPoints(jctx, points)
+			keepRecent(jctx, points)
+			if len(jctx.sinks) != 0 {
+				writeSinks(jctx, points)
+			}
+			pointsExported(jctx, len(points), time.Time{})
 
 		default:
 			var q []string
@@ -574,28 +752,76 @@ func walk(jctx *JCtx, n *schemaNode, f []*telemetry.TelemetryField, p []string,
 			if field.GetName() != "" {
 				q = append(p, field.GetName())
 			}
-			walk(jctx, matchedNode, field.GetFields(), q, newTags)
+			walk(jctx, ns, matchedNode, field.GetFields(), q, newTags)
 		}
 	}
 }
 
-func getParentPath(p []string, ns bool) string {
-	if ns {
-		for index, path := range p {
-			s := strings.Split(path, ":")
-			if len(s) == 2 {
-				p[index] = s[1]
-			}
+// namespaces tells how module names (namespaces) of path elements are
+// written, map renames modules (empty name drops the namespace) and remove
+// drops the namespace of all other modules
+type namespaces struct {
+	remove bool
+	remap  map[string]string
+}
+
+func (ns namespaces) elem(e string) string {
+	i := strings.Index(e, ":")
+	if i < 0 {
+		return e
+	}
+	if alias, ok := ns.remap[e[:i]]; ok {
+		if alias == "" {
+			return e[i+1:]
+		}
+		return alias + e[i:]
+	}
+	if ns.remove {
+		return e[i+1:]
+	}
+	return e
+}
+
+type namespaceRule struct {
+	re *regexp.Regexp
+	ns namespaces
+}
+
+func newNamespaceRules(cfg VendorConfig) ([]namespaceRule, error) {
+	var rules []namespaceRule
+	for i, n := range cfg.Namespaces {
+		re, err := regexp.Compile(n.Path)
+		if err != nil {
+			return nil, fmt.Errorf("vendor namespaces %d: invalid path %q: %v", i, n.Path, err)
 		}
+		rules = append(rules, namespaceRule{re: re, ns: namespaces{remove: n.Remove, remap: n.Map}})
+	}
+	return rules, nil
+}
+
+// matchNamespaces returns the namespace handling of the encoding path, the
+// first matching rule wins, without one remove-namespace applies
+func matchNamespaces(rules []namespaceRule, cfg VendorConfig, path string) namespaces {
+	for _, r := range rules {
+		if r.re.MatchString(path) {
+			return r.ns
+		}
+	}
+	return namespaces{remove: cfg.RemoveNS}
+}
+
+func getParentPath(p []string, ns namespaces) string {
+	for index, path := range p {
+		p[index] = ns.elem(path)
 	}
 	return "/" + strings.Join(p, "/") + "/"
 }
 
-func printFields(jctx *JCtx, fields []*telemetry.TelemetryField, parentPath []string) {
+func printFields(jctx *JCtx, ns namespaces, fields []*telemetry.TelemetryField, parentPath []string) {
 	for _, field := range fields {
 		switch field.GetFields() {
 		case nil:
-			printOneField(jctx, field, parentPath)
+			printOneField(jctx, ns, field, parentPath)
 		default:
 			// we need new parent path so that when recursion winds down we get the
 			// correct parent path. It's recursive code so when it calls itself,
@@ -606,30 +832,30 @@ func printFields(jctx *JCtx, fields []*telemetry.TelemetryField, parentPath []st
 			if field.GetName() != "" {
 				newParentPath = append(parentPath, field.GetName())
 			}
-			printFields(jctx, field.GetFields(), newParentPath)
+			printFields(jctx, ns, field.GetFields(), newParentPath)
 		}
 	}
 }
 
 // print one field (or one leaf). A leaf carries data.
-func printOneField(jctx *JCtx, field *telemetry.TelemetryField, parentPath []string) {
+func printOneField(jctx *JCtx, ns namespaces, field *telemetry.TelemetryField, parentPath []string) {
 	switch field.GetValueByType().(type) {
 	case *telemetry.TelemetryField_StringValue:
-		jLog(jctx, fmt.Sprintf("%s%s: %s\n", getParentPath(parentPath, jctx.config.Vendor.RemoveNS), field.GetName(), field.GetStringValue()))
+		jLogDebug(jctx, fmt.Sprintf("%s%s: %s\n", getParentPath(parentPath, ns), field.GetName(), field.GetStringValue()))
 	case *telemetry.TelemetryField_BoolValue:
-		jLog(jctx, fmt.Sprintf("%s%s: %v\n", getParentPath(parentPath, jctx.config.Vendor.RemoveNS), field.GetName(), field.GetBoolValue()))
+		jLogDebug(jctx, fmt.Sprintf("%s%s: %v\n", getParentPath(parentPath, ns), field.GetName(), field.GetBoolValue()))
 	case *telemetry.TelemetryField_Uint32Value:
-		jLog(jctx, fmt.Sprintf("%s%s: %v\n", getParentPath(parentPath, jctx.config.Vendor.RemoveNS), field.GetName(), field.GetUint32Value()))
+		jLogDebug(jctx, fmt.Sprintf("%s%s: %v\n", getParentPath(parentPath, ns), field.GetName(), field.GetUint32Value()))
 	case *telemetry.TelemetryField_Uint64Value:
-		jLog(jctx, fmt.Sprintf("%s%s: %v\n", getParentPath(parentPath, jctx.config.Vendor.RemoveNS), field.GetName(), field.GetUint64Value()))
+		jLogDebug(jctx, fmt.Sprintf("%s%s: %v\n", getParentPath(parentPath, ns), field.GetName(), field.GetUint64Value()))
 	case *telemetry.TelemetryField_BytesValue:
-		jLog(jctx, fmt.Sprintf("%s%s: %v\n", getParentPath(parentPath, jctx.config.Vendor.RemoveNS), field.GetName(), field.GetBytesValue()))
+		jLogDebug(jctx, fmt.Sprintf("%s%s: %v\n", getParentPath(parentPath, ns), field.GetName(), field.GetBytesValue()))
 	case *telemetry.TelemetryField_Sint32Value:
-		jLog(jctx, fmt.Sprintf("%s%s: %v\n", getParentPath(parentPath, jctx.config.Vendor.RemoveNS), field.GetName(), field.GetSint32Value()))
+		jLogDebug(jctx, fmt.Sprintf("%s%s: %v\n", getParentPath(parentPath, ns), field.GetName(), field.GetSint32Value()))
 	case *telemetry.TelemetryField_Sint64Value:
-		jLog(jctx, fmt.Sprintf("%s%s: %v\n", getParentPath(parentPath, jctx.config.Vendor.RemoveNS), field.GetName(), field.GetSint64Value()))
+		jLogDebug(jctx, fmt.Sprintf("%s%s: %v\n", getParentPath(parentPath, ns), field.GetName(), field.GetSint64Value()))
 	case *telemetry.TelemetryField_DoubleValue:
-		jLog(jctx, fmt.Sprintf("%s%s: %v\n", getParentPath(parentPath, jctx.config.Vendor.RemoveNS), field.GetName(), field.GetDoubleValue()))
+		jLogDebug(jctx, fmt.Sprintf("%s%s: %v\n", getParentPath(parentPath, ns), field.GetName(), field.GetDoubleValue()))
 	default:
 	}
 }
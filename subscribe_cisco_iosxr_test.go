@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
@@ -151,6 +152,7 @@ func TestXRInflux(t *testing.T) {
 						continue
 					}
 
+					ns := matchNamespaces(nil, jctx.config.Vendor, path)
 					ePath := strings.Split(path, "/")
 					if len(ePath) == 1 {
 						for _, nodes := range schema.nodes {
@@ -158,7 +160,7 @@ func TestXRInflux(t *testing.T) {
 								if strings.Compare(ePath[0], node.Name) == 0 {
 									for _, fields := range message.GetDataGpbkv() {
 										parentPath := []string{node.Name}
-										processTopLevelMsg(jctx, node, fields, parentPath)
+										processTopLevelMsg(jctx, ns, node, fields, parentPath)
 									}
 								}
 							}
@@ -167,7 +169,7 @@ func TestXRInflux(t *testing.T) {
 						for _, nodes := range schema.nodes {
 							for _, node := range nodes {
 								if strings.Compare(ePath[0], node.Name) == 0 {
-									processMultiLevelMsg(jctx, node, ePath, message)
+									processMultiLevelMsg(jctx, ns, node, ePath, message)
 								}
 							}
 						}
@@ -270,6 +272,7 @@ func TestXRTagsPoints(t *testing.T) {
 						continue
 					}
 
+					ns := matchNamespaces(nil, jctx.config.Vendor, path)
 					ePath := strings.Split(path, "/")
 					if len(ePath) == 1 {
 						for _, nodes := range schema.nodes {
@@ -277,7 +280,7 @@ func TestXRTagsPoints(t *testing.T) {
 								if strings.Compare(ePath[0], node.Name) == 0 {
 									for _, fields := range message.GetDataGpbkv() {
 										parentPath := []string{node.Name}
-										processTopLevelMsg(jctx, node, fields, parentPath)
+										processTopLevelMsg(jctx, ns, node, fields, parentPath)
 									}
 								}
 							}
@@ -286,7 +289,7 @@ func TestXRTagsPoints(t *testing.T) {
 						for _, nodes := range schema.nodes {
 							for _, node := range nodes {
 								if strings.Compare(ePath[0], node.Name) == 0 {
-									processMultiLevelMsg(jctx, node, ePath, message)
+									processMultiLevelMsg(jctx, ns, node, ePath, message)
 								}
 							}
 						}
@@ -419,3 +422,71 @@ func TestXRSchema(t *testing.T) {
 		})
 	}
 }
+
+func TestSchemaNodeValue(t *testing.T) {
+	tests := []struct {
+		node *schemaNode
+		in   interface{}
+		want interface{}
+	}{
+		{node: nil, in: uint32(1), want: uint32(1)},
+		{node: &schemaNode{}, in: "x", want: "x"},
+		{node: &schemaNode{Type: "identityref"}, in: "openconfig-if-ethernet:SPEED_100GB", want: "SPEED_100GB"},
+		{node: &schemaNode{Type: "identityref"}, in: "SPEED_100GB", want: "SPEED_100GB"},
+		{node: &schemaNode{Type: "int"}, in: uint32(7), want: int64(7)},
+		{node: &schemaNode{Type: "int"}, in: "-42", want: int64(-42)},
+		{node: &schemaNode{Type: "int"}, in: uint64(18446744073709551557), want: uint64(18446744073709551557)},
+		{node: &schemaNode{Type: "uint"}, in: "42", want: uint64(42)},
+		{node: &schemaNode{Type: "uint"}, in: uint64(18446744073709551557), want: uint64(18446744073709551557)},
+		{node: &schemaNode{Type: "uint"}, in: "18446744073709551557", want: uint64(18446744073709551557)},
+		{node: &schemaNode{Type: "uint"}, in: int64(-1), want: int64(-1)},
+		{node: &schemaNode{Type: "float"}, in: "1.5", want: 1.5},
+		{node: &schemaNode{Type: "float"}, in: "n/a", want: "n/a"},
+		{node: &schemaNode{Type: "string"}, in: uint32(3), want: "3"},
+		{node: &schemaNode{Type: "bool"}, in: "true", want: true},
+		{node: &schemaNode{Enum: map[string]string{"1": "UP", "2": "DOWN"}}, in: uint32(2), want: "DOWN"},
+		{node: &schemaNode{Type: "int", Enum: map[string]string{"1": "UP"}}, in: uint32(3), want: int64(3)},
+	}
+	for _, test := range tests {
+		if got := test.node.value(test.in); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: value(%#v) = %#v, want %#v", test.node, test.in, got, test.want)
+		}
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	cfg := VendorConfig{
+		RemoveNS: true,
+		Namespaces: []VendorNamespace{
+			{Path: "^Cisco-IOS-XR-infra-statsd-oper:", Map: map[string]string{"Cisco-IOS-XR-infra-statsd-oper": "statsd"}},
+			{Path: "^openconfig-", Map: map[string]string{"openconfig-bgp": ""}},
+		},
+	}
+	rules, err := newNamespaceRules(cfg)
+	if err != nil {
+		t.Fatalf("newNamespaceRules failed: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		elem string
+		want string
+	}{
+		{"Cisco-IOS-XR-infra-statsd-oper:infra-statistics/interfaces", "Cisco-IOS-XR-infra-statsd-oper:infra-statistics", "statsd:infra-statistics"},
+		{"Cisco-IOS-XR-infra-statsd-oper:infra-statistics/interfaces", "Cisco-IOS-XR-other:x", "Cisco-IOS-XR-other:x"},
+		{"openconfig-bgp:bgp/neighbors", "openconfig-bgp:bgp", "bgp"},
+		{"openconfig-bgp:bgp/neighbors", "openconfig-interfaces:interfaces", "openconfig-interfaces:interfaces"},
+		{"Cisco-IOS-XR-wdsysmon-fd-oper:system-monitoring", "Cisco-IOS-XR-wdsysmon-fd-oper:system-monitoring", "system-monitoring"},
+		{"Cisco-IOS-XR-wdsysmon-fd-oper:system-monitoring", "cpu-utilization", "cpu-utilization"},
+	}
+	for _, test := range tests {
+		ns := matchNamespaces(rules, cfg, test.path)
+		if got := ns.elem(test.elem); got != test.want {
+			t.Errorf("%s: elem(%s) = %s, want %s", test.path, test.elem, got, test.want)
+		}
+	}
+
+	if _, err := newNamespaceRules(VendorConfig{Namespaces: []VendorNamespace{{Path: "("}}}); err == nil {
+		t.Errorf("want error, got nil")
+	}
+}
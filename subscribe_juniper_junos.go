@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"encoding/json"
@@ -15,7 +16,9 @@ import (
 	na_pb "github.com/nileshsimaria/jtimon/telemetry"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 // SubErrorCode to define the type of errors
@@ -29,7 +32,7 @@ const (
 )
 
 func handleOnePacket(ocData *na_pb.OpenConfigData, jctx *JCtx) {
-	updateStats(jctx, ocData, true)
+	updateStats(jctx, ocData)
 
 	s := ""
 
@@ -53,7 +56,7 @@ func handleOnePacket(ocData *na_pb.OpenConfigData, jctx *JCtx) {
 
 	prefixSeen := false
 	for _, kv := range ocData.Kv {
-		updateStatsKV(jctx, true)
+		updateStatsKV(jctx)
 
 		if *print || (IsVerboseLogging(jctx) && !*print) {
 			s += fmt.Sprintf("  key: %s\n", kv.Key)
@@ -88,7 +91,7 @@ func handleOnePacket(ocData *na_pb.OpenConfigData, jctx *JCtx) {
 		}
 	}
 	if s != "" {
-		jLog(jctx, s)
+		jLogData(jctx, s)
 	}
 }
 
@@ -100,17 +103,18 @@ func handleOnePacket(ocData *na_pb.OpenConfigData, jctx *JCtx) {
 //		- In case of an error, Set the error code to restart the connection.
 func subSendAndReceive(conn *grpc.ClientConn, jctx *JCtx,
 	subReqM na_pb.SubscriptionRequest,
-	statusch chan<- bool) SubErrorCode {
+	statusch chan<- bool, control <-chan os.Signal) SubErrorCode {
 
 	var ctx context.Context
 	c := na_pb.NewOpenConfigTelemetryClient(conn)
-	if jctx.config.Meta {
+	if authMode(jctx.config) == AuthMeta {
 		md := metadata.New(map[string]string{"username": jctx.config.User, "password": jctx.config.Password})
 		ctx = metadata.NewOutgoingContext(context.Background(), md)
 	} else {
 		ctx = context.Background()
 	}
-	stream, err := c.TelemetrySubscribe(ctx, &subReqM)
+	codec := &quarantineCodec{}
+	stream, err := c.TelemetrySubscribe(ctx, &subReqM, grpc.CallCustomCodec(codec))
 
 	if err != nil {
 		return SubRcConnRetry
@@ -118,7 +122,7 @@ func subSendAndReceive(conn *grpc.ClientConn, jctx *JCtx,
 
 	hdr, errh := stream.Header()
 	if errh != nil {
-		jLog(jctx, fmt.Sprintf("Failed to get header for stream: %v", errh))
+		jLogWarn(jctx, fmt.Sprintf("Failed to get header for stream: %v", errh))
 	}
 
 	jLog(jctx, fmt.Sprintf("gRPC headers from host %s:%d\n", jctx.config.Host, jctx.config.Port))
@@ -138,24 +142,40 @@ func subSendAndReceive(conn *grpc.ClientConn, jctx *JCtx,
 			ocData, err := stream.Recv()
 			if err == io.EOF {
 				printSummary(jctx)
+				streamEnded(jctx, err)
 				datach <- struct{}{}
 				return
 			}
 			if err != nil {
-				jLog(jctx, fmt.Sprintf("%v.TelemetrySubscribe(_) = _, %v", conn, err))
+				// gRPC reports messages it can not unmarshal as internal errors
+				if status.Code(err) == codes.Internal {
+					atomic.AddUint64(&jctx.metrics.decodeErrs, 1)
+				}
+				jLogError(jctx, "", fmt.Sprintf("%v.TelemetrySubscribe(_) = _", conn), err)
+				streamEnded(jctx, err)
 				datach <- struct{}{}
 				return
 			}
+			packetReceived(jctx)
+			if data, err := codec.take(); err != nil {
+				atomic.AddUint64(&jctx.metrics.decodeErrs, 1)
+				quarantine(jctx, wireSensor(data, junosPathField, unknownSensor), data, err)
+				continue
+			}
 
-			if *genTestData {
+			if *genTestData || capturing(jctx) {
 				if ocDataM, err := proto.Marshal(ocData); err == nil {
-					generateTestData(jctx, ocDataM)
+					if *genTestData {
+						generateTestData(jctx, ocDataM)
+					}
+					captureMessage(jctx, ocDataM)
 				} else {
-					jLog(jctx, fmt.Sprintf("%v", err))
+					jLogError(jctx, "", "Could not generate test data", err)
 				}
 			}
 
 			rtime := time.Now()
+			checkSequence(jctx, ocData, rtime)
 			if *outJSON {
 				if b, err := json.MarshalIndent(ocData, "", "  "); err == nil {
 					jLog(jctx, fmt.Sprintf("%s\n", b))
@@ -165,12 +185,37 @@ func subSendAndReceive(conn *grpc.ClientConn, jctx *JCtx,
 			if *print || *stateHandler || IsVerboseLogging(jctx) {
 				handleOnePacket(ocData, jctx)
 			}
+			if *explain {
+				explainLog(jctx, ocData, rtime)
+			}
+
+			path, priority := jctx.paths.match(sensorPath(ocData.Path))
+			if pathStatsEnabled(jctx) {
+				if path == "" {
+					path = sensorPath(ocData.Path)
+				}
+				updatePathStats(jctx, path, len(ocData.Kv), proto.Size(ocData), ocData.Timestamp, rtime)
+			}
+			// the previous leader of --ha wrote the updates up to its last
+			// one
+			if *haLock != "" && handoffUpdate(jctx, path, ocData) {
+				continue
+			}
+			if shedUpdate(jctx, priority) {
+				continue
+			}
+
+			tr := startTrace(jctx, sensorPath(ocData.Path), rtime)
+			tr.span("receive", rtime)
 
 			// to influxdb
-			if *noppgoroutines {
-				addIDB(ocData, jctx, rtime)
-			} else {
-				go addIDB(ocData, jctx, rtime)
+			switch {
+			case jctx.pipeline != nil:
+				jctx.pipeline.submit(ocData, rtime, tr)
+			case *noppgoroutines:
+				addIDB(ocData, jctx, rtime, tr)
+			default:
+				go addIDB(ocData, jctx, rtime, tr)
 			}
 
 			// to prometheus
@@ -185,7 +230,7 @@ func subSendAndReceive(conn *grpc.ClientConn, jctx *JCtx,
 	}()
 	for {
 		select {
-		case s := <-jctx.control:
+		case s := <-control:
 			switch s {
 			case syscall.SIGHUP:
 				// config has been updated restart the streaming
@@ -201,33 +246,177 @@ func subSendAndReceive(conn *grpc.ClientConn, jctx *JCtx,
 	}
 }
 
+// junosSubscriptionRequests splits the paths round robin into the
+// subscription requests of the configured number of streams, the sample
+// frequencies lowered by factor. The paths of set, with the frequencies set
+// over the API, come after them in a request each.
+func junosSubscriptionRequests(cfg *Config, factor uint64, set map[string]uint64) []na_pb.SubscriptionRequest {
+	shared := 0
+	for _, p := range cfg.Paths {
+		if _, ok := set[p.Path]; !ok {
+			shared++
+		}
+	}
+	n := cfg.GRPC.Streams
+	if n > shared {
+		n = shared
+	}
+	if n < 1 && (shared != 0 || len(cfg.Paths) == 0) {
+		n = 1
+	}
+
+	freqs := adaptiveFreqs(cfg.Paths, factor)
+	reqs := make([]na_pb.SubscriptionRequest, n)
+	var own []na_pb.SubscriptionRequest
+	j := 0
+	for i := range cfg.Paths {
+		var pathM na_pb.Path
+		pathM.Path = cfg.Paths[i].Path
+		if freq, ok := set[pathM.Path]; ok {
+			pathM.SampleFrequency = uint32(freq)
+			own = append(own, na_pb.SubscriptionRequest{PathList: []*na_pb.Path{&pathM}})
+			continue
+		}
+		pathM.SampleFrequency = uint32(freqs[i])
+		reqs[j%n].PathList = append(reqs[j%n].PathList, &pathM)
+		j++
+	}
+	reqs = append(reqs, own...)
+	for i := range reqs {
+		reqs[i].AdditionalConfig = &na_pb.SubscriptionAdditionalConfig{NeedEos: cfg.EOS}
+	}
+	return reqs
+}
+
 // subscribe routine constructs the subscription paths and calls
 // the function to start the streaming connection.
 //
 // In case of SIGHUP, the paths are formed again and streaming
 // is restarted.
 func subscribeJunos(conn *grpc.ClientConn, jctx *JCtx, statusch chan<- bool) SubErrorCode {
-	var subReqM na_pb.SubscriptionRequest
-	var additionalConfigM na_pb.SubscriptionAdditionalConfig
+	reqs := junosRequests(jctx)
+	jctx.stats.gaps.restart()
+	if len(reqs) == 1 {
+		return subSendAndReceive(conn, jctx, reqs[0], statusch, jctx.control)
+	}
+	return subscribeJunosStreams(conn, jctx, reqs, statusch)
+}
 
-	cfg := &jctx.config
-	for i := range cfg.Paths {
-		var pathM na_pb.Path
-		pathM.Path = cfg.Paths[i].Path
-		pathM.SampleFrequency = uint32(cfg.Paths[i].Freq)
-		subReqM.PathList = append(subReqM.PathList, &pathM)
+// junosRequests returns the subscription requests of the worker, without
+// its paused paths
+func junosRequests(jctx *JCtx) []na_pb.SubscriptionRequest {
+	cfg := jctx.config
+	cfg.Paths = jctx.paused.active(cfg.Paths)
+	return junosSubscriptionRequests(&cfg, jctx.adaptive.current(), jctx.freqs.freqs())
+}
+
+// subscribeJunosStreams receives the subscriptions in parallel streams
+// over the same connection. Signals are passed on to all streams, once one
+// of them returns the others are restarted as well. When the frequency of a
+// path is changed over the API only the stream of the path is restarted,
+// unless the paths move between the streams.
+func subscribeJunosStreams(conn *grpc.ClientConn, jctx *JCtx, reqs []na_pb.SubscriptionRequest, statusch chan<- bool) SubErrorCode {
+	codes := make(chan SubErrorCode, len(reqs))
+	controls := make([]chan os.Signal, len(reqs))
+	next := make([]chan na_pb.SubscriptionRequest, len(reqs))
+	for i := range reqs {
+		controls[i] = make(chan os.Signal, 1)
+		next[i] = make(chan na_pb.SubscriptionRequest, 1)
+		go func(req na_pb.SubscriptionRequest, control chan os.Signal, next <-chan na_pb.SubscriptionRequest) {
+			for {
+				code := subSendAndReceive(conn, jctx, req, statusch, control)
+				select {
+				case req = <-next:
+					if code == SubRcSighupRestart {
+						continue
+					}
+				default:
+				}
+				// the signal of a restart which came too late is dropped,
+				// the caller signals the stream once more at most
+				select {
+				case <-control:
+				default:
+				}
+				codes <- code
+				return
+			}
+		}(reqs[i], controls[i], next[i])
 	}
-	additionalConfigM.NeedEos = jctx.config.EOS
-	subReqM.AdditionalConfig = &additionalConfigM
+	jLog(jctx, fmt.Sprintf("Receiving telemetry data from %s:%d in %d streams\n", jctx.config.Host, jctx.config.Port, len(reqs)))
+	changed := jctx.freqs.listen()
+	defer jctx.freqs.unlisten()
 
-	return subSendAndReceive(conn, jctx, subReqM, statusch)
+	running := len(reqs)
+	var code SubErrorCode
+streams:
+	for {
+		select {
+		case s := <-jctx.control:
+			for _, c := range controls {
+				c <- s
+			}
+			code = <-codes
+			running--
+			break streams
+		case code = <-codes:
+			running--
+			for _, c := range controls {
+				c <- syscall.SIGHUP
+			}
+			break streams
+		case <-changed:
+			update := junosRequests(jctx)
+			if len(update) != len(reqs) {
+				for _, c := range controls {
+					c <- syscall.SIGHUP
+				}
+				code = SubRcSighupRestart
+				break streams
+			}
+			for i := range update {
+				if sameSubscription(reqs[i], update[i]) {
+					continue
+				}
+				jLog(jctx, fmt.Sprintf("Subscribing stream %d of %s:%d again", i+1, jctx.config.Host, jctx.config.Port))
+				select {
+				case <-next[i]:
+				default:
+				}
+				next[i] <- update[i]
+				select {
+				case controls[i] <- syscall.SIGHUP:
+				default:
+				}
+			}
+			reqs = update
+		}
+	}
+	for ; running > 0; running-- {
+		<-codes
+	}
+	return code
+}
+
+// sameSubscription tells whether the requests subscribe to the same paths
+// at the same frequencies
+func sameSubscription(a, b na_pb.SubscriptionRequest) bool {
+	if len(a.PathList) != len(b.PathList) {
+		return false
+	}
+	for i, p := range a.PathList {
+		if p.Path != b.PathList[i].Path || p.SampleFrequency != b.PathList[i].SampleFrequency {
+			return false
+		}
+	}
+	return true
 }
 
 func loginCheckJunos(jctx *JCtx, conn *grpc.ClientConn) error {
 	if jctx.config.User != "" && jctx.config.Password != "" {
 		user := jctx.config.User
 		pass := jctx.config.Password
-		if !jctx.config.Meta {
+		if mode := authMode(jctx.config); mode == "" || mode == AuthLoginCheck {
 			lc := auth_pb.NewLoginClient(conn)
 			dat, err := lc.LoginCheck(context.Background(),
 				&auth_pb.LoginRequest{UserName: user,
@@ -3,6 +3,8 @@ package main
 import (
 	"io/ioutil"
 	"os"
+	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"testing"
@@ -11,6 +13,7 @@ import (
 	"github.com/golang/protobuf/proto"
 	na_pb "github.com/nileshsimaria/jtimon/telemetry"
 	flag "github.com/spf13/pflag"
+	"google.golang.org/grpc"
 )
 
 func TestJTISIMSigHup(t *testing.T) {
@@ -450,7 +453,7 @@ func TestVMXTagsPoints(t *testing.T) {
 					if err != nil {
 						t.Errorf("error %v for test config %s", err, test.config)
 					}
-					addIDB(ocData, jctx, time.Now())
+					addIDB(ocData, jctx, time.Now(), nil)
 				}
 			}
 			if err := compareResults(jctx); err != nil {
@@ -459,3 +462,84 @@ func TestVMXTagsPoints(t *testing.T) {
 		})
 	}
 }
+
+func TestJunosSubscriptionRequests(t *testing.T) {
+	cfg := &Config{EOS: true}
+	for _, path := range []string{"/interfaces", "/components", "/lldp", "/bgp", "/mpls"} {
+		cfg.Paths = append(cfg.Paths, PathsConfig{Path: path, Freq: 2000})
+	}
+
+	tests := []struct {
+		streams int
+		want    [][]string
+	}{
+		{streams: 0, want: [][]string{{"/interfaces", "/components", "/lldp", "/bgp", "/mpls"}}},
+		{streams: 2, want: [][]string{{"/interfaces", "/lldp", "/mpls"}, {"/components", "/bgp"}}},
+		{streams: 8, want: [][]string{{"/interfaces"}, {"/components"}, {"/lldp"}, {"/bgp"}, {"/mpls"}}},
+	}
+	for _, test := range tests {
+		cfg.GRPC.Streams = test.streams
+		reqs := junosSubscriptionRequests(cfg, 1, nil)
+		var got [][]string
+		for _, req := range reqs {
+			var paths []string
+			for _, p := range req.PathList {
+				paths = append(paths, p.Path)
+				if p.SampleFrequency != 2000 {
+					t.Errorf("streams %d: %s: got frequency %d", test.streams, p.Path, p.SampleFrequency)
+				}
+			}
+			if !req.AdditionalConfig.NeedEos {
+				t.Errorf("streams %d: eos not set", test.streams)
+			}
+			got = append(got, paths)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("streams %d: got %v, want %v", test.streams, got, test.want)
+		}
+	}
+}
+
+func TestJunosStreams(t *testing.T) {
+	jctx := &JCtx{
+		config: Config{
+			Host:  "127.0.0.1",
+			Port:  50051,
+			Paths: []PathsConfig{{Path: "/interfaces", Freq: 2000}, {Path: "/interfaces", Freq: 2000}},
+			GRPC:  GRPCConfig{Streams: 2},
+		},
+		influxCtx: InfluxCtx{
+			reXpath: regexp.MustCompile(MatchExpressionXpath),
+			reKey:   regexp.MustCompile(MatchExpressionKey),
+		},
+		control: make(chan os.Signal),
+	}
+	conn, err := grpc.Dial("127.0.0.1:50051", grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	statusch := make(chan bool)
+	codes := make(chan SubErrorCode)
+	go func() {
+		codes <- subscribeJunos(conn, jctx, statusch)
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-statusch:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("stream %d did not start", i)
+		}
+	}
+
+	jctx.control <- os.Interrupt
+	select {
+	case code := <-codes:
+		if code != SubRcSighupNoRestart {
+			t.Errorf("got code %d, want %d", code, SubRcSighupNoRestart)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("streams did not stop")
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pathSummary is the summary of a subscription path of a device
+type pathSummary struct {
+	Path         string  `json:"path"`
+	Packets      uint64  `json:"packets"`
+	Points       uint64  `json:"points"`
+	Bytes        uint64  `json:"bytes"`
+	AvgLatencyMs float64 `json:"avg-latency-ms"`
+	P99LatencyMs float64 `json:"p99-latency-ms"`
+}
+
+// deviceSummary is the summary of the run of a worker
+type deviceSummary struct {
+	Device  string `json:"device"`
+	Port    int    `json:"port"`
+	Stopped string `json:"stopped"`
+	// Undrained tells that the updates received were not all written
+	// before the worker stopped
+	Undrained    bool          `json:"undrained,omitempty"`
+	Packets      uint64        `json:"packets"`
+	Points       uint64        `json:"points"`
+	Exported     uint64        `json:"exported-points"`
+	Bytes        uint64        `json:"bytes"`
+	Drops        uint64        `json:"drops"`
+	DecodeErrors uint64        `json:"decode-errors"`
+	Undecodable  []sensorCount `json:"undecodable,omitempty"`
+	Reconnects   uint64        `json:"reconnects"`
+	AvgLatencyMs float64       `json:"avg-latency-ms"`
+	Paths        []pathSummary `json:"paths"`
+}
+
+// sensorCount is the number of the messages of a sensor
+type sensorCount struct {
+	Sensor   string `json:"sensor"`
+	Messages uint64 `json:"messages"`
+}
+
+// runSummary is the report of a run written to --summary-file on exit
+type runSummary struct {
+	Version  string          `json:"version"`
+	Start    time.Time       `json:"start"`
+	End      time.Time       `json:"end"`
+	Duration float64         `json:"duration-seconds"`
+	Devices  []deviceSummary `json:"devices"`
+}
+
+// summaries are the summaries of the workers which stopped
+var summaries struct {
+	sync.Mutex
+	start   time.Time
+	devices []deviceSummary
+}
+
+func toMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// summarize returns the summary of the worker, stopped tells why it stopped
+func summarize(jctx *JCtx, stopped string) deviceSummary {
+	s := deviceSummary{
+		Device:       jctx.config.Host,
+		Port:         jctx.config.Port,
+		Stopped:      stopped,
+		Undrained:    jctx.undrained,
+		Packets:      atomic.LoadUint64(&jctx.metrics.packets),
+		Exported:     atomic.LoadUint64(&jctx.metrics.points),
+		DecodeErrors: atomic.LoadUint64(&jctx.metrics.decodeErrs),
+		Reconnects:   atomic.LoadUint64(&jctx.metrics.reconnects),
+		Paths:        []pathSummary{},
+	}
+	sensors, counts := jctx.quarantine.counts()
+	for i, sensor := range sensors {
+		s.Undecodable = append(s.Undecodable, sensorCount{Sensor: sensor, Messages: counts[i]})
+	}
+	for _, q := range jctx.drops.queues() {
+		s.Drops += jctx.drops.get(q)
+	}
+
+	var count uint64
+	var sum time.Duration
+	for _, p := range jctx.stats.paths.paths() {
+		c := jctx.stats.paths.counters(p)
+		ps := pathSummary{
+			Path:    p,
+			Packets: atomic.LoadUint64(&c.packets),
+			Points:  atomic.LoadUint64(&c.kv),
+			Bytes:   atomic.LoadUint64(&c.bytes),
+		}
+		if n, total, counts := c.latency.snapshot(); n != 0 {
+			ps.AvgLatencyMs = toMs(total / time.Duration(n))
+			ps.P99LatencyMs = toMs(histPercentiles(counts, 99)[0])
+			count += n
+			sum += total
+		}
+		s.Points += ps.Points
+		s.Bytes += ps.Bytes
+		s.Paths = append(s.Paths, ps)
+	}
+	if count != 0 {
+		s.AvgLatencyMs = toMs(sum / time.Duration(count))
+	}
+	return s
+}
+
+// summaryEnabled tells whether the summary of the run is written
+func summaryEnabled() bool {
+	return *summaryFile != ""
+}
+
+// summaryStart records the start of the run
+func summaryStart(now time.Time) {
+	summaries.Lock()
+	summaries.start = now
+	summaries.Unlock()
+}
+
+// summaryAdd records the summary of the worker when it stops
+func summaryAdd(jctx *JCtx, stopped string) {
+	if !summaryEnabled() {
+		return
+	}
+	s := summarize(jctx, stopped)
+	summaries.Lock()
+	summaries.devices = append(summaries.devices, s)
+	summaries.Unlock()
+}
+
+// summaryReport returns the summary of the run which ended at end, the
+// devices sorted by name and port
+func summaryReport(end time.Time) runSummary {
+	summaries.Lock()
+	defer summaries.Unlock()
+	r := runSummary{
+		Version: jtimonVersion,
+		Start:   summaries.start,
+		End:     end,
+		Devices: append([]deviceSummary{}, summaries.devices...),
+	}
+	sort.Slice(r.Devices, func(i, j int) bool {
+		if r.Devices[i].Device != r.Devices[j].Device {
+			return r.Devices[i].Device < r.Devices[j].Device
+		}
+		return r.Devices[i].Port < r.Devices[j].Port
+	})
+	if !r.Start.IsZero() {
+		r.Duration = end.Sub(r.Start).Seconds()
+	}
+	return r
+}
+
+// summaryWrite writes the summary of the run to file, - is stdout
+func summaryWrite(file string, end time.Time) error {
+	b, err := json.MarshalIndent(summaryReport(end), "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if file == "-" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return ioutil.WriteFile(file, b, 0644)
+}
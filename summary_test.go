@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	jctx := &JCtx{config: Config{Host: "r1", Port: 32767}}
+	jctx.metrics.packets = 3
+	jctx.metrics.points = 25
+	jctx.metrics.decodeErrs = 1
+	jctx.metrics.reconnects = 2
+	jctx.stats.paths.add("/interfaces/", 20, 600, 20*time.Millisecond, true)
+	jctx.stats.paths.add("/interfaces/", 10, 300, 40*time.Millisecond, true)
+	jctx.stats.paths.add("/bgp/", 5, 100, 0, false)
+
+	got := summarize(jctx, "interrupt")
+	p99 := got.Paths[1].P99LatencyMs
+	if p99 < 35 || p99 > 45 {
+		t.Errorf("p99 latency of /interfaces/: got %v, want about 40", p99)
+	}
+	got.Paths[1].P99LatencyMs = 0
+	want := deviceSummary{
+		Device:       "r1",
+		Port:         32767,
+		Stopped:      "interrupt",
+		Packets:      3,
+		Points:       35,
+		Exported:     25,
+		Bytes:        1000,
+		DecodeErrors: 1,
+		Reconnects:   2,
+		AvgLatencyMs: 30,
+		Paths: []pathSummary{
+			{Path: "/bgp/", Packets: 1, Points: 5, Bytes: 100},
+			{Path: "/interfaces/", Packets: 2, Points: 30, Bytes: 900, AvgLatencyMs: 30},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestSummaryWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "summary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "summary.json")
+
+	saved := *summaryFile
+	*summaryFile = file
+	defer func() {
+		*summaryFile = saved
+		summaries.devices = nil
+	}()
+
+	start := time.Date(2020, 3, 1, 10, 30, 0, 0, time.UTC)
+	summaryStart(start)
+	for _, host := range []string{"r2", "r1"} {
+		jctx := &JCtx{config: Config{Host: host}}
+		jctx.metrics.packets = 1
+		summaryAdd(jctx, "interrupt")
+	}
+	if err := summaryWrite(file, start.Add(90*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got runSummary
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Duration != 90 {
+		t.Errorf("duration: got %v, want 90", got.Duration)
+	}
+	if len(got.Devices) != 2 || got.Devices[0].Device != "r1" || got.Devices[1].Device != "r2" {
+		t.Errorf("devices: got %+v", got.Devices)
+	}
+}
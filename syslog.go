@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// SyslogConfig is the config of forwarding selected updates as RFC5424
+// syslog messages. network is udp (default) or tcp (octet counting framing).
+type SyslogConfig struct {
+	Server   string       `json:"server"`
+	Network  string       `json:"network"`
+	Facility string       `json:"facility"`
+	AppName  string       `json:"app-name"`
+	Hostname string       `json:"hostname"`
+	Rules    []SyslogRule `json:"rules"`
+	BatchConfig
+}
+
+// SyslogRule maps selected updates to a syslog message, message is a Go
+// template with .Tags, .Measurement, .Field, .Value and .Previous
+type SyslogRule struct {
+	UpdateRule
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// syslogSDID is the structured data element carrying the tags of the update,
+// 32473 is the private enterprise number reserved for documentation
+const syslogSDID = "jtimon@32473"
+
+var syslogSeverities = map[string]int{
+	"emerg": 0, "alert": 1, "crit": 2, "err": 3,
+	"warning": 4, "notice": 5, "info": 6, "debug": 7,
+}
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "daemon": 3, "local0": 16, "local1": 17, "local2": 18,
+	"local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+type syslogRule struct {
+	*updateRule
+	severity int
+	message  *template.Template
+}
+
+type syslogSink struct {
+	cfg      SyslogConfig
+	addr     string
+	facility int
+	hostname *template.Template
+	rules    []*syslogRule
+	conn     net.Conn
+}
+
+func newSyslogSink() *sink {
+	return &sink{
+		name: "syslog",
+		open: openSyslogSink,
+	}
+}
+
+func openSyslogSink(jctx *JCtx) (sinkWriter, BatchConfig, error) {
+	cfg := jctx.config.Syslog
+	if cfg.Server == "" {
+		return nil, cfg.BatchConfig, nil
+	}
+	if len(cfg.Rules) == 0 {
+		return nil, cfg.BatchConfig, fmt.Errorf("syslog needs at least one rule")
+	}
+	switch cfg.Network {
+	case "":
+		cfg.Network = "udp"
+	case "udp", "tcp":
+	default:
+		return nil, cfg.BatchConfig, fmt.Errorf("syslog network %q is not supported, use udp or tcp", cfg.Network)
+	}
+	if cfg.AppName == "" {
+		cfg.AppName = "jtimon"
+	}
+
+	s := &syslogSink{cfg: cfg, addr: cfg.Server}
+	if _, _, err := net.SplitHostPort(s.addr); err != nil {
+		s.addr = net.JoinHostPort(s.addr, strconv.Itoa(DefaultSyslogPort))
+	}
+
+	facility := cfg.Facility
+	if facility == "" {
+		facility = DefaultSyslogFacility
+	}
+	f, ok := syslogFacilities[facility]
+	if !ok {
+		return nil, cfg.BatchConfig, fmt.Errorf("unknown syslog facility %q", facility)
+	}
+	s.facility = f
+
+	hostname := cfg.Hostname
+	if hostname == "" {
+		hostname = "{{.Tags.device}}"
+	}
+	var err error
+	if s.hostname, err = newKeyTemplate("hostname", hostname); err != nil {
+		return nil, cfg.BatchConfig, err
+	}
+
+	for i, r := range cfg.Rules {
+		u, err := newUpdateRule(r.UpdateRule)
+		if err != nil {
+			return nil, cfg.BatchConfig, err
+		}
+		rule := &syslogRule{updateRule: u}
+
+		severity := r.Severity
+		if severity == "" {
+			severity = DefaultSyslogSeverity
+		}
+		if rule.severity, ok = syslogSeverities[severity]; !ok {
+			return nil, cfg.BatchConfig, fmt.Errorf("syslog rule %d: unknown severity %q", i, severity)
+		}
+		message := r.Message
+		if message == "" {
+			message = DefaultSyslogMessage
+		}
+		if rule.message, err = newKeyTemplate("message", message); err != nil {
+			return nil, cfg.BatchConfig, err
+		}
+		s.rules = append(s.rules, rule)
+	}
+	return s, cfg.BatchConfig, nil
+}
+
+// syslogHeaderField makes s a valid RFC5424 header field (printable ASCII, no space)
+func syslogHeaderField(s string, max int) string {
+	f := strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, s)
+	if len(f) > max {
+		f = f[:max]
+	}
+	if f == "" {
+		return "-"
+	}
+	return f
+}
+
+func syslogStructuredData(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+	var b strings.Builder
+	b.WriteString("[" + syslogSDID)
+	for _, k := range keys {
+		if len(k) > 32 || strings.ContainsAny(k, "= ]\"") || syslogHeaderField(k, 32) != k {
+			continue
+		}
+		fmt.Fprintf(&b, ` %s="%s"`, k, escape.Replace(tags[k]))
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+func (s *syslogSink) message(rule *syslogRule, e *updateEvent) (string, error) {
+	msg, err := execEventTemplate(rule.message, e)
+	if err != nil {
+		return "", err
+	}
+	host, err := execEventTemplate(s.hostname, e)
+	if err != nil {
+		return "", err
+	}
+
+	pri := s.facility*8 + rule.severity
+	ts := e.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %d - %s %s", pri,
+		ts.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeaderField(host, 255), syslogHeaderField(s.cfg.AppName, 48), os.Getpid(),
+		syslogStructuredData(e.Tags), msg), nil
+}
+
+func (s *syslogSink) send(msgs []string) error {
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.cfg.Network, s.addr, time.Duration(DefaultIDBTimeout)*time.Second)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	for _, m := range msgs {
+		if err := syslogWrite(s.conn, s.cfg.Network == "tcp", m); err != nil {
+			s.close()
+			return err
+		}
+	}
+	return nil
+}
+
+// syslogWrite writes one message, on streams with octet counting framing
+func syslogWrite(conn net.Conn, stream bool, m string) error {
+	var err error
+	if stream {
+		_, err = fmt.Fprintf(conn, "%d %s", len(m), m)
+	} else {
+		_, err = conn.Write([]byte(m))
+	}
+	return err
+}
+
+func (s *syslogSink) write(points []*point) error {
+	var msgs []string
+	for _, p := range points {
+		for _, rule := range s.rules {
+			for _, e := range rule.match(p) {
+				m, err := s.message(rule, e)
+				if err != nil {
+					return err
+				}
+				msgs = append(msgs, m)
+			}
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return s.send(msgs)
+}
+
+func (s *syslogSink) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
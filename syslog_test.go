@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogSink(t *testing.T) {
+	p := newPoint("ifd", map[string]string{"device": "r1", "interface-name": "et-0/0/0", "descr": `a "b"`},
+		map[string]interface{}{"/oper-status": "DOWN"}, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	want := fmt.Sprintf(`<187>1 2020-01-02T03:04:05.000000Z r1 jtimon %d - `+
+		`[jtimon@32473 descr="a \"b\"" device="r1" interface-name="et-0/0/0"] et-0/0/0 is DOWN`, os.Getpid())
+	rule := SyslogRule{
+		UpdateRule: UpdateRule{Field: "oper-status"},
+		Severity:   "err",
+		Message:    `{{index .Tags "interface-name"}} is {{.Value}}`,
+	}
+
+	t.Run("udp", func(t *testing.T) {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		defer pc.Close()
+
+		jctx := &JCtx{}
+		jctx.config.Syslog = SyslogConfig{Server: pc.LocalAddr().String(), Facility: "local7", Rules: []SyslogRule{rule}}
+		w, _, err := openSyslogSink(jctx)
+		if err != nil {
+			t.Fatalf("openSyslogSink failed: %v", err)
+		}
+		defer w.close()
+		if err := w.write([]*point{p}); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+
+		pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+		buf := make([]byte, 2048)
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("no message received: %v", err)
+		}
+		if got := string(buf[:n]); got != want {
+			t.Errorf("\ngot:  %s\nwant: %s", got, want)
+		}
+	})
+
+	t.Run("tcp", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		defer l.Close()
+		got := make(chan string, 1)
+		go func() {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			r := bufio.NewReader(c)
+			var n int
+			fmt.Fscanf(r, "%d ", &n)
+			b := make([]byte, n)
+			io.ReadFull(r, b)
+			got <- string(b)
+		}()
+
+		jctx := &JCtx{}
+		jctx.config.Syslog = SyslogConfig{Server: l.Addr().String(), Network: "tcp", Facility: "local7", Rules: []SyslogRule{rule}}
+		w, _, err := openSyslogSink(jctx)
+		if err != nil {
+			t.Fatalf("openSyslogSink failed: %v", err)
+		}
+		defer w.close()
+		if err := w.write([]*point{p}); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		select {
+		case m := <-got:
+			if m != want {
+				t.Errorf("\ngot:  %s\nwant: %s", m, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no message received")
+		}
+	})
+
+	t.Run("bad-config", func(t *testing.T) {
+		for _, cfg := range []SyslogConfig{
+			{Server: "s"},
+			{Server: "s", Network: "sctp", Rules: []SyslogRule{rule}},
+			{Server: "s", Facility: "local9", Rules: []SyslogRule{rule}},
+			{Server: "s", Rules: []SyslogRule{{Severity: "fatal"}}},
+		} {
+			jctx := &JCtx{}
+			jctx.config.Syslog = cfg
+			if _, _, err := openSyslogSink(jctx); err == nil || !strings.Contains(err.Error(), "syslog") {
+				t.Errorf("%+v: want syslog error, got %v", cfg, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// sdHeartbeat is the last run of the heartbeat task of the scheduler in
+// unix nanoseconds, the watchdog is not pinged when it stops running
+var sdHeartbeat int64
+
+// sdNotify sends the state, newline separated assignments like READY=1, to
+// the service manager. It does nothing unless jtimon runs as a systemd
+// service of Type=notify, which sets NOTIFY_SOCKET.
+func sdNotify(state string) error {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return nil
+	}
+	if name[0] == '@' {
+		// abstract socket
+		name = "\x00" + name[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// sdWatchdogInterval is the watchdog timeout of the service, WatchdogSec,
+// 0 if it has none or it is meant for another process
+func sdWatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// sdCheck checks the internal health of jtimon and returns the readiness of
+// /readyz. jtimon is wedged if the shared scheduler no longer runs its tasks
+// (batch writes, stats) within stale, or if the workers can not be listed
+// within timeout.
+func sdCheck(stale, timeout time.Duration) (readiness, error) {
+	if last := atomic.LoadInt64(&sdHeartbeat); last != 0 {
+		if d := time.Since(time.Unix(0, last)); d > stale {
+			return readiness{}, fmt.Errorf("the scheduler has not run its tasks for %v", d.Round(time.Second))
+		}
+	}
+	ch := make(chan readiness, 1)
+	go func() {
+		ch <- checkReadiness(deviceWorkers(""), *readyConnected, *readySinks)
+	}()
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case r := <-ch:
+		return r, nil
+	case <-t.C:
+		return readiness{}, fmt.Errorf("the workers are locked up")
+	}
+}
+
+// sdStatus is the status line of the readiness shown by systemctl status
+func sdStatus(r readiness) string {
+	if r.Standby {
+		return fmt.Sprintf("standby of %d devices", r.Devices)
+	}
+	s := fmt.Sprintf("%d of %d devices connected", r.Connected, r.Devices)
+	if r.Unassigned != 0 {
+		s += fmt.Sprintf(", %d on the other members", r.Unassigned)
+	}
+	if len(r.Failing) != 0 {
+		s += fmt.Sprintf(", %d sinks failing", len(r.Failing))
+	}
+	return s
+}
+
+// systemdInit tells systemd when jtimon is ready, once /readyz is, and pings
+// its watchdog while jtimon is not wedged so that a wedged jtimon gets
+// restarted (WatchdogSec and Restart of the service). It does nothing if
+// jtimon is not a Type=notify service.
+func systemdInit() {
+	if os.Getenv("NOTIFY_SOCKET") == "" {
+		return
+	}
+	watchdog := sdWatchdogInterval()
+	every := time.Second
+	if watchdog > 0 && watchdog/2 < every {
+		every = watchdog / 2
+	}
+	atomic.StoreInt64(&sdHeartbeat, time.Now().UnixNano())
+	schedule(every, func() {
+		atomic.StoreInt64(&sdHeartbeat, time.Now().UnixNano())
+	})
+	go sdRun(watchdog, every)
+}
+
+func sdRun(watchdog, every time.Duration) {
+	ready, status, wedged, failed := false, "", "", ""
+	notify := func(state string) {
+		err := sdNotify(state)
+		if err != nil && err.Error() != failed {
+			globalLog(LogLevelError, fmt.Sprintf("systemd notify failed: %v", err))
+		}
+		failed = ""
+		if err != nil {
+			failed = err.Error()
+		}
+	}
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for ; ; <-t.C {
+		r, err := sdCheck(watchdog/2+every, every)
+		if err != nil {
+			if err.Error() != wedged {
+				wedged = err.Error()
+				globalLog(LogLevelError, "jtimon is wedged, not pinging the watchdog: "+wedged)
+				notify("STATUS=wedged: " + wedged)
+				status = ""
+			}
+			continue
+		}
+		wedged = ""
+		state := ""
+		if watchdog > 0 {
+			state = "WATCHDOG=1\n"
+		}
+		if !ready && r.Ready {
+			ready = true
+			state += "READY=1\n"
+		}
+		if s := sdStatus(r); s != status {
+			status = s
+			state += "STATUS=" + s + "\n"
+		}
+		if state != "" {
+			notify(state)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// setenv sets the environment variable until the test ends
+func setenv(key, value string) func() {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	return func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+// notifySocket listens on a socket like the one of systemd
+func notifySocket(t *testing.T, name string) *net.UnixConn {
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func readNotify(t *testing.T, conn *net.UnixConn) string {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	b := make([]byte, 4096)
+	n, err := conn.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b[:n])
+}
+
+func TestSdNotify(t *testing.T) {
+	defer setenv("NOTIFY_SOCKET", "")()
+	if err := sdNotify("READY=1"); err != nil {
+		t.Errorf("sdNotify() without NOTIFY_SOCKET = %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "jtimon-systemd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "notify")
+	conn := notifySocket(t, name)
+	defer conn.Close()
+	os.Setenv("NOTIFY_SOCKET", name)
+	if err := sdNotify("READY=1\nSTATUS=ok"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readNotify(t, conn); got != "READY=1\nSTATUS=ok" {
+		t.Errorf("notified %q", got)
+	}
+
+	abstract := notifySocket(t, "\x00jtimon-test-"+strconv.Itoa(os.Getpid()))
+	defer abstract.Close()
+	os.Setenv("NOTIFY_SOCKET", "@jtimon-test-"+strconv.Itoa(os.Getpid()))
+	if err := sdNotify("WATCHDOG=1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readNotify(t, abstract); got != "WATCHDOG=1" {
+		t.Errorf("notified %q on the abstract socket", got)
+	}
+
+	os.Setenv("NOTIFY_SOCKET", filepath.Join(dir, "none"))
+	if err := sdNotify("READY=1"); err == nil {
+		t.Errorf("sdNotify() to a missing socket = nil")
+	}
+}
+
+func TestSdWatchdogInterval(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		usec, pid string
+		want      time.Duration
+	}{
+		{"", "", 0},
+		{"30000000", "", 30 * time.Second},
+		{"30000000", pid, 30 * time.Second},
+		{"30000000", "1", 0},
+		{"0", "", 0},
+		{"x", "", 0},
+	}
+	for _, test := range tests {
+		restoreUsec := setenv("WATCHDOG_USEC", test.usec)
+		restorePid := setenv("WATCHDOG_PID", test.pid)
+		if got := sdWatchdogInterval(); got != test.want {
+			t.Errorf("sdWatchdogInterval() of %q %q = %v, want %v", test.usec, test.pid, got, test.want)
+		}
+		restorePid()
+		restoreUsec()
+	}
+}
+
+func TestSdCheck(t *testing.T) {
+	defer func(h int64) { atomic.StoreInt64(&sdHeartbeat, h) }(atomic.LoadInt64(&sdHeartbeat))
+	jctx := &JCtx{config: Config{Host: "r1"}}
+	jctx.metrics.attempted, jctx.metrics.connected = 1, 1
+	dropsInit(jctx)
+	defer dropsStop(jctx)
+
+	atomic.StoreInt64(&sdHeartbeat, time.Now().UnixNano())
+	r, err := sdCheck(time.Second, time.Second)
+	if err != nil || r.Devices == 0 || r.Connected == 0 {
+		t.Errorf("sdCheck() = %+v, %v", r, err)
+	}
+	if s := sdStatus(readiness{Devices: 3, Connected: 2, Failing: []string{"r1/kafka"}}); s != "2 of 3 devices connected, 1 sinks failing" {
+		t.Errorf("sdStatus() = %q", s)
+	}
+
+	atomic.StoreInt64(&sdHeartbeat, time.Now().Add(-time.Minute).UnixNano())
+	if _, err := sdCheck(time.Second, time.Second); err == nil || !strings.HasPrefix(err.Error(), "the scheduler has not run its tasks for 1m") {
+		t.Errorf("sdCheck() with the scheduler stuck = %v", err)
+	}
+
+	atomic.StoreInt64(&sdHeartbeat, time.Now().UnixNano())
+	metricWorkers.Lock()
+	_, err = sdCheck(time.Second, 50*time.Millisecond)
+	metricWorkers.Unlock()
+	if err == nil || err.Error() != "the workers are locked up" {
+		t.Errorf("sdCheck() with the workers locked up = %v", err)
+	}
+}
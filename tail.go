@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// tailBuffer is the number of points buffered for a client of the tail, the
+// points are dropped if it reads slower than they come
+const tailBuffer = 1000
+
+// tailClient is a client of the live tail of a worker, it gets the points of
+// the subscription paths starting with path as JSON lines
+type tailClient struct {
+	path    string
+	ch      chan []byte
+	dropped uint64
+}
+
+// tailState is the clients of the live tail of a worker
+type tailState struct {
+	sync.Mutex
+	clients map[*tailClient]bool
+	n       int32
+}
+
+func (t *tailState) add(path string) *tailClient {
+	c := &tailClient{path: path, ch: make(chan []byte, tailBuffer)}
+	t.Lock()
+	defer t.Unlock()
+	if t.clients == nil {
+		t.clients = map[*tailClient]bool{}
+	}
+	t.clients[c] = true
+	atomic.StoreInt32(&t.n, int32(len(t.clients)))
+	return c
+}
+
+func (t *tailState) remove(c *tailClient) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.clients, c)
+	atomic.StoreInt32(&t.n, int32(len(t.clients)))
+}
+
+// tailing tells whether the worker has clients of the tail, it decodes the
+// telemetry for them even without sinks
+func tailing(jctx *JCtx) bool {
+	return atomic.LoadInt32(&jctx.tail.n) != 0
+}
+
+// tailMatch tells whether the point is of a subscription path starting
+// with path
+func tailMatch(p *point, path string) bool {
+	return path == "" || strings.HasPrefix(sensorPath(p.Tags["sensor"]), path) || strings.HasPrefix(p.Measurement, path)
+}
+
+// tailPoints hands the decoded points of the worker to the clients of its
+// tail, they are marshalled right away as the points go on to the sinks
+func tailPoints(jctx *JCtx, points []*point) {
+	if !tailing(jctx) {
+		return
+	}
+	jctx.tail.Lock()
+	defer jctx.tail.Unlock()
+	for c := range jctx.tail.clients {
+		for _, p := range points {
+			if !tailMatch(p, c.path) {
+				continue
+			}
+			b, err := json.Marshal(p)
+			if err != nil {
+				continue
+			}
+			select {
+			case c.ch <- b:
+			default:
+				atomic.AddUint64(&c.dropped, 1)
+			}
+		}
+	}
+}
+
+// deviceTail streams the points of the worker as JSON lines until the
+// client goes away, or count points are sent. A line with the number of
+// dropped points comes when the client could not keep up.
+func deviceTail(w http.ResponseWriter, r *http.Request, jctx *JCtx) {
+	count := 0
+	if v := r.URL.Query().Get("count"); v != "" {
+		var err error
+		if count, err = strconv.Atoi(v); err != nil || count < 0 {
+			http.Error(w, fmt.Sprintf("invalid count %q", v), http.StatusBadRequest)
+			return
+		}
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	c := jctx.tail.add(r.URL.Query().Get("path"))
+	defer jctx.tail.remove(c)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var reported uint64
+	for sent := 0; count == 0 || sent < count; sent++ {
+		select {
+		case b := <-c.ch:
+			if dropped := atomic.LoadUint64(&c.dropped); dropped != reported {
+				fmt.Fprintf(w, "{\"dropped\":%d}\n", dropped-reported)
+				reported = dropped
+			}
+			if _, err := w.Write(append(b, '\n')); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTailMatch(t *testing.T) {
+	junos := newPoint("/interfaces/", map[string]string{"sensor": "sensor_1000_1_1:/junos/system/linecard/interface/:/interfaces/:PFE"}, nil, time.Time{})
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "", want: true},
+		{path: "/junos/system/linecard/", want: true},
+		{path: "/interfaces", want: true},
+		{path: "/bgp/", want: false},
+	}
+	for _, test := range tests {
+		if got := tailMatch(junos, test.path); got != test.want {
+			t.Errorf("%q: got %t, want %t", test.path, got, test.want)
+		}
+	}
+}
+
+func TestTailDrops(t *testing.T) {
+	jctx := &JCtx{}
+	c := jctx.tail.add("")
+	points := make([]*point, tailBuffer+5)
+	for i := range points {
+		points[i] = newPoint("/interfaces/", map[string]string{}, map[string]interface{}{"i": i}, time.Time{})
+	}
+	tailPoints(jctx, points)
+	if len(c.ch) != tailBuffer || c.dropped != 5 {
+		t.Errorf("got %d points and %d drops", len(c.ch), c.dropped)
+	}
+	jctx.tail.remove(c)
+	if tailing(jctx) {
+		t.Errorf("tailing after the client is removed")
+	}
+}
+
+func TestDeviceTail(t *testing.T) {
+	r1 := &JCtx{config: Config{Host: "r1"}}
+	dropsInit(r1)
+	defer dropsStop(r1)
+	srv := httptest.NewServer(http.HandlerFunc(devicesHandler))
+	defer srv.Close()
+
+	if resp, err := http.Get(srv.URL + "/devices/r1/tail?count=x"); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid count: got %v %v", resp, err)
+	}
+
+	resp, err := http.Get(srv.URL + "/devices/r1/tail?path=/interfaces/&count=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("got content type %s", ct)
+	}
+	if !tailing(r1) {
+		t.Fatalf("not tailing")
+	}
+
+	ts := time.Date(2020, 3, 1, 10, 30, 0, 0, time.UTC)
+	tailPoints(r1, []*point{
+		newPoint("/interfaces/", map[string]string{"device": "r1"}, map[string]interface{}{"in-octets": 10.0}, ts),
+		newPoint("/bgp/", map[string]string{"device": "r1"}, map[string]interface{}{"peers": 2.0}, ts),
+		newPoint("/interfaces/", map[string]string{"device": "r1"}, map[string]interface{}{"in-octets": 20.0}, ts),
+		newPoint("/interfaces/", map[string]string{"device": "r1"}, map[string]interface{}{"in-octets": 30.0}, ts),
+	})
+
+	var got []float64
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var p point
+		if err := json.Unmarshal(scanner.Bytes(), &p); err != nil {
+			t.Fatal(err)
+		}
+		if p.Measurement != "/interfaces/" || !p.Timestamp.Equal(ts) {
+			t.Errorf("got %s", scanner.Bytes())
+		}
+		got = append(got, p.Fields["in-octets"].(float64))
+	}
+	if len(got) != 2 || got[0] != 10 || got[1] != 20 {
+		t.Errorf("got %v, want [10 20]", got)
+	}
+	for i := 0; tailing(r1) && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if tailing(r1) {
+		t.Errorf("still tailing after count points")
+	}
+}
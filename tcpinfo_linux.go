@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// readTCPInfo reads TCP_INFO of the connection
+func readTCPInfo(conn net.Conn) (tcpInfo, bool) {
+	tc, ok := conn.(*net.TCPConn)
+	if !ok {
+		return tcpInfo{}, false
+	}
+	raw, err := tc.SyscallConn()
+	if err != nil {
+		return tcpInfo{}, false
+	}
+	var info syscall.TCPInfo
+	var errno syscall.Errno
+	err = raw.Control(func(fd uintptr) {
+		size := uint32(syscall.SizeofTCPInfo)
+		_, _, errno = syscall.Syscall6(syscall.SYS_GETSOCKOPT, fd, syscall.SOL_TCP, syscall.TCP_INFO,
+			uintptr(unsafe.Pointer(&info)), uintptr(unsafe.Pointer(&size)), 0)
+	})
+	if err != nil || errno != 0 {
+		return tcpInfo{}, false
+	}
+	return tcpInfo{
+		rtt:         time.Duration(info.Rtt) * time.Microsecond,
+		rttVar:      time.Duration(info.Rttvar) * time.Microsecond,
+		retransmits: uint64(info.Total_retrans),
+		cwnd:        info.Snd_cwnd,
+		rcvSpace:    info.Rcv_space,
+	}, true
+}
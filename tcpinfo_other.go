@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "net"
+
+// readTCPInfo reads TCP_INFO of the connection, it is known on Linux only
+func readTCPInfo(conn net.Conn) (tcpInfo, bool) {
+	return tcpInfo{}, false
+}
@@ -0,0 +1,266 @@
+package telemetry
+
+// Hand written decoding of the messages streamed by the devices. Every
+// update goes through them and the reflection based decoding of the
+// generated code is the bulk of the CPU of a busy collector. The messages
+// get an Unmarshal method, which both proto.Unmarshal and the gRPC codec
+// use instead.
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	errUnexpectedEOF = errors.New("telemetry: unexpected end of message")
+	errOverflow      = errors.New("telemetry: varint overflow")
+)
+
+func decodeVarint(b []byte, i int) (uint64, int, error) {
+	var x uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		if i >= len(b) {
+			return 0, i, errUnexpectedEOF
+		}
+		c := b[i]
+		i++
+		x |= uint64(c&0x7f) << shift
+		if c < 0x80 {
+			return x, i, nil
+		}
+	}
+	return 0, i, errOverflow
+}
+
+// decodeBytes returns the bounds of the length delimited value at i
+func decodeBytes(b []byte, i int) (int, int, error) {
+	l, i, err := decodeVarint(b, i)
+	if err != nil {
+		return 0, 0, err
+	}
+	if l > uint64(len(b)-i) {
+		return 0, 0, errUnexpectedEOF
+	}
+	return i, i + int(l), nil
+}
+
+// skipField skips the value of an unknown field
+func skipField(b []byte, i int, wire uint64) (int, error) {
+	switch wire {
+	case 0:
+		_, i, err := decodeVarint(b, i)
+		return i, err
+	case 1:
+		i += 8
+	case 2:
+		_, end, err := decodeBytes(b, i)
+		return end, err
+	case 5:
+		i += 4
+	default:
+		return i, fmt.Errorf("telemetry: unsupported wire type %d", wire)
+	}
+	if i > len(b) {
+		return i, errUnexpectedEOF
+	}
+	return i, nil
+}
+
+// fieldCount returns the number of occurrences of field num in b
+func fieldCount(b []byte, num uint64) (int, error) {
+	n := 0
+	for i := 0; i < len(b); {
+		key, j, err := decodeVarint(b, i)
+		if err != nil {
+			return 0, err
+		}
+		if key>>3 == num {
+			n++
+		}
+		if i, err = skipField(b, j, key&7); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// Unmarshal implements proto.Unmarshaler. The key values are allocated in
+// one block.
+func (m *OpenConfigData) Unmarshal(b []byte) error {
+	*m = OpenConfigData{}
+
+	n, err := fieldCount(b, 7)
+	if err != nil {
+		return err
+	}
+	var kvs []KeyValue
+	if n > 0 {
+		kvs = make([]KeyValue, n)
+		m.Kv = make([]*KeyValue, 0, n)
+	}
+
+	for i := 0; i < len(b); {
+		key, j, err := decodeVarint(b, i)
+		if err != nil {
+			return err
+		}
+		i = j
+		num, wire := key>>3, key&7
+
+		var v uint64
+		var start, end int
+		switch {
+		case num >= 1 && num <= 10 && wire == 0:
+			v, i, err = decodeVarint(b, i)
+		case num >= 1 && num <= 10 && wire == 2:
+			start, end, err = decodeBytes(b, i)
+			i = end
+		default:
+			i, err = skipField(b, i, wire)
+			num = 0
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case num == 1 && wire == 2:
+			m.SystemId = string(b[start:end])
+		case num == 2 && wire == 0:
+			m.ComponentId = uint32(v)
+		case num == 3 && wire == 0:
+			m.SubComponentId = uint32(v)
+		case num == 4 && wire == 2:
+			m.Path = string(b[start:end])
+		case num == 5 && wire == 0:
+			m.SequenceNumber = v
+		case num == 6 && wire == 0:
+			m.Timestamp = v
+		case num == 7 && wire == 2:
+			kv := &kvs[len(m.Kv)]
+			if err := kv.unmarshal(b[start:end]); err != nil {
+				return err
+			}
+			m.Kv = append(m.Kv, kv)
+		case num == 8 && wire == 2:
+			d := &Delete{}
+			if err := d.Unmarshal(b[start:end]); err != nil {
+				return err
+			}
+			m.Delete = append(m.Delete, d)
+		case num == 9 && wire == 2:
+			e := &Eom{}
+			if err := e.Unmarshal(b[start:end]); err != nil {
+				return err
+			}
+			m.Eom = append(m.Eom, e)
+		case num == 10 && wire == 0:
+			m.SyncResponse = v != 0
+		}
+	}
+	return nil
+}
+
+// Unmarshal implements proto.Unmarshaler
+func (m *KeyValue) Unmarshal(b []byte) error {
+	*m = KeyValue{}
+	return m.unmarshal(b)
+}
+
+func (m *KeyValue) unmarshal(b []byte) error {
+	for i := 0; i < len(b); {
+		key, j, err := decodeVarint(b, i)
+		if err != nil {
+			return err
+		}
+		i = j
+		num, wire := key>>3, key&7
+
+		switch {
+		case num == 1 && wire == 2, num == 10 && wire == 2, num == 11 && wire == 2:
+			start, end, err := decodeBytes(b, i)
+			if err != nil {
+				return err
+			}
+			i = end
+			switch num {
+			case 1:
+				m.Key = string(b[start:end])
+			case 10:
+				m.Value = &KeyValue_StrValue{StrValue: string(b[start:end])}
+			case 11:
+				// the buffer may be reused, keep a copy
+				m.Value = &KeyValue_BytesValue{BytesValue: append([]byte{}, b[start:end]...)}
+			}
+		case num == 5 && wire == 1:
+			if i+8 > len(b) {
+				return errUnexpectedEOF
+			}
+			bits := uint64(b[i]) | uint64(b[i+1])<<8 | uint64(b[i+2])<<16 | uint64(b[i+3])<<24 |
+				uint64(b[i+4])<<32 | uint64(b[i+5])<<40 | uint64(b[i+6])<<48 | uint64(b[i+7])<<56
+			i += 8
+			m.Value = &KeyValue_DoubleValue{DoubleValue: math.Float64frombits(bits)}
+		case num >= 6 && num <= 9 && wire == 0:
+			var v uint64
+			if v, i, err = decodeVarint(b, i); err != nil {
+				return err
+			}
+			switch num {
+			case 6:
+				m.Value = &KeyValue_IntValue{IntValue: int64(v)}
+			case 7:
+				m.Value = &KeyValue_UintValue{UintValue: v}
+			case 8:
+				m.Value = &KeyValue_SintValue{SintValue: int64(v>>1) ^ -int64(v&1)}
+			case 9:
+				m.Value = &KeyValue_BoolValue{BoolValue: v != 0}
+			}
+		default:
+			if i, err = skipField(b, i, wire); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Unmarshal implements proto.Unmarshaler
+func (m *Delete) Unmarshal(b []byte) error {
+	*m = Delete{}
+	path, err := unmarshalPath(b)
+	m.Path = path
+	return err
+}
+
+// Unmarshal implements proto.Unmarshaler
+func (m *Eom) Unmarshal(b []byte) error {
+	*m = Eom{}
+	path, err := unmarshalPath(b)
+	m.Path = path
+	return err
+}
+
+// unmarshalPath decodes the messages with just a path (field 1)
+func unmarshalPath(b []byte) (string, error) {
+	var path string
+	for i := 0; i < len(b); {
+		key, j, err := decodeVarint(b, i)
+		if err != nil {
+			return "", err
+		}
+		i = j
+		if key == 1<<3|2 {
+			start, end, err := decodeBytes(b, i)
+			if err != nil {
+				return "", err
+			}
+			path, i = string(b[start:end]), end
+			continue
+		}
+		if i, err = skipField(b, i, key&7); err != nil {
+			return "", err
+		}
+	}
+	return path, nil
+}
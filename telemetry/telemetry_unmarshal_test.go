@@ -0,0 +1,115 @@
+package telemetry
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func testOpenConfigData(kvs int) *OpenConfigData {
+	m := &OpenConfigData{
+		SystemId:       "router-1:10.0.0.1",
+		ComponentId:    1,
+		SubComponentId: 2,
+		Path:           "sensor_1000:/interfaces/:/interfaces/:PFE",
+		SequenceNumber: math.MaxUint64,
+		Timestamp:      1577836800000,
+		Delete:         []*Delete{{Path: "/interfaces/interface[name='ge-0/0/1']/"}},
+		Eom:            []*Eom{{Path: "/interfaces/"}},
+		SyncResponse:   true,
+	}
+	values := []isKeyValue_Value{
+		&KeyValue_DoubleValue{DoubleValue: -1.5},
+		&KeyValue_IntValue{IntValue: -42},
+		&KeyValue_UintValue{UintValue: math.MaxUint64},
+		&KeyValue_SintValue{SintValue: math.MinInt64},
+		&KeyValue_BoolValue{BoolValue: true},
+		&KeyValue_StrValue{StrValue: "UP"},
+		&KeyValue_BytesValue{BytesValue: []byte{0, 1, 2, 0xff}},
+		nil,
+	}
+	for i := 0; i < kvs; i++ {
+		m.Kv = append(m.Kv, &KeyValue{
+			Key:   fmt.Sprintf("/interfaces/interface[name='ge-0/0/%d']/state/counters/in-octets", i),
+			Value: values[i%len(values)],
+		})
+	}
+	return m
+}
+
+func TestOpenConfigDataUnmarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		m    *OpenConfigData
+	}{
+		{"empty", &OpenConfigData{}},
+		{"header", testOpenConfigData(0)},
+		{"all-values", testOpenConfigData(8)},
+		{"many", testOpenConfigData(1000)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := proto.Marshal(test.m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// unknown fields are skipped
+			b = append(b, 11<<3|0, 1, 12<<3|2, 2, 'x', 'y', 13<<3|5, 0, 0, 0, 0)
+
+			got := &OpenConfigData{Path: "stale"}
+			if err := got.Unmarshal(b); err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(got, test.m) {
+				t.Errorf("got %v\nwant %v", got, test.m)
+			}
+		})
+	}
+}
+
+func TestOpenConfigDataUnmarshalBytesCopied(t *testing.T) {
+	b, err := proto.Marshal(testOpenConfigData(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &OpenConfigData{}
+	if err := m.Unmarshal(b); err != nil {
+		t.Fatal(err)
+	}
+	for i := range b {
+		b[i] = 0
+	}
+	if v := m.Kv[6].GetBytesValue(); string(v) != "\x00\x01\x02\xff" {
+		t.Errorf("bytes value refers to the buffer: %v", v)
+	}
+}
+
+func TestOpenConfigDataUnmarshalTruncated(t *testing.T) {
+	b, err := proto.Marshal(testOpenConfigData(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{1, 2, len(b) / 2, len(b) - 1} {
+		if err := (&OpenConfigData{}).Unmarshal(b[:n]); err == nil {
+			t.Errorf("no error for message truncated to %d of %d bytes", n, len(b))
+		}
+	}
+}
+
+func BenchmarkOpenConfigDataUnmarshal(b *testing.B) {
+	buf, err := proto.Marshal(testOpenConfigData(100))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(buf)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m := &OpenConfigData{}
+		if err := proto.Unmarshal(buf, m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
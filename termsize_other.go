@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "os"
+
+// terminalWidth returns the number of columns of the terminal of f, it is
+// known on Linux only
+func terminalWidth(f *os.File) int {
+	return 0
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimestampConfig selects the timestamp of the points, index is receive
+// (the time jtimon got the update, default) or device (the timestamp of the
+// update set by the device). Once index is given the other one is always
+// written as field (default "receive-time" or "device-time"), in
+// milliseconds since the epoch.
+type TimestampConfig struct {
+	Index string `json:"index"`
+	Field string `json:"field"`
+}
+
+func validateTimestampConfig(cfg TimestampConfig) error {
+	switch cfg.Index {
+	case "", "receive", "device":
+	default:
+		return fmt.Errorf("timestamp index %q is not supported, use receive or device", cfg.Index)
+	}
+	return nil
+}
+
+// pointTime returns the timestamp of a point received at receive with
+// device timestamp device (zero if the update has none) and adds the other
+// timestamp to fields
+func pointTime(cfg TimestampConfig, receive, device time.Time, fields map[string]interface{}) time.Time {
+	if cfg.Index == "" || device.IsZero() {
+		return receive
+	}
+
+	index, other, field := receive, device, "device-time"
+	if cfg.Index == "device" {
+		index, other, field = device, receive, "receive-time"
+	}
+	if cfg.Field != "" {
+		field = cfg.Field
+	}
+	fields[field] = other.UnixNano() / int64(time.Millisecond)
+	return index
+}
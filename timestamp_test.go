@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPointTime(t *testing.T) {
+	receive := time.Unix(100, 250*int64(time.Millisecond))
+	device := time.Unix(99, 0)
+
+	tests := []struct {
+		name   string
+		cfg    TimestampConfig
+		device time.Time
+		want   time.Time
+		fields map[string]interface{}
+	}{
+		{name: "default", device: device, want: receive, fields: map[string]interface{}{}},
+		{
+			name: "receive", cfg: TimestampConfig{Index: "receive"}, device: device, want: receive,
+			fields: map[string]interface{}{"device-time": int64(99000)},
+		},
+		{
+			name: "device", cfg: TimestampConfig{Index: "device"}, device: device, want: device,
+			fields: map[string]interface{}{"receive-time": int64(100250)},
+		},
+		{
+			name: "field", cfg: TimestampConfig{Index: "device", Field: "rx"}, device: device, want: device,
+			fields: map[string]interface{}{"rx": int64(100250)},
+		},
+		{name: "no-device-time", cfg: TimestampConfig{Index: "device"}, want: receive, fields: map[string]interface{}{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fields := map[string]interface{}{}
+			if got := pointTime(test.cfg, receive, test.device, fields); !got.Equal(test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+			if !reflect.DeepEqual(fields, test.fields) {
+				t.Errorf("fields: got %v, want %v", fields, test.fields)
+			}
+		})
+	}
+
+	if err := validateTimestampConfig(TimestampConfig{Index: "export"}); err == nil {
+		t.Errorf("want error, got nil")
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+var (
+	// tlsVersions are the values of min-version of the TLS config
+	tlsVersions = map[string]uint16{
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+	// tlsCipherSuites are the cipher suites of TLS 1.0 to 1.2 by their IANA
+	// names, the ones of TLS 1.3 are not configurable
+	tlsCipherSuites = map[string]uint16{
+		"TLS_RSA_WITH_RC4_128_SHA":                      tls.TLS_RSA_WITH_RC4_128_SHA,
+		"TLS_RSA_WITH_3DES_EDE_CBC_SHA":                 tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+		"TLS_RSA_WITH_AES_128_CBC_SHA":                  tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+		"TLS_RSA_WITH_AES_256_CBC_SHA":                  tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+		"TLS_RSA_WITH_AES_128_CBC_SHA256":               tls.TLS_RSA_WITH_AES_128_CBC_SHA256,
+		"TLS_RSA_WITH_AES_128_GCM_SHA256":               tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+		"TLS_RSA_WITH_AES_256_GCM_SHA384":               tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+		"TLS_ECDHE_ECDSA_WITH_RC4_128_SHA":              tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA,
+		"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA":          tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+		"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA":          tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+		"TLS_ECDHE_RSA_WITH_RC4_128_SHA":                tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA,
+		"TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA":           tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA,
+		"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA":            tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+		"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA":            tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+		"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256":       tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256,
+		"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256":         tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
+		"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":         tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256":       tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":         tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384":       tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305":          tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+		"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256":   tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+		"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305":        tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+		"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256": tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	}
+	// tlsCurves are the values of curves of the TLS config
+	tlsCurves = map[string]tls.CurveID{
+		"X25519": tls.X25519,
+		"P256":   tls.CurveP256,
+		"P384":   tls.CurveP384,
+		"P521":   tls.CurveP521,
+	}
+)
+
+// tlsEnabled tells whether the connection to the device is TLS, with a CA,
+// the SPIFFE identity of jtimon or, for lab devices with self-signed
+// certificates, without verification
+func tlsEnabled(cfg TLSConfig) bool {
+	return cfg.CA != "" || cfg.SkipVerify || cfg.SPIFFE
+}
+
+// validateTLSConfig checks the versions, cipher suites and curves of the
+// TLS config of a device
+func validateTLSConfig(cfg TLSConfig) error {
+	if !tlsEnabled(cfg) && (cfg.MinVersion != "" || len(cfg.CipherSuites) != 0 || len(cfg.Curves) != 0) {
+		return fmt.Errorf("tls min-version, cipher-suites and curves need a ca, skip-verify or spiffe")
+	}
+	if cfg.CA != "" && cfg.SkipVerify {
+		return fmt.Errorf("tls skip-verify does not verify the certificate with the ca, remove one of them")
+	}
+	if cfg.SPIFFE {
+		if cfg.ClientCrt != "" || cfg.ClientKey != "" {
+			return fmt.Errorf("tls spiffe is the client certificate, remove clientcrt and clientkey")
+		}
+		if spiffeEndpoint() == "" {
+			return fmt.Errorf("tls spiffe needs --spiffe-socket or SPIFFE_ENDPOINT_SOCKET")
+		}
+	}
+	if len(cfg.Signer) != 0 {
+		switch {
+		case cfg.ClientCrt == "":
+			return fmt.Errorf("tls signer needs the clientcrt of its key")
+		case cfg.ClientKey != "" || cfg.SPIFFE:
+			return fmt.Errorf("tls signer is the client key, remove clientkey and spiffe")
+		case !tlsEnabled(cfg):
+			return fmt.Errorf("tls signer needs a ca or skip-verify")
+		}
+	}
+	if err := validateRevocation(cfg); err != nil {
+		return err
+	}
+	if *fipsMode {
+		if err := validateFIPSTLS(cfg); err != nil {
+			return err
+		}
+	}
+	return applyTLSSettings(cfg, &tls.Config{})
+}
+
+// applyTLSSettings sets the min version, cipher suites and curve preferences
+// of the TLS config of the device to t, unset ones are left to Go
+func applyTLSSettings(cfg TLSConfig, t *tls.Config) error {
+	if cfg.MinVersion != "" {
+		v, ok := tlsVersions[cfg.MinVersion]
+		if !ok {
+			return fmt.Errorf("tls min-version %q is not supported, use 1.0, 1.1, 1.2 or 1.3", cfg.MinVersion)
+		}
+		t.MinVersion = v
+	}
+	for _, name := range cfg.CipherSuites {
+		id, ok := tlsCipherSuites[name]
+		if !ok {
+			return fmt.Errorf("tls cipher suite %q is not supported", name)
+		}
+		t.CipherSuites = append(t.CipherSuites, id)
+	}
+	for _, name := range cfg.Curves {
+		id, ok := tlsCurves[name]
+		if !ok {
+			return fmt.Errorf("tls curve %q is not supported, use X25519, P256, P384 or P521", name)
+		}
+		t.CurvePreferences = append(t.CurvePreferences, id)
+	}
+	if *fipsMode {
+		fipsTLS(t)
+	}
+	return nil
+}
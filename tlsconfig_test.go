@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/tls"
+	"reflect"
+	"testing"
+)
+
+func TestValidateTLSConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  TLSConfig
+		err  bool
+	}{
+		{name: "none", cfg: TLSConfig{}},
+		{name: "ca only", cfg: TLSConfig{CA: "ca.crt"}},
+		{
+			name: "baseline",
+			cfg: TLSConfig{CA: "ca.crt", MinVersion: "1.2",
+				CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384", "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256"},
+				Curves:       []string{"X25519", "P384"}},
+		},
+		{name: "without ca", cfg: TLSConfig{MinVersion: "1.2"}, err: true},
+		{name: "skip verify", cfg: TLSConfig{SkipVerify: true, MinVersion: "1.2"}},
+		{name: "skip verify and ca", cfg: TLSConfig{CA: "ca.crt", SkipVerify: true}, err: true},
+		{name: "unknown version", cfg: TLSConfig{CA: "ca.crt", MinVersion: "1.4"}, err: true},
+		{name: "version of ssl", cfg: TLSConfig{CA: "ca.crt", MinVersion: "3.0"}, err: true},
+		{name: "tls 1.3 suite", cfg: TLSConfig{CA: "ca.crt", CipherSuites: []string{"TLS_AES_128_GCM_SHA256"}}, err: true},
+		{name: "unknown curve", cfg: TLSConfig{CA: "ca.crt", Curves: []string{"P224"}}, err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := validateTLSConfig(test.cfg); (err != nil) != test.err {
+				t.Errorf("got %v", err)
+			}
+		})
+	}
+}
+
+func TestApplyTLSSettings(t *testing.T) {
+	cfg := TLSConfig{
+		CA:           "ca.crt",
+		MinVersion:   "1.2",
+		CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+		Curves:       []string{"P384", "X25519"},
+	}
+	got := &tls.Config{ServerName: "r1"}
+	if err := applyTLSSettings(cfg, got); err != nil {
+		t.Fatal(err)
+	}
+	want := &tls.Config{
+		ServerName:       "r1",
+		MinVersion:       tls.VersionTLS12,
+		CipherSuites:     []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+		CurvePreferences: []tls.CurveID{tls.CurveP384, tls.X25519},
+	}
+	if got.ServerName != want.ServerName || got.MinVersion != want.MinVersion ||
+		!reflect.DeepEqual(got.CipherSuites, want.CipherSuites) || !reflect.DeepEqual(got.CurvePreferences, want.CurvePreferences) {
+		t.Errorf("got %+v", got)
+	}
+
+	unset := &tls.Config{}
+	if err := applyTLSSettings(TLSConfig{CA: "ca.crt"}, unset); err != nil || unset.MinVersion != 0 || unset.CipherSuites != nil || unset.CurvePreferences != nil {
+		t.Errorf("without settings: got %+v %v", unset, err)
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTOML parses the TOML document b, of the subset of TOML Telegraf
+// configs are written in: tables, arrays of tables, dotted and quoted keys,
+// strings, numbers, booleans, arrays and inline tables. Dates and times and
+// multi-line strings are not supported. Tables are map[string]interface{},
+// arrays of tables []map[string]interface{}, arrays []interface{}, integers
+// int64 and floats float64.
+func parseTOML(b []byte) (map[string]interface{}, error) {
+	p := &tomlParser{s: string(b), line: 1}
+	root := map[string]interface{}{}
+	cur := root
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			return root, nil
+		}
+		var err error
+		switch {
+		case strings.HasPrefix(p.rest(), "[["):
+			cur, err = p.arrayTable(root)
+		case p.peek() == '[':
+			cur, err = p.table(root)
+		default:
+			err = p.keyValue(cur)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", p.line, err)
+		}
+		p.skipBlank(false)
+		if !p.eof() && p.peek() != '\n' {
+			return nil, fmt.Errorf("line %d: unexpected %q after the value", p.line, p.peek())
+		}
+	}
+}
+
+type tomlParser struct {
+	s    string
+	pos  int
+	line int
+}
+
+func (p *tomlParser) eof() bool    { return p.pos >= len(p.s) }
+func (p *tomlParser) peek() byte   { return p.s[p.pos] }
+func (p *tomlParser) rest() string { return p.s[p.pos:] }
+
+// skipBlank skips the spaces and the comments, and the new lines with nl
+func (p *tomlParser) skipBlank(nl bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '\n' && nl:
+			p.pos++
+			p.line++
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) expect(c byte) error {
+	if p.eof() || p.peek() != c {
+		return fmt.Errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+// key parses a dotted key into its parts
+func (p *tomlParser) key() ([]string, error) {
+	var parts []string
+	for {
+		p.skipBlank(false)
+		if p.eof() {
+			return nil, fmt.Errorf("expected a key")
+		}
+		var part string
+		switch p.peek() {
+		case '"', '\'':
+			v, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			part = v
+		default:
+			start := p.pos
+			for !p.eof() {
+				c := p.peek()
+				if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+					break
+				}
+				p.pos++
+			}
+			if p.pos == start {
+				return nil, fmt.Errorf("expected a key")
+			}
+			part = p.s[start:p.pos]
+		}
+		parts = append(parts, part)
+		p.skipBlank(false)
+		if p.eof() || p.peek() != '.' {
+			return parts, nil
+		}
+		p.pos++
+	}
+}
+
+// descend returns the table of the parts under t, the last element of the
+// arrays of tables, creating the missing tables
+func descend(t map[string]interface{}, parts []string) (map[string]interface{}, error) {
+	for _, k := range parts {
+		switch v := t[k].(type) {
+		case nil:
+			n := map[string]interface{}{}
+			t[k] = n
+			t = n
+		case map[string]interface{}:
+			t = v
+		case []map[string]interface{}:
+			t = v[len(v)-1]
+		default:
+			return nil, fmt.Errorf("key %s is not a table", k)
+		}
+	}
+	return t, nil
+}
+
+func (p *tomlParser) table(root map[string]interface{}) (map[string]interface{}, error) {
+	p.pos++
+	parts, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(']'); err != nil {
+		return nil, err
+	}
+	return descend(root, parts)
+}
+
+func (p *tomlParser) arrayTable(root map[string]interface{}) (map[string]interface{}, error) {
+	p.pos += 2
+	parts, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(']'); err != nil {
+		return nil, err
+	}
+	if err := p.expect(']'); err != nil {
+		return nil, err
+	}
+	parent, err := descend(root, parts[:len(parts)-1])
+	if err != nil {
+		return nil, err
+	}
+	k := parts[len(parts)-1]
+	t := map[string]interface{}{}
+	switch v := parent[k].(type) {
+	case nil:
+		parent[k] = []map[string]interface{}{t}
+	case []map[string]interface{}:
+		parent[k] = append(v, t)
+	default:
+		return nil, fmt.Errorf("key %s is not an array of tables", k)
+	}
+	return t, nil
+}
+
+func (p *tomlParser) keyValue(t map[string]interface{}) error {
+	parts, err := p.key()
+	if err != nil {
+		return err
+	}
+	if err := p.expect('='); err != nil {
+		return err
+	}
+	p.skipBlank(false)
+	v, err := p.value()
+	if err != nil {
+		return err
+	}
+	t, err = descend(t, parts[:len(parts)-1])
+	if err != nil {
+		return err
+	}
+	k := parts[len(parts)-1]
+	if _, ok := t[k]; ok {
+		return fmt.Errorf("key %s is defined twice", k)
+	}
+	t[k] = v
+	return nil
+}
+
+func (p *tomlParser) value() (interface{}, error) {
+	if p.eof() {
+		return nil, fmt.Errorf("expected a value")
+	}
+	switch c := p.peek(); {
+	case c == '"' || c == '\'':
+		return p.str()
+	case c == '[':
+		return p.array()
+	case c == '{':
+		return p.inlineTable()
+	case strings.HasPrefix(p.rest(), "true"):
+		p.pos += 4
+		return true, nil
+	case strings.HasPrefix(p.rest(), "false"):
+		p.pos += 5
+		return false, nil
+	}
+	start := p.pos
+	for !p.eof() && strings.IndexByte(" \t\r\n,]}#", p.peek()) < 0 {
+		p.pos++
+	}
+	s := strings.Replace(p.s[start:p.pos], "_", "", -1)
+	if i, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("invalid value %q", p.s[start:p.pos])
+}
+
+// str parses a basic ("...") or literal ('...') string
+func (p *tomlParser) str() (string, error) {
+	q := p.peek()
+	if strings.HasPrefix(p.rest(), strings.Repeat(string(q), 3)) {
+		return "", fmt.Errorf("multi-line strings are not supported")
+	}
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", fmt.Errorf("unterminated string")
+		}
+		c := p.peek()
+		p.pos++
+		switch {
+		case c == q:
+			return b.String(), nil
+		case c == '\\' && q == '"':
+			if p.eof() {
+				return "", fmt.Errorf("unterminated string")
+			}
+			e := p.peek()
+			p.pos++
+			switch e {
+			case 'b':
+				b.WriteByte('\b')
+			case 't':
+				b.WriteByte('\t')
+			case 'n':
+				b.WriteByte('\n')
+			case 'f':
+				b.WriteByte('\f')
+			case 'r':
+				b.WriteByte('\r')
+			case '"', '\\':
+				b.WriteByte(e)
+			case 'u', 'U':
+				n := 4
+				if e == 'U' {
+					n = 8
+				}
+				if p.pos+n > len(p.s) {
+					return "", fmt.Errorf("invalid escape \\%c", e)
+				}
+				r, err := strconv.ParseUint(p.s[p.pos:p.pos+n], 16, 32)
+				if err != nil || !utf8.ValidRune(rune(r)) {
+					return "", fmt.Errorf("invalid escape \\%c%s", e, p.s[p.pos:p.pos+n])
+				}
+				b.WriteRune(rune(r))
+				p.pos += n
+			default:
+				return "", fmt.Errorf("invalid escape \\%c", e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+func (p *tomlParser) array() ([]interface{}, error) {
+	p.pos++
+	a := []interface{}{}
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			return nil, fmt.Errorf("unterminated array")
+		}
+		if p.peek() == ']' {
+			p.pos++
+			return a, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+		p.skipBlank(true)
+		if !p.eof() && p.peek() == ',' {
+			p.pos++
+		} else if p.eof() || p.peek() != ']' {
+			return nil, fmt.Errorf("expected , or ] in the array")
+		}
+	}
+}
+
+func (p *tomlParser) inlineTable() (map[string]interface{}, error) {
+	p.pos++
+	t := map[string]interface{}{}
+	for {
+		p.skipBlank(false)
+		if p.eof() {
+			return nil, fmt.Errorf("unterminated inline table")
+		}
+		if p.peek() == '}' {
+			p.pos++
+			return t, nil
+		}
+		if err := p.keyValue(t); err != nil {
+			return nil, err
+		}
+		p.skipBlank(false)
+		if !p.eof() && p.peek() == ',' {
+			p.pos++
+		} else if p.eof() || p.peek() != '}' {
+			return nil, fmt.Errorf("expected , or } in the inline table")
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]interface{}
+		err  string
+	}{
+		{
+			name: "values",
+			in: `# a comment
+s = "a \"b\"\tc\u00e9" # trailing comment
+l = 'C:\path'
+i = 1_000
+h = 0x1f
+f = -1.5e3
+b = true
+a = [ "x",
+  'y', # comment
+]
+e = []
+it = { a = 1, b.c = "d" }
+"quoted key" = false
+`,
+			want: map[string]interface{}{
+				"s": "a \"b\"\tc\u00e9", "l": `C:\path`, "i": int64(1000), "h": int64(31), "f": -1500.0, "b": true,
+				"a": []interface{}{"x", "y"}, "e": []interface{}{},
+				"it":         map[string]interface{}{"a": int64(1), "b": map[string]interface{}{"c": "d"}},
+				"quoted key": false,
+			},
+		},
+		{
+			name: "tables",
+			in: `[agent]
+interval = "10s"
+
+[[inputs.gnmi]]
+  addresses = ["r1:32767"]
+  [[inputs.gnmi.subscription]]
+    path = "/a"
+  [[inputs.gnmi.subscription]]
+    path = "/b"
+  [inputs.gnmi.tags]
+    site = "x"
+
+[[inputs.gnmi]]
+  addresses = ["r2:32767"]
+`,
+			want: map[string]interface{}{
+				"agent": map[string]interface{}{"interval": "10s"},
+				"inputs": map[string]interface{}{"gnmi": []map[string]interface{}{
+					{
+						"addresses": []interface{}{"r1:32767"},
+						"subscription": []map[string]interface{}{
+							{"path": "/a"}, {"path": "/b"},
+						},
+						"tags": map[string]interface{}{"site": "x"},
+					},
+					{"addresses": []interface{}{"r2:32767"}},
+				}},
+			},
+		},
+		{name: "duplicate", in: "a = 1\na = 2\n", err: "line 2: key a is defined twice"},
+		{name: "unterminated string", in: "a = \"x\n", err: "line 1: unterminated string"},
+		{name: "unterminated array", in: "a = [1,\n", err: "line 2: unterminated array"},
+		{name: "multi-line string", in: "a = \"\"\"x\"\"\"\n", err: "line 1: multi-line strings are not supported"},
+		{name: "invalid value", in: "a = 1979-05-27T07:32:00Z\n", err: "line 1: invalid value \"1979-05-27T07:32:00Z\""},
+		{name: "two values", in: "a = 1 b = 2\n", err: "line 1: unexpected 'b' after the value"},
+		{name: "not a table", in: "a = 1\n[a.b]\n", err: "line 2: key a is not a table"},
+		{name: "not an array of tables", in: "[a]\n[[a]]\n", err: "line 2: key a is not an array of tables"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseTOML([]byte(test.in))
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("parseTOML() error = %v, want %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseTOML() = %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
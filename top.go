@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+var topInterval = flag.Int("top-interval", 2, "How often jtimon top refreshes, in seconds")
+
+// topErrors is the number of recent errors jtimon top shows
+const topErrors = 10
+
+// topSample is what jtimon top got of the local jtimon at a refresh
+type topSample struct {
+	time    time.Time
+	devices []deviceHealth
+	// errors are the recent errors, disconnects and stale data of the
+	// devices, newest first, unless eventsErr tells why they could not be
+	// got, e.g. without the token of the control endpoints
+	errors    []topEvent
+	eventsErr error
+}
+
+type topEvent struct {
+	device string
+	event
+}
+
+// getJSON gets url with the bearer token if it is set and decodes its JSON
+// into v
+func getJSON(client *http.Client, url, token string, v interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", req.URL.Path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// topFetch gets the health and the events of the devices of the local
+// jtimon
+func topFetch(timeout time.Duration, token string) (*topSample, error) {
+	s := &topSample{time: time.Now()}
+	client, url, err := localAPI("/health", timeout)
+	if err != nil {
+		return nil, err
+	}
+	var health struct {
+		Devices []deviceHealth `json:"devices"`
+	}
+	if err := getJSON(client, url, token, &health); err != nil {
+		return nil, err
+	}
+	s.devices = health.Devices
+
+	_, url, _ = localAPI("/events", timeout)
+	var events struct {
+		Devices []struct {
+			Device string  `json:"device"`
+			Port   int     `json:"port"`
+			Events []event `json:"events"`
+		} `json:"devices"`
+	}
+	if s.eventsErr = getJSON(client, url, token, &events); s.eventsErr != nil {
+		return s, nil
+	}
+	for _, d := range events.Devices {
+		for _, e := range d.Events {
+			if e.Type == EventError || e.Type == EventDisconnect || e.Type == EventStale {
+				s.errors = append(s.errors, topEvent{fmt.Sprintf("%s:%d", d.Device, d.Port), e})
+			}
+		}
+	}
+	sort.SliceStable(s.errors, func(i, j int) bool { return s.errors[i].Time.After(s.errors[j].Time) })
+	return s, nil
+}
+
+// topState is the state of the device as the status page shows it
+func topState(d deviceHealth) string {
+	switch {
+	case d.Paused:
+		return "paused"
+	case d.Unassigned:
+		return "unassigned"
+	case !d.Connected:
+		return "disconnected"
+	case d.Stale:
+		return "stale"
+	}
+	return "connected"
+}
+
+// topAge is how long ago t was
+func topAge(now time.Time, t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	d := now.Sub(*t)
+	if d < 0 {
+		d = 0
+	}
+	if d < time.Minute {
+		return fmt.Sprintf("%ds ago", int(d/time.Second))
+	}
+	return fmt.Sprintf("%dm ago", int(d/time.Minute))
+}
+
+// topLines are the lines of the screen of cur, with the rates since prev,
+// nil on the first refresh
+func topLines(prev, cur *topSample) []string {
+	before := map[string]deviceHealth{}
+	var elapsed float64
+	if prev != nil {
+		elapsed = cur.time.Sub(prev.time).Seconds()
+		for _, d := range prev.devices {
+			before[fmt.Sprintf("%s:%d", d.Device, d.Port)] = d
+		}
+	}
+	rate := func(now, then uint64, ok bool) (float64, bool) {
+		if !ok || elapsed <= 0 || now < then {
+			return 0, false
+		}
+		return float64(now-then) / elapsed, true
+	}
+	format := func(r float64, ok bool) string {
+		if !ok {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f", r)
+	}
+
+	width := len("DEVICE")
+	for _, d := range cur.devices {
+		if n := len(fmt.Sprintf("%s:%d", d.Device, d.Port)); n > width {
+			width = n
+		}
+	}
+	row := func(cols ...string) string {
+		return strings.TrimRight(fmt.Sprintf("%-*s  %-12s %10s %10s %8s %9s %10s  %s", width,
+			cols[0], cols[1], cols[2], cols[3], cols[4], cols[5], cols[6], cols[7]), " ")
+	}
+
+	connected := 0
+	var points, drops float64
+	rows := []string{row("DEVICE", "STATE", "PACKETS/S", "POINTS/S", "DROPS/S", "LATENCY", "RECONNECTS", "LAST DATA")}
+	for _, d := range cur.devices {
+		key := fmt.Sprintf("%s:%d", d.Device, d.Port)
+		p, ok := before[key]
+		if d.Connected {
+			connected++
+		}
+		packetRate, packetOK := rate(d.Packets, p.Packets, ok)
+		pointRate, pointOK := rate(d.Points, p.Points, ok)
+		dropRate, dropOK := rate(d.Drops, p.Drops, ok)
+		points += pointRate
+		drops += dropRate
+		latency := "-"
+		if ok && d.Latencies > p.Latencies {
+			latency = fmt.Sprintf("%.1fms", (d.LatencySum-p.LatencySum)/float64(d.Latencies-p.Latencies)*1000)
+		}
+		rows = append(rows, row(key, topState(d), format(packetRate, packetOK), format(pointRate, pointOK),
+			format(dropRate, dropOK), latency, fmt.Sprint(d.Reconnects), topAge(cur.time, d.LastData)))
+	}
+
+	lines := []string{fmt.Sprintf("jtimon top - %s, %d devices, %d connected", cur.time.Format("15:04:05"), len(cur.devices), connected)}
+	if prev != nil {
+		lines[0] += fmt.Sprintf(", %.1f points/s, %.1f drops/s", points, drops)
+	}
+	lines = append(lines, "")
+	lines = append(lines, rows...)
+	lines = append(lines, "", "RECENT ERRORS")
+	switch {
+	case cur.eventsErr != nil:
+		lines = append(lines, fmt.Sprintf("could not get the events: %v", cur.eventsErr))
+	case len(cur.errors) == 0:
+		lines = append(lines, "none")
+	}
+	for i, e := range cur.errors {
+		if i == topErrors {
+			break
+		}
+		typ := e.Type
+		if e.Code != "" {
+			typ += " (" + e.Code + ")"
+		}
+		lines = append(lines, strings.TrimRight(fmt.Sprintf("%s  %s  %s  %s", e.Time.Local().Format("15:04:05"), e.device, typ, e.Message), " "))
+	}
+	return lines
+}
+
+// topMain runs jtimon top, it refreshes the screen every --top-interval
+// until it is interrupted
+func topMain() {
+	if *topInterval <= 0 {
+		log.Printf("--top-interval must be positive")
+		os.Exit(1)
+	}
+	token := ""
+	if *apiTokenFile != "" {
+		a, err := newAPIAuth(*apiTokenFile, "", "")
+		if err != nil {
+			log.Printf("top: %v", err)
+			os.Exit(1)
+		}
+		token = a.token
+	}
+	interval := time.Duration(*topInterval) * time.Second
+	sigch := make(chan os.Signal, 1)
+	signal.Notify(sigch, os.Interrupt, syscall.SIGTERM)
+
+	// the screen is redrawn in place, without the cursor
+	os.Stdout.WriteString("\x1b[?25l\x1b[2J")
+	defer os.Stdout.WriteString("\x1b[?25h")
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	var prev *topSample
+	for {
+		var lines []string
+		cur, err := topFetch(interval, token)
+		if err != nil {
+			lines = []string{fmt.Sprintf("jtimon top - %s, %v", time.Now().Format("15:04:05"), err)}
+		} else {
+			lines = topLines(prev, cur)
+			prev = cur
+		}
+		width := terminalWidth(os.Stdout)
+		var b strings.Builder
+		b.WriteString("\x1b[H")
+		for _, line := range lines {
+			if width > 0 && len(line) > width {
+				line = line[:width]
+			}
+			b.WriteString(line + "\x1b[K\n")
+		}
+		b.WriteString("\x1b[J")
+		os.Stdout.WriteString(b.String())
+
+		select {
+		case <-sigch:
+			return
+		case <-t.C:
+		}
+	}
+}
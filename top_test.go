@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTopLines(t *testing.T) {
+	now := time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)
+	last := now.Add(-3 * time.Second)
+	prev := &topSample{time: now.Add(-2 * time.Second), devices: []deviceHealth{
+		{Device: "r1", Port: 32767, Connected: true, Packets: 100, Points: 1000, Latencies: 100, LatencySum: 1},
+		{Device: "r2", Port: 32767, Packets: 50, Points: 500},
+	}}
+	cur := &topSample{time: now, devices: []deviceHealth{
+		{Device: "r1", Port: 32767, Connected: true, LastData: &last, Packets: 120, Points: 1200, Drops: 4, Reconnects: 1, Latencies: 120, LatencySum: 1.4},
+		// restarted, its counters are back to 0
+		{Device: "r2", Port: 32767, Packets: 10, Points: 100},
+		{Device: "router-3", Port: 50051, Paused: true},
+	}, errors: []topEvent{
+		{"r2:32767", event{Time: now.Add(-time.Second), Type: EventDisconnect, Code: "Unavailable", Message: "transport is closing"}},
+	}}
+	want := []string{
+		"jtimon top - 10:00:00, 3 devices, 1 connected, 100.0 points/s, 2.0 drops/s",
+		"",
+		"DEVICE          STATE         PACKETS/S   POINTS/S  DROPS/S   LATENCY RECONNECTS  LAST DATA",
+		"r1:32767        connected          10.0      100.0      2.0    20.0ms          1  3s ago",
+		"r2:32767        disconnected          -          -      0.0         -          0  never",
+		"router-3:50051  paused                -          -        -         -          0  never",
+		"",
+		"RECENT ERRORS",
+		time.Unix(now.Unix()-1, 0).Local().Format("15:04:05") + "  r2:32767  disconnect (Unavailable)  transport is closing",
+	}
+	if got := topLines(prev, cur); !reflect.DeepEqual(got, want) {
+		t.Errorf("topLines() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	cur.errors, cur.eventsErr = nil, errors.New("unauthorized")
+	got := topLines(nil, cur)
+	if got[0] != "jtimon top - 10:00:00, 3 devices, 1 connected" || got[len(got)-1] != "could not get the events: unauthorized" {
+		t.Errorf("topLines() of the first refresh =\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestTopFetch(t *testing.T) {
+	defer func(host string, port int32, socket string) {
+		*metricsHost, *metricsPort, *metricsSocket = host, port, socket
+	}(*metricsHost, *metricsPort, *metricsSocket)
+
+	now := time.Now().UTC()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"devices":[{"device":"r1","port":32767,"connected":true,"packets":5,"drops":2,"latencies":1,"latency-sum":0.5}]}`))
+	})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"devices": []interface{}{map[string]interface{}{
+			"device": "r1", "port": 32767, "events": []event{
+				{Time: now.Add(-2 * time.Second), Type: EventConnect},
+				{Time: now.Add(-time.Second), Type: EventError, Message: "decode failed"},
+			}}}})
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	_, port, _ := net.SplitHostPort(s.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	*metricsHost, *metricsPort, *metricsSocket = "127.0.0.1", int32(p), ""
+
+	sample, err := topFetch(time.Second, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sample.devices) != 1 || sample.devices[0].Drops != 2 || sample.devices[0].LatencySum != 0.5 {
+		t.Errorf("devices %+v", sample.devices)
+	}
+	if len(sample.errors) != 1 || sample.errors[0].device != "r1:32767" || sample.errors[0].Message != "decode failed" {
+		t.Errorf("errors %+v", sample.errors)
+	}
+
+	sample, err = topFetch(time.Second, "")
+	if err != nil || sample.eventsErr == nil || sample.eventsErr.Error() != "/events: 401 Unauthorized" {
+		t.Errorf("topFetch() without the token = %+v, %v", sample, err)
+	}
+
+	*metricsPort = 0
+	if _, err := topFetch(time.Second, ""); err == nil {
+		t.Errorf("topFetch() without the internal metrics service = nil")
+	}
+}
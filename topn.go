@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TopNRule only exports the n series of the measurements matching
+// measurement (regex) with the highest value of field (lowest with bottom)
+// per interval milliseconds. The last sample of every series is kept during
+// the interval, the selected ones are written with the first update after
+// the interval ended. Points without field are not affected.
+type TopNRule struct {
+	Measurement string `json:"measurement"`
+	Field       string `json:"field"`
+	N           int    `json:"n"`
+	Interval    int    `json:"interval"`
+	Bottom      bool   `json:"bottom"`
+}
+
+type topNWindow struct {
+	end    time.Time
+	last   map[string]*point
+	values map[string]float64
+}
+
+type topNRule struct {
+	TopNRule
+	re     *regexp.Regexp
+	window *topNWindow
+}
+
+type topN struct {
+	sync.Mutex
+	rules []*topNRule
+	now   func() time.Time
+}
+
+func newTopNTransformer() *transformer {
+	return &transformer{
+		name: "top-n",
+		new:  newTopN,
+	}
+}
+
+func newTopN(jctx *JCtx) (transform, error) {
+	rules := jctx.config.Transform.TopN
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	t := &topN{now: time.Now}
+	for i, rule := range rules {
+		re, err := regexp.Compile(rule.Measurement)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: invalid measurement %q: %v", i, rule.Measurement, err)
+		}
+		if rule.Field == "" {
+			return nil, fmt.Errorf("rule %d: field is missing", i)
+		}
+		if rule.N <= 0 {
+			return nil, fmt.Errorf("rule %d: n must be positive", i)
+		}
+		if rule.Interval == 0 {
+			rule.Interval = DefaultTopNInterval
+		}
+		t.rules = append(t.rules, &topNRule{TopNRule: rule, re: re})
+	}
+	return t, nil
+}
+
+func (t *topN) rule(p *point) *topNRule {
+	for _, rule := range t.rules {
+		if _, ok := p.Fields[rule.Field]; ok && rule.re.MatchString(p.Measurement) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// flush returns the selected points of the window
+func (r *topNRule) flush() []*point {
+	w := r.window
+	r.window = nil
+
+	keys := make([]string, 0, len(w.last))
+	for k := range w.last {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := w.values[keys[i]], w.values[keys[j]]
+		if a == b {
+			return keys[i] < keys[j]
+		}
+		if r.Bottom {
+			return a < b
+		}
+		return a > b
+	})
+	if len(keys) > r.N {
+		keys = keys[:r.N]
+	}
+	out := make([]*point, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, w.last[k])
+	}
+	return out
+}
+
+func (t *topN) apply(points []*point) []*point {
+	t.Lock()
+	defer t.Unlock()
+
+	now := t.now()
+	var out []*point
+	for _, rule := range t.rules {
+		if rule.window != nil && !now.Before(rule.window.end) {
+			out = append(out, rule.flush()...)
+		}
+	}
+
+	for _, p := range points {
+		rule := t.rule(p)
+		if rule == nil {
+			out = append(out, p)
+			continue
+		}
+		v, _, ok := numericValue(p.Fields[rule.Field])
+		if !ok {
+			out = append(out, p)
+			continue
+		}
+		if rule.window == nil {
+			rule.window = &topNWindow{
+				end:    now.Add(time.Duration(rule.Interval) * time.Millisecond),
+				last:   map[string]*point{},
+				values: map[string]float64{},
+			}
+		}
+		key := seriesKey(p, "")
+		rule.window.last[key] = p
+		rule.window.values[key] = v
+	}
+	return out
+}
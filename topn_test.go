@@ -0,0 +1,67 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTopN(t *testing.T) {
+	intf := func(name string, rate float64) *point {
+		return newPoint("/interfaces/", map[string]string{"device": "r1", "name": name},
+			map[string]interface{}{"in-octets_rate": rate}, time.Unix(1, 0))
+	}
+	names := func(points []*point) []string {
+		var n []string
+		for _, p := range points {
+			n = append(n, p.Measurement+":"+p.Tags["name"])
+		}
+		return n
+	}
+
+	tests := []struct {
+		name   string
+		bottom bool
+		want   []string
+	}{
+		{name: "top", want: []string{"/interfaces/:et-0/0/2", "/interfaces/:et-0/0/0", "/components/:"}},
+		{name: "bottom", bottom: true, want: []string{"/interfaces/:et-0/0/3", "/interfaces/:et-0/0/1", "/components/:"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jctx := &JCtx{}
+			jctx.config.Transform.TopN = []TopNRule{
+				{Measurement: "^/interfaces/$", Field: "in-octets_rate", N: 2, Interval: 1000, Bottom: test.bottom},
+			}
+			if err := transformsInit(jctx); err != nil {
+				t.Fatalf("transformsInit failed: %v", err)
+			}
+			now := time.Unix(100, 0)
+			jctx.transforms[0].(*topN).now = func() time.Time { return now }
+
+			// points without the field pass, the others wait for the interval
+			out := applyTransforms(jctx, []*point{
+				intf("et-0/0/0", 5), intf("et-0/0/1", 3), intf("et-0/0/2", 1),
+				newPoint("/components/", map[string]string{}, map[string]interface{}{"temp": 1.0}, time.Unix(1, 0)),
+			})
+			if got := names(out); !reflect.DeepEqual(got, []string{"/components/:"}) {
+				t.Fatalf("got %v", got)
+			}
+
+			// latest sample of a series counts
+			now = now.Add(500 * time.Millisecond)
+			out = applyTransforms(jctx, []*point{intf("et-0/0/2", 9), intf("et-0/0/3", 0)})
+			if len(out) != 0 {
+				t.Fatalf("got %v before the interval ended", names(out))
+			}
+
+			now = now.Add(500 * time.Millisecond)
+			out = applyTransforms(jctx, []*point{
+				newPoint("/components/", map[string]string{}, map[string]interface{}{"temp": 1.0}, time.Unix(2, 0)),
+			})
+			if got := names(out); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// traceFlush is the interval of the exports of the traces, traceBatch the
+// number of traces exported at once at most
+const (
+	traceFlush = 5 * time.Second
+	traceBatch = 512
+)
+
+// traceSpan is one step of the processing of a packet
+type traceSpan struct {
+	id    [8]byte
+	name  string
+	start time.Time
+	end   time.Time
+}
+
+// packetTrace follows a sampled packet from its receipt to its export, one
+// span per step below a span of the whole packet. A nil trace is a packet
+// which is not sampled.
+type packetTrace struct {
+	sync.Mutex
+	id     [16]byte
+	root   traceSpan
+	device string
+	path   string
+	points int
+	spans  []traceSpan
+}
+
+// traceExporter exports the traces to an OpenTelemetry collector with
+// OTLP/HTTP (JSON)
+type traceExporter struct {
+	url    string
+	sample float64
+	client *http.Client
+	ch     chan *packetTrace
+}
+
+// tracer is the trace exporter, nil without --otlp-endpoint
+var tracer *traceExporter
+
+func newTraceExporter(endpoint string, sample float64) *traceExporter {
+	return &traceExporter{
+		url:    strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		sample: sample,
+		client: &http.Client{Timeout: time.Duration(DefaultIDBTimeout) * time.Second},
+		ch:     make(chan *packetTrace, 4*traceBatch),
+	}
+}
+
+func tracingInit() {
+	if *otlpEndpoint == "" {
+		return
+	}
+	tracer = newTraceExporter(*otlpEndpoint, *traceSample)
+	go tracer.run()
+}
+
+func spanID() (id [8]byte) {
+	for id == [8]byte{} {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+// startTrace starts the trace of the packet of path received at rtime if
+// it is sampled
+func startTrace(jctx *JCtx, path string, rtime time.Time) *packetTrace {
+	if tracer == nil || rand.Float64() >= tracer.sample {
+		return nil
+	}
+	t := &packetTrace{
+		root:   traceSpan{id: spanID(), name: "packet", start: rtime},
+		device: jctx.config.Host,
+		path:   path,
+	}
+	for t.id == [16]byte{} {
+		rand.Read(t.id[:])
+	}
+	return t
+}
+
+// span records the step name which started at start and ends now
+func (t *packetTrace) span(name string, start time.Time) {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	t.spans = append(t.spans, traceSpan{id: spanID(), name: name, start: start, end: time.Now()})
+	t.Unlock()
+}
+
+// setPoints records the number of points of the packet
+func (t *packetTrace) setPoints(n int) {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	t.points = n
+	t.Unlock()
+}
+
+// finish ends the trace and queues it for export, it is dropped if the
+// queue is full
+func (t *packetTrace) finish() {
+	if t == nil || tracer == nil {
+		return
+	}
+	t.Lock()
+	t.root.end = time.Now()
+	t.Unlock()
+	select {
+	case tracer.ch <- t:
+	default:
+	}
+}
+
+func (e *traceExporter) run() {
+	ticker := time.NewTicker(traceFlush)
+	defer ticker.Stop()
+	var batch []*packetTrace
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.export(batch); err != nil {
+			globalLog(LogLevelWarn, fmt.Sprintf("Could not export %d traces: %v", len(batch), err))
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case t := <-e.ch:
+			batch = append(batch, t)
+			if len(batch) >= traceBatch {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+}
+
+func otlpString(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: &value}}
+}
+
+func otlpInt(key string, value int) otlpAttribute {
+	v := strconv.Itoa(value)
+	return otlpAttribute{Key: key, Value: otlpValue{IntValue: &v}}
+}
+
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// otlpSpans are the spans of the trace in OTLP JSON
+func (t *packetTrace) otlpSpans() []otlpSpan {
+	t.Lock()
+	defer t.Unlock()
+	const spanKindInternal = 1
+	traceID := hex.EncodeToString(t.id[:])
+	rootID := hex.EncodeToString(t.root.id[:])
+	spans := []otlpSpan{{
+		TraceID:           traceID,
+		SpanID:            rootID,
+		Name:              t.root.name,
+		Kind:              spanKindInternal,
+		StartTimeUnixNano: otlpTime(t.root.start),
+		EndTimeUnixNano:   otlpTime(t.root.end),
+		Attributes: []otlpAttribute{
+			otlpString("device", t.device),
+			otlpString("path", t.path),
+			otlpInt("points", t.points),
+		},
+	}}
+	for _, s := range t.spans {
+		spans = append(spans, otlpSpan{
+			TraceID:           traceID,
+			SpanID:            hex.EncodeToString(s.id[:]),
+			ParentSpanID:      rootID,
+			Name:              s.name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: otlpTime(s.start),
+			EndTimeUnixNano:   otlpTime(s.end),
+		})
+	}
+	return spans
+}
+
+// otlpRequest is the OTLP/HTTP JSON export request of the traces
+func otlpRequest(traces []*packetTrace) ([]byte, error) {
+	var spans []otlpSpan
+	for _, t := range traces {
+		spans = append(spans, t.otlpSpans()...)
+	}
+	type scopeSpans struct {
+		Scope struct {
+			Name    string `json:"name"`
+			Version string `json:"version,omitempty"`
+		} `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	type resourceSpans struct {
+		Resource struct {
+			Attributes []otlpAttribute `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []scopeSpans `json:"scopeSpans"`
+	}
+	var rs resourceSpans
+	rs.Resource.Attributes = []otlpAttribute{otlpString("service.name", "jtimon")}
+	ss := scopeSpans{Spans: spans}
+	ss.Scope.Name = "jtimon"
+	ss.Scope.Version = jtimonVersion
+	rs.ScopeSpans = []scopeSpans{ss}
+	return json.Marshal(struct {
+		ResourceSpans []resourceSpans `json:"resourceSpans"`
+	}{[]resourceSpans{rs}})
+}
+
+func (e *traceExporter) export(traces []*packetTrace) error {
+	body, err := otlpRequest(traces)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	_, err = sinkHTTPDo(e.client, req)
+	return err
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	na_pb "github.com/nileshsimaria/jtimon/telemetry"
+)
+
+func TestStartTrace(t *testing.T) {
+	defer func() { tracer = nil }()
+	jctx := &JCtx{config: Config{Host: "r1"}}
+
+	tests := []struct {
+		name    string
+		tracer  *traceExporter
+		sampled bool
+	}{
+		{name: "no tracer"},
+		{name: "none", tracer: newTraceExporter("http://127.0.0.1:4318", 0)},
+		{name: "all", tracer: newTraceExporter("http://127.0.0.1:4318", 1), sampled: true},
+	}
+	for _, test := range tests {
+		tracer = test.tracer
+		tr := startTrace(jctx, "/interfaces/", time.Now())
+		if (tr != nil) != test.sampled {
+			t.Errorf("%s: got trace %v", test.name, tr)
+		}
+		// not sampled packets have a nil trace
+		tr.span("decode", time.Now())
+		tr.setPoints(1)
+		tr.finish()
+	}
+}
+
+func TestAddIDBTrace(t *testing.T) {
+	tracer = newTraceExporter("http://127.0.0.1:4318", 1)
+	defer func() { tracer = nil }()
+
+	jctx := &JCtx{
+		config: Config{Host: "r1"},
+		influxCtx: InfluxCtx{
+			reXpath: regexp.MustCompile(MatchExpressionXpath),
+			reKey:   regexp.MustCompile(MatchExpressionKey),
+		},
+		sinks: []*sinkCtx{{name: "test", ch: make(chan *point, 10)}},
+	}
+	ocData := &na_pb.OpenConfigData{
+		Path: "sensor_1:/interfaces/:/interfaces/:mib2d",
+		Kv: []*na_pb.KeyValue{
+			{Key: "/interfaces/interface[name='ge-0/0/0']/state/counters/in-octets", Value: &na_pb.KeyValue_UintValue{UintValue: 1}},
+		},
+	}
+	rtime := time.Now()
+	tr := startTrace(jctx, sensorPath(ocData.Path), rtime)
+	tr.span("receive", rtime)
+	addIDB(ocData, jctx, rtime, tr)
+
+	got := <-tracer.ch
+	if got != tr || got.points != 1 || got.root.end.Before(rtime) {
+		t.Fatalf("got trace %+v", got)
+	}
+	var names []string
+	for _, s := range got.spans {
+		names = append(names, s.name)
+		if s.start.Before(rtime) || s.end.Before(s.start) || s.end.After(got.root.end) {
+			t.Errorf("%s: got span from %v to %v in trace from %v to %v", s.name, s.start, s.end, rtime, got.root.end)
+		}
+	}
+	if want := []string{"receive", "decode", "transform", "export"}; len(names) != len(want) ||
+		names[0] != want[0] || names[1] != want[1] || names[2] != want[2] || names[3] != want[3] {
+		t.Errorf("got spans %v, want %v", names, want)
+	}
+}
+
+func TestTraceExport(t *testing.T) {
+	var body []byte
+	var path, ctype string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, ctype = r.URL.Path, r.Header.Get("Content-Type")
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	start := time.Unix(1583058600, 0)
+	tr := &packetTrace{
+		id:     [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		root:   traceSpan{id: [8]byte{1, 1, 1, 1, 1, 1, 1, 1}, name: "packet", start: start, end: start.Add(3 * time.Millisecond)},
+		device: "r1",
+		path:   "/interfaces/",
+		points: 4,
+		spans: []traceSpan{
+			{id: [8]byte{2, 2, 2, 2, 2, 2, 2, 2}, name: "decode", start: start.Add(time.Millisecond), end: start.Add(2 * time.Millisecond)},
+		},
+	}
+	e := newTraceExporter(server.URL+"/", 1)
+	if err := e.export([]*packetTrace{tr}); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/v1/traces" || ctype != "application/json" {
+		t.Errorf("got %s %s", path, ctype)
+	}
+
+	var req struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []otlpAttribute `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Spans []otlpSpan `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("got %s", body)
+	}
+	if a := req.ResourceSpans[0].Resource.Attributes; len(a) != 1 || a[0].Key != "service.name" || *a[0].Value.StringValue != "jtimon" {
+		t.Errorf("got resource %s", body)
+	}
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("got spans %s", body)
+	}
+	root, decode := spans[0], spans[1]
+	if root.TraceID != "0102030405060708090a0b0c0d0e0f10" || root.SpanID != "0101010101010101" || root.ParentSpanID != "" ||
+		root.StartTimeUnixNano != "1583058600000000000" || root.EndTimeUnixNano != "1583058600003000000" || len(root.Attributes) != 3 {
+		t.Errorf("got root span %+v", root)
+	}
+	if decode.TraceID != root.TraceID || decode.ParentSpanID != root.SpanID || decode.Name != "decode" ||
+		decode.StartTimeUnixNano != "1583058600001000000" {
+		t.Errorf("got decode span %+v", decode)
+	}
+	if a := root.Attributes[2]; a.Key != "points" || *a.Value.IntValue != "4" {
+		t.Errorf("got attribute %+v", a)
+	}
+}
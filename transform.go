@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+)
+
+// TransformConfig is the config of the transformations applied to the
+// decoded points before they are written to InfluxDB and the sinks
+type TransformConfig struct {
+	ListKeys ListKeysConfig        `json:"list-keys"`
+	Filter   FilterConfig          `json:"filter"`
+	Sample   []SampleRule          `json:"sample"`
+	Enrich   EnrichConfig          `json:"enrich"`
+	Metadata MetadataConfig        `json:"metadata"`
+	Coerce   []CoerceRule          `json:"coerce"`
+	Expr     ExprConfig            `json:"expr"`
+	Units    []UnitRule            `json:"units"`
+	Rate     []RateRule            `json:"rate"`
+	Delta    []DeltaRule           `json:"delta"`
+	Anomaly  []AnomalyRule         `json:"anomaly"`
+	TopN     []TopNRule            `json:"top-n"`
+	Deadband []DeadbandRule        `json:"deadband"`
+	Script   ScriptConfig          `json:"script"`
+	Flatten  FlattenConfig         `json:"flatten"`
+	Rename   []RenameRule          `json:"rename"`
+	Promote  PromoteConfig         `json:"promote"`
+	Sanitize SanitizeConfig        `json:"sanitize"`
+	Fields   map[string]FieldsRule `json:"fields"`
+}
+
+// transform is one stage of the pipeline. It returns the points to pass on
+// to the next stage, it must not modify the points it got.
+type transform interface {
+	apply(points []*point) []*point
+}
+
+// transformer creates the stage of the worker, new returns nil transform
+// if the stage is not configured
+type transformer struct {
+	name string
+	new  func(*JCtx) (transform, error)
+}
+
+// transformers in the order they are applied
+var transformers = []*transformer{
+	newListKeysTransformer(),
+	newFilterTransformer(),
+	newSampleTransformer(),
+	newEnrichTransformer(),
+	newMetadataTransformer(),
+	newCoerceTransformer(),
+	newExprTransformer(),
+	newUnitsTransformer(),
+	newRateTransformer(),
+	newDeltaTransformer(),
+	newAnomalyTransformer(),
+	newTopNTransformer(),
+	newDeadbandTransformer(),
+	newScriptTransformer(),
+	newFlattenTransformer(),
+	newRenameTransformer(),
+	newPromoteTransformer(),
+	newSanitizeTransformer(),
+	newFieldsTransformer(),
+}
+
+func transformsInit(jctx *JCtx) error {
+	for _, t := range transformers {
+		tr, err := t.new(jctx)
+		if err != nil {
+			return fmt.Errorf("%s transform: %v", t.name, err)
+		}
+		if tr == nil {
+			continue
+		}
+		jctx.transforms = append(jctx.transforms, tr)
+		jLog(jctx, fmt.Sprintf("Successfully initialized %s transform", t.name))
+	}
+	return nil
+}
+
+func applyTransforms(jctx *JCtx, points []*point) []*point {
+	for _, t := range jctx.transforms {
+		if len(points) == 0 {
+			break
+		}
+		points = t.apply(points)
+	}
+	return points
+}
+
+func copyFields(fields map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		c[k] = v
+	}
+	return c
+}
+
+// numericValue returns field value as float64, integer tells whether the
+// value was of an integer type
+func numericValue(v interface{}) (f float64, integer bool, ok bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, false, true
+	case float32:
+		return float64(v), false, true
+	case int:
+		return float64(v), true, true
+	case int32:
+		return float64(v), true, true
+	case int64:
+		return float64(v), true, true
+	case uint32:
+		return float64(v), true, true
+	case uint64:
+		return float64(v), true, true
+	}
+	return 0, false, false
+}
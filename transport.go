@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// transportStats are the gRPC transport stats of a worker: the bytes of its
+// connections on the wire (TLS and HTTP/2 framing, pings and window updates
+// included) and the streams which ended with an error, accessed atomically.
+// conn is the connection to the device, if any.
+type transportStats struct {
+	bytesIn  uint64
+	bytesOut uint64
+	dials    uint64
+	resets   uint64
+
+	sync.Mutex
+	conn net.Conn
+}
+
+// tcpInfo is what the kernel knows of a TCP connection
+type tcpInfo struct {
+	rtt         time.Duration
+	rttVar      time.Duration
+	retransmits uint64
+	cwnd        uint32
+	rcvSpace    uint32
+}
+
+// countingConn counts the bytes of the connection to the device
+type countingConn struct {
+	net.Conn
+	t *transportStats
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddUint64(&c.t.bytesIn, uint64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddUint64(&c.t.bytesOut, uint64(n))
+	return n, err
+}
+
+func (c *countingConn) Close() error {
+	c.t.Lock()
+	if c.t.conn == c.Conn {
+		c.t.conn = nil
+	}
+	c.t.Unlock()
+	return c.Conn.Close()
+}
+
+// dial connects to the device, the bytes of the connection are counted
+func (t *transportStats) dial(addr string, timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddUint64(&t.dials, 1)
+	t.Lock()
+	t.conn = conn
+	t.Unlock()
+	return &countingConn{Conn: conn, t: t}, nil
+}
+
+// dialOption is the dialer of the connections of the worker, nil with an
+// HTTPS proxy which only the dialer of gRPC goes through
+func (t *transportStats) dialOption() grpc.DialOption {
+	if os.Getenv("HTTPS_PROXY") != "" || os.Getenv("https_proxy") != "" {
+		return nil
+	}
+	return grpc.WithDialer(t.dial)
+}
+
+// streamReset counts a stream which ended with an error
+func (t *transportStats) streamReset() {
+	atomic.AddUint64(&t.resets, 1)
+}
+
+// tcpInfo returns what the kernel knows of the connection to the device,
+// false without connection or where it is not known
+func (t *transportStats) tcpInfo() (tcpInfo, bool) {
+	t.Lock()
+	conn := t.conn
+	t.Unlock()
+	if conn == nil {
+		return tcpInfo{}, false
+	}
+	return readTCPInfo(conn)
+}
+
+// windowSize is the initial flow control window of the connections of the
+// worker, 0 if gRPC sizes it (ws-auto)
+func windowSize(jctx *JCtx) int32 {
+	if jctx.config.GRPC.WSAuto {
+		return 0
+	}
+	return jctx.config.GRPC.WS
+}
+
+// stats describes the transport stats of the worker
+func (t *transportStats) stats(jctx *JCtx) string {
+	ws := "auto"
+	if w := windowSize(jctx); w != 0 {
+		ws = fmt.Sprint(w)
+	}
+	s := fmt.Sprintf("%-12v : gRPC window size (bytes)\n", ws)
+	s += fmt.Sprintf("%-12v : gRPC connections dialed\n", atomic.LoadUint64(&t.dials))
+	s += fmt.Sprintf("%-12v : gRPC streams ended with an error\n", atomic.LoadUint64(&t.resets))
+	s += fmt.Sprintf("%-12v : in-wire bytes (TCP)\n", atomic.LoadUint64(&t.bytesIn))
+	s += fmt.Sprintf("%-12v : out-wire bytes (TCP)\n", atomic.LoadUint64(&t.bytesOut))
+	if info, ok := t.tcpInfo(); ok {
+		s += fmt.Sprintf("%-12v : TCP round trip time (+/- %v)\n", info.rtt, info.rttVar)
+		s += fmt.Sprintf("%-12v : TCP retransmits\n", info.retransmits)
+		s += fmt.Sprintf("%-12v : TCP congestion window (segments)\n", info.cwnd)
+		s += fmt.Sprintf("%-12v : TCP receive space (bytes)\n", info.rcvSpace)
+	}
+	return s
+}
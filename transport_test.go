@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransportStats(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		io.Copy(c, c)
+	}()
+
+	jctx := &JCtx{config: Config{GRPC: GRPCConfig{WS: 524288}}}
+	tr := &jctx.transport
+	conn, err := tr.dial(l.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 5)
+	if _, err := io.ReadFull(conn, b); err != nil {
+		t.Fatal(err)
+	}
+	tr.streamReset()
+
+	if tr.bytesIn != 5 || tr.bytesOut != 5 || tr.dials != 1 || tr.resets != 1 {
+		t.Errorf("got %d bytes in, %d out, %d dials and %d resets", tr.bytesIn, tr.bytesOut, tr.dials, tr.resets)
+	}
+	if _, ok := tr.tcpInfo(); ok != (runtime.GOOS == "linux") {
+		t.Errorf("got tcp info %v on %s", ok, runtime.GOOS)
+	}
+	s := tr.stats(jctx)
+	for _, want := range []string{"524288       : gRPC window size", "5            : in-wire bytes"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("stats miss %q:\n%s", want, s)
+		}
+	}
+
+	conn.Close()
+	if _, ok := tr.tcpInfo(); ok {
+		t.Errorf("got tcp info of a closed connection")
+	}
+	jctx.config.GRPC.WSAuto = true
+	if s := tr.stats(jctx); !strings.Contains(s, "auto         : gRPC window size") {
+		t.Errorf("ws-auto: got\n%s", s)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+)
+
+// UnitRule converts numeric values of the fields matching match as
+// value*scale + offset. unit is a shortcut for well known conversions,
+// see unitPresets. Integers stay integers if scale and offset are integral.
+type UnitRule struct {
+	Match  string  `json:"match"`
+	Unit   string  `json:"unit"`
+	Scale  float64 `json:"scale"`
+	Offset float64 `json:"offset"`
+}
+
+var unitPresets = map[string]UnitRule{
+	"bytes-to-bits":           {Scale: 8},
+	"bits-to-bytes":           {Scale: 0.125},
+	"centiseconds-to-seconds": {Scale: 0.01},
+	"milliseconds-to-seconds": {Scale: 0.001},
+	"microseconds-to-seconds": {Scale: 0.000001},
+	"milli":                   {Scale: 0.001},
+	"micro":                   {Scale: 0.000001},
+	"kilo":                    {Scale: 1000},
+	"celsius-to-fahrenheit":   {Scale: 1.8, Offset: 32},
+}
+
+type unitRule struct {
+	re            *regexp.Regexp
+	scale, offset float64
+	integral      bool
+}
+
+type units struct {
+	rules []unitRule
+}
+
+func newUnitsTransformer() *transformer {
+	return &transformer{
+		name: "units",
+		new:  newUnits,
+	}
+}
+
+func newUnits(jctx *JCtx) (transform, error) {
+	rules := jctx.config.Transform.Units
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	u := &units{}
+	for i, r := range rules {
+		if r.Unit != "" {
+			preset, ok := unitPresets[r.Unit]
+			if !ok {
+				return nil, fmt.Errorf("rule %d: unknown unit %q", i, r.Unit)
+			}
+			r.Scale, r.Offset = preset.Scale, preset.Offset
+		}
+		if r.Scale == 0 {
+			return nil, fmt.Errorf("rule %d: unit or scale is missing", i)
+		}
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: invalid match %q: %v", i, r.Match, err)
+		}
+		u.rules = append(u.rules, unitRule{
+			re:       re,
+			scale:    r.Scale,
+			offset:   r.Offset,
+			integral: r.Scale == math.Trunc(r.Scale) && r.Offset == math.Trunc(r.Offset),
+		})
+	}
+	return u, nil
+}
+
+func (u *units) convert(field string, v interface{}) (interface{}, bool) {
+	for _, r := range u.rules {
+		if !r.re.MatchString(field) {
+			continue
+		}
+		f, integer, ok := numericValue(v)
+		if !ok {
+			return nil, false
+		}
+		f = f*r.scale + r.offset
+		if integer && r.integral {
+			return int64(f), true
+		}
+		return f, true
+	}
+	return nil, false
+}
+
+func (u *units) apply(points []*point) []*point {
+	out := make([]*point, 0, len(points))
+	for _, p := range points {
+		var fields map[string]interface{}
+		for k, v := range p.Fields {
+			if c, ok := u.convert(k, v); ok {
+				if fields == nil {
+					fields = copyFields(p.Fields)
+				}
+				fields[k] = c
+			}
+		}
+		if fields == nil {
+			out = append(out, p)
+		} else {
+			out = append(out, newPoint(p.Measurement, p.Tags, fields, p.Timestamp))
+		}
+	}
+	return out
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUnits(t *testing.T) {
+	tests := []struct {
+		name string
+		rule UnitRule
+		in   interface{}
+		want interface{}
+	}{
+		{"bytes-to-bits-int", UnitRule{Unit: "bytes-to-bits"}, uint64(10), int64(80)},
+		{"bytes-to-bits-float", UnitRule{Unit: "bytes-to-bits"}, 1.5, 12.0},
+		{"centiseconds", UnitRule{Unit: "centiseconds-to-seconds"}, uint32(250), 2.5},
+		{"celsius", UnitRule{Unit: "celsius-to-fahrenheit"}, 100.0, 212.0},
+		{"scale-offset", UnitRule{Scale: 2, Offset: -1}, int64(5), int64(9)},
+		{"string-untouched", UnitRule{Unit: "kilo"}, "5", "5"},
+		{"not-matching", UnitRule{Match: "^/other", Unit: "kilo"}, 5.0, 5.0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jctx := &JCtx{}
+			jctx.config.Transform.Units = []UnitRule{test.rule}
+			if err := transformsInit(jctx); err != nil {
+				t.Fatalf("transformsInit failed: %v", err)
+			}
+			in := newPoint("m", nil, map[string]interface{}{"/state/value": test.in}, time.Unix(1, 0))
+			out := applyTransforms(jctx, []*point{in})
+			if got := out[0].Fields["/state/value"]; !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v (%T), want %v (%T)", got, got, test.want, test.want)
+			}
+		})
+	}
+
+	for _, bad := range []UnitRule{{Unit: "furlongs"}, {Match: "x"}, {Match: "(", Scale: 2}} {
+		jctx := &JCtx{}
+		jctx.config.Transform.Units = []UnitRule{bad}
+		if err := transformsInit(jctx); err == nil {
+			t.Errorf("%+v: want error, got nil", bad)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// jtimonVars is the state of jtimon in /debug/vars
+type jtimonVars struct {
+	Version    string       `json:"version"`
+	Goroutines int          `json:"goroutines"`
+	Devices    []deviceVars `json:"devices"`
+}
+
+// deviceVars is the state of a worker in /debug/vars. ConfigHash is the
+// hash of its config without the secrets, it changes with the config.
+type deviceVars struct {
+	Device       string               `json:"device"`
+	Port         int                  `json:"port"`
+	File         string               `json:"file"`
+	ConfigHash   string               `json:"config-hash"`
+	Connected    bool                 `json:"connected"`
+	Paused       bool                 `json:"paused"`
+	Started      time.Time            `json:"started"`
+	LastData     *time.Time           `json:"last-data,omitempty"`
+	Packets      uint64               `json:"packets"`
+	Points       uint64               `json:"points"`
+	DecodeErrors uint64               `json:"decode-errors"`
+	Reconnects   uint64               `json:"reconnects"`
+	BytesIn      uint64               `json:"bytes-in"`
+	BytesOut     uint64               `json:"bytes-out"`
+	StreamResets uint64               `json:"stream-resets"`
+	Window       int32                `json:"grpc-window,omitempty"`
+	RTT          float64              `json:"rtt-ms,omitempty"`
+	Drops        map[string]uint64    `json:"drops"`
+	Queues       map[string]queueVars `json:"queues"`
+}
+
+// queueVars is the length and the capacity of an internal queue
+type queueVars struct {
+	Len int `json:"len"`
+	Cap int `json:"cap"`
+}
+
+// configHash is the sha256 of the config without its secrets
+func configHash(cfg Config) (string, error) {
+	v, err := redactConfig(cfg)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+}
+
+// workerVars returns the state of the worker
+func workerVars(jctx *JCtx) deviceVars {
+	d := deviceVars{
+		Device:       jctx.config.Host,
+		Port:         jctx.config.Port,
+		File:         jctx.file,
+		Connected:    atomic.LoadInt32(&jctx.metrics.connected) == 1,
+		Started:      jctx.stats.started().UTC(),
+		Packets:      atomic.LoadUint64(&jctx.metrics.packets),
+		Points:       atomic.LoadUint64(&jctx.metrics.points),
+		DecodeErrors: atomic.LoadUint64(&jctx.metrics.decodeErrs),
+		Reconnects:   atomic.LoadUint64(&jctx.metrics.reconnects),
+		BytesIn:      atomic.LoadUint64(&jctx.transport.bytesIn),
+		BytesOut:     atomic.LoadUint64(&jctx.transport.bytesOut),
+		StreamResets: atomic.LoadUint64(&jctx.transport.resets),
+		Window:       windowSize(jctx),
+		Drops:        map[string]uint64{},
+		Queues:       map[string]queueVars{},
+	}
+	if hash, err := configHash(jctx.config); err == nil {
+		d.ConfigHash = hash
+	}
+	d.Paused, _ = jctx.paused.state()
+	if last := atomic.LoadInt64(&jctx.metrics.lastData); last != 0 {
+		t := time.Unix(0, last).UTC()
+		d.LastData = &t
+	}
+	if rtt, ok := jctx.rtt.get(); ok {
+		d.RTT = float64(rtt) / float64(time.Millisecond)
+	}
+	for _, q := range jctx.drops.queues() {
+		d.Drops[q] = jctx.drops.get(q)
+	}
+	workerQueues(jctx, func(name string, length, capacity int) {
+		d.Queues[name] = queueVars{Len: length, Cap: capacity}
+	})
+	return d
+}
+
+// varsHandler serves /debug/vars in the format of expvar: the published
+// vars, e.g. cmdline and memstats, and jtimon with the state of the workers
+// in the scope of the request, for scripts and for diffs between two
+// calls or two instances
+func varsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	v := jtimonVars{Version: jtimonVersion, Goroutines: runtime.NumGoroutine(), Devices: []deviceVars{}}
+	for _, jctx := range requestScope(r.Context()).filter(deviceWorkers("")) {
+		v.Devices = append(v.Devices, workerVars(jctx))
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprintf(w, "{\n")
+	expvar.Do(func(kv expvar.KeyValue) {
+		fmt.Fprintf(w, "%q: %s,\n", kv.Key, kv.Value)
+	})
+	fmt.Fprintf(w, "%q: %s\n}\n", "jtimon", b)
+}
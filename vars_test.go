@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestConfigHash(t *testing.T) {
+	a := Config{Host: "r1", Port: 32767, User: "jtimon", Password: "secret"}
+	h1, err := configHash(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := a
+	b.Password = "other"
+	if h2, _ := configHash(b); h2 != h1 {
+		t.Errorf("the hash changed with the password: %s %s", h1, h2)
+	}
+	b.Port = 50051
+	if h3, _ := configHash(b); h3 == h1 {
+		t.Errorf("the hash did not change with the port")
+	}
+}
+
+func TestVarsHandler(t *testing.T) {
+	r1 := &JCtx{config: Config{Host: "r1", Port: 32767, Groups: []string{"emea"}}, control: make(chan os.Signal)}
+	r1.metrics.connected, r1.metrics.packets, r1.metrics.points = 1, 10, 100
+	r1.metrics.lastData = time.Now().UnixNano()
+	r1.drops.add("sink/redis", 3)
+	r1.sinks = []*sinkCtx{{name: "redis", ch: make(chan *point, 8)}}
+	r1.sinks[0].ch <- &point{}
+	r2 := &JCtx{config: Config{Host: "r2", Port: 32767, Groups: []string{"apac"}}, control: make(chan os.Signal)}
+	for _, jctx := range []*JCtx{r1, r2} {
+		dropsInit(jctx)
+		defer dropsStop(jctx)
+	}
+
+	rec := httptest.NewRecorder()
+	varsHandler(rec, httptest.NewRequest("GET", "/debug/vars", nil))
+	var v struct {
+		Cmdline  []string        `json:"cmdline"`
+		Memstats json.RawMessage `json:"memstats"`
+		Jtimon   jtimonVars      `json:"jtimon"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("%d %s: %v", rec.Code, rec.Body.String(), err)
+	}
+	if len(v.Cmdline) == 0 || len(v.Memstats) == 0 {
+		t.Errorf("no cmdline or memstats: %s", rec.Body.String())
+	}
+	devices := map[string]deviceVars{}
+	for _, d := range v.Jtimon.Devices {
+		devices[d.Device] = d
+	}
+	d, ok := devices["r1"]
+	if !ok || !d.Connected || d.Packets != 10 || d.Points != 100 || d.LastData == nil || d.ConfigHash == "" {
+		t.Errorf("got %+v", d)
+	}
+	if d.Drops["sink/redis"] != 3 || d.Queues["sink/redis"] != (queueVars{Len: 1, Cap: 8}) {
+		t.Errorf("got drops %v queues %v", d.Drops, d.Queues)
+	}
+	if d, ok := devices["r2"]; !ok || d.Connected || len(d.Queues) != 0 {
+		t.Errorf("got %+v", d)
+	}
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/debug/vars", nil)
+	varsHandler(rec, req.WithContext(withScope(req.Context(), apiScope{"apac": true})))
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatal(err)
+	}
+	if len(v.Jtimon.Devices) != 1 || v.Jtimon.Devices[0].Device != "r2" {
+		t.Errorf("scope apac: got %+v", v.Jtimon.Devices)
+	}
+
+	rec = httptest.NewRecorder()
+	varsHandler(rec, httptest.NewRequest("POST", "/debug/vars", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: got code %d", rec.Code)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// versionInfo is the answer of /version, what is deployed
+type versionInfo struct {
+	Version   string   `json:"version"`
+	Commit    string   `json:"commit"`
+	BuildTime string   `json:"build-time"`
+	Go        goInfo   `json:"go"`
+	Vendors   []string `json:"vendors"`
+	Sinks     []string `json:"sinks"`
+	Enabled   []string `json:"enabled"`
+}
+
+// goInfo is the Go runtime of jtimon
+type goInfo struct {
+	Version    string `json:"version"`
+	OS         string `json:"os"`
+	Arch       string `json:"arch"`
+	CPUs       int    `json:"cpus"`
+	MaxProcs   int    `json:"max-procs"`
+	Goroutines int    `json:"goroutines"`
+}
+
+// enabledFeatures are the optional features turned on by the flags, and
+// the outputs the workers write to
+func enabledFeatures() []string {
+	var enabled []string
+	for _, f := range []struct {
+		name string
+		on   bool
+	}{
+		{"prometheus", *prom},
+		{"fips", *fipsMode},
+		{"admin", adminEnabled()},
+		{"api-tls", apiTLS != nil},
+		{"api-auth", apiAuthn != nil},
+		{"api-rate-limit", apiLimit != nil},
+		{"api-audit", apiAudit != nil},
+		{"recent-points", recentEnabled()},
+		{"memory-limit", *memoryLimit > 0},
+		{"statsd", *statsdAddr != ""},
+		{"tracing", *otlpEndpoint != ""},
+		{"pprof", *pProf},
+	} {
+		if f.on {
+			enabled = append(enabled, f.name)
+		}
+	}
+
+	outputs := map[string]bool{}
+	metricWorkers.Lock()
+	for jctx := range metricWorkers.m {
+		if jctx.influxCtx.influxClient != nil {
+			outputs["influx"] = true
+		}
+		for _, s := range jctx.sinks {
+			outputs[s.name] = true
+		}
+	}
+	metricWorkers.Unlock()
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append(enabled, names...)
+}
+
+func getVersionInfo() versionInfo {
+	v := versionInfo{
+		Version:   jtimonVersion,
+		Commit:    gitCommit,
+		BuildTime: buildTime,
+		Go: goInfo{
+			Version:    runtime.Version(),
+			OS:         runtime.GOOS,
+			Arch:       runtime.GOARCH,
+			CPUs:       runtime.NumCPU(),
+			MaxProcs:   runtime.GOMAXPROCS(0),
+			Goroutines: runtime.NumGoroutine(),
+		},
+		Enabled: enabledFeatures(),
+	}
+	for _, vendor := range vendors {
+		v.Vendors = append(v.Vendors, vendor.name)
+	}
+	for _, s := range sinks {
+		v.Sinks = append(v.Sinks, s.name)
+	}
+	if v.Enabled == nil {
+		v.Enabled = []string{}
+	}
+	return v
+}
+
+// versionHandler serves /version, for the fleet tooling to check what is
+// deployed
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, getVersionInfo())
+}
+
+// versionMain runs jtimon version
+func versionMain(w io.Writer) {
+	v := getVersionInfo()
+	fmt.Fprintf(w, "jtimon %s\ncommit %s\nbuilt %s with %s %s/%s", v.Version, v.Commit, v.BuildTime, v.Go.Version, v.Go.OS, v.Go.Arch)
+	if fipsBuild {
+		fmt.Fprintf(w, " (BoringCrypto)")
+	}
+	fmt.Fprintf(w, "\nvendors %s\nsinks %s\n", strings.Join(v.Vendors, ", "), strings.Join(v.Sinks, ", "))
+}
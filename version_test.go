@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestVersionHandler(t *testing.T) {
+	defer func(v, c string, p bool) { jtimonVersion, gitCommit, *prom = v, c, p }(jtimonVersion, gitCommit, *prom)
+	jtimonVersion, gitCommit, *prom = "0123abc-master", "0123abc", true
+	apiAuthn = &apiAuth{token: "t0ken"}
+	defer func() { apiAuthn = nil }()
+
+	r1 := &JCtx{file: "r1.json", config: Config{Host: "r1"}, sinks: []*sinkCtx{{name: "kafka"}, {name: "loki"}}}
+	dropsInit(r1)
+	defer dropsStop(r1)
+	r2 := &JCtx{file: "r2.json", config: Config{Host: "r2"}, sinks: []*sinkCtx{{name: "amqp"}, {name: "loki"}}}
+	dropsInit(r2)
+	defer dropsStop(r2)
+
+	rec := httptest.NewRecorder()
+	versionHandler(rec, httptest.NewRequest("GET", "/version", nil))
+	var got versionInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != "0123abc-master" || got.Commit != "0123abc" || got.BuildTime != buildTime {
+		t.Errorf("got %s", rec.Body)
+	}
+	if got.Go.Version != runtime.Version() || got.Go.OS != runtime.GOOS || got.Go.CPUs == 0 || got.Go.Goroutines == 0 {
+		t.Errorf("got runtime %+v", got.Go)
+	}
+	if !reflect.DeepEqual(got.Vendors, []string{"juniper-junos", "cisco-iosxr"}) || len(got.Sinks) != len(sinks) {
+		t.Errorf("got vendors %v and sinks %v", got.Vendors, got.Sinks)
+	}
+	// the workers of the other tests may still be there
+	enabled := map[string]int{}
+	for _, e := range got.Enabled {
+		enabled[e]++
+	}
+	for _, e := range []string{"prometheus", "api-auth", "amqp", "kafka", "loki"} {
+		if enabled[e] != 1 {
+			t.Errorf("got enabled %v, want %s once", got.Enabled, e)
+		}
+	}
+	if enabled["admin"] != 0 || enabled["api-tls"] != 0 {
+		t.Errorf("got enabled %v", got.Enabled)
+	}
+}
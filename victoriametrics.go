@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	client "github.com/influxdata/influxdb/client/v2"
+)
+
+// VictoriaMetricsConfig is the config of the VictoriaMetrics sink. format is
+// either "json" (/api/v1/import) or "influx" (/write, line protocol).
+type VictoriaMetricsConfig struct {
+	URL         string            `json:"url"`
+	Format      string            `json:"format"`
+	User        string            `json:"user"`
+	Password    string            `json:"password"`
+	ExtraLabels map[string]string `json:"extra-labels"`
+	BatchConfig
+}
+
+type vmSink struct {
+	cfg    VictoriaMetricsConfig
+	url    string
+	client *http.Client
+}
+
+func newVictoriaMetricsSink() *sink {
+	return &sink{
+		name: "victoriametrics",
+		open: openVictoriaMetricsSink,
+	}
+}
+
+func openVictoriaMetricsSink(jctx *JCtx) (sinkWriter, BatchConfig, error) {
+	cfg := jctx.config.VictoriaMetrics
+	if cfg.URL == "" {
+		return nil, cfg.BatchConfig, nil
+	}
+
+	path := "/api/v1/import"
+	switch cfg.Format {
+	case "", "json":
+	case "influx":
+		// no db param, VictoriaMetrics would turn it into a db label
+		path = "/write"
+	default:
+		return nil, cfg.BatchConfig, fmt.Errorf("victoriametrics format %q is not supported, use json or influx", cfg.Format)
+	}
+
+	// extra labels are attached by VictoriaMetrics itself and win over tags
+	keys := make([]string, 0, len(cfg.ExtraLabels))
+	for k := range cfg.ExtraLabels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	q := url.Values{}
+	for _, k := range keys {
+		q.Add("extra_label", k+"="+cfg.ExtraLabels[k])
+	}
+
+	s := &vmSink{
+		cfg:    cfg,
+		url:    strings.TrimSuffix(cfg.URL, "/") + path,
+		client: &http.Client{Timeout: time.Duration(DefaultIDBTimeout) * time.Second},
+	}
+	if len(q) > 0 {
+		s.url += "?" + q.Encode()
+	}
+	return s, cfg.BatchConfig, nil
+}
+
+// vmValue converts field value to float64, VictoriaMetrics can not store strings
+func vmValue(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+type vmImportLine struct {
+	Metric     map[string]string `json:"metric"`
+	Values     []float64         `json:"values"`
+	Timestamps []int64           `json:"timestamps"`
+}
+
+func (s *vmSink) encodeJSON(points []*point) *bytes.Buffer {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, p := range points {
+		ts := p.Timestamp.UnixNano() / int64(time.Millisecond)
+		for name, v := range p.Fields {
+			value, ok := vmValue(v)
+			if !ok {
+				continue
+			}
+			metric := map[string]string{
+				"__name__": promName(p.Measurement + "_" + strings.TrimPrefix(name, "/")),
+			}
+			for k, v := range p.Tags {
+				if v != "" {
+					metric[promName(k)] = v
+				}
+			}
+			enc.Encode(vmImportLine{Metric: metric, Values: []float64{value}, Timestamps: []int64{ts}})
+		}
+	}
+	return &buf
+}
+
+func (s *vmSink) encodeInflux(points []*point) *bytes.Buffer {
+	var buf bytes.Buffer
+	for _, p := range points {
+		fields := make(map[string]interface{}, len(p.Fields))
+		for name, v := range p.Fields {
+			if _, ok := vmValue(v); ok {
+				fields[name] = v
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		pt, err := client.NewPoint(p.Measurement, p.Tags, fields, p.Timestamp)
+		if err != nil {
+			continue
+		}
+		buf.WriteString(pt.String())
+		buf.WriteByte('\n')
+	}
+	return &buf
+}
+
+func (s *vmSink) write(points []*point) error {
+	var body *bytes.Buffer
+	if s.cfg.Format == "influx" {
+		body = s.encodeInflux(points)
+	} else {
+		body = s.encodeJSON(points)
+	}
+	if body.Len() == 0 {
+		return nil
+	}
+
+	req, err := http.NewRequest("POST", s.url, body)
+	if err != nil {
+		return err
+	}
+	if s.cfg.User != "" {
+		req.SetBasicAuth(s.cfg.User, s.cfg.Password)
+	}
+	_, err = sinkHTTPDo(s.client, req)
+	return err
+}
+
+func (s *vmSink) close() {
+}
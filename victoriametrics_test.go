@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVictoriaMetricsSink(t *testing.T) {
+	var path, query, body string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, _ := r.BasicAuth(); u != "u" || p != "p" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		path = r.URL.Path
+		query = r.URL.RawQuery
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	p := newPoint("ifd", map[string]string{"device": "r1", "interface-name": "et-0/0/0"},
+		map[string]interface{}{"/in-octets": uint64(10), "/oper-status": "UP", "/up": true}, time.Unix(1, 0))
+
+	t.Run("json", func(t *testing.T) {
+		jctx := &JCtx{}
+		jctx.config.VictoriaMetrics = VictoriaMetricsConfig{
+			URL: server.URL, User: "u", Password: "p",
+			ExtraLabels: map[string]string{"site": "dc1", "env": "lab"},
+		}
+		w, _, err := openVictoriaMetricsSink(jctx)
+		if err != nil {
+			t.Fatalf("openVictoriaMetricsSink failed: %v", err)
+		}
+		if err := w.write([]*point{p}); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		if path != "/api/v1/import" || query != "extra_label=env%3Dlab&extra_label=site%3Ddc1" {
+			t.Errorf("unexpected request %s?%s", path, query)
+		}
+
+		lines := strings.Split(strings.TrimSpace(body), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("string field must be skipped, want 2 lines, got %d: %s", len(lines), body)
+		}
+		found := false
+		for _, line := range lines {
+			var l vmImportLine
+			if err := json.Unmarshal([]byte(line), &l); err != nil {
+				t.Fatalf("%v: %s", err, line)
+			}
+			if l.Metric["__name__"] == "ifd_in_octets" {
+				found = true
+				if l.Metric["interface_name"] != "et-0/0/0" || l.Values[0] != 10 || l.Timestamps[0] != 1000 {
+					t.Errorf("unexpected line %s", line)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("ifd_in_octets is missing: %s", body)
+		}
+	})
+
+	t.Run("influx", func(t *testing.T) {
+		jctx := &JCtx{}
+		jctx.config.VictoriaMetrics = VictoriaMetricsConfig{URL: server.URL, Format: "influx", User: "u", Password: "p"}
+		w, _, err := openVictoriaMetricsSink(jctx)
+		if err != nil {
+			t.Fatalf("openVictoriaMetricsSink failed: %v", err)
+		}
+		if err := w.write([]*point{p}); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		want := "ifd,device=r1,interface-name=et-0/0/0 /in-octets=10u,/up=true 1000000000\n"
+		if path != "/write" || query != "" || body != want {
+			t.Errorf("unexpected request %s?%s\ngot:  %q\nwant: %q", path, query, body, want)
+		}
+	})
+
+	t.Run("bad-format", func(t *testing.T) {
+		jctx := &JCtx{}
+		jctx.config.VictoriaMetrics = VictoriaMetricsConfig{URL: server.URL, Format: "csv"}
+		if _, _, err := openVictoriaMetricsSink(jctx); err == nil {
+			t.Errorf("want error, got nil")
+		}
+	})
+}
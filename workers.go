@@ -7,27 +7,63 @@ import (
 	"os/signal"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"google.golang.org/grpc"
 )
 
+// reconnectDelay is the wait of the workers before they connect again,
+// the tests against the simulator shorten it
+var reconnectDelay = 10 * time.Second
+
 // JCtx is JTIMON run time context
 type JCtx struct {
-	config    Config
-	file      string
-	wg        *sync.WaitGroup
-	influxCtx InfluxCtx
-	stats     statsCtx
-	pExporter *jtimonPExporter
-	control   chan os.Signal
-	running   bool
-	alias     *Alias
-	testMeta  *os.File
-	testBytes *os.File
-	testExp   *os.File
-	testRes   *os.File
+	config     Config
+	file       string
+	wg         *sync.WaitGroup
+	influxCtx  InfluxCtx
+	sinks      []*sinkCtx
+	transforms []transform
+	decoders   []decoderBinding
+	paths      *pathTrie
+	pipeline   *pipeline
+	drops      dropCounters
+	stats      statsCtx
+	statsTask  *schedTask
+	adaptive   *adaptive
+	routes     *routes
+	self       *selfTelemetry
+	rtt        *rttProbe
+	events     eventRing
+	logDedup   logDedup
+	transport  transportStats
+	paused     pauseState
+	handoff    handoffState
+	facts      factsState
+	freqs      freqState
+	pathsSet   pathsOverride
+	tail       tailState
+	recent     recentState
+	conn       liveConn
+	capture    captureState
+	quarantine quarantineState
+	undrained  bool
+	stale      *staleCheck
+	certs      *certWatch
+	csv        *csvStats
+	metrics    workerMetrics
+	startSlot  func()
+	pExporter  *jtimonPExporter
+	control    chan os.Signal
+	signalch   chan os.Signal
+	running    bool
+	alias      *Alias
+	testMeta   *os.File
+	testBytes  *os.File
+	testExp    *os.File
+	testRes    *os.File
 }
 
 // JWorkers holds worker
@@ -38,15 +74,26 @@ type JWorkers struct {
 	files    []string
 	fileList string
 	sigchan  chan os.Signal
+	// discovered are the changes of the config files of the discovered
+	// devices, discoveredFiles the files of their workers
+	discovered      chan discoveryChange
+	discoveredFiles map[string]bool
+	watchers        []configWatcher
+	discoveryDone   chan struct{}
+	discoveryOnce   sync.Once
 }
 
 // NewJWorkers to create new workers
 func NewJWorkers(files []string, fileList string, mr int64) *JWorkers {
 	return &JWorkers{
-		m:        make(map[string]*JWorker),
-		mr:       mr,
-		files:    files,
-		fileList: fileList,
+		m:               make(map[string]*JWorker),
+		mr:              mr,
+		files:           files,
+		fileList:        fileList,
+		sigchan:         make(chan os.Signal, 10),
+		discovered:      make(chan discoveryChange),
+		discoveredFiles: make(map[string]bool),
+		discoveryDone:   make(chan struct{}),
 	}
 }
 
@@ -69,6 +116,10 @@ func (ws *JWorkers) StartWorkers() {
 	for _, v := range ws.m {
 		v.signalch <- syscall.SIGCONT
 	}
+	for _, w := range ws.watchers {
+		ws.wg.Add(1)
+		go ws.runDiscovery(w)
+	}
 	go ws.signalHandler(ws.fileList)
 	go ws.maxRunHandler(ws.mr)
 }
@@ -101,6 +152,14 @@ func (ws *JWorkers) StartWorker(file string) {
 // AddWorker is to add new worker in set of (actually map of) workers
 func (ws *JWorkers) AddWorker(file string) {
 	if w, err := NewJWorker(file, &ws.wg); err == nil {
+		others := make(map[string]Config, len(ws.m))
+		for f, other := range ws.m {
+			others[f] = other.jctx.config
+		}
+		if err := cidDuplicate(file, w.jctx.config, others); err != nil {
+			jLogError(w.jctx, "", "Duplicate client id", err)
+			recordEvent(w.jctx, EventError, "", err.Error())
+		}
 		ws.m[file] = w
 		ws.wg.Add(1)
 	}
@@ -113,6 +172,10 @@ func (ws *JWorkers) maxRunHandler(maxRunTime int64) {
 		// Once the time expires, interrupt worker go routines.
 		tickChan := time.NewTimer(time.Second * time.Duration(maxRunTime)).C
 		<-tickChan
+		sdNotify("STOPPING=1\nSTATUS=draining")
+		go haStop()
+		go clusterStop()
+		ws.stopDiscovery()
 		for _, w := range ws.m {
 			w.signalch <- os.Interrupt
 		}
@@ -139,9 +202,10 @@ func (ws *JWorkers) handleConfigChanges() {
 				ws.StartWorker(file)
 			}
 		}
-		// handle deletions
+		// handle deletions, the workers of the discovered devices are
+		// deleted by their discovery
 		for file, w := range ws.m {
-			if StringInSlice(file, configfilelist.Filenames) == false {
+			if StringInSlice(file, configfilelist.Filenames) == false && !ws.discoveredFiles[file] {
 				// kill the worker go routine and remove it from the map
 				log.Printf("deleting worker for %v", file)
 				w.signalch <- os.Interrupt
@@ -154,23 +218,46 @@ func (ws *JWorkers) handleConfigChanges() {
 }
 
 func (ws *JWorkers) signalHandler(configFileList string) {
-	sigchan := make(chan os.Signal, 10)
-	ws.sigchan = sigchan
-	// handle interrupt and sighup
-	signal.Notify(sigchan, os.Interrupt, syscall.SIGHUP)
+	sigchan := ws.sigchan
+	// handle interrupt, sigterm, sighup and sigusr1
+	signal.Notify(sigchan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1)
+	stopping := false
 	for {
-		s := <-sigchan
+		var s os.Signal
+		select {
+		case s = <-sigchan:
+		case c := <-ws.discovered:
+			if !stopping {
+				ws.applyDiscovery(c)
+			}
+			continue
+		}
 		switch s {
 		case syscall.SIGHUP:
 			// propagate the signal to workers and continue waiting for signals
 			if len(ws.fileList) != 0 {
+				sdNotify("RELOADING=1")
 				ws.handleConfigChanges()
+				sdNotify("READY=1")
 			}
-		case os.Interrupt:
+		case syscall.SIGUSR1:
+			// the log files have been rotated by an external tool
+			reopenLogFiles()
+		case os.Interrupt, syscall.SIGTERM:
+			// the workers stop the same way on both, a second signal
+			// does not wait for them to drain
+			if stopping {
+				log.Printf("exiting without writing the pending updates")
+				os.Exit(ExitNotDrained)
+			}
+			stopping = true
+			sdNotify("STOPPING=1\nSTATUS=draining")
+			go haStop()
+			go clusterStop()
+			ws.stopDiscovery()
 			for _, w := range ws.m {
-				w.signalch <- s
+				go func(w *JWorker) { w.signalch <- os.Interrupt }(w)
 			}
-			return
 		}
 	}
 }
@@ -191,6 +278,7 @@ func NewJWorker(file string, wg *sync.WaitGroup) (*JWorker, error) {
 		file:      file,
 		wg:        wg,
 		pExporter: exporter,
+		signalch:  signalch,
 		stats: statsCtx{
 			startTime: time.Now(),
 		},
@@ -216,15 +304,31 @@ func NewJWorker(file string, wg *sync.WaitGroup) (*JWorker, error) {
 			case sig := <-signalch:
 				switch sig {
 				case os.Interrupt:
-					// we are asked to stop
-					printSummary(&jctx)
+					// we are asked to stop: let the downstream subscribe go
+					// routines know we are done and no need to restart, then
+					// write what was received
 					jLog(&jctx, fmt.Sprintf("Streaming for host %s will be stopped (SIGINT)", jctx.config.Host))
+					deadline := drainDeadline()
+					stopStreaming(&jctx, deadline)
+					if !drainWorker(&jctx, deadline) {
+						jctx.undrained = true
+						setExitStatus(ExitNotDrained)
+					}
+					printSummary(&jctx)
+					summaryAdd(&jctx, "interrupt")
 					if *genTestData {
 						testTearDown(&jctx)
 					}
 					jctx.wg.Done()
-					// let the downstream subscribe go routines know we are done and no need to restart
-					jctx.control <- os.Interrupt
+					statsStop(&jctx)
+					dropsStop(&jctx)
+					adaptiveStop(&jctx)
+					routesStop(&jctx)
+					selfStop(&jctx)
+					rttStop(&jctx)
+					csvStatsStop(&jctx)
+					staleStop(&jctx)
+					certWatchStop(&jctx)
 					logStop(&jctx)
 					return
 				case syscall.SIGHUP:
@@ -236,7 +340,7 @@ func NewJWorker(file string, wg *sync.WaitGroup) (*JWorker, error) {
 					restart := false
 					err := ConfigRead(&jctx, false, &restart)
 					if err != nil {
-						jLog(&jctx, fmt.Sprintln(err))
+						jLogError(&jctx, "", "config re-parse failed", err)
 					} else if jctx.running {
 						if restart {
 							jctx.control <- syscall.SIGHUP
@@ -252,11 +356,25 @@ func NewJWorker(file string, wg *sync.WaitGroup) (*JWorker, error) {
 				switch status {
 				case false:
 					// worker must have encountered error
+					startDone(&jctx)
+					setExitStatus(ExitWorkerFailed)
 					printSummary(&jctx)
+					summaryAdd(&jctx, "error")
 					jctx.wg.Done()
+					statsStop(&jctx)
+					dropsStop(&jctx)
+					adaptiveStop(&jctx)
+					routesStop(&jctx)
+					selfStop(&jctx)
+					rttStop(&jctx)
+					csvStatsStop(&jctx)
+					staleStop(&jctx)
+					certWatchStop(&jctx)
 					logStop(&jctx)
 					return
 				case true:
+					startDone(&jctx)
+					setConnected(&jctx, true)
 					jctx.running = true
 				}
 			}
@@ -269,19 +387,28 @@ func work(jctx *JCtx, statusch chan bool) {
 	var retry bool
 	var opts []grpc.DialOption
 
+	// wait for our turn to connect, if the start of the workers is paced
+	jctx.startSlot = starts.acquire()
+	defer startDone(jctx)
+
 connect:
+	if retry {
+		startDone(jctx)
+		jctx.self.reconnect()
+		atomic.AddUint64(&jctx.metrics.reconnects, 1)
+	}
 	// Read the host-name and vendor from the config as they might be changed
 	vendor, err := getVendor(jctx)
 	if opts, err = getGPRCDialOptions(jctx, vendor); err != nil {
-		jLog(jctx, fmt.Sprintf("%v", err))
+		jLogError(jctx, "", "Could not get the dial options", err)
 		statusch <- false
 		return
 	}
 
-	hostname := jctx.config.Host + ":" + strconv.Itoa(jctx.config.Port)
+	hostname := deviceAddress(jctx) + ":" + strconv.Itoa(jctx.config.Port)
 	if hostname == ":0" {
 		statusch <- false
-		jLog(jctx, fmt.Sprintf("Not a valid host-name %s", hostname))
+		jLogError(jctx, "", fmt.Sprintf("Not a valid host-name %s", hostname), nil)
 		return
 	}
 
@@ -299,6 +426,10 @@ connect:
 	default:
 		// No signal recieved, Continue the connection attempt
 	}
+	if !waitResumed(jctx) {
+		jLog(jctx, fmt.Sprintf("Connection for %s has been interrupted", hostname))
+		return
+	}
 
 	if retry {
 		jLog(jctx, fmt.Sprintf("Reconnecting to %s", hostname))
@@ -306,9 +437,13 @@ connect:
 		jLog(jctx, fmt.Sprintf("Connecting to %s", hostname))
 	}
 	conn, err := grpc.Dial(hostname, opts...)
+	atomic.StoreInt32(&jctx.metrics.attempted, 1)
 	if err != nil {
-		jLog(jctx, fmt.Sprintf("[%s] could not dial: %v", jctx.config.Host, err))
-		time.Sleep(10 * time.Second)
+		jLogError(jctx, "", fmt.Sprintf("[%s] could not dial", jctx.config.Host), err)
+		recordEvent(jctx, EventError, "", fmt.Sprintf("could not dial: %v", err))
+		if !failover(jctx, err) {
+			time.Sleep(reconnectDelay)
+		}
 		retry = true
 		goto connect
 	}
@@ -317,18 +452,28 @@ connect:
 	// if required.
 	if vendor.loginCheckRequired {
 		if err := vendor.sendLoginCheck(jctx, conn); err != nil {
-			jLog(jctx, fmt.Sprintf("%v", err))
-			time.Sleep(10 * time.Second)
+			jLogError(jctx, "", "Login check failed", err)
+			recordEvent(jctx, EventError, "", fmt.Sprintf("login check failed: %v", err))
+			if !failover(jctx, err) {
+				time.Sleep(reconnectDelay)
+			}
 			retry = true
 			conn.Close()
 			goto connect
 		}
 	}
 
+	if vendor.name == "juniper-junos" {
+		factsStart(jctx, conn)
+	}
+
 	if vendor.subscribe == nil {
 		panic(fmt.Sprintf("could not found subscribe implementation for vendor %s", vendor.name))
 	}
+	jctx.conn.set(conn)
 	code := vendor.subscribe(conn, jctx, statusch)
+	jctx.conn.set(nil)
+	setConnected(jctx, false)
 
 	// close the current connection and retry
 	conn.Close()
@@ -336,11 +481,16 @@ connect:
 	switch code {
 	case SubRcSighupRestart:
 		jLog(jctx, fmt.Sprintf("sighup detected, reconnect with new config for worker %s", jctx.file))
+		recordEvent(jctx, EventResubscribe, "", "subscribing again with the new config")
 		retry = true
 		goto connect
 	case SubRcConnRetry:
-		jLog(jctx, fmt.Sprintf("subscribe returns, reconnecting after 10s for worker %s", jctx.file))
-		time.Sleep(10 * time.Second)
+		if failover(jctx, nil) {
+			retry = true
+			goto connect
+		}
+		jLogWarn(jctx, fmt.Sprintf("subscribe returns, reconnecting after %v for worker %s", reconnectDelay, jctx.file))
+		time.Sleep(reconnectDelay)
 		retry = true
 		goto connect
 	case SubRcSighupNoRestart: